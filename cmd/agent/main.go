@@ -23,6 +23,7 @@ func main() {
 		"version":   version.Version,
 		"pod":       os.Getenv("POD_NAME"),
 		"namespace": os.Getenv("POD_NAMESPACE"),
+		"mode":      config.GetEnv("APSS_MONITORING_MODE", "full"),
 	}).Info("Starting APSS Sidecar Agent")
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -37,13 +38,62 @@ func main() {
 		PodName:             cfg.PodName,
 		PodNamespace:        cfg.PodNamespace,
 		NodeName:            cfg.NodeName,
+		PodIP:               cfg.PodIP,
+		ServiceAccount:      cfg.ServiceAccount,
 		ControllerEndpoint:  cfg.ControllerEndpoint,
+		ControllerToken:     cfg.ControllerToken,
+		Version:             version.Version,
 		ProcScanInterval:    cfg.ProcScanInterval,
 		NetScanInterval:     cfg.NetScanInterval,
 		FileScanInterval:    cfg.FileScanInterval,
 		WatchPaths:          cfg.WatchPaths,
+		WatchExclude:        cfg.WatchExclude,
+		CredentialPaths:     cfg.CredentialPaths,
+		FileBaselineKey:     cfg.FileBaselineKey,
 		SuspiciousProcesses: cfg.SuspiciousProcesses,
 		SuspiciousPorts:     cfg.SuspiciousPorts,
+		ListenBaseline:      cfg.ListenBaseline,
+		SMTPPorts:           cfg.SMTPPorts,
+		IRCPorts:            cfg.IRCPorts,
+		FanoutConnections:   cfg.FanoutConnections,
+		FanoutDestinations:  cfg.FanoutDestinations,
+		FanoutSigma:         cfg.FanoutSigma,
+		ExeHashAllowlist:    cfg.ExeHashAllowlist,
+		ExeHashDenylist:     cfg.ExeHashDenylist,
+		DiskWatchPaths:      cfg.DiskWatchPaths,
+		DiskScanInterval:    cfg.DiskScanInterval,
+		DiskGrowthBytes:     cfg.DiskGrowthBytes,
+		DiskGrowthFiles:     cfg.DiskGrowthFiles,
+		DropWatchPaths:      cfg.DropWatchPaths,
+		InodeUsagePercent:   cfg.InodeUsagePercent,
+		FDUsagePercent:      cfg.FDUsagePercent,
+		HighCPUPercent:      cfg.HighCPUPercent,
+		HighCPUScans:        cfg.HighCPUScans,
+		ProcEventMode:       cfg.ProcEventMode,
+		ProcScanMinInterval: cfg.ProcScanMinInterval,
+		ProcScanSamples:     cfg.ProcScanSamples,
+		ProbeCommands:       cfg.ProbeCommands,
+		ExecProbePolicy:     cfg.ExecProbePolicy,
+		GPUMonitor:          cfg.GPUMonitor,
+		GPUWorkload:         cfg.GPUWorkload,
+		GPUScanInterval:     cfg.GPUScanInterval,
+		GPUAllowedProcesses: cfg.GPUAllowedProcesses,
+		GPUMetricsURL:       cfg.GPUMetricsURL,
+		GPUUtilPercent:      cfg.GPUUtilPercent,
+		GPUUtilScans:        cfg.GPUUtilScans,
+		DegradedMode:        cfg.MonitoringMode == "degraded",
+		MaxMonitorRestarts:  cfg.MaxMonitorRestarts,
+		HeartbeatInterval:   cfg.HeartbeatInterval,
+		StartupJitter:       cfg.StartupJitter,
+		HealthAddr:          cfg.HealthAddr,
+		BreakerThreshold:    cfg.BreakerThreshold,
+		BreakerCooldown:     cfg.BreakerCooldown,
+		SpoolDir:            cfg.SpoolDir,
+		SpoolMaxBytes:       cfg.SpoolMaxBytes,
+		WorkloadIdentity:    cfg.WorkloadIdentity,
+		ClusterName:         cfg.ClusterName,
+		Environment:         cfg.Environment,
+		RedactEnvSecrets:    cfg.RedactEnvSecrets,
 	}
 
 	mon, err := monitor.New(monCfg, log)
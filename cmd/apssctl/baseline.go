@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/cli"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+// runBaseline runs apssctl baseline capture, which hashes the files the
+// agent watches and prints them as an unsigned file baseline to import with
+// PUT /api/v1/baselines/{namespace}/{workload}. It returns the exit code.
+func runBaseline(args []string) int {
+	if len(args) == 0 || args[0] != "capture" {
+		usage()
+		return cli.ExitUsage
+	}
+	fs := flag.NewFlagSet("baseline", flag.ExitOnError)
+	fs.Usage = usage
+	watch := fs.String("watch", strings.Join(config.DefaultAgentConfig().WatchPaths, ","), "")
+	exclude := fs.String("exclude", config.GetEnv("WATCH_EXCLUDE", ""), "")
+	fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		usage()
+		return cli.ExitUsage
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	b, err := fileintegrity.Capture("", splitList(*watch), splitList(*exclude), log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		return cli.ExitUsage
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b); err != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		return cli.ExitError
+	}
+	return cli.ExitOK
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
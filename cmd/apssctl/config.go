@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/cli"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+// runConfig runs apssctl config validate, which checks a controller
+// configuration as the controller's -validate-config does. It returns the
+// exit code.
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		usage()
+		return cli.ExitUsage
+	}
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	fs.Usage = usage
+	envFile := fs.String("env-file", "", "")
+	fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		usage()
+		return cli.ExitUsage
+	}
+	if *envFile != "" {
+		if err := cli.LoadEnvFile(*envFile); err != nil {
+			fmt.Fprintln(os.Stderr, "apssctl:", err)
+			return cli.ExitUsage
+		}
+	}
+	return cli.ValidateConfig(os.Stdout, config.DefaultControllerConfig())
+}
@@ -0,0 +1,175 @@
+// apssctl lists alerts and agents and searches events from the APSS
+// controller API. apssctl alerts check exits non-zero when matching alerts
+// exist, for gating CI jobs and scripts; see cli.ExitOK and the other exit
+// codes. apssctl onboard enables sidecar injection for a namespace, and
+// apssctl baseline capture hashes files for a file integrity baseline, and
+// apssctl config validate checks a controller configuration.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/cli"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+func usage() {
+	names := make([]string, 0, len(cli.Resources))
+	for name := range cli.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, `Usage: apssctl <%s> [flags]
+       apssctl alerts check [flags]
+       apssctl onboard <namespace> [-restart] [-wait DURATION] [-kube-api URL]
+       apssctl baseline capture [-watch PATHS] [-exclude PATTERNS]
+       apssctl config validate [-env-file FILE]
+
+Flags:
+  -server URL      controller API (env APSS_SERVER, default http://localhost:8080)
+  -token TOKEN     operator bearer token (env APSS_TOKEN)
+  -o FORMAT        %s (default table)
+  -columns A,B,C   fields to print, in order
+
+Alert filters: -status, -severity, -namespace, -rule-id, -since, -limit
+  -since takes a timestamp (RFC 3339) or a duration back from now (1h)
+Search: -q TEXT (required), -namespace, -pod, -limit
+
+alerts check counts open and acknowledged alerts matching the alert
+filters; a single -severity also matches higher severities. -quiet prints
+nothing. Exit codes: 0 no matching alerts, 1 matching alerts, 2 usage
+error, 3 API error.
+
+onboard checks the controller and the injector webhook, labels the
+namespace apss.invisible.tech/injection=enabled and reports which pods are
+monitored. -restart rolls workloads without the sidecar and -wait waits
+for them. The Kubernetes API is -kube-api (env APSS_KUBE_API), in-cluster
+credentials, or kubectl proxy at http://127.0.0.1:8001. Exit codes: 0 all
+pods monitored, 1 some are not, 3 a check or API call failed.
+
+baseline capture hashes the files under -watch (default the agent's watch
+paths) less -exclude (env WATCH_EXCLUDE), such as at image build, and prints
+them as JSON to PUT to /api/v1/baselines/<namespace>/<workload>.
+
+config validate checks the controller configuration in the environment,
+plus the KEY=VALUE lines of -env-file, and the Sigma rules, playbooks, sink,
+mapping, token and key files it names, as the controller's -validate-config
+does. Exit codes: 0 valid, 1 problems found, 2 usage error.
+`, strings.Join(names, "|"), strings.Join(cli.Formats, ", "))
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(cli.ExitUsage)
+	}
+	name, args := os.Args[1], os.Args[2:]
+	switch name {
+	case "onboard":
+		os.Exit(runOnboard(args))
+	case "baseline":
+		os.Exit(runBaseline(args))
+	case "config":
+		os.Exit(runConfig(args))
+	}
+	res, ok := cli.Resources[name]
+	if !ok {
+		usage()
+		os.Exit(cli.ExitUsage)
+	}
+	check := name == "alerts" && len(args) > 0 && args[0] == "check"
+	if check {
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = usage
+	server := fs.String("server", config.GetEnv("APSS_SERVER", "http://localhost:8080"), "")
+	token := fs.String("token", config.GetEnv("APSS_TOKEN", ""), "")
+	format := fs.String("o", cli.FormatTable, "")
+	columns := fs.String("columns", "", "")
+	filters := map[string]*string{}
+	switch name {
+	case "alerts":
+		for _, f := range []string{"status", "severity", "namespace", "rule-id", "since", "limit"} {
+			filters[strings.ReplaceAll(f, "-", "_")] = fs.String(f, "", "")
+		}
+		if check {
+			delete(filters, "limit")
+		}
+	case "search":
+		for _, f := range []string{"q", "namespace", "pod", "limit"} {
+			filters[f] = fs.String(f, "", "")
+		}
+	}
+	quiet := fs.Bool("quiet", false, "")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		usage()
+		os.Exit(cli.ExitUsage)
+	}
+
+	query := url.Values{}
+	for k, v := range filters {
+		if *v != "" {
+			query.Set(k, *v)
+		}
+	}
+	if v := query.Get("since"); v != "" {
+		query.Set("since", cli.Since(v, time.Now()))
+	}
+	var cols []string
+	if *columns != "" {
+		for _, c := range strings.Split(*columns, ",") {
+			cols = append(cols, strings.TrimSpace(c))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client := cli.NewClient(*server, *token)
+	if check {
+		os.Exit(runCheck(ctx, client, query, *format, cols, res.Columns, *quiet))
+	}
+	records, err := client.List(ctx, res.Path, query)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		os.Exit(cli.ExitError)
+	}
+	if err := cli.Render(os.Stdout, *format, records, cols, res.Columns); err != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		os.Exit(cli.ExitUsage)
+	}
+}
+
+// runCheck runs alerts check and returns the exit code.
+func runCheck(ctx context.Context, client *cli.Client, query url.Values, format string, cols, defaults []string, quiet bool) int {
+	severity, err := cli.MinSeverity(query.Get("severity"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		return cli.ExitUsage
+	}
+	if severity != "" {
+		query.Set("severity", severity)
+	}
+	result, err := client.CheckAlerts(ctx, query)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		return cli.ExitError
+	}
+	if err := cli.RenderCheck(os.Stdout, format, result, cols, defaults, quiet); err != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		return cli.ExitUsage
+	}
+	if !result.Passed {
+		return cli.ExitFindings
+	}
+	return cli.ExitOK
+}
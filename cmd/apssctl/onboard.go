@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/cli"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// kubectlProxy is where kubectl proxy serves the Kubernetes API by default.
+const kubectlProxy = "http://127.0.0.1:8001"
+
+// runOnboard runs apssctl onboard and returns the exit code.
+func runOnboard(args []string) int {
+	var namespace string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		namespace, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("onboard", flag.ExitOnError)
+	fs.Usage = usage
+	server := fs.String("server", config.GetEnv("APSS_SERVER", "http://localhost:8080"), "")
+	token := fs.String("token", config.GetEnv("APSS_TOKEN", ""), "")
+	format := fs.String("o", cli.FormatTable, "")
+	kubeAPI := fs.String("kube-api", config.GetEnv("APSS_KUBE_API", ""), "")
+	restart := fs.Bool("restart", false, "")
+	wait := fs.Duration("wait", 0, "")
+	fs.Parse(args)
+	if namespace == "" && fs.NArg() > 0 {
+		// Flags may come before the namespace as well as after it.
+		namespace = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if namespace == "" || fs.NArg() > 0 {
+		usage()
+		return cli.ExitUsage
+	}
+
+	var kc *kube.Client
+	if *kubeAPI == "" {
+		kc, _ = kube.NewInCluster()
+	}
+	if kc == nil {
+		base := *kubeAPI
+		if base == "" {
+			base = kubectlProxy
+		}
+		kc = kube.NewClient(base, &http.Client{Timeout: 30 * time.Second})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute+*wait)
+	defer cancel()
+	report, err := cli.Onboard(ctx, cli.NewClient(*server, *token), kc, cli.OnboardOptions{
+		Namespace: namespace,
+		Restart:   *restart,
+		Wait:      *wait,
+	})
+	if rerr := cli.RenderOnboard(os.Stdout, *format, report); rerr != nil {
+		fmt.Fprintln(os.Stderr, "apssctl:", rerr)
+		return cli.ExitUsage
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "apssctl:", err)
+		if errors.Is(err, cli.ErrOnboardPrecheck) {
+			fmt.Fprintln(os.Stderr, "apssctl: namespace", namespace, "was not changed")
+		}
+		return cli.ExitError
+	case !report.Complete():
+		return cli.ExitFindings
+	}
+	return cli.ExitOK
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
@@ -9,12 +10,23 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/invisible-tech/autopilot-security-sensor/internal/cli"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/server"
 )
 
 func main() {
+	validate := flag.Bool("validate-config", false, "check the configuration and its rule, sink and key files, then exit")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "print the Postgres storage migrations that would be applied, then exit")
+	flag.Parse()
+	if *validate {
+		os.Exit(cli.ValidateConfig(os.Stderr, config.DefaultControllerConfig()))
+	}
+	if *migrateDryRun {
+		os.Exit(cli.MigrateDryRun(os.Stdout, config.DefaultControllerConfig()))
+	}
+
 	log := logrus.New()
 	log.SetFormatter(&logrus.JSONFormatter{})
 	log.SetLevel(logrus.InfoLevel)
@@ -38,4 +50,13 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 	_ = srv.Shutdown(ctx)
+	if err := ctrl.SaveState(); err != nil {
+		log.WithError(err).Error("Failed to save controller state")
+	}
+	if err := ctrl.CloseStorage(); err != nil {
+		log.WithError(err).Error("Failed to close storage")
+	}
+	if err := ctrl.ReleaseLeadership(ctx); err != nil {
+		log.WithError(err).Error("Failed to release controller leadership")
+	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"io"
 	"net/http"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
 	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
@@ -23,6 +25,59 @@ func main() {
 
 	cfg := config.DefaultWebhookConfig()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg.NativeSidecar = webhook.ResolveNativeSidecar(ctx, cfg.SidecarMode, webhook.InClusterServerVersion, log)
+
+	if namespaces, err := webhook.NewNamespaceCache(log); err != nil {
+		log.WithError(err).Warn("Namespace cache unavailable, namespace injection labels are ignored")
+	} else {
+		go namespaces.Run(ctx)
+		syncCtx, syncCancel := context.WithTimeout(ctx, 30*time.Second)
+		if !namespaces.WaitForSync(syncCtx) {
+			log.Warn("Namespace cache not synced yet, continuing with the default injection policy")
+		}
+		syncCancel()
+		cfg.NamespaceLabels = namespaces.Labels
+	}
+
+	exclusions, err := webhook.NewExclusionWatcher(cfg, log)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load injection exclusions")
+	}
+	go func() {
+		if err := exclusions.Watch(ctx); err != nil {
+			log.WithError(err).Error("Exclusions watcher stopped, rules will not reload")
+		}
+	}()
+
+	resources, err := webhook.NewResourceDefaultsWatcher(cfg, log)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load sidecar resource defaults")
+	}
+	go func() {
+		if err := resources.Watch(ctx); err != nil {
+			log.WithError(err).Error("Resource defaults watcher stopped, defaults will not reload")
+		}
+	}()
+
+	var policies webhook.ValidationPolicies
+	if policies.Images, err = webhook.LoadImagePolicies(cfg.ImagePolicyFile); err != nil {
+		log.WithError(err).Fatal("Failed to load image policies")
+	}
+	if policies.Posture, err = webhook.LoadPosturePolicies(cfg.PosturePolicyFile); err != nil {
+		log.WithError(err).Fatal("Failed to load posture policies")
+	}
+	if cfg.OPAURL != "" {
+		if policies.OPA, err = webhook.NewOPA(cfg, log); err != nil {
+			log.WithError(err).Fatal("Failed to set up OPA admission policy")
+		}
+		log.WithField("url", cfg.OPAURL).Info("Delegating admission decisions to OPA")
+	}
+	audit := webhook.NewAuditReporter(cfg.ControllerEndpoint, cfg.AgentToken, log)
+	go audit.Run(ctx)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/mutate", func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
@@ -30,7 +85,7 @@ func main() {
 			http.Error(w, "Failed to read request body", http.StatusBadRequest)
 			return
 		}
-		respBody, err := webhook.ProcessAdmissionReview(body, cfg, log)
+		respBody, err := webhook.ProcessAdmissionReview(body, resources.Apply(exclusions.Apply(cfg)), log)
 		if err != nil {
 			log.WithError(err).Error("Admission review failed")
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -39,20 +94,67 @@ func main() {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(respBody)
 	})
+	mux.HandleFunc("/validate", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		respBody, err := webhook.ProcessValidationReview(body, policies, audit, log)
+		if err != nil {
+			log.WithError(err).Error("Validation review failed")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(respBody)
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/report/degraded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(webhook.DegradedPods())
+	})
+	mux.HandleFunc("/api/v1/exclusions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exclusions.Status())
+	})
+	mux.HandleFunc("/api/v1/resources", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resources.Status())
+	})
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
-	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if cfg.CertBootstrap {
+		bootstrap, err := webhook.NewCertBootstrapper(cfg, log)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to set up certificate bootstrap")
+		}
+		ensureCtx, ensureCancel := context.WithTimeout(ctx, 30*time.Second)
+		err = bootstrap.Ensure(ensureCtx)
+		ensureCancel()
+		if err != nil {
+			log.WithError(err).Fatal("Failed to bootstrap webhook certificates")
+		}
+		go bootstrap.Run(ctx)
+	}
+
+	certs, err := webhook.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, log)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to load TLS certificates")
 	}
+	go func() {
+		if err := certs.Watch(ctx); err != nil {
+			log.WithError(err).Error("Certificate watcher stopped, rotated certificates need a restart")
+		}
+	}()
 
 	server := &http.Server{
 		Addr:      cfg.HTTPAddr,
 		Handler:   mux,
-		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		TLSConfig: &tls.Config{GetCertificate: certs.GetCertificate},
 	}
 
 	go func() {
@@ -60,9 +162,10 @@ func main() {
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
 		log.Info("Shutting down webhook server")
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		_ = server.Shutdown(ctx)
+		cancel()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer shutdownCancel()
+		_ = server.Shutdown(shutdownCtx)
 	}()
 
 	log.WithField("addr", cfg.HTTPAddr).Info("Starting APSS webhook server")
@@ -47,3 +47,41 @@ Selector labels
 app.kubernetes.io/name: {{ include "apss.name" . }}
 app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
+
+{{/*
+Proxy and TLS settings of one outbound integration, as env vars. Takes a list
+of the env var prefix and the integration's egress values.
+*/}}
+{{- define "apss.egressEnv" -}}
+{{- $prefix := index . 0 }}
+{{- with index . 1 }}
+{{- if .proxyURL }}
+- name: {{ $prefix }}_PROXY_URL
+  value: {{ .proxyURL | quote }}
+{{- end }}
+{{- if .caFile }}
+- name: {{ $prefix }}_CA_FILE
+  value: {{ .caFile | quote }}
+{{- end }}
+{{- if .tlsSkipVerify }}
+- name: {{ $prefix }}_TLS_SKIP_VERIFY
+  value: "true"
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+Digest mode of one notifier, as env vars. Takes a list of the env var prefix
+and the notifier's digest values.
+*/}}
+{{- define "apss.digestEnv" -}}
+{{- $prefix := index . 0 }}
+{{- with index . 1 }}
+{{- if .severities }}
+- name: {{ $prefix }}_DIGEST_SEVERITIES
+  value: {{ join "," .severities | quote }}
+- name: {{ $prefix }}_DIGEST_WINDOW
+  value: {{ .window | default "15m" | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
@@ -0,0 +1,118 @@
+// Package breaker provides the circuit breaker the agent's controller client
+// and the Sweet Security client put in front of their sends.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is a breaker's state. Its values are what the clients export as
+// their breaker state gauges.
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker is a circuit breaker. After threshold consecutive failures it
+// opens and rejects requests for cooldown; it then lets a single trial
+// request through (half-open) and closes again only if that request
+// succeeds. A threshold of zero or less disables it.
+type Breaker struct {
+	// Now returns the current time. Tests replace it.
+	Now func() time.Time
+
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// New returns a closed breaker.
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Now: time.Now, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a request may be sent now. Once the cooldown has
+// passed the first caller makes the trial request; others keep being
+// rejected until its outcome is recorded. Every allowed request must be
+// followed by Record or Abandon.
+func (b *Breaker) Allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if b.Now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state, b.trial = HalfOpen, true
+		return true
+	case HalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record updates the breaker with a request's outcome and returns the state
+// transition, if any, so the caller can log it.
+func (b *Breaker) Record(ok bool) (from, to State) {
+	if b.threshold <= 0 {
+		return Closed, Closed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	from, b.trial = b.state, false
+	if ok {
+		b.state, b.failures = Closed, 0
+		return from, b.state
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt = Open, b.Now()
+	}
+	return from, b.state
+}
+
+// Abandon records a request the caller gave up on, which says nothing about
+// the destination. A trial request abandoned lets the next one through.
+func (b *Breaker) Abandon() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// State returns the breaker's current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
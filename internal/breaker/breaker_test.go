@@ -0,0 +1,93 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker_OpensAfterThreshold(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := New(3, 30*time.Second)
+	b.Now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("attempt %d rejected before threshold", i)
+		}
+		b.Record(false)
+	}
+	if !b.Allow() {
+		t.Fatal("third attempt should still be allowed")
+	}
+	if from, to := b.Record(false); from != Closed || to != Open {
+		t.Fatalf("transition %s -> %s, want closed -> open", from, to)
+	}
+	if b.Allow() {
+		t.Error("open breaker should reject during cooldown")
+	}
+
+	// After the cooldown one trial goes through; others wait for its result.
+	now = now.Add(30 * time.Second)
+	if !b.Allow() {
+		t.Fatal("trial should be allowed after cooldown")
+	}
+	if b.State() != HalfOpen {
+		t.Errorf("state = %s, want half-open", b.State())
+	}
+	if b.Allow() {
+		t.Error("only one half-open trial should be allowed")
+	}
+	if from, to := b.Record(false); from != HalfOpen || to != Open {
+		t.Fatalf("failed trial: %s -> %s, want half-open -> open", from, to)
+	}
+	if b.Allow() {
+		t.Error("failed trial should restart the cooldown")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !b.Allow() {
+		t.Fatal("second trial should be allowed")
+	}
+	if from, to := b.Record(true); from != HalfOpen || to != Closed {
+		t.Fatalf("successful trial: %s -> %s, want half-open -> closed", from, to)
+	}
+	if !b.Allow() {
+		t.Error("closed breaker should allow requests")
+	}
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b := New(2, time.Minute)
+	b.Record(false)
+	b.Record(true)
+	b.Record(false)
+	if !b.Allow() {
+		t.Error("failures separated by a success should not open the breaker")
+	}
+}
+
+func TestBreaker_AbandonedTrial(t *testing.T) {
+	now := time.Now()
+	b := New(1, time.Minute)
+	b.Now = func() time.Time { return now }
+	b.Allow()
+	b.Record(false)
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Abandon()
+	if !b.Allow() {
+		t.Error("abandoned trial blocked the next one")
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	for _, threshold := range []int{0, -1} {
+		b := New(threshold, time.Minute)
+		for i := 0; i < 10; i++ {
+			b.Record(false)
+		}
+		if !b.Allow() || b.State() != Closed {
+			t.Errorf("threshold %d should disable the breaker", threshold)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// apssctl exit codes, stable for scripts.
+const (
+	// ExitOK is success; for alerts check, no matching alerts.
+	ExitOK = 0
+	// ExitFindings is alerts check finding matching alerts.
+	ExitFindings = 1
+	// ExitUsage is an unknown command, flag or flag value.
+	ExitUsage = 2
+	// ExitError is a failure to reach or read the controller API.
+	ExitError = 3
+)
+
+// activeStatuses are the alert statuses alerts check counts by default.
+var activeStatuses = []string{types.AlertStatusOpen, types.AlertStatusAcked}
+
+// checkPageSize is the alerts fetched per status; the API's maximum.
+const checkPageSize = 1000
+
+// CheckResult is the outcome of alerts check. Alerts holds at most one
+// page per status; Matched counts them all.
+type CheckResult struct {
+	Passed  bool     `json:"passed"`
+	Matched int      `json:"matched"`
+	Alerts  []Record `json:"alerts"`
+}
+
+// CheckAlerts counts the alerts matching query. Without a status it counts
+// open and acknowledged alerts, the ones still needing attention.
+func (c *Client) CheckAlerts(ctx context.Context, query url.Values) (CheckResult, error) {
+	res := CheckResult{Alerts: []Record{}}
+	statuses := activeStatuses
+	if s := query.Get("status"); s != "" {
+		statuses = []string{s}
+	}
+	for _, status := range statuses {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("status", status)
+		q.Set("limit", fmt.Sprint(checkPageSize))
+		records, total, err := c.Page(ctx, "/api/v1/alerts", q)
+		if err != nil {
+			return res, err
+		}
+		res.Matched += total
+		res.Alerts = append(res.Alerts, records...)
+	}
+	res.Passed = res.Matched == 0
+	return res, nil
+}
+
+// MinSeverity expands a single severity to it and every higher one, so
+// "high" selects HIGH and CRITICAL. Lists are returned as they are.
+func MinSeverity(severity string) (string, error) {
+	if severity == "" || strings.Contains(severity, ",") {
+		return severity, nil
+	}
+	floor := types.SeverityRank(strings.ToUpper(severity))
+	if floor == 0 {
+		return "", fmt.Errorf("invalid severity %q", severity)
+	}
+	var out []string
+	for _, s := range []string{"INFO", "LOW", "MEDIUM", "HIGH", "CRITICAL"} {
+		if types.SeverityRank(s) >= floor {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+// Since converts a -since value to RFC 3339: durations such as 1h or 30m
+// count back from now, and timestamps pass through.
+func Since(v string, now time.Time) string {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d).UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// RenderCheck writes a check result. Table output lists the matching
+// alerts and ends with a PASS or FAIL line; JSON and JSONL output is the
+// result as one object; CSV output is the alerts alone. quiet writes
+// nothing.
+func RenderCheck(w io.Writer, format string, res CheckResult, columns, defaults []string, quiet bool) error {
+	if quiet {
+		return nil
+	}
+	switch format {
+	case FormatJSON, FormatJSONL:
+		res.Alerts = project(res.Alerts, columns)
+		enc := json.NewEncoder(w)
+		if format == FormatJSON {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(res)
+	case FormatCSV:
+		return Render(w, format, res.Alerts, columns, defaults)
+	case FormatTable:
+	default:
+		return Render(w, format, nil, nil, nil)
+	}
+	if res.Passed {
+		_, err := fmt.Fprintln(w, "PASS: no matching alerts")
+		return err
+	}
+	if err := Render(w, format, res.Alerts, columns, defaults); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "FAIL: %d matching alerts\n", res.Matched)
+	return err
+}
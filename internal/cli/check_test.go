@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_CheckAlerts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("namespace") != "prod" || q.Get("limit") != "1000" {
+			t.Errorf("request %s", r.URL)
+		}
+		switch q.Get("status") {
+		case "open":
+			// A page shorter than the total.
+			w.Header().Set("X-Total-Count", "3")
+			w.Write([]byte(`[{"id":"a1"},{"id":"a2"}]`))
+		case "acked":
+			w.Write([]byte(`[{"id":"a3"}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "")
+
+	res, err := c.CheckAlerts(context.Background(), url.Values{"namespace": {"prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Passed || res.Matched != 4 || len(res.Alerts) != 3 {
+		t.Errorf("result = %+v", res)
+	}
+	if res, _ := c.CheckAlerts(context.Background(), url.Values{"namespace": {"prod"}, "status": {"resolved"}}); !res.Passed || res.Matched != 0 {
+		t.Errorf("resolved only: %+v", res)
+	}
+	if _, err := NewClient("http://127.0.0.1:1", "").CheckAlerts(context.Background(), nil); err == nil {
+		t.Error("expected error for unreachable controller")
+	}
+}
+
+func TestRenderCheck(t *testing.T) {
+	fail := CheckResult{Matched: 1, Alerts: []Record{{"id": "a1", "severity": "HIGH"}}}
+	var buf bytes.Buffer
+	if err := RenderCheck(&buf, FormatTable, fail, nil, []string{"id", "severity"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "a1") || !strings.HasSuffix(out, "FAIL: 1 matching alerts\n") {
+		t.Errorf("table = %q", out)
+	}
+
+	buf.Reset()
+	RenderCheck(&buf, FormatJSON, fail, []string{"id"}, nil, false)
+	var got struct {
+		Passed  bool
+		Matched int
+		Alerts  []map[string]string
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil || got.Passed || got.Matched != 1 || len(got.Alerts[0]) != 1 {
+		t.Errorf("json = %s (%v)", buf.String(), err)
+	}
+
+	buf.Reset()
+	RenderCheck(&buf, FormatTable, CheckResult{Passed: true}, nil, nil, false)
+	if buf.String() != "PASS: no matching alerts\n" {
+		t.Errorf("pass = %q", buf.String())
+	}
+	buf.Reset()
+	if RenderCheck(&buf, FormatTable, fail, nil, nil, true); buf.Len() != 0 {
+		t.Errorf("quiet wrote %q", buf.String())
+	}
+	if err := RenderCheck(&buf, "yaml", CheckResult{Passed: true}, nil, nil, false); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestMinSeverity(t *testing.T) {
+	for in, want := range map[string]string{
+		"":             "",
+		"high":         "HIGH,CRITICAL",
+		"MEDIUM":       "MEDIUM,HIGH,CRITICAL",
+		"LOW,CRITICAL": "LOW,CRITICAL",
+	} {
+		if got, err := MinSeverity(in); err != nil || got != want {
+			t.Errorf("MinSeverity(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := MinSeverity("severe"); err == nil {
+		t.Error("expected error for unknown severity")
+	}
+}
+
+func TestSince(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := Since("1h", now); got != "2026-03-01T11:00:00Z" {
+		t.Errorf("Since(1h) = %s", got)
+	}
+	if got := Since("2026-02-01T00:00:00Z", now); got != "2026-02-01T00:00:00Z" {
+		t.Errorf("timestamp changed to %s", got)
+	}
+}
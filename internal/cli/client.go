@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resource is a list endpoint apssctl can print.
+type Resource struct {
+	Path string
+	// Columns are the default table and CSV columns.
+	Columns []string
+}
+
+// Resources are the list commands, by name.
+var Resources = map[string]Resource{
+	"alerts": {
+		Path:    "/api/v1/alerts",
+		Columns: []string{"id", "timestamp", "severity", "rule_id", "rule_name", "pod_namespace", "pod_name", "status"},
+	},
+	"agents": {
+		Path:    "/api/v1/agents",
+		Columns: []string{"id", "pod_namespace", "pod_name", "status", "version", "last_seen", "event_count"},
+	},
+	"rules": {
+		Path:    "/api/v1/rules/coverage",
+		Columns: []string{"rule_id", "rule_name", "severity", "shadow", "disabled", "matches", "shadow_matches", "last_fired_at"},
+	},
+	"search": {
+		Path:    "/api/v1/search",
+		Columns: []string{"timestamp", "type", "severity", "pod_namespace", "pod_name", "field", "value"},
+	},
+}
+
+// Client calls the controller API with an operator token.
+type Client struct {
+	Server string
+	Token  string
+	HTTP   *http.Client
+}
+
+// NewClient returns a client for the controller at server (a base URL).
+func NewClient(server, token string) *Client {
+	return &Client{Server: strings.TrimSuffix(server, "/"), Token: token, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Health checks that the controller answers its health endpoint.
+func (c *Client) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Server+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET /health: %s", resp.Status)
+	}
+	return nil
+}
+
+// List fetches a JSON array from path with query and decodes it. Numbers are
+// kept as json.Number so IDs and counts print exactly.
+func (c *Client) List(ctx context.Context, path string, query url.Values) ([]Record, error) {
+	records, _, err := c.Page(ctx, path, query)
+	return records, err
+}
+
+// Page is List that also returns the total number of matches from the
+// X-Total-Count header, or the number of records without one.
+func (c *Client) Page(ctx context.Context, path string, query url.Values) ([]Record, int, error) {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, 0, fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	var records []Record
+	if err := dec.Decode(&records); err != nil {
+		return nil, 0, fmt.Errorf("decode %s: %w", path, err)
+	}
+	total, err := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	if err != nil {
+		total = len(records)
+	}
+	return records, total, nil
+}
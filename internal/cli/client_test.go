@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClient_List(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer op" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/alerts" || r.URL.Query().Get("status") != "open" {
+			t.Errorf("request %s", r.URL)
+		}
+		w.Write([]byte(`[{"id":"a1","event_count":12345678901}]`))
+	}))
+	defer srv.Close()
+
+	records, err := NewClient(srv.URL+"/", "op").List(context.Background(), "/api/v1/alerts", url.Values{"status": {"open"}})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(records) != 1 || records[0]["event_count"] != json.Number("12345678901") {
+		t.Errorf("records = %v", records)
+	}
+
+	if _, err := NewClient(srv.URL, "").List(context.Background(), "/api/v1/alerts", nil); err == nil {
+		t.Error("expected error on 401")
+	}
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/storage"
+)
+
+// MigrateDryRun prints the Postgres storage schema version and the SQL of
+// every migration the controller would apply at startup, without applying
+// them. It returns ExitFindings when migrations are pending and ExitUsage
+// when storage is not Postgres.
+func MigrateDryRun(w io.Writer, cfg config.ControllerConfig) int {
+	if cfg.StorageBackend != storage.BackendPostgres {
+		fmt.Fprintf(w, "STORAGE_BACKEND is %q; only postgres has schema migrations\n", cfg.StorageBackend)
+		return ExitUsage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	status, err := storage.PlanMigrations(ctx, cfg.StoragePostgresDSN)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return ExitError
+	}
+	return printMigrationPlan(w, status)
+}
+
+func printMigrationPlan(w io.Writer, status *storage.MigrationStatus) int {
+	fmt.Fprintf(w, "schema version %d, latest %d\n", status.Version, status.Latest)
+	if status.Version > status.Latest {
+		fmt.Fprintln(w, storage.ErrSchemaTooNew)
+		return ExitError
+	}
+	if len(status.Pending) == 0 {
+		fmt.Fprintln(w, "no pending migrations")
+		return ExitOK
+	}
+	for _, m := range status.Pending {
+		fmt.Fprintf(w, "\n-- %04d_%s\n%s\n", m.Version, m.Name, strings.TrimSpace(m.SQL))
+	}
+	fmt.Fprintf(w, "\n%d pending migration(s)\n", len(status.Pending))
+	return ExitFindings
+}
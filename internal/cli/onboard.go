@@ -0,0 +1,372 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// Labels, annotations and names the sidecar injector reads and writes; see
+// internal/webhook.
+const (
+	labelInjection         = "apss.invisible.tech/injection"
+	labelInjectOptOut      = "apss.invisible.tech/inject"
+	annotationInjected     = "apss.invisible.tech/injected"
+	annotationOnboarded    = "apss.invisible.tech/onboarded-at"
+	injectorWebhookName    = "sidecar-injector.apss.invisible.tech"
+	sidecarContainerName   = "apss-agent"
+	namespaceNameLabel     = "kubernetes.io/metadata.name"
+	restartedAtAnnotation  = "kubectl.kubernetes.io/restartedAt"
+	defaultOnboardInterval = 5 * time.Second
+)
+
+// ErrOnboardPrecheck is returned when a check that runs before the
+// namespace is changed fails; the namespace is left as it was.
+var ErrOnboardPrecheck = errors.New("onboarding check failed")
+
+// OnboardOptions configures Onboard.
+type OnboardOptions struct {
+	Namespace string
+	// Restart rolls the Deployments, StatefulSets and DaemonSets that own
+	// pods without the sidecar, as kubectl rollout restart does.
+	Restart bool
+	// Wait is how long to wait for every pod to be covered before
+	// reporting; zero reports at once.
+	Wait time.Duration
+	// Interval is how often coverage is polled while waiting.
+	Interval time.Duration
+}
+
+// OnboardStep is one check or change made while onboarding.
+type OnboardStep struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// PodCoverage is whether a pod has the sidecar and its agent has
+// registered with the controller.
+type PodCoverage struct {
+	Pod         string `json:"pod"`
+	Phase       string `json:"phase"`
+	Injected    bool   `json:"injected"`
+	Agent       string `json:"agent,omitempty"`
+	AgentStatus string `json:"agent_status,omitempty"`
+	Covered     bool   `json:"covered"`
+}
+
+// OnboardReport is the outcome of onboarding a namespace.
+type OnboardReport struct {
+	Namespace string        `json:"namespace"`
+	Steps     []OnboardStep `json:"steps"`
+	// Restarted names the workloads rolled, as kind/name.
+	Restarted []string      `json:"restarted,omitempty"`
+	Pods      []PodCoverage `json:"pods"`
+	Covered   int           `json:"covered"`
+	Total     int           `json:"total"`
+}
+
+// Complete reports whether every running pod in the namespace is covered.
+func (r *OnboardReport) Complete() bool {
+	return r.Covered == r.Total
+}
+
+func (r *OnboardReport) step(name string, err error, detail string) error {
+	s := OnboardStep{Name: name, OK: err == nil, Detail: detail}
+	if err != nil {
+		s.Detail = err.Error()
+	}
+	r.Steps = append(r.Steps, s)
+	return err
+}
+
+// Onboard enables sidecar injection for a namespace. It first checks that
+// the controller answers, that the namespace exists and that the injector
+// webhook is installed, would select the namespace and answers through the
+// API server; if any check fails it returns ErrOnboardPrecheck without
+// changing anything. It then labels the namespace, optionally restarts the
+// workloads whose pods lack the sidecar, and reports per-pod coverage.
+func Onboard(ctx context.Context, api *Client, kc *kube.Client, opts OnboardOptions) (*OnboardReport, error) {
+	ns := opts.Namespace
+	report := &OnboardReport{Namespace: ns, Pods: []PodCoverage{}}
+
+	if err := report.step("controller", api.Health(ctx), api.Server); err != nil {
+		return report, fmt.Errorf("%w: controller: %v", ErrOnboardPrecheck, err)
+	}
+	var namespace corev1.Namespace
+	err := kc.Get(ctx, "/api/v1/namespaces/"+url.PathEscape(ns), &namespace)
+	if kube.IsStatus(err, http.StatusNotFound) {
+		err = fmt.Errorf("namespace %s not found", ns)
+	}
+	if report.step("namespace", err, ns) != nil {
+		return report, fmt.Errorf("%w: %v", ErrOnboardPrecheck, err)
+	}
+	detail, err := checkInjector(ctx, kc, onboardedLabels(ns, namespace.Labels))
+	if report.step("webhook", err, detail) != nil {
+		return report, fmt.Errorf("%w: webhook: %v", ErrOnboardPrecheck, err)
+	}
+
+	patch := map[string]interface{}{"metadata": map[string]interface{}{
+		"labels":      map[string]interface{}{labelInjection: "enabled", labelInjectOptOut: nil},
+		"annotations": map[string]string{annotationOnboarded: time.Now().UTC().Format(time.RFC3339)},
+	}}
+	err = kc.Send(ctx, http.MethodPatch, "/api/v1/namespaces/"+url.PathEscape(ns), "application/merge-patch+json", patch, nil)
+	if report.step("label", err, labelInjection+"=enabled") != nil {
+		return report, err
+	}
+
+	pods, err := listPods(ctx, kc, ns)
+	if err != nil {
+		return report, err
+	}
+	if opts.Restart {
+		restarted, err := restartUninjected(ctx, kc, ns, pods)
+		report.Restarted = restarted
+		if report.step("restart", err, fmt.Sprintf("%d workloads", len(restarted))) != nil {
+			return report, err
+		}
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultOnboardInterval
+	}
+	deadline := time.Now().Add(opts.Wait)
+	for {
+		if err := report.coverage(ctx, api, pods); err != nil {
+			return report, err
+		}
+		if report.Complete() || !time.Now().Before(deadline) {
+			return report, nil
+		}
+		select {
+		case <-ctx.Done():
+			return report, nil
+		case <-time.After(interval):
+		}
+		if pods, err = listPods(ctx, kc, ns); err != nil {
+			return report, err
+		}
+	}
+}
+
+// onboardedLabels are a namespace's labels once Onboard has labelled it.
+func onboardedLabels(ns string, current map[string]string) labels.Set {
+	set := labels.Set{namespaceNameLabel: ns}
+	for k, v := range current {
+		set[k] = v
+	}
+	set[labelInjection] = "enabled"
+	delete(set, labelInjectOptOut)
+	return set
+}
+
+// checkInjector finds the sidecar injector webhook, checks its namespace
+// selector matches nsLabels and calls its health endpoint through the API
+// server's service proxy.
+func checkInjector(ctx context.Context, kc *kube.Client, nsLabels labels.Set) (string, error) {
+	var configs admissionregistrationv1.MutatingWebhookConfigurationList
+	if err := kc.Get(ctx, "/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations", &configs); err != nil {
+		return "", err
+	}
+	for _, cfg := range configs.Items {
+		for _, wh := range cfg.Webhooks {
+			if wh.Name != injectorWebhookName {
+				continue
+			}
+			if wh.NamespaceSelector != nil {
+				selector, err := metav1.LabelSelectorAsSelector(wh.NamespaceSelector)
+				if err != nil {
+					return "", fmt.Errorf("%s: namespace selector: %w", cfg.Name, err)
+				}
+				if !selector.Matches(nsLabels) {
+					return "", fmt.Errorf("%s excludes namespace %s (webhook.excludeNamespaces)", cfg.Name, nsLabels[namespaceNameLabel])
+				}
+			}
+			svc := wh.ClientConfig.Service
+			if svc == nil {
+				return cfg.Name, nil
+			}
+			port := int32(443)
+			if svc.Port != nil {
+				port = *svc.Port
+			}
+			path := fmt.Sprintf("/api/v1/namespaces/%s/services/https:%s:%d/proxy/health", url.PathEscape(svc.Namespace), url.PathEscape(svc.Name), port)
+			body, err := kc.Open(ctx, path)
+			if err != nil {
+				return "", fmt.Errorf("service %s/%s unreachable: %w", svc.Namespace, svc.Name, err)
+			}
+			body.Close()
+			return fmt.Sprintf("%s (service %s/%s)", cfg.Name, svc.Namespace, svc.Name), nil
+		}
+	}
+	return "", fmt.Errorf("no MutatingWebhookConfiguration has webhook %s; is APSS installed?", injectorWebhookName)
+}
+
+// listPods returns the namespace's pods that are running or starting.
+func listPods(ctx context.Context, kc *kube.Client, ns string) ([]corev1.Pod, error) {
+	var list corev1.PodList
+	if err := kc.Get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/pods", url.PathEscape(ns)), &list); err != nil {
+		return nil, err
+	}
+	pods := list.Items[:0]
+	for _, pod := range list.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+func injected(pod *corev1.Pod) bool {
+	if pod.Annotations[annotationInjected] == "true" {
+		return true
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == sidecarContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+// restartUninjected rolls each Deployment, StatefulSet and DaemonSet whose
+// selector matches a pod without the sidecar, and returns them as kind/name.
+func restartUninjected(ctx context.Context, kc *kube.Client, ns string, pods []corev1.Pod) ([]string, error) {
+	var missing []labels.Set
+	for i := range pods {
+		if !injected(&pods[i]) {
+			missing = append(missing, pods[i].Labels)
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	type workload struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+		Spec     struct {
+			Selector *metav1.LabelSelector `json:"selector"`
+		} `json:"spec"`
+	}
+	restartedAt := time.Now().UTC().Format(time.RFC3339)
+	patch := map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]string{restartedAtAnnotation: restartedAt}},
+	}}}
+	var restarted []string
+	for _, kind := range []string{"deployments", "statefulsets", "daemonsets"} {
+		var list struct {
+			Items []workload `json:"items"`
+		}
+		base := fmt.Sprintf("/apis/%s/namespaces/%s/%s", appsv1.SchemeGroupVersion, url.PathEscape(ns), kind)
+		if err := kc.Get(ctx, base, &list); err != nil {
+			return restarted, err
+		}
+		for _, w := range list.Items {
+			if w.Spec.Selector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(w.Spec.Selector)
+			if err != nil || selector.Empty() {
+				continue
+			}
+			for _, podLabels := range missing {
+				if !selector.Matches(podLabels) {
+					continue
+				}
+				if err := kc.Send(ctx, http.MethodPatch, base+"/"+url.PathEscape(w.Metadata.Name), "application/merge-patch+json", patch, nil); err != nil {
+					return restarted, err
+				}
+				restarted = append(restarted, strings.TrimSuffix(kind, "s")+"/"+w.Metadata.Name)
+				break
+			}
+		}
+	}
+	return restarted, nil
+}
+
+// coverage fills the report's pods from pods and the registered agents.
+func (r *OnboardReport) coverage(ctx context.Context, api *Client, pods []corev1.Pod) error {
+	agents, err := api.List(ctx, Resources["agents"].Path, nil)
+	if err != nil {
+		return err
+	}
+	byPod := make(map[string]Record)
+	for _, a := range agents {
+		if cell(a["pod_namespace"]) == r.Namespace {
+			byPod[cell(a["pod_name"])] = a
+		}
+	}
+	r.Pods, r.Covered, r.Total = []PodCoverage{}, 0, len(pods)
+	for i := range pods {
+		pc := PodCoverage{Pod: pods[i].Name, Phase: string(pods[i].Status.Phase), Injected: injected(&pods[i])}
+		if a, ok := byPod[pc.Pod]; ok {
+			pc.Agent, pc.AgentStatus = cell(a["id"]), cell(a["status"])
+		}
+		pc.Covered = pc.Injected && pc.Agent != ""
+		if pc.Covered {
+			r.Covered++
+		}
+		r.Pods = append(r.Pods, pc)
+	}
+	return nil
+}
+
+// RenderOnboard writes an onboarding report: with format json the report
+// as one object, otherwise the steps, a pod coverage table and a summary.
+func RenderOnboard(w io.Writer, format string, r *OnboardReport) error {
+	switch format {
+	case FormatJSON, FormatJSONL:
+		enc := json.NewEncoder(w)
+		if format == FormatJSON {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(r)
+	case FormatTable:
+	default:
+		return fmt.Errorf("unknown output format %q for onboard (want table, json or jsonl)", format)
+	}
+	for _, s := range r.Steps {
+		status := "ok"
+		if !s.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%-4s  %-10s  %s\n", status, s.Name, s.Detail)
+	}
+	for _, name := range r.Restarted {
+		fmt.Fprintf(w, "restarted %s\n", name)
+	}
+	if len(r.Steps) == 0 || !r.Steps[len(r.Steps)-1].OK {
+		return nil
+	}
+	if len(r.Pods) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "POD\tPHASE\tINJECTED\tAGENT\tAGENT_STATUS\tCOVERED")
+		for _, p := range r.Pods {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Pod, p.Phase, strconv.FormatBool(p.Injected), p.Agent, p.AgentStatus, strconv.FormatBool(p.Covered))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\nCoverage: %d/%d pods in %s monitored\n", r.Covered, r.Total, r.Namespace)
+	return err
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// fakeOnboardCluster serves the Kubernetes reads Onboard makes and records
+// its patches by path.
+func fakeOnboardCluster(t *testing.T, excluded string) (*httptest.Server, map[string]string) {
+	var mu sync.Mutex
+	patches := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			if ct := r.Header.Get("Content-Type"); ct != "application/merge-patch+json" {
+				t.Errorf("PATCH %s content type %q", r.URL.Path, ct)
+			}
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			patches[r.URL.Path] = string(body)
+			mu.Unlock()
+			w.Write([]byte(`{}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/prod":
+			w.Write([]byte(`{"metadata":{"name":"prod","labels":{"apss.invisible.tech/inject":"false"}}}`))
+		case "/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations":
+			w.Write([]byte(`{"items":[{"metadata":{"name":"apss-webhook"},"webhooks":[{
+				"name":"sidecar-injector.apss.invisible.tech",
+				"clientConfig":{"service":{"namespace":"apss-system","name":"apss-webhook","port":443}},
+				"namespaceSelector":{"matchExpressions":[
+					{"key":"kubernetes.io/metadata.name","operator":"NotIn","values":["kube-system","` + excluded + `"]},
+					{"key":"apss.invisible.tech/inject","operator":"NotIn","values":["false"]}]}}]}]}`))
+		case "/api/v1/namespaces/apss-system/services/https:apss-webhook:443/proxy/health":
+			w.Write([]byte("OK"))
+		case "/api/v1/namespaces/prod/pods":
+			w.Write([]byte(`{"items":[
+				{"metadata":{"name":"web-1","labels":{"app":"web"},"annotations":{"apss.invisible.tech/injected":"true"}},"status":{"phase":"Running"}},
+				{"metadata":{"name":"api-1","labels":{"app":"api"}},"status":{"phase":"Running"}},
+				{"metadata":{"name":"job-1","labels":{"app":"job"}},"status":{"phase":"Succeeded"}}]}`))
+		case "/apis/apps/v1/namespaces/prod/deployments":
+			w.Write([]byte(`{"items":[
+				{"metadata":{"name":"web"},"spec":{"selector":{"matchLabels":{"app":"web"}}}},
+				{"metadata":{"name":"api"},"spec":{"selector":{"matchLabels":{"app":"api"}}}}]}`))
+		case "/apis/apps/v1/namespaces/prod/statefulsets", "/apis/apps/v1/namespaces/prod/daemonsets":
+			w.Write([]byte(`{"items":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv, patches
+}
+
+func fakeController(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"status":"healthy"}`))
+		case "/api/v1/agents":
+			w.Write([]byte(`[{"id":"web-1-prod","pod_namespace":"prod","pod_name":"web-1","status":"healthy"},
+				{"id":"api-1-dev","pod_namespace":"dev","pod_name":"api-1","status":"healthy"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOnboard(t *testing.T) {
+	cluster, patches := fakeOnboardCluster(t, "other")
+	defer cluster.Close()
+	ctrl := fakeController(t)
+	defer ctrl.Close()
+
+	report, err := Onboard(context.Background(), NewClient(ctrl.URL, ""), kube.NewClient(cluster.URL, cluster.Client()),
+		OnboardOptions{Namespace: "prod", Restart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range report.Steps {
+		if !s.OK {
+			t.Errorf("step %s failed: %s", s.Name, s.Detail)
+		}
+	}
+	ns := patches["/api/v1/namespaces/prod"]
+	if !strings.Contains(ns, `"apss.invisible.tech/injection":"enabled"`) || !strings.Contains(ns, `"apss.invisible.tech/inject":null`) ||
+		!strings.Contains(ns, annotationOnboarded) {
+		t.Errorf("namespace patch = %s", ns)
+	}
+	// Only the workload owning a pod without the sidecar is restarted.
+	if len(report.Restarted) != 1 || report.Restarted[0] != "deployment/api" {
+		t.Errorf("restarted = %v", report.Restarted)
+	}
+	if !strings.Contains(patches["/apis/apps/v1/namespaces/prod/deployments/api"], restartedAtAnnotation) {
+		t.Errorf("patches = %v", patches)
+	}
+	if report.Total != 2 || report.Covered != 1 || report.Complete() {
+		t.Errorf("coverage %d/%d", report.Covered, report.Total)
+	}
+	if p := report.Pods[0]; !p.Covered || p.Agent != "web-1-prod" || p.AgentStatus != "healthy" {
+		t.Errorf("web-1 = %+v", p)
+	}
+	if p := report.Pods[1]; p.Covered || p.Injected || p.Agent != "" {
+		t.Errorf("api-1 = %+v", p)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderOnboard(&buf, FormatTable, report); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "restarted deployment/api") || !strings.HasSuffix(out, "Coverage: 1/2 pods in prod monitored\n") {
+		t.Errorf("table = %q", out)
+	}
+	buf.Reset()
+	RenderOnboard(&buf, FormatJSON, report)
+	var decoded OnboardReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Covered != 1 || len(decoded.Steps) != 5 {
+		t.Errorf("json = %s (%v)", buf.String(), err)
+	}
+}
+
+func TestOnboard_Precheck(t *testing.T) {
+	cluster, patches := fakeOnboardCluster(t, "prod")
+	defer cluster.Close()
+	ctrl := fakeController(t)
+	defer ctrl.Close()
+	kc := kube.NewClient(cluster.URL, cluster.Client())
+
+	report, err := Onboard(context.Background(), NewClient(ctrl.URL, ""), kc, OnboardOptions{Namespace: "prod"})
+	if !errors.Is(err, ErrOnboardPrecheck) || !strings.Contains(err.Error(), "excludes namespace prod") {
+		t.Errorf("excluded namespace: err = %v", err)
+	}
+	if last := report.Steps[len(report.Steps)-1]; last.Name != "webhook" || last.OK {
+		t.Errorf("steps = %+v", report.Steps)
+	}
+	if _, err := Onboard(context.Background(), NewClient(ctrl.URL, ""), kc, OnboardOptions{Namespace: "missing"}); !errors.Is(err, ErrOnboardPrecheck) {
+		t.Errorf("missing namespace: err = %v", err)
+	}
+	if _, err := Onboard(context.Background(), NewClient("http://127.0.0.1:1", ""), kc, OnboardOptions{Namespace: "prod"}); !errors.Is(err, ErrOnboardPrecheck) {
+		t.Errorf("unreachable controller: err = %v", err)
+	}
+	if len(patches) != 0 {
+		t.Errorf("failed checks changed the cluster: %v", patches)
+	}
+}
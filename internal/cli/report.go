@@ -0,0 +1,128 @@
+// Package cli implements apssctl: a small client for the controller API and
+// the table/JSON/JSONL/CSV rendering shared by its list commands.
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats accepted by Render.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// Formats lists the output formats in the order they are documented.
+var Formats = []string{FormatTable, FormatJSON, FormatJSONL, FormatCSV}
+
+// Record is one list item as decoded from the API's JSON.
+type Record map[string]interface{}
+
+// Render writes records to w in format. columns selects and orders the
+// fields: table and CSV output print exactly those columns, and JSON/JSONL
+// objects are trimmed to those keys. With no columns, table and CSV use
+// defaults and JSON/JSONL keep every field.
+func Render(w io.Writer, format string, records []Record, columns, defaults []string) error {
+	switch format {
+	case FormatTable, FormatCSV:
+		if len(columns) == 0 {
+			columns = defaults
+		}
+		if format == FormatTable {
+			return renderTable(w, records, columns)
+		}
+		return renderCSV(w, records, columns)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(project(records, columns))
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, r := range project(records, columns) {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (want one of %s)", format, strings.Join(Formats, ", "))
+}
+
+func renderTable(w io.Writer, records []Record, columns []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = strings.ToUpper(c)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range records {
+		fmt.Fprintln(tw, strings.Join(row(r, columns), "\t"))
+	}
+	return tw.Flush()
+}
+
+func renderCSV(w io.Writer, records []Record, columns []string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	for _, r := range records {
+		cw.Write(row(r, columns))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// project trims records to columns; with no columns it returns them as is.
+func project(records []Record, columns []string) []Record {
+	if len(columns) == 0 {
+		return records
+	}
+	out := make([]Record, len(records))
+	for i, r := range records {
+		p := make(Record, len(columns))
+		for _, c := range columns {
+			if v, ok := r[c]; ok {
+				p[c] = v
+			}
+		}
+		out[i] = p
+	}
+	return out
+}
+
+func row(r Record, columns []string) []string {
+	cells := make([]string, len(columns))
+	for i, c := range columns {
+		cells[i] = cell(r[c])
+	}
+	return cells
+}
+
+// cell formats a value for a table or CSV cell. Lists of scalars are joined
+// with ";"; objects are written as compact JSON.
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = cell(e)
+		}
+		return strings.Join(parts, ";")
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testRecords() []Record {
+	return []Record{
+		{"id": "a1", "severity": "HIGH", "event_ids": []interface{}{"e1", "e2"}, "count": json.Number("3")},
+		{"id": "a2", "severity": "LOW", "monitors": map[string]interface{}{"procmon": "running"}},
+	}
+}
+
+func TestRender_TableAndCSVColumns(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, FormatTable, testRecords(), nil, []string{"id", "severity"}); err != nil {
+		t.Fatalf("table: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "HIGH") {
+		t.Errorf("table output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Render(&buf, FormatCSV, testRecords(), []string{"event_ids", "id", "monitors", "count"}, nil); err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	want := [][]string{
+		{"event_ids", "id", "monitors", "count"},
+		{"e1;e2", "a1", "", "3"},
+		{"", "a2", `{"procmon":"running"}`, ""},
+	}
+	for i := range want {
+		if !equalRow(rows[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestRender_JSONAndJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, FormatJSONL, testRecords(), []string{"id"}, nil); err != nil {
+		t.Fatalf("jsonl: %v", err)
+	}
+	if got := buf.String(); got != "{\"id\":\"a1\"}\n{\"id\":\"a2\"}\n" {
+		t.Errorf("jsonl = %q", got)
+	}
+
+	buf.Reset()
+	if err := Render(&buf, FormatJSON, testRecords(), nil, []string{"id"}); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if len(got) != 2 || got[0]["severity"] != "HIGH" {
+		t.Errorf("json without columns should keep every field: %v", got)
+	}
+
+	if err := Render(&buf, "xml", nil, nil, nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func equalRow(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
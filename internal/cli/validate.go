@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+// ValidateConfig prints to w every problem controller.ValidateConfig finds
+// in cfg, or that the configuration is valid. It returns ExitFindings if
+// there are problems.
+func ValidateConfig(w io.Writer, cfg config.ControllerConfig) int {
+	problems := controller.ValidateConfig(cfg)
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(w, "%d configuration problem(s)\n", len(problems))
+		return ExitFindings
+	}
+	fmt.Fprintln(w, "configuration OK")
+	return ExitOK
+}
+
+// LoadEnvFile sets the environment variables in file, one KEY=VALUE per
+// line as in a .env file. Blank lines and # comments are skipped, an
+// "export " prefix and quotes around the value are dropped. Malformed lines
+// are reported with their line number.
+func LoadEnvFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var errs []error
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			errs = append(errs, fmt.Errorf("%s:%d: not KEY=VALUE", file, n))
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		os.Setenv(key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
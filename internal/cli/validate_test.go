@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/storage"
+)
+
+func TestLoadEnvFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "controller.env")
+	content := "# controller\nAPSS_TEST_ENV_A=one\n\nexport APSS_TEST_ENV_B=\"two words\"\nnot a pair\nAPSS_TEST_ENV_C='x=y'\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, k := range []string{"APSS_TEST_ENV_A", "APSS_TEST_ENV_B", "APSS_TEST_ENV_C"} {
+			os.Unsetenv(k)
+		}
+	})
+
+	err := LoadEnvFile(file)
+	if err == nil || err.Error() != file+":5: not KEY=VALUE" {
+		t.Errorf("err = %v", err)
+	}
+	for k, want := range map[string]string{"APSS_TEST_ENV_A": "one", "APSS_TEST_ENV_B": "two words", "APSS_TEST_ENV_C": "x=y"} {
+		if got := os.Getenv(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if err := LoadEnvFile(file + ".missing"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	var buf bytes.Buffer
+	if code := ValidateConfig(&buf, config.ControllerConfig{}); code != ExitOK || buf.String() != "configuration OK\n" {
+		t.Errorf("valid: code %d, output %q", code, buf.String())
+	}
+	buf.Reset()
+	cfg := config.ControllerConfig{ShadowRules: []string{"APSS-999"}}
+	if code := ValidateConfig(&buf, cfg); code != ExitFindings || !strings.HasSuffix(buf.String(), "1 configuration problem(s)\n") {
+		t.Errorf("invalid: code %d, output %q", code, buf.String())
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	if code := MigrateDryRun(&buf, config.ControllerConfig{StorageBackend: "bbolt"}); code != ExitUsage {
+		t.Errorf("bbolt: code %d", code)
+	}
+
+	all, err := storage.Migrations()
+	if err != nil || len(all) == 0 {
+		t.Fatalf("Migrations() = %v, %v", all, err)
+	}
+	buf.Reset()
+	status := &storage.MigrationStatus{Latest: len(all), Pending: all}
+	if code := printMigrationPlan(&buf, status); code != ExitFindings ||
+		!strings.Contains(buf.String(), "-- 0001_create_records\n") || !strings.Contains(buf.String(), "CREATE TABLE IF NOT EXISTS apss_records") {
+		t.Errorf("pending: code %d, output %q", code, buf.String())
+	}
+	buf.Reset()
+	status = &storage.MigrationStatus{Version: len(all), Latest: len(all)}
+	if code := printMigrationPlan(&buf, status); code != ExitOK || !strings.HasSuffix(buf.String(), "no pending migrations\n") {
+		t.Errorf("current: code %d, output %q", code, buf.String())
+	}
+	buf.Reset()
+	status = &storage.MigrationStatus{Version: len(all) + 1, Latest: len(all)}
+	if code := printMigrationPlan(&buf, status); code != ExitError {
+		t.Errorf("too new: code %d", code)
+	}
+}
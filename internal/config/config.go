@@ -3,9 +3,13 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
 )
 
 // GetEnv returns the value of key from the environment, or defaultValue if unset or empty.
@@ -24,38 +28,495 @@ func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	d, err := time.ParseDuration(s)
 	if err != nil {
+		recordInvalid(key, s)
 		return defaultValue
 	}
 	return d
 }
 
+// GetEnvInt returns the integer for key, or defaultValue if unset/invalid.
+func GetEnvInt(key string, defaultValue int) int {
+	s := os.Getenv(key)
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		recordInvalid(key, s)
+		return defaultValue
+	}
+	return n
+}
+
+// GetEnvFloat returns the float value of key, or defaultValue if unset or
+// invalid.
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	s := os.Getenv(key)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		recordInvalid(key, s)
+		return defaultValue
+	}
+	return f
+}
+
+// GetEnvList returns the comma-separated values of key with whitespace and
+// empty entries dropped, or defaultValue if unset.
+func GetEnvList(key string, defaultValue []string) []string {
+	s := os.Getenv(key)
+	if s == "" {
+		return defaultValue
+	}
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// GetEnvPorts returns the comma-separated port numbers of key. Entries that
+// are not ports are skipped, so "none" yields an empty list.
+func GetEnvPorts(key string, defaultValue []int) []int {
+	values := GetEnvList(key, nil)
+	if values == nil {
+		return defaultValue
+	}
+	ports := []int{}
+	for _, v := range values {
+		if port, err := strconv.Atoi(v); err == nil && port > 0 && port <= 65535 {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// GetEnvEgress returns the proxy and TLS settings for one integration from
+// <prefix>_PROXY_URL, <prefix>_CA_FILE and <prefix>_TLS_SKIP_VERIFY.
+func GetEnvEgress(prefix string) egress.Config {
+	return egress.Config{
+		ProxyURL:           GetEnv(prefix+"_PROXY_URL", ""),
+		CAFile:             GetEnv(prefix+"_CA_FILE", ""),
+		InsecureSkipVerify: GetEnv(prefix+"_TLS_SKIP_VERIFY", "false") == "true",
+	}
+}
+
+// DigestSettings batch a notifier's alerts of Severities into one message
+// per Window; no Severities sends every alert on its own.
+type DigestSettings struct {
+	Severities []string
+	Window     time.Duration
+}
+
+// GetEnvDigest returns one notifier's digest mode from
+// <prefix>_DIGEST_SEVERITIES and <prefix>_DIGEST_WINDOW.
+func GetEnvDigest(prefix string) DigestSettings {
+	return DigestSettings{
+		Severities: GetEnvList(prefix+"_DIGEST_SEVERITIES", nil),
+		Window:     GetEnvDuration(prefix+"_DIGEST_WINDOW", 15*time.Minute),
+	}
+}
+
 // AgentConfig holds configuration for the sidecar agent (used by cmd/agent and pkg/monitor).
 type AgentConfig struct {
-	AgentID             string
-	PodName             string
-	PodNamespace        string
-	NodeName            string
-	ControllerEndpoint  string
-	ProcScanInterval    time.Duration
-	NetScanInterval     time.Duration
-	FileScanInterval    time.Duration
-	WatchPaths          []string
+	AgentID            string
+	PodName            string
+	PodNamespace       string
+	NodeName           string
+	PodIP              string
+	ServiceAccount     string
+	ControllerEndpoint string
+	ProcScanInterval   time.Duration
+	NetScanInterval    time.Duration
+	FileScanInterval   time.Duration
+	WatchPaths         []string
+	WatchExclude       []string
+	// CredentialPaths are service account token and cloud credential files
+	// or directories; ~/ stands for every home directory. Reads and changes
+	// of them are reported as credential access.
+	CredentialPaths []string
+	// FileBaselineKey is the PEM Ed25519 public key file integrity
+	// baselines are verified with; empty disables baselines.
+	FileBaselineKey     string
 	SuspiciousProcesses []string
 	SuspiciousPorts     []int
+	// ListenBaseline, when set, is the warm-up during which listening ports
+	// are learned; afterwards only listeners on new ports raise events.
+	ListenBaseline time.Duration
+	// Outbound connections to SMTPPorts (external only) and IRCPorts are
+	// flagged with their protocol.
+	SMTPPorts []int
+	IRCPorts  []int
+	// A network scan with more new external connections or destination IPs
+	// than the larger of FanoutConnections or FanoutDestinations and the
+	// rolling mean plus FanoutSigma standard deviations raises an anomaly;
+	// FanoutSigma 0 disables it.
+	FanoutConnections  int
+	FanoutDestinations int
+	FanoutSigma        float64
+	// ExeHashAllowlist and ExeHashDenylist are hex SHA-256 digests of
+	// executables whose processes are ignored or raise a CRITICAL event.
+	ExeHashAllowlist []string
+	ExeHashDenylist  []string
+	// DiskWatchPaths are scanned every DiskScanInterval; growth of at least
+	// DiskGrowthBytes or DiskGrowthFiles between scans raises an anomaly.
+	DiskWatchPaths   []string
+	DiskScanInterval time.Duration
+	DiskGrowthBytes  int64
+	DiskGrowthFiles  int
+	// DropWatchPaths are watched for new executables and ELF binaries.
+	DropWatchPaths []string
+	// InodeUsagePercent and FDUsagePercent are the filesystem inode and
+	// per-process open file usage that raise exhaustion anomalies.
+	InodeUsagePercent int
+	FDUsagePercent    int
+	// A process using HighCPUPercent of one core for HighCPUScans process
+	// scans in a row raises a sustained CPU event; 0 scans disables it.
+	HighCPUPercent int
+	HighCPUScans   int
+	// ProcEventMode is "auto", "netlink" or "poll": whether process events
+	// from the kernel's process connector supplement the /proc scans.
+	ProcEventMode string
+	// Without process events, the process scan interval shrinks towards
+	// ProcScanMinInterval while processes churn, and /proc is sampled for
+	// new processes ProcScanSamples times per interval.
+	ProcScanMinInterval time.Duration
+	ProcScanSamples     int
+	// ProbeCommands are the pod's exec probe commands, which the webhook
+	// annotates the pod with as a JSON list of argv lists. ExecProbePolicy
+	// is "downrank", "exempt" or "off": what happens to the events of the
+	// processes probes run.
+	ProbeCommands   [][]string
+	ExecProbePolicy string
+	// GPUMonitor watches for GPU use outside labeled GPU workloads;
+	// GPUWorkload is set for pods labeled as one. GPUMetricsURL is a
+	// dcgm-exporter endpoint for the utilization check, which raises an
+	// anomaly at GPUUtilPercent for GPUUtilScans scans in a row.
+	GPUMonitor          bool
+	GPUWorkload         bool
+	GPUScanInterval     time.Duration
+	GPUAllowedProcesses []string
+	GPUMetricsURL       string
+	GPUUtilPercent      int
+	GPUUtilScans        int
+	// MonitoringMode is "full" or "degraded" (no shared process namespace).
+	MonitoringMode string
+	// HeartbeatInterval is how often the agent reports liveness and monitor crash counts.
+	HeartbeatInterval  time.Duration
+	MaxMonitorRestarts int
+	// StartupJitter delays an agent's monitors and registration by a random
+	// time up to it, spreading the load of pods restarted together.
+	StartupJitter time.Duration
+	// HealthAddr serves per-monitor status on /healthz; loopback-only by
+	// default so it never collides with or exposes anything on the pod IP.
+	HealthAddr string
+	// ControllerToken is the bearer token sent with every controller request.
+	ControllerToken string
+	// After BreakerThreshold consecutive failed sends the agent stops calling
+	// the controller for BreakerCooldown and spools events under SpoolDir
+	// (up to SpoolMaxBytes) for replay once it is reachable again.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	SpoolDir         string
+	SpoolMaxBytes    int64
+	// WorkloadIdentity looks up the Google service account bound to
+	// ServiceAccount from the GKE metadata server at startup.
+	WorkloadIdentity bool
+	// ClusterName and Environment tag the agent's registration and events,
+	// as the webhook passes them on.
+	ClusterName string
+	Environment string
+	// RedactEnvSecrets hashes credentials found in process environments
+	// instead of sending them in clear text.
+	RedactEnvSecrets bool
 }
 
 // ControllerConfig holds configuration for the controller.
 type ControllerConfig struct {
-	HTTPAddr              string
-	ShutdownTimeout       time.Duration
-	EventBufferSize       int
-	AlertBufferSize       int
-	AgentStaleThreshold   time.Duration
-	AlertRetentionCount   int
+	HTTPAddr            string
+	ShutdownTimeout     time.Duration
+	EventBufferSize     int
+	AlertBufferSize     int
+	AgentStaleThreshold time.Duration
+	AlertRetentionCount int
+	// EventRetentionCount is how many recent events are kept for export.
+	EventRetentionCount int
+	AlertStreamBuffer   int
+	// ClusterName and Environment are where the controller runs. Events
+	// from agents that do not report their own, and alerts the controller
+	// raises itself, are tagged with them.
+	ClusterName string
+	Environment string
+	// LateralMovementWindow is how close in time a pod-to-pod connection and
+	// a shell in the destination pod must be to raise a lateral movement
+	// incident. 0 disables the correlation.
+	LateralMovementWindow time.Duration
+	// CampaignWindow is how long sightings of one indicator are grouped
+	// into a campaign; CampaignMinWorkloads is how many distinct workloads
+	// must see it. A zero window disables campaign detection.
+	CampaignWindow       time.Duration
+	CampaignMinWorkloads int
+	// EventSummaryWindow collapses identical INFO events: within each
+	// window, repeats of an event are stored and exported as one summary
+	// event. 0 disables summarization.
+	EventSummaryWindow time.Duration
+	// GraphRetention is how long the entity graph keeps pods, processes,
+	// destinations and files after they were last seen in an event; 0
+	// disables the graph. GraphMaxNodes bounds it, evicting the least
+	// recently seen nodes.
+	GraphRetention time.Duration
+	GraphMaxNodes  int
+	// TriageWindow is how close a shell must follow a kubectl exec into its
+	// pod, or an account file change an account tool, for the alert to get
+	// a probable-cause hint; 0 disables triage hints. TriageInitWindow is
+	// how long after an agent connects account file changes count as
+	// container initialization.
+	TriageWindow     time.Duration
+	TriageInitWindow time.Duration
+	// StateFile is where the controller snapshots its agents, recent alerts,
+	// incidents, IOCs and correlation windows every StateSaveInterval and on
+	// shutdown, and restores them from on startup. Empty keeps state in
+	// memory only.
+	StateFile         string
+	StateSaveInterval time.Duration
+	// StorageBackend persists events, alerts, incidents, suppressions and
+	// the audit log: "memory", "bbolt" in the file StoragePath, or
+	// "postgres" at StoragePostgresDSN. The controller loads its retained
+	// sets from storage when it starts leading. Empty keeps them in memory
+	// only. Records older than StorageRetention are pruned.
+	StorageBackend     string
+	StoragePath        string
+	StoragePostgresDSN string
+	StorageRetention   time.Duration
+	// StorageMigrate applies pending Postgres schema migrations at startup.
+	// Off, a controller whose database needs migrating keeps records in
+	// memory only.
+	StorageMigrate bool
+	// CanaryInterval is how often a synthetic test alert is sent straight
+	// to every alert sink to check it still delivers; 0 disables canaries.
+	CanaryInterval time.Duration
+	// MonitorCrashAlertThreshold is the per-monitor crash count at which an
+	// agent crash-loop alert is raised.
+	MonitorCrashAlertThreshold int
+	// AgentTokensFile and OperatorTokensFile hold bearer tokens, one per line,
+	// usually mounted from Secrets. Auth is disabled when both are empty.
+	AgentTokensFile    string
+	OperatorTokensFile string
+	// IntegrationTokensFile holds tokens for inbound integration callbacks,
+	// which may only post Sweet Security enrichments.
+	IntegrationTokensFile string
+	// SigmaRulesDir holds Sigma rules (*.yml, *.yaml) loaded alongside the
+	// built-in detection rules. Empty disables Sigma import.
+	SigmaRulesDir string
+	// ShadowRules are the IDs of rules loaded in shadow mode: evaluated and
+	// counted, but raising no alerts.
+	ShadowRules []string
+	// A rule whose evaluation of an event takes SlowRuleThreshold or longer
+	// several times in a row is logged as slow, and with SlowRuleDisable
+	// no longer evaluated. 0 disables the check.
+	SlowRuleThreshold time.Duration
+	SlowRuleDisable   bool
+	// PlaybooksFile maps rule IDs to response playbooks attached to their
+	// alerts. Empty attaches only the playbooks Sigma rules define.
+	PlaybooksFile string
+	// YaraRulesDir holds YARA rules (*.yar, *.yara) agents pull and scan
+	// new and changed files with. Empty disables YARA scanning.
+	YaraRulesDir string
+	// KubeMetadata watches pods in the cluster and attaches each alert's
+	// pod owner, node, service account and KubeMetadataLabels to it.
+	KubeMetadata       bool
+	KubeMetadataLabels []string
+	// BrownoutFactor and BrownoutDuration are the default scan interval
+	// multiplier and length of a monitoring brownout started through the API.
+	BrownoutFactor   int
+	BrownoutDuration time.Duration
+	// FederationEndpoint, the central controller's base URL, makes this an
+	// edge controller that reports its agent counts and up to
+	// FederationBatchSize new alerts there every FederationInterval,
+	// authenticating with FederationToken. Events stay on the edge.
+	FederationEndpoint  string
+	FederationToken     string
+	FederationInterval  time.Duration
+	FederationBatchSize int
+	// FederationCentral accepts edge reports on /api/v1/federation and keeps
+	// the consolidated alerts for FederationRetention after they last fired.
+	FederationCentral   bool
+	FederationRetention time.Duration
+	// LeaderElection lets replicas share the Lease LeaderElectionLease in
+	// LeaderElectionNamespace: the holder runs detection, alerting and
+	// exports and the others forward API requests to it. The Lease is held
+	// for LeaseDuration, renewed every LeaseRetryPeriod, and given up when a
+	// renewal has not succeeded for LeaseRenewDeadline. PodName identifies
+	// the replica and PodIP is where the others reach it.
+	LeaderElection          bool
+	LeaderElectionNamespace string
+	LeaderElectionLease     string
+	LeaseDuration           time.Duration
+	LeaseRenewDeadline      time.Duration
+	LeaseRetryPeriod        time.Duration
+	PodName                 string
+	PodIP                   string
+	// Sharding spreads agents over the Ready controller pods matching
+	// ShardingSelector in ShardingNamespace, listed again every
+	// ShardingRefresh. Each replica processes its own agents' events, and
+	// replicas share alerts and suppressions through the storage backend.
+	// It needs PodName and PodIP, like LeaderElection, which it replaces.
+	Sharding          bool
+	ShardingNamespace string
+	ShardingSelector  string
+	ShardingRefresh   time.Duration
+	// FileBaselineSigningKeyFile holds the PEM Ed25519 private key file
+	// integrity baselines are signed with. Empty disables baselines.
+	FileBaselineSigningKeyFile string
+	// ThreatIntelIPFeeds and ThreatIntelDomainFeeds are blocklist URLs,
+	// refreshed every ThreatIntelRefresh, that network events are matched
+	// against.
+	ThreatIntelIPFeeds     []string
+	ThreatIntelDomainFeeds []string
+	ThreatIntelRefresh     time.Duration
+	// ThreatIntelTorFeeds list Tor entry node addresses, refreshed like
+	// the blocklists; matches are reported separately from them.
+	ThreatIntelTorFeeds []string
+	// IOCExtraction adds the hashes, external IPs and domains of CRITICAL
+	// alerts to a local IOC list matched like a feed; entries not seen again
+	// for IOCTTL expire.
+	IOCExtraction bool
+	IOCTTL        time.Duration
+	// SlackWebhookURL and PagerDutyRoutingKey enable alert notifications.
+	// SlackSeverities and PagerDutySeverities choose which alert severities
+	// each one receives. WebhookSinksFile lists generic webhook sinks (YAML
+	// or JSON) whose request bodies are rendered from Go templates.
+	SlackWebhookURL       string
+	SlackChannel          string
+	SlackSeverities       []string
+	PagerDutyRoutingKey   string
+	PagerDutySeverities   []string
+	WebhookSinksFile      string
 	SweetSecurityEnabled  bool
 	SweetSecurityEndpoint string
 	SweetSecurityAPIKey   string
 	SweetSecurityTimeout  time.Duration
+	// SweetSecurityAuthMode sends the API key as a bearer token (bearer), in
+	// the SweetSecurityAPIKeyHeader header (header), or not at all (none),
+	// for credentials passed in SweetSecurityHeaders. SweetSecurityHeaders
+	// are extra request headers in the OTEL_EXPORTER_OTLP_HEADERS format.
+	SweetSecurityAuthMode     string
+	SweetSecurityAPIKeyHeader string
+	SweetSecurityHeaders      string
+	// Sweet Security sends are retried SweetSecurityMaxRetries times with
+	// exponential backoff from SweetSecurityRetryBackoff. After
+	// SweetSecurityBreakerLimit consecutive failed sends the circuit breaker
+	// fails sends fast for SweetSecurityBreakerReset.
+	SweetSecurityMaxRetries   int
+	SweetSecurityRetryBackoff time.Duration
+	SweetSecurityBreakerLimit int
+	SweetSecurityBreakerReset time.Duration
+	// Events and alerts wait in a queue of SweetSecurityQueueSize for
+	// SweetSecurityWorkers senders, which batch events by
+	// SweetSecurityBatchSize or SweetSecurityFlushInterval.
+	// SweetSecurityDropPolicy is drop-newest or drop-oldest.
+	SweetSecurityQueueSize     int
+	SweetSecurityDropPolicy    string
+	SweetSecurityWorkers       int
+	SweetSecurityBatchSize     int
+	SweetSecurityFlushInterval time.Duration
+	// SweetSecurityMappingsFile reshapes alert payloads per rule; see
+	// sweetsecurity.AlertMappings. Empty sends alerts as built.
+	SweetSecurityMappingsFile string
+
+	// Splunk HTTP Event Collector export of every processed event and
+	// alert, enabled when both the URL and token are set.
+	SplunkEnabled         bool
+	SplunkHECURL          string
+	SplunkHECToken        string
+	SplunkIndex           string
+	SplunkEventSourceType string
+	SplunkAlertSourceType string
+	SplunkBatchSize       int
+	SplunkFlushInterval   time.Duration
+
+	// Elasticsearch or OpenSearch bulk indexing of events and alerts into
+	// daily indices, enabled when the URL is set. APIKey takes precedence
+	// over basic auth.
+	ElasticsearchURL           string
+	ElasticsearchAPIKey        string
+	ElasticsearchUsername      string
+	ElasticsearchPassword      string
+	ElasticsearchIndexPrefix   string
+	ElasticsearchBatchSize     int
+	ElasticsearchFlushInterval time.Duration
+
+	// OTLP log export of events and alerts, enabled when the endpoint is set.
+	// Endpoint, protocol and headers use the standard OpenTelemetry variables.
+	OTLPEndpoint      string
+	OTLPProtocol      string
+	OTLPHeaders       string
+	OTLPBatchSize     int
+	OTLPFlushInterval time.Duration
+
+	// Syslog export of alerts, and of events too with SyslogEvents, to a
+	// SIEM collector at SyslogAddress (host:port), enabled when it is set.
+	// SyslogProtocol is tcp or tls and SyslogFormat cef or rfc5424, whose
+	// structured data is the element SyslogSDID.
+	SyslogAddress  string
+	SyslogProtocol string
+	SyslogFormat   string
+	SyslogFacility int
+	SyslogSDID     string
+	SyslogEvents   bool
+
+	// Google Cloud alert sinks, authenticated through the metadata server
+	// (Workload Identity). PubSubTopic enables publishing to Pub/Sub and
+	// CloudLoggingEnabled writing to Cloud Logging; GCPProjectID defaults to
+	// the cluster's project.
+	GCPProjectID           string
+	PubSubTopic            string
+	PubSubSeverities       []string
+	CloudLoggingEnabled    bool
+	CloudLoggingLogName    string
+	CloudLoggingSeverities []string
+
+	// MaxRequestBytes caps the body of an event or event batch request;
+	// MaxBatchEvents caps the events in one batch. Zero disables a limit.
+	MaxRequestBytes int64
+	MaxBatchEvents  int
+
+	// AgentMinProtocol is the oldest agent protocol version the controller
+	// counts as compatible; agents without a handshake speak version 1.
+	// AgentCapabilities are what the controller grants agents in the
+	// handshake, "none" for single uncompressed events.
+	AgentMinProtocol  int
+	AgentCapabilities []string
+
+	// AgentEventRate is the events per second each agent may send, with
+	// bursts of up to AgentEventBurst; events over it get a 429. Zero
+	// disables the limit.
+	AgentEventRate  float64
+	AgentEventBurst int
+
+	// AccessLogSample is the fraction of API requests logged. Failed and
+	// slow requests are always logged; a request is slow past
+	// AccessLogSlow or, when it is zero, past the p99 of recent requests.
+	AccessLogSample float64
+	AccessLogSlow   time.Duration
+
+	// Digest mode of each notifier. DigestTemplateFile is a Go template
+	// rendering every digest's text; empty uses the default.
+	SlackDigest        DigestSettings
+	PagerDutyDigest    DigestSettings
+	PubSubDigest       DigestSettings
+	CloudLoggingDigest DigestSettings
+	DigestTemplateFile string
+
+	// Proxy and TLS settings for each outbound integration; the zero value
+	// uses the HTTPS_PROXY environment and the system roots.
+	SweetSecurityEgress egress.Config
+	SplunkEgress        egress.Config
+	ElasticsearchEgress egress.Config
+	OTLPEgress          egress.Config
+	SyslogEgress        egress.Config
+	SlackEgress         egress.Config
+	PagerDutyEgress     egress.Config
+	GCPEgress           egress.Config
+	FederationEgress    egress.Config
 }
 
 // WebhookConfig holds configuration for the mutating webhook.
@@ -63,10 +524,95 @@ type WebhookConfig struct {
 	SidecarImage       string
 	ControllerEndpoint string
 	ExcludeNamespaces  []string
+	// NamespaceInjectionDefault is "enabled" or "disabled": whether pods in
+	// namespaces without an apss.invisible.tech/injection label get the
+	// sidecar.
+	NamespaceInjectionDefault string
+	// NamespaceLabels looks up a namespace's labels from the webhook's
+	// namespace cache; nil or a miss treats the namespace as unlabelled.
+	NamespaceLabels func(namespace string) (map[string]string, bool)
+	// ExcludeLabels and ExcludeAnnotations skip pods carrying a matching
+	// key; a value of "*" matches any value.
 	ExcludeLabels      map[string]string
-	TLSCertFile        string
-	TLSKeyFile         string
-	HTTPAddr           string
+	ExcludeAnnotations map[string]string
+	// ExcludeImageRegistries skips pods with any container image from one of
+	// these registries (or registry/path prefixes).
+	ExcludeImageRegistries []string
+	// ExclusionsFile is a mounted ConfigMap file whose exclusions replace the
+	// ones above and are reloaded when it changes.
+	ExclusionsFile string
+	// SidecarResourcesFile is a mounted ConfigMap file of per-namespace
+	// sidecar resource defaults, reloaded when it changes.
+	SidecarResourcesFile string
+	// SidecarResourceDefaults maps namespace ("*" for all others) to keys
+	// such as "cpu-limit" and quantities, as loaded from SidecarResourcesFile.
+	SidecarResourceDefaults map[string]map[string]string
+	// ImagePolicyFile is a mounted ConfigMap file with the image policies
+	// checked on /validate. Empty disables image policy checks.
+	ImagePolicyFile string
+	// PosturePolicyFile is a mounted ConfigMap file with the pod security
+	// posture policies checked on /validate. Empty disables posture checks.
+	PosturePolicyFile string
+	TLSCertFile       string
+	TLSKeyFile        string
+	// CertBootstrap makes the webhook issue its own CA and serving
+	// certificate, keep them in CertSecretName and patch the CA bundle into
+	// the webhook configurations named WebhookConfigName, instead of relying
+	// on cert-manager. The key pair is written to TLSCertFile/TLSKeyFile.
+	CertBootstrap     bool
+	CertSecretName    string
+	WebhookConfigName string
+	// Namespace and ServiceName are where the webhook runs and the Service
+	// the API server calls; they set the serving certificate's DNS names.
+	Namespace   string
+	ServiceName string
+	HTTPAddr    string
+	// AgentToken is the webhook's own token for reporting admissions to the
+	// controller. It is never copied into injected sidecars.
+	AgentToken string
+	// AgentTokenSecretName and AgentTokenSecretKey name the Secret, in each
+	// injected pod's namespace, that sidecars read CONTROLLER_TOKEN from.
+	// Empty injects no token.
+	AgentTokenSecretName string
+	AgentTokenSecretKey  string
+	// FileBaselineKey is passed to injected sidecars as
+	// FIM_BASELINE_PUBLIC_KEY when set, turning on file integrity baselines.
+	FileBaselineKey string
+	// SidecarMode is "auto", "native" or "classic". Native sidecars are init
+	// containers with restartPolicy Always (Kubernetes 1.29+); auto picks
+	// native when the API server is new enough.
+	SidecarMode string
+	// NativeSidecar is SidecarMode resolved against the cluster version at
+	// webhook startup.
+	NativeSidecar bool
+	// WorkloadIdentityLookup lets injected agents ask the GKE metadata
+	// server for their Workload Identity binding.
+	WorkloadIdentityLookup bool
+	// ClusterName and Environment are passed to injected agents, which tag
+	// their events with them.
+	ClusterName string
+	Environment string
+	// ExecProbePolicy is passed to injected agents: "downrank", "exempt" or
+	// "off" for the events of the processes exec probes run.
+	ExecProbePolicy string
+	// RedactEnvSecrets makes injected agents hash credentials found in
+	// process environments.
+	RedactEnvSecrets bool
+	// GPUNamespaces turns on GPU monitoring in injected agents for pods in
+	// these namespaces ("*" for all). GPUMetricsURL is a dcgm-exporter
+	// endpoint, which may refer to $(NODE_IP); GPUAllowedProcesses may hold
+	// GPU devices besides those of pods labelled as GPU workloads.
+	GPUNamespaces       []string
+	GPUMetricsURL       string
+	GPUAllowedProcesses []string
+
+	// OPAURL is the Open Policy Agent Data API path /validate also asks
+	// about each pod. OPAFailurePolicy is "ignore" or "deny" for when OPA
+	// fails; decisions are cached for OPACacheTTL (zero disables caching).
+	OPAURL           string
+	OPATimeout       time.Duration
+	OPAFailurePolicy string
+	OPACacheTTL      time.Duration
 }
 
 // DefaultAgentConfig returns agent config from environment with defaults.
@@ -76,13 +622,61 @@ func DefaultAgentConfig() AgentConfig {
 		PodName:             GetEnv("POD_NAME", ""),
 		PodNamespace:        GetEnv("POD_NAMESPACE", ""),
 		NodeName:            GetEnv("NODE_NAME", ""),
+		PodIP:               GetEnv("POD_IP", ""),
+		ServiceAccount:      GetEnv("POD_SERVICE_ACCOUNT", ""),
+		ClusterName:         GetEnv("CLUSTER_NAME", ""),
+		Environment:         GetEnv("ENVIRONMENT", ""),
 		ControllerEndpoint:  GetEnv("CONTROLLER_ENDPOINT", "apss-controller.apss-system.svc.cluster.local:8080"),
 		ProcScanInterval:    GetEnvDuration("PROC_SCAN_INTERVAL", 5*time.Second),
 		NetScanInterval:     GetEnvDuration("NET_SCAN_INTERVAL", 10*time.Second),
 		FileScanInterval:    GetEnvDuration("FILE_SCAN_INTERVAL", 30*time.Second),
 		WatchPaths:          defaultWatchPaths(),
+		WatchExclude:        GetEnvList("WATCH_EXCLUDE", nil),
+		CredentialPaths:     GetEnvList("CREDENTIAL_PATHS", defaultCredentialPaths()),
+		FileBaselineKey:     GetEnv("FIM_BASELINE_PUBLIC_KEY", ""),
 		SuspiciousProcesses: defaultSuspiciousProcesses(),
 		SuspiciousPorts:     defaultSuspiciousPorts(),
+		ListenBaseline:      GetEnvDuration("LISTEN_BASELINE_WINDOW", 0),
+		SMTPPorts:           GetEnvPorts("SMTP_PORTS", []int{25, 465, 587}),
+		IRCPorts:            GetEnvPorts("IRC_PORTS", []int{6667}),
+		FanoutConnections:   GetEnvInt("FANOUT_MIN_CONNECTIONS", 20),
+		FanoutDestinations:  GetEnvInt("FANOUT_MIN_DESTINATIONS", 10),
+		FanoutSigma:         GetEnvFloat("FANOUT_SIGMA", 3),
+		ExeHashAllowlist:    GetEnvList("EXE_HASH_ALLOWLIST", nil),
+		ExeHashDenylist:     GetEnvList("EXE_HASH_DENYLIST", nil),
+		DiskWatchPaths:      GetEnvList("DISK_WATCH_PATHS", []string{"/tmp", "/var/tmp", "/dev/shm"}),
+		DiskScanInterval:    GetEnvDuration("DISK_SCAN_INTERVAL", time.Minute),
+		DiskGrowthBytes:     int64(GetEnvInt("DISK_GROWTH_MB", 512)) << 20,
+		DiskGrowthFiles:     GetEnvInt("DISK_GROWTH_FILES", 10000),
+		DropWatchPaths:      GetEnvList("DROP_WATCH_PATHS", []string{"/tmp", "/var/tmp", "/dev/shm"}),
+		InodeUsagePercent:   GetEnvInt("INODE_USAGE_PERCENT", 90),
+		FDUsagePercent:      GetEnvInt("FD_USAGE_PERCENT", 80),
+		HighCPUPercent:      GetEnvInt("HIGH_CPU_PERCENT", 80),
+		HighCPUScans:        GetEnvInt("HIGH_CPU_SCANS", 6),
+		ProcEventMode:       GetEnv("PROC_EVENT_MODE", "auto"),
+		ProcScanMinInterval: GetEnvDuration("PROC_SCAN_MIN_INTERVAL", time.Second),
+		ProcScanSamples:     GetEnvInt("PROC_SCAN_SAMPLES", 3),
+		ProbeCommands:       probeCommands(),
+		ExecProbePolicy:     GetEnv("EXEC_PROBE_POLICY", "downrank"),
+		GPUMonitor:          GetEnv("GPU_MONITOR", "false") == "true",
+		GPUWorkload:         GetEnv("GPU_WORKLOAD", "false") == "true",
+		GPUScanInterval:     GetEnvDuration("GPU_SCAN_INTERVAL", 15*time.Second),
+		GPUAllowedProcesses: GetEnvList("GPU_ALLOWED_PROCESSES", nil),
+		GPUMetricsURL:       GetEnv("GPU_METRICS_URL", ""),
+		GPUUtilPercent:      GetEnvInt("GPU_UTIL_PERCENT", 50),
+		GPUUtilScans:        GetEnvInt("GPU_UTIL_SCANS", 4),
+		MonitoringMode:      GetEnv("APSS_MONITORING_MODE", "full"),
+		HeartbeatInterval:   GetEnvDuration("HEARTBEAT_INTERVAL", 30*time.Second),
+		MaxMonitorRestarts:  5,
+		StartupJitter:       GetEnvDuration("STARTUP_JITTER", 15*time.Second),
+		HealthAddr:          GetEnv("AGENT_HEALTH_ADDR", "127.0.0.1:8091"),
+		ControllerToken:     GetEnv("CONTROLLER_TOKEN", ""),
+		BreakerThreshold:    GetEnvInt("COLLECTOR_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:     GetEnvDuration("COLLECTOR_BREAKER_COOLDOWN", 30*time.Second),
+		SpoolDir:            GetEnv("SPOOL_DIR", ""),
+		SpoolMaxBytes:       int64(GetEnvInt("SPOOL_MAX_MB", 64)) << 20,
+		WorkloadIdentity:    GetEnv("WORKLOAD_IDENTITY_LOOKUP", "true") == "true",
+		RedactEnvSecrets:    GetEnv("REDACT_ENV_SECRETS", "true") == "true",
 	}
 }
 
@@ -93,6 +687,29 @@ func defaultWatchPaths() []string {
 	}
 }
 
+// probeCommands returns the exec probe commands in PROBE_COMMANDS. Invalid
+// JSON is ignored, leaving probes to be recognized by their period.
+func probeCommands() [][]string {
+	var commands [][]string
+	if v := os.Getenv("PROBE_COMMANDS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &commands); err != nil {
+			return nil
+		}
+	}
+	return commands
+}
+
+func defaultCredentialPaths() []string {
+	return []string{
+		"/var/run/secrets/kubernetes.io/serviceaccount",
+		"/run/secrets/kubernetes.io/serviceaccount",
+		"/var/run/secrets/eks.amazonaws.com/serviceaccount",
+		"/var/run/secrets/azure/tokens",
+		"~/.aws", "~/.config/gcloud", "~/.azure",
+		"~/.kube/config", "~/.docker/config.json",
+	}
+}
+
 func defaultSuspiciousProcesses() []string {
 	return []string{
 		"nc", "ncat", "netcat", "nmap", "masscan",
@@ -112,17 +729,152 @@ func defaultSuspiciousPorts() []int {
 func DefaultControllerConfig() ControllerConfig {
 	ep := GetEnv("SWEET_SECURITY_ENDPOINT", "")
 	key := GetEnv("SWEET_SECURITY_API_KEY", "")
+	sweetAuth := GetEnv("SWEET_SECURITY_AUTH_MODE", "bearer")
+	hecURL := GetEnv("SPLUNK_HEC_URL", "")
+	hecToken := GetEnv("SPLUNK_HEC_TOKEN", "")
 	return ControllerConfig{
-		HTTPAddr:              GetEnv("HTTP_ADDR", ":8080"),
-		ShutdownTimeout:       GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
-		EventBufferSize:       100000,
-		AlertBufferSize:       10000,
-		AgentStaleThreshold:   2 * time.Minute,
-		AlertRetentionCount:   10000,
-		SweetSecurityEnabled:  ep != "" && key != "",
-		SweetSecurityEndpoint: ep,
-		SweetSecurityAPIKey:   key,
-		SweetSecurityTimeout:  GetEnvDuration("SWEET_SECURITY_TIMEOUT", 30*time.Second),
+		HTTPAddr:                   GetEnv("HTTP_ADDR", ":8080"),
+		ShutdownTimeout:            GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		EventBufferSize:            100000,
+		AlertBufferSize:            10000,
+		AgentStaleThreshold:        2 * time.Minute,
+		AlertRetentionCount:        10000,
+		EventRetentionCount:        GetEnvInt("EVENT_RETENTION_COUNT", 50000),
+		AlertStreamBuffer:          256,
+		ClusterName:                GetEnv("CLUSTER_NAME", ""),
+		Environment:                GetEnv("ENVIRONMENT", ""),
+		LateralMovementWindow:      GetEnvDuration("LATERAL_MOVEMENT_WINDOW", 5*time.Minute),
+		CampaignWindow:             GetEnvDuration("CAMPAIGN_WINDOW", 15*time.Minute),
+		CampaignMinWorkloads:       GetEnvInt("CAMPAIGN_MIN_WORKLOADS", 3),
+		EventSummaryWindow:         GetEnvDuration("EVENT_SUMMARY_WINDOW", 0),
+		GraphRetention:             GetEnvDuration("GRAPH_RETENTION", 24*time.Hour),
+		GraphMaxNodes:              GetEnvInt("GRAPH_MAX_NODES", 50000),
+		TriageWindow:               GetEnvDuration("TRIAGE_WINDOW", 5*time.Second),
+		TriageInitWindow:           GetEnvDuration("TRIAGE_INIT_WINDOW", 2*time.Minute),
+		StateFile:                  GetEnv("STATE_FILE", ""),
+		StateSaveInterval:          GetEnvDuration("STATE_SAVE_INTERVAL", 30*time.Second),
+		StorageBackend:             GetEnv("STORAGE_BACKEND", ""),
+		StoragePath:                GetEnv("STORAGE_PATH", "/var/lib/apss/apss.db"),
+		StoragePostgresDSN:         GetEnv("STORAGE_POSTGRES_DSN", ""),
+		StorageRetention:           GetEnvDuration("STORAGE_RETENTION", 30*24*time.Hour),
+		StorageMigrate:             GetEnv("STORAGE_MIGRATE", "true") == "true",
+		CanaryInterval:             GetEnvDuration("CANARY_INTERVAL", 0),
+		MonitorCrashAlertThreshold: 3,
+		AgentTokensFile:            GetEnv("AGENT_TOKENS_FILE", ""),
+		OperatorTokensFile:         GetEnv("OPERATOR_TOKENS_FILE", ""),
+		IntegrationTokensFile:      GetEnv("INTEGRATION_TOKENS_FILE", ""),
+		SigmaRulesDir:              GetEnv("SIGMA_RULES_DIR", ""),
+		ShadowRules:                GetEnvList("SHADOW_RULES", nil),
+		SlowRuleThreshold:          GetEnvDuration("SLOW_RULE_THRESHOLD", 5*time.Millisecond),
+		SlowRuleDisable:            GetEnv("SLOW_RULE_DISABLE", "false") == "true",
+		PlaybooksFile:              GetEnv("PLAYBOOKS_FILE", ""),
+		YaraRulesDir:               GetEnv("YARA_RULES_DIR", ""),
+		KubeMetadata:               GetEnv("KUBE_METADATA", "true") == "true",
+		KubeMetadataLabels:         GetEnvList("KUBE_METADATA_LABELS", []string{"app", "app.kubernetes.io/name", "app.kubernetes.io/part-of", "team"}),
+		BrownoutFactor:             GetEnvInt("BROWNOUT_FACTOR", 4),
+		BrownoutDuration:           GetEnvDuration("BROWNOUT_DURATION", 30*time.Minute),
+		FederationEndpoint:         strings.TrimSuffix(GetEnv("FEDERATION_ENDPOINT", ""), "/"),
+		FederationToken:            GetEnv("FEDERATION_TOKEN", ""),
+		FederationInterval:         GetEnvDuration("FEDERATION_INTERVAL", 30*time.Second),
+		FederationBatchSize:        GetEnvInt("FEDERATION_BATCH_SIZE", 500),
+		FederationCentral:          GetEnv("FEDERATION_CENTRAL", "false") == "true",
+		LeaderElection:             GetEnv("LEADER_ELECTION", "false") == "true",
+		LeaderElectionNamespace:    GetEnv("POD_NAMESPACE", "apss-system"),
+		LeaderElectionLease:        GetEnv("LEADER_ELECTION_LEASE", "apss-controller"),
+		LeaseDuration:              GetEnvDuration("LEADER_ELECTION_LEASE_DURATION", 15*time.Second),
+		LeaseRenewDeadline:         GetEnvDuration("LEADER_ELECTION_RENEW_DEADLINE", 10*time.Second),
+		LeaseRetryPeriod:           GetEnvDuration("LEADER_ELECTION_RETRY_PERIOD", 2*time.Second),
+		PodName:                    GetEnv("POD_NAME", ""),
+		PodIP:                      GetEnv("POD_IP", ""),
+		Sharding:                   GetEnv("SHARDING", "false") == "true",
+		ShardingNamespace:          GetEnv("POD_NAMESPACE", "apss-system"),
+		ShardingSelector:           GetEnv("SHARDING_SELECTOR", "app.kubernetes.io/component=controller"),
+		ShardingRefresh:            GetEnvDuration("SHARDING_REFRESH", 10*time.Second),
+		FederationRetention:        GetEnvDuration("FEDERATION_RETENTION", 7*24*time.Hour),
+		FileBaselineSigningKeyFile: GetEnv("FIM_BASELINE_SIGNING_KEY_FILE", ""),
+		ThreatIntelIPFeeds:         GetEnvList("THREAT_INTEL_IP_FEEDS", nil),
+		ThreatIntelDomainFeeds:     GetEnvList("THREAT_INTEL_DOMAIN_FEEDS", nil),
+		ThreatIntelRefresh:         GetEnvDuration("THREAT_INTEL_REFRESH", time.Hour),
+		ThreatIntelTorFeeds:        GetEnvList("THREAT_INTEL_TOR_FEEDS", nil),
+		IOCExtraction:              GetEnv("IOC_EXTRACTION", "true") == "true",
+		IOCTTL:                     GetEnvDuration("IOC_TTL", 7*24*time.Hour),
+		SlackWebhookURL:            GetEnv("SLACK_WEBHOOK_URL", ""),
+		SlackChannel:               GetEnv("SLACK_CHANNEL", ""),
+		SlackSeverities:            GetEnvList("SLACK_SEVERITIES", []string{"HIGH", "CRITICAL"}),
+		PagerDutyRoutingKey:        GetEnv("PAGERDUTY_ROUTING_KEY", ""),
+		PagerDutySeverities:        GetEnvList("PAGERDUTY_SEVERITIES", []string{"CRITICAL"}),
+		WebhookSinksFile:           GetEnv("WEBHOOK_SINKS_FILE", ""),
+		SweetSecurityEnabled:       ep != "" && (key != "" || sweetAuth == "none"),
+		SweetSecurityEndpoint:      ep,
+		SweetSecurityAPIKey:        key,
+		SweetSecurityTimeout:       GetEnvDuration("SWEET_SECURITY_TIMEOUT", 30*time.Second),
+		SweetSecurityAuthMode:      sweetAuth,
+		SweetSecurityAPIKeyHeader:  GetEnv("SWEET_SECURITY_API_KEY_HEADER", ""),
+		SweetSecurityHeaders:       GetEnv("SWEET_SECURITY_HEADERS", ""),
+		SweetSecurityMaxRetries:    GetEnvInt("SWEET_SECURITY_MAX_RETRIES", 3),
+		SweetSecurityRetryBackoff:  GetEnvDuration("SWEET_SECURITY_RETRY_BACKOFF", 500*time.Millisecond),
+		SweetSecurityBreakerLimit:  GetEnvInt("SWEET_SECURITY_BREAKER_THRESHOLD", 5),
+		SweetSecurityBreakerReset:  GetEnvDuration("SWEET_SECURITY_BREAKER_COOLDOWN", 30*time.Second),
+		SweetSecurityQueueSize:     GetEnvInt("SWEET_SECURITY_QUEUE_SIZE", 10000),
+		SweetSecurityDropPolicy:    GetEnv("SWEET_SECURITY_DROP_POLICY", "drop-newest"),
+		SweetSecurityWorkers:       GetEnvInt("SWEET_SECURITY_WORKERS", 4),
+		SweetSecurityBatchSize:     GetEnvInt("SWEET_SECURITY_BATCH_SIZE", 100),
+		SweetSecurityFlushInterval: GetEnvDuration("SWEET_SECURITY_FLUSH_INTERVAL", 2*time.Second),
+		SweetSecurityMappingsFile:  GetEnv("SWEET_SECURITY_MAPPINGS_FILE", ""),
+		SplunkEnabled:              hecURL != "" && hecToken != "",
+		SplunkHECURL:               hecURL,
+		SplunkHECToken:             hecToken,
+		SplunkIndex:                GetEnv("SPLUNK_INDEX", ""),
+		SplunkEventSourceType:      GetEnv("SPLUNK_EVENT_SOURCETYPE", "apss:event"),
+		SplunkAlertSourceType:      GetEnv("SPLUNK_ALERT_SOURCETYPE", "apss:alert"),
+		SplunkBatchSize:            GetEnvInt("SPLUNK_BATCH_SIZE", 100),
+		SplunkFlushInterval:        GetEnvDuration("SPLUNK_FLUSH_INTERVAL", 5*time.Second),
+		ElasticsearchURL:           GetEnv("ELASTICSEARCH_URL", ""),
+		ElasticsearchAPIKey:        GetEnv("ELASTICSEARCH_API_KEY", ""),
+		ElasticsearchUsername:      GetEnv("ELASTICSEARCH_USERNAME", ""),
+		ElasticsearchPassword:      GetEnv("ELASTICSEARCH_PASSWORD", ""),
+		ElasticsearchIndexPrefix:   GetEnv("ELASTICSEARCH_INDEX_PREFIX", "apss"),
+		ElasticsearchBatchSize:     GetEnvInt("ELASTICSEARCH_BATCH_SIZE", 500),
+		ElasticsearchFlushInterval: GetEnvDuration("ELASTICSEARCH_FLUSH_INTERVAL", 5*time.Second),
+		OTLPEndpoint:               GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		OTLPProtocol:               GetEnv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf"),
+		OTLPHeaders:                GetEnv("OTEL_EXPORTER_OTLP_HEADERS", ""),
+		OTLPBatchSize:              GetEnvInt("OTLP_BATCH_SIZE", 512),
+		OTLPFlushInterval:          GetEnvDuration("OTLP_FLUSH_INTERVAL", 5*time.Second),
+		SyslogAddress:              GetEnv("SYSLOG_ADDRESS", ""),
+		SyslogProtocol:             GetEnv("SYSLOG_PROTOCOL", "tls"),
+		SyslogFormat:               GetEnv("SYSLOG_FORMAT", "cef"),
+		SyslogFacility:             GetEnvInt("SYSLOG_FACILITY", 10),
+		SyslogSDID:                 GetEnv("SYSLOG_SD_ID", "apss@32473"),
+		SyslogEvents:               GetEnv("SYSLOG_EVENTS", "false") == "true",
+		GCPProjectID:               GetEnv("GCP_PROJECT_ID", ""),
+		PubSubTopic:                GetEnv("PUBSUB_TOPIC", ""),
+		PubSubSeverities:           GetEnvList("PUBSUB_SEVERITIES", []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}),
+		CloudLoggingEnabled:        GetEnv("CLOUD_LOGGING_ENABLED", "false") == "true",
+		CloudLoggingLogName:        GetEnv("CLOUD_LOGGING_LOG_NAME", "apss-alerts"),
+		CloudLoggingSeverities:     GetEnvList("CLOUD_LOGGING_SEVERITIES", []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}),
+		MaxRequestBytes:            int64(GetEnvInt("MAX_REQUEST_BODY_MB", 10)) << 20,
+		MaxBatchEvents:             GetEnvInt("MAX_BATCH_EVENTS", 1000),
+		AgentMinProtocol:           GetEnvInt("AGENT_MIN_PROTOCOL", 1),
+		AgentCapabilities:          GetEnvList("AGENT_CAPABILITIES", []string{"batch", "gzip"}),
+		AgentEventRate:             GetEnvFloat("AGENT_EVENT_RATE", 100),
+		AgentEventBurst:            GetEnvInt("AGENT_EVENT_BURST", 2000),
+		AccessLogSample:            GetEnvFloat("ACCESS_LOG_SAMPLE", 0.01),
+		AccessLogSlow:              GetEnvDuration("ACCESS_LOG_SLOW", 0),
+		SlackDigest:                GetEnvDigest("SLACK"),
+		PagerDutyDigest:            GetEnvDigest("PAGERDUTY"),
+		PubSubDigest:               GetEnvDigest("PUBSUB"),
+		CloudLoggingDigest:         GetEnvDigest("CLOUD_LOGGING"),
+		DigestTemplateFile:         GetEnv("NOTIFY_DIGEST_TEMPLATE_FILE", ""),
+		SweetSecurityEgress:        GetEnvEgress("SWEET_SECURITY"),
+		SplunkEgress:               GetEnvEgress("SPLUNK"),
+		ElasticsearchEgress:        GetEnvEgress("ELASTICSEARCH"),
+		OTLPEgress:                 GetEnvEgress("OTLP"),
+		SyslogEgress:               GetEnvEgress("SYSLOG"),
+		SlackEgress:                GetEnvEgress("SLACK"),
+		PagerDutyEgress:            GetEnvEgress("PAGERDUTY"),
+		GCPEgress:                  GetEnvEgress("GCP"),
+		FederationEgress:           GetEnvEgress("FEDERATION"),
 	}
 }
 
@@ -134,12 +886,39 @@ func DefaultWebhookConfig() WebhookConfig {
 		namespaces[i] = strings.TrimSpace(n)
 	}
 	return WebhookConfig{
-		SidecarImage:       GetEnv("SIDECAR_IMAGE", "gcr.io/invisible-sre-sandbox/apss-agent:latest"),
-		ControllerEndpoint: GetEnv("CONTROLLER_ENDPOINT", "apss-controller.apss-system.svc.cluster.local:8080"),
-		ExcludeNamespaces:  namespaces,
-		ExcludeLabels:      nil,
-		TLSCertFile:        GetEnv("TLS_CERT_FILE", "/etc/webhook/certs/tls.crt"),
-		TLSKeyFile:         GetEnv("TLS_KEY_FILE", "/etc/webhook/certs/tls.key"),
-		HTTPAddr:           GetEnv("HTTP_ADDR", ":8443"),
+		SidecarImage:              GetEnv("SIDECAR_IMAGE", "gcr.io/invisible-sre-sandbox/apss-agent:latest"),
+		ControllerEndpoint:        GetEnv("CONTROLLER_ENDPOINT", "apss-controller.apss-system.svc.cluster.local:8080"),
+		ExcludeNamespaces:         namespaces,
+		ExcludeLabels:             nil,
+		NamespaceInjectionDefault: GetEnv("NAMESPACE_INJECTION_DEFAULT", "enabled"),
+		ExclusionsFile:            GetEnv("EXCLUSIONS_FILE", ""),
+		ImagePolicyFile:           GetEnv("IMAGE_POLICY_FILE", ""),
+		PosturePolicyFile:         GetEnv("POSTURE_POLICY_FILE", ""),
+		OPAURL:                    GetEnv("OPA_URL", ""),
+		OPATimeout:                GetEnvDuration("OPA_TIMEOUT", 2*time.Second),
+		OPAFailurePolicy:          GetEnv("OPA_FAILURE_POLICY", "ignore"),
+		OPACacheTTL:               GetEnvDuration("OPA_CACHE_TTL", 30*time.Second),
+		SidecarResourcesFile:      GetEnv("SIDECAR_RESOURCES_FILE", ""),
+		TLSCertFile:               GetEnv("TLS_CERT_FILE", "/etc/webhook/certs/tls.crt"),
+		TLSKeyFile:                GetEnv("TLS_KEY_FILE", "/etc/webhook/certs/tls.key"),
+		CertBootstrap:             GetEnv("CERT_BOOTSTRAP", "false") == "true",
+		CertSecretName:            GetEnv("CERT_SECRET_NAME", "apss-webhook-certs"),
+		WebhookConfigName:         GetEnv("WEBHOOK_CONFIG_NAME", "apss-webhook"),
+		Namespace:                 GetEnv("POD_NAMESPACE", "apss-system"),
+		ServiceName:               GetEnv("WEBHOOK_SERVICE_NAME", "apss-webhook"),
+		HTTPAddr:                  GetEnv("HTTP_ADDR", ":8443"),
+		AgentToken:                GetEnv("AGENT_TOKEN", ""),
+		AgentTokenSecretName:      GetEnv("AGENT_TOKEN_SECRET_NAME", ""),
+		AgentTokenSecretKey:       GetEnv("AGENT_TOKEN_SECRET_KEY", "token"),
+		FileBaselineKey:           GetEnv("FIM_BASELINE_PUBLIC_KEY", ""),
+		SidecarMode:               GetEnv("SIDECAR_MODE", "auto"),
+		WorkloadIdentityLookup:    GetEnv("WORKLOAD_IDENTITY_LOOKUP", "true") == "true",
+		ClusterName:               GetEnv("CLUSTER_NAME", ""),
+		Environment:               GetEnv("ENVIRONMENT", ""),
+		ExecProbePolicy:           GetEnv("EXEC_PROBE_POLICY", "downrank"),
+		RedactEnvSecrets:          GetEnv("REDACT_ENV_SECRETS", "true") == "true",
+		GPUNamespaces:             GetEnvList("GPU_NAMESPACES", nil),
+		GPUMetricsURL:             GetEnv("GPU_METRICS_URL", ""),
+		GPUAllowedProcesses:       GetEnvList("GPU_ALLOWED_PROCESSES", nil),
 	}
 }
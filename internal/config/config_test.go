@@ -2,8 +2,11 @@ package config
 
 import (
 	"os"
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
 )
 
 func TestGetEnv(t *testing.T) {
@@ -99,6 +102,30 @@ func TestDefaultAgentConfig(t *testing.T) {
 	}
 }
 
+func TestDefaultAgentConfig_Identity(t *testing.T) {
+	t.Setenv("POD_SERVICE_ACCOUNT", "api")
+	cfg := DefaultAgentConfig()
+	if cfg.ServiceAccount != "api" || !cfg.WorkloadIdentity {
+		t.Errorf("identity config = %q, lookup %v", cfg.ServiceAccount, cfg.WorkloadIdentity)
+	}
+	t.Setenv("WORKLOAD_IDENTITY_LOOKUP", "false")
+	if DefaultAgentConfig().WorkloadIdentity {
+		t.Error("WorkloadIdentity with WORKLOAD_IDENTITY_LOOKUP=false")
+	}
+}
+
+func TestDefaultAgentConfig_ProbeCommands(t *testing.T) {
+	t.Setenv("PROBE_COMMANDS", `[["sh","-c","pg_isready"],["cat","/tmp/ready"]]`)
+	cfg := DefaultAgentConfig()
+	if len(cfg.ProbeCommands) != 2 || cfg.ProbeCommands[0][2] != "pg_isready" || cfg.ExecProbePolicy != "downrank" {
+		t.Errorf("probe config = %q, policy %q", cfg.ProbeCommands, cfg.ExecProbePolicy)
+	}
+	t.Setenv("PROBE_COMMANDS", "not json")
+	if got := DefaultAgentConfig().ProbeCommands; got != nil {
+		t.Errorf("ProbeCommands from invalid JSON = %q", got)
+	}
+}
+
 func TestDefaultControllerConfig(t *testing.T) {
 	os.Unsetenv("SWEET_SECURITY_ENDPOINT")
 	os.Unsetenv("SWEET_SECURITY_API_KEY")
@@ -114,6 +141,81 @@ func TestDefaultControllerConfig(t *testing.T) {
 	}
 }
 
+func TestDefaultControllerConfig_Splunk(t *testing.T) {
+	t.Setenv("SPLUNK_HEC_URL", "https://splunk:8088")
+	if DefaultControllerConfig().SplunkEnabled {
+		t.Error("SplunkEnabled without SPLUNK_HEC_TOKEN")
+	}
+	t.Setenv("SPLUNK_HEC_TOKEN", "tok")
+	t.Setenv("SPLUNK_INDEX", "security")
+	cfg := DefaultControllerConfig()
+	if !cfg.SplunkEnabled || cfg.SplunkIndex != "security" || cfg.SplunkEventSourceType != "apss:event" || cfg.SplunkBatchSize != 100 {
+		t.Errorf("splunk config = %+v", cfg)
+	}
+}
+
+func TestDefaultControllerConfig_Elasticsearch(t *testing.T) {
+	t.Setenv("ELASTICSEARCH_URL", "https://es:9200")
+	t.Setenv("ELASTICSEARCH_BATCH_SIZE", "200")
+	cfg := DefaultControllerConfig()
+	if cfg.ElasticsearchURL != "https://es:9200" || cfg.ElasticsearchIndexPrefix != "apss" || cfg.ElasticsearchBatchSize != 200 {
+		t.Errorf("elasticsearch config = %+v", cfg)
+	}
+}
+
+func TestDefaultControllerConfig_OTLP(t *testing.T) {
+	if cfg := DefaultControllerConfig(); cfg.OTLPEndpoint != "" || cfg.OTLPProtocol != "http/protobuf" {
+		t.Errorf("otlp defaults = %q, %q", cfg.OTLPEndpoint, cfg.OTLPProtocol)
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://otel-collector:4317")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-tenant=acme")
+	cfg := DefaultControllerConfig()
+	if cfg.OTLPEndpoint != "http://otel-collector:4317" || cfg.OTLPProtocol != "grpc" || cfg.OTLPHeaders != "x-tenant=acme" || cfg.OTLPBatchSize != 512 {
+		t.Errorf("otlp config = %+v", cfg)
+	}
+}
+
+func TestDefaultControllerConfig_Syslog(t *testing.T) {
+	if cfg := DefaultControllerConfig(); cfg.SyslogAddress != "" || cfg.SyslogProtocol != "tls" || cfg.SyslogFormat != "cef" || cfg.SyslogEvents {
+		t.Errorf("syslog defaults = %q, %q, %q, %v", cfg.SyslogAddress, cfg.SyslogProtocol, cfg.SyslogFormat, cfg.SyslogEvents)
+	}
+	t.Setenv("SYSLOG_ADDRESS", "siem.example.com:6514")
+	t.Setenv("SYSLOG_FORMAT", "rfc5424")
+	t.Setenv("SYSLOG_EVENTS", "true")
+	t.Setenv("SYSLOG_CA_FILE", "/etc/apss/egress-ca/siem.pem")
+	cfg := DefaultControllerConfig()
+	if cfg.SyslogAddress != "siem.example.com:6514" || cfg.SyslogFormat != "rfc5424" || !cfg.SyslogEvents ||
+		cfg.SyslogFacility != 10 || cfg.SyslogSDID != "apss@32473" || cfg.SyslogEgress.CAFile != "/etc/apss/egress-ca/siem.pem" {
+		t.Errorf("syslog config = %+v", cfg)
+	}
+}
+
+func TestDefaultControllerConfig_GCPSinks(t *testing.T) {
+	cfg := DefaultControllerConfig()
+	if cfg.PubSubTopic != "" || cfg.CloudLoggingEnabled || cfg.CloudLoggingLogName != "apss-alerts" || len(cfg.PubSubSeverities) != 4 {
+		t.Errorf("gcp sink defaults = %+v", cfg)
+	}
+	t.Setenv("PUBSUB_TOPIC", "apss-alerts")
+	t.Setenv("CLOUD_LOGGING_ENABLED", "true")
+	t.Setenv("CLOUD_LOGGING_SEVERITIES", "HIGH,CRITICAL")
+	cfg = DefaultControllerConfig()
+	if cfg.PubSubTopic != "apss-alerts" || !cfg.CloudLoggingEnabled || len(cfg.CloudLoggingSeverities) != 2 {
+		t.Errorf("gcp sink config = %+v", cfg)
+	}
+}
+
+func TestGetEnvDigest(t *testing.T) {
+	if d := GetEnvDigest("SLACK"); len(d.Severities) != 0 || d.Window != 15*time.Minute {
+		t.Errorf("default digest = %+v", d)
+	}
+	t.Setenv("SLACK_DIGEST_SEVERITIES", "MEDIUM, LOW")
+	t.Setenv("SLACK_DIGEST_WINDOW", "1h")
+	if d := DefaultControllerConfig().SlackDigest; len(d.Severities) != 2 || d.Severities[1] != "LOW" || d.Window != time.Hour {
+		t.Errorf("slack digest = %+v", d)
+	}
+}
+
 func TestDefaultWebhookConfig(t *testing.T) {
 	cfg := DefaultWebhookConfig()
 	if cfg.SidecarImage == "" {
@@ -127,4 +229,113 @@ func TestDefaultWebhookConfig(t *testing.T) {
 			t.Error("ExcludeNamespaces should not contain empty strings")
 		}
 	}
+	if cfg.OPAURL != "" || cfg.OPAFailurePolicy != "ignore" || cfg.OPACacheTTL != 30*time.Second {
+		t.Errorf("OPA defaults = %q, %q, %v", cfg.OPAURL, cfg.OPAFailurePolicy, cfg.OPACacheTTL)
+	}
+}
+
+func TestGetEnvList(t *testing.T) {
+	os.Unsetenv("APSS_TEST_LIST")
+	if got := GetEnvList("APSS_TEST_LIST", []string{"/tmp"}); len(got) != 1 || got[0] != "/tmp" {
+		t.Errorf("GetEnvList(unset) = %v", got)
+	}
+	os.Setenv("APSS_TEST_LIST", " /a, ,/b ")
+	defer os.Unsetenv("APSS_TEST_LIST")
+	if got := GetEnvList("APSS_TEST_LIST", nil); len(got) != 2 || got[0] != "/a" || got[1] != "/b" {
+		t.Errorf("GetEnvList(set) = %v", got)
+	}
+}
+
+func TestGetEnvPorts(t *testing.T) {
+	os.Unsetenv("APSS_TEST_PORTS")
+	if got := GetEnvPorts("APSS_TEST_PORTS", []int{25}); len(got) != 1 || got[0] != 25 {
+		t.Errorf("GetEnvPorts(unset) = %v", got)
+	}
+	os.Setenv("APSS_TEST_PORTS", "6667, 6697,70000,irc")
+	defer os.Unsetenv("APSS_TEST_PORTS")
+	if got := GetEnvPorts("APSS_TEST_PORTS", nil); len(got) != 2 || got[0] != 6667 || got[1] != 6697 {
+		t.Errorf("GetEnvPorts(set) = %v", got)
+	}
+	os.Setenv("APSS_TEST_PORTS", "none")
+	if got := GetEnvPorts("APSS_TEST_PORTS", []int{25}); got == nil || len(got) != 0 {
+		t.Errorf("GetEnvPorts(none) = %v", got)
+	}
+}
+
+func TestGetEnvInt(t *testing.T) {
+	os.Setenv("APSS_TEST_INT", "not-a-number")
+	defer os.Unsetenv("APSS_TEST_INT")
+	if got := GetEnvInt("APSS_TEST_INT", 7); got != 7 {
+		t.Errorf("GetEnvInt(invalid) = %d, want 7", got)
+	}
+	if !slices.Contains(InvalidEnv(), `APSS_TEST_INT="not-a-number" is invalid, the default is used`) {
+		t.Errorf("InvalidEnv() = %q", InvalidEnv())
+	}
+	os.Setenv("APSS_TEST_INT", "42")
+	if got := GetEnvInt("APSS_TEST_INT", 7); got != 42 {
+		t.Errorf("GetEnvInt(42) = %d", got)
+	}
+}
+
+func TestDefaultControllerConfig_IngestionLimits(t *testing.T) {
+	cfg := DefaultControllerConfig()
+	if cfg.MaxRequestBytes != 10<<20 || cfg.MaxBatchEvents != 1000 {
+		t.Errorf("ingestion limit defaults = %d bytes, %d events", cfg.MaxRequestBytes, cfg.MaxBatchEvents)
+	}
+	if cfg.AgentMinProtocol != 1 || !slices.Equal(cfg.AgentCapabilities, []string{"batch", "gzip"}) {
+		t.Errorf("agent protocol defaults = %d, %v", cfg.AgentMinProtocol, cfg.AgentCapabilities)
+	}
+	if cfg.AgentEventRate != 100 || cfg.AgentEventBurst != 2000 {
+		t.Errorf("agent event rate defaults = %v/s, burst %d", cfg.AgentEventRate, cfg.AgentEventBurst)
+	}
+	t.Setenv("MAX_REQUEST_BODY_MB", "2")
+	t.Setenv("MAX_BATCH_EVENTS", "0")
+	cfg = DefaultControllerConfig()
+	if cfg.MaxRequestBytes != 2<<20 || cfg.MaxBatchEvents != 0 {
+		t.Errorf("ingestion limits = %d bytes, %d events", cfg.MaxRequestBytes, cfg.MaxBatchEvents)
+	}
+}
+
+func TestDefaultControllerConfig_SweetSecurityRetries(t *testing.T) {
+	cfg := DefaultControllerConfig()
+	if cfg.SweetSecurityMaxRetries != 3 || cfg.SweetSecurityBreakerLimit != 5 || cfg.SweetSecurityBreakerReset != 30*time.Second {
+		t.Errorf("sweet security retry defaults = %+v", cfg)
+	}
+	t.Setenv("SWEET_SECURITY_MAX_RETRIES", "-1")
+	t.Setenv("SWEET_SECURITY_BREAKER_THRESHOLD", "10")
+	t.Setenv("SWEET_SECURITY_BREAKER_COOLDOWN", "2m")
+	cfg = DefaultControllerConfig()
+	if cfg.SweetSecurityMaxRetries != -1 || cfg.SweetSecurityBreakerLimit != 10 || cfg.SweetSecurityBreakerReset != 2*time.Minute {
+		t.Errorf("sweet security retry config = %+v", cfg)
+	}
+}
+
+func TestDefaultControllerConfig_Egress(t *testing.T) {
+	if cfg := DefaultControllerConfig(); !cfg.SplunkEgress.IsZero() || !cfg.SlackEgress.IsZero() {
+		t.Errorf("egress defaults = %+v, %+v; want zero", cfg.SplunkEgress, cfg.SlackEgress)
+	}
+	t.Setenv("SPLUNK_PROXY_URL", "http://proxy.corp:3128")
+	t.Setenv("SPLUNK_CA_FILE", "/etc/apss/egress-ca/corp.pem")
+	t.Setenv("PAGERDUTY_TLS_SKIP_VERIFY", "true")
+	cfg := DefaultControllerConfig()
+	want := egress.Config{ProxyURL: "http://proxy.corp:3128", CAFile: "/etc/apss/egress-ca/corp.pem"}
+	if cfg.SplunkEgress != want {
+		t.Errorf("SplunkEgress = %+v, want %+v", cfg.SplunkEgress, want)
+	}
+	if !cfg.PagerDutyEgress.InsecureSkipVerify || !cfg.ElasticsearchEgress.IsZero() {
+		t.Errorf("egress = pagerduty %+v, elasticsearch %+v", cfg.PagerDutyEgress, cfg.ElasticsearchEgress)
+	}
+}
+
+func TestDefaultControllerConfig_SweetSecurityQueue(t *testing.T) {
+	cfg := DefaultControllerConfig()
+	if cfg.SweetSecurityQueueSize != 10000 || cfg.SweetSecurityDropPolicy != "drop-newest" || cfg.SweetSecurityWorkers != 4 || cfg.SweetSecurityBatchSize != 100 {
+		t.Errorf("sweet security queue defaults = %+v", cfg)
+	}
+	t.Setenv("SWEET_SECURITY_DROP_POLICY", "drop-oldest")
+	t.Setenv("SWEET_SECURITY_WORKERS", "8")
+	cfg = DefaultControllerConfig()
+	if cfg.SweetSecurityDropPolicy != "drop-oldest" || cfg.SweetSecurityWorkers != 8 {
+		t.Errorf("sweet security queue config = %+v", cfg)
+	}
 }
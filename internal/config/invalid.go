@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// invalid holds the environment variables set to values the GetEnv
+// functions could not parse and replaced with their default, by key.
+var (
+	invalid   = make(map[string]string)
+	invalidMu sync.Mutex
+)
+
+// recordInvalid notes that key's value s was ignored; unset keys are not
+// recorded.
+func recordInvalid(key, s string) {
+	if s == "" {
+		return
+	}
+	invalidMu.Lock()
+	defer invalidMu.Unlock()
+	invalid[key] = fmt.Sprintf("%s=%q is invalid, the default is used", key, s)
+}
+
+// InvalidEnv describes, sorted by key, the environment variables read so far
+// whose values could not be parsed and were replaced with their default.
+func InvalidEnv() []string {
+	invalidMu.Lock()
+	defer invalidMu.Unlock()
+	keys := make([]string, 0, len(invalid))
+	for k := range invalid {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = invalid[k]
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+var (
+	// ErrNoAgentConfig is returned when no runtime config has been pushed yet.
+	ErrNoAgentConfig = errors.New("no agent config set")
+	// ErrInvalidAgentConfig is returned when a pushed config fails validation.
+	ErrInvalidAgentConfig = errors.New("invalid agent config")
+)
+
+// AgentConfig returns the current runtime config pushed to agents.
+func (c *Controller) AgentConfig() (*types.AgentRuntimeConfig, error) {
+	c.agentConfigMu.RLock()
+	defer c.agentConfigMu.RUnlock()
+	if c.agentConfig == nil {
+		return nil, ErrNoAgentConfig
+	}
+	return c.agentConfig, nil
+}
+
+// SetAgentConfig validates and stores a new runtime config for all agents,
+// bumping the revision. Agents pick it up on their next poll.
+func (c *Controller) SetAgentConfig(cfg types.AgentRuntimeConfig) (*types.AgentRuntimeConfig, error) {
+	if err := validateAgentConfig(&cfg); err != nil {
+		return nil, err
+	}
+
+	c.agentConfigMu.Lock()
+	if c.agentConfig != nil {
+		cfg.Revision = c.agentConfig.Revision + 1
+	} else {
+		cfg.Revision = 1
+	}
+	cfg.UpdatedAt = time.Now()
+	c.agentConfig = &cfg
+	c.agentConfigMu.Unlock()
+
+	c.log.WithFields(logrus.Fields{
+		"revision":             cfg.Revision,
+		"suspicious_processes": len(cfg.SuspiciousProcesses),
+		"watch_paths":          len(cfg.WatchPaths),
+		"watch_exclude":        len(cfg.WatchExclude),
+		"suspicious_ports":     len(cfg.SuspiciousPorts),
+		"exe_hash_allowlist":   len(cfg.ExeHashAllowlist),
+		"exe_hash_denylist":    len(cfg.ExeHashDenylist),
+	}).Info("Agent config updated")
+	return &cfg, nil
+}
+
+func validateAgentConfig(cfg *types.AgentRuntimeConfig) error {
+	for _, p := range cfg.SuspiciousProcesses {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("%w: suspicious process pattern %q: %v", ErrInvalidAgentConfig, p, err)
+		}
+	}
+	for _, p := range cfg.WatchPaths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("%w: watch path %q is not absolute", ErrInvalidAgentConfig, p)
+		}
+	}
+	for _, p := range append(append([]string(nil), cfg.WatchPaths...), cfg.WatchExclude...) {
+		if err := fileintegrity.ValidatePattern(p); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAgentConfig, err)
+		}
+	}
+	for _, port := range cfg.SuspiciousPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%w: port %d out of range", ErrInvalidAgentConfig, port)
+		}
+	}
+	for _, h := range append(append([]string(nil), cfg.ExeHashAllowlist...), cfg.ExeHashDenylist...) {
+		if b, err := hex.DecodeString(h); err != nil || len(b) != 32 {
+			return fmt.Errorf("%w: executable hash %q is not a hex SHA-256", ErrInvalidAgentConfig, h)
+		}
+	}
+	return nil
+}
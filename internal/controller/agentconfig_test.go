@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_AgentConfig(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+
+	if _, err := c.AgentConfig(); !errors.Is(err, ErrNoAgentConfig) {
+		t.Fatalf("AgentConfig before set: err = %v", err)
+	}
+
+	got, err := c.SetAgentConfig(types.AgentRuntimeConfig{SuspiciousProcesses: []string{"xmrig"}, SuspiciousPorts: []int{4444}})
+	if err != nil {
+		t.Fatalf("SetAgentConfig: %v", err)
+	}
+	if got.Revision != 1 || got.UpdatedAt.IsZero() {
+		t.Errorf("first config = %+v", got)
+	}
+	got, err = c.SetAgentConfig(types.AgentRuntimeConfig{WatchPaths: []string{"/etc/shadow"}, Revision: 99})
+	if err != nil {
+		t.Fatalf("SetAgentConfig: %v", err)
+	}
+	if got.Revision != 2 {
+		t.Errorf("revision = %d, want 2 (client revision is ignored)", got.Revision)
+	}
+	current, _ := c.AgentConfig()
+	if current.Revision != 2 || current.SuspiciousProcesses != nil {
+		t.Errorf("current config = %+v", current)
+	}
+
+	invalid := []types.AgentRuntimeConfig{
+		{SuspiciousProcesses: []string{"("}},
+		{WatchPaths: []string{"etc/passwd"}},
+		{WatchPaths: []string{"/app/[config"}},
+		{WatchExclude: []string{"*.log", "[a-"}},
+		{SuspiciousPorts: []int{70000}},
+		{ExeHashDenylist: []string{"d41d8cd98f00b204e9800998ecf8427e"}},
+		{ExeHashAllowlist: []string{"not-hex"}},
+	}
+	for _, cfg := range invalid {
+		if _, err := c.SetAgentConfig(cfg); !errors.Is(err, ErrInvalidAgentConfig) {
+			t.Errorf("SetAgentConfig(%+v): err = %v", cfg, err)
+		}
+	}
+	if current, _ := c.AgentConfig(); current.Revision != 2 {
+		t.Errorf("invalid update changed revision to %d", current.Revision)
+	}
+}
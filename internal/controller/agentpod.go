@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotAgentPod is returned for an agent request that does not come
+	// from the agent's own pod.
+	ErrNotAgentPod = errors.New("request does not come from the agent's pod")
+	// ErrAgentNotRegistered is returned with ErrNotAgentPod by
+	// VerifyAgentPod for an agent the controller has no pod IP for yet, such
+	// as after a restart, until it registers or heartbeats.
+	ErrAgentNotRegistered = errors.New("agent not registered")
+)
+
+// VerifyAgentPod checks that a request from ip may act as agent id, as any
+// agent token may name any agent. When pod metadata is cached, ip must be
+// the IP Kubernetes gave the pod the agent registered as, which follows a
+// pod recreated under the same name; otherwise it must be the pod IP the
+// agent registered with.
+func (c *Controller) VerifyAgentPod(id, ip string) error {
+	c.agentsMu.RLock()
+	agent, ok := c.agents[id]
+	var ns, name, registered string
+	if ok {
+		ns, name, registered = agent.PodNamespace, agent.PodName, agent.PodIP
+	}
+	c.agentsMu.RUnlock()
+	switch {
+	case registered == "":
+		return fmt.Errorf("%w: %w: %s", ErrNotAgentPod, ErrAgentNotRegistered, id)
+	case c.podMeta == nil:
+		if registered != ip {
+			return fmt.Errorf("%w: agent %s registered pod IP %q", ErrNotAgentPod, id, registered)
+		}
+		return nil
+	}
+	if podIP, ok := c.podMeta.podIP(ns, name); !ok || podIP != ip {
+		return fmt.Errorf("%w: pod %s/%s does not have IP %s", ErrNotAgentPod, ns, name, ip)
+	}
+	return nil
+}
+
+// VerifyRegistration checks that a request from ip may register agent id,
+// or heartbeat for it, as running in pod ns/name with podIP. The pod IP
+// must be ip. An agent already registered keeps its pod: when pod metadata
+// is cached, pod ns/name must be the one it registered as and have IP ip;
+// without it, ip must be the one it registered with, until the agent goes
+// stale. Without pod metadata, an agent registering under another's pod
+// name is not caught.
+func (c *Controller) VerifyRegistration(id, ns, name, podIP, ip string) error {
+	c.agentsMu.RLock()
+	agent, ok := c.agents[id]
+	var regNS, regName, registered string
+	if ok {
+		regNS, regName, registered = agent.PodNamespace, agent.PodName, agent.PodIP
+	}
+	c.agentsMu.RUnlock()
+	switch {
+	case podIP != ip:
+		return fmt.Errorf("%w: agent %s reports pod IP %q", ErrNotAgentPod, id, podIP)
+	case c.podMeta == nil:
+		if registered != "" && registered != ip {
+			return fmt.Errorf("%w: agent %s registered pod IP %q", ErrNotAgentPod, id, registered)
+		}
+		return nil
+	case registered != "" && (regNS != ns || regName != name):
+		return fmt.Errorf("%w: agent %s registered as pod %s/%s", ErrNotAgentPod, id, regNS, regName)
+	}
+	if actual, ok := c.podMeta.podIP(ns, name); !ok || actual != ip {
+		return fmt.Errorf("%w: pod %s/%s does not have IP %s", ErrNotAgentPod, ns, name, ip)
+	}
+	return nil
+}
+
+// IsReplica reports whether ip is the pod IP of name, another replica of
+// this controller: a pod in its namespace with the same owner. Followers
+// forward agent requests to the leader with the agent's IP, which the
+// leader only takes from a replica. Telling needs pod metadata.
+func (c *Controller) IsReplica(name, ip string) bool {
+	if c.podMeta == nil || c.cfg.PodName == "" || name == c.cfg.PodName {
+		return false
+	}
+	ns := c.cfg.LeaderElectionNamespace
+	if podIP, ok := c.podMeta.podIP(ns, name); !ok || podIP != ip {
+		return false
+	}
+	self, peer := c.podMeta.lookup(ns, c.cfg.PodName), c.podMeta.lookup(ns, name)
+	return self != nil && peer != nil && self.OwnerName != "" &&
+		self.OwnerKind == peer.OwnerKind && self.OwnerName == peer.OwnerName
+}
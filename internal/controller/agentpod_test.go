@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_VerifyAgentPod(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	if err := c.RegisterAgent(&types.AgentRegistration{AgentID: "a1", PodName: "api-0", PodNamespace: "shop", PodIP: "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyAgentPod("a1", "10.0.0.5"); err != nil {
+		t.Errorf("agent's own pod: %v", err)
+	}
+	if err := c.VerifyAgentPod("a1", "10.0.0.6"); !errors.Is(err, ErrNotAgentPod) || errors.Is(err, ErrAgentNotRegistered) {
+		t.Errorf("another pod = %v", err)
+	}
+	if err := c.VerifyAgentPod("a2", "10.0.0.5"); !errors.Is(err, ErrNotAgentPod) || !errors.Is(err, ErrAgentNotRegistered) {
+		t.Errorf("unregistered agent = %v", err)
+	}
+
+	// With pod metadata, the pod the agent registered as must have the IP,
+	// wherever the agent registered from.
+	c.podMeta = &podMetadata{pods: map[string]*podMetaEntry{podKey("shop", "api-0"): {ip: "10.0.0.9"}}}
+	if err := c.VerifyAgentPod("a1", "10.0.0.5"); !errors.Is(err, ErrNotAgentPod) {
+		t.Errorf("agent claiming another pod = %v", err)
+	}
+	if err := c.VerifyAgentPod("a1", "10.0.0.9"); err != nil {
+		t.Errorf("agent's pod recreated = %v", err)
+	}
+}
+
+func TestController_VerifyRegistration(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	if err := c.VerifyRegistration("a1", "shop", "api-0", "10.0.0.5", "10.0.0.5"); err != nil {
+		t.Errorf("new agent: %v", err)
+	}
+	if err := c.VerifyRegistration("a1", "shop", "api-0", "10.0.0.5", "10.0.0.6"); !errors.Is(err, ErrNotAgentPod) {
+		t.Errorf("pod IP of another pod = %v", err)
+	}
+	if err := c.RegisterAgent(&types.AgentRegistration{AgentID: "a1", PodName: "api-0", PodNamespace: "shop", PodIP: "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyRegistration("a1", "shop", "api-0", "10.0.0.6", "10.0.0.6"); !errors.Is(err, ErrNotAgentPod) {
+		t.Errorf("taking over a registered agent = %v", err)
+	}
+
+	c.podMeta = &podMetadata{pods: map[string]*podMetaEntry{
+		podKey("shop", "api-0"): {ip: "10.0.0.6"},
+		podKey("shop", "web-0"): {ip: "10.0.0.7"},
+	}}
+	if err := c.VerifyRegistration("a1", "shop", "api-0", "10.0.0.6", "10.0.0.6"); err != nil {
+		t.Errorf("agent's pod recreated: %v", err)
+	}
+	if err := c.VerifyRegistration("a1", "shop", "web-0", "10.0.0.7", "10.0.0.7"); !errors.Is(err, ErrNotAgentPod) {
+		t.Errorf("another pod taking over the agent = %v", err)
+	}
+	if err := c.VerifyRegistration("a2", "shop", "api-0", "10.0.0.7", "10.0.0.7"); !errors.Is(err, ErrNotAgentPod) {
+		t.Errorf("agent claiming another pod = %v", err)
+	}
+}
+
+func TestController_IsReplica(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, PodName: "ctl-a", LeaderElectionNamespace: "apss-system"}, logrus.New())
+	if c.IsReplica("ctl-b", "10.0.1.2") {
+		t.Error("replica known without pod metadata")
+	}
+	owner := &types.KubeMetadata{OwnerKind: "Deployment", OwnerName: "apss-controller"}
+	c.podMeta = &podMetadata{pods: map[string]*podMetaEntry{
+		podKey("apss-system", "ctl-a"): {meta: owner, ip: "10.0.1.1"},
+		podKey("apss-system", "ctl-b"): {meta: owner, ip: "10.0.1.2"},
+		podKey("apss-system", "other"): {meta: &types.KubeMetadata{OwnerKind: "Deployment", OwnerName: "other"}, ip: "10.0.1.3"},
+	}}
+	if !c.IsReplica("ctl-b", "10.0.1.2") {
+		t.Error("replica not recognized")
+	}
+	for _, tc := range []struct{ name, ip string }{{"ctl-b", "10.0.0.5"}, {"other", "10.0.1.3"}, {"ctl-a", "10.0.1.1"}} {
+		if c.IsReplica(tc.name, tc.ip) {
+			t.Errorf("IsReplica(%s, %s) = true", tc.name, tc.ip)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+var (
+	// ErrAlertNotFound is returned when an alert ID is not in the retained set.
+	ErrAlertNotFound = errors.New("alert not found")
+	// ErrInvalidAlertStatus is returned when an update names an unknown lifecycle state.
+	ErrInvalidAlertStatus = errors.New("invalid alert status")
+)
+
+// GetAlert returns the alert with the given ID.
+func (c *Controller) GetAlert(id string) (*types.Alert, error) {
+	c.alertsMu.RLock()
+	defer c.alertsMu.RUnlock()
+	if i := c.alertIndex(id); i >= 0 {
+		return c.alerts[i], nil
+	}
+	return nil, ErrAlertNotFound
+}
+
+// UpdateAlert applies a triage update (status and/or assignee) to an alert and
+// returns the updated copy. Alerts are replaced rather than mutated in place so
+// that readers holding earlier pointers never observe a partial update.
+func (c *Controller) UpdateAlert(id string, update types.AlertUpdate) (*types.Alert, error) {
+	if update.Status != nil && !types.ValidAlertStatus(*update.Status) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAlertStatus, *update.Status)
+	}
+
+	c.alertsMu.Lock()
+	i := c.alertIndex(id)
+	if i < 0 {
+		c.alertsMu.Unlock()
+		return nil, ErrAlertNotFound
+	}
+	updated := *c.alerts[i]
+	now := time.Now()
+	if update.Status != nil && *update.Status != updated.Status {
+		updated.Status = *update.Status
+		switch updated.Status {
+		case types.AlertStatusAcked:
+			updated.AckedAt = &now
+		case types.AlertStatusResolved:
+			updated.ResolvedAt = &now
+		case types.AlertStatusOpen:
+			updated.AckedAt = nil
+			updated.ResolvedAt = nil
+		}
+	}
+	if update.Assignee != nil {
+		updated.Assignee = *update.Assignee
+	}
+	updated.UpdatedAt = &now
+	if c.shards != nil {
+		// The replica that raised it has left, or forwarded the update:
+		// this one keeps the alert from now on.
+		updated.Replica = c.shards.self
+	}
+	c.interner.alert(&updated)
+	c.alerts[i] = &updated
+	c.alertsMu.Unlock()
+	c.storeAlert(&updated)
+	detail := map[string]string{"status": updated.Status, "assignee": updated.Assignee}
+	c.audit(types.AuditAlertUpdated, id, detail)
+	if c.elastic != nil {
+		// Re-indexing under the same ID keeps the triage state searchable.
+		c.elastic.IndexAlert(updated.ID, updated.Timestamp, &updated)
+	}
+
+	c.log.WithFields(logrus.Fields{
+		"alert_id": id, "status": updated.Status, "assignee": updated.Assignee,
+	}).Info("Alert updated")
+	return &updated, nil
+}
+
+// alertIndex returns the position of id in c.alerts, or -1. Caller must hold alertsMu.
+func (c *Controller) alertIndex(id string) int {
+	for i := len(c.alerts) - 1; i >= 0; i-- {
+		if c.alerts[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
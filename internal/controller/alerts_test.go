@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func newTestControllerWithAlerts(t *testing.T, alerts ...*types.Alert) *Controller {
+	t.Helper()
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	c.alerts = append(c.alerts, alerts...)
+	return c
+}
+
+func TestController_UpdateAlert(t *testing.T) {
+	c := newTestControllerWithAlerts(t,
+		&types.Alert{ID: "a1", Timestamp: time.Now(), Status: types.AlertStatusOpen},
+		&types.Alert{ID: "a2", Timestamp: time.Now(), Status: types.AlertStatusOpen},
+	)
+	before, _ := c.GetAlert("a1")
+
+	acked := types.AlertStatusAcked
+	assignee := "oncall@example.com"
+	got, err := c.UpdateAlert("a1", types.AlertUpdate{Status: &acked, Assignee: &assignee})
+	if err != nil {
+		t.Fatalf("UpdateAlert: %v", err)
+	}
+	if got.Status != types.AlertStatusAcked || got.Assignee != assignee || got.AckedAt == nil || got.UpdatedAt == nil {
+		t.Errorf("updated alert: %+v", got)
+	}
+	if before.Status != types.AlertStatusOpen {
+		t.Error("previously returned alert pointer must not be mutated")
+	}
+
+	resolved := types.AlertStatusResolved
+	got, err = c.UpdateAlert("a1", types.AlertUpdate{Status: &resolved})
+	if err != nil {
+		t.Fatalf("UpdateAlert resolve: %v", err)
+	}
+	if got.ResolvedAt == nil || got.Assignee != assignee {
+		t.Errorf("resolve should set ResolvedAt and keep assignee: %+v", got)
+	}
+
+	open, _ := c.GetAlerts(types.AlertFilter{Status: types.AlertStatusOpen})
+	if len(open) != 1 || open[0].ID != "a2" {
+		t.Errorf("GetAlertsByStatus(open) = %+v", open)
+	}
+}
+
+func TestController_UpdateAlert_Errors(t *testing.T) {
+	c := newTestControllerWithAlerts(t, &types.Alert{ID: "a1", Status: types.AlertStatusOpen})
+
+	bogus := "closed"
+	if _, err := c.UpdateAlert("a1", types.AlertUpdate{Status: &bogus}); !errors.Is(err, ErrInvalidAlertStatus) {
+		t.Errorf("invalid status: got %v", err)
+	}
+	if _, err := c.UpdateAlert("missing", types.AlertUpdate{}); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("missing alert: got %v", err)
+	}
+	if _, err := c.GetAlert("missing"); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("GetAlert missing: got %v", err)
+	}
+}
+
+func TestController_GetAlerts_FilterSortPage(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	c := newTestControllerWithAlerts(t,
+		&types.Alert{ID: "a1", Timestamp: base, Severity: "MEDIUM", RuleID: "APSS-004", PodNS: "web", PodName: "p1", Status: types.AlertStatusOpen},
+		&types.Alert{ID: "a2", Timestamp: base.Add(time.Minute), Severity: "CRITICAL", RuleID: "APSS-002", PodNS: "web", PodName: "p2", Status: types.AlertStatusOpen},
+		&types.Alert{ID: "a3", Timestamp: base.Add(2 * time.Minute), Severity: "HIGH", RuleID: "APSS-003", PodNS: "db", PodName: "p3", Status: types.AlertStatusOpen},
+		&types.Alert{ID: "a4", Timestamp: base.Add(3 * time.Minute), Severity: "MEDIUM", RuleID: "APSS-004", PodNS: "web", PodName: "p1", Status: types.AlertStatusOpen},
+	)
+	ids := func(alerts []*types.Alert) string {
+		var out []string
+		for _, a := range alerts {
+			out = append(out, a.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name      string
+		filter    types.AlertFilter
+		want      string
+		wantTotal int
+	}{
+		{"default oldest first", types.AlertFilter{}, "a1,a2,a3,a4", 4},
+		{"descending", types.AlertFilter{Order: types.SortDesc}, "a4,a3,a2,a1", 4},
+		{"namespace", types.AlertFilter{Namespace: "web"}, "a1,a2,a4", 3},
+		{"rule and pod", types.AlertFilter{RuleID: "APSS-004", Pod: "p1"}, "a1,a4", 2},
+		{"severities", types.AlertFilter{Severities: []string{"HIGH", "CRITICAL"}}, "a2,a3", 2},
+		{"time range", types.AlertFilter{Since: base.Add(30 * time.Second), Until: base.Add(150 * time.Second)}, "a2,a3", 2},
+		{"severity sort", types.AlertFilter{Sort: types.AlertSortSeverity}, "a1,a4,a3,a2", 4},
+		{"most severe first", types.AlertFilter{Sort: types.AlertSortSeverity, Order: types.SortDesc}, "a2,a3,a4,a1", 4},
+		{"page", types.AlertFilter{Limit: 2, Offset: 1}, "a2,a3", 4},
+		{"offset past end", types.AlertFilter{Offset: 10}, "", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := c.GetAlerts(tt.filter)
+			if ids(got) != tt.want || total != tt.wantTotal {
+				t.Errorf("GetAlerts = %q (total %d), want %q (total %d)", ids(got), total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// arrivalWindow is how many seconds of arrivals the ingest rate gauges
+// cover.
+const arrivalWindow = 60
+
+// Arrival kinds, the kind label of the ingest rate gauges
+const (
+	arrivalEvent        = "event"
+	arrivalHeartbeat    = "heartbeat"
+	arrivalRegistration = "registration"
+)
+
+var (
+	ingestRatePeak = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_ingest_rate_peak",
+			Help: "Highest arrivals in one second over the last minute",
+		},
+		[]string{"kind"},
+	)
+	ingestRateMean = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_ingest_rate_mean",
+			Help: "Mean arrivals per second over the last minute",
+		},
+		[]string{"kind"},
+	)
+	ingestBurstiness = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_ingest_burstiness",
+			Help: "Peak over mean arrivals per second over the last minute; 1 is perfectly smooth",
+		},
+		[]string{"kind"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(ingestRatePeak, ingestRateMean, ingestBurstiness)
+}
+
+// arrivals counts arrivals per second over the last arrivalWindow seconds.
+// A counter's rate() averages bursts away; these show agents reporting in
+// lockstep, such as after pods restarted together.
+type arrivals struct {
+	mu sync.Mutex
+	// counts has a slot for the current second too. secs is the Unix
+	// second each slot is for.
+	counts [arrivalWindow + 1]int
+	secs   [arrivalWindow + 1]int64
+}
+
+func (a *arrivals) record(now time.Time) {
+	sec := now.Unix()
+	slot := sec % int64(len(a.counts))
+	a.mu.Lock()
+	if a.secs[slot] != sec {
+		a.secs[slot] = sec
+		a.counts[slot] = 0
+	}
+	a.counts[slot]++
+	a.mu.Unlock()
+}
+
+// stats returns the peak and mean arrivals per second over the
+// arrivalWindow seconds before now's, which is not over yet.
+func (a *arrivals) stats(now time.Time) (peak int, mean float64) {
+	sec := now.Unix()
+	total := 0
+	a.mu.Lock()
+	for i, s := range a.secs {
+		if s >= sec || s < sec-arrivalWindow {
+			continue
+		}
+		total += a.counts[i]
+		peak = max(peak, a.counts[i])
+	}
+	a.mu.Unlock()
+	return peak, float64(total) / arrivalWindow
+}
+
+// ingestRates tracks the arrivals of each kind.
+type ingestRates map[string]*arrivals
+
+func newIngestRates() ingestRates {
+	return ingestRates{
+		arrivalEvent:        &arrivals{},
+		arrivalHeartbeat:    &arrivals{},
+		arrivalRegistration: &arrivals{},
+	}
+}
+
+// update sets the ingest rate gauges.
+func (r ingestRates) update(now time.Time) {
+	for kind, a := range r {
+		peak, mean := a.stats(now)
+		ingestRatePeak.WithLabelValues(kind).Set(float64(peak))
+		ingestRateMean.WithLabelValues(kind).Set(mean)
+		burstiness := 0.0
+		if mean > 0 {
+			burstiness = float64(peak) / mean
+		}
+		ingestBurstiness.WithLabelValues(kind).Set(burstiness)
+	}
+}
+
+// runIngestRates refreshes the ingest rate gauges every few seconds.
+func (c *Controller) runIngestRates(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.arrivals.update(now)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArrivals(t *testing.T) {
+	var a arrivals
+	base := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 30; i++ {
+		a.record(base)
+	}
+	for s := 1; s <= 59; s++ {
+		a.record(base.Add(time.Duration(s) * time.Second))
+	}
+	// The current second is still filling up and not counted.
+	a.record(base.Add(60 * time.Second))
+
+	peak, mean := a.stats(base.Add(60 * time.Second))
+	if peak != 30 || mean != float64(30+59)/arrivalWindow {
+		t.Errorf("stats = %d, %v", peak, mean)
+	}
+
+	// A minute later the burst has left the window, and stale slots
+	// are not counted.
+	peak, mean = a.stats(base.Add(121 * time.Second))
+	if peak != 0 || mean != 0 {
+		t.Errorf("stats after a minute = %d, %v", peak, mean)
+	}
+	peak, _ = a.stats(base.Add(61 * time.Second))
+	if peak != 1 {
+		t.Errorf("peak without the burst second = %d, want 1", peak)
+	}
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+var (
+	// ErrBaselinesDisabled is returned when no signing key is configured.
+	ErrBaselinesDisabled = errors.New("file baselines disabled")
+	// ErrBaselineNotFound is returned for a workload without a baseline.
+	ErrBaselineNotFound = errors.New("baseline not found")
+	// ErrBaselineExists is returned when an agent offers a baseline for a
+	// workload that already has one.
+	ErrBaselineExists = errors.New("baseline already exists")
+	// ErrInvalidBaseline is returned for a baseline without files, of an
+	// unknown version, or offered by an unregistered agent.
+	ErrInvalidBaseline = errors.New("invalid baseline")
+)
+
+// Sources of a stored baseline.
+const (
+	baselineSourceAgent  = "agent"
+	baselineSourceImport = "import"
+)
+
+func (c *Controller) loadBaselineKey() {
+	if c.cfg.FileBaselineSigningKeyFile == "" {
+		return
+	}
+	data, err := os.ReadFile(c.cfg.FileBaselineSigningKeyFile)
+	if err == nil {
+		c.baselineKey, err = fileintegrity.ParsePrivateKey(data)
+	}
+	if err != nil {
+		c.log.WithError(err).WithField("file", c.cfg.FileBaselineSigningKeyFile).Error("Failed to load file baseline signing key, baselines disabled")
+		return
+	}
+	c.log.Info("File integrity baselines enabled")
+}
+
+// agentWorkload returns the namespace/workload baseline key of agent id.
+func (c *Controller) agentWorkload(id string) (string, bool) {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	agent, ok := c.agents[id]
+	if !ok {
+		return "", false
+	}
+	return podKey(agent.PodNamespace, workloadName(agent.PodName)), true
+}
+
+// AgentBaseline returns the signed baseline of agent id's workload.
+func (c *Controller) AgentBaseline(id string) (*fileintegrity.Baseline, error) {
+	if c.baselineKey == nil {
+		return nil, ErrBaselinesDisabled
+	}
+	key, ok := c.agentWorkload(id)
+	if !ok {
+		return nil, ErrBaselineNotFound
+	}
+	return c.GetBaseline(key)
+}
+
+// OfferBaseline keeps b, the file hashes agent id took at startup, as its
+// workload's baseline if the workload has none. The first replica of a new
+// workload to start captures the baseline the others are compared against.
+func (c *Controller) OfferBaseline(id string, b fileintegrity.Baseline) (*fileintegrity.Baseline, error) {
+	if c.baselineKey == nil {
+		return nil, ErrBaselinesDisabled
+	}
+	key, ok := c.agentWorkload(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: agent %s is not registered", ErrInvalidBaseline, id)
+	}
+	return c.storeBaseline(key, b, baselineSourceAgent, false)
+}
+
+// ImportBaseline replaces the baseline of workload key (namespace/workload)
+// with b, such as one captured at image build with apssctl.
+func (c *Controller) ImportBaseline(key string, b fileintegrity.Baseline) (*fileintegrity.Baseline, error) {
+	if c.baselineKey == nil {
+		return nil, ErrBaselinesDisabled
+	}
+	if ns, name, ok := strings.Cut(key, "/"); !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("%w: key %q is not namespace/workload", ErrInvalidBaseline, key)
+	}
+	return c.storeBaseline(key, b, baselineSourceImport, true)
+}
+
+// storeBaseline signs b as the baseline of workload key. Without replace,
+// an existing baseline is kept and ErrBaselineExists returned.
+func (c *Controller) storeBaseline(key string, b fileintegrity.Baseline, source string, replace bool) (*fileintegrity.Baseline, error) {
+	if b.Version != fileintegrity.BaselineVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrInvalidBaseline, b.Version)
+	}
+	if len(b.Files) == 0 {
+		return nil, fmt.Errorf("%w: no files", ErrInvalidBaseline)
+	}
+	b.Key = key
+	b.Source = source
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now().UTC()
+	}
+	b.Files = append([]fileintegrity.BaselineFile(nil), b.Files...)
+	if err := b.Sign(c.baselineKey); err != nil {
+		return nil, fmt.Errorf("sign baseline: %w", err)
+	}
+
+	c.baselinesMu.Lock()
+	if _, ok := c.baselines[key]; ok && !replace {
+		c.baselinesMu.Unlock()
+		return nil, ErrBaselineExists
+	}
+	c.baselines[key] = &b
+	c.baselinesMu.Unlock()
+
+	c.log.WithFields(logrus.Fields{
+		"workload": key, "source": source, "files": len(b.Files),
+	}).Info("File integrity baseline stored")
+	return &b, nil
+}
+
+// GetBaselines returns the stored baselines ordered by workload.
+func (c *Controller) GetBaselines() []*fileintegrity.Baseline {
+	c.baselinesMu.RLock()
+	out := make([]*fileintegrity.Baseline, 0, len(c.baselines))
+	for _, b := range c.baselines {
+		out = append(out, b)
+	}
+	c.baselinesMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// GetBaseline returns the baseline of workload key.
+func (c *Controller) GetBaseline(key string) (*fileintegrity.Baseline, error) {
+	c.baselinesMu.RLock()
+	defer c.baselinesMu.RUnlock()
+	b, ok := c.baselines[key]
+	if !ok {
+		return nil, ErrBaselineNotFound
+	}
+	return b, nil
+}
+
+// DeleteBaseline removes the baseline of workload key, so the next agent of
+// the workload to start captures a new one.
+func (c *Controller) DeleteBaseline(key string) error {
+	c.baselinesMu.Lock()
+	defer c.baselinesMu.Unlock()
+	if _, ok := c.baselines[key]; !ok {
+		return ErrBaselineNotFound
+	}
+	delete(c.baselines, key)
+	c.log.WithField("workload", key).Info("File integrity baseline deleted")
+	return nil
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+// writeSigningKey writes a new PEM Ed25519 private key to dir and returns
+// its path and public key.
+func writeSigningKey(t *testing.T, dir string) (string, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, pub
+}
+
+func testBaseline(hash string) fileintegrity.Baseline {
+	return fileintegrity.Baseline{
+		Version: fileintegrity.BaselineVersion,
+		Files:   []fileintegrity.BaselineFile{{Path: "/etc/passwd", Hash: hash, Mode: 0o644, Size: 10}},
+	}
+}
+
+func TestController_Baselines(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, pub := writeSigningKey(t, dir)
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, FileBaselineSigningKeyFile: keyFile, StateFile: filepath.Join(dir, "state.json")}
+	c := New(cfg, logrus.New())
+	for _, reg := range []*types.AgentRegistration{
+		{AgentID: "a1", PodName: "api-7d9f8b6c5d-x2k9z", PodNamespace: "shop"},
+		{AgentID: "a2", PodName: "api-7d9f8b6c5d-qw4tz", PodNamespace: "shop"},
+	} {
+		if err := c.RegisterAgent(reg); err != nil {
+			t.Fatalf("RegisterAgent: %v", err)
+		}
+	}
+
+	if _, err := c.AgentBaseline("a1"); !errors.Is(err, ErrBaselineNotFound) {
+		t.Fatalf("AgentBaseline before offer: err = %v", err)
+	}
+	stored, err := c.OfferBaseline("a1", testBaseline("aaa"))
+	if err != nil {
+		t.Fatalf("OfferBaseline: %v", err)
+	}
+	if stored.Key != "shop/api" || stored.Source != "agent" || stored.Verify(pub) != nil {
+		t.Errorf("stored = %+v, verify %v", stored, stored.Verify(pub))
+	}
+	if _, err := c.OfferBaseline("a2", testBaseline("bbb")); !errors.Is(err, ErrBaselineExists) {
+		t.Errorf("second offer: err = %v, want ErrBaselineExists", err)
+	}
+	if b, err := c.AgentBaseline("a2"); err != nil || b.Files[0].Hash != "aaa" {
+		t.Errorf("replica baseline = %+v, %v", b, err)
+	}
+	if _, err := c.OfferBaseline("a1", fileintegrity.Baseline{Version: fileintegrity.BaselineVersion}); !errors.Is(err, ErrInvalidBaseline) {
+		t.Errorf("empty offer: err = %v", err)
+	}
+	if _, err := c.OfferBaseline("unknown", testBaseline("ccc")); !errors.Is(err, ErrInvalidBaseline) {
+		t.Errorf("offer from unknown agent: err = %v", err)
+	}
+
+	imported, err := c.ImportBaseline("shop/api", testBaseline("ddd"))
+	if err != nil || imported.Source != "import" || imported.Files[0].Hash != "ddd" || imported.Verify(pub) != nil {
+		t.Fatalf("ImportBaseline = %+v, %v", imported, err)
+	}
+	if _, err := c.ImportBaseline("shop", testBaseline("ddd")); !errors.Is(err, ErrInvalidBaseline) {
+		t.Errorf("import without workload: err = %v", err)
+	}
+
+	if err := c.SaveState(); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	restored := New(cfg, logrus.New())
+	if b, err := restored.GetBaseline("shop/api"); err != nil || b.Files[0].Hash != "ddd" || b.Verify(pub) != nil {
+		t.Errorf("restored baseline = %+v, %v", b, err)
+	}
+
+	if err := c.DeleteBaseline("shop/api"); err != nil {
+		t.Fatalf("DeleteBaseline: %v", err)
+	}
+	if err := c.DeleteBaseline("shop/api"); !errors.Is(err, ErrBaselineNotFound) {
+		t.Errorf("second delete: err = %v", err)
+	}
+	if len(c.GetBaselines()) != 0 {
+		t.Errorf("baselines left after delete: %d", len(c.GetBaselines()))
+	}
+}
+
+func TestController_BaselinesDisabled(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	if _, err := c.OfferBaseline("a1", testBaseline("aaa")); !errors.Is(err, ErrBaselinesDisabled) {
+		t.Errorf("OfferBaseline: err = %v, want ErrBaselinesDisabled", err)
+	}
+	if _, err := c.ImportBaseline("shop/api", testBaseline("aaa")); !errors.Is(err, ErrBaselinesDisabled) {
+		t.Errorf("ImportBaseline: err = %v, want ErrBaselinesDisabled", err)
+	}
+}
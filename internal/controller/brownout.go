@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	// maxBrownoutFactor bounds how much a brownout stretches scan
+	// intervals, so a typo cannot blind the fleet.
+	maxBrownoutFactor = 20
+	// maxBrownoutTTL bounds how long a brownout lasts without being renewed.
+	maxBrownoutTTL = 24 * time.Hour
+)
+
+var (
+	// ErrNoBrownout is returned when no brownout is in effect.
+	ErrNoBrownout = errors.New("no brownout")
+	// ErrInvalidBrownout is returned for a brownout request with a factor
+	// or TTL out of range.
+	ErrInvalidBrownout = errors.New("invalid brownout")
+)
+
+var brownoutFactor = newGauge(prometheus.GaugeOpts{
+	Name: "apss_brownout_factor",
+	Help: "Scan interval multiplier of the monitoring brownout in effect, 1 when there is none",
+})
+
+func init() {
+	prometheus.MustRegister(brownoutFactor)
+	brownoutFactor.Set(1)
+}
+
+// Brownout returns the brownout in effect. A brownout past its end is
+// ended here, so it reverts even if nobody ends it.
+func (c *Controller) Brownout() (*types.Brownout, error) {
+	c.brownoutMu.Lock()
+	defer c.brownoutMu.Unlock()
+	c.expireBrownoutLocked(time.Now())
+	if c.brownout == nil {
+		return nil, ErrNoBrownout
+	}
+	return c.brownout, nil
+}
+
+// StartBrownout slows the scans of every agent down, replacing any brownout
+// in effect. Agents pick it up on their next poll.
+func (c *Controller) StartBrownout(req types.BrownoutRequest) (*types.Brownout, error) {
+	factor := req.Factor
+	if factor == 0 {
+		factor = c.cfg.BrownoutFactor
+	}
+	if factor < 2 || factor > maxBrownoutFactor {
+		return nil, fmt.Errorf("%w: factor %d is not between 2 and %d", ErrInvalidBrownout, factor, maxBrownoutFactor)
+	}
+	ttl := c.cfg.BrownoutDuration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			return nil, fmt.Errorf("%w: ttl %q", ErrInvalidBrownout, req.TTL)
+		}
+	}
+	if ttl <= 0 || ttl > maxBrownoutTTL {
+		return nil, fmt.Errorf("%w: ttl %v is not between 0 and %v", ErrInvalidBrownout, ttl, maxBrownoutTTL)
+	}
+
+	now := time.Now()
+	b := &types.Brownout{Factor: factor, Reason: req.Reason, StartedAt: now, Until: now.Add(ttl)}
+	c.brownoutMu.Lock()
+	c.brownout = b
+	c.brownoutMu.Unlock()
+	brownoutFactor.Set(float64(factor))
+
+	c.log.WithFields(logrus.Fields{"factor": factor, "until": b.Until, "reason": b.Reason}).Warn("Monitoring brownout started")
+	return b, nil
+}
+
+// EndBrownout restores the agents' scan intervals before the brownout in
+// effect runs out.
+func (c *Controller) EndBrownout() error {
+	c.brownoutMu.Lock()
+	defer c.brownoutMu.Unlock()
+	c.expireBrownoutLocked(time.Now())
+	if c.brownout == nil {
+		return ErrNoBrownout
+	}
+	c.brownout = nil
+	brownoutFactor.Set(1)
+	c.log.Warn("Monitoring brownout ended")
+	return nil
+}
+
+// expireBrownoutLocked ends the brownout if it ran out by now. Caller holds
+// brownoutMu.
+func (c *Controller) expireBrownoutLocked(now time.Time) {
+	if c.brownout == nil || now.Before(c.brownout.Until) {
+		return
+	}
+	c.log.WithField("started_at", c.brownout.StartedAt).Info("Monitoring brownout ran out")
+	c.brownout = nil
+	brownoutFactor.Set(1)
+}
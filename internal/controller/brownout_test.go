@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_BrownoutExpiresAndPersists(t *testing.T) {
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, BrownoutFactor: 4, BrownoutDuration: time.Hour,
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+	c := New(cfg, logrus.New())
+	if _, err := c.Brownout(); !errors.Is(err, ErrNoBrownout) {
+		t.Fatalf("Brownout() err = %v, want ErrNoBrownout", err)
+	}
+	b, err := c.StartBrownout(types.BrownoutRequest{Reason: "incident"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := New(cfg, logrus.New())
+	got, err := restored.Brownout()
+	if err != nil || got.Factor != 4 || !got.Until.Equal(b.Until) {
+		t.Errorf("restored brownout = %+v, %v", got, err)
+	}
+
+	// A brownout past its end reverts on its own.
+	restored.brownoutMu.Lock()
+	restored.brownout.Until = time.Now().Add(-time.Second)
+	restored.brownoutMu.Unlock()
+	if _, err := restored.Brownout(); !errors.Is(err, ErrNoBrownout) {
+		t.Errorf("expired brownout err = %v, want ErrNoBrownout", err)
+	}
+	if err := restored.EndBrownout(); !errors.Is(err, ErrNoBrownout) {
+		t.Errorf("EndBrownout() err = %v, want ErrNoBrownout", err)
+	}
+}
@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// CampaignRuleID identifies alerts raised when one indicator shows up in
+// several workloads within the campaign window.
+const CampaignRuleID = "APSS-014"
+
+// maxCmdlinePattern bounds the normalized command line used as an indicator.
+const maxCmdlinePattern = 256
+
+var (
+	// digitRun is masked in command lines so PIDs, ports and addresses do
+	// not split one pattern into many.
+	digitRun = regexp.MustCompile(`[0-9]+`)
+
+	// Pod name suffixes added by workload controllers. Random suffixes use
+	// the Kubernetes safe alphabet (no vowels, no 0, 1 or 3).
+	deploymentPodSuffix = regexp.MustCompile(`^(.+)-[bcdfghjklmnpqrstvwxz2456789]{6,10}-[bcdfghjklmnpqrstvwxz2456789]{5}$`)
+	generatedPodSuffix  = regexp.MustCompile(`^(.+)-[bcdfghjklmnpqrstvwxz2456789]{5}$`)
+	statefulPodSuffix   = regexp.MustCompile(`^(.+)-[0-9]+$`)
+)
+
+// workloadName guesses the owning workload from a pod name: a Deployment's
+// pods are <name>-<template hash>-<suffix>, DaemonSet and Job pods
+// <name>-<suffix> and StatefulSet pods <name>-<ordinal>. Other pods are
+// their own workload.
+func workloadName(pod string) string {
+	for _, re := range []*regexp.Regexp{deploymentPodSuffix, generatedPodSuffix, statefulPodSuffix} {
+		if m := re.FindStringSubmatch(pod); m != nil {
+			return m[1]
+		}
+	}
+	return pod
+}
+
+// normalizeCmdline turns a command line into a pattern shared by its
+// variants: digits masked, whitespace collapsed, length bounded.
+func normalizeCmdline(cmdline []string) string {
+	s := strings.Join(strings.Fields(strings.Join(cmdline, " ")), " ")
+	s = digitRun.ReplaceAllString(s, "N")
+	if len(s) > maxCmdlinePattern {
+		s = s[:maxCmdlinePattern]
+	}
+	return s
+}
+
+// campaignIndicators returns the indicators of a suspicious event that are
+// tracked across pods. Only high-severity process events and network events
+// to listed or suspicious external destinations count, so the routine
+// activity every pod shares does not add up to a campaign.
+func campaignIndicators(e *types.SecurityEvent) []campaignKey {
+	var keys []campaignKey
+	suspicious := e.Severity == "HIGH" || e.Severity == "CRITICAL"
+	if p := e.Process; p != nil && suspicious {
+		if p.ExeHash != "" {
+			keys = append(keys, campaignKey{types.IndicatorExeHash, p.ExeHash})
+		}
+		if pattern := normalizeCmdline(p.Cmdline); pattern != "" {
+			keys = append(keys, campaignKey{types.IndicatorCmdline, pattern})
+		}
+	}
+	if n := e.Network; n != nil && n.DstIP != "" {
+		if n.MatchedIOC != nil || (suspicious && n.IsExternal) {
+			keys = append(keys, campaignKey{types.IndicatorDstIP, n.DstIP})
+		}
+	}
+	return keys
+}
+
+type campaignKey struct {
+	kind, value string
+}
+
+// campaignSighting is the latest event with an indicator in one pod.
+type campaignSighting struct {
+	pod      types.PodRef
+	workload string
+	at       time.Time
+	eventID  string
+}
+
+// campaignState is one indicator's sightings within the window and the
+// incident raised for it, if any.
+type campaignState struct {
+	pods     map[string]campaignSighting
+	incident *types.Incident
+}
+
+// campaignTracker groups sightings of each indicator by pod. It is used
+// from processEvents; mu guards it against the state saver.
+type campaignTracker struct {
+	mu           sync.Mutex
+	window       time.Duration
+	minWorkloads int
+	states       map[campaignKey]*campaignState
+	lastSweep    time.Time
+}
+
+func newCampaignTracker(window time.Duration, minWorkloads int) *campaignTracker {
+	if minWorkloads < 2 {
+		minWorkloads = 2
+	}
+	return &campaignTracker{
+		window:       window,
+		minWorkloads: minWorkloads,
+		states:       make(map[campaignKey]*campaignState),
+	}
+}
+
+// sweep drops sightings older than the window, and indicators left with
+// none, at most once per window. A campaign whose indicator goes quiet for
+// a whole window is closed; a later sighting starts a new one.
+func (t *campaignTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.window {
+		return
+	}
+	t.lastSweep = now
+	cutoff := now.Add(-t.window)
+	for key, st := range t.states {
+		for pod, s := range st.pods {
+			if !s.at.After(cutoff) {
+				delete(st.pods, pod)
+			}
+		}
+		if len(st.pods) == 0 {
+			delete(t.states, key)
+		}
+	}
+}
+
+// workloads returns the distinct workloads among the sightings as an
+// inventory sorted by namespace and name.
+func (st *campaignState) workloads() []types.Workload {
+	byKey := make(map[string]*types.Workload)
+	for _, s := range st.pods {
+		key := podKey(s.pod.Namespace, s.workload)
+		w, ok := byKey[key]
+		if !ok {
+			w = &types.Workload{Namespace: s.pod.Namespace, Name: s.workload}
+			byKey[key] = w
+		}
+		w.Pods = append(w.Pods, s.pod.Name)
+	}
+	out := make([]types.Workload, 0, len(byKey))
+	for _, w := range byKey {
+		sort.Strings(w.Pods)
+		out = append(out, *w)
+	}
+	sortWorkloads(out)
+	return out
+}
+
+func sortWorkloads(ws []types.Workload) {
+	sort.Slice(ws, func(i, j int) bool {
+		if ws[i].Namespace != ws[j].Namespace {
+			return ws[i].Namespace < ws[j].Namespace
+		}
+		return ws[i].Name < ws[j].Name
+	})
+}
+
+// correlateCampaign records the event's indicators and raises a campaign
+// incident once an indicator has been seen in enough workloads within the
+// window. Pods seen later are added to the open incident's inventory.
+func (c *Controller) correlateCampaign(event *types.SecurityEvent) {
+	t := c.campaigns
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at := eventTime(event)
+	t.sweep(at)
+	pod := types.PodRef{Namespace: event.PodNamespace, Name: event.PodName, Role: types.PodRoleImpacted}
+	key := podKey(pod.Namespace, pod.Name)
+
+	for _, ind := range campaignIndicators(event) {
+		st, ok := t.states[ind]
+		if !ok {
+			st = &campaignState{pods: make(map[string]campaignSighting)}
+			t.states[ind] = st
+		}
+		sighting := campaignSighting{pod: pod, workload: workloadName(pod.Name), at: at, eventID: event.ID}
+		st.pods[key] = sighting
+
+		if st.incident != nil {
+			c.growCampaign(st, sighting)
+		} else if workloads := st.workloads(); len(workloads) >= t.minWorkloads {
+			c.raiseCampaign(ind, st, workloads, pod)
+		}
+	}
+}
+
+// campaignDescription summarizes a campaign's spread.
+func campaignDescription(ind campaignKey, pods int, workloads []types.Workload, window time.Duration) string {
+	namespaces := make(map[string]bool)
+	for _, w := range workloads {
+		namespaces[w.Namespace] = true
+	}
+	return fmt.Sprintf("Indicator %s %q seen in %d pods across %d workloads in %d namespaces within %s",
+		ind.kind, ind.value, pods, len(workloads), len(namespaces), window)
+}
+
+// campaignInventory returns the pods and event IDs of a campaign's
+// sightings in a stable order.
+func campaignInventory(st *campaignState) ([]types.PodRef, []string) {
+	keys := make([]string, 0, len(st.pods))
+	for k := range st.pods {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pods := make([]types.PodRef, 0, len(keys))
+	eventIDs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pods = append(pods, st.pods[k].pod)
+		eventIDs = append(eventIDs, st.pods[k].eventID)
+	}
+	return pods, eventIDs
+}
+
+// raiseCampaign records a campaign incident and its alert. The alert is
+// raised on trigger, the pod whose sighting crossed the threshold.
+func (c *Controller) raiseCampaign(ind campaignKey, st *campaignState, workloads []types.Workload, trigger types.PodRef) {
+	now := time.Now()
+	pods, eventIDs := campaignInventory(st)
+	description := campaignDescription(ind, len(pods), workloads, c.campaigns.window)
+	incident := &types.Incident{
+		ID:            fmt.Sprintf("incident-%d", now.UnixNano()),
+		Type:          types.IncidentTypeCampaign,
+		Timestamp:     now,
+		Severity:      "CRITICAL",
+		RuleID:        CampaignRuleID,
+		Title:         "Cluster-Wide Campaign",
+		Description:   description,
+		Pods:          pods,
+		EventIDs:      eventIDs,
+		MitreTactic:   "Lateral Movement",
+		MitreID:       "T1080",
+		IndicatorType: ind.kind,
+		Indicator:     ind.value,
+		Workloads:     workloads,
+	}
+	alert := &types.Alert{
+		ID:          fmt.Sprintf("alert-%d", now.UnixNano()),
+		Timestamp:   now,
+		Severity:    incident.Severity,
+		RuleID:      CampaignRuleID,
+		RuleName:    incident.Title,
+		Description: description,
+		EventIDs:    eventIDs,
+		PodName:     trigger.Name,
+		PodNS:       trigger.Namespace,
+		MitreTactic: incident.MitreTactic,
+		MitreID:     incident.MitreID,
+		Actions: []string{
+			"Review the incident's workload inventory for every impacted pod",
+			"Check whether the workloads share a base image and rebuild it if compromised",
+			"Block the indicator with a NetworkPolicy or admission policy",
+		},
+		Status:     types.AlertStatusOpen,
+		IncidentID: incident.ID,
+	}
+	incident.AlertIDs = []string{alert.ID}
+	st.incident = incident
+
+	c.recordIncident(incident)
+	c.raiseAlert(alert)
+	c.log.WithFields(logrus.Fields{
+		"incident_id": incident.ID, "indicator_type": ind.kind, "indicator": ind.value,
+		"workloads": len(workloads), "pods": len(pods),
+	}).Warn("Cluster-wide campaign detected")
+}
+
+// growCampaign adds a newly impacted pod to an open campaign's incident.
+// The retained incident is replaced with an updated copy, as API readers
+// may hold the previous one.
+func (c *Controller) growCampaign(st *campaignState, s campaignSighting) {
+	for _, p := range st.incident.Pods {
+		if p == s.pod {
+			return
+		}
+	}
+	updated := *st.incident
+	updated.Pods = append(append([]types.PodRef(nil), updated.Pods...), s.pod)
+	updated.EventIDs = append(append([]string(nil), updated.EventIDs...), s.eventID)
+	updated.Workloads = make([]types.Workload, 0, len(st.incident.Workloads)+1)
+	added := false
+	for _, w := range st.incident.Workloads {
+		w.Pods = append([]string(nil), w.Pods...)
+		if w.Namespace == s.pod.Namespace && w.Name == s.workload {
+			w.Pods = append(w.Pods, s.pod.Name)
+			sort.Strings(w.Pods)
+			added = true
+		}
+		updated.Workloads = append(updated.Workloads, w)
+	}
+	if !added {
+		updated.Workloads = append(updated.Workloads, types.Workload{Namespace: s.pod.Namespace, Name: s.workload, Pods: []string{s.pod.Name}})
+		sortWorkloads(updated.Workloads)
+	}
+	updated.Description = campaignDescription(
+		campaignKey{updated.IndicatorType, updated.Indicator}, len(updated.Pods), updated.Workloads, c.campaigns.window)
+	st.incident = &updated
+	c.replaceIncident(&updated)
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestWorkloadName(t *testing.T) {
+	tests := []struct{ pod, want string }{
+		{"api-7d9c5b6f8d-x2k4z", "api"},
+		{"node-exporter-tw9b5", "node-exporter"},
+		{"postgres-0", "postgres"},
+		{"standalone", "standalone"},
+		{"api-v2-5f6d7c8b9-qxz7p", "api-v2"},
+	}
+	for _, tt := range tests {
+		if got := workloadName(tt.pod); got != tt.want {
+			t.Errorf("workloadName(%q) = %q, want %q", tt.pod, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCmdline(t *testing.T) {
+	got := normalizeCmdline([]string{"xmrig", "-o", "10.0.0.7:3333", "--threads", " 4"})
+	if want := "xmrig -o N.N.N.N:N --threads N"; got != want {
+		t.Errorf("normalizeCmdline = %q, want %q", got, want)
+	}
+}
+
+func minerEvent(id, ns, pod string, at time.Time) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: id, Type: "process_start", Severity: "CRITICAL", Timestamp: at, PodName: pod, PodNamespace: ns,
+		Process: &types.ProcessEventData{
+			Name: "kworker", ExeHash: "abc123", Cmdline: []string{"/tmp/kworker"},
+			SuspiciousIndicators: []string{"possible_cryptominer"},
+		},
+	}
+}
+
+func TestController_Campaign(t *testing.T) {
+	c := New(config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, CampaignWindow: time.Minute, CampaignMinWorkloads: 3,
+	}, logrus.New())
+	now := time.Now()
+
+	// Replicas of one Deployment count as a single workload.
+	c.correlateCampaign(minerEvent("e1", "shop", "web-7d9c5b6f8d-x2k4z", now))
+	c.correlateCampaign(minerEvent("e2", "shop", "web-7d9c5b6f8d-bq7wm", now))
+	c.correlateCampaign(minerEvent("e3", "shop", "cart-5f6d7c8b9-qxz7p", now))
+	if n := len(c.GetIncidents(types.IncidentTypeCampaign)); n != 0 {
+		t.Fatalf("incidents after 2 workloads = %d, want 0", n)
+	}
+
+	c.correlateCampaign(minerEvent("e4", "data", "postgres-0", now.Add(10*time.Second)))
+	incidents := c.GetIncidents(types.IncidentTypeCampaign)
+	// The exe hash and the command line are tracked separately.
+	if len(incidents) != 2 {
+		t.Fatalf("incidents = %d, want 2", len(incidents))
+	}
+	var inc *types.Incident
+	for _, i := range incidents {
+		if i.IndicatorType == types.IndicatorExeHash {
+			inc = i
+		}
+	}
+	if inc == nil || inc.Indicator != "abc123" || inc.RuleID != CampaignRuleID || len(inc.Pods) != 4 {
+		t.Fatalf("exe hash incident = %+v", inc)
+	}
+	want := []types.Workload{
+		{Namespace: "data", Name: "postgres", Pods: []string{"postgres-0"}},
+		{Namespace: "shop", Name: "cart", Pods: []string{"cart-5f6d7c8b9-qxz7p"}},
+		{Namespace: "shop", Name: "web", Pods: []string{"web-7d9c5b6f8d-bq7wm", "web-7d9c5b6f8d-x2k4z"}},
+	}
+	if fmt.Sprint(inc.Workloads) != fmt.Sprint(want) {
+		t.Errorf("workloads = %+v, want %+v", inc.Workloads, want)
+	}
+	if len(c.alertChan) != 2 {
+		t.Fatalf("alerts = %d, want 2", len(c.alertChan))
+	}
+	alert := <-c.alertChan
+	if alert.RuleID != CampaignRuleID || alert.IncidentID == "" || alert.PodName != "postgres-0" {
+		t.Errorf("alert = %+v", alert)
+	}
+	<-c.alertChan
+
+	// A later pod joins the open incident instead of raising a new one, and
+	// a repeat sighting does not add it twice.
+	c.correlateCampaign(minerEvent("e5", "batch", "report-28374651-kx9wz", now.Add(20*time.Second)))
+	c.correlateCampaign(minerEvent("e6", "batch", "report-28374651-kx9wz", now.Add(25*time.Second)))
+	if len(c.alertChan) != 0 {
+		t.Errorf("alerts after growth = %d, want 0", len(c.alertChan))
+	}
+	grown, err := c.GetIncident(inc.ID)
+	if err != nil || len(grown.Pods) != 5 || len(grown.Workloads) != 4 || len(inc.Pods) != 4 {
+		t.Errorf("grown incident = %+v (%v), original pods = %d", grown, err, len(inc.Pods))
+	}
+}
+
+func TestController_Campaign_Ignored(t *testing.T) {
+	c := New(config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, CampaignWindow: time.Minute, CampaignMinWorkloads: 2,
+	}, logrus.New())
+	now := time.Now()
+
+	// Low-severity activity is shared by many workloads and never counts.
+	for i, pod := range []string{"a", "b", "c"} {
+		ev := minerEvent(fmt.Sprint(i), "ns", pod, now)
+		ev.Severity = "MEDIUM"
+		c.correlateCampaign(ev)
+	}
+	// Sightings further apart than the window do not add up.
+	c.correlateCampaign(minerEvent("e1", "ns", "d", now))
+	c.correlateCampaign(minerEvent("e2", "ns", "e", now.Add(3*time.Minute)))
+	if n := len(c.GetIncidents("")); n != 0 {
+		t.Errorf("incidents = %d, want 0", n)
+	}
+
+	disabled := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	disabled.correlateCampaign(minerEvent("e1", "ns", "a", now))
+	if disabled.campaigns != nil {
+		t.Error("campaign tracker created with a zero window")
+	}
+}
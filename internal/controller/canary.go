@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	// CanaryRuleID identifies the synthetic test alerts sent to every sink.
+	CanaryRuleID = "APSS-CANARY"
+	// SinkFailureRuleID identifies alerts raised when a sink fails to
+	// deliver a canary.
+	SinkFailureRuleID = "APSS-032"
+	// sweetSecuritySink names Sweet Security among canary results, next to
+	// the notify sinks.
+	sweetSecuritySink = "sweetsecurity"
+	// canarySendTimeout bounds the Sweet Security canary, including retries.
+	canarySendTimeout = 30 * time.Second
+)
+
+var (
+	canaryDeliveries = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_canary_deliveries_total",
+			Help: "Canary alert deliveries by sink and result (sent, failed)",
+		},
+		[]string{"sink", "result"},
+	)
+	canaryLastSuccess = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_canary_last_success_timestamp_seconds",
+			Help: "Unix time of the last canary alert each sink delivered",
+		},
+		[]string{"sink"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(canaryDeliveries, canaryLastSuccess)
+}
+
+// runCanary sends a canary alert every CanaryInterval until ctx is done.
+func (c *Controller) runCanary(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.CanaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.sendCanary(ctx)
+		}
+	}
+}
+
+// sendCanary sends one test alert straight to every notify sink and to
+// Sweet Security, whatever their severity routes, and returns each sink's
+// error by name. The canary is not stored or exported. A sink that starts
+// failing raises a SinkFailureRuleID alert, which goes to the other sinks.
+func (c *Controller) sendCanary(ctx context.Context) map[string]error {
+	now := time.Now()
+	alert := &types.Alert{
+		ID:          fmt.Sprintf("canary-%d", now.UnixNano()),
+		Timestamp:   now,
+		Severity:    "INFO",
+		RuleID:      CanaryRuleID,
+		RuleName:    "Alert Pipeline Canary",
+		Description: "Synthetic test alert checking that this sink delivers APSS alerts. No action needed.",
+		EventIDs:    []string{},
+		Status:      types.AlertStatusOpen,
+		Test:        true,
+	}
+	results := make(map[string]error)
+	if c.notifier != nil {
+		results = c.notifier.SendAll(ctx, alert)
+	}
+	if client := c.SweetSecurity(); client != nil {
+		sendCtx, cancel := context.WithTimeout(ctx, canarySendTimeout)
+		results[sweetSecuritySink] = client.SendAlert(sendCtx, c.newSweetAlert(alert))
+		cancel()
+	}
+
+	sinks := make([]string, 0, len(results))
+	for sink := range results {
+		sinks = append(sinks, sink)
+	}
+	sort.Strings(sinks)
+	for _, sink := range sinks {
+		err := results[sink]
+		if err == nil {
+			canaryDeliveries.WithLabelValues(sink, "sent").Inc()
+			canaryLastSuccess.WithLabelValues(sink).Set(float64(now.Unix()))
+			if c.canaryFailing[sink] {
+				delete(c.canaryFailing, sink)
+				c.log.WithField("sink", sink).Info("Alert sink delivering canaries again")
+			}
+			continue
+		}
+		canaryDeliveries.WithLabelValues(sink, "failed").Inc()
+		c.log.WithError(err).WithField("sink", sink).Error("Alert sink failed to deliver canary")
+		if c.canaryFailing[sink] {
+			continue
+		}
+		c.canaryFailing[sink] = true
+		c.raiseAlert(&types.Alert{
+			ID:          fmt.Sprintf("alert-%d", time.Now().UnixNano()),
+			Timestamp:   now,
+			Severity:    "HIGH",
+			RuleID:      SinkFailureRuleID,
+			RuleName:    "Alert Sink Delivery Failure",
+			Description: fmt.Sprintf("Alert sink %s failed to deliver a canary alert: %v", sink, err),
+			EventIDs:    []string{},
+			MitreTactic: "Defense Evasion",
+			MitreID:     "T1562.006",
+			Actions:     []string{"Check the sink's credentials (webhook URL, routing key or API key) and that they have not expired or been revoked", "Check the controller can reach the sink through its egress proxy", "Look for alerts raised since the sink's last successful canary (apss_canary_last_success_timestamp_seconds)"},
+			Status:      types.AlertStatusOpen,
+		})
+	}
+	return results
+}
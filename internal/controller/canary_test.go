@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/notify"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+type canarySink struct {
+	name string
+	err  error
+	got  []*types.Alert
+}
+
+func (s *canarySink) Name() string { return s.name }
+
+func (s *canarySink) Send(ctx context.Context, alert *types.Alert) error {
+	s.got = append(s.got, alert)
+	return s.err
+}
+
+func TestController_sendCanary(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	slack := &canarySink{name: "slack"}
+	pager := &canarySink{name: "pagerduty", err: errors.New("status 400")}
+	c.notifier = notify.NewRouter(c.log)
+	c.notifier.AddRoute(slack, []string{"HIGH", "CRITICAL"})
+	c.notifier.AddRoute(pager, []string{"CRITICAL"})
+
+	results := c.sendCanary(context.Background())
+	if len(results) != 2 || results["slack"] != nil || results["pagerduty"] == nil {
+		t.Fatalf("results = %v", results)
+	}
+	if len(slack.got) != 1 || !slack.got[0].Test || slack.got[0].RuleID != CanaryRuleID {
+		t.Errorf("slack got %+v", slack.got)
+	}
+	// The canary is delivered directly, not stored as an alert.
+	if _, total := c.GetAlerts(types.AlertFilter{}); total != 0 {
+		t.Errorf("canary stored: %d alerts", total)
+	}
+
+	// One failure alert per sink until it recovers.
+	alertFor := func() *types.Alert {
+		select {
+		case a := <-c.alertChan:
+			return a
+		default:
+			return nil
+		}
+	}
+	if a := alertFor(); a == nil || a.RuleID != SinkFailureRuleID || a.Severity != "HIGH" || a.Test {
+		t.Fatalf("failure alert = %+v", a)
+	}
+	c.sendCanary(context.Background())
+	if a := alertFor(); a != nil {
+		t.Errorf("repeat failure raised %+v", a)
+	}
+	pager.err = nil
+	c.sendCanary(context.Background())
+	if c.canaryFailing["pagerduty"] {
+		t.Error("pagerduty still failing after a delivery")
+	}
+	pager.err = errors.New("status 400")
+	c.sendCanary(context.Background())
+	if a := alertFor(); a == nil || a.RuleID != SinkFailureRuleID {
+		t.Errorf("failure after recovery: %+v", a)
+	}
+}
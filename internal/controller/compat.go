@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+var (
+	legacyEventsConverted = newCounter(
+		prometheus.CounterOpts{
+			Name: "apss_legacy_events_converted_total",
+			Help: "Total events from legacy v1 agents converted to the current schema",
+		},
+	)
+	eventSchemaMismatch = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_event_schema_mismatch_total",
+			Help: "Total events carrying fields this controller does not know, by sender schema version",
+		},
+		[]string{"schema_version"},
+	)
+	agentsBySchemaVersion = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_agents_by_schema_version",
+			Help: "Number of active agents by payload schema version",
+		},
+		[]string{"version"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(legacyEventsConverted)
+	prometheus.MustRegister(eventSchemaMismatch)
+	prometheus.MustRegister(agentsBySchemaVersion)
+}
+
+// maxLoggedUnknownFields bounds the set of unknown field paths already logged,
+// so a misbehaving agent cannot grow it without limit.
+const maxLoggedUnknownFields = 256
+
+// noteUnknownFields counts events carrying fields this controller does not
+// know and logs each new field path once. The fields themselves stay on the
+// event and are written back out on export and forwarding.
+func (c *Controller) noteUnknownFields(event *types.SecurityEvent, schema string) {
+	fields := event.UnknownFields()
+	if len(fields) == 0 {
+		return
+	}
+	eventSchemaMismatch.WithLabelValues(schema).Inc()
+
+	var fresh []string
+	c.unknownFieldsMu.Lock()
+	for path := range fields {
+		if c.unknownFields[path] || len(c.unknownFields) >= maxLoggedUnknownFields {
+			continue
+		}
+		c.unknownFields[path] = true
+		fresh = append(fresh, path)
+	}
+	c.unknownFieldsMu.Unlock()
+	if len(fresh) == 0 {
+		return
+	}
+	sort.Strings(fresh)
+	c.log.WithFields(logrus.Fields{
+		"agent_id":       event.AgentID,
+		"schema_version": schema,
+		"fields":         fresh,
+	}).Warn("Event has fields unknown to this controller; preserving them as-is")
+}
+
+// upgradeEvent detects the schema version an event was sent with and converts
+// legacy payloads in place to the current schema. It returns the detected
+// sender version so it can be recorded against the agent.
+func upgradeEvent(event *types.SecurityEvent) string {
+	sent := event.SchemaVersion
+	if sent == "" {
+		sent = types.SchemaVersionV1
+	}
+	if sent != types.SchemaVersionV1 {
+		return sent
+	}
+
+	// v1 agents predate the schema_version field and never send process
+	// exe/uid or network source addresses; those stay unset. Severity casing
+	// was not enforced by v1 collectors.
+	event.SchemaVersion = types.CurrentSchemaVersion
+	event.Severity = strings.ToUpper(event.Severity)
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.Metadata == nil {
+		event.Metadata = make(map[string]interface{})
+	}
+	event.Metadata["converted_from"] = types.SchemaVersionV1
+	legacyEventsConverted.Inc()
+	return sent
+}
+
+// SchemaMigration reports the schema versions in use across active agents.
+func (c *Controller) SchemaMigration() types.SchemaMigration {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	m := types.SchemaMigration{
+		TotalAgents:   len(c.agents),
+		ByVersion:     make(map[string]int),
+		LegacyAgents:  []string{},
+		TargetVersion: types.CurrentSchemaVersion,
+	}
+	for id, a := range c.agents {
+		m.ByVersion[a.SchemaVersion]++
+		if a.SchemaVersion == types.SchemaVersionV1 {
+			m.LegacyAgents = append(m.LegacyAgents, id)
+		}
+	}
+	sort.Strings(m.LegacyAgents)
+	if m.TotalAgents > 0 {
+		m.PercentMigrated = float64(m.ByVersion[types.CurrentSchemaVersion]) * 100 / float64(m.TotalAgents)
+	}
+	return m
+}
+
+// updateSchemaGauge refreshes apss_agents_by_schema_version. Caller must hold agentsMu.
+func (c *Controller) updateSchemaGauge() {
+	counts := make(map[string]int)
+	for _, a := range c.agents {
+		counts[a.SchemaVersion]++
+	}
+	agentsBySchemaVersion.Reset()
+	for v, n := range counts {
+		agentsBySchemaVersion.WithLabelValues(v).Set(float64(n))
+	}
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestUpgradeEvent_Legacy(t *testing.T) {
+	ev := &types.SecurityEvent{ID: "ev-1", Severity: "high"}
+	if got := upgradeEvent(ev); got != types.SchemaVersionV1 {
+		t.Errorf("detected version = %q, want v1", got)
+	}
+	if ev.SchemaVersion != types.CurrentSchemaVersion {
+		t.Errorf("SchemaVersion = %q, want %q", ev.SchemaVersion, types.CurrentSchemaVersion)
+	}
+	if ev.Severity != "HIGH" {
+		t.Errorf("Severity = %q, want HIGH", ev.Severity)
+	}
+	if ev.Timestamp.IsZero() {
+		t.Error("Timestamp should be filled for legacy events without one")
+	}
+	if ev.Metadata["converted_from"] != types.SchemaVersionV1 {
+		t.Errorf("Metadata converted_from = %v", ev.Metadata["converted_from"])
+	}
+}
+
+func TestUpgradeEvent_Current(t *testing.T) {
+	ev := &types.SecurityEvent{SchemaVersion: types.SchemaVersionV2, Severity: "HIGH"}
+	if got := upgradeEvent(ev); got != types.SchemaVersionV2 {
+		t.Errorf("detected version = %q, want v2", got)
+	}
+	if ev.Metadata != nil {
+		t.Error("current-schema events should not be modified")
+	}
+}
+
+func TestController_SchemaMigration(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	ctx := context.Background()
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "1", AgentID: "old-agent"})
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "2", AgentID: "new-agent", SchemaVersion: types.SchemaVersionV2})
+
+	m := c.SchemaMigration()
+	if m.TotalAgents != 2 || m.ByVersion[types.SchemaVersionV1] != 1 || m.ByVersion[types.SchemaVersionV2] != 1 {
+		t.Errorf("migration counts: %+v", m)
+	}
+	if m.PercentMigrated != 50 {
+		t.Errorf("PercentMigrated = %v, want 50", m.PercentMigrated)
+	}
+	if len(m.LegacyAgents) != 1 || m.LegacyAgents[0] != "old-agent" {
+		t.Errorf("LegacyAgents = %v", m.LegacyAgents)
+	}
+
+	// The old agent upgrades: its next event carries the new schema.
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "3", AgentID: "old-agent", SchemaVersion: types.SchemaVersionV2})
+	if m := c.SchemaMigration(); m.PercentMigrated != 100 {
+		t.Errorf("after upgrade PercentMigrated = %v, want 100", m.PercentMigrated)
+	}
+}
+
+func TestController_UnknownFields(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	var ev types.SecurityEvent
+	body := `{"schema_version":"v3","id":"ev-1","agent_id":"a","type":"process_start","severity":"HIGH",
+		"trace_id":"abc","process":{"pid":7,"name":"sh","cmdline":["sh"],"container_id":"c1"}}`
+	if err := json.Unmarshal([]byte(body), &ev); err != nil {
+		t.Fatal(err)
+	}
+	before := testutil.ToFloat64(eventSchemaMismatch.WithLabelValues("v3"))
+	if err := c.IngestEvent(context.Background(), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(eventSchemaMismatch.WithLabelValues("v3")) - before; got != 1 {
+		t.Errorf("schema mismatch count = %v, want 1", got)
+	}
+	if !c.unknownFields["trace_id"] || !c.unknownFields["process.container_id"] {
+		t.Errorf("logged unknown fields = %v", c.unknownFields)
+	}
+
+	// Known-only events are not counted.
+	_ = c.IngestEvent(context.Background(), &types.SecurityEvent{ID: "ev-2", AgentID: "a", SchemaVersion: "v3"})
+	if got := testutil.ToFloat64(eventSchemaMismatch.WithLabelValues("v3")) - before; got != 1 {
+		t.Errorf("schema mismatch count = %v, want 1", got)
+	}
+}
@@ -4,7 +4,11 @@ package controller
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
+	"net/http"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,27 +17,38 @@ import (
 
 	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/detection"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/notify"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/search"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/storage"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/threatintel"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/elasticsearch"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/otlp"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/splunk"
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/sweetsecurity"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/syslog"
 )
 
 // Prometheus metrics (registered once).
 var (
-	eventsReceived = prometheus.NewCounterVec(
+	eventsReceived = newCounterVec(
 		prometheus.CounterOpts{
 			Name: "apss_events_received_total",
 			Help: "Total security events received",
 		},
 		[]string{"type", "severity", "namespace"},
 	)
-	alertsGenerated = prometheus.NewCounterVec(
+	alertsGenerated = newCounterVec(
 		prometheus.CounterOpts{
 			Name: "apss_alerts_generated_total",
 			Help: "Total security alerts generated",
 		},
 		[]string{"rule", "severity"},
 	)
-	activeAgents = prometheus.NewGauge(
+	activeAgents = newGauge(
 		prometheus.GaugeOpts{
 			Name: "apss_active_agents",
 			Help: "Number of active APSS agents",
@@ -52,16 +67,117 @@ type Controller struct {
 	cfg      config.ControllerConfig
 	log      *logrus.Logger
 	engine   *detection.Engine
+	intel    *threatintel.Store
+	notifier *notify.Router
 	agents   map[string]*types.AgentInfo
 	agentsMu sync.RWMutex
+	// podIPs maps pod IPs reported by agents to agent IDs for cross-pod
+	// correlation; guarded by agentsMu.
+	podIPs   map[string]string
 	alerts   []*types.Alert
 	alertsMu sync.RWMutex
+	// alertsDropped and eventsDropped count records trimmed by retention;
+	// a record's export cursor is its index plus the dropped count.
+	alertsDropped int64
+	events        []*types.SecurityEvent
+	eventsDropped int64
+	eventsMu      sync.RWMutex
+	// searchIndex indexes the retained events by cursor; guarded by
+	// eventsMu.
+	searchIndex *search.Index
 
 	eventBuffer chan *types.SecurityEvent
 	alertChan   chan *types.Alert
+	alertHub    *alertHub
+	ruleStats   *ruleStats
+	// ruleTimings is set once the rules are loaded, before events flow.
+	ruleTimings *ruleTimings
+	lateral     *lateralTracker
+	campaigns   *campaignTracker
+	summarizer  *eventSummarizer
+	graph       *entityGraph
+	triage      *triageTracker
+
+	// kube reads pod lifecycle for timelines; nil outside a cluster.
+	kube *kube.Client
+	// podMeta caches pod owners and labels for alerts; nil when off or
+	// outside a cluster.
+	podMeta *podMetadata
+
+	// playbooks are attached to alerts by rule ID, replacing any playbook
+	// the rule defines itself.
+	playbooks map[string]*types.Playbook
+	// yara is the YARA rule bundle agents pull, loaded at startup.
+	yara *yaraBundle
+	// arrivals measures how bursty events, heartbeats and registrations are.
+	arrivals ingestRates
+	// sweetMappings reshape alerts sent to Sweet Security by rule ID.
+	sweetMappings *sweetsecurity.AlertMappings
+
+	incidents   []*types.Incident
+	incidentsMu sync.RWMutex
+
+	// suppressions drop matching alerts before they are retained or sent.
+	// They are replaced rather than changed, like alerts.
+	suppressions   []*types.Suppression
+	suppressionsMu sync.Mutex
+
+	// baselines are the signed file integrity baselines, keyed by
+	// namespace/workload, that agents compare their files against at
+	// startup. They are replaced rather than changed. baselineKey signs
+	// them; nil disables baselines.
+	baselines   map[string]*fileintegrity.Baseline
+	baselinesMu sync.RWMutex
+	baselineKey ed25519.PrivateKey
+
+	// iocs are extracted from CRITICAL alerts, keyed by type and value.
+	iocs   map[string]*types.IOC
+	iocsMu sync.Mutex
+
+	// unknownFields records the unknown event field paths already logged.
+	unknownFields   map[string]bool
+	unknownFieldsMu sync.Mutex
+
+	agentConfig   *types.AgentRuntimeConfig
+	agentConfigMu sync.RWMutex
+
+	// brownout slows agent scans down fleet-wide until it runs out; nil
+	// when there is none.
+	brownout   *types.Brownout
+	brownoutMu sync.Mutex
+
+	// fedEdge reports to a central controller and fedHub receives edge
+	// reports; each is nil when that side of federation is off.
+	fedEdge *federationEdge
+	fedHub  *federationHub
+	// leader is nil unless replicas elect a leader.
+	leader *leaderElector
+	// shards is nil unless replicas shard agents between them.
+	shards *shardRouter
+	// eventLimiter applies AgentEventRate; nil when it is off.
+	eventLimiter *rateLimiter
+	// interner shares the strings retained alerts repeat between them.
+	interner *alertInterner
+	// store persists records written through storeQueue; nil without a
+	// storage backend.
+	store      storage.Storage
+	storeQueue chan storageOp
+
+	// stateMu serializes SaveState between the saver and shutdown.
+	stateMu sync.Mutex
 
 	sweetSecurity   *sweetsecurity.Client
+	sweetQueue      *sweetsecurity.Queue
 	sweetSecurityMu sync.RWMutex
+
+	splunk  *splunk.Client
+	elastic *elasticsearch.Indexer
+	otlp    *otlp.Exporter
+	syslog  *syslog.Exporter
+
+	// canaryFailing holds the sinks whose last canary failed; only the
+	// canary loop uses it.
+	canaryFailing map[string]bool
 }
 
 // New creates a new Controller with the given config and logger.
@@ -71,24 +187,297 @@ func New(cfg config.ControllerConfig, log *logrus.Logger) *Controller {
 		log:         log,
 		engine:      detection.NewEngine(),
 		agents:      make(map[string]*types.AgentInfo),
+		podIPs:      make(map[string]string),
 		eventBuffer: make(chan *types.SecurityEvent, cfg.EventBufferSize),
 		alertChan:   make(chan *types.Alert, cfg.AlertBufferSize),
+		alertHub:    newAlertHub(),
+		ruleStats:   newRuleStats(),
+		arrivals:    newIngestRates(),
+		searchIndex: search.New(),
+
+		eventLimiter: newRateLimiter(cfg.AgentEventRate, cfg.AgentEventBurst),
+		interner:     newAlertInterner(),
+
+		unknownFields: make(map[string]bool),
+		iocs:          make(map[string]*types.IOC),
+		baselines:     make(map[string]*fileintegrity.Baseline),
+		canaryFailing: make(map[string]bool),
+	}
+	if cfg.LateralMovementWindow > 0 {
+		c.lateral = newLateralTracker(cfg.LateralMovementWindow)
+	}
+	if cfg.CampaignWindow > 0 {
+		c.campaigns = newCampaignTracker(cfg.CampaignWindow, cfg.CampaignMinWorkloads)
+	}
+	if cfg.EventSummaryWindow > 0 {
+		c.summarizer = newEventSummarizer(cfg.EventSummaryWindow)
 	}
+	if cfg.GraphRetention > 0 {
+		c.graph = newEntityGraph(cfg.GraphRetention, cfg.GraphMaxNodes)
+	}
+	if cfg.TriageWindow > 0 {
+		c.triage = newTriageTracker(cfg.TriageWindow)
+	}
+	c.loadSigmaRules()
+	c.loadShadowRules()
+	c.initRuleTimings()
+	c.loadPlaybooks()
+	c.loadYaraRules()
+	c.loadBaselineKey()
+	c.loadSweetMappings()
+	c.initThreatIntel()
+	c.initNotify()
 	c.initSweetSecurity()
+	c.initSplunk()
+	c.initElasticsearch()
+	c.initOTLP()
+	c.initSyslog()
+	c.initFederation()
+	c.initKube()
+	c.initKubeMetadata()
+	c.initStorage()
+	c.initSharding()
+	c.initLeaderElection()
+	if c.leader == nil {
+		c.restoreState()
+		c.loadStorage()
+	}
 	return c
 }
 
+// initThreatIntel sets up blocklist matching when any feed is configured or
+// IOC extraction is on. Feeds are first downloaded when Start runs.
+func (c *Controller) initThreatIntel() {
+	var feeds []threatintel.Feed
+	for _, u := range c.cfg.ThreatIntelIPFeeds {
+		feeds = append(feeds, threatintel.Feed{URL: u, Type: types.IOCTypeIP})
+	}
+	for _, u := range c.cfg.ThreatIntelDomainFeeds {
+		feeds = append(feeds, threatintel.Feed{URL: u, Type: types.IOCTypeDomain})
+	}
+	for _, u := range c.cfg.ThreatIntelTorFeeds {
+		feeds = append(feeds, threatintel.Feed{URL: u, Type: types.IOCTypeIP, Category: types.IOCCategoryTor})
+	}
+	if len(feeds) == 0 && !c.cfg.IOCExtraction {
+		return
+	}
+	refresh := c.cfg.ThreatIntelRefresh
+	if refresh <= 0 {
+		refresh = time.Hour
+	}
+	c.intel = threatintel.New(feeds, refresh, c.log)
+}
+
+// loadSigmaRules adds the Sigma rules from cfg.SigmaRulesDir to the engine.
+// Rules that fail to convert are logged and skipped.
+func (c *Controller) loadSigmaRules() {
+	if c.cfg.SigmaRulesDir == "" {
+		return
+	}
+	rules, err := detection.LoadSigmaDir(c.cfg.SigmaRulesDir)
+	if err != nil {
+		c.log.WithError(err).Warn("Some Sigma rules could not be loaded")
+	}
+	c.engine.AddRules(rules...)
+	c.log.WithField("rules", len(rules)).Info("Loaded Sigma rules")
+}
+
+func (c *Controller) loadPlaybooks() {
+	if c.cfg.PlaybooksFile == "" {
+		return
+	}
+	playbooks, err := detection.LoadPlaybooks(c.cfg.PlaybooksFile)
+	if err != nil {
+		c.log.WithError(err).WithField("file", c.cfg.PlaybooksFile).Error("Failed to load playbooks")
+		return
+	}
+	c.playbooks = playbooks
+	c.log.WithField("playbooks", len(playbooks)).Info("Loaded playbooks")
+}
+
+func (c *Controller) loadSweetMappings() {
+	if c.cfg.SweetSecurityMappingsFile == "" {
+		return
+	}
+	mappings, err := sweetsecurity.LoadAlertMappings(c.cfg.SweetSecurityMappingsFile)
+	if err != nil {
+		c.log.WithError(err).WithField("file", c.cfg.SweetSecurityMappingsFile).Error("Failed to load Sweet Security alert mappings")
+		return
+	}
+	c.sweetMappings = mappings
+	c.log.WithField("rules", len(mappings.Rules)).Info("Loaded Sweet Security alert mappings")
+}
+
+// initNotify routes alerts to Slack, PagerDuty and generic webhooks when
+// they are configured.
+func (c *Controller) initNotify() {
+	router := notify.NewRouter(c.log)
+	if c.cfg.SlackWebhookURL != "" {
+		if t, ok := c.egressTransport("slack", c.cfg.SlackEgress); ok {
+			c.addRoute(router, notify.NewSlack(c.cfg.SlackWebhookURL, c.cfg.SlackChannel, t), c.cfg.SlackSeverities, c.cfg.SlackDigest)
+		}
+	}
+	if c.cfg.PagerDutyRoutingKey != "" {
+		if t, ok := c.egressTransport("pagerduty", c.cfg.PagerDutyEgress); ok {
+			c.addRoute(router, notify.NewPagerDuty(c.cfg.PagerDutyRoutingKey, t), c.cfg.PagerDutySeverities, c.cfg.PagerDutyDigest)
+		}
+	}
+	if c.cfg.WebhookSinksFile != "" {
+		c.addWebhookRoutes(router)
+	}
+	if c.cfg.PubSubTopic != "" || c.cfg.CloudLoggingEnabled {
+		c.addGCPRoutes(router)
+	}
+	if !router.Empty() {
+		c.notifier = router
+	}
+}
+
+// addWebhookRoutes adds the sinks in cfg.WebhookSinksFile to router. Invalid
+// sinks are logged and skipped so one bad template does not disable the rest.
+func (c *Controller) addWebhookRoutes(router *notify.Router) {
+	configs, err := notify.LoadWebhooks(c.cfg.WebhookSinksFile)
+	if err != nil {
+		c.log.WithError(err).WithField("file", c.cfg.WebhookSinksFile).Error("Failed to load webhook sinks")
+		return
+	}
+	for _, cfg := range configs {
+		warnInsecureEgress(c.log, cfg.Name, cfg.Egress)
+		sink, err := notify.NewWebhook(cfg)
+		if err != nil {
+			c.log.WithError(err).Error("Skipping webhook sink")
+			continue
+		}
+		if digest, ok := sink.Digest(); ok {
+			if digest.Template == "" {
+				digest.Template = c.digestTemplate()
+			}
+			if err := router.AddDigestRoute(sink, sink.Severities(), digest); err != nil {
+				c.log.WithError(err).Error("Skipping webhook sink")
+			}
+			continue
+		}
+		router.AddRoute(sink, sink.Severities())
+	}
+	c.log.WithField("sinks", len(configs)).Info("Loaded webhook sinks")
+}
+
+// addGCPRoutes adds the Pub/Sub and Cloud Logging sinks, which share one
+// token source and proxy.
+func (c *Controller) addGCPRoutes(router *notify.Router) {
+	t, ok := c.egressTransport("gcp", c.cfg.GCPEgress)
+	if !ok {
+		return
+	}
+	auth := notify.NewGCPAuth(t)
+	if c.cfg.PubSubTopic != "" {
+		c.addRoute(router, notify.NewPubSub(auth, c.cfg.GCPProjectID, c.cfg.PubSubTopic), c.cfg.PubSubSeverities, c.cfg.PubSubDigest)
+	}
+	if c.cfg.CloudLoggingEnabled {
+		c.addRoute(router, notify.NewCloudLogging(auth, c.cfg.GCPProjectID, c.cfg.CloudLoggingLogName), c.cfg.CloudLoggingSeverities, c.cfg.CloudLoggingDigest)
+	}
+}
+
+// addRoute routes severities to sink, batching those of digest into
+// digests when it has any.
+func (c *Controller) addRoute(router *notify.Router, sink notify.Sink, severities []string, digest config.DigestSettings) {
+	if len(digest.Severities) == 0 {
+		router.AddRoute(sink, severities)
+		return
+	}
+	err := router.AddDigestRoute(sink, severities, notify.DigestConfig{
+		Severities: digest.Severities,
+		Window:     digest.Window,
+		Template:   c.digestTemplate(),
+	})
+	if err != nil {
+		c.log.WithError(err).Error("Invalid digest, sending alerts one by one")
+		router.AddRoute(sink, severities)
+		return
+	}
+	c.log.WithFields(logrus.Fields{"sink": sink.Name(), "severities": digest.Severities, "window": digest.Window}).Info("Batching alerts into digests")
+}
+
+// digestTemplate returns the template in cfg.DigestTemplateFile, or "" for
+// the default when it is unset or invalid.
+func (c *Controller) digestTemplate() string {
+	if c.cfg.DigestTemplateFile == "" {
+		return ""
+	}
+	text, err := notify.LoadDigestTemplate(c.cfg.DigestTemplateFile)
+	if err != nil {
+		c.log.WithError(err).WithField("file", c.cfg.DigestTemplateFile).Error("Invalid digest template, using the default")
+		return ""
+	}
+	return text
+}
+
+// egressTransport builds the transport one integration reaches its service
+// through. Invalid proxy or CA settings disable the integration instead of
+// letting it bypass the proxy.
+func (c *Controller) egressTransport(sink string, cfg egress.Config) (http.RoundTripper, bool) {
+	t, err := cfg.Transport()
+	if err != nil {
+		c.log.WithError(err).WithField("sink", sink).Error("Invalid proxy or TLS settings, integration disabled")
+		return nil, false
+	}
+	warnInsecureEgress(c.log, sink, cfg)
+	return t, true
+}
+
+// warnInsecureEgress logs that sink accepts any server certificate.
+func warnInsecureEgress(log *logrus.Logger, sink string, cfg egress.Config) {
+	if cfg.InsecureSkipVerify {
+		log.WithField("sink", sink).Warn("TLS certificate verification disabled; use a CA file instead")
+	}
+}
+
 func (c *Controller) initSweetSecurity() {
 	if !c.cfg.SweetSecurityEnabled {
 		return
 	}
+	if !sweetsecurity.ValidAuthMode(c.cfg.SweetSecurityAuthMode) {
+		c.log.WithField("auth_mode", c.cfg.SweetSecurityAuthMode).Error("Invalid Sweet Security auth mode, Sweet Security integration disabled")
+		return
+	}
+	headers, err := otlp.ParseHeaders(c.cfg.SweetSecurityHeaders)
+	if err != nil {
+		c.log.WithError(err).Error("Invalid Sweet Security headers, Sweet Security integration disabled")
+		return
+	}
+	transport, ok := c.egressTransport("sweetsecurity", c.cfg.SweetSecurityEgress)
+	if !ok {
+		return
+	}
 	client := sweetsecurity.NewClient(sweetsecurity.Config{
 		APIEndpoint: c.cfg.SweetSecurityEndpoint,
 		APIKey:      c.cfg.SweetSecurityAPIKey,
 		Timeout:     c.cfg.SweetSecurityTimeout,
+		Transport:   transport,
+
+		AuthMode:     c.cfg.SweetSecurityAuthMode,
+		APIKeyHeader: c.cfg.SweetSecurityAPIKeyHeader,
+		Headers:      headers,
+
+		MaxRetries:       c.cfg.SweetSecurityMaxRetries,
+		RetryBackoff:     c.cfg.SweetSecurityRetryBackoff,
+		BreakerThreshold: c.cfg.SweetSecurityBreakerLimit,
+		BreakerCooldown:  c.cfg.SweetSecurityBreakerReset,
+	}, c.log)
+	queue, err := sweetsecurity.NewQueue(client, sweetsecurity.QueueConfig{
+		Size:          c.cfg.SweetSecurityQueueSize,
+		Policy:        c.cfg.SweetSecurityDropPolicy,
+		Workers:       c.cfg.SweetSecurityWorkers,
+		BatchSize:     c.cfg.SweetSecurityBatchSize,
+		FlushInterval: c.cfg.SweetSecurityFlushInterval,
 	}, c.log)
+	if err != nil {
+		c.log.WithError(err).Error("Invalid Sweet Security queue config, Sweet Security integration disabled")
+		return
+	}
 	c.sweetSecurityMu.Lock()
 	c.sweetSecurity = client
+	c.sweetQueue = queue
 	c.sweetSecurityMu.Unlock()
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -101,67 +490,258 @@ func (c *Controller) initSweetSecurity() {
 	}()
 }
 
-// Start begins event processing and agent health check goroutines.
-// Caller must run the HTTP server separately.
+// initSplunk exports events and alerts to a Splunk HTTP Event Collector
+// when one is configured. Records are batched and sent by Start.
+func (c *Controller) initSplunk() {
+	if !c.cfg.SplunkEnabled {
+		return
+	}
+	transport, ok := c.egressTransport("splunk", c.cfg.SplunkEgress)
+	if !ok {
+		return
+	}
+	host, _ := os.Hostname()
+	c.splunk = splunk.NewClient(splunk.Config{
+		URL:             c.cfg.SplunkHECURL,
+		Token:           c.cfg.SplunkHECToken,
+		Index:           c.cfg.SplunkIndex,
+		Host:            host,
+		EventSourceType: c.cfg.SplunkEventSourceType,
+		AlertSourceType: c.cfg.SplunkAlertSourceType,
+		BatchSize:       c.cfg.SplunkBatchSize,
+		FlushInterval:   c.cfg.SplunkFlushInterval,
+		Transport:       transport,
+	}, c.log)
+	c.log.WithField("url", c.cfg.SplunkHECURL).Info("Exporting events and alerts to Splunk HEC")
+}
+
+// initElasticsearch bulk-indexes events and alerts into Elasticsearch or
+// OpenSearch when a URL is configured. Index templates are installed and
+// documents sent by Start.
+func (c *Controller) initElasticsearch() {
+	if c.cfg.ElasticsearchURL == "" {
+		return
+	}
+	transport, ok := c.egressTransport("elasticsearch", c.cfg.ElasticsearchEgress)
+	if !ok {
+		return
+	}
+	c.elastic = elasticsearch.NewIndexer(elasticsearch.Config{
+		URL:           c.cfg.ElasticsearchURL,
+		APIKey:        c.cfg.ElasticsearchAPIKey,
+		Username:      c.cfg.ElasticsearchUsername,
+		Password:      c.cfg.ElasticsearchPassword,
+		IndexPrefix:   c.cfg.ElasticsearchIndexPrefix,
+		BatchSize:     c.cfg.ElasticsearchBatchSize,
+		FlushInterval: c.cfg.ElasticsearchFlushInterval,
+		Transport:     transport,
+	}, c.log)
+	c.log.WithField("url", c.cfg.ElasticsearchURL).Info("Indexing events and alerts into Elasticsearch")
+}
+
+// Start begins event processing and agent health check goroutines. With
+// leader election, only once this replica is the leader; it restores the
+// saved state first. Caller must run the HTTP server separately.
 func (c *Controller) Start(ctx context.Context) {
+	if c.leader == nil {
+		c.lead(ctx)
+		return
+	}
+	// A replica that lost the Lease holds state the new leader no longer
+	// shares; it restarts and rejoins as a follower.
+	go c.leader.Run(ctx, func(ctx context.Context) {
+		c.restoreState()
+		c.loadStorage()
+		c.lead(ctx)
+	}, func() {
+		c.log.Fatal("Lost controller leadership, restarting")
+	})
+}
+
+// lead starts the leader's background work: detection, alerting, exports
+// and the periodic checks.
+func (c *Controller) lead(ctx context.Context) {
 	go c.processEvents(ctx)
 	go c.processAlerts(ctx)
 	go c.checkAgentHealth(ctx)
+	go c.runIngestRates(ctx)
+	if c.podMeta != nil {
+		go c.podMeta.Run(ctx)
+	}
+	if c.summarizer != nil {
+		go c.runSummaries(ctx)
+	}
+	if c.cfg.StateFile != "" {
+		go c.runStateSaver(ctx)
+	}
+	if c.store != nil {
+		go c.runStorage(ctx)
+	}
+	if c.shards != nil {
+		go c.runSharding(ctx)
+	}
+	if c.intel != nil {
+		go c.intel.Run(ctx)
+	}
+	if c.notifier != nil {
+		go c.notifier.Run(ctx)
+	}
+	if q := c.sweetSecurityQueue(); q != nil {
+		go q.Run(ctx)
+	}
+	if c.splunk != nil {
+		go c.splunk.Run(ctx)
+	}
+	if c.elastic != nil {
+		go c.elastic.Run(ctx)
+	}
+	if c.otlp != nil {
+		go c.otlp.Run(ctx)
+	}
+	if c.syslog != nil {
+		go c.syslog.Run(ctx)
+	}
+	if c.cfg.CanaryInterval > 0 {
+		go c.runCanary(ctx)
+	}
+	if c.fedEdge != nil && c.cfg.FederationInterval > 0 {
+		go c.runFederation(ctx)
+	}
 }
 
 // IngestEvent accepts an event from the HTTP API and queues it for processing.
-// It also updates agent tracking. Returns error if buffer is full.
+// Legacy payloads are converted to the current schema first. It also updates
+// agent tracking, fills in the pod identity, cluster and environment the
+// agent registered when the event lacks them, and forwards HIGH and CRITICAL
+// events to Sweet Security.
+// Returns a *RateLimitError if the caller set by WithCaller, or without one
+// the agent, is over AgentEventRate and an error if the buffer is full;
+// otherwise the controller owns the event and the caller must not use it
+// again.
 func (c *Controller) IngestEvent(ctx context.Context, event *types.SecurityEvent) error {
+	now := time.Now()
+	if err := c.admitEvent(ctx, event.AgentID, now); err != nil {
+		return err
+	}
+	schema := upgradeEvent(event)
+	c.noteUnknownFields(event, schema)
+	mode, _ := event.Metadata["monitoring_mode"].(string)
+	c.arrivals[arrivalEvent].record(now)
+	if c.shards != nil && !c.shards.owns(event.AgentID) {
+		shardMisrouted.Inc()
+	}
 	c.agentsMu.Lock()
 	if agent, ok := c.agents[event.AgentID]; ok {
-		agent.LastSeen = time.Now()
+		agent.LastSeen = now
+		agent.LastEventAt = &now
 		agent.EventCount++
+		agent.MonitoringMode = mode
+		agent.SchemaVersion = schema
+		if event.Identity != nil {
+			agent.Identity = event.Identity
+		} else {
+			event.Identity = agent.Identity
+		}
+		if event.ClusterName == "" && event.Environment == "" {
+			event.ClusterName, event.Environment = agent.ClusterName, agent.Environment
+		}
 	} else {
 		c.agents[event.AgentID] = &types.AgentInfo{
-			ID:           event.AgentID,
-			PodName:      event.PodName,
-			PodNamespace: event.PodNamespace,
-			ConnectedAt:  time.Now(),
-			LastSeen:     time.Now(),
-			EventCount:   1,
+			ID:             event.AgentID,
+			PodName:        event.PodName,
+			PodNamespace:   event.PodNamespace,
+			ConnectedAt:    now,
+			LastSeen:       now,
+			LastEventAt:    &now,
+			EventCount:     1,
+			MonitoringMode: mode,
+			SchemaVersion:  schema,
+			Identity:       event.Identity,
+			ClusterName:    event.ClusterName,
+			Environment:    event.Environment,
 		}
 	}
 	c.agentsMu.Unlock()
+	if event.ClusterName == "" {
+		event.ClusterName = c.cfg.ClusterName
+	}
+	if event.Environment == "" {
+		event.Environment = c.cfg.Environment
+	}
+
+	// Built before queueing, since processing enriches the event as soon as
+	// it is queued.
+	var sweetEvent *sweetsecurity.Event
+	queue := c.sweetSecurityQueue()
+	if queue != nil && (event.Severity == "CRITICAL" || event.Severity == "HIGH") {
+		sweetEvent = newSweetEvent(event)
+	}
 
 	select {
 	case c.eventBuffer <- event:
-		return nil
 	default:
 		return fmt.Errorf("event buffer full")
 	}
+	if sweetEvent != nil && !queue.SendEvent(sweetEvent) {
+		c.log.WithField("event_id", sweetEvent.ID).Debug("Sweet Security queue full, dropping event")
+	}
+	return nil
 }
 
-// GetAgents returns a copy of connected agents.
+// GetAgents returns a copy of connected agents with their derived status.
 func (c *Controller) GetAgents() []*types.AgentInfo {
+	now := time.Now()
 	c.agentsMu.RLock()
 	defer c.agentsMu.RUnlock()
 	out := make([]*types.AgentInfo, 0, len(c.agents))
 	for _, a := range c.agents {
-		out = append(out, a)
+		cp := *a
+		cp.Status = agentStatus(a, now, c.cfg.AgentStaleThreshold)
+		if cp.Protocol == nil {
+			cp.Protocol = c.agentProtocol()
+		}
+		out = append(out, &cp)
 	}
 	return out
 }
 
-// GetAlerts returns the most recent alerts, up to limit.
-func (c *Controller) GetAlerts(limit int) []*types.Alert {
+// GetAlerts returns the page of alerts selected by filter along with the total
+// number of matching alerts before paging.
+func (c *Controller) GetAlerts(filter types.AlertFilter) ([]*types.Alert, int) {
 	c.alertsMu.RLock()
-	defer c.alertsMu.RUnlock()
-	n := len(c.alerts)
-	if limit <= 0 || limit > n {
-		limit = n
+	matched := make([]*types.Alert, 0, len(c.alerts))
+	for _, a := range c.alerts {
+		if filter.Matches(a) {
+			matched = append(matched, a)
+		}
+	}
+	c.alertsMu.RUnlock()
+
+	asc := filter.Order != types.SortDesc
+	if filter.Sort == types.AlertSortSeverity {
+		sort.SliceStable(matched, func(i, j int) bool {
+			ri, rj := types.SeverityRank(matched[i].Severity), types.SeverityRank(matched[j].Severity)
+			if ri != rj {
+				return (ri < rj) == asc
+			}
+			return matched[i].Timestamp.Before(matched[j].Timestamp) == asc
+		})
+	} else if !asc {
+		// Alerts are stored in arrival order; newest first is a reversal.
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
 	}
-	start := n - limit
-	if start < 0 {
-		start = 0
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*types.Alert{}, total
 	}
-	out := make([]*types.Alert, limit)
-	copy(out, c.alerts[start:])
-	return out
+	page := matched[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(page) {
+		page = page[:filter.Limit]
+	}
+	return page, total
 }
 
 // SweetSecurity returns the Sweet Security client if configured (for sending events from server).
@@ -171,15 +751,30 @@ func (c *Controller) SweetSecurity() *sweetsecurity.Client {
 	return c.sweetSecurity
 }
 
-// SendHighSeverityEvent sends a high/critical event to Sweet Security if configured.
-// Call from the HTTP handler after IngestEvent for HIGH/CRITICAL severity.
-func (c *Controller) SendHighSeverityEvent(ctx context.Context, event *types.SecurityEvent) {
+// sweetSecurityQueue returns the queue in front of the Sweet Security
+// client, or nil if the integration is not configured.
+func (c *Controller) sweetSecurityQueue() *sweetsecurity.Queue {
 	c.sweetSecurityMu.RLock()
-	client := c.sweetSecurity
-	c.sweetSecurityMu.RUnlock()
-	if client == nil {
+	defer c.sweetSecurityMu.RUnlock()
+	return c.sweetQueue
+}
+
+// SendHighSeverityEvent queues a high/critical event for Sweet Security if configured.
+// IngestEvent already does this for HIGH/CRITICAL events it accepts. The
+// event is sent in a batch by the queue's workers, not under ctx.
+func (c *Controller) SendHighSeverityEvent(ctx context.Context, event *types.SecurityEvent) {
+	queue := c.sweetSecurityQueue()
+	if queue == nil {
 		return
 	}
+	if !queue.SendEvent(newSweetEvent(event)) {
+		c.log.WithField("event_id", event.ID).Debug("Sweet Security queue full, dropping event")
+	}
+}
+
+// newSweetEvent converts event to the Sweet Security format. The result
+// shares no memory with the top-level event struct.
+func newSweetEvent(event *types.SecurityEvent) *sweetsecurity.Event {
 	sweetEvent := &sweetsecurity.Event{
 		ID:           event.ID,
 		AgentID:      event.AgentID,
@@ -198,6 +793,18 @@ func (c *Controller) SendHighSeverityEvent(ctx context.Context, event *types.Sec
 			"cmdline":               event.Process.Cmdline,
 			"suspicious_indicators": event.Process.SuspiciousIndicators,
 		}
+		if len(event.Process.Ancestors) > 0 {
+			sweetEvent.Process["ancestors"] = event.Process.Ancestors
+		}
+		if len(event.Process.Environment) > 0 {
+			sweetEvent.Process["environment"] = event.Process.Environment
+		}
+		if event.Process.CPUPercent > 0 {
+			sweetEvent.Process["cpu_percent"] = event.Process.CPUPercent
+		}
+		if event.Process.MemoryBytes > 0 {
+			sweetEvent.Process["memory_bytes"] = event.Process.MemoryBytes
+		}
 	}
 	if event.Network != nil {
 		sweetEvent.Network = map[string]interface{}{
@@ -208,6 +815,12 @@ func (c *Controller) SendHighSeverityEvent(ctx context.Context, event *types.Sec
 			"is_external":        event.Network.IsExternal,
 			"is_suspicious_port": event.Network.IsSuspiciousPort,
 		}
+		if event.Network.Domain != "" {
+			sweetEvent.Network["domain"] = event.Network.Domain
+		}
+		if event.Network.MatchedIOC != nil {
+			sweetEvent.Network["matched_ioc"] = event.Network.MatchedIOC
+		}
 	}
 	if event.File != nil {
 		sweetEvent.File = map[string]interface{}{
@@ -216,17 +829,49 @@ func (c *Controller) SendHighSeverityEvent(ctx context.Context, event *types.Sec
 			"old_hash":  event.File.OldHash,
 			"new_hash":  event.File.NewHash,
 		}
+		if len(event.File.Indicators) > 0 {
+			sweetEvent.File["indicators"] = event.File.Indicators
+		}
+		if len(event.File.YaraRules) > 0 {
+			sweetEvent.File["yara_rules"] = event.File.YaraRules
+		}
+		if event.File.PID != 0 {
+			sweetEvent.File["pid"] = event.File.PID
+			sweetEvent.File["process_name"] = event.File.ProcessName
+		}
+		if event.File.Mode != "" {
+			sweetEvent.File["mode"] = event.File.Mode
+			sweetEvent.File["old_mode"] = event.File.OldMode
+		}
+		if event.File.UID != nil && event.File.GID != nil {
+			sweetEvent.File["uid"] = *event.File.UID
+			sweetEvent.File["gid"] = *event.File.GID
+		}
 	}
 	if event.Metadata != nil {
 		for k, v := range event.Metadata {
 			sweetEvent.Metadata[k] = v
 		}
 	}
-	go func() {
-		if err := client.SendEvent(ctx, sweetEvent); err != nil {
-			c.log.WithError(err).WithField("event_id", event.ID).Debug("Failed to send event to Sweet Security")
-		}
-	}()
+	if event.Resource != nil {
+		sweetEvent.Metadata["resource"] = event.Resource
+	}
+	if event.OccurredAt != nil {
+		sweetEvent.Metadata["occurred_at"] = event.OccurredAt
+	}
+	if event.Identity != nil {
+		sweetEvent.Metadata["identity"] = event.Identity
+	}
+	if event.ClusterName != "" {
+		sweetEvent.Metadata["cluster_name"] = event.ClusterName
+	}
+	if event.Environment != "" {
+		sweetEvent.Metadata["environment"] = event.Environment
+	}
+	if fields := event.UnknownFields(); fields != nil {
+		sweetEvent.Metadata["unknown_fields"] = fields
+	}
+	return sweetEvent
 }
 
 func (c *Controller) processEvents(ctx context.Context) {
@@ -235,7 +880,24 @@ func (c *Controller) processEvents(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case event := <-c.eventBuffer:
+			if c.intel != nil {
+				c.intel.Enrich(event)
+			}
+			// Detection sees every event; only storage and export are
+			// summarized.
+			store := c.summarizer == nil || c.summarizer.admit(event)
+			if store {
+				c.retainEvent(event)
+				c.storeEvent(event)
+			}
+			c.observeTriage(event)
 			c.evaluateEvent(event)
+			c.correlateLateral(event)
+			c.correlateCampaign(event)
+			c.recordGraph(event)
+			if store {
+				c.exportEvent(event)
+			}
 		}
 	}
 }
@@ -243,12 +905,16 @@ func (c *Controller) processEvents(ctx context.Context) {
 func (c *Controller) evaluateEvent(event *types.SecurityEvent) {
 	eventsReceived.WithLabelValues(event.Type, event.Severity, event.PodNamespace).Inc()
 	for _, alert := range c.engine.Evaluate(event) {
-		select {
-		case c.alertChan <- alert:
-		default:
-			c.log.Warn("Alert channel full, dropping alert")
+		if alert.Shadow {
+			c.recordShadowMatch(alert)
+			continue
 		}
+		alert.Kubernetes = c.podMeta.lookup(event.PodNamespace, event.PodName)
+		c.triageAlert(alert, event)
+		c.extractIOCs(alert, event)
+		c.raiseAlert(alert)
 	}
+	c.handleSlowRules()
 }
 
 func (c *Controller) processAlerts(ctx context.Context) {
@@ -257,12 +923,36 @@ func (c *Controller) processAlerts(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case alert := <-c.alertChan:
+			if c.suppressed(alert) {
+				continue
+			}
+			if p, ok := c.playbooks[alert.RuleID]; ok {
+				alert.Playbook = p
+			}
+			if alert.ClusterName == "" {
+				alert.ClusterName = c.cfg.ClusterName
+			}
+			if alert.Environment == "" {
+				alert.Environment = c.cfg.Environment
+			}
+			if c.shards != nil {
+				alert.Replica = c.shards.self
+			}
+			if alert.Status == "" {
+				alert.Status = types.AlertStatusOpen
+			}
+			c.interner.alert(alert)
 			c.alertsMu.Lock()
 			c.alerts = append(c.alerts, alert)
-			if len(c.alerts) > c.cfg.AlertRetentionCount {
-				c.alerts = c.alerts[len(c.alerts)-c.cfg.AlertRetentionCount:]
+			if c.cfg.AlertRetentionCount > 0 && len(c.alerts) > c.cfg.AlertRetentionCount {
+				drop := len(c.alerts) - c.cfg.AlertRetentionCount
+				c.alerts = c.alerts[drop:]
+				c.alertsDropped += int64(drop)
 			}
 			c.alertsMu.Unlock()
+			c.storeAlert(alert)
+			c.ruleStats.record(alert)
+			c.alertHub.publish(alert)
 
 			alertsGenerated.WithLabelValues(alert.RuleID, alert.Severity).Inc()
 			c.log.WithFields(logrus.Fields{
@@ -271,18 +961,66 @@ func (c *Controller) processAlerts(ctx context.Context) {
 				"mitre": alert.MitreID, "description": alert.Description,
 			}).Warn("SECURITY ALERT")
 
-			c.sendAlertToSweetSecurity(ctx, alert)
+			c.sendAlertToSweetSecurity(alert)
+			c.exportAlert(alert)
+			if c.notifier != nil {
+				c.notifier.Notify(alert)
+			}
 		}
 	}
 }
 
-func (c *Controller) sendAlertToSweetSecurity(ctx context.Context, alert *types.Alert) {
-	c.sweetSecurityMu.RLock()
-	client := c.sweetSecurity
-	c.sweetSecurityMu.RUnlock()
-	if client == nil {
+// exportEvent queues a processed event, with its threat intel matches, for
+// Splunk, Elasticsearch, OTLP and, when it takes events, syslog.
+func (c *Controller) exportEvent(event *types.SecurityEvent) {
+	if c.splunk != nil && !c.splunk.SendEvent(event, eventTime(event)) {
+		c.log.WithField("event_id", event.ID).Debug("Splunk export queue full, dropping event")
+	}
+	if c.elastic != nil && !c.elastic.IndexEvent(event.ID, event.Timestamp, event) {
+		c.log.WithField("event_id", event.ID).Debug("Elasticsearch queue full, dropping event")
+	}
+	if c.otlp != nil && !c.otlp.Export(eventRecord(event)) {
+		c.log.WithField("event_id", event.ID).Debug("OTLP export queue full, dropping event")
+	}
+	if c.syslog != nil && c.cfg.SyslogEvents && !c.syslog.Export(c.eventSyslog(event)) {
+		c.log.WithField("event_id", event.ID).Debug("Syslog export queue full, dropping event")
+	}
+}
+
+// exportAlert queues a copy of an alert for Splunk, Elasticsearch, OTLP and
+// syslog, as later status updates change the retained alert in place.
+func (c *Controller) exportAlert(alert *types.Alert) {
+	if c.splunk == nil && c.elastic == nil && c.otlp == nil && c.syslog == nil {
+		return
+	}
+	snapshot := *alert
+	if c.splunk != nil && !c.splunk.SendAlert(&snapshot, alert.Timestamp) {
+		c.log.WithField("alert_id", alert.ID).Warn("Splunk export queue full, dropping alert")
+	}
+	if c.elastic != nil && !c.elastic.IndexAlert(alert.ID, alert.Timestamp, &snapshot) {
+		c.log.WithField("alert_id", alert.ID).Warn("Elasticsearch queue full, dropping alert")
+	}
+	if c.otlp != nil && !c.otlp.Export(alertRecord(&snapshot)) {
+		c.log.WithField("alert_id", alert.ID).Warn("OTLP export queue full, dropping alert")
+	}
+	if c.syslog != nil && !c.syslog.Export(c.alertSyslog(&snapshot)) {
+		c.log.WithField("alert_id", alert.ID).Warn("Syslog export queue full, dropping alert")
+	}
+}
+
+func (c *Controller) sendAlertToSweetSecurity(alert *types.Alert) {
+	queue := c.sweetSecurityQueue()
+	if queue == nil {
 		return
 	}
+	if !queue.SendAlert(c.newSweetAlert(alert)) {
+		c.log.WithField("alert_id", alert.ID).Warn("Sweet Security queue full, dropping alert")
+	}
+}
+
+// newSweetAlert converts an alert to Sweet Security's format and applies
+// the configured mappings.
+func (c *Controller) newSweetAlert(alert *types.Alert) *sweetsecurity.Alert {
 	sweetAlert := &sweetsecurity.Alert{
 		ID:           alert.ID,
 		Timestamp:    alert.Timestamp,
@@ -292,6 +1030,7 @@ func (c *Controller) sendAlertToSweetSecurity(ctx context.Context, alert *types.
 		Description:  alert.Description,
 		PodName:      alert.PodName,
 		PodNamespace: alert.PodNS,
+		ClusterName:  alert.ClusterName,
 		MitreTactic:  alert.MitreTactic,
 		MitreID:      alert.MitreID,
 		EventIDs:     alert.EventIDs,
@@ -300,11 +1039,34 @@ func (c *Controller) sendAlertToSweetSecurity(ctx context.Context, alert *types.
 			"recommended_actions": alert.Actions,
 		},
 	}
-	go func() {
-		if err := client.SendAlert(ctx, sweetAlert); err != nil {
-			c.log.WithError(err).WithFields(logrus.Fields{"alert_id": alert.ID, "rule_id": alert.RuleID}).Error("Failed to send alert to Sweet Security API")
-		}
-	}()
+	if alert.ObservedAt != nil {
+		sweetAlert.Metadata["observed_at"] = alert.ObservedAt
+	}
+	if alert.OccurredAt != nil {
+		sweetAlert.Metadata["occurred_at"] = alert.OccurredAt
+	}
+	if alert.Identity != nil {
+		sweetAlert.Metadata["identity"] = alert.Identity
+	}
+	if alert.Kubernetes != nil {
+		sweetAlert.Metadata["kubernetes"] = alert.Kubernetes
+	}
+	if alert.Environment != "" {
+		sweetAlert.Metadata["environment"] = alert.Environment
+	}
+	if alert.Playbook != nil {
+		sweetAlert.Metadata["playbook"] = alert.Playbook
+	}
+	if len(alert.Hints) > 0 {
+		sweetAlert.Metadata["triage_hints"] = alert.Hints
+	}
+	if alert.Test {
+		sweetAlert.Metadata["test"] = true
+	}
+	if err := c.sweetMappings.Apply(sweetAlert); err != nil {
+		c.log.WithError(err).WithField("alert_id", alert.ID).Warn("Failed to map Sweet Security alert, sending it unmapped")
+	}
+	return sweetAlert
 }
 
 func (c *Controller) checkAgentHealth(ctx context.Context) {
@@ -321,10 +1083,17 @@ func (c *Controller) checkAgentHealth(ctx context.Context) {
 				if now.Sub(agent.LastSeen) > c.cfg.AgentStaleThreshold {
 					c.log.WithField("agent_id", id).Warn("Agent appears offline")
 					delete(c.agents, id)
+					if c.podIPs[agent.PodIP] == id {
+						delete(c.podIPs, agent.PodIP)
+					}
 				}
 			}
 			activeAgents.Set(float64(len(c.agents)))
+			c.updateStatusGauge(now)
+			c.updateSchemaGauge()
+			c.updateThrottledGauge(now)
 			c.agentsMu.Unlock()
+			c.eventLimiter.prune(now)
 		}
 	}
 }
@@ -2,7 +2,14 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -97,7 +104,7 @@ func TestController_GetAlerts_Empty(t *testing.T) {
 	log := logrus.New()
 	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}
 	c := New(cfg, log)
-	alerts := c.GetAlerts(100)
+	alerts, _ := c.GetAlerts(types.AlertFilter{Limit: 100})
 	if len(alerts) != 0 {
 		t.Errorf("GetAlerts: want 0, got %d", len(alerts))
 	}
@@ -130,7 +137,7 @@ func TestController_Start_EventToAlertFlow(t *testing.T) {
 	// Wait for processEvents and processAlerts to run
 	time.Sleep(150 * time.Millisecond)
 
-	alerts := c.GetAlerts(10)
+	alerts, _ := c.GetAlerts(types.AlertFilter{Limit: 10})
 	if len(alerts) < 1 {
 		t.Errorf("expected at least 1 alert from cryptominer event, got %d", len(alerts))
 	}
@@ -166,19 +173,19 @@ func TestController_GetAlerts_Limit(t *testing.T) {
 	time.Sleep(150 * time.Millisecond)
 
 	// GetAlerts(1) should return only 1
-	alerts := c.GetAlerts(1)
+	alerts, _ := c.GetAlerts(types.AlertFilter{Limit: 1})
 	if len(alerts) != 1 {
 		t.Errorf("GetAlerts(1): want 1, got %d", len(alerts))
 	}
 
 	// GetAlerts(0) - limit <= 0 means return all
-	alerts0 := c.GetAlerts(0)
+	alerts0, _ := c.GetAlerts(types.AlertFilter{})
 	if len(alerts0) < 2 {
 		t.Errorf("GetAlerts(0): want at least 2, got %d", len(alerts0))
 	}
 
 	// GetAlerts(999) - limit > n returns n
-	alerts999 := c.GetAlerts(999)
+	alerts999, _ := c.GetAlerts(types.AlertFilter{Limit: 999})
 	if len(alerts999) != len(alerts0) {
 		t.Errorf("GetAlerts(999): got %d, want %d", len(alerts999), len(alerts0))
 	}
@@ -205,3 +212,336 @@ func TestController_SweetSecurity(t *testing.T) {
 		t.Error("SweetSecurity should be nil when not configured")
 	}
 }
+
+func TestController_IngestEvent_ForwardsHighSeverity(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	sweet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/events/batch" {
+			var batch struct {
+				Events []map[string]interface{} `json:"events"`
+			}
+			json.NewDecoder(r.Body).Decode(&batch)
+			for _, ev := range batch.Events {
+				received <- ev
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer sweet.Close()
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		SweetSecurityEnabled: true, SweetSecurityEndpoint: sweet.URL, SweetSecurityAPIKey: "key", SweetSecurityTimeout: time.Second,
+		SweetSecurityFlushInterval: 10 * time.Millisecond,
+	}
+	c := New(cfg, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	for _, sev := range []string{"LOW", "CRITICAL"} {
+		ev := &types.SecurityEvent{}
+		ev.ID, ev.AgentID, ev.Type, ev.Severity = "ev-"+sev, "a", "process_start", sev
+		ev.Process = &types.ProcessEventData{PID: 7, Name: "nc"}
+		if err := c.IngestEvent(ctx, ev); err != nil {
+			t.Fatalf("IngestEvent: %v", err)
+		}
+	}
+	select {
+	case ev := <-received:
+		process, _ := ev["process"].(map[string]interface{})
+		if ev["id"] != "ev-CRITICAL" || process["name"] != "nc" {
+			t.Errorf("forwarded event = %v, want ev-CRITICAL with its process", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CRITICAL event not forwarded to Sweet Security")
+	}
+	select {
+	case ev := <-received:
+		t.Errorf("LOW event forwarded: %v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestController_ThreatIntelEnrichment(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# C2 servers\n198.51.100.7\n"))
+	}))
+	defer feed.Close()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, EventRetentionCount: 10, ThreatIntelIPFeeds: []string{feed.URL}}
+	c := New(cfg, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+	for i := 0; i < 50 && c.intel.Match("198.51.100.7", "") == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ev := &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a", Type: "network_connect", Severity: "MEDIUM",
+		Timestamp: time.Now(), PodName: "p", PodNamespace: "ns",
+		Network: &types.NetworkEventData{Protocol: "tcp", DstIP: "198.51.100.7", DstPort: 443, IsExternal: true},
+	}
+	if err := c.IngestEvent(ctx, ev); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	alerts, _ := c.GetAlerts(types.AlertFilter{RuleID: "APSS-011"})
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 APSS-011 alert, got %d", len(alerts))
+	}
+	page := c.ExportEvents(0, 10, func(*types.SecurityEvent) bool { return true })
+	if len(page.Items) != 1 || page.Items[0].Network.MatchedIOC == nil || page.Items[0].Network.MatchedIOC.Feed != feed.URL {
+		t.Errorf("exported event not enriched: %+v", page.Items)
+	}
+}
+
+func TestController_NotifiesBySeverity(t *testing.T) {
+	posted := make(chan string, 10)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&msg)
+		posted <- msg.Text
+	}))
+	defer slack.Close()
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		SlackWebhookURL: slack.URL, SlackSeverities: []string{"CRITICAL"},
+	}
+	c := New(cfg, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	// APSS-004 (MEDIUM) is not routed; APSS-002 (CRITICAL) is.
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-1", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"shell_spawn"}}})
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-2", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}}})
+
+	select {
+	case text := <-posted:
+		if !strings.Contains(text, "APSS-002") {
+			t.Errorf("posted %q, want the APSS-002 alert", text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no Slack notification")
+	}
+	select {
+	case text := <-posted:
+		t.Errorf("unexpected second notification %q", text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestController_WebhookSinks(t *testing.T) {
+	posted := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posted <- r.Header.Get("X-Api-Key") + " " + string(body)
+	}))
+	defer srv.Close()
+	t.Setenv("OPSGENIE_KEY", "k3y")
+	file := filepath.Join(t.TempDir(), "webhooks.yaml")
+	os.WriteFile(file, []byte(`webhooks:
+  - name: opsgenie
+    url: `+srv.URL+`
+    headers: {X-Api-Key: "${OPSGENIE_KEY}"}
+    severities: [CRITICAL]
+    body: '{"message": {{ .RuleID | json }}}'
+  - name: broken
+    url: `+srv.URL+`
+    body: '{{ .Nope'
+`), 0o600)
+
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, WebhookSinksFile: file}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-1", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"shell_spawn"}}})
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-2", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}}})
+
+	select {
+	case got := <-posted:
+		if got != `k3y {"message": "APSS-002"}` {
+			t.Errorf("posted %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook notification")
+	}
+	select {
+	case got := <-posted:
+		t.Errorf("unexpected second notification %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestController_Playbooks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "playbooks.yaml")
+	os.WriteFile(file, []byte(`playbooks:
+  APSS-002:
+    url: https://runbooks.example.com/cryptominer
+    body: Delete the pod and check its image digest.
+`), 0o600)
+
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, PlaybooksFile: file}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-1", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"shell_spawn"}}})
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-2", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}}})
+	time.Sleep(100 * time.Millisecond)
+
+	alerts, _ := c.GetAlerts(types.AlertFilter{})
+	if len(alerts) != 2 {
+		t.Fatalf("alerts = %d, want 2", len(alerts))
+	}
+	for _, a := range alerts {
+		switch {
+		case a.RuleID == "APSS-002" && (a.Playbook == nil || a.Playbook.URL != "https://runbooks.example.com/cryptominer"):
+			t.Errorf("APSS-002 playbook = %+v", a.Playbook)
+		case a.RuleID != "APSS-002" && a.Playbook != nil:
+			t.Errorf("%s has playbook %+v, want none", a.RuleID, a.Playbook)
+		}
+	}
+}
+
+func TestController_SplunkExport(t *testing.T) {
+	sourcetypes := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dec := json.NewDecoder(r.Body)
+		for dec.More() {
+			var rec struct {
+				SourceType string `json:"sourcetype"`
+			}
+			if dec.Decode(&rec) != nil {
+				return
+			}
+			sourcetypes <- rec.SourceType
+		}
+	}))
+	defer srv.Close()
+	c := New(config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		SplunkEnabled: true, SplunkHECURL: srv.URL, SplunkHECToken: "tok",
+		SplunkEventSourceType: "apss:event", SplunkAlertSourceType: "apss:alert",
+		SplunkFlushInterval: 20 * time.Millisecond,
+	}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-1", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}}})
+
+	got := map[string]int{}
+	deadline := time.After(2 * time.Second)
+	for got["apss:event"] < 1 || got["apss:alert"] < 1 {
+		select {
+		case st := <-sourcetypes:
+			got[st]++
+		case <-deadline:
+			t.Fatalf("exported sourcetypes = %v, want the event and its alert", got)
+		}
+	}
+}
+
+func TestController_ElasticsearchExport(t *testing.T) {
+	indices := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			return
+		}
+		dec := json.NewDecoder(r.Body)
+		for dec.More() {
+			var line struct {
+				Index *struct {
+					Index string `json:"_index"`
+				} `json:"index"`
+			}
+			if dec.Decode(&line) != nil {
+				return
+			}
+			if line.Index != nil {
+				indices <- line.Index.Index
+			}
+		}
+		io.WriteString(w, `{"errors":false,"items":[]}`)
+	}))
+	defer srv.Close()
+	c := New(config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		ElasticsearchURL: srv.URL, ElasticsearchIndexPrefix: "apss",
+		ElasticsearchFlushInterval: 20 * time.Millisecond,
+	}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	now := time.Now()
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-1", AgentID: "a", Timestamp: now, Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}}})
+
+	day := now.UTC().Format("2006.01.02")
+	got := map[string]int{}
+	deadline := time.After(2 * time.Second)
+	for got["apss-events-"+day] < 1 || got["apss-alerts-"+day] < 1 {
+		select {
+		case idx := <-indices:
+			got[idx]++
+		case <-deadline:
+			t.Fatalf("indexed into %v, want the event and its alert in today's indices", got)
+		}
+	}
+}
+
+func TestController_OTLPExport(t *testing.T) {
+	requests := make(chan int, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/logs" && r.Header.Get("Content-Type") == "application/x-protobuf" {
+			body, _ := io.ReadAll(r.Body)
+			requests <- len(body)
+		}
+	}))
+	defer srv.Close()
+	c := New(config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		OTLPEndpoint: srv.URL, OTLPProtocol: "http/protobuf", OTLPFlushInterval: 20 * time.Millisecond,
+	}, logrus.New())
+	if c.otlp == nil {
+		t.Fatal("OTLP exporter not configured")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-1", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}}})
+	select {
+	case n := <-requests:
+		if n == 0 {
+			t.Error("empty OTLP export")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing exported over OTLP")
+	}
+}
+
+func TestController_OTLPInvalidConfig(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, OTLPEndpoint: "otel:4317"}, logrus.New())
+	if c.otlp != nil {
+		t.Error("OTLP exporter configured with an endpoint that is not a URL")
+	}
+}
+
+func TestController_GCPSinks(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	if c.notifier != nil {
+		t.Fatal("notifier configured without sinks")
+	}
+	c = New(config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		PubSubTopic: "apss-alerts", PubSubSeverities: []string{"CRITICAL"},
+		CloudLoggingEnabled: true, CloudLoggingSeverities: []string{"HIGH"},
+	}, logrus.New())
+	if c.notifier == nil {
+		t.Error("Pub/Sub and Cloud Logging sinks not routed")
+	}
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/detection"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ruleStat tracks how often a rule has fired. Unlike the retained alert list
+// it is never trimmed, so rare rules keep their history.
+type ruleStat struct {
+	name      string
+	severity  string
+	matches   int64
+	lastFired time.Time
+	// shadowMatches counts the alerts the rule would have raised in shadow
+	// mode; samples holds the latest of them.
+	shadowMatches int64
+	lastShadow    time.Time
+	samples       []types.ShadowMatch
+}
+
+type ruleStats struct {
+	mu    sync.Mutex
+	stats map[string]*ruleStat
+	// modes are the shadow modes set through the API, by rule ID; they
+	// override SHADOW_RULES and Sigma rules' own setting across restarts.
+	modes map[string]bool
+	// disabled holds the IDs of rules disabled for being slow or through
+	// the API, kept across restarts.
+	disabled map[string]bool
+}
+
+func newRuleStats() *ruleStats {
+	return &ruleStats{stats: make(map[string]*ruleStat), modes: make(map[string]bool), disabled: make(map[string]bool)}
+}
+
+// get returns the stat of alert's rule, creating it. Caller must hold mu.
+func (s *ruleStats) get(alert *types.Alert) *ruleStat {
+	st, ok := s.stats[alert.RuleID]
+	if !ok {
+		st = &ruleStat{}
+		s.stats[alert.RuleID] = st
+	}
+	st.name, st.severity = alert.RuleName, alert.Severity
+	return st
+}
+
+func (s *ruleStats) record(alert *types.Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.get(alert)
+	st.matches++
+	st.lastFired = alert.Timestamp
+}
+
+// RuleCoverage reports fixture counts and match history for every detection
+// rule, plus controller-raised rules that have fired, sorted by rule ID.
+func (c *Controller) RuleCoverage() []*types.RuleCoverage {
+	fixtures := detection.FixtureCounts()
+	byID := make(map[string]*types.RuleCoverage)
+	for _, r := range c.engine.Rules() {
+		byID[r.ID] = &types.RuleCoverage{
+			RuleID:   r.ID,
+			RuleName: r.Name,
+			Severity: r.Severity,
+			Fixtures: fixtures[r.ID],
+		}
+	}
+
+	c.ruleStats.mu.Lock()
+	for id, st := range c.ruleStats.stats {
+		cov, ok := byID[id]
+		if !ok {
+			cov = &types.RuleCoverage{RuleID: id, RuleName: st.name, Severity: st.severity, Fixtures: fixtures[id]}
+			byID[id] = cov
+		}
+		if st.matches > 0 {
+			last := st.lastFired
+			cov.Matches = st.matches
+			cov.LastFiredAt = &last
+			cov.EverMatched = true
+		}
+		if st.shadowMatches > 0 {
+			last := st.lastShadow
+			cov.ShadowMatches = st.shadowMatches
+			cov.LastShadowMatchAt = &last
+			cov.ShadowSamples = append([]types.ShadowMatch(nil), st.samples...)
+		}
+	}
+	c.ruleStats.mu.Unlock()
+	for id, cov := range byID {
+		cov.Shadow = c.engine.IsShadow(id)
+		cov.Disabled = c.engine.IsDisabled(id)
+		cov.Slow = c.ruleTimings != nil && c.ruleTimings.isSlow(id)
+	}
+
+	out := make([]*types.RuleCoverage, 0, len(byID))
+	for _, cov := range byID {
+		out = append(out, cov)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RuleID < out[j].RuleID })
+	return out
+}
+
+// ruleCoverage returns the coverage of rule id.
+func (c *Controller) ruleCoverage(id string) (*types.RuleCoverage, error) {
+	for _, cov := range c.RuleCoverage() {
+		if cov.RuleID == id {
+			return cov, nil
+		}
+	}
+	return nil, ErrRuleNotFound
+}
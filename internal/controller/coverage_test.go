@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_RuleCoverage(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, AlertRetentionCount: 1}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	cov := c.RuleCoverage()
+	if len(cov) != len(c.engine.Rules()) {
+		t.Fatalf("coverage entries = %d, want %d", len(cov), len(c.engine.Rules()))
+	}
+	for _, rc := range cov {
+		if rc.Fixtures == 0 || rc.EverMatched || rc.LastFiredAt != nil {
+			t.Errorf("fresh coverage for %s = %+v", rc.RuleID, rc)
+		}
+	}
+
+	// Two reverse-shell alerts; retention of 1 must not lose the count.
+	for i := 0; i < 2; i++ {
+		err := c.IngestEvent(ctx, &types.SecurityEvent{
+			ID: "ev", AgentID: "a", Type: "network_connect", Severity: "HIGH",
+			Network: &types.NetworkEventData{DstIP: "1.2.3.4", DstPort: 4444, IsExternal: true},
+		})
+		if err != nil {
+			t.Fatalf("IngestEvent: %v", err)
+		}
+	}
+	c.raiseAlert(&types.Alert{RuleID: MonitorCrashRuleID, RuleName: "Agent Monitor Crash Loop", Severity: "HIGH", Timestamp: time.Now()})
+	time.Sleep(200 * time.Millisecond)
+
+	byID := make(map[string]*types.RuleCoverage)
+	for _, rc := range c.RuleCoverage() {
+		byID[rc.RuleID] = rc
+	}
+	if rc := byID["APSS-001"]; rc.Matches != 2 || !rc.EverMatched || rc.LastFiredAt == nil {
+		t.Errorf("APSS-001 coverage = %+v", rc)
+	}
+	if rc := byID[MonitorCrashRuleID]; rc == nil || rc.Matches != 1 || rc.Fixtures != 0 {
+		t.Errorf("controller rule coverage = %+v", rc)
+	}
+}
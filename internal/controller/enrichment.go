@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ErrInvalidEnrichment is returned when an enrichment names no target, two
+// targets, or an unknown verdict or severity.
+var ErrInvalidEnrichment = errors.New("invalid enrichment")
+
+var enrichmentsReceived = newCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_sweetsecurity_enrichments_total",
+		Help: "Total enrichments pushed back by Sweet Security, by verdict and whether they escalated severity",
+	},
+	[]string{"verdict", "escalated"},
+)
+
+func init() {
+	prometheus.MustRegister(enrichmentsReceived)
+}
+
+// ApplyEnrichment attaches e to its alert or incident and raises their
+// severity as its verdict demands. An incident's enrichment is also applied
+// to the incident's retained alerts, so escalated alerts reach the
+// notification sinks again. It returns e as stored.
+func (c *Controller) ApplyEnrichment(e types.Enrichment) (*types.Enrichment, error) {
+	if (e.AlertID == "") == (e.IncidentID == "") {
+		return nil, fmt.Errorf("%w: set exactly one of alert_id and incident_id", ErrInvalidEnrichment)
+	}
+	if !types.ValidVerdict(e.Verdict) {
+		return nil, fmt.Errorf("%w: unknown verdict %q", ErrInvalidEnrichment, e.Verdict)
+	}
+	if e.Severity != "" && types.SeverityRank(e.Severity) == 0 {
+		return nil, fmt.Errorf("%w: unknown severity %q", ErrInvalidEnrichment, e.Severity)
+	}
+	e.ReceivedAt = time.Now()
+	e.EscalatedFrom = ""
+
+	var err error
+	if e.AlertID != "" {
+		e, err = c.enrichAlert(e.AlertID, e)
+	} else {
+		e, err = c.enrichIncident(e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	enrichmentsReceived.WithLabelValues(e.Verdict, fmt.Sprint(e.EscalatedFrom != "")).Inc()
+	c.log.WithFields(logrus.Fields{
+		"alert_id": e.AlertID, "incident_id": e.IncidentID, "verdict": e.Verdict,
+		"indicator": e.Indicator, "escalated_from": e.EscalatedFrom,
+	}).Info("Sweet Security enrichment applied")
+	return &e, nil
+}
+
+// enrichAlert attaches e to alert id, escalating it if needed, and returns e
+// with EscalatedFrom set when it did. Like UpdateAlert it replaces the alert
+// rather than mutating it.
+func (c *Controller) enrichAlert(id string, e types.Enrichment) (types.Enrichment, error) {
+	c.alertsMu.Lock()
+	i := c.alertIndex(id)
+	if i < 0 {
+		c.alertsMu.Unlock()
+		return e, ErrAlertNotFound
+	}
+	updated := *c.alerts[i]
+	if sev := e.EscalatedSeverity(updated.Severity); sev != updated.Severity {
+		e.EscalatedFrom = updated.Severity
+		updated.Severity = sev
+	}
+	updated.Enrichments = append(append([]types.Enrichment(nil), updated.Enrichments...), e)
+	now := time.Now()
+	updated.UpdatedAt = &now
+	c.alerts[i] = &updated
+	c.alertsMu.Unlock()
+	c.storeAlert(&updated)
+
+	if c.elastic != nil {
+		c.elastic.IndexAlert(updated.ID, updated.Timestamp, &updated)
+	}
+	if e.EscalatedFrom != "" {
+		c.log.WithFields(logrus.Fields{
+			"alert_id": id, "from": e.EscalatedFrom, "to": updated.Severity, "verdict": e.Verdict,
+		}).Warn("Alert escalated by Sweet Security")
+		if c.notifier != nil {
+			c.notifier.Notify(&updated)
+		}
+	}
+	return e, nil
+}
+
+// enrichIncident attaches e to its incident and each of the incident's
+// retained alerts, escalating them independently.
+func (c *Controller) enrichIncident(e types.Enrichment) (types.Enrichment, error) {
+	incident, err := c.GetIncident(e.IncidentID)
+	if err != nil {
+		return e, err
+	}
+	updated := *incident
+	if sev := e.EscalatedSeverity(updated.Severity); sev != updated.Severity {
+		e.EscalatedFrom = updated.Severity
+		updated.Severity = sev
+	}
+	updated.Enrichments = append(append([]types.Enrichment(nil), updated.Enrichments...), e)
+	c.replaceIncident(&updated)
+
+	// Alerts already trimmed by retention are skipped.
+	for _, alertID := range updated.AlertIDs {
+		forAlert := e
+		forAlert.EscalatedFrom = ""
+		c.enrichAlert(alertID, forAlert)
+	}
+	return e, nil
+}
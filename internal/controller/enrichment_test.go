@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_ApplyEnrichment_Alert(t *testing.T) {
+	posted := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posted <- string(body)
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "webhooks.yaml")
+	os.WriteFile(file, []byte(`webhooks:
+  - name: oncall
+    url: `+srv.URL+`
+    severities: [CRITICAL]
+    body: '{{ .ID }} {{ .Severity }}'
+`), 0o600)
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, WebhookSinksFile: file}, logrus.New())
+	c.alerts = append(c.alerts, &types.Alert{ID: "a1", Severity: "MEDIUM", Status: types.AlertStatusOpen})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+	before, _ := c.GetAlert("a1")
+
+	got, err := c.ApplyEnrichment(types.Enrichment{AlertID: "a1", Verdict: types.VerdictBenign, Summary: "known scanner"})
+	if err != nil {
+		t.Fatalf("ApplyEnrichment benign: %v", err)
+	}
+	if got.EscalatedFrom != "" || got.ReceivedAt.IsZero() {
+		t.Errorf("benign enrichment = %+v", got)
+	}
+
+	got, err = c.ApplyEnrichment(types.Enrichment{AlertID: "a1", Verdict: types.VerdictMalicious, Indicator: "203.0.113.9"})
+	if err != nil {
+		t.Fatalf("ApplyEnrichment malicious: %v", err)
+	}
+	if got.EscalatedFrom != "MEDIUM" {
+		t.Errorf("escalated_from = %q, want MEDIUM", got.EscalatedFrom)
+	}
+	alert, _ := c.GetAlert("a1")
+	if alert.Severity != "CRITICAL" || len(alert.Enrichments) != 2 || alert.Enrichments[1].Indicator != "203.0.113.9" {
+		t.Errorf("enriched alert = %+v", alert)
+	}
+	if before.Severity != "MEDIUM" || len(before.Enrichments) != 0 {
+		t.Error("previously returned alert pointer must not be mutated")
+	}
+	select {
+	case body := <-posted:
+		if body != "a1 CRITICAL" {
+			t.Errorf("posted %q", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("escalated alert not notified")
+	}
+
+	// A lower assessment never downgrades the alert.
+	if got, _ := c.ApplyEnrichment(types.Enrichment{AlertID: "a1", Verdict: types.VerdictSuspicious, Severity: "LOW"}); got.EscalatedFrom != "" {
+		t.Errorf("suspicious enrichment escalated from %q", got.EscalatedFrom)
+	}
+	if alert, _ := c.GetAlert("a1"); alert.Severity != "CRITICAL" {
+		t.Errorf("severity = %s after a lower assessment", alert.Severity)
+	}
+}
+
+func TestController_ApplyEnrichment_Incident(t *testing.T) {
+	c := newTestControllerWithAlerts(t, &types.Alert{ID: "a1", Severity: "HIGH", IncidentID: "inc-1"})
+	c.recordIncident(&types.Incident{ID: "inc-1", Severity: "HIGH", AlertIDs: []string{"a1", "trimmed"}})
+
+	got, err := c.ApplyEnrichment(types.Enrichment{IncidentID: "inc-1", Verdict: types.VerdictMalicious, FindingID: "f-9"})
+	if err != nil {
+		t.Fatalf("ApplyEnrichment: %v", err)
+	}
+	if got.EscalatedFrom != "HIGH" {
+		t.Errorf("escalated_from = %q, want HIGH", got.EscalatedFrom)
+	}
+	incident, _ := c.GetIncident("inc-1")
+	if incident.Severity != "CRITICAL" || len(incident.Enrichments) != 1 {
+		t.Errorf("enriched incident = %+v", incident)
+	}
+	alert, _ := c.GetAlert("a1")
+	if alert.Severity != "CRITICAL" || len(alert.Enrichments) != 1 || alert.Enrichments[0].EscalatedFrom != "HIGH" {
+		t.Errorf("incident alert = %+v", alert)
+	}
+}
+
+func TestController_ApplyEnrichment_Errors(t *testing.T) {
+	c := newTestControllerWithAlerts(t, &types.Alert{ID: "a1", Severity: "LOW"})
+
+	invalid := []types.Enrichment{
+		{Verdict: types.VerdictMalicious},
+		{AlertID: "a1", IncidentID: "inc-1", Verdict: types.VerdictMalicious},
+		{AlertID: "a1", Verdict: "confirmed"},
+		{AlertID: "a1", Verdict: types.VerdictSuspicious, Severity: "SEVERE"},
+	}
+	for _, e := range invalid {
+		if _, err := c.ApplyEnrichment(e); !errors.Is(err, ErrInvalidEnrichment) {
+			t.Errorf("ApplyEnrichment(%+v): err = %v", e, err)
+		}
+	}
+	if _, err := c.ApplyEnrichment(types.Enrichment{AlertID: "nope", Verdict: types.VerdictBenign}); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("unknown alert: err = %v", err)
+	}
+	if _, err := c.ApplyEnrichment(types.Enrichment{IncidentID: "nope", Verdict: types.VerdictBenign}); !errors.Is(err, ErrIncidentNotFound) {
+		t.Errorf("unknown incident: err = %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package controller
+
+import "github.com/invisible-tech/autopilot-security-sensor/internal/types"
+
+// ExportPage is a run of retained alerts or events read from a cursor.
+// Cursors count every record ever retained, so they stay valid as older
+// records are trimmed.
+type ExportPage[T any] struct {
+	Items []T
+	// Next is the cursor to pass to resume after the last record examined.
+	Next int64
+	// Truncated is set when records between the requested cursor and the
+	// oldest retained one have already been dropped by retention.
+	Truncated bool
+}
+
+// exportPage selects up to limit matching items (all when limit <= 0)
+// starting at cursor. items[0] has cursor dropped.
+func exportPage[T any](items []T, dropped, cursor int64, limit int, match func(T) bool) ExportPage[T] {
+	page := ExportPage[T]{Items: []T{}}
+	if cursor < dropped {
+		// Starting from 0 on a trimmed history is a fresh export, not a gap.
+		page.Truncated = cursor > 0
+		cursor = dropped
+	}
+	i := min(int(cursor-dropped), len(items))
+	for ; i < len(items); i++ {
+		if limit > 0 && len(page.Items) == limit {
+			break
+		}
+		if match(items[i]) {
+			page.Items = append(page.Items, items[i])
+		}
+	}
+	page.Next = dropped + int64(i)
+	return page
+}
+
+// ExportAlerts returns copies of retained alerts selected by filter, oldest
+// first, starting at cursor. The filter's sort and paging fields are ignored.
+func (c *Controller) ExportAlerts(cursor int64, limit int, filter types.AlertFilter) ExportPage[types.Alert] {
+	c.alertsMu.RLock()
+	defer c.alertsMu.RUnlock()
+	page := exportPage(c.alerts, c.alertsDropped, cursor, limit, filter.Matches)
+	out := ExportPage[types.Alert]{Items: make([]types.Alert, len(page.Items)), Next: page.Next, Truncated: page.Truncated}
+	for i, a := range page.Items {
+		out.Items[i] = *a
+	}
+	return out
+}
+
+// ExportEvents returns retained events selected by match, oldest first,
+// starting at cursor.
+func (c *Controller) ExportEvents(cursor int64, limit int, match func(*types.SecurityEvent) bool) ExportPage[*types.SecurityEvent] {
+	c.eventsMu.RLock()
+	defer c.eventsMu.RUnlock()
+	return exportPage(c.events, c.eventsDropped, cursor, limit, match)
+}
+
+// retainEvent keeps event for export, trimming the oldest beyond
+// EventRetentionCount.
+func (c *Controller) retainEvent(event *types.SecurityEvent) {
+	if c.cfg.EventRetentionCount <= 0 {
+		return
+	}
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	c.searchIndex.Add(c.eventsDropped+int64(len(c.events)), searchEventFields(event))
+	c.events = append(c.events, event)
+	if len(c.events) > c.cfg.EventRetentionCount {
+		drop := len(c.events) - c.cfg.EventRetentionCount
+		for i, e := range c.events[:drop] {
+			c.searchIndex.Remove(c.eventsDropped+int64(i), searchEventFields(e))
+		}
+		c.events = c.events[drop:]
+		c.eventsDropped += int64(drop)
+	}
+}
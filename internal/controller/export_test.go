@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestExportPage(t *testing.T) {
+	items := []int{10, 11, 12, 13, 14} // cursors 10..14
+	even := func(n int) bool { return n%2 == 0 }
+	all := func(int) bool { return true }
+
+	p := exportPage(items, 10, 0, 0, all)
+	if len(p.Items) != 5 || p.Next != 15 || p.Truncated {
+		t.Errorf("fresh export = %+v", p)
+	}
+	p = exportPage(items, 10, 5, 0, all)
+	if len(p.Items) != 5 || !p.Truncated {
+		t.Errorf("resume into trimmed history = %+v", p)
+	}
+	p = exportPage(items, 10, 11, 2, even)
+	if len(p.Items) != 2 || p.Items[0] != 12 || p.Items[1] != 14 || p.Next != 15 {
+		t.Errorf("filtered page = %+v", p)
+	}
+	p = exportPage(items, 10, 10, 2, all)
+	if len(p.Items) != 2 || p.Next != 12 {
+		t.Errorf("limited page = %+v", p)
+	}
+	p = exportPage(items, 10, 99, 0, all)
+	if len(p.Items) != 0 || p.Next != 15 {
+		t.Errorf("cursor past the end = %+v", p)
+	}
+}
+
+func TestRetainEvent_Trims(t *testing.T) {
+	c := New(config.ControllerConfig{EventRetentionCount: 3}, logrus.New())
+	for _, id := range []string{"e0", "e1", "e2", "e3", "e4"} {
+		c.retainEvent(&types.SecurityEvent{ID: id})
+	}
+	all := func(*types.SecurityEvent) bool { return true }
+	p := c.ExportEvents(0, 0, all)
+	if len(p.Items) != 3 || p.Items[0].ID != "e2" || p.Next != 5 {
+		t.Errorf("export after trim = %d items, first %q, next %d", len(p.Items), p.Items[0].ID, p.Next)
+	}
+	if p := c.ExportEvents(1, 0, all); !p.Truncated {
+		t.Error("resuming at a trimmed cursor should report truncation")
+	}
+
+	c = New(config.ControllerConfig{}, logrus.New())
+	c.retainEvent(&types.SecurityEvent{ID: "e0"})
+	if p := c.ExportEvents(0, 0, all); len(p.Items) != 0 {
+		t.Error("retention disabled should keep no events")
+	}
+}
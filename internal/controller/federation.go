@@ -0,0 +1,377 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	// federationTimeout bounds one report to the central controller.
+	federationTimeout = 15 * time.Second
+	// federationMaxBatches bounds the reports sent back to back to catch up
+	// on a backlog, so a long outage drains over several intervals.
+	federationMaxBatches = 10
+	// federationStaleIntervals missed reports make a cluster stale.
+	federationStaleIntervals = 3
+)
+
+var (
+	// ErrFederationDisabled is returned by the central controller APIs when
+	// FederationCentral is off.
+	ErrFederationDisabled = errors.New("federation is not enabled on this controller")
+	// ErrInvalidFederationReport is returned for a report without a
+	// cluster name.
+	ErrInvalidFederationReport = errors.New("invalid federation report")
+)
+
+var (
+	federationReports = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_federation_reports_total",
+			Help: "Reports an edge controller sent to the central controller, by result (ok or error)",
+		},
+		[]string{"result"},
+	)
+	federationAlertsReceived = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_federation_alerts_received_total",
+			Help: "New alerts the central controller received from edge controllers, by cluster",
+		},
+		[]string{"cluster"},
+	)
+	federationClusters = newGauge(prometheus.GaugeOpts{
+		Name: "apss_federation_clusters",
+		Help: "Edge clusters that have reported to the central controller",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(federationReports, federationAlertsReceived, federationClusters)
+}
+
+// federationEdge sends this controller's reports to the central controller.
+// cursor is the export cursor of the next alert to send; it is saved with
+// the state, so a restart does not resend everything.
+type federationEdge struct {
+	client *http.Client
+	url    string
+	cursor atomic.Int64
+}
+
+// federationHub is the central controller's record of the edge clusters and
+// their alerts, consolidated by rule and workload.
+type federationHub struct {
+	retention time.Duration
+
+	mu       sync.Mutex
+	clusters map[string]*types.ClusterSummary
+	alerts   map[string]*types.FederatedAlert
+	// seen holds when each cluster/alert ID was received, so an edge
+	// resending a report it got no answer to is not counted twice.
+	seen map[string]time.Time
+}
+
+func newFederationHub(retention time.Duration) *federationHub {
+	return &federationHub{
+		retention: retention,
+		clusters:  make(map[string]*types.ClusterSummary),
+		alerts:    make(map[string]*types.FederatedAlert),
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// initFederation sets up reporting to a central controller, receiving
+// reports as one, or both, as tiers of federation may.
+func (c *Controller) initFederation() {
+	if c.cfg.FederationCentral {
+		c.fedHub = newFederationHub(c.cfg.FederationRetention)
+		c.log.Info("Accepting federation reports from edge controllers")
+	}
+	if c.cfg.FederationEndpoint == "" {
+		return
+	}
+	if c.cfg.ClusterName == "" {
+		c.log.Error("FEDERATION_ENDPOINT needs CLUSTER_NAME to tell this cluster apart, federation disabled")
+		return
+	}
+	transport, ok := c.egressTransport("federation", c.cfg.FederationEgress)
+	if !ok {
+		return
+	}
+	c.fedEdge = &federationEdge{
+		client: &http.Client{Timeout: federationTimeout, Transport: transport},
+		url:    c.cfg.FederationEndpoint + "/api/v1/federation",
+	}
+	c.log.WithFields(logrus.Fields{"endpoint": c.cfg.FederationEndpoint, "cluster": c.cfg.ClusterName}).Info("Reporting to central controller")
+}
+
+// runFederation reports to the central controller every FederationInterval.
+func (c *Controller) runFederation(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.FederationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.reportFederation(ctx)
+		}
+	}
+}
+
+// reportFederation sends the agent counts and the alerts retained since the
+// last accepted report, in batches until they are all sent or a send fails.
+// Alerts are resent until the central controller accepts them.
+func (c *Controller) reportFederation(ctx context.Context) {
+	for i := 0; i < federationMaxBatches; i++ {
+		report, next := c.federationReport(time.Now())
+		if err := c.sendFederationReport(ctx, report); err != nil {
+			federationReports.WithLabelValues("error").Inc()
+			c.log.WithError(err).Warn("Failed to report to central controller")
+			return
+		}
+		federationReports.WithLabelValues("ok").Inc()
+		c.fedEdge.cursor.Store(next)
+		if len(report.Alerts) < c.cfg.FederationBatchSize || c.cfg.FederationBatchSize <= 0 {
+			return
+		}
+	}
+}
+
+// federationReport builds the next report and returns the cursor to resume
+// from once it is accepted.
+func (c *Controller) federationReport(now time.Time) (*types.FederationReport, int64) {
+	agents := make(map[string]int)
+	for _, a := range c.GetAgents() {
+		agents[a.Status]++
+	}
+	page := c.ExportAlerts(c.fedEdge.cursor.Load(), c.cfg.FederationBatchSize, types.AlertFilter{})
+	return &types.FederationReport{
+		ClusterName: c.cfg.ClusterName,
+		Environment: c.cfg.Environment,
+		SentAt:      now,
+		Interval:    c.cfg.FederationInterval.String(),
+		Agents:      agents,
+		Alerts:      page.Items,
+		Truncated:   page.Truncated,
+	}, page.Next
+}
+
+func (c *Controller) sendFederationReport(ctx context.Context, report *types.FederationReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal federation report: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.fedEdge.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create federation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.FederationToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.FederationToken)
+	}
+	resp, err := c.fedEdge.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send federation report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("central controller returned %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// ReceiveFederationReport records an edge controller's report on the
+// central controller.
+func (c *Controller) ReceiveFederationReport(report *types.FederationReport) (*types.FederationAck, error) {
+	if c.fedHub == nil {
+		return nil, ErrFederationDisabled
+	}
+	if report.ClusterName == "" {
+		return nil, fmt.Errorf("%w: cluster_name is required", ErrInvalidFederationReport)
+	}
+	report.ClusterName = c.interner.intern(report.ClusterName)
+	report.Environment = c.interner.intern(report.Environment)
+	for i := range report.Alerts {
+		c.interner.alert(&report.Alerts[i])
+	}
+	ack := c.fedHub.receive(report, time.Now())
+	if ack.Accepted > 0 {
+		federationAlertsReceived.WithLabelValues(report.ClusterName).Add(float64(ack.Accepted))
+	}
+	if report.Truncated {
+		c.log.WithField("cluster", report.ClusterName).Warn("Edge controller trimmed alerts before reporting them")
+	}
+	return ack, nil
+}
+
+func (h *federationHub) receive(report *types.FederationReport, now time.Time) *types.FederationAck {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pruneLocked(now)
+
+	sum := h.clusters[report.ClusterName]
+	if sum == nil {
+		sum = &types.ClusterSummary{ClusterName: report.ClusterName, FirstReport: now, Alerts: make(map[string]int)}
+		h.clusters[report.ClusterName] = sum
+		federationClusters.Set(float64(len(h.clusters)))
+	}
+	sum.Environment = report.Environment
+	sum.LastReport = now
+	sum.Interval = report.Interval
+	sum.Agents = report.Agents
+	sum.AgentsTotal = 0
+	for _, n := range report.Agents {
+		sum.AgentsTotal += n
+	}
+	if report.Truncated {
+		sum.Gaps++
+	}
+
+	ack := &types.FederationAck{}
+	for i := range report.Alerts {
+		alert := report.Alerts[i]
+		key := report.ClusterName + "/" + alert.ID
+		if _, dup := h.seen[key]; dup {
+			ack.Duplicate++
+			continue
+		}
+		h.seen[key] = now
+		ack.Accepted++
+		if alert.ClusterName == "" {
+			alert.ClusterName = report.ClusterName
+		}
+		if alert.Environment == "" {
+			alert.Environment = report.Environment
+		}
+		sum.Alerts[alert.Severity]++
+		h.addLocked(&alert)
+	}
+	return ack
+}
+
+// addLocked folds alert into its consolidated alert.
+func (h *federationHub) addLocked(alert *types.Alert) {
+	workload := alert.PodName
+	if k := alert.Kubernetes; k != nil && k.OwnerName != "" {
+		workload = k.OwnerKind + "/" + k.OwnerName
+	}
+	fp := alert.RuleID + "|" + alert.PodNS + "|" + workload
+	fa := h.alerts[fp]
+	if fa == nil {
+		fa = &types.FederatedAlert{
+			Fingerprint: fp,
+			RuleID:      alert.RuleID,
+			Namespace:   alert.PodNS,
+			Workload:    workload,
+			FirstSeen:   alert.Timestamp,
+		}
+		h.alerts[fp] = fa
+	}
+	fa.Count++
+	if i := sort.SearchStrings(fa.Clusters, alert.ClusterName); i == len(fa.Clusters) || fa.Clusters[i] != alert.ClusterName {
+		fa.Clusters = append(fa.Clusters[:i], append([]string{alert.ClusterName}, fa.Clusters[i:]...)...)
+	}
+	if types.SeverityRank(alert.Severity) > types.SeverityRank(fa.Severity) {
+		fa.Severity = alert.Severity
+	}
+	if alert.Timestamp.Before(fa.FirstSeen) {
+		fa.FirstSeen = alert.Timestamp
+	}
+	if fa.Latest == nil || !alert.Timestamp.Before(fa.LastSeen) {
+		fa.Latest = alert
+		fa.LastSeen = alert.Timestamp
+		fa.RuleName = alert.RuleName
+	}
+}
+
+// pruneLocked forgets consolidated alerts that last fired, and alert IDs
+// received, over the retention ago.
+func (h *federationHub) pruneLocked(now time.Time) {
+	if h.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-h.retention)
+	for fp, fa := range h.alerts {
+		if fa.LastSeen.Before(cutoff) {
+			delete(h.alerts, fp)
+		}
+	}
+	for key, at := range h.seen {
+		if at.Before(cutoff) {
+			delete(h.seen, key)
+		}
+	}
+}
+
+// FederationClusters returns the edge clusters that have reported, sorted
+// by name.
+func (c *Controller) FederationClusters() ([]types.ClusterSummary, error) {
+	h := c.fedHub
+	if h == nil {
+		return nil, ErrFederationDisabled
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]types.ClusterSummary, 0, len(h.clusters))
+	for _, sum := range h.clusters {
+		cp := *sum
+		if interval, err := time.ParseDuration(sum.Interval); err == nil && interval > 0 {
+			cp.Stale = now.Sub(sum.LastReport) > federationStaleIntervals*interval
+		}
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ClusterName < out[j].ClusterName })
+	return out, nil
+}
+
+// FederatedAlerts returns the page of consolidated alerts selected by
+// filter, most recently fired first, and the number matching before paging.
+func (c *Controller) FederatedAlerts(filter types.FederatedAlertFilter) ([]types.FederatedAlert, int, error) {
+	h := c.fedHub
+	if h == nil {
+		return nil, 0, ErrFederationDisabled
+	}
+	h.mu.Lock()
+	var matched []types.FederatedAlert
+	for _, fa := range h.alerts {
+		if filter.Matches(fa) {
+			cp := *fa
+			cp.Clusters = append([]string(nil), fa.Clusters...)
+			matched = append(matched, cp)
+		}
+	}
+	h.mu.Unlock()
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].LastSeen.Equal(matched[j].LastSeen) {
+			return matched[i].LastSeen.After(matched[j].LastSeen)
+		}
+		return matched[i].Fingerprint < matched[j].Fingerprint
+	})
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []types.FederatedAlert{}, total, nil
+	}
+	page := matched[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(page) {
+		page = page[:filter.Limit]
+	}
+	return page, total, nil
+}
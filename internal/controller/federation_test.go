@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_ReceiveFederationReport(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	if _, err := c.ReceiveFederationReport(&types.FederationReport{ClusterName: "eu-1"}); !errors.Is(err, ErrFederationDisabled) {
+		t.Fatalf("receive without FederationCentral: %v", err)
+	}
+
+	c = New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, FederationCentral: true}, logrus.New())
+	if _, err := c.ReceiveFederationReport(&types.FederationReport{}); !errors.Is(err, ErrInvalidFederationReport) {
+		t.Errorf("report without a cluster: %v", err)
+	}
+
+	now := time.Now()
+	owner := &types.KubeMetadata{OwnerKind: "Deployment", OwnerName: "api"}
+	shell := func(id, pod, severity string, at time.Time) types.Alert {
+		return types.Alert{ID: id, RuleID: "APSS-001", RuleName: "Reverse Shell", Severity: severity,
+			PodName: pod, PodNS: "payments", Kubernetes: owner, Timestamp: at}
+	}
+	eu := &types.FederationReport{
+		ClusterName: "eu-1", Environment: "prod", Interval: "30s",
+		Agents: map[string]int{types.AgentStatusHealthy: 3, types.AgentStatusDegraded: 1},
+		Alerts: []types.Alert{shell("a1", "api-x", "HIGH", now.Add(-time.Minute))},
+	}
+	ack, err := c.ReceiveFederationReport(eu)
+	if err != nil || ack.Accepted != 1 || ack.Duplicate != 0 {
+		t.Fatalf("first report: %+v, %v", ack, err)
+	}
+	// A resent report is not counted twice.
+	if ack, _ = c.ReceiveFederationReport(eu); ack.Accepted != 0 || ack.Duplicate != 1 {
+		t.Errorf("resent report: %+v", ack)
+	}
+	// The same workload in another cluster is the same consolidated alert.
+	_, err = c.ReceiveFederationReport(&types.FederationReport{
+		ClusterName: "us-1", Interval: "30s",
+		Alerts: []types.Alert{shell("a1", "api-y", "CRITICAL", now), {ID: "a2", RuleID: "APSS-002", PodName: "db-0", PodNS: "data", Timestamp: now.Add(-time.Second)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, total, _ := c.FederatedAlerts(types.FederatedAlertFilter{RuleID: "APSS-001"})
+	if total != 1 || len(alerts) != 1 {
+		t.Fatalf("consolidated alerts = %d", total)
+	}
+	fa := alerts[0]
+	if fa.Workload != "Deployment/api" || fa.Count != 2 || fa.Severity != "CRITICAL" ||
+		len(fa.Clusters) != 2 || fa.Clusters[0] != "eu-1" || fa.Latest.ClusterName != "us-1" {
+		t.Errorf("consolidated alert = %+v", fa)
+	}
+	if _, total, _ = c.FederatedAlerts(types.FederatedAlertFilter{Cluster: "eu-1"}); total != 1 {
+		t.Errorf("eu-1 alerts = %d, want 1", total)
+	}
+	if page, total, _ := c.FederatedAlerts(types.FederatedAlertFilter{Limit: 1, Offset: 1}); total != 2 || len(page) != 1 || page[0].RuleID != "APSS-002" {
+		t.Errorf("second page = %+v of %d", page, total)
+	}
+
+	clusters, _ := c.FederationClusters()
+	if len(clusters) != 2 || clusters[0].ClusterName != "eu-1" || clusters[0].AgentsTotal != 4 ||
+		clusters[0].Alerts["HIGH"] != 1 || clusters[0].Stale {
+		t.Errorf("clusters = %+v", clusters)
+	}
+	c.fedHub.clusters["eu-1"].LastReport = now.Add(-2 * time.Minute)
+	if clusters, _ = c.FederationClusters(); !clusters[0].Stale || clusters[1].Stale {
+		t.Errorf("stale = %v, %v; want eu-1 only", clusters[0].Stale, clusters[1].Stale)
+	}
+}
+
+func TestController_ReportFederation(t *testing.T) {
+	central := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, FederationCentral: true}, logrus.New())
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail || r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var report types.FederationReport
+		json.NewDecoder(r.Body).Decode(&report)
+		ack, err := central.ReceiveFederationReport(&report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(ack)
+	}))
+	defer srv.Close()
+
+	edge := newTestControllerWithAlerts(t,
+		&types.Alert{ID: "a1", RuleID: "APSS-001", Severity: "HIGH", Timestamp: time.Now()},
+		&types.Alert{ID: "a2", RuleID: "APSS-002", Severity: "LOW", Timestamp: time.Now()},
+		&types.Alert{ID: "a3", RuleID: "APSS-003", Severity: "LOW", Timestamp: time.Now()},
+	)
+	edge.cfg.ClusterName = "eu-1"
+	edge.cfg.FederationEndpoint = srv.URL
+	edge.cfg.FederationToken = "s3cret"
+	edge.cfg.FederationInterval = time.Minute
+	edge.cfg.FederationBatchSize = 2
+	edge.initFederation()
+
+	fail = true
+	edge.reportFederation(context.Background())
+	if edge.fedEdge.cursor.Load() != 0 {
+		t.Fatal("failed report advanced the cursor")
+	}
+	fail = false
+	edge.reportFederation(context.Background())
+	if got := edge.fedEdge.cursor.Load(); got != 3 {
+		t.Errorf("cursor = %d, want 3", got)
+	}
+	if _, total, _ := central.FederatedAlerts(types.FederatedAlertFilter{}); total != 3 {
+		t.Errorf("central has %d alerts, want 3", total)
+	}
+	clusters, _ := central.FederationClusters()
+	if len(clusters) != 1 || clusters[0].ClusterName != "eu-1" || clusters[0].Interval != "1m0s" {
+		t.Errorf("clusters = %+v", clusters)
+	}
+}
@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+var (
+	// ErrGraphDisabled is returned by graph queries when GraphRetention is 0.
+	ErrGraphDisabled = errors.New("entity graph disabled")
+	// ErrGraphNodeNotFound is returned when a neighborhood query starts
+	// from a node that is not in the graph.
+	ErrGraphNodeNotFound = errors.New("graph node not found")
+)
+
+const (
+	// graphSweepInterval is how often nodes and edges older than the
+	// retention are dropped.
+	graphSweepInterval = time.Minute
+	// maxEdgeEventIDs and maxEdgePorts bound what one edge remembers.
+	maxEdgeEventIDs = 5
+	maxEdgePorts    = 16
+	// maxCmdlineAttr truncates the cmdline attribute of process nodes.
+	maxCmdlineAttr = 256
+)
+
+// graphNode is a node with the keys of its edges in both directions.
+type graphNode struct {
+	types.GraphNode
+	edges map[string]bool
+}
+
+// entityGraph links the pods, processes, destinations, files and hashes
+// named in events. It is fed from processEvents and read by the API, so mu
+// guards it.
+type entityGraph struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	maxNodes  int
+	nodes     map[string]*graphNode
+	edges     map[string]*types.GraphEdge
+	lastSweep time.Time
+}
+
+func newEntityGraph(retention time.Duration, maxNodes int) *entityGraph {
+	return &entityGraph{
+		retention: retention,
+		maxNodes:  maxNodes,
+		nodes:     make(map[string]*graphNode),
+		edges:     make(map[string]*types.GraphEdge),
+	}
+}
+
+func edgeKey(from, to, kind string) string { return from + "\x00" + to + "\x00" + kind }
+
+func processNodeID(ns, pod string, pid int, name string) string {
+	return types.GraphNodeProcess + ":" + podKey(ns, pod) + "/" + strconv.Itoa(pid) + "/" + name
+}
+
+// recordGraph adds the entities of an event and their relations to the
+// entity graph. A connection to another pod's IP links to that pod.
+func (c *Controller) recordGraph(event *types.SecurityEvent) {
+	g := c.graph
+	if g == nil || event.PodName == "" {
+		return
+	}
+	var dstPod *types.PodRef
+	if n := event.Network; n != nil && n.DstIP != "" {
+		if pod, ok := c.podByIP(n.DstIP); ok {
+			dstPod = &pod
+		}
+	}
+	g.observe(event, dstPod, time.Now())
+}
+
+func (g *entityGraph) observe(e *types.SecurityEvent, dstPod *types.PodRef, now time.Time) {
+	at := eventTime(e)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ns, name := e.PodNamespace, e.PodName
+	pod := g.podNode(ns, name, e, at)
+	subject := pod
+	if p := e.Process; p != nil && p.PID > 0 {
+		proc := g.node(processNodeID(ns, name, p.PID, p.Name), types.GraphNodeProcess, p.Name, e, at)
+		proc.Attributes["pid"] = strconv.Itoa(p.PID)
+		proc.Attributes["pod"] = podKey(ns, name)
+		if p.ExePath != "" {
+			proc.Attributes["exe_path"] = p.ExePath
+		}
+		if cmdline := strings.Join(p.Cmdline, " "); cmdline != "" {
+			if len(cmdline) > maxCmdlineAttr {
+				cmdline = cmdline[:maxCmdlineAttr]
+			}
+			proc.Attributes["cmdline"] = cmdline
+		}
+		g.link(pod, proc, types.GraphEdgeRuns, e, at, 0)
+		if len(p.Ancestors) > 0 {
+			a := p.Ancestors[0]
+			parent := g.node(processNodeID(ns, name, a.PID, a.Name), types.GraphNodeProcess, a.Name, nil, at)
+			parent.Attributes["pid"] = strconv.Itoa(a.PID)
+			parent.Attributes["pod"] = podKey(ns, name)
+			g.link(pod, parent, types.GraphEdgeRuns, e, at, 0)
+			g.link(parent, proc, types.GraphEdgeSpawned, e, at, 0)
+		}
+		if p.ExeHash != "" {
+			g.link(proc, g.hashNode(p.ExeHash, e, at), types.GraphEdgeHashes, e, at, 0)
+		}
+		subject = proc
+	}
+	if n := e.Network; n != nil {
+		switch {
+		case dstPod != nil:
+			// The destination pod's agent reports the connection to the
+			// client's ephemeral port; only the client side is an edge.
+			if n.DstPort < ephemeralPortMin {
+				g.link(subject, g.podNode(dstPod.Namespace, dstPod.Name, e, at), types.GraphEdgeConnects, e, at, n.DstPort)
+			}
+		case n.DstIP != "":
+			ip := g.node(types.GraphNodeIP+":"+n.DstIP, types.GraphNodeIP, n.DstIP, e, at)
+			ip.Attributes["external"] = strconv.FormatBool(n.IsExternal)
+			g.link(subject, ip, types.GraphEdgeConnects, e, at, n.DstPort)
+		}
+		if n.Domain != "" {
+			domain := strings.ToLower(strings.TrimSuffix(n.Domain, "."))
+			g.link(subject, g.node(types.GraphNodeDomain+":"+domain, types.GraphNodeDomain, domain, e, at), types.GraphEdgeResolves, e, at, 0)
+		}
+	}
+	if f := e.File; f != nil && f.Path != "" {
+		file := g.node(types.GraphNodeFile+":"+podKey(ns, name)+":"+f.Path, types.GraphNodeFile, f.Path, e, at)
+		file.Attributes["pod"] = podKey(ns, name)
+		if f.Operation != "" {
+			file.Attributes["operation"] = f.Operation
+		}
+		g.link(subject, file, types.GraphEdgeModifies, e, at, 0)
+		if f.NewHash != "" {
+			g.link(file, g.hashNode(f.NewHash, e, at), types.GraphEdgeHashes, e, at, 0)
+		}
+	}
+
+	if now.Sub(g.lastSweep) >= graphSweepInterval {
+		g.lastSweep = now
+		g.sweep(now)
+	}
+	if g.maxNodes > 0 && len(g.nodes) > g.maxNodes {
+		g.evict()
+	}
+}
+
+func (g *entityGraph) podNode(ns, name string, e *types.SecurityEvent, at time.Time) *graphNode {
+	n := g.node(types.GraphNodePod+":"+podKey(ns, name), types.GraphNodePod, podKey(ns, name), e, at)
+	n.Attributes["namespace"] = ns
+	n.Attributes["name"] = name
+	return n
+}
+
+func (g *entityGraph) hashNode(hash string, e *types.SecurityEvent, at time.Time) *graphNode {
+	hash = strings.ToLower(hash)
+	return g.node(types.GraphNodeHash+":"+hash, types.GraphNodeHash, hash, e, at)
+}
+
+// node returns the node with the given ID, creating it, and counts e
+// against it unless e is nil (the node is only inferred from the event).
+// Caller must hold mu.
+func (g *entityGraph) node(id, kind, label string, e *types.SecurityEvent, at time.Time) *graphNode {
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &graphNode{
+			GraphNode: types.GraphNode{ID: id, Kind: kind, Label: label, Attributes: map[string]string{}, FirstSeen: at},
+			edges:     make(map[string]bool),
+		}
+		g.nodes[id] = n
+	}
+	if at.After(n.LastSeen) {
+		n.LastSeen = at
+	}
+	if at.Before(n.FirstSeen) {
+		n.FirstSeen = at
+	}
+	if e != nil {
+		n.EventCount++
+		if types.SeverityRank(e.Severity) > types.SeverityRank(n.Severity) {
+			n.Severity = e.Severity
+		}
+	}
+	return n
+}
+
+// link records an edge from one node to another seen in e. A non-zero
+// port is added to the edge's ports. Caller must hold mu.
+func (g *entityGraph) link(from, to *graphNode, kind string, e *types.SecurityEvent, at time.Time, port int) {
+	key := edgeKey(from.ID, to.ID, kind)
+	edge, ok := g.edges[key]
+	if !ok {
+		edge = &types.GraphEdge{From: from.ID, To: to.ID, Kind: kind, FirstSeen: at}
+		g.edges[key] = edge
+		from.edges[key] = true
+		to.edges[key] = true
+	}
+	if at.After(edge.LastSeen) {
+		edge.LastSeen = at
+	}
+	if at.Before(edge.FirstSeen) {
+		edge.FirstSeen = at
+	}
+	edge.EventCount++
+	if e.ID != "" {
+		edge.EventIDs = append(edge.EventIDs, e.ID)
+		if len(edge.EventIDs) > maxEdgeEventIDs {
+			edge.EventIDs = edge.EventIDs[len(edge.EventIDs)-maxEdgeEventIDs:]
+		}
+	}
+	if port > 0 && len(edge.Ports) < maxEdgePorts {
+		i := sort.SearchInts(edge.Ports, port)
+		if i == len(edge.Ports) || edge.Ports[i] != port {
+			edge.Ports = append(edge.Ports, 0)
+			copy(edge.Ports[i+1:], edge.Ports[i:])
+			edge.Ports[i] = port
+		}
+	}
+}
+
+// sweep drops edges not seen within the retention, then nodes left without
+// edges that were not seen within it either. Caller must hold mu.
+func (g *entityGraph) sweep(now time.Time) {
+	cutoff := now.Add(-g.retention)
+	for key, edge := range g.edges {
+		if edge.LastSeen.Before(cutoff) {
+			g.removeEdge(key)
+		}
+	}
+	for id, n := range g.nodes {
+		if len(n.edges) == 0 && n.LastSeen.Before(cutoff) {
+			delete(g.nodes, id)
+		}
+	}
+}
+
+// evict drops the least recently seen nodes and their edges down to 90% of
+// maxNodes, so eviction does not run on every event. Caller must hold mu.
+func (g *entityGraph) evict() {
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return g.nodes[ids[i]].LastSeen.Before(g.nodes[ids[j]].LastSeen) })
+	for _, id := range ids[:len(ids)-g.maxNodes*9/10] {
+		for key := range g.nodes[id].edges {
+			g.removeEdge(key)
+		}
+		delete(g.nodes, id)
+	}
+}
+
+func (g *entityGraph) removeEdge(key string) {
+	edge := g.edges[key]
+	delete(g.edges, key)
+	if n := g.nodes[edge.From]; n != nil {
+		delete(n.edges, key)
+	}
+	if n := g.nodes[edge.To]; n != nil {
+		delete(n.edges, key)
+	}
+}
+
+// GetGraph returns part of the entity graph: the neighborhood of q.Node,
+// or the most recently seen nodes when it is empty, with the edges between
+// them seen since q.Since.
+func (c *Controller) GetGraph(q types.GraphQuery) (types.Graph, error) {
+	if c.graph == nil {
+		return types.Graph{}, ErrGraphDisabled
+	}
+	return c.graph.query(q)
+}
+
+func (g *entityGraph) query(q types.GraphQuery) (types.Graph, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var (
+		selected  []string
+		truncated bool
+	)
+	visited := make(map[string]bool)
+	if q.Node == "" {
+		for id, n := range g.nodes {
+			if !n.LastSeen.Before(q.Since) {
+				selected = append(selected, id)
+			}
+		}
+		sort.Slice(selected, func(i, j int) bool {
+			a, b := g.nodes[selected[i]], g.nodes[selected[j]]
+			if !a.LastSeen.Equal(b.LastSeen) {
+				return a.LastSeen.After(b.LastSeen)
+			}
+			return a.ID < b.ID
+		})
+		if len(selected) > q.Limit {
+			selected, truncated = selected[:q.Limit], true
+		}
+		for _, id := range selected {
+			visited[id] = true
+		}
+	} else {
+		if _, ok := g.nodes[q.Node]; !ok {
+			return types.Graph{}, ErrGraphNodeNotFound
+		}
+		selected = []string{q.Node}
+		visited[q.Node] = true
+		frontier := selected
+		for depth := 0; depth < q.Depth && len(frontier) > 0; depth++ {
+			var next []string
+			for _, id := range frontier {
+				for _, edge := range g.recentEdges(id, q.Since) {
+					other := edge.To
+					if other == id {
+						other = edge.From
+					}
+					if visited[other] {
+						continue
+					}
+					if len(selected) >= q.Limit {
+						truncated = true
+						continue
+					}
+					visited[other] = true
+					selected = append(selected, other)
+					next = append(next, other)
+				}
+			}
+			frontier = next
+		}
+	}
+
+	out := types.Graph{Nodes: make([]types.GraphNode, 0, len(selected)), Edges: []types.GraphEdge{}, Truncated: truncated}
+	for _, id := range selected {
+		n := g.nodes[id].GraphNode
+		n.Attributes = copyStringMap(n.Attributes)
+		out.Nodes = append(out.Nodes, n)
+		for _, edge := range g.recentEdges(id, q.Since) {
+			// Each edge is added from its From node.
+			if edge.From == id && visited[edge.To] {
+				e := *edge
+				e.Ports = append([]int(nil), edge.Ports...)
+				e.EventIDs = append([]string(nil), edge.EventIDs...)
+				out.Edges = append(out.Edges, e)
+			}
+		}
+	}
+	sort.Slice(out.Edges, func(i, j int) bool {
+		a, b := out.Edges[i], out.Edges[j]
+		if !a.LastSeen.Equal(b.LastSeen) {
+			return a.LastSeen.After(b.LastSeen)
+		}
+		return edgeKey(a.From, a.To, a.Kind) < edgeKey(b.From, b.To, b.Kind)
+	})
+	return out, nil
+}
+
+// recentEdges returns the edges of a node seen since the given time, most
+// recent first. Caller must hold mu.
+func (g *entityGraph) recentEdges(id string, since time.Time) []*types.GraphEdge {
+	var out []*types.GraphEdge
+	for key := range g.nodes[id].edges {
+		if edge := g.edges[key]; !edge.LastSeen.Before(since) {
+			out = append(out, edge)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastSeen.Equal(out[j].LastSeen) {
+			return out[i].LastSeen.After(out[j].LastSeen)
+		}
+		return edgeKey(out[i].From, out[i].To, out[i].Kind) < edgeKey(out[j].From, out[j].To, out[j].Kind)
+	})
+	return out
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func graphIDs(g types.Graph) map[string]bool {
+	ids := make(map[string]bool, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids[n.ID] = true
+	}
+	return ids
+}
+
+func TestEntityGraph_neighborhood(t *testing.T) {
+	g := newEntityGraph(time.Hour, 100)
+	now := time.Now()
+	// curl in web-1 and a miner in batch-1 both reach the same IP; web-1
+	// also connects to db-0.
+	g.observe(&types.SecurityEvent{
+		ID: "e1", Severity: "HIGH", Timestamp: now, PodNamespace: "prod", PodName: "web-1",
+		Process: &types.ProcessEventData{PID: 42, Name: "curl", ExeHash: "ABC", Ancestors: []types.ProcessAncestor{{PID: 7, Name: "sh"}}},
+		Network: &types.NetworkEventData{DstIP: "203.0.113.9", DstPort: 443, IsExternal: true, Domain: "evil.example."},
+	}, nil, now)
+	g.observe(&types.SecurityEvent{
+		ID: "e2", Severity: "CRITICAL", Timestamp: now, PodNamespace: "jobs", PodName: "batch-1",
+		Process: &types.ProcessEventData{PID: 9, Name: "xmrig"},
+		Network: &types.NetworkEventData{DstIP: "203.0.113.9", DstPort: 3333},
+	}, nil, now)
+	g.observe(&types.SecurityEvent{
+		ID: "e3", Severity: "INFO", Timestamp: now, PodNamespace: "prod", PodName: "web-1",
+		Network: &types.NetworkEventData{DstIP: "10.0.0.5", DstPort: 5432},
+	}, &types.PodRef{Namespace: "prod", Name: "db-0"}, now)
+	// db-0's side of the same connection, to web-1's ephemeral port.
+	g.observe(&types.SecurityEvent{
+		ID: "e4", Severity: "INFO", Timestamp: now, PodNamespace: "prod", PodName: "db-0",
+		Network: &types.NetworkEventData{DstIP: "10.0.0.4", DstPort: 51000},
+	}, &types.PodRef{Namespace: "prod", Name: "web-1"}, now)
+	g.observe(&types.SecurityEvent{
+		ID: "e5", Severity: "MEDIUM", Timestamp: now, PodNamespace: "prod", PodName: "web-1",
+		Process: &types.ProcessEventData{PID: 42, Name: "curl"},
+		File:    &types.FileEventData{Path: "/tmp/x", Operation: "create", NewHash: "abc"},
+	}, nil, now)
+
+	got, err := g.query(types.GraphQuery{Node: "ip:203.0.113.9", Depth: 1, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := graphIDs(got)
+	if len(got.Nodes) != 3 || !ids["process:prod/web-1/42/curl"] || !ids["process:jobs/batch-1/9/xmrig"] {
+		t.Errorf("depth 1 nodes = %v, want the IP and both processes", ids)
+	}
+	if len(got.Edges) != 2 || got.Edges[0].Kind != types.GraphEdgeConnects {
+		t.Errorf("depth 1 edges = %+v", got.Edges)
+	}
+
+	got, _ = g.query(types.GraphQuery{Node: "ip:203.0.113.9", Depth: 2, Limit: 100})
+	ids = graphIDs(got)
+	for _, id := range []string{"pod:prod/web-1", "pod:jobs/batch-1", "process:prod/web-1/7/sh", "hash:abc", "domain:evil.example", "file:prod/web-1:/tmp/x"} {
+		if !ids[id] {
+			t.Errorf("depth 2 is missing %s: %v", id, ids)
+		}
+	}
+
+	got, _ = g.query(types.GraphQuery{Node: "pod:prod/web-1", Depth: 1, Limit: 100})
+	var toDB, fromDB bool
+	for _, e := range got.Edges {
+		toDB = toDB || (e.From == "pod:prod/web-1" && e.To == "pod:prod/db-0" && e.Ports[0] == 5432)
+		fromDB = fromDB || e.From == "pod:prod/db-0"
+	}
+	if !toDB || fromDB {
+		t.Errorf("pod edges = %+v, want only web-1 -> db-0", got.Edges)
+	}
+
+	node := g.nodes["hash:abc"]
+	if node.EventCount != 2 || node.Severity != "HIGH" {
+		t.Errorf("hash node = %+v, want 2 events up to HIGH", node.GraphNode)
+	}
+	if n := g.nodes["process:prod/web-1/7/sh"]; n.EventCount != 0 {
+		t.Errorf("inferred parent counted %d events", n.EventCount)
+	}
+
+	if got, _ := g.query(types.GraphQuery{Node: "ip:203.0.113.9", Depth: 3, Limit: 2}); !got.Truncated || len(got.Nodes) != 2 {
+		t.Errorf("limited query = %d nodes, truncated %v", len(got.Nodes), got.Truncated)
+	}
+	if got, _ := g.query(types.GraphQuery{Node: "ip:203.0.113.9", Depth: 1, Limit: 100, Since: now.Add(time.Minute)}); len(got.Nodes) != 1 || len(got.Edges) != 0 {
+		t.Errorf("query since the future = %+v, want the node alone", got)
+	}
+	if _, err := g.query(types.GraphQuery{Node: "ip:198.51.100.1", Depth: 1, Limit: 100}); err != ErrGraphNodeNotFound {
+		t.Errorf("unknown node: err = %v", err)
+	}
+	if got, _ := g.query(types.GraphQuery{Limit: 100}); len(got.Nodes) != len(g.nodes) || len(got.Edges) != len(g.edges) {
+		t.Errorf("whole graph = %d nodes, %d edges; have %d, %d", len(got.Nodes), len(got.Edges), len(g.nodes), len(g.edges))
+	}
+}
+
+func TestEntityGraph_expiry(t *testing.T) {
+	g := newEntityGraph(time.Hour, 4)
+	old := time.Now().Add(-2 * time.Hour)
+	g.observe(&types.SecurityEvent{
+		ID: "e1", Timestamp: old, PodNamespace: "ns", PodName: "old",
+		Network: &types.NetworkEventData{DstIP: "192.0.2.1", DstPort: 80},
+	}, nil, old)
+
+	now := time.Now()
+	g.observe(&types.SecurityEvent{ID: "e2", Timestamp: now, PodNamespace: "ns", PodName: "new"}, nil, now)
+	if _, ok := g.nodes["pod:ns/old"]; ok || len(g.edges) != 0 {
+		t.Errorf("expired entities kept: nodes %v, %d edges", g.nodes, len(g.edges))
+	}
+
+	for i, ip := range []string{"192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5"} {
+		at := now.Add(time.Duration(i+1) * time.Second)
+		g.observe(&types.SecurityEvent{
+			Timestamp: at, PodNamespace: "ns", PodName: "new",
+			Network: &types.NetworkEventData{DstIP: ip, DstPort: 80},
+		}, nil, now)
+	}
+	if len(g.nodes) > 4 {
+		t.Errorf("%d nodes, want at most 4", len(g.nodes))
+	}
+	if _, ok := g.nodes["ip:192.0.2.5"]; !ok {
+		t.Error("most recent node evicted")
+	}
+	for key, edge := range g.edges {
+		if g.nodes[edge.From] == nil || g.nodes[edge.To] == nil {
+			t.Errorf("edge %q outlived its node", key)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// MonitorCrashRuleID identifies alerts raised when an agent monitor crash-loops.
+const MonitorCrashRuleID = "APSS-006"
+
+// monitorStateRunning is the only monitor state an agent reports for a
+// monitor that is working.
+const monitorStateRunning = "running"
+
+var agentsByStatus = newGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "apss_agents_by_status",
+		Help: "Number of tracked agents by derived status",
+	},
+	[]string{"status"},
+)
+
+func init() {
+	prometheus.MustRegister(agentsByStatus)
+}
+
+// RegisterAgent records an agent's startup registration. Registering again
+// (after an agent restart) refreshes version and config hash but keeps the
+// original ConnectedAt and event counters.
+func (c *Controller) RegisterAgent(reg *types.AgentRegistration) error {
+	if reg.AgentID == "" {
+		return fmt.Errorf("registration missing agent_id")
+	}
+	schema := reg.SchemaVersion
+	if schema == "" {
+		schema = types.SchemaVersionV1
+	}
+
+	now := time.Now()
+	c.arrivals[arrivalRegistration].record(now)
+	c.agentsMu.Lock()
+	agent, ok := c.agents[reg.AgentID]
+	if !ok {
+		agent = &types.AgentInfo{ID: reg.AgentID, ConnectedAt: now}
+		c.agents[reg.AgentID] = agent
+	}
+	agent.PodName = reg.PodName
+	agent.PodNamespace = reg.PodNamespace
+	agent.NodeName = reg.NodeName
+	c.setPodIP(agent, reg.PodIP)
+	if agent.Protocol != nil && agent.Version != reg.Version {
+		// Another build registering without a handshake of its own, such
+		// as a rolled back agent, does not negotiate.
+		agent.Protocol = nil
+	}
+	agent.Version = reg.Version
+	agent.ConfigHash = reg.ConfigHash
+	agent.SchemaVersion = schema
+	agent.MonitoringMode = reg.MonitoringMode
+	if reg.Identity != nil {
+		agent.Identity = reg.Identity
+	}
+	agent.ClusterName, agent.Environment = reg.ClusterName, reg.Environment
+	agent.RegisteredAt = &now
+	agent.LastSeen = now
+	monitors := make(map[string]string, len(reg.Monitors))
+	for _, name := range reg.Monitors {
+		monitors[name] = monitorStateRunning
+	}
+	agent.Monitors = monitors
+	c.agentsMu.Unlock()
+
+	c.log.WithFields(logrus.Fields{
+		"agent_id":    reg.AgentID,
+		"pod":         reg.PodName,
+		"namespace":   reg.PodNamespace,
+		"version":     reg.Version,
+		"config_hash": reg.ConfigHash,
+	}).Info("Agent registered")
+	return nil
+}
+
+// RecordHeartbeat updates agent liveness from a heartbeat and raises an alert
+// the first time any of the agent's monitors reaches the crash threshold.
+func (c *Controller) RecordHeartbeat(hb *types.AgentHeartbeat) error {
+	if hb.AgentID == "" {
+		return fmt.Errorf("heartbeat missing agent_id")
+	}
+	threshold := c.cfg.MonitorCrashAlertThreshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	schema := hb.SchemaVersion
+	if schema == "" {
+		schema = types.SchemaVersionV1
+	}
+
+	now := time.Now()
+	c.arrivals[arrivalHeartbeat].record(now)
+	var crashLooping []string
+	c.agentsMu.Lock()
+	agent, ok := c.agents[hb.AgentID]
+	if !ok {
+		agent = &types.AgentInfo{
+			ID:           hb.AgentID,
+			PodName:      hb.PodName,
+			PodNamespace: hb.PodNamespace,
+			ConnectedAt:  now,
+		}
+		c.agents[hb.AgentID] = agent
+	}
+	for name, n := range hb.MonitorCrashes {
+		if n >= threshold && agent.MonitorCrashes[name] < threshold {
+			crashLooping = append(crashLooping, name)
+		}
+	}
+	if hb.ConfigHash != "" && agent.ConfigHash != "" && hb.ConfigHash != agent.ConfigHash {
+		c.log.WithFields(logrus.Fields{"agent_id": hb.AgentID, "old": agent.ConfigHash, "new": hb.ConfigHash}).Info("Agent config changed")
+	}
+	if agent.PodName == "" {
+		// Handshaking creates the agent without its pod.
+		agent.PodName, agent.PodNamespace = hb.PodName, hb.PodNamespace
+	}
+	agent.LastSeen = now
+	agent.LastHeartbeat = &now
+	c.setPodIP(agent, hb.PodIP)
+	agent.SchemaVersion = schema
+	if hb.Version != "" {
+		agent.Version = hb.Version
+	}
+	if hb.ConfigHash != "" {
+		agent.ConfigHash = hb.ConfigHash
+	}
+	if hb.Monitors != nil {
+		agent.Monitors = hb.Monitors
+	}
+	agent.ConfigRevision = hb.ConfigRevision
+	agent.MonitorCrashes = hb.MonitorCrashes
+	podName, podNS := agent.PodName, agent.PodNamespace
+	cluster, env := agent.ClusterName, agent.Environment
+	c.agentsMu.Unlock()
+
+	sort.Strings(crashLooping)
+	for _, name := range crashLooping {
+		c.raiseAlert(&types.Alert{
+			ID:          fmt.Sprintf("alert-%d", time.Now().UnixNano()),
+			Timestamp:   now,
+			Severity:    "HIGH",
+			RuleID:      MonitorCrashRuleID,
+			RuleName:    "Agent Monitor Crash Loop",
+			Description: fmt.Sprintf("Agent %s monitor %q crashed %d times", hb.AgentID, name, hb.MonitorCrashes[name]),
+			EventIDs:    []string{},
+			PodName:     podName,
+			PodNS:       podNS,
+			ClusterName: cluster,
+			Environment: env,
+			MitreTactic: "Defense Evasion",
+			MitreID:     "T1562.001",
+			Actions:     []string{"Check agent logs for panic stack traces", "Verify the sidecar image has not been tampered with", "Restart the pod if monitoring stays degraded"},
+			Status:      types.AlertStatusOpen,
+		})
+	}
+	if len(crashLooping) > 0 {
+		c.log.WithFields(logrus.Fields{"agent_id": hb.AgentID, "monitors": crashLooping}).Warn("Agent monitor crash loop")
+	}
+	return nil
+}
+
+// agentStatus derives an agent's status. Agents that have never registered or
+// heartbeated can only be judged by event traffic, so they are unknown. The
+// rest are degraded if any monitor is not running, idle if they have not sent
+// an event within the stale threshold, and healthy otherwise.
+func agentStatus(a *types.AgentInfo, now time.Time, stale time.Duration) string {
+	if a.LastHeartbeat == nil && a.RegisteredAt == nil {
+		return types.AgentStatusUnknown
+	}
+	for _, state := range a.Monitors {
+		if state != monitorStateRunning {
+			return types.AgentStatusDegraded
+		}
+	}
+	if a.LastEventAt == nil || (stale > 0 && now.Sub(*a.LastEventAt) > stale) {
+		return types.AgentStatusIdle
+	}
+	return types.AgentStatusHealthy
+}
+
+// updateStatusGauge refreshes apss_agents_by_status. Caller must hold agentsMu.
+func (c *Controller) updateStatusGauge(now time.Time) {
+	byStatus := map[string]int{
+		types.AgentStatusHealthy:  0,
+		types.AgentStatusIdle:     0,
+		types.AgentStatusDegraded: 0,
+		types.AgentStatusUnknown:  0,
+	}
+	for _, agent := range c.agents {
+		byStatus[agentStatus(agent, now, c.cfg.AgentStaleThreshold)]++
+	}
+	for status, n := range byStatus {
+		agentsByStatus.WithLabelValues(status).Set(float64(n))
+	}
+}
+
+// raiseAlert queues a controller-generated alert into the alert pipeline.
+func (c *Controller) raiseAlert(alert *types.Alert) {
+	select {
+	case c.alertChan <- alert:
+	default:
+		c.log.Warn("Alert channel full, dropping alert")
+	}
+}
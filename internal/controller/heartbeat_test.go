@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_RecordHeartbeat_CrashLoopAlert(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, MonitorCrashAlertThreshold: 3}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	send := func(crashes int) {
+		t.Helper()
+		err := c.RecordHeartbeat(&types.AgentHeartbeat{
+			AgentID: "agent-1", PodName: "p", PodNamespace: "ns", SchemaVersion: types.SchemaVersionV2,
+			MonitorCrashes: map[string]int{"procmon": crashes},
+		})
+		if err != nil {
+			t.Fatalf("RecordHeartbeat: %v", err)
+		}
+	}
+	send(1)
+	send(3)
+	send(4) // already alerted for this monitor
+	time.Sleep(100 * time.Millisecond)
+
+	alerts, _ := c.GetAlerts(types.AlertFilter{RuleID: MonitorCrashRuleID})
+	if len(alerts) != 1 {
+		t.Fatalf("crash loop alerts = %d, want 1", len(alerts))
+	}
+	if alerts[0].PodName != "p" || alerts[0].PodNS != "ns" {
+		t.Errorf("alert pod: %s/%s", alerts[0].PodNS, alerts[0].PodName)
+	}
+
+	agents := c.GetAgents()
+	if len(agents) != 1 || agents[0].MonitorCrashes["procmon"] != 4 || agents[0].LastHeartbeat == nil {
+		t.Errorf("agent after heartbeats: %+v", agents)
+	}
+}
+
+func TestController_RecordHeartbeat_MissingAgentID(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	if err := c.RecordHeartbeat(&types.AgentHeartbeat{}); err == nil {
+		t.Error("expected error for heartbeat without agent_id")
+	}
+}
+
+func TestController_RegisterAgent_Status(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, AgentStaleThreshold: time.Minute}, logrus.New())
+
+	if err := c.RegisterAgent(&types.AgentRegistration{}); err == nil {
+		t.Error("expected error for registration without agent_id")
+	}
+	err := c.RegisterAgent(&types.AgentRegistration{
+		AgentID: "agent-1", PodName: "p", PodNamespace: "ns", Version: "1.2.3", ConfigHash: "abc",
+		Monitors: []string{"procmon", "netpolicy"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	agent := c.GetAgents()[0]
+	if agent.Version != "1.2.3" || agent.ConfigHash != "abc" || agent.RegisteredAt == nil {
+		t.Errorf("registered agent: %+v", agent)
+	}
+	if agent.Status != types.AgentStatusIdle {
+		t.Errorf("status before any events = %q, want %q", agent.Status, types.AgentStatusIdle)
+	}
+
+	if err := c.IngestEvent(context.Background(), &types.SecurityEvent{AgentID: "agent-1", Severity: "LOW"}); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	if got := c.GetAgents()[0].Status; got != types.AgentStatusHealthy {
+		t.Errorf("status after event = %q, want %q", got, types.AgentStatusHealthy)
+	}
+
+	err = c.RecordHeartbeat(&types.AgentHeartbeat{
+		AgentID: "agent-1", ConfigHash: "def",
+		Monitors: map[string]string{"procmon": "failed", "netpolicy": "running"},
+	})
+	if err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	agent = c.GetAgents()[0]
+	if agent.Status != types.AgentStatusDegraded || agent.ConfigHash != "def" || agent.Version != "1.2.3" {
+		t.Errorf("agent after failed-monitor heartbeat: %+v", agent)
+	}
+
+	if err := c.IngestEvent(context.Background(), &types.SecurityEvent{AgentID: "agent-2", Severity: "LOW"}); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	for _, a := range c.GetAgents() {
+		if a.ID == "agent-2" && a.Status != types.AgentStatusUnknown {
+			t.Errorf("event-only agent status = %q, want %q", a.Status, types.AgentStatusUnknown)
+		}
+	}
+}
+
+func TestController_IngestEvent_FillsCluster(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, ClusterName: "default", Environment: "staging"}, logrus.New())
+	if err := c.RegisterAgent(&types.AgentRegistration{AgentID: "agent-1", ClusterName: "prod-us", Environment: "production"}); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	ev := &types.SecurityEvent{AgentID: "agent-1", Severity: "LOW"}
+	if err := c.IngestEvent(context.Background(), ev); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	if ev.ClusterName != "prod-us" || ev.Environment != "production" {
+		t.Errorf("event cluster = %q/%q, want the registered prod-us/production", ev.ClusterName, ev.Environment)
+	}
+
+	// Agents that never said fall back to the controller's.
+	ev = &types.SecurityEvent{AgentID: "agent-2", Severity: "LOW"}
+	if err := c.IngestEvent(context.Background(), ev); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	if ev.ClusterName != "default" || ev.Environment != "staging" {
+		t.Errorf("event cluster = %q/%q, want default/staging", ev.ClusterName, ev.Environment)
+	}
+
+	sweet := c.newSweetAlert(&types.Alert{ID: "a", ClusterName: "prod-us", Environment: "production"})
+	if sweet.ClusterName != "prod-us" || sweet.Metadata["environment"] != "production" {
+		t.Errorf("sweet alert = %+v", sweet)
+	}
+}
+
+func TestController_IngestEvent_FillsIdentity(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	registered := &types.Identity{ServiceAccount: "api", GCPServiceAccount: "api@proj.iam.gserviceaccount.com"}
+	if err := c.RegisterAgent(&types.AgentRegistration{AgentID: "agent-1", Identity: registered}); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	ev := &types.SecurityEvent{AgentID: "agent-1", Severity: "LOW"}
+	if err := c.IngestEvent(context.Background(), ev); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	if ev.Identity != registered {
+		t.Errorf("event identity = %+v, want the registered %+v", ev.Identity, registered)
+	}
+
+	// An agent that reports its own identity overrides the registered one.
+	sent := &types.Identity{ServiceAccount: "api-v2"}
+	if err := c.IngestEvent(context.Background(), &types.SecurityEvent{AgentID: "agent-1", Severity: "LOW", Identity: sent}); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	if got := c.GetAgents()[0].Identity; got != sent {
+		t.Errorf("agent identity = %+v, want %+v", got, sent)
+	}
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ErrIncidentNotFound is returned when an incident ID is not in the retained set.
+var ErrIncidentNotFound = errors.New("incident not found")
+
+var incidentsRaised = newCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_incidents_total",
+		Help: "Total cross-pod incidents raised by correlation",
+	},
+	[]string{"type"},
+)
+
+func init() {
+	prometheus.MustRegister(incidentsRaised)
+}
+
+// recordIncident retains incident, trimming the oldest beyond the alert
+// retention count.
+func (c *Controller) recordIncident(incident *types.Incident) {
+	c.incidentsMu.Lock()
+	c.incidents = append(c.incidents, incident)
+	if n := c.cfg.AlertRetentionCount; n > 0 && len(c.incidents) > n {
+		c.incidents = c.incidents[len(c.incidents)-n:]
+	}
+	c.incidentsMu.Unlock()
+	c.storeIncident(incident)
+	incidentsRaised.WithLabelValues(incident.Type).Inc()
+}
+
+// replaceIncident swaps the retained incident with the same ID for updated.
+func (c *Controller) replaceIncident(updated *types.Incident) {
+	c.incidentsMu.Lock()
+	defer c.incidentsMu.Unlock()
+	for i, inc := range c.incidents {
+		if inc.ID == updated.ID {
+			c.incidents[i] = updated
+			c.storeIncident(updated)
+			return
+		}
+	}
+}
+
+// GetIncidents returns retained incidents, newest first, optionally limited
+// to one type.
+func (c *Controller) GetIncidents(incidentType string) []*types.Incident {
+	c.incidentsMu.RLock()
+	defer c.incidentsMu.RUnlock()
+	out := make([]*types.Incident, 0, len(c.incidents))
+	for i := len(c.incidents) - 1; i >= 0; i-- {
+		if incidentType == "" || c.incidents[i].Type == incidentType {
+			out = append(out, c.incidents[i])
+		}
+	}
+	return out
+}
+
+// GetIncident returns the incident with the given ID.
+func (c *Controller) GetIncident(id string) (*types.Incident, error) {
+	c.incidentsMu.RLock()
+	defer c.incidentsMu.RUnlock()
+	for _, inc := range c.incidents {
+		if inc.ID == id {
+			return inc, nil
+		}
+	}
+	return nil, ErrIncidentNotFound
+}
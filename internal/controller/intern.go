@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// maxInterned bounds the interned strings. Pod names come and go, so once
+// the table is full it is started afresh: retained alerts keep the copies
+// they have, and later alerts share new ones.
+const maxInterned = 1 << 16
+
+var internedStrings = newGauge(prometheus.GaugeOpts{
+	Name: "apss_alert_interned_strings",
+	Help: "Distinct strings shared between retained alerts",
+})
+
+func init() {
+	prometheus.MustRegister(internedStrings)
+}
+
+// ruleMeta is the metadata every alert of a rule repeats. It is shared by
+// those alerts and must not be modified.
+type ruleMeta struct {
+	name        string
+	description string
+	mitreTactic string
+	mitreID     string
+	actions     []string
+}
+
+func (m *ruleMeta) matches(a *types.Alert) bool {
+	return m.name == a.RuleName && m.description == a.Description &&
+		m.mitreTactic == a.MitreTactic && m.mitreID == a.MitreID &&
+		(m.actions == nil) == (a.Actions == nil) && slices.Equal(m.actions, a.Actions)
+}
+
+// alertInterner makes retained alerts share one copy of the strings they
+// repeat: their rule's metadata, severity, status, pod and cluster. Alerts
+// the engine raises already share their rule's strings, but alerts decoded
+// from storage, a state snapshot, other replicas or edge clusters each
+// bring their own copies, tens of thousands of times over.
+type alertInterner struct {
+	mu      sync.Mutex
+	strings map[string]string
+	rules   map[string]*ruleMeta
+}
+
+func newAlertInterner() *alertInterner {
+	return &alertInterner{strings: make(map[string]string), rules: make(map[string]*ruleMeta)}
+}
+
+// internLocked returns the shared copy of s. Caller must hold mu.
+func (in *alertInterner) internLocked(s string) string {
+	if s == "" {
+		return s
+	}
+	if shared, ok := in.strings[s]; ok {
+		return shared
+	}
+	if len(in.strings) >= maxInterned {
+		in.strings = make(map[string]string, len(in.strings))
+	}
+	in.strings[s] = s
+	return s
+}
+
+// intern returns the shared copy of s.
+func (in *alertInterner) intern(s string) string {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.internLocked(s)
+}
+
+// alert points a's repeated fields at their shared copies. It modifies a,
+// so it must be called before a is retained or published.
+func (in *alertInterner) alert(a *types.Alert) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	a.RuleID = in.internLocked(a.RuleID)
+	meta := in.rules[a.RuleID]
+	if meta == nil || !meta.matches(a) {
+		// The rule is new, or was changed since; its latest alerts win.
+		meta = &ruleMeta{
+			name:        in.internLocked(a.RuleName),
+			description: in.internLocked(a.Description),
+			mitreTactic: in.internLocked(a.MitreTactic),
+			mitreID:     in.internLocked(a.MitreID),
+		}
+		if a.Actions != nil {
+			meta.actions = make([]string, len(a.Actions))
+			for i, action := range a.Actions {
+				meta.actions[i] = in.internLocked(action)
+			}
+		}
+		in.rules[a.RuleID] = meta
+	}
+	a.RuleName, a.Description = meta.name, meta.description
+	a.MitreTactic, a.MitreID = meta.mitreTactic, meta.mitreID
+	a.Actions = meta.actions
+
+	a.Severity = in.internLocked(a.Severity)
+	a.Status = in.internLocked(a.Status)
+	a.Assignee = in.internLocked(a.Assignee)
+	a.PodName = in.internLocked(a.PodName)
+	a.PodNS = in.internLocked(a.PodNS)
+	a.IncidentID = in.internLocked(a.IncidentID)
+	a.ClusterName = in.internLocked(a.ClusterName)
+	a.Environment = in.internLocked(a.Environment)
+	a.Replica = in.internLocked(a.Replica)
+	internedStrings.Set(float64(len(in.strings)))
+}
+
+// alerts interns each of alerts.
+func (in *alertInterner) alerts(alerts []*types.Alert) {
+	for _, a := range alerts {
+		in.alert(a)
+	}
+}
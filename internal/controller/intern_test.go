@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// decodeAlert returns a fresh copy of alert with its own strings, as
+// decoding it from storage or a report gives.
+func decodeAlert(t testing.TB, alert *types.Alert) *types.Alert {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out types.Alert
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func sameString(a, b string) bool { return unsafe.StringData(a) == unsafe.StringData(b) }
+
+func TestAlertInterner(t *testing.T) {
+	in := newAlertInterner()
+	alert := &types.Alert{
+		ID: "alert-1", RuleID: "APSS-001", RuleName: "Shell in container", Description: "A shell was started",
+		MitreID: "T1059", Actions: []string{"Isolate the pod"}, Severity: "HIGH", Status: types.AlertStatusOpen,
+		PodName: "api-0", PodNS: "prod", ClusterName: "eu-1",
+	}
+	a, b := decodeAlert(t, alert), decodeAlert(t, alert)
+	in.alerts([]*types.Alert{a, b})
+	if !sameString(a.RuleName, b.RuleName) || !sameString(a.Description, b.Description) ||
+		&a.Actions[0] != &b.Actions[0] || !sameString(a.PodName, b.PodName) || !sameString(a.ClusterName, b.ClusterName) {
+		t.Error("interned alerts do not share their strings")
+	}
+	if a.ID != alert.ID || a.RuleName != alert.RuleName || a.Actions[0] != alert.Actions[0] {
+		t.Errorf("interned alert = %+v", a)
+	}
+
+	// A changed rule's alerts keep their own metadata.
+	alert.Description = "A shell was started in a container"
+	c := decodeAlert(t, alert)
+	in.alert(c)
+	if c.Description != alert.Description || a.Description == alert.Description {
+		t.Errorf("descriptions after the rule changed = %q, %q", a.Description, c.Description)
+	}
+
+	alert.Actions = nil
+	d := decodeAlert(t, alert)
+	in.alert(d)
+	if d.Actions != nil {
+		t.Errorf("actions = %#v, want nil", d.Actions)
+	}
+}
+
+// BenchmarkAlertRetention measures the heap a full retention of alerts
+// loaded from storage takes, with and without interning. 20 rules raising
+// alerts in 50 pods give 10000 alerts of:
+//
+//	copies     ~630 B/alert
+//	interned   ~510 B/alert
+func BenchmarkAlertRetention(b *testing.B) {
+	const retained = 10000
+	stored := make([][]byte, retained)
+	for i := range stored {
+		data, err := json.Marshal(&types.Alert{
+			ID:          fmt.Sprintf("alert-%d", i),
+			RuleID:      fmt.Sprintf("APSS-%03d", i%20),
+			RuleName:    fmt.Sprintf("Suspicious activity detected by rule %d", i%20),
+			Description: fmt.Sprintf("Rule %d matched activity that is rarely seen in a production workload and may be an attacker", i%20),
+			EventIDs:    []string{fmt.Sprintf("ev-%d", i)},
+			MitreTactic: "Execution",
+			MitreID:     "T1059",
+			Actions:     []string{"Review the pod's recent process activity", "Isolate the pod if the activity is unexpected"},
+			Severity:    "HIGH",
+			Status:      types.AlertStatusOpen,
+			PodName:     fmt.Sprintf("checkout-7d9f8b6c5d-%05d", i%50),
+			PodNS:       "payments",
+			ClusterName: "prod-eu-west-1",
+			Environment: "production",
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		stored[i] = data
+	}
+
+	for _, intern := range []bool{false, true} {
+		name := "copies"
+		if intern {
+			name = "interned"
+		}
+		b.Run(name, func(b *testing.B) {
+			var heap uint64
+			for n := 0; n < b.N; n++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				in := newAlertInterner()
+				alerts := make([]*types.Alert, retained)
+				for i, data := range stored {
+					alerts[i] = &types.Alert{}
+					if err := json.Unmarshal(data, alerts[i]); err != nil {
+						b.Fatal(err)
+					}
+					if intern {
+						in.alert(alerts[i])
+					}
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				heap += after.HeapAlloc - before.HeapAlloc
+				runtime.KeepAlive(alerts)
+				runtime.KeepAlive(in)
+			}
+			b.ReportMetric(float64(heap)/float64(b.N)/retained, "heap-B/alert")
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// maxIOCs bounds the extracted IOC list; the least recently seen entries are
+// evicted beyond it.
+const maxIOCs = 10000
+
+var iocsExtracted = newCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_iocs_extracted_total",
+		Help: "Total new IOCs extracted from CRITICAL alerts",
+	},
+	[]string{"type"},
+)
+
+func init() {
+	prometheus.MustRegister(iocsExtracted)
+}
+
+func iocKey(typ, value string) string { return typ + ":" + value }
+
+// eventIOCs returns the indicators an event carries: the executable and new
+// file hashes, and the destination IP (only if external) and domain.
+func eventIOCs(e *types.SecurityEvent) []types.IOC {
+	var out []types.IOC
+	if e.Process != nil && e.Process.ExeHash != "" {
+		out = append(out, types.IOC{Type: types.IOCTypeHash, Value: strings.ToLower(e.Process.ExeHash)})
+	}
+	if e.File != nil && e.File.NewHash != "" {
+		out = append(out, types.IOC{Type: types.IOCTypeHash, Value: strings.ToLower(e.File.NewHash)})
+	}
+	if n := e.Network; n != nil {
+		if n.IsExternal && n.DstIP != "" {
+			out = append(out, types.IOC{Type: types.IOCTypeIP, Value: n.DstIP})
+		}
+		if n.Domain != "" {
+			out = append(out, types.IOC{Type: types.IOCTypeDomain, Value: strings.ToLower(strings.TrimSuffix(n.Domain, "."))})
+		}
+	}
+	return out
+}
+
+// extractIOCs adds the indicators of the event behind a CRITICAL alert to
+// the IOC list and hands the list to threat intel matching, so later events
+// from any pod that carry them are flagged.
+func (c *Controller) extractIOCs(alert *types.Alert, event *types.SecurityEvent) {
+	if !c.cfg.IOCExtraction || c.intel == nil || alert.Severity != "CRITICAL" {
+		return
+	}
+	found := eventIOCs(event)
+	if len(found) == 0 {
+		return
+	}
+	now := time.Now()
+	c.iocsMu.Lock()
+	added := 0
+	for _, ioc := range found {
+		key := iocKey(ioc.Type, ioc.Value)
+		if existing, ok := c.iocs[key]; ok {
+			existing.LastSeen = now
+			continue
+		}
+		ioc.AlertID, ioc.RuleID = alert.ID, alert.RuleID
+		ioc.PodName, ioc.PodNamespace = alert.PodName, alert.PodNS
+		ioc.FirstSeen, ioc.LastSeen = now, now
+		c.iocs[key] = &ioc
+		iocsExtracted.WithLabelValues(ioc.Type).Inc()
+		added++
+		c.log.WithFields(logrus.Fields{
+			"type": ioc.Type, "value": ioc.Value, "alert_id": alert.ID, "rule_id": alert.RuleID,
+		}).Info("Extracted IOC from critical alert")
+	}
+	c.expireIOCsLocked(now)
+	c.iocsMu.Unlock()
+	if added > 0 {
+		c.syncIOCs()
+	}
+}
+
+// expireIOCsLocked drops IOCs not seen for the TTL and evicts the least
+// recently seen beyond maxIOCs. It reports whether any were removed. Caller
+// must hold iocsMu.
+func (c *Controller) expireIOCsLocked(now time.Time) bool {
+	removed := false
+	if ttl := c.cfg.IOCTTL; ttl > 0 {
+		for key, ioc := range c.iocs {
+			if now.Sub(ioc.LastSeen) > ttl {
+				delete(c.iocs, key)
+				removed = true
+			}
+		}
+	}
+	if over := len(c.iocs) - maxIOCs; over > 0 {
+		keys := make([]string, 0, len(c.iocs))
+		for key := range c.iocs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return c.iocs[keys[i]].LastSeen.Before(c.iocs[keys[j]].LastSeen) })
+		for _, key := range keys[:over] {
+			delete(c.iocs, key)
+		}
+		removed = true
+	}
+	return removed
+}
+
+// syncIOCs replaces the IOCs matched by threat intel with the current list.
+func (c *Controller) syncIOCs() {
+	c.intel.SetLocal(c.GetIOCs(""))
+}
+
+// GetIOCs returns the extracted IOCs, most recently seen first, optionally
+// limited to one type. Expired entries are dropped first.
+func (c *Controller) GetIOCs(iocType string) []types.IOC {
+	c.iocsMu.Lock()
+	expired := c.expireIOCsLocked(time.Now())
+	out := make([]types.IOC, 0, len(c.iocs))
+	for _, ioc := range c.iocs {
+		if iocType == "" || ioc.Type == iocType {
+			out = append(out, *ioc)
+		}
+	}
+	c.iocsMu.Unlock()
+	if expired && c.intel != nil {
+		c.syncIOCs()
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastSeen.Equal(out[j].LastSeen) {
+			return out[i].LastSeen.After(out[j].LastSeen)
+		}
+		return iocKey(out[i].Type, out[i].Value) < iocKey(out[j].Type, out[j].Value)
+	})
+	return out
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_ExtractIOCs(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, IOCExtraction: true, IOCTTL: time.Hour}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	// A cryptominer (APSS-002, CRITICAL) and a reverse shell connection
+	// (APSS-001, CRITICAL) in one pod.
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a", PodName: "web", PodNamespace: "shop",
+		Process: &types.ProcessEventData{Name: "kworker", ExeHash: "ABC123", SuspiciousIndicators: []string{"possible_cryptominer"}},
+	})
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-2", AgentID: "a", PodName: "web", PodNamespace: "shop",
+		Network: &types.NetworkEventData{DstIP: "198.51.100.9", DstPort: 4444, IsExternal: true},
+	})
+	// A MEDIUM shell spawn contributes nothing.
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-3", AgentID: "a", PodName: "web", PodNamespace: "shop",
+		Process: &types.ProcessEventData{Name: "sh", ExeHash: "5e11", SuspiciousIndicators: []string{"shell_spawn"}},
+	})
+	time.Sleep(150 * time.Millisecond)
+
+	iocs := c.GetIOCs("")
+	if len(iocs) != 2 {
+		t.Fatalf("iocs = %+v, want the hash and the IP", iocs)
+	}
+	hashes := c.GetIOCs(types.IOCTypeHash)
+	if len(hashes) != 1 || hashes[0].Value != "abc123" || hashes[0].RuleID != "APSS-002" || hashes[0].PodNamespace != "shop" {
+		t.Errorf("hash iocs = %+v", hashes)
+	}
+
+	// The same binary and address seen later in another pod match.
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-4", AgentID: "b", PodName: "api", PodNamespace: "data",
+		Process: &types.ProcessEventData{Name: "kworker", ExeHash: "abc123"},
+	})
+	_ = c.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-5", AgentID: "b", PodName: "api", PodNamespace: "data",
+		Network: &types.NetworkEventData{DstIP: "198.51.100.9", DstPort: 443, IsExternal: true},
+	})
+	time.Sleep(150 * time.Millisecond)
+
+	for _, rule := range []string{"APSS-015", "APSS-011"} {
+		alerts, _ := c.GetAlerts(types.AlertFilter{RuleID: rule})
+		if len(alerts) != 1 || alerts[0].PodName != "api" {
+			t.Errorf("%s alerts = %+v", rule, alerts)
+		}
+	}
+}
+
+func TestController_ExpireIOCs(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, IOCExtraction: true, IOCTTL: time.Minute}, logrus.New())
+	alert := &types.Alert{ID: "alert-1", RuleID: "APSS-002", Severity: "CRITICAL"}
+	c.extractIOCs(alert, &types.SecurityEvent{Process: &types.ProcessEventData{ExeHash: "abc123"}})
+	if c.intel.MatchHash("abc123") == nil {
+		t.Fatal("extracted hash not matched")
+	}
+
+	c.iocsMu.Lock()
+	c.iocs[iocKey(types.IOCTypeHash, "abc123")].LastSeen = time.Now().Add(-2 * time.Minute)
+	c.iocsMu.Unlock()
+	if iocs := c.GetIOCs(""); len(iocs) != 0 {
+		t.Errorf("iocs after TTL = %+v", iocs)
+	}
+	if c.intel.MatchHash("abc123") != nil {
+		t.Error("expired hash still matched")
+	}
+
+	disabled := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	disabled.extractIOCs(alert, &types.SecurityEvent{Process: &types.ProcessEventData{ExeHash: "abc123"}})
+	if n := len(disabled.GetIOCs("")); n != 0 {
+		t.Errorf("iocs with extraction off = %d", n)
+	}
+}
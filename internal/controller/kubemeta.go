@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	// podWatchTimeout bounds each watch request; the cache re-watches from
+	// the last resource version when it expires.
+	podWatchTimeout = 5 * time.Minute
+	podRetryMin     = time.Second
+	podRetryMax     = time.Minute
+	// podListPageSize is how many pods each list request returns.
+	podListPageSize = 500
+	// deletedPodRetention is how long a deleted pod's metadata is kept for
+	// its events still in flight, such as those spooled by its agent.
+	deletedPodRetention = 15 * time.Minute
+)
+
+// errPodWatchExpired is returned when the API server no longer has the
+// watched resource version and the cache must list again.
+var errPodWatchExpired = errors.New("watch resource version expired")
+
+// cronJobSuffix is the scheduled time, in minutes since the epoch, a CronJob
+// appends to the names of its Jobs.
+var cronJobSuffix = regexp.MustCompile(`^(.+)-[0-9]{8,}$`)
+
+var kubeMetadataPods = newGauge(prometheus.GaugeOpts{
+	Name: "apss_kube_metadata_pods",
+	Help: "Pods whose Kubernetes metadata the controller has cached",
+})
+
+func init() {
+	prometheus.MustRegister(kubeMetadataPods)
+}
+
+// podMetadata keeps the metadata of every pod in the cluster in memory,
+// filled by a list and kept current with a watch, so alerts never wait on
+// the API server.
+type podMetadata struct {
+	client *kube.Client
+	log    *logrus.Logger
+	// labels are the pod label keys kept
+	labels []string
+
+	mu   sync.RWMutex
+	pods map[string]*podMetaEntry
+}
+
+type podMetaEntry struct {
+	meta *types.KubeMetadata
+	// ip is the pod's IP, empty until it is assigned
+	ip string
+	// deleted is when the pod was deleted, zero while it exists
+	deleted time.Time
+}
+
+func newPodMetadata(client *kube.Client, labels []string, log *logrus.Logger) *podMetadata {
+	return &podMetadata{client: client, log: log, labels: labels, pods: make(map[string]*podMetaEntry)}
+}
+
+// initKubeMetadata sets up the pod metadata cache when the controller runs
+// in a cluster and KubeMetadata is on.
+func (c *Controller) initKubeMetadata() {
+	if c.kube == nil || !c.cfg.KubeMetadata {
+		return
+	}
+	c.podMeta = newPodMetadata(c.kube, c.cfg.KubeMetadataLabels, c.log)
+}
+
+// lookup returns the metadata of pod ns/name, or nil if it is unknown.
+func (p *podMetadata) lookup(ns, name string) *types.KubeMetadata {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if e := p.pods[podKey(ns, name)]; e != nil {
+		return e.meta
+	}
+	return nil
+}
+
+// podIP returns the IP of pod ns/name, and false if the pod is unknown or
+// was deleted.
+func (p *podMetadata) podIP(ns, name string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	e := p.pods[podKey(ns, name)]
+	if e == nil || !e.deleted.IsZero() {
+		return "", false
+	}
+	return e.ip, true
+}
+
+// Run lists and watches pods until ctx is done, retrying with backoff on
+// errors.
+func (p *podMetadata) Run(ctx context.Context) {
+	backoff := podRetryMin
+	for ctx.Err() == nil {
+		rv, err := p.list(ctx)
+		for err == nil {
+			backoff = podRetryMin
+			p.purge(time.Now())
+			rv, err = p.watch(ctx, rv)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !errors.Is(err, errPodWatchExpired) {
+			p.log.WithError(err).WithField("retry_in", backoff).Warn("Pod metadata list/watch failed")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, podRetryMax)
+		}
+	}
+}
+
+type podObject struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		NodeName           string `json:"nodeName"`
+		ServiceAccountName string `json:"serviceAccountName"`
+	} `json:"spec"`
+	Status struct {
+		PodIP string `json:"podIP"`
+	} `json:"status"`
+}
+
+// list replaces the cache with every pod in the cluster, page by page, and
+// returns the list's resource version. Deleted pods still retained are
+// kept unless they were recreated.
+func (p *podMetadata) list(ctx context.Context) (string, error) {
+	pods := make(map[string]*podMetaEntry)
+	var rv, next string
+	for {
+		var page struct {
+			Metadata metav1.ListMeta `json:"metadata"`
+			Items    []podObject     `json:"items"`
+		}
+		path := fmt.Sprintf("/api/v1/pods?limit=%d", podListPageSize)
+		if next != "" {
+			path += "&continue=" + url.QueryEscape(next)
+		}
+		if err := p.client.Get(ctx, path, &page); err != nil {
+			return "", err
+		}
+		for i := range page.Items {
+			pod := &page.Items[i]
+			pods[podKey(pod.Metadata.Namespace, pod.Metadata.Name)] = &podMetaEntry{meta: p.metadata(pod), ip: pod.Status.PodIP}
+		}
+		rv, next = page.Metadata.ResourceVersion, page.Metadata.Continue
+		if next == "" {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	for key, e := range p.pods {
+		if _, ok := pods[key]; !ok && !e.deleted.IsZero() {
+			pods[key] = e
+		}
+	}
+	p.pods = pods
+	kubeMetadataPods.Set(float64(len(pods)))
+	p.mu.Unlock()
+	p.log.WithField("pods", len(pods)).Debug("Listed pods")
+	return rv, nil
+}
+
+// watch applies pod events from rv until the watch ends, returning the last
+// resource version seen.
+func (p *podMetadata) watch(ctx context.Context, rv string) (string, error) {
+	path := fmt.Sprintf("/api/v1/pods?watch=true&allowWatchBookmarks=true&resourceVersion=%s&timeoutSeconds=%d",
+		rv, int(podWatchTimeout.Seconds()))
+	body, err := p.client.Open(ctx, path)
+	if err != nil {
+		return rv, err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var ev struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return rv, ctx.Err()
+			}
+			// The server closes the stream when timeoutSeconds expires.
+			return rv, nil
+		}
+		if ev.Type == "ERROR" {
+			var status metav1.Status
+			_ = json.Unmarshal(ev.Object, &status)
+			if status.Code == http.StatusGone {
+				return rv, errPodWatchExpired
+			}
+			return rv, fmt.Errorf("watch pods: %s", status.Message)
+		}
+		var pod podObject
+		if err := json.Unmarshal(ev.Object, &pod); err != nil {
+			return rv, fmt.Errorf("decode pod event: %w", err)
+		}
+		rv = pod.Metadata.ResourceVersion
+		key := podKey(pod.Metadata.Namespace, pod.Metadata.Name)
+		p.mu.Lock()
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			p.pods[key] = &podMetaEntry{meta: p.metadata(&pod), ip: pod.Status.PodIP}
+		case "DELETED":
+			if e := p.pods[key]; e != nil {
+				e.deleted = time.Now()
+			}
+		}
+		kubeMetadataPods.Set(float64(len(p.pods)))
+		p.mu.Unlock()
+	}
+}
+
+// purge drops the pods deleted more than deletedPodRetention before now.
+func (p *podMetadata) purge(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, e := range p.pods {
+		if !e.deleted.IsZero() && now.Sub(e.deleted) > deletedPodRetention {
+			delete(p.pods, key)
+		}
+	}
+	kubeMetadataPods.Set(float64(len(p.pods)))
+}
+
+// metadata extracts what alerts carry about pod.
+func (p *podMetadata) metadata(pod *podObject) *types.KubeMetadata {
+	m := &types.KubeMetadata{Node: pod.Spec.NodeName, ServiceAccount: pod.Spec.ServiceAccountName}
+	m.OwnerKind, m.OwnerName = podOwner(&pod.Metadata)
+	for _, k := range p.labels {
+		if v, ok := pod.Metadata.Labels[k]; ok {
+			if m.Labels == nil {
+				m.Labels = make(map[string]string)
+			}
+			m.Labels[k] = v
+		}
+	}
+	return m
+}
+
+// podOwner returns the top-level owner of a pod from its controller
+// reference, without reading the owner: a ReplicaSet named after its pod
+// template hash belongs to the Deployment it is named after, and a Job
+// named with a scheduled time to a CronJob. Pods without a controller have
+// no owner.
+func podOwner(meta *metav1.ObjectMeta) (kind, name string) {
+	ref := metav1.GetControllerOfNoCopy(meta)
+	if ref == nil {
+		return "", ""
+	}
+	switch ref.Kind {
+	case "ReplicaSet":
+		if hash := meta.Labels["pod-template-hash"]; hash != "" {
+			if deployment, ok := strings.CutSuffix(ref.Name, "-"+hash); ok {
+				return "Deployment", deployment
+			}
+		}
+	case "Job":
+		if m := cronJobSuffix.FindStringSubmatch(ref.Name); m != nil {
+			return "CronJob", m[1]
+		}
+	}
+	return ref.Kind, ref.Name
+}
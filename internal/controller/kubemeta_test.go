@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestPodMetadata_ListAndWatch(t *testing.T) {
+	var lists, watches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("watch") != "true" {
+			atomic.AddInt32(&lists, 1)
+			if q.Get("continue") == "" {
+				fmt.Fprint(w, `{"metadata":{"resourceVersion":"10","continue":"page2"},"items":[
+					{"metadata":{"name":"checkout-7d9f8-abcde","namespace":"shop",
+						"labels":{"app":"checkout","team":"payments","pod-template-hash":"7d9f8","version":"v2"},
+						"ownerReferences":[{"kind":"ReplicaSet","name":"checkout-7d9f8","controller":true}]},
+					 "spec":{"nodeName":"node-1","serviceAccountName":"checkout"},"status":{"podIP":"10.8.0.4"}}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"metadata":{"resourceVersion":"10"},"items":[
+				{"metadata":{"name":"old","namespace":"shop"},"spec":{"nodeName":"node-2"}}]}`)
+			return
+		}
+		if atomic.AddInt32(&watches, 1) == 1 {
+			if rv := q.Get("resourceVersion"); rv != "10" {
+				t.Errorf("watch resourceVersion = %q, want 10", rv)
+			}
+			fmt.Fprintln(w, `{"type":"ADDED","object":{"metadata":{"name":"report-28000000-xyz","namespace":"batch","resourceVersion":"11",
+				"ownerReferences":[{"kind":"Job","name":"report-28000000","controller":true}]}}}`)
+			fmt.Fprintln(w, `{"type":"DELETED","object":{"metadata":{"name":"old","namespace":"shop","resourceVersion":"12"}}}`)
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	p := newPodMetadata(kube.NewClient(srv.URL, srv.Client()), []string{"app", "team"}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&watches) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("pod metadata did not list and watch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := &types.KubeMetadata{
+		OwnerKind: "Deployment", OwnerName: "checkout", Node: "node-1", ServiceAccount: "checkout",
+		Labels: map[string]string{"app": "checkout", "team": "payments"},
+	}
+	if got := p.lookup("shop", "checkout-7d9f8-abcde"); !reflect.DeepEqual(got, want) {
+		t.Errorf("checkout = %+v, want %+v", got, want)
+	}
+	if got := p.lookup("batch", "report-28000000-xyz"); got == nil || got.OwnerKind != "CronJob" || got.OwnerName != "report" {
+		t.Errorf("report = %+v", got)
+	}
+	if ip, ok := p.podIP("shop", "checkout-7d9f8-abcde"); !ok || ip != "10.8.0.4" {
+		t.Errorf("checkout pod IP = %q, %v", ip, ok)
+	}
+	if _, ok := p.podIP("shop", "old"); ok {
+		t.Error("deleted pod has an IP")
+	}
+	// A deleted pod is kept for the events still in flight.
+	if got := p.lookup("shop", "old"); got == nil || got.Node != "node-2" {
+		t.Errorf("deleted pod = %+v", got)
+	}
+	p.purge(time.Now().Add(deletedPodRetention + time.Minute))
+	if got := p.lookup("shop", "old"); got != nil {
+		t.Errorf("purged pod = %+v", got)
+	}
+	if got := p.lookup("shop", "missing"); got != nil {
+		t.Errorf("unknown pod = %+v", got)
+	}
+	var nilCache *podMetadata
+	if got := nilCache.lookup("shop", "checkout-7d9f8-abcde"); got != nil {
+		t.Errorf("nil cache lookup = %+v", got)
+	}
+}
+
+func TestPodOwner(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name      string
+		refs      []metav1.OwnerReference
+		hash      string
+		wantKind  string
+		wantOwner string
+	}{
+		{"deployment", []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5c8d", Controller: &yes}}, "5c8d", "Deployment", "web"},
+		{"bare replicaset", []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web", Controller: &yes}}, "", "ReplicaSet", "web"},
+		{"cronjob", []metav1.OwnerReference{{Kind: "Job", Name: "backup-29123456", Controller: &yes}}, "", "CronJob", "backup"},
+		{"job", []metav1.OwnerReference{{Kind: "Job", Name: "migrate-42", Controller: &yes}}, "", "Job", "migrate-42"},
+		{"statefulset", []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: &yes}}, "", "StatefulSet", "db"},
+		{"not controller", []metav1.OwnerReference{{Kind: "ConfigMap", Name: "cfg"}}, "", "", ""},
+		{"bare pod", nil, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := &metav1.ObjectMeta{OwnerReferences: tt.refs}
+			if tt.hash != "" {
+				meta.Labels = map[string]string{"pod-template-hash": tt.hash}
+			}
+			kind, name := podOwner(meta)
+			if kind != tt.wantKind || name != tt.wantOwner {
+				t.Errorf("podOwner() = %s/%s, want %s/%s", kind, name, tt.wantKind, tt.wantOwner)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// LateralMovementRuleID identifies alerts raised when one pod connects to
+// another shortly before or after a shell spawns in the destination pod.
+const LateralMovementRuleID = "APSS-013"
+
+// ephemeralPortMin is the start of the Linux ephemeral port range. Agents see
+// both ends of a pod-to-pod connection; the destination pod's agent reports it
+// as a connection to the source's ephemeral port, which is skipped so only the
+// client side counts as outbound.
+const ephemeralPortMin = 32768
+
+// shellIndicators mark process events that count as a shell in the target pod.
+var shellIndicators = map[string]bool{"shell_spawn": true, "possible_reverse_shell": true}
+
+// lateralObs is a connection into a pod or a shell in it, as seen by its agent.
+type lateralObs struct {
+	at      time.Time
+	eventID string
+	pod     types.PodRef
+}
+
+// lateralTracker keeps the connections between pods and the shell spawns of
+// the last window so either one can be matched against the other, whichever
+// arrives first. It is used from processEvents; mu guards it against the
+// state saver.
+type lateralTracker struct {
+	mu     sync.Mutex
+	window time.Duration
+	// conns holds connections keyed by destination pod, shells by the pod
+	// the shell ran in; fired is the last incident per source>target pair.
+	conns     map[string][]lateralObs
+	shells    map[string][]lateralObs
+	fired     map[string]time.Time
+	lastSweep time.Time
+}
+
+func newLateralTracker(window time.Duration) *lateralTracker {
+	return &lateralTracker{
+		window: window,
+		conns:  make(map[string][]lateralObs),
+		shells: make(map[string][]lateralObs),
+		fired:  make(map[string]time.Time),
+	}
+}
+
+func podKey(ns, name string) string { return ns + "/" + name }
+
+// eventTime is when the event's activity happened, if the agent knows, or
+// else when it was observed.
+func eventTime(e *types.SecurityEvent) time.Time {
+	if e.OccurredAt != nil {
+		return *e.OccurredAt
+	}
+	return e.Timestamp
+}
+
+func isShellEvent(e *types.SecurityEvent) bool {
+	if e.Process == nil {
+		return false
+	}
+	for _, ind := range e.Process.SuspiciousIndicators {
+		if shellIndicators[ind] {
+			return true
+		}
+	}
+	return false
+}
+
+// podByIP returns the pod whose agent last reported ip.
+func (c *Controller) podByIP(ip string) (types.PodRef, bool) {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	agent, ok := c.agents[c.podIPs[ip]]
+	if !ok || agent.PodIP != ip {
+		return types.PodRef{}, false
+	}
+	return types.PodRef{Namespace: agent.PodNamespace, Name: agent.PodName}, true
+}
+
+// AgentByIP returns the ID of the agent whose pod last reported ip, or ""
+// when none did.
+func (c *Controller) AgentByIP(ip string) string {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	if agent, ok := c.agents[c.podIPs[ip]]; ok && agent.PodIP == ip {
+		return agent.ID
+	}
+	return ""
+}
+
+// setPodIP records the agent's pod IP for correlation. Caller must hold agentsMu.
+func (c *Controller) setPodIP(agent *types.AgentInfo, ip string) {
+	if ip == "" {
+		return
+	}
+	agent.PodIP = ip
+	c.podIPs[ip] = agent.ID
+}
+
+// correlateLateral matches a pod-to-pod connection with a shell spawned in
+// the destination pod within the window, in either order, and raises an
+// incident for the pair.
+func (c *Controller) correlateLateral(event *types.SecurityEvent) {
+	t := c.lateral
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at := eventTime(event)
+	t.sweep(at)
+	self := types.PodRef{Namespace: event.PodNamespace, Name: event.PodName}
+
+	switch {
+	case isShellEvent(event):
+		key := podKey(self.Namespace, self.Name)
+		shell := lateralObs{at: at, eventID: event.ID, pod: self}
+		t.shells[key] = append(t.shells[key], shell)
+		for _, conn := range t.conns[key] {
+			if t.within(conn.at, at) {
+				c.raiseLateralMovement(conn, shell)
+			}
+		}
+
+	case event.Network != nil && event.Type == "network_connect":
+		n := event.Network
+		if n.State != "ESTABLISHED" && n.State != "SYN_SENT" {
+			return
+		}
+		if n.DstPort <= 0 || n.DstPort >= ephemeralPortMin {
+			return
+		}
+		target, ok := c.podByIP(n.DstIP)
+		if !ok || target == self {
+			return
+		}
+		key := podKey(target.Namespace, target.Name)
+		conn := lateralObs{at: at, eventID: event.ID, pod: self}
+		t.conns[key] = append(t.conns[key], conn)
+		for _, shell := range t.shells[key] {
+			if t.within(conn.at, shell.at) {
+				c.raiseLateralMovement(conn, shell)
+			}
+		}
+	}
+}
+
+func (t *lateralTracker) within(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d <= t.window && d >= -t.window
+}
+
+// sweep drops observations older than the window, at most once per window.
+func (t *lateralTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.window {
+		return
+	}
+	t.lastSweep = now
+	cutoff := now.Add(-t.window)
+	for _, m := range []map[string][]lateralObs{t.conns, t.shells} {
+		for key, obs := range m {
+			kept := obs[:0]
+			for _, o := range obs {
+				if o.at.After(cutoff) {
+					kept = append(kept, o)
+				}
+			}
+			if len(kept) == 0 {
+				delete(m, key)
+			} else {
+				m[key] = kept
+			}
+		}
+	}
+	for pair, at := range t.fired {
+		if !at.After(cutoff) {
+			delete(t.fired, pair)
+		}
+	}
+}
+
+// raiseLateralMovement records an incident and its alert, once per source
+// and target pair per window.
+func (c *Controller) raiseLateralMovement(conn, shell lateralObs) {
+	t := c.lateral
+	pair := podKey(conn.pod.Namespace, conn.pod.Name) + ">" + podKey(shell.pod.Namespace, shell.pod.Name)
+	latest := conn.at
+	if shell.at.After(latest) {
+		latest = shell.at
+	}
+	if last, ok := t.fired[pair]; ok && t.within(last, latest) {
+		return
+	}
+	t.fired[pair] = latest
+
+	now := time.Now()
+	source := conn.pod
+	source.Role = types.PodRoleSource
+	target := shell.pod
+	target.Role = types.PodRoleTarget
+	description := fmt.Sprintf("Pod %s/%s connected to pod %s/%s, where a shell was spawned within %s",
+		source.Namespace, source.Name, target.Namespace, target.Name, t.window)
+	incident := &types.Incident{
+		ID:          fmt.Sprintf("incident-%d", now.UnixNano()),
+		Type:        types.IncidentTypeLateralMovement,
+		Timestamp:   now,
+		Severity:    "HIGH",
+		RuleID:      LateralMovementRuleID,
+		Title:       "Lateral Movement Between Pods",
+		Description: description,
+		Pods:        []types.PodRef{source, target},
+		EventIDs:    []string{conn.eventID, shell.eventID},
+		MitreTactic: "Lateral Movement",
+		MitreID:     "T1021",
+	}
+	alert := &types.Alert{
+		ID:          fmt.Sprintf("alert-%d", now.UnixNano()),
+		Timestamp:   now,
+		Severity:    incident.Severity,
+		RuleID:      LateralMovementRuleID,
+		RuleName:    incident.Title,
+		Description: description,
+		EventIDs:    incident.EventIDs,
+		PodName:     target.Name,
+		PodNS:       target.Namespace,
+		MitreTactic: incident.MitreTactic,
+		MitreID:     incident.MitreID,
+		Actions: []string{
+			"Isolate both pods with a NetworkPolicy",
+			fmt.Sprintf("Review how %s/%s reached %s/%s", source.Namespace, source.Name, target.Namespace, target.Name),
+			"Check the source pod for compromise",
+		},
+		Status:     types.AlertStatusOpen,
+		IncidentID: incident.ID,
+	}
+	incident.AlertIDs = []string{alert.ID}
+
+	c.recordIncident(incident)
+	c.raiseAlert(alert)
+	c.log.WithFields(logrus.Fields{
+		"incident_id": incident.ID, "source": podKey(source.Namespace, source.Name),
+		"target": podKey(target.Namespace, target.Name),
+	}).Warn("Lateral movement between pods")
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func newLateralTestController(t *testing.T) *Controller {
+	t.Helper()
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, LateralMovementWindow: time.Minute}, logrus.New())
+	for _, reg := range []*types.AgentRegistration{
+		{AgentID: "agent-a", PodName: "web", PodNamespace: "shop", PodIP: "10.0.0.1"},
+		{AgentID: "agent-b", PodName: "db", PodNamespace: "data", PodIP: "10.0.0.2"},
+	} {
+		if err := c.RegisterAgent(reg); err != nil {
+			t.Fatalf("RegisterAgent: %v", err)
+		}
+	}
+	return c
+}
+
+func connectEvent(id string, at time.Time, dstIP string, dstPort int) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: id, AgentID: "agent-a", Type: "network_connect", Timestamp: at, PodName: "web", PodNamespace: "shop",
+		Network: &types.NetworkEventData{SrcIP: "10.0.0.1", SrcPort: 40000, DstIP: dstIP, DstPort: dstPort, State: "ESTABLISHED"},
+	}
+}
+
+func shellEvent(id string, at time.Time) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: id, AgentID: "agent-b", Type: "process_start", Timestamp: at, PodName: "db", PodNamespace: "data",
+		Process: &types.ProcessEventData{SuspiciousIndicators: []string{"shell_spawn"}},
+	}
+}
+
+func TestController_LateralMovement(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		events []*types.SecurityEvent
+		want   int
+	}{
+		{"connect then shell", []*types.SecurityEvent{connectEvent("e1", now, "10.0.0.2", 5432), shellEvent("e2", now.Add(10*time.Second))}, 1},
+		{"shell then connect", []*types.SecurityEvent{shellEvent("e2", now), connectEvent("e1", now.Add(10*time.Second), "10.0.0.2", 5432)}, 1},
+		{"repeat pair deduped", []*types.SecurityEvent{
+			connectEvent("e1", now, "10.0.0.2", 5432), shellEvent("e2", now.Add(time.Second)), shellEvent("e3", now.Add(2*time.Second)),
+		}, 1},
+		{"outside window", []*types.SecurityEvent{connectEvent("e1", now, "10.0.0.2", 5432), shellEvent("e2", now.Add(2*time.Minute))}, 0},
+		{"ephemeral port", []*types.SecurityEvent{connectEvent("e1", now, "10.0.0.2", 45000), shellEvent("e2", now)}, 0},
+		{"unknown ip", []*types.SecurityEvent{connectEvent("e1", now, "10.9.9.9", 5432), shellEvent("e2", now)}, 0},
+		{"same pod", []*types.SecurityEvent{connectEvent("e1", now, "10.0.0.1", 5432), {
+			ID: "e2", AgentID: "agent-a", Type: "process_start", Timestamp: now, PodName: "web", PodNamespace: "shop",
+			Process: &types.ProcessEventData{SuspiciousIndicators: []string{"shell_spawn"}},
+		}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLateralTestController(t)
+			for _, ev := range tt.events {
+				c.correlateLateral(ev)
+			}
+			incidents := c.GetIncidents(types.IncidentTypeLateralMovement)
+			if len(incidents) != tt.want {
+				t.Fatalf("incidents = %d, want %d", len(incidents), tt.want)
+			}
+			if len(c.alertChan) != tt.want {
+				t.Fatalf("alerts = %d, want %d", len(c.alertChan), tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			inc := incidents[0]
+			if len(inc.Pods) != 2 || inc.Pods[0].Name != "web" || inc.Pods[0].Role != types.PodRoleSource ||
+				inc.Pods[1].Name != "db" || inc.Pods[1].Role != types.PodRoleTarget {
+				t.Errorf("incident pods = %+v", inc.Pods)
+			}
+			alert := <-c.alertChan
+			if alert.RuleID != LateralMovementRuleID || alert.IncidentID != inc.ID || alert.PodName != "db" {
+				t.Errorf("alert = %+v", alert)
+			}
+			if got, err := c.GetIncident(inc.ID); err != nil || got != inc {
+				t.Errorf("GetIncident(%q) = %v, %v", inc.ID, got, err)
+			}
+		})
+	}
+}
+
+func TestController_LateralMovement_Disabled(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	c.correlateLateral(shellEvent("e1", time.Now()))
+	if _, err := c.GetIncident("missing"); err != ErrIncidentNotFound {
+		t.Errorf("GetIncident(missing) err = %v", err)
+	}
+	if n := len(c.GetIncidents("")); n != 0 {
+		t.Errorf("incidents with correlation disabled = %d", n)
+	}
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// annotationLeaderAddress is the URL the Lease holder serves its API on,
+// for followers to forward requests to.
+const annotationLeaderAddress = "apss.invisible.tech/leader-address"
+
+var (
+	leaderGauge = newGauge(prometheus.GaugeOpts{
+		Name: "apss_controller_leader",
+		Help: "1 while this controller replica holds the leader Lease, 0 otherwise",
+	})
+	leaderTransitions = newCounter(prometheus.CounterOpts{
+		Name: "apss_controller_leader_transitions_total",
+		Help: "Times this controller replica became leader",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(leaderGauge, leaderTransitions)
+}
+
+// LeaderStatus is a replica's view of the leader election.
+type LeaderStatus struct {
+	// Enabled is false when the controller runs alone, and is then always
+	// the leader.
+	Enabled  bool   `json:"enabled"`
+	Identity string `json:"identity,omitempty"`
+	Leading  bool   `json:"leading"`
+	// Leader and LeaderAddress are the Lease holder's identity and API URL,
+	// empty while no replica holds the Lease.
+	Leader        string `json:"leader,omitempty"`
+	LeaderAddress string `json:"leader_address,omitempty"`
+}
+
+// leaderElector holds or watches a coordination.k8s.io Lease. A Lease is
+// taken over when its record has not changed for its duration as measured
+// by this replica's clock, so clock skew between replicas does not matter.
+type leaderElector struct {
+	client *kube.Client
+	// leases is the Leases collection path and name the Lease's name.
+	leases   string
+	name     string
+	identity string
+	address  string
+	duration time.Duration
+	deadline time.Duration
+	retry    time.Duration
+	log      *logrus.Logger
+
+	mu            sync.RWMutex
+	leading       bool
+	holder        string
+	holderAddress string
+	// observed is the holder and renew time last read, and observedAt when
+	// it was first read.
+	observed   string
+	observedAt time.Time
+	// lease is the last Lease read or written, for its resource version.
+	lease *coordinationv1.Lease
+}
+
+// initLeaderElection sets up the elector when LeaderElection is on. Outside
+// a cluster, or without a pod IP to be reached at, the controller runs as
+// the only leader.
+func (c *Controller) initLeaderElection() {
+	if !c.cfg.LeaderElection {
+		return
+	}
+	if c.shards != nil {
+		c.log.Warn("LEADER_ELECTION is ignored when SHARDING is on")
+		return
+	}
+	if c.kube == nil {
+		c.log.Error("LEADER_ELECTION needs the Kubernetes API, running as the only replica")
+		return
+	}
+	if c.cfg.PodIP == "" {
+		c.log.Error("LEADER_ELECTION needs POD_IP for followers to reach the leader, running as the only replica")
+		return
+	}
+	identity := c.cfg.PodName
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	_, port, err := net.SplitHostPort(c.cfg.HTTPAddr)
+	if err != nil {
+		port = "8080"
+	}
+	c.leader = &leaderElector{
+		client:   c.kube,
+		leases:   fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", url.PathEscape(c.cfg.LeaderElectionNamespace)),
+		name:     c.cfg.LeaderElectionLease,
+		identity: identity,
+		address:  "http://" + net.JoinHostPort(c.cfg.PodIP, port),
+		duration: c.cfg.LeaseDuration,
+		deadline: c.cfg.LeaseRenewDeadline,
+		retry:    c.cfg.LeaseRetryPeriod,
+		log:      c.log,
+	}
+}
+
+// LeaderStatus returns this replica's view of the leader election.
+func (c *Controller) LeaderStatus() LeaderStatus {
+	if c.leader == nil {
+		return LeaderStatus{Leading: true}
+	}
+	c.leader.mu.RLock()
+	defer c.leader.mu.RUnlock()
+	return LeaderStatus{
+		Enabled:       true,
+		Identity:      c.leader.identity,
+		Leading:       c.leader.leading,
+		Leader:        c.leader.holder,
+		LeaderAddress: c.leader.holderAddress,
+	}
+}
+
+// leading reports whether this replica does the leader's work: always when
+// it runs alone.
+func (c *Controller) leading() bool {
+	if c.leader == nil {
+		return true
+	}
+	c.leader.mu.RLock()
+	defer c.leader.mu.RUnlock()
+	return c.leader.leading
+}
+
+// Run tries to acquire the Lease every retry period, calls lead once it
+// has, and keeps renewing it until ctx is done. The replica counts as
+// leading only once lead returns, so lead can prepare state before the
+// replica serves requests. Run calls lost and returns when another replica
+// takes the Lease or a renewal has not succeeded for the renew deadline.
+func (e *leaderElector) Run(ctx context.Context, lead func(ctx context.Context), lost func()) {
+	ticker := time.NewTicker(e.retry)
+	defer ticker.Stop()
+	var lastRenew time.Time
+	for {
+		ok, err := e.tryAcquireOrRenew(ctx, time.Now())
+		switch {
+		case ok && lastRenew.IsZero():
+			e.log.WithField("identity", e.identity).Info("Acquired controller leadership")
+			lead(ctx)
+			e.mu.Lock()
+			e.leading = true
+			e.mu.Unlock()
+			leaderTransitions.Inc()
+			leaderGauge.Set(1)
+			lastRenew = time.Now()
+		case ok:
+			lastRenew = time.Now()
+		case !lastRenew.IsZero() && (err == nil || time.Since(lastRenew) > e.deadline):
+			e.mu.Lock()
+			e.leading = false
+			e.mu.Unlock()
+			leaderGauge.Set(0)
+			if err == nil {
+				e.log.Error("Another replica took over controller leadership")
+			} else {
+				e.log.WithError(err).Error("Failed to renew controller leadership")
+			}
+			lost()
+			return
+		case err != nil:
+			e.log.WithError(err).Warn("Leader election failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquireOrRenew reads the Lease and takes or renews it if it is free,
+// expired or already held, and reports whether this replica holds it.
+func (e *leaderElector) tryAcquireOrRenew(ctx context.Context, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.retry+e.deadline/2)
+	defer cancel()
+	var lease coordinationv1.Lease
+	err := e.client.Get(ctx, e.path(), &lease)
+	if kube.IsStatus(err, http.StatusNotFound) {
+		return e.write(ctx, nil, now)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	record := holder
+	if lease.Spec.RenewTime != nil {
+		record += "@" + lease.Spec.RenewTime.UTC().Format(time.RFC3339Nano)
+	}
+	e.mu.Lock()
+	if record != e.observed {
+		e.observed, e.observedAt = record, now
+	}
+	duration := e.duration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	held := holder != "" && holder != e.identity && now.Before(e.observedAt.Add(duration))
+	if held {
+		e.leading = false
+		e.holder, e.holderAddress = holder, lease.Annotations[annotationLeaderAddress]
+	}
+	e.mu.Unlock()
+	if held {
+		return false, nil
+	}
+	return e.write(ctx, &lease, now)
+}
+
+// write creates the Lease, when current is nil, or takes over or renews
+// current. A conflict means another replica wrote it first.
+func (e *leaderElector) write(ctx context.Context, current *coordinationv1.Lease, now time.Time) (bool, error) {
+	seconds := int32(e.duration / time.Second)
+	renew := metav1.NewMicroTime(now)
+	lease := &coordinationv1.Lease{
+		TypeMeta: metav1.TypeMeta{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"},
+	}
+	method, path := http.MethodPost, e.leases
+	if current != nil {
+		lease.ObjectMeta = current.ObjectMeta
+		lease.Spec = current.Spec
+		method, path = http.MethodPut, e.path()
+	} else {
+		lease.Name = e.name
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != e.identity {
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil && current != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.HolderIdentity = &e.identity
+		lease.Spec.AcquireTime = &renew
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &renew
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[annotationLeaderAddress] = e.address
+
+	var written coordinationv1.Lease
+	if err := e.client.Send(ctx, method, path, "application/json", lease, &written); err != nil {
+		if kube.IsStatus(err, http.StatusConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+	e.mu.Lock()
+	e.holder, e.holderAddress = e.identity, e.address
+	e.lease = &written
+	e.mu.Unlock()
+	return true, nil
+}
+
+// Release gives up the Lease, if held, so another replica can take over
+// at once instead of after it expires.
+func (e *leaderElector) Release(ctx context.Context) error {
+	e.mu.Lock()
+	lease := e.lease
+	leading := e.leading
+	e.leading = false
+	e.mu.Unlock()
+	if !leading || lease == nil {
+		return nil
+	}
+	leaderGauge.Set(0)
+	released := lease.DeepCopy()
+	released.Spec.HolderIdentity = nil
+	one := int32(1)
+	released.Spec.LeaseDurationSeconds = &one
+	delete(released.Annotations, annotationLeaderAddress)
+	return e.client.Send(ctx, http.MethodPut, e.path(), "application/json", released, nil)
+}
+
+func (e *leaderElector) path() string {
+	return e.leases + "/" + url.PathEscape(e.name)
+}
+
+// ReleaseLeadership gives up the leader Lease on shutdown. It is a no-op
+// without leader election or when this replica is not the leader.
+func (c *Controller) ReleaseLeadership(ctx context.Context) error {
+	if c.leader == nil {
+		return nil
+	}
+	return c.leader.Release(ctx)
+}
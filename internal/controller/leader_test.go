@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// fakeLeases serves a single Lease, rejecting writes with a stale resource
+// version the way the API server does.
+type fakeLeases struct {
+	mu      sync.Mutex
+	lease   *coordinationv1.Lease
+	version int
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		if f.lease == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+	case http.MethodPost, http.MethodPut:
+		var lease coordinationv1.Lease
+		json.NewDecoder(r.Body).Decode(&lease)
+		if (r.Method == http.MethodPost) != (f.lease == nil) ||
+			f.lease != nil && lease.ResourceVersion != f.lease.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.version++
+		lease.ResourceVersion = strconv.Itoa(f.version)
+		f.lease = &lease
+		json.NewEncoder(w).Encode(f.lease)
+	}
+}
+
+func (f *fakeLeases) holder() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lease == nil || f.lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *f.lease.Spec.HolderIdentity
+}
+
+func newTestElector(url, identity string) *leaderElector {
+	return &leaderElector{
+		client:   kube.NewClient(url, http.DefaultClient),
+		leases:   "/apis/coordination.k8s.io/v1/namespaces/apss-system/leases",
+		name:     "apss-controller",
+		identity: identity,
+		address:  "http://" + identity + ":8080",
+		duration: 15 * time.Second,
+		deadline: 10 * time.Second,
+		retry:    2 * time.Second,
+		log:      logrus.New(),
+	}
+}
+
+func TestLeaderElector_AcquireAndFollow(t *testing.T) {
+	leases := &fakeLeases{}
+	srv := httptest.NewServer(leases)
+	defer srv.Close()
+	a, b := newTestElector(srv.URL, "pod-a"), newTestElector(srv.URL, "pod-b")
+	ctx := context.Background()
+	now := time.Now()
+
+	if ok, err := a.tryAcquireOrRenew(ctx, now); !ok || err != nil {
+		t.Fatalf("acquire free lease = %v, %v", ok, err)
+	}
+	if leases.holder() != "pod-a" || leases.lease.Annotations[annotationLeaderAddress] != "http://pod-a:8080" {
+		t.Fatalf("lease = %+v", leases.lease)
+	}
+
+	// b follows while a's lease is valid, and learns where a serves.
+	if ok, err := b.tryAcquireOrRenew(ctx, now); ok || err != nil {
+		t.Fatalf("acquire held lease = %v, %v", ok, err)
+	}
+	if b.holder != "pod-a" || b.holderAddress != "http://pod-a:8080" {
+		t.Errorf("follower sees holder %q at %q", b.holder, b.holderAddress)
+	}
+	if ok, _ := a.tryAcquireOrRenew(ctx, now.Add(time.Second)); !ok {
+		t.Fatal("holder failed to renew")
+	}
+
+	// A record unchanged for the lease duration on b's clock is taken over.
+	if ok, _ := b.tryAcquireOrRenew(ctx, now.Add(2*time.Second)); ok {
+		t.Fatal("renewed lease taken over")
+	}
+	if ok, err := b.tryAcquireOrRenew(ctx, now.Add(20*time.Second)); !ok || err != nil {
+		t.Fatalf("take over expired lease = %v, %v", ok, err)
+	}
+	if leases.holder() != "pod-b" || *leases.lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("lease after takeover = %+v", leases.lease.Spec)
+	}
+
+	// a's write based on its stale copy conflicts.
+	var stale coordinationv1.Lease
+	a.lease.DeepCopyInto(&stale)
+	if ok, err := a.write(ctx, &stale, now.Add(20*time.Second)); ok || err != nil {
+		t.Errorf("stale write = %v, %v", ok, err)
+	}
+}
+
+func TestLeaderElector_Release(t *testing.T) {
+	leases := &fakeLeases{}
+	srv := httptest.NewServer(leases)
+	defer srv.Close()
+	a, b := newTestElector(srv.URL, "pod-a"), newTestElector(srv.URL, "pod-b")
+	ctx := context.Background()
+	now := time.Now()
+
+	a.tryAcquireOrRenew(ctx, now)
+	a.leading = true
+	if err := a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if leases.holder() != "" || a.leading {
+		t.Fatalf("released lease held by %q", leases.holder())
+	}
+	// A released lease is free at once.
+	if ok, _ := b.tryAcquireOrRenew(ctx, now); !ok {
+		t.Error("released lease not acquired")
+	}
+}
+
+func TestLeaderElector_Run(t *testing.T) {
+	leases := &fakeLeases{}
+	srv := httptest.NewServer(leases)
+	defer srv.Close()
+	e := newTestElector(srv.URL, "pod-a")
+	e.retry = 10 * time.Millisecond
+	c := &Controller{leader: e}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	led := make(chan bool, 1)
+	lost := make(chan struct{})
+	go e.Run(ctx, func(context.Context) { led <- c.leading() }, func() { close(lost) })
+
+	select {
+	case leading := <-led:
+		if leading {
+			t.Error("replica leading before lead returned")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("lead not called")
+	}
+
+	// Another replica taking the lease ends the leadership.
+	leases.mu.Lock()
+	other := "pod-b"
+	leases.lease.Spec.HolderIdentity = &other
+	leases.lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now().Add(time.Minute)}
+	leases.mu.Unlock()
+	select {
+	case <-lost:
+	case <-time.After(2 * time.Second):
+		t.Fatal("lost not called")
+	}
+	if st := c.LeaderStatus(); st.Leading || st.Leader != "pod-b" {
+		t.Errorf("status = %+v", st)
+	}
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// Metric constructors record each metric in a catalog so integrations (e.g.
+// generated Grafana dashboards) follow metric renames and label changes
+// without a separate list to maintain.
+var (
+	metricCatalog   []types.MetricDesc
+	metricCatalogMu sync.Mutex
+)
+
+func catalogMetric(name, help, kind string, labels []string) {
+	metricCatalogMu.Lock()
+	defer metricCatalogMu.Unlock()
+	metricCatalog = append(metricCatalog, types.MetricDesc{
+		Name: name, Help: help, Type: kind, Labels: append([]string(nil), labels...),
+	})
+}
+
+func newCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	catalogMetric(opts.Name, opts.Help, types.MetricTypeCounter, nil)
+	return prometheus.NewCounter(opts)
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	catalogMetric(opts.Name, opts.Help, types.MetricTypeCounter, labels)
+	return prometheus.NewCounterVec(opts, labels)
+}
+
+func newGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	catalogMetric(opts.Name, opts.Help, types.MetricTypeGauge, nil)
+	return prometheus.NewGauge(opts)
+}
+
+func newGaugeVec(opts prometheus.GaugeOpts, labels []string) *prometheus.GaugeVec {
+	catalogMetric(opts.Name, opts.Help, types.MetricTypeGauge, labels)
+	return prometheus.NewGaugeVec(opts, labels)
+}
+
+func newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	catalogMetric(opts.Name, opts.Help, types.MetricTypeHistogram, labels)
+	return prometheus.NewHistogramVec(opts, labels)
+}
+
+// Metrics returns the controller's Prometheus metrics sorted by name.
+func Metrics() []types.MetricDesc {
+	metricCatalogMu.Lock()
+	out := append([]types.MetricDesc(nil), metricCatalog...)
+	metricCatalogMu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/version"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/otlp"
+)
+
+// otlpServiceName is the service.name resource attribute of exported records.
+const otlpServiceName = "apss-controller"
+
+// initOTLP exports events and alerts as OTLP log records when an endpoint
+// is configured. Records are sent by Start.
+func (c *Controller) initOTLP() {
+	if c.cfg.OTLPEndpoint == "" {
+		return
+	}
+	headers, err := otlp.ParseHeaders(c.cfg.OTLPHeaders)
+	if err != nil {
+		c.log.WithError(err).Error("Invalid OTLP headers, OTLP export disabled")
+		return
+	}
+	exp, err := otlp.NewExporter(otlp.Config{
+		Endpoint:      c.cfg.OTLPEndpoint,
+		Protocol:      c.cfg.OTLPProtocol,
+		Headers:       headers,
+		Scope:         otlp.Scope{Name: "github.com/invisible-tech/autopilot-security-sensor", Version: version.Version},
+		BatchSize:     c.cfg.OTLPBatchSize,
+		FlushInterval: c.cfg.OTLPFlushInterval,
+		Egress:        c.cfg.OTLPEgress,
+	}, c.log)
+	if err != nil {
+		c.log.WithError(err).Error("Invalid OTLP exporter config, OTLP export disabled")
+		return
+	}
+	warnInsecureEgress(c.log, "otlp", c.cfg.OTLPEgress)
+	c.otlp = exp
+	c.log.WithField("endpoint", c.cfg.OTLPEndpoint).WithField("protocol", c.cfg.OTLPProtocol).Info("Exporting events and alerts over OTLP")
+}
+
+// otlpSeverity maps an APSS severity to an OpenTelemetry severity number.
+func otlpSeverity(severity string) int32 {
+	switch severity {
+	case "CRITICAL":
+		return otlp.SeverityFatal
+	case "HIGH":
+		return otlp.SeverityError
+	case "MEDIUM":
+		return otlp.SeverityWarn
+	}
+	return otlp.SeverityInfo
+}
+
+// podResource returns the resource attributes of records about a pod and the
+// identity it runs as, which OpenTelemetry has no convention for yet.
+func podResource(podName, podNamespace string, id *types.Identity) []otlp.KeyValue {
+	res := []otlp.KeyValue{otlp.String("service.name", otlpServiceName)}
+	if podName != "" {
+		res = append(res, otlp.String("k8s.pod.name", podName))
+	}
+	if podNamespace != "" {
+		res = append(res, otlp.String("k8s.namespace.name", podNamespace))
+	}
+	if id != nil && id.ServiceAccount != "" {
+		res = append(res, otlp.String("apss.k8s.service_account", id.ServiceAccount))
+	}
+	if id != nil && id.GCPServiceAccount != "" {
+		res = append(res, otlp.String("apss.gcp.service_account", id.GCPServiceAccount))
+	}
+	return res
+}
+
+// jsonBody returns v as JSON for a record body, so backends that cannot
+// query attributes still get the full event or alert.
+func jsonBody(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// eventRecord maps an event onto an OTLP log record, using OpenTelemetry
+// semantic convention names where one exists and apss.* otherwise.
+func eventRecord(e *types.SecurityEvent) otlp.Record {
+	attrs := []otlp.KeyValue{
+		otlp.String("event.name", "apss.security_event"),
+		otlp.String("apss.event.id", e.ID),
+		otlp.String("apss.event.type", e.Type),
+		otlp.String("apss.agent.id", e.AgentID),
+	}
+	if p := e.Process; p != nil {
+		attrs = append(attrs,
+			otlp.Int("process.pid", p.PID),
+			otlp.Int("process.parent_pid", p.PPID),
+			otlp.String("process.executable.name", p.Name),
+		)
+		if p.ExePath != "" {
+			attrs = append(attrs, otlp.String("process.executable.path", p.ExePath))
+		}
+		if len(p.Cmdline) > 0 {
+			attrs = append(attrs, otlp.Strings("process.command_args", p.Cmdline))
+		}
+		if p.UID != nil {
+			attrs = append(attrs, otlp.Int("process.user.id", *p.UID))
+		}
+		if p.ExeHash != "" {
+			attrs = append(attrs, otlp.String("apss.process.exe_hash", p.ExeHash))
+		}
+		if len(p.SuspiciousIndicators) > 0 {
+			attrs = append(attrs, otlp.Strings("apss.indicators", p.SuspiciousIndicators))
+		}
+		if len(p.Ancestors) > 0 {
+			names := make([]string, len(p.Ancestors))
+			for i, a := range p.Ancestors {
+				names[i] = a.Name
+			}
+			attrs = append(attrs, otlp.Strings("apss.process.ancestors", names))
+		}
+		if len(p.Environment) > 0 {
+			env := make([]string, 0, len(p.Environment))
+			for k, v := range p.Environment {
+				env = append(env, k+"="+v)
+			}
+			sort.Strings(env)
+			attrs = append(attrs, otlp.Strings("apss.process.environment", env))
+		}
+		attrs = appendIOCAttrs(attrs, p.MatchedIOC)
+	}
+	if n := e.Network; n != nil {
+		attrs = append(attrs,
+			otlp.String("network.transport", strings.ToLower(n.Protocol)),
+			otlp.String("destination.address", n.DstIP),
+			otlp.Int("destination.port", n.DstPort),
+			otlp.Bool("apss.network.is_external", n.IsExternal),
+		)
+		if n.SrcIP != "" {
+			attrs = append(attrs, otlp.String("source.address", n.SrcIP), otlp.Int("source.port", n.SrcPort))
+		}
+		if n.Domain != "" {
+			attrs = append(attrs, otlp.String("server.address", n.Domain))
+		}
+		attrs = appendIOCAttrs(attrs, n.MatchedIOC)
+	}
+	if f := e.File; f != nil {
+		attrs = append(attrs, otlp.String("file.path", f.Path), otlp.String("apss.file.operation", f.Operation))
+		if len(f.Indicators) > 0 {
+			attrs = append(attrs, otlp.Strings("apss.indicators", f.Indicators))
+		}
+		attrs = appendIOCAttrs(attrs, f.MatchedIOC)
+	}
+	return otlp.Record{
+		Time:         eventTime(e),
+		ObservedTime: e.Timestamp,
+		Severity:     otlpSeverity(e.Severity),
+		SeverityText: e.Severity,
+		Body:         jsonBody(e),
+		Resource:     podResource(e.PodName, e.PodNamespace, e.Identity),
+		Attributes:   attrs,
+	}
+}
+
+func appendIOCAttrs(attrs []otlp.KeyValue, m *types.IOCMatch) []otlp.KeyValue {
+	if m == nil {
+		return attrs
+	}
+	return append(attrs,
+		otlp.String("apss.ioc.type", m.Type),
+		otlp.String("apss.ioc.indicator", m.Indicator),
+		otlp.String("apss.ioc.feed", m.Feed),
+	)
+}
+
+// alertRecord maps an alert onto an OTLP log record. MITRE ATT&CK fields use
+// the threat.* names of the Elastic Common Schema, which OpenTelemetry has
+// no convention for yet.
+func alertRecord(a *types.Alert) otlp.Record {
+	attrs := []otlp.KeyValue{
+		otlp.String("event.name", "apss.alert"),
+		otlp.String("apss.alert.id", a.ID),
+		otlp.String("apss.rule.id", a.RuleID),
+		otlp.String("apss.rule.name", a.RuleName),
+		otlp.String("apss.alert.status", a.Status),
+	}
+	if a.MitreTactic != "" {
+		attrs = append(attrs, otlp.String("threat.tactic.name", a.MitreTactic))
+	}
+	if a.MitreID != "" {
+		attrs = append(attrs, otlp.String("threat.technique.id", a.MitreID))
+	}
+	if len(a.EventIDs) > 0 {
+		attrs = append(attrs, otlp.Strings("apss.event.ids", a.EventIDs))
+	}
+	if a.IncidentID != "" {
+		attrs = append(attrs, otlp.String("apss.incident.id", a.IncidentID))
+	}
+	r := otlp.Record{
+		Time:         a.Timestamp,
+		Severity:     otlpSeverity(a.Severity),
+		SeverityText: a.Severity,
+		Body:         jsonBody(a),
+		Resource:     podResource(a.PodName, a.PodNS, a.Identity),
+		Attributes:   attrs,
+	}
+	if a.ObservedAt != nil {
+		r.ObservedTime = *a.ObservedAt
+	}
+	return r
+}
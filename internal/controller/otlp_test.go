@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/otlp"
+)
+
+func attrMap(kvs []otlp.KeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestEventRecord(t *testing.T) {
+	observed := time.Unix(1700000100, 0)
+	occurred := time.Unix(1700000000, 0)
+	uid := 1000
+	ev := &types.SecurityEvent{
+		ID: "ev-1", AgentID: "agent-1", Type: "process_start", Severity: "HIGH",
+		Timestamp: observed, OccurredAt: &occurred, PodName: "api-0", PodNamespace: "payments",
+		Process: &types.ProcessEventData{
+			PID: 42, PPID: 1, Name: "curl", Cmdline: []string{"curl", "x"}, UID: &uid,
+			MatchedIOC:  &types.IOCMatch{Type: types.IOCTypeHash, Indicator: "abc", Feed: "local"},
+			Ancestors:   []types.ProcessAncestor{{PID: 7, Name: "sh"}, {PID: 1, Name: "nginx"}},
+			Environment: map[string]string{"LD_PRELOAD": "/tmp/x.so", "HISTFILE": "/dev/null"},
+		},
+		Network:  &types.NetworkEventData{Protocol: "TCP", DstIP: "203.0.113.7", DstPort: 443, IsExternal: true},
+		Identity: &types.Identity{ServiceAccount: "api", GCPServiceAccount: "api@proj.iam.gserviceaccount.com"},
+	}
+	r := eventRecord(ev)
+	if !r.Time.Equal(occurred) || !r.ObservedTime.Equal(observed) {
+		t.Errorf("times = %v, %v; want occurred_at and timestamp", r.Time, r.ObservedTime)
+	}
+	if r.Severity != otlp.SeverityError || r.SeverityText != "HIGH" || r.Body == "" {
+		t.Errorf("record = %+v", r)
+	}
+	res := attrMap(r.Resource)
+	if res["k8s.pod.name"] != "api-0" || res["k8s.namespace.name"] != "payments" || res["service.name"] != otlpServiceName {
+		t.Errorf("resource = %v", res)
+	}
+	if res["apss.k8s.service_account"] != "api" || res["apss.gcp.service_account"] != "api@proj.iam.gserviceaccount.com" {
+		t.Errorf("identity resource = %v", res)
+	}
+	attrs := attrMap(r.Attributes)
+	for key, want := range map[string]interface{}{
+		"apss.event.id": "ev-1", "apss.agent.id": "agent-1", "process.pid": 42, "process.user.id": 1000,
+		"network.transport": "tcp", "destination.port": 443, "apss.network.is_external": true, "apss.ioc.feed": "local",
+	} {
+		if attrs[key] != want {
+			t.Errorf("attribute %s = %v, want %v", key, attrs[key], want)
+		}
+	}
+	if got := fmt.Sprint(attrs["apss.process.ancestors"]); got != "[sh nginx]" {
+		t.Errorf("apss.process.ancestors = %s, want [sh nginx]", got)
+	}
+	if got := fmt.Sprint(attrs["apss.process.environment"]); got != "[HISTFILE=/dev/null LD_PRELOAD=/tmp/x.so]" {
+		t.Errorf("apss.process.environment = %s", got)
+	}
+}
+
+func TestAlertRecord(t *testing.T) {
+	observed := time.Unix(1700000000, 0)
+	a := &types.Alert{
+		ID: "alert-1", Timestamp: observed.Add(time.Second), Severity: "CRITICAL", RuleID: "APSS-001",
+		RuleName: "Reverse Shell", PodName: "api-0", PodNS: "payments", MitreTactic: "Execution",
+		MitreID: "T1059", Status: types.AlertStatusOpen, EventIDs: []string{"ev-1"}, ObservedAt: &observed,
+	}
+	r := alertRecord(a)
+	if r.Severity != otlp.SeverityFatal || !r.ObservedTime.Equal(observed) {
+		t.Errorf("record = %+v", r)
+	}
+	attrs := attrMap(r.Attributes)
+	if attrs["threat.tactic.name"] != "Execution" || attrs["threat.technique.id"] != "T1059" || attrs["apss.rule.id"] != "APSS-001" {
+		t.Errorf("attributes = %v", attrs)
+	}
+	if res := attrMap(r.Resource); res["k8s.pod.name"] != "api-0" {
+		t.Errorf("resource = %v", res)
+	}
+}
+
+func TestOTLPSeverity(t *testing.T) {
+	for severity, want := range map[string]int32{
+		"CRITICAL": otlp.SeverityFatal, "HIGH": otlp.SeverityError, "MEDIUM": otlp.SeverityWarn, "LOW": otlp.SeverityInfo, "": otlp.SeverityInfo,
+	} {
+		if got := otlpSeverity(severity); got != want {
+			t.Errorf("otlpSeverity(%q) = %d, want %d", severity, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ErrIncompatibleAgent is returned by Handshake when the agent and the
+// controller share no protocol or schema version.
+var ErrIncompatibleAgent = errors.New("agent is incompatible with this controller")
+
+// servedCapabilities are the capabilities this controller can grant. It
+// serves no gRPC API, so grpc is never granted.
+var servedCapabilities = map[string]bool{types.CapabilityBatch: true, types.CapabilityGzip: true}
+
+// ingestedSchemas are the payload schemas this controller ingests, newest
+// first. v1 payloads are converted on ingest.
+var ingestedSchemas = []string{types.SchemaVersionV2, types.SchemaVersionV1}
+
+var agentHandshakes = newCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_agent_handshakes_total",
+		Help: "Agent protocol handshakes, by negotiated protocol version or \"incompatible\"",
+	},
+	[]string{"protocol"},
+)
+
+func init() {
+	prometheus.MustRegister(agentHandshakes)
+}
+
+// minProtocol is the oldest protocol version agents may speak.
+func (c *Controller) minProtocol() int {
+	if c.cfg.AgentMinProtocol < types.ProtocolV1 {
+		return types.ProtocolV1
+	}
+	return c.cfg.AgentMinProtocol
+}
+
+// Handshake picks the newest protocol version, no older than
+// AgentMinProtocol, and the newest schema version the agent and controller
+// share, and grants the capabilities the agent offers that
+// AgentCapabilities allow. The outcome is shown on the agent in GetAgents.
+// An agent sharing no version gets a response with Error set and
+// ErrIncompatibleAgent.
+func (c *Controller) Handshake(h *types.AgentHandshake) (*types.HandshakeResponse, error) {
+	if h.AgentID == "" {
+		return nil, fmt.Errorf("handshake missing agent_id")
+	}
+	resp := &types.HandshakeResponse{Capabilities: []string{}}
+	for _, v := range h.ProtocolVersions {
+		if v >= c.minProtocol() && v <= types.CurrentProtocol && v > resp.ProtocolVersion {
+			resp.ProtocolVersion = v
+		}
+	}
+	schemas := h.SchemaVersions
+	if len(schemas) == 0 {
+		schemas = []string{types.SchemaVersionV1}
+	}
+	for _, s := range ingestedSchemas {
+		if slices.Contains(schemas, s) {
+			resp.SchemaVersion = s
+			break
+		}
+	}
+	switch {
+	case resp.ProtocolVersion == 0:
+		resp.Error = fmt.Sprintf("agent speaks protocol %s, controller accepts %d to %d",
+			joinInts(h.ProtocolVersions), c.minProtocol(), types.CurrentProtocol)
+	case resp.SchemaVersion == "":
+		resp.Error = fmt.Sprintf("agent sends schema %s, controller ingests %s",
+			strings.Join(schemas, ","), strings.Join(ingestedSchemas, ","))
+	case resp.ProtocolVersion >= types.ProtocolV2:
+		// Protocol 1 posts single uncompressed events, whatever the agent
+		// offers.
+		for _, name := range h.Capabilities {
+			if servedCapabilities[name] && slices.Contains(c.cfg.AgentCapabilities, name) {
+				resp.Capabilities = append(resp.Capabilities, name)
+			}
+		}
+		resp.MaxBatchEvents = c.cfg.MaxBatchEvents
+		resp.MaxRequestBytes = c.cfg.MaxRequestBytes
+	}
+
+	now := time.Now()
+	c.agentsMu.Lock()
+	agent, ok := c.agents[h.AgentID]
+	if !ok {
+		agent = &types.AgentInfo{ID: h.AgentID, ConnectedAt: now}
+		c.agents[h.AgentID] = agent
+	}
+	if h.Version != "" {
+		agent.Version = h.Version
+	}
+	agent.LastSeen = now
+	agent.Protocol = &types.AgentProtocol{
+		Version:      resp.ProtocolVersion,
+		Capabilities: resp.Capabilities,
+		Negotiated:   true,
+		Incompatible: resp.Error,
+	}
+	c.agentsMu.Unlock()
+
+	fields := logrus.Fields{"agent_id": h.AgentID, "version": h.Version}
+	if resp.Error != "" {
+		agentHandshakes.WithLabelValues("incompatible").Inc()
+		c.log.WithFields(fields).WithField("reason", resp.Error).Warn("Agent is incompatible with this controller")
+		return resp, fmt.Errorf("%w: %s", ErrIncompatibleAgent, resp.Error)
+	}
+	agentHandshakes.WithLabelValues(strconv.Itoa(resp.ProtocolVersion)).Inc()
+	fields["protocol"], fields["schema_version"], fields["capabilities"] = resp.ProtocolVersion, resp.SchemaVersion, resp.Capabilities
+	c.log.WithFields(fields).Debug("Agent negotiated protocol")
+	return resp, nil
+}
+
+// agentProtocol is the protocol of an agent that sent no handshake.
+func (c *Controller) agentProtocol() *types.AgentProtocol {
+	p := &types.AgentProtocol{Version: types.ProtocolV1}
+	if oldest := c.minProtocol(); oldest > types.ProtocolV1 {
+		p.Incompatible = fmt.Sprintf("agent sent no handshake and speaks protocol 1, controller accepts %d to %d",
+			oldest, types.CurrentProtocol)
+	}
+	return p
+}
+
+func joinInts(ints []int) string {
+	if len(ints) == 0 {
+		return "none"
+	}
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
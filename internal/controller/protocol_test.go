@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_Handshake(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, AgentCapabilities: []string{"batch", "gzip"}}, logrus.New())
+
+	// A protocol 1 agent that handshakes is told to send single events.
+	resp, err := c.Handshake(&types.AgentHandshake{AgentID: "a1", Version: "1.0", ProtocolVersions: []int{1}, Capabilities: []string{"batch"}})
+	if err != nil || resp.ProtocolVersion != 1 || resp.SchemaVersion != types.SchemaVersionV1 || len(resp.Capabilities) != 0 {
+		t.Errorf("protocol 1 handshake = %+v, %v", resp, err)
+	}
+	resp, err = c.Handshake(&types.AgentHandshake{AgentID: "a2", ProtocolVersions: []int{2}, SchemaVersions: []string{"v3"}})
+	if !errors.Is(err, ErrIncompatibleAgent) || resp.Error == "" {
+		t.Errorf("unknown schema handshake = %+v, %v", resp, err)
+	}
+
+	// Registering another build without a handshake drops the negotiated
+	// protocol.
+	c.RegisterAgent(&types.AgentRegistration{AgentID: "a1", Version: "1.0"})
+	c.RegisterAgent(&types.AgentRegistration{AgentID: "a2", Version: "0.9"})
+	for _, a := range c.GetAgents() {
+		if negotiated := a.ID == "a1"; a.Protocol.Negotiated != negotiated {
+			t.Errorf("agent %s protocol = %+v", a.ID, a.Protocol)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrRateLimited is returned by IngestEvent, in a *RateLimitError, for an
+// event its agent sent over AgentEventRate.
+var ErrRateLimited = errors.New("agent is over its event rate")
+
+// throttledWindow is how recently an agent must have been throttled to be
+// counted in apss_agents_throttled.
+const throttledWindow = time.Minute
+
+var (
+	eventsThrottled = newCounter(prometheus.CounterOpts{
+		Name: "apss_events_throttled_total",
+		Help: "Events rejected because their agent was over its event rate",
+	})
+	agentsThrottled = newGauge(prometheus.GaugeOpts{
+		Name: "apss_agents_throttled",
+		Help: "Agents with events rejected for their event rate in the last minute",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(eventsThrottled, agentsThrottled)
+}
+
+// RateLimitError is an event rejected because its agent was over its event
+// rate, and how long until the agent may send another.
+type RateLimitError struct {
+	AgentID    string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("agent %s is over its event rate; retry after %s", e.AgentID, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// tokenBucket holds up to burst tokens, refilled at the limiter's rate. An
+// event takes one token.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// callerKey marks the context of an ingestion request with who sent it.
+type callerKey struct{}
+
+// WithCaller returns ctx marked as from caller, such as the IP of the pod an
+// event was sent from. IngestEvent limits event rates per caller, as the
+// agent ID in an event is whatever its sender says.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// rateLimiter keeps a token bucket per agent.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter returns nil, which allows everything, when rate is not
+// positive. The burst is at least one event.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, burst: math.Max(float64(burst), 1), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from key's bucket at now. When the bucket is empty it
+// returns false and how long until it holds a token again.
+func (l *rateLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+}
+
+// prune drops the buckets that have refilled by now, which are the same as
+// no bucket, so agents that went away are not kept.
+func (l *rateLimiter) prune(now time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// admitEvent applies the event rate of ctx's caller to one event of agent
+// agentID, recording it on the agent when it is throttled. Events ingested
+// without a caller, from within the controller, are limited per agent ID.
+func (c *Controller) admitEvent(ctx context.Context, agentID string, now time.Time) error {
+	key, ok := ctx.Value(callerKey{}).(string)
+	if !ok {
+		key = agentID
+	}
+	wait, ok := c.eventLimiter.allow(key, now)
+	if ok {
+		return nil
+	}
+	eventsThrottled.Inc()
+	c.agentsMu.Lock()
+	if agent, ok := c.agents[agentID]; ok {
+		agent.ThrottledEvents++
+		agent.LastThrottledAt = &now
+	}
+	c.agentsMu.Unlock()
+	// Whole seconds, as sent in Retry-After.
+	return &RateLimitError{AgentID: agentID, RetryAfter: time.Duration(math.Ceil(wait.Seconds())) * time.Second}
+}
+
+// updateThrottledGauge refreshes apss_agents_throttled. Caller must hold
+// agentsMu.
+func (c *Controller) updateThrottledGauge(now time.Time) {
+	n := 0
+	for _, agent := range c.agents {
+		if agent.LastThrottledAt != nil && now.Sub(*agent.LastThrottledAt) < throttledWindow {
+			n++
+		}
+	}
+	agentsThrottled.Set(float64(n))
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, ok := l.allow("a", now); !ok {
+			t.Fatalf("event %d of the burst throttled", i)
+		}
+	}
+	if wait, ok := l.allow("a", now); ok || wait != 500*time.Millisecond {
+		t.Errorf("over the burst = %v, %v", wait, ok)
+	}
+	if _, ok := l.allow("b", now); !ok {
+		t.Error("another agent throttled")
+	}
+	if _, ok := l.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("refilled token not taken")
+	}
+
+	l.prune(now.Add(time.Second))
+	if _, ok := l.buckets["b"]; ok || len(l.buckets) != 1 {
+		t.Errorf("buckets after prune = %v", l.buckets)
+	}
+	if newRateLimiter(0, 10) != nil {
+		t.Error("zero rate limits events")
+	}
+}
+
+func TestController_IngestEvent_RateLimited(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, AgentEventRate: 1, AgentEventBurst: 2}, logrus.New())
+	ingest := func() error {
+		return c.IngestEvent(context.Background(), &types.SecurityEvent{ID: "e", AgentID: "noisy", Type: "process_start", Severity: "LOW"})
+	}
+	ingest()
+	ingest()
+	err := ingest()
+	var limited *RateLimitError
+	if !errors.As(err, &limited) || !errors.Is(err, ErrRateLimited) || limited.RetryAfter != time.Second {
+		t.Fatalf("third event = %v", err)
+	}
+	agents := c.GetAgents()
+	if len(agents) != 1 || agents[0].EventCount != 2 || agents[0].ThrottledEvents != 1 || agents[0].LastThrottledAt == nil {
+		t.Errorf("agent = %+v", agents[0])
+	}
+}
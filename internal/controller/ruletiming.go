@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/detection"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// slowRuleStrikes is how many evaluations in a row at or over the slow rule
+// threshold make a rule slow, so one GC pause or outsized event does not.
+const slowRuleStrikes = 5
+
+var (
+	ruleEvalSeconds = newHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "apss_rule_evaluation_seconds",
+			Help:    "Time to evaluate a detection rule against one event",
+			Buckets: []float64{1e-6, 5e-6, 25e-6, 100e-6, 500e-6, 2.5e-3, 10e-3, 50e-3},
+		},
+		[]string{"rule"},
+	)
+	ruleEvalMatches = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_rule_evaluation_matches_total",
+			Help: "Events a detection rule matched, including shadow and suppressed matches",
+		},
+		[]string{"rule"},
+	)
+	slowRulesGauge = newGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_slow_rule",
+			Help: "Whether a detection rule is over the slow rule threshold",
+		},
+		[]string{"rule"},
+	)
+	slowRuleDisables = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_slow_rule_disables_total",
+			Help: "Detection rules disabled for being slow",
+		},
+		[]string{"rule"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(ruleEvalSeconds, ruleEvalMatches, slowRulesGauge, slowRuleDisables)
+}
+
+// ruleTiming is the evaluation timing of one rule. Its fields are updated
+// by every event processing worker, so they are atomic.
+type ruleTiming struct {
+	seconds prometheus.Observer
+	matches prometheus.Counter
+	strikes atomic.Int32
+	slow    atomic.Bool
+	// last is the latest evaluation time, for logging.
+	last atomic.Int64
+}
+
+// ruleTimings times every rule's evaluations and spots slow rules. rules is
+// built before events are evaluated and only read after.
+type ruleTimings struct {
+	threshold time.Duration
+	rules     map[string]*ruleTiming
+
+	// flagged holds the IDs of rules that turned slow and were not handled
+	// yet; pending is set while it is not empty.
+	mu      sync.Mutex
+	flagged []string
+	pending atomic.Bool
+}
+
+// initRuleTimings times every rule the engine has loaded.
+func (c *Controller) initRuleTimings() {
+	t := &ruleTimings{threshold: c.cfg.SlowRuleThreshold, rules: make(map[string]*ruleTiming)}
+	for _, r := range c.engine.Rules() {
+		t.rules[r.ID] = &ruleTiming{
+			seconds: ruleEvalSeconds.WithLabelValues(r.ID),
+			matches: ruleEvalMatches.WithLabelValues(r.ID),
+		}
+	}
+	c.ruleTimings = t
+	c.engine.SetObserver(t.observe)
+}
+
+// observe records one evaluation of rule. It runs inside Engine.Evaluate,
+// so a rule that turns slow is only flagged here and handled afterwards by
+// handleSlowRules.
+func (t *ruleTimings) observe(rule *detection.Rule, took time.Duration, matched bool) {
+	rt := t.rules[rule.ID]
+	if rt == nil {
+		return
+	}
+	rt.seconds.Observe(took.Seconds())
+	if matched {
+		rt.matches.Inc()
+	}
+	if t.threshold <= 0 {
+		return
+	}
+	if took < t.threshold {
+		rt.strikes.Store(0)
+		if rt.slow.CompareAndSwap(true, false) {
+			slowRulesGauge.WithLabelValues(rule.ID).Set(0)
+		}
+		return
+	}
+	rt.last.Store(int64(took))
+	if rt.strikes.Add(1) >= slowRuleStrikes && rt.slow.CompareAndSwap(false, true) {
+		slowRulesGauge.WithLabelValues(rule.ID).Set(1)
+		t.mu.Lock()
+		t.flagged = append(t.flagged, rule.ID)
+		t.pending.Store(true)
+		t.mu.Unlock()
+	}
+}
+
+// isSlow reports whether rule id is currently slow.
+func (t *ruleTimings) isSlow(id string) bool {
+	rt := t.rules[id]
+	return rt != nil && rt.slow.Load()
+}
+
+// reset clears rule id's slow state, such as when it is re-enabled.
+func (t *ruleTimings) reset(id string) {
+	if rt := t.rules[id]; rt != nil {
+		rt.strikes.Store(0)
+		if rt.slow.CompareAndSwap(true, false) {
+			slowRulesGauge.WithLabelValues(id).Set(0)
+		}
+	}
+}
+
+// handleSlowRules warns about the rules that turned slow since it last ran
+// and, with SlowRuleDisable, disables them to protect ingestion.
+func (c *Controller) handleSlowRules() {
+	t := c.ruleTimings
+	if t == nil || !t.pending.Load() {
+		return
+	}
+	t.mu.Lock()
+	flagged := t.flagged
+	t.flagged = nil
+	t.pending.Store(false)
+	t.mu.Unlock()
+
+	for _, id := range flagged {
+		log := c.log.WithFields(logrus.Fields{
+			"rule_id":   id,
+			"threshold": t.threshold,
+			"took":      time.Duration(t.rules[id].last.Load()),
+		})
+		if !c.cfg.SlowRuleDisable {
+			log.Warn("Detection rule is slow")
+			continue
+		}
+		c.engine.SetDisabled(id, true)
+		c.ruleStats.mu.Lock()
+		c.ruleStats.disabled[id] = true
+		c.ruleStats.mu.Unlock()
+		slowRuleDisables.WithLabelValues(id).Inc()
+		log.Error("Detection rule is slow, disabled")
+	}
+}
+
+// SetRuleDisabled stops or resumes evaluating rule id and returns its
+// coverage. The change is kept in the controller state.
+func (c *Controller) SetRuleDisabled(id string, disabled bool) (*types.RuleCoverage, error) {
+	if !c.engine.SetDisabled(id, disabled) {
+		return nil, ErrRuleNotFound
+	}
+	c.ruleStats.mu.Lock()
+	if disabled {
+		c.ruleStats.disabled[id] = true
+	} else {
+		delete(c.ruleStats.disabled, id)
+	}
+	c.ruleStats.mu.Unlock()
+	if !disabled && c.ruleTimings != nil {
+		c.ruleTimings.reset(id)
+	}
+
+	c.log.WithFields(logrus.Fields{"rule_id": id, "disabled": disabled}).Info("Rule evaluation changed")
+	return c.ruleCoverage(id)
+}
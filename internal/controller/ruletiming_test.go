@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/detection"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_SlowRules(t *testing.T) {
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		SlowRuleThreshold: time.Millisecond, SlowRuleDisable: true,
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+	c := New(cfg, logrus.New())
+	c.engine.AddRules(&detection.Rule{
+		ID: "SLOW-1", Name: "Slow Rule", Severity: "LOW",
+		Condition: func(*types.SecurityEvent) bool { time.Sleep(2 * time.Millisecond); return true },
+	})
+	c.initRuleTimings()
+
+	ev := &types.SecurityEvent{ID: "ev", AgentID: "a", Type: "process_start", Severity: "INFO", PodName: "p", PodNamespace: "ns"}
+	for i := 0; i < slowRuleStrikes-1; i++ {
+		c.evaluateEvent(ev)
+	}
+	if rc := ruleCoverage(c, "SLOW-1"); rc.Slow || rc.Disabled {
+		t.Fatalf("slow before %d strikes: %+v", slowRuleStrikes, rc)
+	}
+	c.evaluateEvent(ev)
+	if rc := ruleCoverage(c, "SLOW-1"); !rc.Slow || !rc.Disabled {
+		t.Fatalf("coverage after %d slow evaluations = %+v", slowRuleStrikes, rc)
+	}
+	if c.engine.Evaluate(ev) != nil {
+		t.Error("disabled rule evaluated")
+	}
+
+	rc, err := c.SetRuleDisabled("SLOW-1", false)
+	if err != nil || rc.Disabled || rc.Slow {
+		t.Errorf("SetRuleDisabled = %+v, %v", rc, err)
+	}
+
+	// Disabled rules stay disabled across a restart.
+	if _, err := c.SetRuleDisabled("APSS-002", true); err != nil {
+		t.Fatalf("SetRuleDisabled: %v", err)
+	}
+	if err := c.SaveState(); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	if restored := New(cfg, logrus.New()); !restored.engine.IsDisabled("APSS-002") {
+		t.Error("disabled rule enabled after restart")
+	}
+}
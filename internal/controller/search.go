@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/search"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ErrSearchDisabled is returned by searches when events are not retained.
+var ErrSearchDisabled = errors.New("event search disabled")
+
+// searchFieldNames name the fields searchEventFields returns, in order.
+var searchFieldNames = []string{
+	"process.name", "process.exe_path", "process.cmdline", "file.path", "network.dst_ip", "network.domain",
+}
+
+// searchEventFields returns the normalized searchable fields of e, one per
+// searchFieldNames entry, empty when e does not have it.
+func searchEventFields(e *types.SecurityEvent) []string {
+	fields := make([]string, len(searchFieldNames))
+	if p := e.Process; p != nil {
+		fields[0] = search.Normalize(p.Name)
+		fields[1] = search.Normalize(p.ExePath)
+		fields[2] = search.Normalize(strings.Join(p.Cmdline, " "))
+	}
+	if f := e.File; f != nil {
+		fields[3] = search.Normalize(f.Path)
+	}
+	if n := e.Network; n != nil {
+		fields[4] = search.Normalize(n.DstIP)
+		fields[5] = search.Normalize(n.Domain)
+	}
+	return fields
+}
+
+// SearchEvents returns a page of the retained events matching q, newest
+// first, and the total number of matches. Candidates come from a trigram
+// index of the searchable fields, so terms of three or more characters
+// avoid a scan of every event.
+func (c *Controller) SearchEvents(q types.SearchQuery) ([]types.SearchHit, int, error) {
+	if c.cfg.EventRetentionCount <= 0 {
+		return nil, 0, ErrSearchDisabled
+	}
+	terms := search.Terms(q.Text)
+	hits := []types.SearchHit{}
+	total := 0
+	if len(terms) == 0 {
+		return hits, 0, nil
+	}
+
+	c.eventsMu.RLock()
+	defer c.eventsMu.RUnlock()
+	ids, indexed := c.searchIndex.Candidates(terms)
+	n := len(c.events)
+	if indexed {
+		n = len(ids)
+	}
+	for i := n - 1; i >= 0; i-- {
+		pos := i
+		if indexed {
+			pos = int(ids[i] - c.eventsDropped)
+		}
+		e := c.events[pos]
+		if (q.Namespace != "" && e.PodNamespace != q.Namespace) || (q.Pod != "" && e.PodName != q.Pod) {
+			continue
+		}
+		fields := searchEventFields(e)
+		field, ok := search.Match(terms, fields)
+		if !ok {
+			continue
+		}
+		if total >= q.Offset && (q.Limit <= 0 || len(hits) < q.Limit) {
+			hits = append(hits, types.SearchHit{
+				ID: e.ID, Timestamp: e.Timestamp, Type: e.Type, Severity: e.Severity,
+				PodNamespace: e.PodNamespace, PodName: e.PodName,
+				Field: searchFieldNames[field], Value: searchFieldValue(e, field), Event: e,
+			})
+		}
+		total++
+	}
+	return hits, total, nil
+}
+
+// searchFieldValue is field i of e as reported, before normalization.
+func searchFieldValue(e *types.SecurityEvent, i int) string {
+	switch i {
+	case 0:
+		return e.Process.Name
+	case 1:
+		return e.Process.ExePath
+	case 2:
+		return truncate(strings.Join(e.Process.Cmdline, " "), search.MaxFieldLen)
+	case 3:
+		return e.File.Path
+	case 4:
+		return e.Network.DstIP
+	case 5:
+		return e.Network.Domain
+	}
+	return ""
+}
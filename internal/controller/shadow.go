@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ErrRuleNotFound is returned for an unknown detection rule ID.
+var ErrRuleNotFound = errors.New("rule not found")
+
+// maxShadowSamples bounds the shadow matches kept per rule.
+const maxShadowSamples = 10
+
+var shadowMatches = newCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_shadow_rule_matches_total",
+		Help: "Alerts rules in shadow mode would have raised",
+	},
+	[]string{"rule", "severity"},
+)
+
+func init() {
+	prometheus.MustRegister(shadowMatches)
+}
+
+// loadShadowRules puts the rules listed in ShadowRules in shadow mode.
+func (c *Controller) loadShadowRules() {
+	for _, id := range c.cfg.ShadowRules {
+		if !c.engine.SetShadow(id, true) {
+			c.log.WithField("rule_id", id).Warn("Unknown rule in SHADOW_RULES")
+		}
+	}
+}
+
+// recordShadowMatch counts an alert of a rule in shadow mode in place of
+// raising it.
+func (c *Controller) recordShadowMatch(alert *types.Alert) {
+	c.ruleStats.mu.Lock()
+	st := c.ruleStats.get(alert)
+	st.shadowMatches++
+	st.lastShadow = alert.Timestamp
+	st.samples = append(st.samples, types.ShadowMatch{
+		At: alert.Timestamp, PodName: alert.PodName, PodNS: alert.PodNS, EventIDs: alert.EventIDs,
+	})
+	if n := len(st.samples) - maxShadowSamples; n > 0 {
+		st.samples = append(st.samples[:0:0], st.samples[n:]...)
+	}
+	c.ruleStats.mu.Unlock()
+
+	shadowMatches.WithLabelValues(alert.RuleID, alert.Severity).Inc()
+	c.log.WithFields(logrus.Fields{
+		"rule_id": alert.RuleID, "severity": alert.Severity, "pod": alert.PodName,
+		"namespace": alert.PodNS, "event_ids": alert.EventIDs,
+	}).Info("Shadow rule matched")
+}
+
+// SetRuleShadow moves rule id into shadow mode or promotes it to active,
+// and returns its coverage. The change is kept in the controller state.
+func (c *Controller) SetRuleShadow(id string, shadow bool) (*types.RuleCoverage, error) {
+	if !c.engine.SetShadow(id, shadow) {
+		return nil, ErrRuleNotFound
+	}
+	c.ruleStats.mu.Lock()
+	c.ruleStats.modes[id] = shadow
+	c.ruleStats.mu.Unlock()
+
+	mode := "active"
+	if shadow {
+		mode = "shadow"
+	}
+	c.log.WithFields(logrus.Fields{"rule_id": id, "mode": mode}).Info("Rule mode changed")
+	return c.ruleCoverage(id)
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func reverseShellEvent(id string) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: id, AgentID: "a", Type: "network_connect", Severity: "HIGH", PodName: "p", PodNamespace: "ns",
+		Network: &types.NetworkEventData{DstIP: "1.2.3.4", DstPort: 4444, IsExternal: true},
+	}
+}
+
+func ruleCoverage(c *Controller, id string) *types.RuleCoverage {
+	for _, rc := range c.RuleCoverage() {
+		if rc.RuleID == id {
+			return rc
+		}
+	}
+	return nil
+}
+
+func TestController_ShadowRules(t *testing.T) {
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, ShadowRules: []string{"APSS-001", "APSS-999"},
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+	c := New(cfg, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	for _, id := range []string{"ev-1", "ev-2"} {
+		if err := c.IngestEvent(ctx, reverseShellEvent(id)); err != nil {
+			t.Fatalf("IngestEvent: %v", err)
+		}
+	}
+	time.Sleep(150 * time.Millisecond)
+	if alerts, _ := c.GetAlerts(types.AlertFilter{RuleID: "APSS-001"}); len(alerts) != 0 {
+		t.Fatalf("shadow rule raised %d alerts", len(alerts))
+	}
+	rc := ruleCoverage(c, "APSS-001")
+	if rc == nil || !rc.Shadow || rc.ShadowMatches != 2 || rc.Matches != 0 || rc.EverMatched || len(rc.ShadowSamples) != 2 {
+		t.Fatalf("shadow coverage = %+v", rc)
+	}
+	if s := rc.ShadowSamples[1]; s.PodName != "p" || s.PodNS != "ns" || len(s.EventIDs) != 1 || s.EventIDs[0] != "ev-2" {
+		t.Errorf("latest sample = %+v", s)
+	}
+
+	if _, err := c.SetRuleShadow("APSS-999", false); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("SetRuleShadow unknown rule: err = %v", err)
+	}
+	promoted, err := c.SetRuleShadow("APSS-001", false)
+	if err != nil || promoted.Shadow || promoted.ShadowMatches != 2 {
+		t.Fatalf("SetRuleShadow = %+v, %v", promoted, err)
+	}
+	if err := c.IngestEvent(ctx, reverseShellEvent("ev-3")); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if alerts, _ := c.GetAlerts(types.AlertFilter{RuleID: "APSS-001"}); len(alerts) != 1 {
+		t.Errorf("promoted rule raised %d alerts, want 1", len(alerts))
+	}
+
+	// The promotion outlives a restart that still lists the rule in
+	// SHADOW_RULES.
+	if err := c.SaveState(); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	restored := New(cfg, logrus.New())
+	if rc := ruleCoverage(restored, "APSS-001"); rc.Shadow || rc.ShadowMatches != 2 || rc.Matches != 1 {
+		t.Errorf("restored coverage = %+v", rc)
+	}
+}
@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/storage"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/shard"
+)
+
+// ErrShardingDisabled is returned by RoutingTable when replicas do not
+// shard agents between them.
+var ErrShardingDisabled = errors.New("sharding is not enabled on this controller")
+
+var (
+	shardMembers = newGauge(prometheus.GaugeOpts{
+		Name: "apss_shard_members",
+		Help: "Controller replicas in the routing table",
+	})
+	shardMisrouted = newCounter(prometheus.CounterOpts{
+		Name: "apss_shard_misrouted_events_total",
+		Help: "Events received for agents the routing table assigns to another replica",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(shardMembers, shardMisrouted)
+}
+
+// shardRouter keeps the routing table of the Ready controller pods.
+type shardRouter struct {
+	client *kube.Client
+	// pods is the path listing the controller pods.
+	pods    string
+	self    string
+	port    string
+	refresh time.Duration
+
+	mu    sync.RWMutex
+	table *shard.Table
+}
+
+// initSharding sets up the routing table when Sharding is on. Replicas
+// share alerts through Postgres, so without it, outside a cluster or
+// without a pod IP to be reached at, the controller runs unsharded.
+func (c *Controller) initSharding() {
+	if !c.cfg.Sharding {
+		return
+	}
+	switch {
+	case c.kube == nil:
+		c.log.Error("SHARDING needs the Kubernetes API, running unsharded")
+		return
+	case c.cfg.PodIP == "":
+		c.log.Error("SHARDING needs POD_IP for agents to reach the replica, running unsharded")
+		return
+	case c.store == nil || c.cfg.StorageBackend != storage.BackendPostgres:
+		c.log.Error("SHARDING needs postgres storage to share alerts between replicas, running unsharded")
+		return
+	}
+	self := c.cfg.PodName
+	if self == "" {
+		self, _ = os.Hostname()
+	}
+	// Replicas of one Deployment listen on the same port.
+	_, port, err := net.SplitHostPort(c.cfg.HTTPAddr)
+	if err != nil {
+		port = "8080"
+	}
+	refresh := c.cfg.ShardingRefresh
+	if refresh <= 0 {
+		refresh = 10 * time.Second
+	}
+	c.shards = &shardRouter{
+		client: c.kube,
+		pods: fmt.Sprintf("/api/v1/namespaces/%s/pods?labelSelector=%s",
+			url.PathEscape(c.cfg.ShardingNamespace), url.QueryEscape(c.cfg.ShardingSelector)),
+		self:    self,
+		port:    port,
+		refresh: refresh,
+		table:   shard.NewTable(nil),
+	}
+	c.log.WithField("replica", self).Info("Sharding agents between controller replicas")
+}
+
+// list replaces the table with the controller pods that are Ready and not
+// shutting down, and reports whether its members changed.
+func (r *shardRouter) list(ctx context.Context) (bool, error) {
+	var pods corev1.PodList
+	if err := r.client.Get(ctx, r.pods, &pods); err != nil {
+		return false, err
+	}
+	var members []shard.Member
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.PodIP == "" || !podReady(pod) {
+			continue
+		}
+		members = append(members, shard.Member{Name: pod.Name, Address: "http://" + net.JoinHostPort(pod.Status.PodIP, r.port)})
+	}
+	table := shard.NewTable(members)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := table.Generation != r.table.Generation
+	r.table = table
+	return changed, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (r *shardRouter) current() *shard.Table {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.table
+}
+
+// owns reports whether agent id is routed to this replica, or to no
+// replica while the table is empty.
+func (r *shardRouter) owns(id string) bool {
+	owner, ok := r.current().Owner(id)
+	return !ok || owner.Name == r.self
+}
+
+// RoutingTable returns the replicas agents are routed to, or
+// ErrShardingDisabled.
+func (c *Controller) RoutingTable() (*shard.Table, error) {
+	if c.shards == nil {
+		return nil, ErrShardingDisabled
+	}
+	return c.shards.current(), nil
+}
+
+// AlertOwner returns the API address of the replica that raised alert id,
+// when that is another replica in the routing table, so triage updates are
+// made where the alert is kept. It returns "" when this replica updates
+// the alert itself.
+func (c *Controller) AlertOwner(id string) string {
+	if c.shards == nil {
+		return ""
+	}
+	c.alertsMu.RLock()
+	replica := ""
+	if i := c.alertIndex(id); i >= 0 {
+		replica = c.alerts[i].Replica
+	}
+	c.alertsMu.RUnlock()
+	if replica == "" || replica == c.shards.self {
+		return ""
+	}
+	if m, ok := c.shards.current().Member(replica); ok {
+		return m.Address
+	}
+	return ""
+}
+
+// runSharding lists the controller replicas and syncs shared state every
+// ShardingRefresh.
+func (c *Controller) runSharding(ctx context.Context) {
+	ticker := time.NewTicker(c.shards.refresh)
+	defer ticker.Stop()
+	for {
+		c.refreshShards(ctx)
+		c.syncShared(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) refreshShards(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.shards.refresh)
+	defer cancel()
+	changed, err := c.shards.list(ctx)
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to list controller replicas, keeping the routing table")
+		return
+	}
+	table := c.shards.current()
+	shardMembers.Set(float64(len(table.Members)))
+	if changed {
+		c.log.WithFields(logrus.Fields{"generation": table.Generation, "replicas": len(table.Members)}).Info("Routing table changed")
+	}
+}
+
+// syncShared reads the alerts and suppressions every replica stores, so
+// each serves the same alerts and applies the same suppressions.
+func (c *Controller) syncShared(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, storageTimeout)
+	defer cancel()
+	read := time.Now()
+	if alerts, err := c.store.RecentAlerts(ctx, c.cfg.AlertRetentionCount); err != nil {
+		c.log.WithError(err).Warn("Failed to read shared alerts")
+	} else {
+		c.mergeAlerts(alerts)
+	}
+	if sups, err := c.store.Suppressions(ctx); err != nil {
+		c.log.WithError(err).Warn("Failed to read shared suppressions")
+	} else {
+		// A suppression added since the previous sync may still be queued
+		// for storage.
+		c.mergeSuppressions(sups, read.Add(-c.shards.refresh))
+	}
+}
+
+// mergeAlerts replaces the alerts other replicas raised with their stored
+// copies. Alerts this replica raised are kept as it holds them, as its
+// latest changes may not be written yet. Alerts new to this replica are
+// published to its alert streams.
+func (c *Controller) mergeAlerts(stored []*types.Alert) {
+	self := c.shards.self
+	c.interner.alerts(stored)
+	c.alertsMu.Lock()
+	known := make(map[string]bool, len(c.alerts))
+	merged := make([]*types.Alert, 0, len(c.alerts)+len(stored))
+	for _, a := range c.alerts {
+		known[a.ID] = true
+		if a.Replica == self {
+			merged = append(merged, a)
+		}
+	}
+	var added []*types.Alert
+	for _, a := range stored {
+		if a.Replica == self {
+			continue
+		}
+		merged = append(merged, a)
+		if !known[a.ID] {
+			added = append(added, a)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp.Before(merged[j].Timestamp) })
+	if n := c.cfg.AlertRetentionCount; n > 0 && len(merged) > n {
+		merged = merged[len(merged)-n:]
+	}
+	c.alerts = merged
+	c.alertsMu.Unlock()
+	for _, a := range added {
+		c.alertHub.publish(a)
+	}
+}
+
+// mergeSuppressions replaces the suppressions with the stored ones, keeping
+// this replica's match counts and the suppressions it added after since.
+// One deleted here but not yet deleted in storage returns until the next
+// sync.
+func (c *Controller) mergeSuppressions(stored []*types.Suppression, since time.Time) {
+	c.suppressionsMu.Lock()
+	defer c.suppressionsMu.Unlock()
+	local := make(map[string]*types.Suppression, len(c.suppressions))
+	for _, s := range c.suppressions {
+		local[s.ID] = s
+	}
+	merged := make([]*types.Suppression, 0, len(stored))
+	for _, s := range stored {
+		if l, ok := local[s.ID]; ok {
+			s = l
+			delete(local, s.ID)
+		}
+		merged = append(merged, s)
+	}
+	for _, s := range local {
+		if s.CreatedAt.After(since) {
+			merged = append(merged, s)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].CreatedAt.Before(merged[j].CreatedAt) })
+	c.suppressions = merged
+	c.dropExpiredSuppressions(time.Now())
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/shard"
+)
+
+func controllerPod(name, ip string, ready bool) corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	pod.Status.PodIP = ip
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+	return pod
+}
+
+func TestShardRouter_List(t *testing.T) {
+	terminating := controllerPod("pod-d", "10.0.0.4", true)
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	pods := corev1.PodList{Items: []corev1.Pod{
+		controllerPod("pod-b", "10.0.0.2", true),
+		controllerPod("pod-a", "10.0.0.1", true),
+		controllerPod("pod-c", "10.0.0.3", false),
+		terminating,
+	}}
+	var selector string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selector = r.URL.Query().Get("labelSelector")
+		json.NewEncoder(w).Encode(pods)
+	}))
+	defer srv.Close()
+
+	r := &shardRouter{
+		client: kube.NewClient(srv.URL, http.DefaultClient),
+		pods:   "/api/v1/namespaces/apss-system/pods?labelSelector=app.kubernetes.io%2Fcomponent%3Dcontroller",
+		self:   "pod-a",
+		port:   "8080",
+		table:  shard.NewTable(nil),
+	}
+	if !r.owns("agent-1") {
+		t.Error("agent not owned while the table is empty")
+	}
+	changed, err := r.list(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("list = %v, %v", changed, err)
+	}
+	if selector != "app.kubernetes.io/component=controller" {
+		t.Errorf("labelSelector = %q", selector)
+	}
+	want := []shard.Member{{Name: "pod-a", Address: "http://10.0.0.1:8080"}, {Name: "pod-b", Address: "http://10.0.0.2:8080"}}
+	if got := r.current().Members; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("members = %v", got)
+	}
+	if changed, _ := r.list(context.Background()); changed {
+		t.Error("unchanged pods reported as a change")
+	}
+}
+
+func TestController_SyncShared(t *testing.T) {
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, StorageBackend: "memory"}, logrus.New())
+	c.shards = &shardRouter{
+		self:    "pod-a",
+		refresh: time.Minute,
+		table:   shard.NewTable([]shard.Member{{Name: "pod-a", Address: "http://10.0.0.1:8080"}, {Name: "pod-b", Address: "http://10.0.0.2:8080"}}),
+	}
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour)
+
+	// pod-a raised a1 and acknowledged it; storage has an older copy. pod-b
+	// acknowledged b1 and raised b2.
+	c.alerts = []*types.Alert{
+		{ID: "a1", Timestamp: base, Replica: "pod-a", Status: types.AlertStatusAcked},
+		{ID: "b1", Timestamp: base.Add(time.Minute), Replica: "pod-b", Status: types.AlertStatusOpen},
+	}
+	c.store.PutAlert(ctx, &types.Alert{ID: "a1", Timestamp: base, Replica: "pod-a", Status: types.AlertStatusOpen})
+	c.store.PutAlert(ctx, &types.Alert{ID: "b1", Timestamp: base.Add(time.Minute), Replica: "pod-b", Status: types.AlertStatusAcked})
+	c.store.PutAlert(ctx, &types.Alert{ID: "b2", Timestamp: base.Add(2 * time.Minute), Replica: "pod-b", Status: types.AlertStatusOpen})
+
+	// s1 was deleted elsewhere, s2 was just added here and s3 elsewhere.
+	c.suppressions = []*types.Suppression{
+		{ID: "s1", RuleID: "APSS-001", CreatedAt: base},
+		{ID: "s2", RuleID: "APSS-002", CreatedAt: time.Now()},
+		{ID: "s4", RuleID: "APSS-004", CreatedAt: base, Matches: 3},
+	}
+	c.store.PutSuppression(ctx, &types.Suppression{ID: "s3", RuleID: "APSS-003", CreatedAt: base.Add(time.Minute)})
+	c.store.PutSuppression(ctx, &types.Suppression{ID: "s4", RuleID: "APSS-004", CreatedAt: base})
+
+	stream := c.alertHub.subscribe(10)
+	c.syncShared(ctx)
+
+	var statuses []string
+	for _, a := range c.alerts {
+		statuses = append(statuses, a.ID+"="+a.Status)
+	}
+	if len(statuses) != 3 || statuses[0] != "a1=acked" || statuses[1] != "b1=acked" || statuses[2] != "b2=open" {
+		t.Errorf("alerts after sync = %v", statuses)
+	}
+	select {
+	case a := <-stream:
+		if a.ID != "b2" {
+			t.Errorf("streamed %s", a.ID)
+		}
+	default:
+		t.Error("new alert not streamed")
+	}
+
+	sups := c.GetSuppressions()
+	if len(sups) != 3 || sups[0].ID != "s4" || sups[0].Matches != 3 || sups[1].ID != "s3" || sups[2].ID != "s2" {
+		t.Errorf("suppressions after sync = %v", sups)
+	}
+
+	if got := c.AlertOwner("b1"); got != "http://10.0.0.2:8080" {
+		t.Errorf("AlertOwner(b1) = %q", got)
+	}
+	if got := c.AlertOwner("a1"); got != "" {
+		t.Errorf("AlertOwner(a1) = %q", got)
+	}
+}
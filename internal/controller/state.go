@@ -0,0 +1,439 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+// stateVersion is bumped when the snapshot layout changes incompatibly; a
+// snapshot with another version is ignored.
+const stateVersion = 1
+
+// controllerState is the snapshot written to StateFile. Events are not
+// saved, only how many were ever retained, so export cursors stay valid.
+type controllerState struct {
+	Version       int                `json:"version"`
+	SavedAt       time.Time          `json:"saved_at"`
+	Agents        []*types.AgentInfo `json:"agents"`
+	Alerts        []*types.Alert     `json:"alerts"`
+	AlertsDropped int64              `json:"alerts_dropped"`
+	EventsTotal   int64              `json:"events_total"`
+	Incidents     []*types.Incident  `json:"incidents"`
+	IOCs          []types.IOC        `json:"iocs"`
+	RuleStats     []savedRuleStat    `json:"rule_stats"`
+	// RuleModes are the shadow modes set through the API, by rule ID.
+	RuleModes map[string]bool `json:"rule_modes,omitempty"`
+	// DisabledRules are the rules disabled for being slow or through the API.
+	DisabledRules []string `json:"disabled_rules,omitempty"`
+	// Suppressions are operator decisions and outlive alert retention.
+	Suppressions []*types.Suppression `json:"suppressions,omitempty"`
+	// Baselines are the known-good file hashes agents compare against, so
+	// they must not be captured again from possibly tampered pods.
+	Baselines []*fileintegrity.Baseline `json:"baselines,omitempty"`
+	// Brownout is the monitoring brownout in effect, so a restart does not
+	// end it early.
+	Brownout *types.Brownout `json:"brownout,omitempty"`
+	// AgentConfig is the config pushed to agents, so a restart neither
+	// drops it nor restarts its revisions.
+	AgentConfig *types.AgentRuntimeConfig `json:"agent_config,omitempty"`
+	// FederationCursor is the export cursor of the next alert an edge
+	// controller reports, so a restart does not resend every alert.
+	FederationCursor int64 `json:"federation_cursor,omitempty"`
+	// Federation is a central controller's record of the edge clusters.
+	Federation *savedFederation `json:"federation,omitempty"`
+	// The dedup windows: lateral movement pairs already raised, campaign
+	// sightings and their open incidents, and the INFO events already
+	// stored in the current summary window.
+	LateralFired map[string]time.Time `json:"lateral_fired,omitempty"`
+	Campaigns    []savedCampaign      `json:"campaigns,omitempty"`
+	SummaryKeys  []string             `json:"summary_keys,omitempty"`
+}
+
+type savedRuleStat struct {
+	RuleID    string    `json:"rule_id"`
+	Name      string    `json:"name"`
+	Severity  string    `json:"severity"`
+	Matches   int64     `json:"matches"`
+	LastFired time.Time `json:"last_fired"`
+	// ShadowMatches and LastShadow count matches in shadow mode.
+	ShadowMatches int64      `json:"shadow_matches,omitempty"`
+	LastShadow    *time.Time `json:"last_shadow,omitempty"`
+}
+
+type savedFederation struct {
+	Clusters []*types.ClusterSummary `json:"clusters"`
+	Alerts   []*types.FederatedAlert `json:"alerts"`
+	Seen     map[string]time.Time    `json:"seen"`
+}
+
+type savedCampaign struct {
+	Kind       string          `json:"kind"`
+	Value      string          `json:"value"`
+	IncidentID string          `json:"incident_id,omitempty"`
+	Sightings  []savedSighting `json:"sightings"`
+}
+
+type savedSighting struct {
+	Pod      types.PodRef `json:"pod"`
+	Workload string       `json:"workload"`
+	At       time.Time    `json:"at"`
+	EventID  string       `json:"event_id"`
+}
+
+// SaveState writes the controller's state to StateFile, replacing the
+// previous snapshot atomically. It is a no-op when no file is configured or
+// another replica is the leader.
+func (c *Controller) SaveState() error {
+	if c.cfg.StateFile == "" || !c.leading() {
+		return nil
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	data, err := json.Marshal(c.snapshotState(time.Now()))
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+	tmp := c.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := os.Rename(tmp, c.cfg.StateFile); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
+
+func (c *Controller) snapshotState(now time.Time) *controllerState {
+	st := &controllerState{Version: stateVersion, SavedAt: now}
+
+	c.agentsMu.RLock()
+	for _, a := range c.agents {
+		cp := *a
+		st.Agents = append(st.Agents, &cp)
+	}
+	c.agentsMu.RUnlock()
+
+	// Alerts change in place under alertsMu, so they are copied under it.
+	c.alertsMu.RLock()
+	st.Alerts = make([]*types.Alert, len(c.alerts))
+	for i, a := range c.alerts {
+		cp := *a
+		st.Alerts[i] = &cp
+	}
+	st.AlertsDropped = c.alertsDropped
+	c.alertsMu.RUnlock()
+
+	c.eventsMu.RLock()
+	st.EventsTotal = c.eventsDropped + int64(len(c.events))
+	c.eventsMu.RUnlock()
+
+	// Retained incidents are replaced rather than changed, so the pointers
+	// can be shared.
+	c.incidentsMu.RLock()
+	st.Incidents = append([]*types.Incident(nil), c.incidents...)
+	c.incidentsMu.RUnlock()
+
+	c.iocsMu.Lock()
+	for _, ioc := range c.iocs {
+		st.IOCs = append(st.IOCs, *ioc)
+	}
+	c.iocsMu.Unlock()
+
+	c.ruleStats.mu.Lock()
+	for id, s := range c.ruleStats.stats {
+		saved := savedRuleStat{
+			RuleID: id, Name: s.name, Severity: s.severity, Matches: s.matches, LastFired: s.lastFired,
+			ShadowMatches: s.shadowMatches,
+		}
+		if s.shadowMatches > 0 {
+			last := s.lastShadow
+			saved.LastShadow = &last
+		}
+		st.RuleStats = append(st.RuleStats, saved)
+	}
+	if len(c.ruleStats.modes) > 0 {
+		st.RuleModes = make(map[string]bool, len(c.ruleStats.modes))
+		for id, shadow := range c.ruleStats.modes {
+			st.RuleModes[id] = shadow
+		}
+	}
+	for id := range c.ruleStats.disabled {
+		st.DisabledRules = append(st.DisabledRules, id)
+	}
+	sort.Strings(st.DisabledRules)
+	c.ruleStats.mu.Unlock()
+
+	c.suppressionsMu.Lock()
+	st.Suppressions = append([]*types.Suppression(nil), c.suppressions...)
+	c.suppressionsMu.Unlock()
+
+	st.Baselines = c.GetBaselines()
+	st.Brownout, _ = c.Brownout()
+	st.AgentConfig, _ = c.AgentConfig()
+	if e := c.fedEdge; e != nil {
+		st.FederationCursor = e.cursor.Load()
+	}
+	if h := c.fedHub; h != nil {
+		h.mu.Lock()
+		saved := &savedFederation{Seen: make(map[string]time.Time, len(h.seen))}
+		for _, sum := range h.clusters {
+			cp := *sum
+			saved.Clusters = append(saved.Clusters, &cp)
+		}
+		for _, fa := range h.alerts {
+			cp := *fa
+			cp.Clusters = append([]string(nil), fa.Clusters...)
+			saved.Alerts = append(saved.Alerts, &cp)
+		}
+		for key, at := range h.seen {
+			saved.Seen[key] = at
+		}
+		h.mu.Unlock()
+		st.Federation = saved
+	}
+
+	if t := c.lateral; t != nil {
+		t.mu.Lock()
+		st.LateralFired = make(map[string]time.Time, len(t.fired))
+		for pair, at := range t.fired {
+			st.LateralFired[pair] = at
+		}
+		t.mu.Unlock()
+	}
+	if t := c.campaigns; t != nil {
+		t.mu.Lock()
+		for key, cs := range t.states {
+			saved := savedCampaign{Kind: key.kind, Value: key.value}
+			if cs.incident != nil {
+				saved.IncidentID = cs.incident.ID
+			}
+			for _, s := range cs.pods {
+				saved.Sightings = append(saved.Sightings, savedSighting{Pod: s.pod, Workload: s.workload, At: s.at, EventID: s.eventID})
+			}
+			st.Campaigns = append(st.Campaigns, saved)
+		}
+		t.mu.Unlock()
+	}
+	if s := c.summarizer; s != nil {
+		s.mu.Lock()
+		for key := range s.seen {
+			st.SummaryKeys = append(st.SummaryKeys, key)
+		}
+		s.mu.Unlock()
+	}
+	return st
+}
+
+// restoreState loads the snapshot in StateFile, if any, so the API and the
+// dedup windows pick up where the previous controller left off. Restored
+// agents that do not report again are dropped by the usual stale check.
+// It must run before the controller starts leading.
+func (c *Controller) restoreState() {
+	if c.cfg.StateFile == "" {
+		return
+	}
+	data, err := os.ReadFile(c.cfg.StateFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		c.log.WithError(err).WithField("file", c.cfg.StateFile).Error("Failed to read controller state")
+		return
+	}
+	var st controllerState
+	if err := json.Unmarshal(data, &st); err != nil {
+		c.log.WithError(err).WithField("file", c.cfg.StateFile).Error("Failed to decode controller state, starting empty")
+		return
+	}
+	if st.Version != stateVersion {
+		c.log.WithFields(logrus.Fields{"file": c.cfg.StateFile, "version": st.Version}).Warn("Unsupported controller state version, starting empty")
+		return
+	}
+	c.applyState(&st, time.Now())
+	c.log.WithFields(logrus.Fields{
+		"agents": len(st.Agents), "alerts": len(st.Alerts), "incidents": len(st.Incidents),
+		"iocs": len(st.IOCs), "saved_at": st.SavedAt,
+	}).Info("Restored controller state")
+}
+
+func (c *Controller) applyState(st *controllerState, now time.Time) {
+	c.agentsMu.Lock()
+	for _, a := range st.Agents {
+		if a.ID == "" {
+			continue
+		}
+		c.agents[a.ID] = a
+		if a.PodIP != "" {
+			c.podIPs[a.PodIP] = a.ID
+		}
+	}
+	activeAgents.Set(float64(len(c.agents)))
+	c.agentsMu.Unlock()
+
+	alerts := st.Alerts
+	dropped := st.AlertsDropped
+	if n := c.cfg.AlertRetentionCount; n > 0 && len(alerts) > n {
+		dropped += int64(len(alerts) - n)
+		alerts = alerts[len(alerts)-n:]
+	}
+	c.interner.alerts(alerts)
+	c.alertsMu.Lock()
+	c.alerts = append(alerts, c.alerts...)
+	c.alertsDropped = dropped
+	c.alertsMu.Unlock()
+
+	c.eventsMu.Lock()
+	c.eventsDropped = st.EventsTotal
+	c.eventsMu.Unlock()
+
+	incidents := st.Incidents
+	if n := c.cfg.AlertRetentionCount; n > 0 && len(incidents) > n {
+		incidents = incidents[len(incidents)-n:]
+	}
+	c.incidentsMu.Lock()
+	c.incidents = append(incidents, c.incidents...)
+	c.incidentsMu.Unlock()
+
+	c.iocsMu.Lock()
+	for _, ioc := range st.IOCs {
+		ioc := ioc
+		c.iocs[iocKey(ioc.Type, ioc.Value)] = &ioc
+	}
+	c.expireIOCsLocked(now)
+	c.iocsMu.Unlock()
+	if c.intel != nil && len(st.IOCs) > 0 {
+		c.syncIOCs()
+	}
+
+	c.ruleStats.mu.Lock()
+	for _, s := range st.RuleStats {
+		rs := &ruleStat{name: s.Name, severity: s.Severity, matches: s.Matches, lastFired: s.LastFired, shadowMatches: s.ShadowMatches}
+		if s.LastShadow != nil {
+			rs.lastShadow = *s.LastShadow
+		}
+		c.ruleStats.stats[s.RuleID] = rs
+	}
+	for id, shadow := range st.RuleModes {
+		if c.engine.SetShadow(id, shadow) {
+			c.ruleStats.modes[id] = shadow
+		}
+	}
+	for _, id := range st.DisabledRules {
+		if c.engine.SetDisabled(id, true) {
+			c.ruleStats.disabled[id] = true
+		}
+	}
+	c.ruleStats.mu.Unlock()
+
+	c.suppressionsMu.Lock()
+	c.suppressions = append(st.Suppressions, c.suppressions...)
+	c.dropExpiredSuppressions(now)
+	c.suppressionsMu.Unlock()
+
+	if b := st.Brownout; b != nil && now.Before(b.Until) {
+		c.brownoutMu.Lock()
+		c.brownout = b
+		c.brownoutMu.Unlock()
+		brownoutFactor.Set(float64(b.Factor))
+	}
+	if st.AgentConfig != nil {
+		c.agentConfigMu.Lock()
+		c.agentConfig = st.AgentConfig
+		c.agentConfigMu.Unlock()
+	}
+
+	if e := c.fedEdge; e != nil {
+		e.cursor.Store(st.FederationCursor)
+	}
+	if h, saved := c.fedHub, st.Federation; h != nil && saved != nil {
+		h.mu.Lock()
+		for _, sum := range saved.Clusters {
+			h.clusters[sum.ClusterName] = sum
+		}
+		for _, fa := range saved.Alerts {
+			h.alerts[fa.Fingerprint] = fa
+		}
+		for key, at := range saved.Seen {
+			h.seen[key] = at
+		}
+		h.pruneLocked(now)
+		federationClusters.Set(float64(len(h.clusters)))
+		h.mu.Unlock()
+	}
+
+	c.baselinesMu.Lock()
+	for _, b := range st.Baselines {
+		if b.Key != "" {
+			c.baselines[b.Key] = b
+		}
+	}
+	c.baselinesMu.Unlock()
+
+	// The trackers' own sweeps drop whatever has left the window since the
+	// snapshot.
+	if t := c.lateral; t != nil {
+		t.mu.Lock()
+		for pair, at := range st.LateralFired {
+			t.fired[pair] = at
+		}
+		t.mu.Unlock()
+	}
+	if t := c.campaigns; t != nil {
+		byID := make(map[string]*types.Incident, len(incidents))
+		for _, inc := range incidents {
+			byID[inc.ID] = inc
+		}
+		t.mu.Lock()
+		for _, saved := range st.Campaigns {
+			cs := &campaignState{pods: make(map[string]campaignSighting), incident: byID[saved.IncidentID]}
+			for _, s := range saved.Sightings {
+				cs.pods[podKey(s.Pod.Namespace, s.Pod.Name)] = campaignSighting{pod: s.Pod, workload: s.Workload, at: s.At, eventID: s.EventID}
+			}
+			t.states[campaignKey{saved.Kind, saved.Value}] = cs
+		}
+		t.mu.Unlock()
+	}
+	// Summary keys only describe the window that was open at the snapshot.
+	if s := c.summarizer; s != nil && now.Sub(st.SavedAt) < s.window {
+		s.mu.Lock()
+		for _, key := range st.SummaryKeys {
+			if len(s.seen) < maxSummaryKeys {
+				s.seen[key] = &summaryEntry{}
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// runStateSaver snapshots the controller's state every StateSaveInterval,
+// and once more when ctx is done.
+func (c *Controller) runStateSaver(ctx context.Context) {
+	interval := c.cfg.StateSaveInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.SaveState(); err != nil {
+				c.log.WithError(err).Error("Failed to save controller state")
+			}
+			return
+		case <-ticker.C:
+			if err := c.SaveState(); err != nil {
+				c.log.WithError(err).Error("Failed to save controller state")
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_SaveRestoreState(t *testing.T) {
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, AlertRetentionCount: 2, EventRetentionCount: 1,
+		LateralMovementWindow: time.Hour, CampaignWindow: time.Hour, CampaignMinWorkloads: 2,
+		EventSummaryWindow: time.Hour, IOCExtraction: true, IOCTTL: time.Hour,
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+	now := time.Now()
+	c := New(cfg, logrus.New())
+	if err := c.RegisterAgent(&types.AgentRegistration{AgentID: "agent-a", PodName: "web", PodNamespace: "shop", PodIP: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"alert-1", "alert-2", "alert-3"} {
+		a := &types.Alert{ID: id, RuleID: "APSS-001", RuleName: "Reverse Shell", Severity: "CRITICAL", Timestamp: now, Status: types.AlertStatusOpen}
+		c.alerts = append(c.alerts, a)
+		c.ruleStats.record(a)
+	}
+	c.retainEvent(&types.SecurityEvent{ID: "evt-1"})
+	c.retainEvent(&types.SecurityEvent{ID: "evt-2"})
+	c.incidents = []*types.Incident{{ID: "incident-1", Type: types.IncidentTypeCampaign}}
+	c.iocs[iocKey(types.IOCTypeIP, "203.0.113.9")] = &types.IOC{Type: types.IOCTypeIP, Value: "203.0.113.9", LastSeen: now}
+	c.lateral.fired["shop/web>data/db"] = now
+	c.campaigns.states[campaignKey{types.IndicatorDstIP, "203.0.113.9"}] = &campaignState{
+		pods:     map[string]campaignSighting{"shop/web": {pod: types.PodRef{Namespace: "shop", Name: "web"}, workload: "web", at: now, eventID: "evt-1"}},
+		incident: c.incidents[0],
+	}
+	info := &types.SecurityEvent{ID: "evt-3", Type: "process_start", Severity: "INFO", PodName: "web", PodNamespace: "shop"}
+	c.summarizer.admit(info)
+	if _, err := c.SetAgentConfig(types.AgentRuntimeConfig{SuspiciousPorts: []int{4444}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SaveState(); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+
+	r := New(cfg, logrus.New())
+	if agents := r.GetAgents(); len(agents) != 1 || agents[0].ID != "agent-a" || agents[0].Status == types.AgentStatusUnknown {
+		t.Errorf("agents = %+v, want the registered agent-a", agents)
+	}
+	if ref, ok := r.podByIP("10.0.0.1"); !ok || ref.Name != "web" {
+		t.Errorf("podByIP = %+v, %v", ref, ok)
+	}
+	// Retention trims the restored alerts, and cursors keep counting.
+	if page := r.ExportAlerts(0, 0, types.AlertFilter{}); len(page.Items) != 2 || page.Items[0].ID != "alert-2" || page.Next != 3 {
+		t.Errorf("alerts = %+v, next %d", page.Items, page.Next)
+	}
+	if page := r.ExportEvents(0, 0, func(*types.SecurityEvent) bool { return true }); page.Next != 2 {
+		t.Errorf("event cursor = %d, want 2", page.Next)
+	}
+	if inc, err := r.GetIncident("incident-1"); err != nil || inc.Type != types.IncidentTypeCampaign {
+		t.Errorf("incident = %+v, %v", inc, err)
+	}
+	if iocs := r.GetIOCs(""); len(iocs) != 1 || iocs[0].Value != "203.0.113.9" {
+		t.Errorf("iocs = %+v", iocs)
+	}
+	for _, cov := range r.RuleCoverage() {
+		if cov.RuleID == "APSS-001" && cov.Matches != 3 {
+			t.Errorf("APSS-001 matches = %d, want 3", cov.Matches)
+		}
+	}
+
+	// Dedup windows survive the restart.
+	if _, ok := r.lateral.fired["shop/web>data/db"]; !ok {
+		t.Error("lateral movement pair not restored")
+	}
+	st := r.campaigns.states[campaignKey{types.IndicatorDstIP, "203.0.113.9"}]
+	if st == nil || st.incident == nil || st.incident.ID != "incident-1" || len(st.pods) != 1 {
+		t.Errorf("campaign state = %+v", st)
+	}
+	if r.summarizer.admit(&types.SecurityEvent{ID: "evt-4", Type: "process_start", Severity: "INFO", PodName: "web", PodNamespace: "shop"}) {
+		t.Error("repeat of an event stored before the restart was stored again")
+	}
+
+	// The pushed agent config survives, and its revisions carry on.
+	if ac, err := r.AgentConfig(); err != nil || ac.Revision != 1 || len(ac.SuspiciousPorts) != 1 {
+		t.Errorf("agent config = %+v, %v", ac, err)
+	}
+	if ac, err := r.SetAgentConfig(types.AgentRuntimeConfig{}); err != nil || ac.Revision != 2 {
+		t.Errorf("agent config after restart = %+v, %v", ac, err)
+	}
+}
+
+func TestController_RestoreState_Invalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, StateFile: file}
+
+	// A missing file is a first start.
+	if c := New(cfg, logrus.New()); len(c.GetAgents()) != 0 {
+		t.Error("agents restored from a missing file")
+	}
+	for _, data := range []string{`{not json`, `{"version": 99, "agents": [{"id": "agent-a"}]}`} {
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if c := New(cfg, logrus.New()); len(c.GetAgents()) != 0 {
+			t.Errorf("agents restored from %s", data)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/storage"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ErrStorageDisabled is returned by the audit log and migration status APIs
+// when no storage backend is configured.
+var ErrStorageDisabled = errors.New("storage is not enabled on this controller")
+
+const (
+	// storageQueueSize bounds the writes waiting for the storage backend.
+	storageQueueSize = 10000
+	// storageBatchSize is how many queued events are written at once.
+	storageBatchSize = 500
+	// storageTimeout bounds each storage call.
+	storageTimeout = 10 * time.Second
+	// storagePruneInterval is how often records past StorageRetention are
+	// pruned.
+	storagePruneInterval = time.Hour
+)
+
+var (
+	storageWrites = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_storage_writes_total",
+			Help: "Records written to the storage backend, by kind",
+		},
+		[]string{"kind"},
+	)
+	storageErrors = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_storage_errors_total",
+			Help: "Failed storage backend writes, by kind",
+		},
+		[]string{"kind"},
+	)
+	storageDropped = newCounter(prometheus.CounterOpts{
+		Name: "apss_storage_dropped_total",
+		Help: "Storage writes dropped because the write queue was full",
+	})
+	storageSchemaVersion = newGauge(prometheus.GaugeOpts{
+		Name: "apss_storage_schema_version",
+		Help: "Schema migration version of the Postgres storage database",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(storageWrites, storageErrors, storageDropped, storageSchemaVersion)
+}
+
+// storageOp is a queued storage write: an event, written in batches with
+// the events queued next to it, or any other write.
+type storageOp struct {
+	kind  string
+	event *types.SecurityEvent
+	write func(ctx context.Context, s storage.Storage) error
+}
+
+// initStorage opens the storage backend when StorageBackend is set. A
+// backend that fails to open is logged and the controller keeps records in
+// memory only.
+func (c *Controller) initStorage() {
+	if c.cfg.StorageBackend == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	s, err := storage.Open(ctx, storage.Config{
+		Backend:     c.cfg.StorageBackend,
+		Path:        c.cfg.StoragePath,
+		PostgresDSN: c.cfg.StoragePostgresDSN,
+		Migrate:     c.cfg.StorageMigrate,
+	})
+	if err != nil {
+		c.log.WithError(err).WithField("backend", c.cfg.StorageBackend).Error("Failed to open storage, keeping records in memory only")
+		return
+	}
+	c.store = s
+	c.storeQueue = make(chan storageOp, storageQueueSize)
+	fields := logrus.Fields{"backend": c.cfg.StorageBackend}
+	if status, err := s.MigrationStatus(ctx); err == nil {
+		storageSchemaVersion.Set(float64(status.Version))
+		fields["schema_version"] = status.Version
+	}
+	c.log.WithFields(fields).Info("Persisting events, alerts and audit log to storage")
+}
+
+// loadStorage replaces the retained alerts, incidents, suppressions and
+// events with the newest stored ones, so a restarted or newly elected
+// controller continues from what was stored. A set storage holds nothing
+// of is left as restored from the state snapshot. It must run before the
+// controller starts leading.
+func (c *Controller) loadStorage() {
+	if c.store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	now := time.Now()
+
+	alerts, err := c.store.RecentAlerts(ctx, c.cfg.AlertRetentionCount)
+	if err != nil {
+		c.log.WithError(err).Error("Failed to load alerts from storage")
+	} else if len(alerts) > 0 {
+		c.interner.alerts(alerts)
+		c.alertsMu.Lock()
+		c.alerts = alerts
+		c.alertsMu.Unlock()
+	}
+
+	incidents, err := c.store.RecentIncidents(ctx, c.cfg.AlertRetentionCount)
+	if err != nil {
+		c.log.WithError(err).Error("Failed to load incidents from storage")
+	} else if len(incidents) > 0 {
+		c.incidentsMu.Lock()
+		c.incidents = incidents
+		c.incidentsMu.Unlock()
+	}
+
+	suppressions, err := c.store.Suppressions(ctx)
+	if err != nil {
+		c.log.WithError(err).Error("Failed to load suppressions from storage")
+	} else if len(suppressions) > 0 {
+		c.suppressionsMu.Lock()
+		c.suppressions = suppressions
+		c.dropExpiredSuppressions(now)
+		c.suppressionsMu.Unlock()
+	}
+
+	var events []*types.SecurityEvent
+	if c.cfg.EventRetentionCount > 0 {
+		events, err = c.store.RecentEvents(ctx, c.cfg.EventRetentionCount)
+		if err != nil {
+			c.log.WithError(err).Error("Failed to load events from storage")
+		}
+		for _, e := range events {
+			c.retainEvent(e)
+		}
+	}
+
+	c.log.WithFields(logrus.Fields{
+		"alerts": len(alerts), "incidents": len(incidents), "suppressions": len(suppressions), "events": len(events),
+	}).Info("Loaded records from storage")
+}
+
+// persist queues op for the storage writer, dropping it when the queue is
+// full.
+func (c *Controller) persist(op storageOp) {
+	if c.store == nil {
+		return
+	}
+	select {
+	case c.storeQueue <- op:
+	default:
+		storageDropped.Inc()
+		c.log.WithField("kind", op.kind).Debug("Storage queue full, dropping write")
+	}
+}
+
+func (c *Controller) storeEvent(event *types.SecurityEvent) {
+	c.persist(storageOp{kind: "event", event: event})
+}
+
+// storeAlert queues a copy of alert, as the retained one may be replaced
+// before it is written.
+func (c *Controller) storeAlert(alert *types.Alert) {
+	snapshot := *alert
+	c.persist(storageOp{kind: "alert", write: func(ctx context.Context, s storage.Storage) error {
+		return s.PutAlert(ctx, &snapshot)
+	}})
+}
+
+func (c *Controller) storeIncident(incident *types.Incident) {
+	snapshot := *incident
+	c.persist(storageOp{kind: "incident", write: func(ctx context.Context, s storage.Storage) error {
+		return s.PutIncident(ctx, &snapshot)
+	}})
+}
+
+// storeSuppression queues a copy of sup, whose match counts change in
+// place.
+func (c *Controller) storeSuppression(sup types.Suppression) {
+	c.persist(storageOp{kind: "suppression", write: func(ctx context.Context, s storage.Storage) error {
+		return s.PutSuppression(ctx, &sup)
+	}})
+}
+
+func (c *Controller) unstoreSuppression(id string) {
+	c.persist(storageOp{kind: "suppression", write: func(ctx context.Context, s storage.Storage) error {
+		return s.DeleteSuppression(ctx, id)
+	}})
+}
+
+// audit records an operator change in the audit log.
+func (c *Controller) audit(action, target string, detail map[string]string) {
+	now := time.Now()
+	entry := &types.AuditEntry{
+		ID:     fmt.Sprintf("audit-%d", now.UnixNano()),
+		Time:   now,
+		Action: action,
+		Target: target,
+		Detail: detail,
+	}
+	c.persist(storageOp{kind: "audit", write: func(ctx context.Context, s storage.Storage) error {
+		return s.AppendAudit(ctx, entry)
+	}})
+}
+
+// AuditLog returns up to limit of the newest audit entries at or after
+// since, oldest first.
+func (c *Controller) AuditLog(ctx context.Context, since time.Time, limit int) ([]*types.AuditEntry, error) {
+	if c.store == nil {
+		return nil, ErrStorageDisabled
+	}
+	return c.store.AuditLog(ctx, since, limit)
+}
+
+// StorageMigrations reports the storage schema version and the migrations
+// applied. It returns ErrStorageDisabled without a storage backend and
+// storage.ErrNoMigrations for backends without a schema.
+func (c *Controller) StorageMigrations(ctx context.Context) (*storage.MigrationStatus, error) {
+	if c.store == nil {
+		return nil, ErrStorageDisabled
+	}
+	return c.store.MigrationStatus(ctx)
+}
+
+// runStorage writes queued records to the storage backend, and prunes
+// records past StorageRetention. Once ctx is done it writes what is
+// already queued.
+func (c *Controller) runStorage(ctx context.Context) {
+	prune := time.NewTicker(storagePruneInterval)
+	defer prune.Stop()
+	c.pruneStorage()
+	for {
+		select {
+		case <-ctx.Done():
+			c.writeStorage(nil)
+			return
+		case op := <-c.storeQueue:
+			c.writeStorage(&op)
+		case <-prune.C:
+			c.pruneStorage()
+		}
+	}
+}
+
+// writeStorage writes first, if not nil, and the ops queued after it,
+// batching consecutive events.
+func (c *Controller) writeStorage(first *storageOp) {
+	var events []*types.SecurityEvent
+	flush := func() {
+		if len(events) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		defer cancel()
+		if err := c.store.AppendEvents(ctx, events); err != nil {
+			storageErrors.WithLabelValues("event").Add(float64(len(events)))
+			c.log.WithError(err).WithField("events", len(events)).Error("Failed to store events")
+		} else {
+			storageWrites.WithLabelValues("event").Add(float64(len(events)))
+		}
+		events = events[:0]
+	}
+	write := func(op storageOp) {
+		if op.event != nil {
+			events = append(events, op.event)
+			if len(events) >= storageBatchSize {
+				flush()
+			}
+			return
+		}
+		flush()
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		defer cancel()
+		if err := op.write(ctx, c.store); err != nil {
+			storageErrors.WithLabelValues(op.kind).Inc()
+			c.log.WithError(err).WithField("kind", op.kind).Error("Failed to write to storage")
+			return
+		}
+		storageWrites.WithLabelValues(op.kind).Inc()
+	}
+
+	if first != nil {
+		write(*first)
+	}
+	for {
+		select {
+		case op := <-c.storeQueue:
+			write(op)
+		default:
+			flush()
+			return
+		}
+	}
+}
+
+func (c *Controller) pruneStorage() {
+	if c.cfg.StorageRetention <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if err := c.store.Prune(ctx, time.Now().Add(-c.cfg.StorageRetention)); err != nil {
+		c.log.WithError(err).Error("Failed to prune storage")
+	}
+}
+
+// CloseStorage closes the storage backend on shutdown, after writing what
+// is queued. It is a no-op without a storage backend.
+func (c *Controller) CloseStorage() error {
+	if c.store == nil {
+		return nil
+	}
+	c.writeStorage(nil)
+	return c.store.Close()
+}
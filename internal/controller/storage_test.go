@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_Storage(t *testing.T) {
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, AlertRetentionCount: 10, EventRetentionCount: 10,
+		StorageBackend: "bbolt", StoragePath: filepath.Join(t.TempDir(), "apss.db"), StorageRetention: time.Hour,
+	}
+	now := time.Now()
+	c := New(cfg, logrus.New())
+	if c.store == nil {
+		t.Fatal("storage not opened")
+	}
+	c.alerts = append(c.alerts, &types.Alert{ID: "a1", RuleID: "APSS-001", Timestamp: now, Status: types.AlertStatusOpen})
+	acked := types.AlertStatusAcked
+	if _, err := c.UpdateAlert("a1", types.AlertUpdate{Status: &acked}); err != nil {
+		t.Fatal(err)
+	}
+	sup, _ := c.AddSuppression(types.Suppression{RuleID: "APSS-002", Reason: "noisy"})
+	c.storeEvent(&types.SecurityEvent{ID: "e1", Type: "process", Timestamp: now})
+	c.storeEvent(&types.SecurityEvent{ID: "e2", Type: "process", Timestamp: now})
+	c.storeIncident(&types.Incident{ID: "i1", Type: "lateral_movement", Timestamp: now})
+	if err := c.CloseStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new controller continues from what was stored.
+	c = New(cfg, logrus.New())
+	defer c.CloseStorage()
+	if a, err := c.GetAlert("a1"); err != nil || a.Status != types.AlertStatusAcked {
+		t.Errorf("stored alert = %+v, %v", a, err)
+	}
+	if sups := c.GetSuppressions(); len(sups) != 1 || sups[0].ID != sup.ID {
+		t.Errorf("stored suppressions = %v", sups)
+	}
+	if len(c.events) != 2 || len(c.incidents) != 1 {
+		t.Errorf("stored events %d, incidents %d", len(c.events), len(c.incidents))
+	}
+	entries, err := c.AuditLog(context.Background(), time.Time{}, 10)
+	if err != nil || len(entries) != 2 || entries[0].Action != types.AuditAlertUpdated ||
+		entries[0].Detail["status"] != types.AlertStatusAcked || entries[1].Target != sup.ID {
+		t.Errorf("audit log = %v, %v", entries, err)
+	}
+
+	if _, err := New(config.ControllerConfig{}, logrus.New()).AuditLog(context.Background(), time.Time{}, 10); !errors.Is(err, ErrStorageDisabled) {
+		t.Errorf("audit log without storage: %v", err)
+	}
+}
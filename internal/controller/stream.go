@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+var (
+	alertStreamClients = newGauge(prometheus.GaugeOpts{
+		Name: "apss_alert_stream_clients",
+		Help: "Number of connected live alert stream clients",
+	})
+	alertStreamEvictions = newCounter(prometheus.CounterOpts{
+		Name: "apss_alert_stream_evictions_total",
+		Help: "Total live alert stream clients evicted for not keeping up",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(alertStreamClients)
+	prometheus.MustRegister(alertStreamEvictions)
+}
+
+// alertHub fans out new alerts to live stream subscribers. Each subscriber has
+// its own buffer; a subscriber whose buffer is full when an alert arrives is
+// evicted (its channel is closed) so one slow client cannot stall the pipeline.
+type alertHub struct {
+	mu   sync.Mutex
+	subs map[chan *types.Alert]struct{}
+}
+
+func newAlertHub() *alertHub {
+	return &alertHub{subs: make(map[chan *types.Alert]struct{})}
+}
+
+func (h *alertHub) subscribe(buffer int) chan *types.Alert {
+	ch := make(chan *types.Alert, buffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	alertStreamClients.Set(float64(len(h.subs)))
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *alertHub) unsubscribe(ch chan *types.Alert) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+		alertStreamClients.Set(float64(len(h.subs)))
+	}
+}
+
+func (h *alertHub) publish(alert *types.Alert) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- alert:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+			alertStreamEvictions.Inc()
+		}
+	}
+	alertStreamClients.Set(float64(len(h.subs)))
+}
+
+// SubscribeAlerts registers a live alert subscriber. The returned channel
+// receives each new alert and is closed if the subscriber falls more than the
+// configured buffer behind. Call the cancel func when done.
+func (c *Controller) SubscribeAlerts() (<-chan *types.Alert, func()) {
+	buffer := c.cfg.AlertStreamBuffer
+	if buffer <= 0 {
+		buffer = 256
+	}
+	ch := c.alertHub.subscribe(buffer)
+	return ch, func() { c.alertHub.unsubscribe(ch) }
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestAlertHub_PublishAndEvict(t *testing.T) {
+	h := newAlertHub()
+	fast := h.subscribe(4)
+	slow := h.subscribe(1)
+
+	h.publish(&types.Alert{ID: "a1"})
+	h.publish(&types.Alert{ID: "a2"})
+
+	if a := <-fast; a.ID != "a1" {
+		t.Errorf("fast first alert = %q", a.ID)
+	}
+	if a := <-fast; a.ID != "a2" {
+		t.Errorf("fast second alert = %q", a.ID)
+	}
+	if a := <-slow; a.ID != "a1" {
+		t.Errorf("slow first alert = %q", a.ID)
+	}
+	if _, ok := <-slow; ok {
+		t.Error("slow subscriber should be evicted and its channel closed")
+	}
+	if len(h.subs) != 1 {
+		t.Errorf("subscribers after eviction = %d, want 1", len(h.subs))
+	}
+
+	h.unsubscribe(fast)
+	h.unsubscribe(fast) // idempotent
+	if _, ok := <-fast; ok {
+		t.Error("unsubscribed channel should be closed")
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// maxSummaryKeys bounds the distinct events tracked per window; events
+// beyond it are stored and exported individually.
+const maxSummaryKeys = 10000
+
+var eventsSummarized = newCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_events_summarized_total",
+		Help: "Total repeated INFO events collapsed into summary events instead of being stored and exported",
+	},
+	[]string{"event_type"},
+)
+
+func init() {
+	prometheus.MustRegister(eventsSummarized)
+}
+
+// summaryEntry counts the repeats of one event within a window.
+type summaryEntry struct {
+	// first is a copy of the first repeat, the template of the summary.
+	first               *types.SecurityEvent
+	count               int
+	firstSeen, lastSeen time.Time
+}
+
+// eventSummarizer collapses identical INFO events from long-running, noisy
+// workloads. The first event with a given key in a window is stored and
+// exported as usual; its repeats are only counted, and at the end of the
+// window become one summary event.
+type eventSummarizer struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]*summaryEntry
+}
+
+func newEventSummarizer(window time.Duration) *eventSummarizer {
+	return &eventSummarizer{window: window, seen: make(map[string]*summaryEntry)}
+}
+
+// admit reports whether e should be stored and exported on its own. It must
+// be called once per event.
+func (s *eventSummarizer) admit(e *types.SecurityEvent) bool {
+	if e.Severity != "INFO" || hasIOCMatch(e) {
+		return true
+	}
+	key := summaryKey(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.seen[key]
+	if !ok {
+		if len(s.seen) < maxSummaryKeys {
+			s.seen[key] = &summaryEntry{}
+		}
+		return true
+	}
+	t := eventTime(e)
+	if entry.first == nil {
+		first := *e
+		entry.first = &first
+		entry.firstSeen = t
+	}
+	entry.count++
+	entry.lastSeen = t
+	eventsSummarized.WithLabelValues(e.Type).Inc()
+	return false
+}
+
+// flush returns a summary event for every event repeated in the window that
+// is ending and starts a new one.
+func (s *eventSummarizer) flush(now time.Time) []*types.SecurityEvent {
+	s.mu.Lock()
+	seen := s.seen
+	s.seen = make(map[string]*summaryEntry)
+	s.mu.Unlock()
+
+	var out []*types.SecurityEvent
+	for _, entry := range seen {
+		if entry.count == 0 {
+			continue
+		}
+		summary := *entry.first
+		summary.ID = fmt.Sprintf("summary-%d-%d", now.UnixNano(), len(out))
+		summary.Timestamp = now
+		summary.OccurredAt = nil
+		summary.Metadata = make(map[string]interface{}, len(entry.first.Metadata)+4)
+		for k, v := range entry.first.Metadata {
+			summary.Metadata[k] = v
+		}
+		summary.Metadata["summary_count"] = entry.count
+		summary.Metadata["first_seen"] = entry.firstSeen.UTC().Format(time.RFC3339)
+		summary.Metadata["last_seen"] = entry.lastSeen.UTC().Format(time.RFC3339)
+		summary.Metadata["summary_window"] = s.window.String()
+		out = append(out, &summary)
+	}
+	return out
+}
+
+// summaryKey identifies events that are the same activity: same pod and
+// type, and the same payload fields that describe what happened. PIDs,
+// source ports and timestamps differ between repeats and are left out.
+func summaryKey(e *types.SecurityEvent) string {
+	parts := []string{e.PodNamespace, e.PodName, e.Type}
+	if p := e.Process; p != nil {
+		parts = append(parts, p.Name, p.ExePath, strings.Join(p.Cmdline, " "))
+	}
+	if n := e.Network; n != nil {
+		parts = append(parts, n.Protocol, n.DstIP, strconv.Itoa(n.DstPort), n.Domain, n.State)
+	}
+	if f := e.File; f != nil {
+		parts = append(parts, f.Path, f.Operation)
+	}
+	if r := e.Resource; r != nil {
+		parts = append(parts, r.AnomalyType, r.Path, r.ProcessName)
+	}
+	if a := e.Audit; a != nil {
+		parts = append(parts, a.Verb, a.Resource, a.Namespace, a.User)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func hasIOCMatch(e *types.SecurityEvent) bool {
+	return (e.Process != nil && e.Process.MatchedIOC != nil) ||
+		(e.Network != nil && e.Network.MatchedIOC != nil) ||
+		(e.File != nil && e.File.MatchedIOC != nil)
+}
+
+// runSummaries stores and exports the summary events at the end of every
+// window until ctx is done.
+func (c *Controller) runSummaries(ctx context.Context) {
+	ticker := time.NewTicker(c.summarizer.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, summary := range c.summarizer.flush(now) {
+				c.retainEvent(summary)
+				c.storeEvent(summary)
+				c.exportEvent(summary)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func healthCheckEvent(pid int, at time.Time) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: "ev", Type: "process_start", Severity: "INFO", Timestamp: at, PodName: "web-1", PodNamespace: "prod",
+		Process:  &types.ProcessEventData{PID: pid, Name: "curl", Cmdline: []string{"curl", "-f", "localhost/healthz"}},
+		Metadata: map[string]interface{}{"cmdline_hash": "abc"},
+	}
+}
+
+func TestEventSummarizer(t *testing.T) {
+	s := newEventSummarizer(time.Hour)
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	if !s.admit(healthCheckEvent(100, start)) {
+		t.Fatal("first event of a window was summarized")
+	}
+	for i := 1; i <= 3; i++ {
+		if s.admit(healthCheckEvent(100+i, start.Add(time.Duration(i)*time.Minute))) {
+			t.Fatalf("repeat %d was not summarized", i)
+		}
+	}
+	other := healthCheckEvent(200, start)
+	other.Process.Cmdline = []string{"curl", "-f", "localhost/readyz"}
+	if !s.admit(other) {
+		t.Error("a different command line was summarized")
+	}
+	high := healthCheckEvent(300, start)
+	high.Severity = "HIGH"
+	if !s.admit(high) || !s.admit(high) {
+		t.Error("HIGH events were summarized")
+	}
+	matched := healthCheckEvent(400, start)
+	matched.Process.MatchedIOC = &types.IOCMatch{Type: types.IOCTypeHash, Indicator: "x", Feed: "local"}
+	if !s.admit(matched) {
+		t.Error("event with an IOC match was summarized")
+	}
+
+	now := start.Add(time.Hour)
+	summaries := s.flush(now)
+	if len(summaries) != 1 {
+		t.Fatalf("summaries = %d, want 1", len(summaries))
+	}
+	sum := summaries[0]
+	if sum.Process.Name != "curl" || !sum.Timestamp.Equal(now) || sum.ID == "ev" {
+		t.Errorf("summary event = %+v", sum)
+	}
+	want := map[string]interface{}{
+		"cmdline_hash": "abc", "summary_count": 3, "summary_window": "1h0m0s",
+		"first_seen": "2026-01-01T10:01:00Z", "last_seen": "2026-01-01T10:03:00Z",
+	}
+	for k, v := range want {
+		if sum.Metadata[k] != v {
+			t.Errorf("metadata[%s] = %v, want %v", k, sum.Metadata[k], v)
+		}
+	}
+
+	// A new window starts empty.
+	if !s.admit(healthCheckEvent(500, now)) {
+		t.Error("first event of the next window was summarized")
+	}
+	if got := s.flush(now.Add(time.Hour)); len(got) != 0 {
+		t.Errorf("window without repeats produced %d summaries", len(got))
+	}
+}
+
+func TestController_EventSummaries(t *testing.T) {
+	c := New(config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, EventRetentionCount: 100,
+		EventSummaryWindow: 100 * time.Millisecond,
+	}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	for i := 0; i < 5; i++ {
+		if err := c.IngestEvent(ctx, healthCheckEvent(100+i, time.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The events usually fall in one window, giving the first event and a
+	// summary of 4, but a window may end part way through.
+	deadline := time.Now().Add(2 * time.Second)
+	var items []*types.SecurityEvent
+	total := 0
+	for time.Now().Before(deadline) && total < 5 {
+		time.Sleep(20 * time.Millisecond)
+		items = c.ExportEvents(0, 0, func(*types.SecurityEvent) bool { return true }).Items
+		total = 0
+		for _, e := range items {
+			if n, ok := e.Metadata["summary_count"].(int); ok {
+				total += n
+			} else {
+				total++
+			}
+		}
+	}
+	if total != 5 || len(items) >= 5 {
+		t.Errorf("retained %d events covering %d, want fewer than 5 covering all 5", len(items), total)
+	}
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/version"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/syslog"
+)
+
+// Device fields of the CEF header of exported records.
+const (
+	cefVendor  = "Invisible Technologies"
+	cefProduct = "APSS"
+)
+
+// initSyslog exports alerts, and events when configured, to a syslog
+// collector when an address is set. Messages are sent by Start.
+func (c *Controller) initSyslog() {
+	if c.cfg.SyslogAddress == "" {
+		return
+	}
+	if !syslog.ValidFormat(c.cfg.SyslogFormat) {
+		c.log.WithField("format", c.cfg.SyslogFormat).Error("Invalid syslog format, syslog export disabled")
+		return
+	}
+	host, _ := os.Hostname()
+	exp, err := syslog.NewExporter(syslog.Config{
+		Address:  c.cfg.SyslogAddress,
+		Protocol: c.cfg.SyslogProtocol,
+		Facility: c.cfg.SyslogFacility,
+		Hostname: host,
+		Egress:   c.cfg.SyslogEgress,
+	}, c.log)
+	if err != nil {
+		c.log.WithError(err).Error("Invalid syslog exporter config, syslog export disabled")
+		return
+	}
+	warnInsecureEgress(c.log, "syslog", c.cfg.SyslogEgress)
+	c.syslog = exp
+	c.log.WithField("address", c.cfg.SyslogAddress).WithField("format", c.cfg.SyslogFormat).
+		WithField("events", c.cfg.SyslogEvents).Info("Exporting alerts over syslog")
+}
+
+// syslogSeverity maps an APSS severity to a syslog severity.
+func syslogSeverity(severity string) int {
+	switch severity {
+	case "CRITICAL":
+		return syslog.SeverityCritical
+	case "HIGH":
+		return syslog.SeverityError
+	case "MEDIUM":
+		return syslog.SeverityWarning
+	case "LOW":
+		return syslog.SeverityNotice
+	}
+	return syslog.SeverityInfo
+}
+
+// cefSeverity maps an APSS severity onto CEF's 0 to 10 scale.
+func cefSeverity(severity string) int {
+	switch severity {
+	case "CRITICAL":
+		return 10
+	case "HIGH":
+		return 8
+	case "MEDIUM":
+		return 5
+	case "LOW":
+		return 3
+	}
+	return 1
+}
+
+// cefFields collects CEF extensions. Custom string fields (cs1 to cs6) are
+// numbered in the order they are added, with their label alongside.
+type cefFields struct {
+	ext    []syslog.CEFExtension
+	custom int
+}
+
+func (f *cefFields) add(key, value string) {
+	f.ext = append(f.ext, syslog.CEFExtension{Key: key, Value: value})
+}
+
+func (f *cefFields) addCustom(label, value string) {
+	if value == "" || f.custom == 6 {
+		return
+	}
+	f.custom++
+	n := strconv.Itoa(f.custom)
+	f.add("cs"+n+"Label", label)
+	f.add("cs"+n, value)
+}
+
+// sdParams collects RFC 5424 structured data parameters, leaving out empty
+// values.
+type sdParams []syslog.SDParam
+
+func (p *sdParams) add(name, value string) {
+	if value != "" {
+		*p = append(*p, syslog.SDParam{Name: name, Value: value})
+	}
+}
+
+// alertSyslog renders an alert in the configured syslog format.
+func (c *Controller) alertSyslog(a *types.Alert) syslog.Message {
+	m := syslog.Message{Time: a.Timestamp, Severity: syslogSeverity(a.Severity), MsgID: "alert"}
+	if c.cfg.SyslogFormat == syslog.FormatCEF {
+		var f cefFields
+		f.add("rt", strconv.FormatInt(a.Timestamp.UnixMilli(), 10))
+		f.add("externalId", a.ID)
+		f.add("cat", "alert")
+		f.add("msg", a.Description)
+		f.addCustom("namespace", a.PodNS)
+		f.addCustom("pod", a.PodName)
+		f.addCustom("mitreTactic", a.MitreTactic)
+		f.addCustom("mitreTechnique", a.MitreID)
+		f.addCustom("status", a.Status)
+		f.addCustom("cluster", a.ClusterName)
+		m.Msg = (&syslog.CEF{
+			DeviceVendor:  cefVendor,
+			DeviceProduct: cefProduct,
+			DeviceVersion: version.Version,
+			SignatureID:   a.RuleID,
+			Name:          a.RuleName,
+			Severity:      cefSeverity(a.Severity),
+			Extensions:    f.ext,
+		}).String()
+		return m
+	}
+	var p sdParams
+	p.add("alert_id", a.ID)
+	p.add("rule_id", a.RuleID)
+	p.add("rule_name", a.RuleName)
+	p.add("severity", a.Severity)
+	p.add("status", a.Status)
+	p.add("namespace", a.PodNS)
+	p.add("pod", a.PodName)
+	p.add("mitre_tactic", a.MitreTactic)
+	p.add("mitre_id", a.MitreID)
+	p.add("incident_id", a.IncidentID)
+	p.add("cluster", a.ClusterName)
+	p.add("environment", a.Environment)
+	m.StructuredData = []syslog.SDElement{{ID: c.cfg.SyslogSDID, Params: p}}
+	m.Msg = jsonBody(a)
+	return m
+}
+
+// eventSyslog renders an event in the configured syslog format, using the
+// CEF dictionary's process, network and file fields where they fit. The
+// file fields describe the file an event touched, so the process executable
+// goes in sproc and its hash in a custom field.
+func (c *Controller) eventSyslog(e *types.SecurityEvent) syslog.Message {
+	at := eventTime(e)
+	m := syslog.Message{Time: at, Severity: syslogSeverity(e.Severity), MsgID: "event"}
+	if c.cfg.SyslogFormat == syslog.FormatCEF {
+		var f cefFields
+		f.add("rt", strconv.FormatInt(at.UnixMilli(), 10))
+		f.add("externalId", e.ID)
+		f.add("cat", "event")
+		if p := e.Process; p != nil {
+			f.add("dproc", p.Name)
+			f.add("dpid", strconv.Itoa(p.PID))
+			f.add("sproc", p.ExePath)
+		}
+		if n := e.Network; n != nil {
+			f.add("proto", strings.ToUpper(n.Protocol))
+			f.add("src", n.SrcIP)
+			if n.SrcPort != 0 {
+				f.add("spt", strconv.Itoa(n.SrcPort))
+			}
+			f.add("dst", n.DstIP)
+			f.add("dpt", strconv.Itoa(n.DstPort))
+			f.add("dhost", n.Domain)
+		}
+		if fl := e.File; fl != nil {
+			f.add("filePath", fl.Path)
+			f.add("act", fl.Operation)
+		}
+		f.addCustom("namespace", e.PodNamespace)
+		f.addCustom("pod", e.PodName)
+		f.addCustom("agentId", e.AgentID)
+		if e.Process != nil {
+			f.addCustom("commandLine", strings.Join(e.Process.Cmdline, " "))
+			f.addCustom("exeHash", e.Process.ExeHash)
+		}
+		m.Msg = (&syslog.CEF{
+			DeviceVendor:  cefVendor,
+			DeviceProduct: cefProduct,
+			DeviceVersion: version.Version,
+			SignatureID:   e.Type,
+			Name:          e.Type,
+			Severity:      cefSeverity(e.Severity),
+			Extensions:    f.ext,
+		}).String()
+		return m
+	}
+	var p sdParams
+	p.add("event_id", e.ID)
+	p.add("type", e.Type)
+	p.add("severity", e.Severity)
+	p.add("agent_id", e.AgentID)
+	p.add("namespace", e.PodNamespace)
+	p.add("pod", e.PodName)
+	m.StructuredData = []syslog.SDElement{{ID: c.cfg.SyslogSDID, Params: p}}
+	m.Msg = jsonBody(e)
+	return m
+}
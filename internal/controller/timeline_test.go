@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestController_GetTimeline(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+
+	// web-1 was created at 0s, its app container first started at 10s,
+	// crashed at 50s and restarted at 60s.
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "prod", CreationTimestamp: metav1.NewTime(at(0))},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:         "app",
+			RestartCount: 1,
+			State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(at(60))}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				ExitCode: 137, Reason: "OOMKilled", StartedAt: metav1.NewTime(at(10)), FinishedAt: metav1.NewTime(at(50)),
+			}},
+		}}},
+	}
+	events := corev1.EventList{Items: []corev1.Event{{
+		ObjectMeta: metav1.ObjectMeta{UID: "u1"}, Reason: "Scheduled", Message: "Successfully assigned prod/web-1", LastTimestamp: metav1.NewTime(at(1)),
+	}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/prod/pods/web-1":
+			json.NewEncoder(w).Encode(pod)
+		case "/api/v1/namespaces/prod/events":
+			if got := r.URL.Query().Get("fieldSelector"); got != "involvedObject.kind=Pod,involvedObject.name=web-1" {
+				t.Errorf("fieldSelector = %q", got)
+			}
+			json.NewEncoder(w).Encode(events)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, EventRetentionCount: 100}, logrus.New())
+	c.kube = kube.NewClient(srv.URL, srv.Client())
+	occurred := func(s int) *time.Time { t := at(s); return &t }
+	for _, e := range []*types.SecurityEvent{
+		// The app's entrypoint, then a shell exec'd into the pod.
+		{ID: "e1", Type: "process_start", Timestamp: at(62), OccurredAt: occurred(61), PodNamespace: "prod", PodName: "web-1", Process: &types.ProcessEventData{PID: 8, Name: "app"}},
+		{ID: "e2", Type: "process_start", Severity: "MEDIUM", Timestamp: at(120), PodNamespace: "prod", PodName: "web-1", Process: &types.ProcessEventData{PID: 40, Name: "sh", Cmdline: []string{"/bin/sh"}}},
+		{ID: "e3", Type: "network_connection", Timestamp: at(130), PodNamespace: "prod", PodName: "web-1", Network: &types.NetworkEventData{DstIP: "203.0.113.9", DstPort: 443}},
+		{ID: "other", Type: "process_start", Timestamp: at(120), PodNamespace: "prod", PodName: "web-2", Process: &types.ProcessEventData{PID: 40}},
+	} {
+		c.retainEvent(e)
+	}
+	c.alerts = append(c.alerts, &types.Alert{ID: "a1", Timestamp: at(121), RuleID: "APSS-004", RuleName: "Shell Spawned in Container", Severity: "MEDIUM", PodNS: "prod", PodName: "web-1"})
+	registered := at(12)
+	c.agents["agent-1"] = &types.AgentInfo{ID: "agent-1", PodNamespace: "prod", PodName: "web-1", RegisteredAt: &registered}
+
+	tl, err := c.GetTimeline(context.Background(), types.TimelineQuery{Namespace: "prod", Pod: "web-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range tl.Entries {
+		got = append(got, e.ID)
+	}
+	want := []string{
+		"created", "k8s:u1",
+		"container_started:app:" + strconv.FormatInt(at(10).UnixNano(), 10), "agent:agent-1",
+		"terminated:app:" + strconv.FormatInt(at(50).UnixNano(), 10), "container_restarted:app:" + strconv.FormatInt(at(60).UnixNano(), 10),
+		"e1", "e2", "exec:e2", "a1", "e3",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if tl.Total != len(want) || len(tl.Warnings) != 0 {
+		t.Errorf("total %d, warnings %v", tl.Total, tl.Warnings)
+	}
+	if term := tl.Entries[4].Lifecycle; term.Reason != "OOMKilled" || *term.ExitCode != 137 {
+		t.Errorf("termination = %+v", term)
+	}
+
+	page, _ := c.GetTimeline(context.Background(), types.TimelineQuery{Namespace: "prod", Pod: "web-1", Since: at(61), Order: types.SortDesc, Limit: 2, Offset: 1})
+	if page.Total != 5 || len(page.Entries) != 2 || page.Entries[0].ID != "a1" || page.Entries[1].ID != "exec:e2" {
+		t.Errorf("page = %+v", page)
+	}
+
+	// Without the API, events and alerts remain but execs cannot be told
+	// from container starts.
+	c.kube = nil
+	tl, _ = c.GetTimeline(context.Background(), types.TimelineQuery{Namespace: "prod", Pod: "web-1"})
+	if tl.Total != 5 || len(tl.Warnings) != 1 {
+		t.Errorf("without the API: %d entries, warnings %v", tl.Total, tl.Warnings)
+	}
+	if _, err := c.GetTimeline(context.Background(), types.TimelineQuery{Namespace: "prod", Pod: "nope"}); !errors.Is(err, ErrPodNotFound) {
+		t.Errorf("unknown pod: err = %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+var (
+	// ErrSuppressionNotFound is returned for an unknown suppression ID.
+	ErrSuppressionNotFound = errors.New("suppression not found")
+	// ErrInvalidSuppression is returned when a suppression names no rule, a
+	// cause the alert has no hint for, or an unparsable TTL.
+	ErrInvalidSuppression = errors.New("invalid suppression")
+)
+
+var (
+	triageHints = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_triage_hints_total",
+			Help: "Probable-cause hints attached to alerts, by cause",
+		},
+		[]string{"cause"},
+	)
+	alertsSuppressed = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_alerts_suppressed_total",
+			Help: "Alerts dropped by a suppression, by rule",
+		},
+		[]string{"rule"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(triageHints)
+	prometheus.MustRegister(alertsSuppressed)
+}
+
+// accountFiles are the files useradd and similar tools rewrite.
+var accountFiles = map[string]bool{
+	"/etc/passwd": true, "/etc/shadow": true, "/etc/group": true, "/etc/gshadow": true,
+}
+
+// accountTools are the processes that legitimately rewrite accountFiles.
+var accountTools = map[string]bool{
+	"useradd": true, "adduser": true, "userdel": true, "deluser": true, "usermod": true,
+	"groupadd": true, "addgroup": true, "groupdel": true, "delgroup": true, "groupmod": true,
+	"chpasswd": true, "passwd": true,
+}
+
+// triageObs is a kubectl exec into a pod or an account tool run in it.
+type triageObs struct {
+	at      time.Time
+	eventID string
+	detail  string
+}
+
+// triageTracker keeps the kubectl execs and account tool runs of the last
+// window per pod, so alerts that follow them can be explained. It is only
+// used from processEvents and needs no lock.
+type triageTracker struct {
+	window time.Duration
+	execs  map[string][]triageObs
+	tools  map[string][]triageObs
+	// lastSweep is when observations older than window were last dropped.
+	lastSweep time.Time
+}
+
+func newTriageTracker(window time.Duration) *triageTracker {
+	return &triageTracker{
+		window: window,
+		execs:  make(map[string][]triageObs),
+		tools:  make(map[string][]triageObs),
+	}
+}
+
+// isExecAudit reports whether e is the webhook's record of a kubectl exec or
+// attach into a pod.
+func isExecAudit(e *types.SecurityEvent) bool {
+	return e.Audit != nil && (e.Audit.Resource == "pods/exec" || e.Audit.Resource == "pods/attach")
+}
+
+func isAccountTool(e *types.SecurityEvent) bool {
+	return e.Process != nil && e.Type == "process_start" && accountTools[path.Base(e.Process.Name)]
+}
+
+// observeTriage records the activity later alerts may be explained by. It
+// runs before the event is evaluated, so an event never explains itself.
+func (c *Controller) observeTriage(event *types.SecurityEvent) {
+	t := c.triage
+	if t == nil {
+		return
+	}
+	at := eventTime(event)
+	t.sweep(at)
+	switch {
+	case isExecAudit(event):
+		key := podKey(event.Audit.Namespace, event.Audit.Name)
+		t.execs[key] = append(t.execs[key], triageObs{at: at, eventID: event.ID, detail: event.Audit.User})
+	case isAccountTool(event):
+		key := podKey(event.PodNamespace, event.PodName)
+		t.tools[key] = append(t.tools[key], triageObs{at: at, eventID: event.ID, detail: event.Process.Name})
+	}
+}
+
+// sweep drops observations older than the window, at most once per window.
+func (t *triageTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.window {
+		return
+	}
+	t.lastSweep = now
+	for _, m := range []map[string][]triageObs{t.execs, t.tools} {
+		for key, obs := range m {
+			kept := obs[:0]
+			for _, o := range obs {
+				if now.Sub(o.at) <= t.window {
+					kept = append(kept, o)
+				}
+			}
+			if len(kept) == 0 {
+				delete(m, key)
+			} else {
+				m[key] = kept
+			}
+		}
+	}
+}
+
+// latest returns the most recent observation in obs at most window before
+// at. A small skew the other way is tolerated, as the webhook and the agent
+// have separate clocks.
+func (t *triageTracker) latest(obs []triageObs, at time.Time) (triageObs, bool) {
+	for i := len(obs) - 1; i >= 0; i-- {
+		if d := at.Sub(obs[i].at); d <= t.window && d >= -time.Second {
+			return obs[i], true
+		}
+	}
+	return triageObs{}, false
+}
+
+// triageAlert attaches probable-cause hints to an alert raised for event:
+// a shell or exec'd process shortly after a kubectl exec into the pod, and
+// an account file change shortly after an account tool ran in the pod or
+// while the container was starting.
+func (c *Controller) triageAlert(alert *types.Alert, event *types.SecurityEvent) {
+	t := c.triage
+	if t == nil {
+		return
+	}
+	at := eventTime(event)
+	key := podKey(event.PodNamespace, event.PodName)
+	if event.Process != nil && (isShellEvent(event) || event.Process.PPID == 0 && event.Process.PID != 1) {
+		if o, ok := t.latest(t.execs[key], at); ok {
+			who := "kubectl exec"
+			if o.detail != "" {
+				who += " by " + o.detail
+			}
+			alert.Hints = append(alert.Hints, types.TriageHint{
+				Cause:       types.CauseKubectlExec,
+				Explanation: fmt.Sprintf("%s started %s after a %s into the pod", processName(event), at.Sub(o.at).Round(time.Millisecond), who),
+				EventIDs:    []string{o.eventID},
+			})
+		}
+	}
+	accountChange := event.File != nil && accountFiles[event.File.Path] && event.File.Operation != "delete"
+	if accountChange {
+		if o, ok := t.latest(t.tools[key], at); ok {
+			alert.Hints = append(alert.Hints, types.TriageHint{
+				Cause:       types.CauseAccountTool,
+				Explanation: fmt.Sprintf("%s changed %s after %s ran in the pod", event.File.Operation, event.File.Path, o.detail),
+				EventIDs:    []string{o.eventID},
+			})
+		}
+	}
+	if accountChange && c.cfg.TriageInitWindow > 0 {
+		if started, ok := c.agentConnectedAt(event.AgentID); ok && at.Sub(started) <= c.cfg.TriageInitWindow {
+			alert.Hints = append(alert.Hints, types.TriageHint{
+				Cause:       types.CauseContainerInit,
+				Explanation: fmt.Sprintf("%s changed %s %s after the pod's agent started, during container initialization", event.File.Operation, event.File.Path, at.Sub(started).Round(time.Second)),
+			})
+		}
+	}
+	for i := range alert.Hints {
+		h := &alert.Hints[i]
+		h.Suppression = &types.Suppression{RuleID: alert.RuleID, Namespace: alert.PodNS, Cause: h.Cause, AlertID: alert.ID}
+		triageHints.WithLabelValues(h.Cause).Inc()
+	}
+}
+
+func processName(e *types.SecurityEvent) string {
+	if e.Process.Name != "" {
+		return e.Process.Name
+	}
+	return "process"
+}
+
+// agentConnectedAt returns when agent id connected, if it is known.
+func (c *Controller) agentConnectedAt(id string) (time.Time, bool) {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	agent, ok := c.agents[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return agent.ConnectedAt, true
+}
+
+// suppressed reports whether a suppression silences alert, counting the
+// match against it.
+func (c *Controller) suppressed(alert *types.Alert) bool {
+	now := time.Now()
+	c.suppressionsMu.Lock()
+	defer c.suppressionsMu.Unlock()
+	for i, s := range c.suppressions {
+		if !s.Silences(alert, now) {
+			continue
+		}
+		updated := *s
+		updated.Matches++
+		updated.LastMatched = &now
+		c.suppressions[i] = &updated
+		alertsSuppressed.WithLabelValues(alert.RuleID).Inc()
+		c.log.WithFields(logrus.Fields{
+			"alert_id": alert.ID, "rule_id": alert.RuleID, "suppression_id": s.ID,
+		}).Debug("Alert suppressed")
+		return true
+	}
+	return false
+}
+
+// GetSuppressions returns the suppressions that have not expired, oldest
+// first.
+func (c *Controller) GetSuppressions() []*types.Suppression {
+	now := time.Now()
+	c.suppressionsMu.Lock()
+	defer c.suppressionsMu.Unlock()
+	c.dropExpiredSuppressions(now)
+	return append([]*types.Suppression{}, c.suppressions...)
+}
+
+// AddSuppression stores s, filling in its ID and creation time, and returns
+// it as stored.
+func (c *Controller) AddSuppression(s types.Suppression) (*types.Suppression, error) {
+	if s.RuleID == "" {
+		return nil, fmt.Errorf("%w: rule_id is required", ErrInvalidSuppression)
+	}
+	now := time.Now()
+	s.ID = fmt.Sprintf("suppression-%d", now.UnixNano())
+	s.CreatedAt = now
+	s.Matches = 0
+	s.LastMatched = nil
+	c.suppressionsMu.Lock()
+	c.dropExpiredSuppressions(now)
+	c.suppressions = append(c.suppressions, &s)
+	stored := s
+	c.suppressionsMu.Unlock()
+	c.storeSuppression(stored)
+	c.audit(types.AuditSuppressionAdded, s.ID, map[string]string{"rule_id": s.RuleID, "namespace": s.Namespace, "reason": s.Reason})
+
+	c.log.WithFields(logrus.Fields{
+		"suppression_id": s.ID, "rule_id": s.RuleID, "namespace": s.Namespace,
+		"cause": s.Cause, "alert_id": s.AlertID, "reason": s.Reason,
+	}).Info("Suppression added")
+	return &s, nil
+}
+
+// SuppressAlert accepts one of alert id's triage hints, chosen by
+// req.Cause or else the first, as a suppression of its rule in the alert's
+// namespace. An alert without hints is suppressed for its rule and
+// namespace regardless of cause.
+func (c *Controller) SuppressAlert(id string, req types.SuppressRequest) (*types.Suppression, error) {
+	alert, err := c.GetAlert(id)
+	if err != nil {
+		return nil, err
+	}
+	s := types.Suppression{RuleID: alert.RuleID, Namespace: alert.PodNS, AlertID: alert.ID, Reason: req.Reason}
+	switch {
+	case req.Cause != "":
+		for _, h := range alert.Hints {
+			if h.Cause == req.Cause {
+				s.Cause = h.Cause
+			}
+		}
+		if s.Cause == "" {
+			return nil, fmt.Errorf("%w: alert has no %q hint", ErrInvalidSuppression, req.Cause)
+		}
+	case len(alert.Hints) > 0:
+		s.Cause = alert.Hints[0].Cause
+	}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("%w: ttl %q", ErrInvalidSuppression, req.TTL)
+		}
+		expires := time.Now().Add(ttl)
+		s.ExpiresAt = &expires
+	}
+	return c.AddSuppression(s)
+}
+
+// DeleteSuppression removes suppression id.
+func (c *Controller) DeleteSuppression(id string) error {
+	c.suppressionsMu.Lock()
+	defer c.suppressionsMu.Unlock()
+	for i, s := range c.suppressions {
+		if s.ID == id {
+			c.suppressions = append(c.suppressions[:i:i], c.suppressions[i+1:]...)
+			c.unstoreSuppression(id)
+			c.audit(types.AuditSuppressionDeleted, id, nil)
+			c.log.WithField("suppression_id", id).Info("Suppression deleted")
+			return nil
+		}
+	}
+	return ErrSuppressionNotFound
+}
+
+// dropExpiredSuppressions removes suppressions past their expiry. Caller
+// must hold suppressionsMu.
+func (c *Controller) dropExpiredSuppressions(now time.Time) {
+	kept := c.suppressions[:0]
+	for _, s := range c.suppressions {
+		if s.ExpiresAt == nil || now.Before(*s.ExpiresAt) {
+			kept = append(kept, s)
+		}
+	}
+	c.suppressions = kept
+}
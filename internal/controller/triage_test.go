@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func newTriageTestController(t *testing.T) *Controller {
+	t.Helper()
+	c := New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, TriageWindow: 5 * time.Second, TriageInitWindow: time.Minute}, logrus.New())
+	if err := c.RegisterAgent(&types.AgentRegistration{AgentID: "agent-b", PodName: "db", PodNamespace: "data"}); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	return c
+}
+
+func execAuditEvent(id string, at time.Time) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: id, AgentID: "apss-webhook", Type: "k8s_audit", Timestamp: at, PodName: "db", PodNamespace: "data",
+		Audit: &types.AuditEventData{Verb: "connect", Resource: "pods/exec", Name: "db", Namespace: "data", User: "alice"},
+	}
+}
+
+func accountFileEvent(id string, at time.Time) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: id, AgentID: "agent-b", Type: "file_modify", Timestamp: at, PodName: "db", PodNamespace: "data",
+		File: &types.FileEventData{Path: "/etc/passwd", Operation: "modify"},
+	}
+}
+
+func hintCauses(alert *types.Alert) []string {
+	var causes []string
+	for _, h := range alert.Hints {
+		causes = append(causes, h.Cause)
+	}
+	return causes
+}
+
+func TestController_TriageKubectlExec(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		exec  time.Time
+		shell time.Time
+		want  bool
+	}{
+		{"shell after exec", now, now.Add(2 * time.Second), true},
+		{"slight clock skew", now, now.Add(-500 * time.Millisecond), true},
+		{"outside window", now, now.Add(10 * time.Second), false},
+		{"shell long before exec", now, now.Add(-10 * time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTriageTestController(t)
+			c.observeTriage(execAuditEvent("audit-1", tt.exec))
+			shell := shellEvent("e1", tt.shell)
+			alert := &types.Alert{ID: "a1", RuleID: "APSS-004", PodName: "db", PodNS: "data"}
+			c.triageAlert(alert, shell)
+			if got := len(alert.Hints) == 1; got != tt.want {
+				t.Fatalf("hints = %+v, want hint %v", alert.Hints, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			h := alert.Hints[0]
+			if h.Cause != types.CauseKubectlExec || len(h.EventIDs) != 1 || h.EventIDs[0] != "audit-1" {
+				t.Errorf("hint = %+v", h)
+			}
+			if s := h.Suppression; s == nil || s.RuleID != "APSS-004" || s.Namespace != "data" || s.Cause != types.CauseKubectlExec || s.AlertID != "a1" {
+				t.Errorf("suggested suppression = %+v", h.Suppression)
+			}
+		})
+	}
+}
+
+func TestController_TriageAccountFiles(t *testing.T) {
+	c := newTriageTestController(t)
+	// The agent registered just now, so the change is also during init.
+	now := time.Now()
+	c.observeTriage(&types.SecurityEvent{
+		ID: "tool-1", AgentID: "agent-b", Type: "process_start", Timestamp: now, PodName: "db", PodNamespace: "data",
+		Process: &types.ProcessEventData{Name: "useradd"},
+	})
+	alert := &types.Alert{ID: "a1", RuleID: "APSS-003", PodName: "db", PodNS: "data"}
+	c.triageAlert(alert, accountFileEvent("e1", now.Add(time.Second)))
+	if causes := hintCauses(alert); len(causes) != 2 || causes[0] != types.CauseAccountTool || causes[1] != types.CauseContainerInit {
+		t.Errorf("causes = %v", causes)
+	}
+
+	later := &types.Alert{ID: "a2", RuleID: "APSS-003", PodName: "db", PodNS: "data"}
+	c.triageAlert(later, accountFileEvent("e2", now.Add(2*time.Minute)))
+	if len(later.Hints) != 0 {
+		t.Errorf("change long after init and tools got hints %v", hintCauses(later))
+	}
+}
+
+func TestController_Suppressions(t *testing.T) {
+	hinted := &types.Alert{
+		ID: "a1", RuleID: "APSS-004", PodNS: "data", Timestamp: time.Now(),
+		Hints: []types.TriageHint{{Cause: types.CauseKubectlExec}},
+	}
+	c := newTestControllerWithAlerts(t, hinted, &types.Alert{ID: "a2", RuleID: "APSS-001", PodNS: "data"})
+
+	if _, err := c.SuppressAlert("a1", types.SuppressRequest{Cause: types.CauseAccountTool}); !errors.Is(err, ErrInvalidSuppression) {
+		t.Errorf("cause without a hint: err = %v", err)
+	}
+	if _, err := c.SuppressAlert("a1", types.SuppressRequest{TTL: "soon"}); !errors.Is(err, ErrInvalidSuppression) {
+		t.Errorf("bad ttl: err = %v", err)
+	}
+	if _, err := c.SuppressAlert("missing", types.SuppressRequest{}); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("missing alert: err = %v", err)
+	}
+	sup, err := c.SuppressAlert("a1", types.SuppressRequest{Reason: "on-call debugging", TTL: "1h"})
+	if err != nil {
+		t.Fatalf("SuppressAlert: %v", err)
+	}
+	if sup.ID == "" || sup.Cause != types.CauseKubectlExec || sup.Namespace != "data" || sup.ExpiresAt == nil {
+		t.Errorf("suppression = %+v", sup)
+	}
+
+	same := &types.Alert{ID: "a3", RuleID: "APSS-004", PodNS: "data", Hints: []types.TriageHint{{Cause: types.CauseKubectlExec}}}
+	unexplained := &types.Alert{ID: "a4", RuleID: "APSS-004", PodNS: "data"}
+	otherNS := &types.Alert{ID: "a5", RuleID: "APSS-004", PodNS: "prod", Hints: same.Hints}
+	if !c.suppressed(same) {
+		t.Error("alert with the same rule, namespace and cause should be suppressed")
+	}
+	if c.suppressed(unexplained) || c.suppressed(otherNS) {
+		t.Error("alerts without the hint or in another namespace must still fire")
+	}
+	if got := c.GetSuppressions(); len(got) != 1 || got[0].Matches != 1 || got[0].LastMatched == nil {
+		t.Errorf("suppressions = %+v", got)
+	}
+
+	if err := c.DeleteSuppression(sup.ID); err != nil {
+		t.Fatalf("DeleteSuppression: %v", err)
+	}
+	if err := c.DeleteSuppression(sup.ID); !errors.Is(err, ErrSuppressionNotFound) {
+		t.Errorf("second delete: err = %v", err)
+	}
+	if c.suppressed(same) {
+		t.Error("deleted suppression still applies")
+	}
+}
+
+func TestController_SuppressionExpires(t *testing.T) {
+	c := newTestControllerWithAlerts(t)
+	past := time.Now().Add(-time.Minute)
+	if _, err := c.AddSuppression(types.Suppression{RuleID: "APSS-004", ExpiresAt: &past}); err != nil {
+		t.Fatalf("AddSuppression: %v", err)
+	}
+	if c.suppressed(&types.Alert{RuleID: "APSS-004"}) {
+		t.Error("expired suppression applied")
+	}
+	if got := c.GetSuppressions(); len(got) != 0 {
+		t.Errorf("expired suppressions listed: %+v", got)
+	}
+	if _, err := c.AddSuppression(types.Suppression{}); !errors.Is(err, ErrInvalidSuppression) {
+		t.Errorf("no rule: err = %v", err)
+	}
+}
@@ -0,0 +1,434 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/detection"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/notify"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/storage"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/version"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/otlp"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/sweetsecurity"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/syslog"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/yara"
+)
+
+// ConfigProblem is a setting or file ValidateConfig found invalid. File and
+// Line are set when the problem is in a file, Line when it could be placed.
+type ConfigProblem struct {
+	Setting string
+	File    string
+	Line    int
+	Message string
+}
+
+func (p ConfigProblem) String() string {
+	switch {
+	case p.Line > 0:
+		return fmt.Sprintf("%s:%d: %s: %s", p.File, p.Line, p.Setting, p.Message)
+	case p.File != "":
+		return fmt.Sprintf("%s: %s: %s", p.File, p.Setting, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Setting, p.Message)
+}
+
+var (
+	// yamlLine finds the line of a YAML syntax error.
+	yamlLine = regexp.MustCompile(`line (\d+)`)
+	// errSubjects find what a loader error is about, most specific first: a
+	// Sigma field or selection, then the rule or webhook.
+	errSubjects = []*regexp.Regexp{
+		regexp.MustCompile(`field ([^:\s]+):`),
+		regexp.MustCompile(`selection ([^:\s]+):`),
+		regexp.MustCompile(`^(?:sigma rule|rule|webhook) "?([^":\s]+)"?:`),
+	}
+)
+
+// problemLine places err in data: the line a YAML syntax error names, or
+// the first line mentioning what the error is about.
+func problemLine(data []byte, err error) int {
+	msg := err.Error()
+	if m := yamlLine.FindStringSubmatch(msg); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	for _, re := range errSubjects {
+		if m := re.FindStringSubmatch(msg); m != nil {
+			if n := lineOf(data, m[1]); n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// lineOf returns the first line of data containing s, or 0.
+func lineOf(data []byte, s string) int {
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if bytes.Contains(line, []byte(s)) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// configValidator collects the problems of one configuration.
+type configValidator struct {
+	cfg      config.ControllerConfig
+	problems []ConfigProblem
+}
+
+func (v *configValidator) add(setting, file string, line int, format string, args ...interface{}) {
+	v.problems = append(v.problems, ConfigProblem{Setting: setting, File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// readFile returns file's content, recording a problem if it cannot be read.
+func (v *configValidator) readFile(setting, file string) ([]byte, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		v.add(setting, file, 0, "%v", err)
+		return nil, false
+	}
+	return data, true
+}
+
+// ValidateConfig loads every rule, sink, mapping and key file cfg names and
+// checks the settings the controller would otherwise only reject, often
+// by disabling an integration, once running. It reports all problems, with
+// the line in the file where one can be placed, so configuration can be
+// checked in CI.
+func ValidateConfig(cfg config.ControllerConfig) []ConfigProblem {
+	v := &configValidator{cfg: cfg}
+	for _, msg := range config.InvalidEnv() {
+		v.add("environment", "", 0, "%s", msg)
+	}
+	v.validateRules()
+	v.validatePlaybooks()
+	v.validateYara()
+	v.validateWebhooks()
+	v.validateSinks()
+	v.validateFiles()
+	v.validateStorage()
+	v.validateSharding()
+	v.validateAgents()
+	return v.problems
+}
+
+// validateRules converts the Sigma rules and checks SHADOW_RULES against
+// the rules that would be loaded.
+func (v *configValidator) validateRules() {
+	engine := detection.NewEngine()
+	if dir := v.cfg.SigmaRulesDir; dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			v.add("SIGMA_RULES_DIR", dir, 0, "%v", err)
+		}
+		seen := make(map[string]string)
+		for _, ent := range entries {
+			ext := filepath.Ext(ent.Name())
+			if ent.IsDir() || (ext != ".yml" && ext != ".yaml") {
+				continue
+			}
+			path := filepath.Join(dir, ent.Name())
+			data, ok := v.readFile("SIGMA_RULES_DIR", path)
+			if !ok {
+				continue
+			}
+			rule, err := detection.ParseSigma(data)
+			if err != nil {
+				v.add("SIGMA_RULES_DIR", path, problemLine(data, err), "%v", err)
+				continue
+			}
+			if prev, dup := seen[rule.ID]; dup {
+				v.add("SIGMA_RULES_DIR", path, lineOf(data, "id:"), "duplicate rule id %s (also in %s)", rule.ID, prev)
+				continue
+			}
+			seen[rule.ID] = ent.Name()
+			engine.AddRules(rule)
+		}
+	}
+	for _, id := range v.cfg.ShadowRules {
+		if !engine.SetShadow(id, true) {
+			v.add("SHADOW_RULES", "", 0, "unknown rule %s", id)
+		}
+	}
+}
+
+// validatePlaybooks checks every playbook, where LoadPlaybooks stops at the
+// first invalid one.
+func (v *configValidator) validatePlaybooks() {
+	file := v.cfg.PlaybooksFile
+	if file == "" {
+		return
+	}
+	data, ok := v.readFile("PLAYBOOKS_FILE", file)
+	if !ok {
+		return
+	}
+	var f detection.PlaybooksFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		v.add("PLAYBOOKS_FILE", file, problemLine(data, err), "%v", err)
+		return
+	}
+	ids := make([]string, 0, len(f.Playbooks))
+	for id := range f.Playbooks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := f.Playbooks[id]
+		if p == nil {
+			v.add("PLAYBOOKS_FILE", file, lineOf(data, id), "rule %s: empty playbook", id)
+		} else if err := detection.ValidatePlaybook(p); err != nil {
+			v.add("PLAYBOOKS_FILE", file, lineOf(data, id), "rule %s: %v", id, err)
+		}
+	}
+}
+
+// validateYara compiles every YARA rule file, where LoadDir reports the
+// files it leaves out without their line.
+func (v *configValidator) validateYara() {
+	dir := v.cfg.YaraRulesDir
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		v.add("YARA_RULES_DIR", dir, 0, "%v", err)
+		return
+	}
+	seen := make(map[string]string)
+	for _, ent := range entries {
+		if ent.IsDir() || !yara.IsRuleFile(ent.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, ent.Name())
+		data, ok := v.readFile("YARA_RULES_DIR", path)
+		if !ok {
+			continue
+		}
+		rules, err := yara.Compile(string(data))
+		var yerr *yara.Error
+		switch {
+		case errors.As(err, &yerr):
+			v.add("YARA_RULES_DIR", path, yerr.Line, "%s", yerr.Msg)
+			continue
+		case err != nil:
+			v.add("YARA_RULES_DIR", path, 0, "%v", err)
+			continue
+		}
+		for _, name := range rules.Names() {
+			if prev, dup := seen[name]; dup {
+				v.add("YARA_RULES_DIR", path, lineOf(data, "rule "+name), "duplicate rule %s (also in %s)", name, prev)
+				continue
+			}
+			seen[name] = ent.Name()
+		}
+	}
+}
+
+// validateWebhooks builds every webhook sink, which parses its body template
+// and egress settings.
+func (v *configValidator) validateWebhooks() {
+	file := v.cfg.WebhookSinksFile
+	if file == "" {
+		return
+	}
+	data, ok := v.readFile("WEBHOOK_SINKS_FILE", file)
+	if !ok {
+		return
+	}
+	configs, err := notify.LoadWebhooks(file)
+	if err != nil {
+		v.add("WEBHOOK_SINKS_FILE", file, problemLine(data, err), "%v", err)
+		return
+	}
+	for _, cfg := range configs {
+		if _, err := notify.NewWebhook(cfg); err != nil {
+			v.add("WEBHOOK_SINKS_FILE", file, problemLine(data, err), "%v", err)
+		}
+	}
+}
+
+// validateSinks checks the settings of the built-in integrations that are
+// turned on.
+func (v *configValidator) validateSinks() {
+	cfg := v.cfg
+	egressOf := func(prefix string, on bool, e egress.Config) {
+		if !on {
+			return
+		}
+		if _, err := e.Transport(); err != nil {
+			v.add(prefix+"_PROXY_URL / "+prefix+"_CA_FILE", "", 0, "%v", err)
+		}
+	}
+	egressOf("SLACK", cfg.SlackWebhookURL != "", cfg.SlackEgress)
+	egressOf("PAGERDUTY", cfg.PagerDutyRoutingKey != "", cfg.PagerDutyEgress)
+	egressOf("GCP", cfg.PubSubTopic != "" || cfg.CloudLoggingEnabled, cfg.GCPEgress)
+	egressOf("SPLUNK", cfg.SplunkEnabled, cfg.SplunkEgress)
+	egressOf("ELASTICSEARCH", cfg.ElasticsearchURL != "", cfg.ElasticsearchEgress)
+	egressOf("SWEET_SECURITY", cfg.SweetSecurityEnabled, cfg.SweetSecurityEgress)
+
+	if cfg.SweetSecurityEnabled {
+		if !sweetsecurity.ValidAuthMode(cfg.SweetSecurityAuthMode) {
+			v.add("SWEET_SECURITY_AUTH_MODE", "", 0, "unknown auth mode %q", cfg.SweetSecurityAuthMode)
+		}
+		if _, err := otlp.ParseHeaders(cfg.SweetSecurityHeaders); err != nil {
+			v.add("SWEET_SECURITY_HEADERS", "", 0, "%v", err)
+		}
+		if _, err := sweetsecurity.NewQueue(nil, sweetsecurity.QueueConfig{Policy: cfg.SweetSecurityDropPolicy}, nil); err != nil {
+			v.add("SWEET_SECURITY_DROP_POLICY", "", 0, "%v", err)
+		}
+	}
+	if file := cfg.DigestTemplateFile; file != "" {
+		if data, ok := v.readFile("NOTIFY_DIGEST_TEMPLATE_FILE", file); ok {
+			if _, err := notify.LoadDigestTemplate(file); err != nil {
+				v.add("NOTIFY_DIGEST_TEMPLATE_FILE", file, problemLine(data, err), "%v", err)
+			}
+		}
+	}
+	if file := cfg.SweetSecurityMappingsFile; file != "" {
+		if data, ok := v.readFile("SWEET_SECURITY_MAPPINGS_FILE", file); ok {
+			if _, err := sweetsecurity.LoadAlertMappings(file); err != nil {
+				v.add("SWEET_SECURITY_MAPPINGS_FILE", file, problemLine(data, err), "%v", err)
+			}
+		}
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		headers, err := otlp.ParseHeaders(cfg.OTLPHeaders)
+		if err != nil {
+			v.add("OTEL_EXPORTER_OTLP_HEADERS", "", 0, "%v", err)
+		}
+		log := logrus.New()
+		log.SetOutput(io.Discard)
+		if _, err := otlp.NewExporter(otlp.Config{
+			Endpoint: cfg.OTLPEndpoint,
+			Protocol: cfg.OTLPProtocol,
+			Headers:  headers,
+			Scope:    otlp.Scope{Name: "github.com/invisible-tech/autopilot-security-sensor", Version: version.Version},
+			Egress:   cfg.OTLPEgress,
+		}, log); err != nil {
+			v.add("OTEL_EXPORTER_OTLP_*", "", 0, "%v", err)
+		}
+	}
+	if cfg.SyslogAddress != "" {
+		if !syslog.ValidFormat(cfg.SyslogFormat) {
+			v.add("SYSLOG_FORMAT", "", 0, "unknown format %q: want %s or %s", cfg.SyslogFormat, syslog.FormatCEF, syslog.FormatRFC5424)
+		}
+		if _, err := syslog.NewExporter(syslog.Config{
+			Address:  cfg.SyslogAddress,
+			Protocol: cfg.SyslogProtocol,
+			Facility: cfg.SyslogFacility,
+			Egress:   cfg.SyslogEgress,
+		}, nil); err != nil {
+			v.add("SYSLOG_*", "", 0, "%v", err)
+		}
+	}
+}
+
+// validateFiles checks the token and key files can be read.
+func (v *configValidator) validateFiles() {
+	tokens := []struct{ setting, file string }{
+		{"AGENT_TOKENS_FILE", v.cfg.AgentTokensFile},
+		{"OPERATOR_TOKENS_FILE", v.cfg.OperatorTokensFile},
+		{"INTEGRATION_TOKENS_FILE", v.cfg.IntegrationTokensFile},
+	}
+	for _, t := range tokens {
+		if t.file == "" {
+			continue
+		}
+		if data, ok := v.readFile(t.setting, t.file); ok && !hasTokens(data) {
+			v.add(t.setting, t.file, 0, "no tokens")
+		}
+	}
+	if file := v.cfg.FileBaselineSigningKeyFile; file != "" {
+		if data, ok := v.readFile("FIM_BASELINE_SIGNING_KEY_FILE", file); ok {
+			if _, err := fileintegrity.ParsePrivateKey(data); err != nil {
+				v.add("FIM_BASELINE_SIGNING_KEY_FILE", file, 0, "%v", err)
+			}
+		}
+	}
+}
+
+// validateStorage checks the storage backend is known and configured,
+// without connecting to it.
+func (v *configValidator) validateStorage() {
+	switch v.cfg.StorageBackend {
+	case "", storage.BackendMemory:
+	case storage.BackendBolt:
+		if v.cfg.StoragePath == "" {
+			v.add("STORAGE_PATH", "", 0, "required by the bbolt backend")
+		}
+	case storage.BackendPostgres:
+		if v.cfg.StoragePostgresDSN == "" {
+			v.add("STORAGE_POSTGRES_DSN", "", 0, "required by the postgres backend")
+		}
+	default:
+		v.add("STORAGE_BACKEND", "", 0, "unknown backend %q", v.cfg.StorageBackend)
+	}
+}
+
+// validateSharding checks that sharded replicas can share their alerts and
+// do not also elect a leader or save per-replica snapshots.
+func (v *configValidator) validateSharding() {
+	if !v.cfg.Sharding {
+		return
+	}
+	if v.cfg.StorageBackend != storage.BackendPostgres {
+		v.add("STORAGE_BACKEND", "", 0, "SHARDING needs the postgres backend to share alerts between replicas")
+	}
+	if v.cfg.LeaderElection {
+		v.add("LEADER_ELECTION", "", 0, "ignored when SHARDING is on")
+	}
+	if v.cfg.StateFile != "" {
+		v.add("STATE_FILE", "", 0, "replicas sharding agents would overwrite each other's snapshot; storage replaces it")
+	}
+}
+
+// validateAgents checks the limits on what agents send.
+func (v *configValidator) validateAgents() {
+	if v.cfg.AgentMinProtocol > types.CurrentProtocol {
+		v.add("AGENT_MIN_PROTOCOL", "", 0, "protocol %d is newer than this controller speaks (%d); every agent would be incompatible",
+			v.cfg.AgentMinProtocol, types.CurrentProtocol)
+	}
+	if v.cfg.AgentEventRate > 0 && v.cfg.MaxBatchEvents > 0 && v.cfg.AgentEventBurst < v.cfg.MaxBatchEvents {
+		v.add("AGENT_EVENT_BURST", "", 0, "%d is below MAX_BATCH_EVENTS (%d); full batches are always partly throttled",
+			v.cfg.AgentEventBurst, v.cfg.MaxBatchEvents)
+	}
+	for _, name := range v.cfg.AgentCapabilities {
+		switch {
+		case name == "none" || servedCapabilities[name]:
+		case name == types.CapabilityGRPC:
+			v.add("AGENT_CAPABILITIES", "", 0, "grpc is not served by this controller")
+		default:
+			v.add("AGENT_CAPABILITIES", "", 0, "unknown capability %q", name)
+		}
+	}
+}
+
+// hasTokens reports whether a token file, one token per line with # comments,
+// has any token.
+func hasTokens(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 && line[0] != '#' {
+			return true
+		}
+	}
+	return false
+}
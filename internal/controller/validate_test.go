@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	sigma := filepath.Join(dir, "sigma")
+	os.Mkdir(sigma, 0o755)
+	writeFile(t, sigma, "good.yml", "id: good\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {Image|endswith: /curl}\n  condition: s\n")
+	writeFile(t, sigma, "modifier.yml", "id: bad\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s:\n    Image|base64: x\n  condition: s\n")
+	writeFile(t, sigma, "syntax.yml", "id: broken\nlevel: low\ndetection: [\n")
+	writeFile(t, sigma, "dup.yml", "title: again\nid: good\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {Image: /bin/sh}\n  condition: s\n")
+	playbooks := writeFile(t, dir, "playbooks.yaml", "playbooks:\n  APSS-001:\n    url: https://wiki.example.com/1\n  APSS-002:\n    url: ftp://wiki.example.com/2\n")
+	webhooks := writeFile(t, dir, "webhooks.yaml", "webhooks:\n  - name: ok\n    url: https://hooks.example.com\n  - name: broken\n    url: https://hooks.example.com\n    body: '{{ .Alert.ID'\n")
+	tokens := writeFile(t, dir, "tokens", "# no tokens yet\n\n")
+
+	cfg := config.ControllerConfig{
+		SigmaRulesDir:      sigma,
+		ShadowRules:        []string{"APSS-001", "SIGMA-good", "APSS-999"},
+		PlaybooksFile:      playbooks,
+		WebhookSinksFile:   webhooks,
+		AgentTokensFile:    tokens,
+		OperatorTokensFile: filepath.Join(dir, "missing"),
+		StorageBackend:     "postgres",
+		Sharding:           true,
+		LeaderElection:     true,
+		AgentMinProtocol:   3,
+		AgentEventRate:     10,
+		AgentEventBurst:    100,
+		MaxBatchEvents:     1000,
+		AgentCapabilities:  []string{"gzip", "grpc", "zstd"},
+	}
+	var got []string
+	for _, p := range ValidateConfig(cfg) {
+		got = append(got, p.String())
+	}
+	want := []string{
+		filepath.Join(sigma, "good.yml") + ":1: SIGMA_RULES_DIR: duplicate rule id SIGMA-good (also in dup.yml)",
+		filepath.Join(sigma, "modifier.yml") + ":6: SIGMA_RULES_DIR: sigma rule bad: selection s: field Image|base64: unsupported modifier",
+		filepath.Join(sigma, "syntax.yml") + ":3: SIGMA_RULES_DIR: parse sigma rule",
+		"SHADOW_RULES: unknown rule APSS-999",
+		playbooks + ":4: PLAYBOOKS_FILE: rule APSS-002: playbook url",
+		webhooks + ":4: WEBHOOK_SINKS_FILE: webhook \"broken\": body template",
+		tokens + ": AGENT_TOKENS_FILE: no tokens",
+		filepath.Join(dir, "missing") + ": OPERATOR_TOKENS_FILE: ",
+		"STORAGE_POSTGRES_DSN: required by the postgres backend",
+		"LEADER_ELECTION: ignored when SHARDING is on",
+		"AGENT_MIN_PROTOCOL: protocol 3 is newer than this controller speaks (2)",
+		"AGENT_EVENT_BURST: 100 is below MAX_BATCH_EVENTS (1000)",
+		"AGENT_CAPABILITIES: grpc is not served by this controller",
+		"AGENT_CAPABILITIES: unknown capability \"zstd\"",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("problems:\n%s", strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("problem %d = %q, want prefix %q", i, got[i], want[i])
+		}
+	}
+
+	if problems := ValidateConfig(config.ControllerConfig{}); len(problems) != 0 {
+		t.Errorf("empty config: %v", problems)
+	}
+}
+
+func TestValidateConfig_Yara(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.yar", "rule miner {\n  strings:\n    $a = \"xmrig\"\n  condition:\n    $a\n}\n")
+	writeFile(t, dir, "b.yara", "rule webshell {\n  strings:\n    $e = { 3C 3F ZZ }\n  condition:\n    $e\n}\n")
+	writeFile(t, dir, "c.yar", "// again\nrule miner { condition: true }\n")
+	writeFile(t, dir, "notes.txt", "not a rule")
+
+	var got []string
+	for _, p := range ValidateConfig(config.ControllerConfig{YaraRulesDir: dir}) {
+		got = append(got, p.String())
+	}
+	want := []string{
+		filepath.Join(dir, "b.yara") + ":3: YARA_RULES_DIR: invalid hex byte \"ZZ\"",
+		filepath.Join(dir, "c.yar") + ":2: YARA_RULES_DIR: duplicate rule miner (also in a.yar)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/yara"
+)
+
+// ErrNoYaraRules is returned when no YARA rules are loaded.
+var ErrNoYaraRules = errors.New("no yara rules")
+
+// yaraBundle is the YARA rule source agents pull, with its ETag.
+type yaraBundle struct {
+	source []byte
+	etag   string
+}
+
+// loadYaraRules bundles the YARA rules in cfg.YaraRulesDir for agents. Rule
+// files that fail to compile are logged and left out.
+func (c *Controller) loadYaraRules() {
+	if c.cfg.YaraRulesDir == "" {
+		return
+	}
+	source, rules, err := yara.LoadDir(c.cfg.YaraRulesDir)
+	if err != nil {
+		c.log.WithError(err).Warn("Some YARA rules could not be loaded")
+	}
+	if rules == nil || len(rules.Names()) == 0 {
+		return
+	}
+	sum := sha256.Sum256(source)
+	c.yara = &yaraBundle{source: source, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+	c.log.WithFields(logrus.Fields{"rules": len(rules.Names()), "etag": c.yara.etag}).Info("Loaded YARA rules")
+}
+
+// YaraRules returns the YARA rule source agents scan files with and its
+// ETag.
+func (c *Controller) YaraRules() ([]byte, string, error) {
+	if c.yara == nil {
+		return nil, "", ErrNoYaraRules
+	}
+	return c.yara.source, c.yara.etag, nil
+}
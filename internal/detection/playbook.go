@@ -0,0 +1,55 @@
+package detection
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// PlaybooksFile maps rule IDs to playbooks, so built-in and correlation
+// rules can carry runbooks without code changes.
+type PlaybooksFile struct {
+	Playbooks map[string]*types.Playbook `json:"playbooks"`
+}
+
+// ValidatePlaybook checks that p has a runbook URL or body, and that a URL is
+// an absolute http(s) link on-call engineers can open.
+func ValidatePlaybook(p *types.Playbook) error {
+	if p.URL == "" && p.Body == "" {
+		return errors.New("playbook needs a url or a body")
+	}
+	if p.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("playbook url %q is not an http(s) URL", p.URL)
+	}
+	return nil
+}
+
+// LoadPlaybooks reads rule playbooks from a YAML or JSON file.
+func LoadPlaybooks(file string) (map[string]*types.Playbook, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var f PlaybooksFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, err
+	}
+	for ruleID, p := range f.Playbooks {
+		if p == nil {
+			return nil, fmt.Errorf("rule %s: empty playbook", ruleID)
+		}
+		if err := ValidatePlaybook(p); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", ruleID, err)
+		}
+	}
+	return f.Playbooks, nil
+}
@@ -0,0 +1,41 @@
+package detection
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPlaybooks(t *testing.T) {
+	tests := []struct {
+		name, file, wantErr string
+	}{
+		{name: "valid", file: "playbooks:\n  APSS-001:\n    url: https://runbooks.example.com/revshell\n  APSS-002:\n    body: |\n      1. Delete the pod\n      2. Rotate its credentials\n"},
+		{name: "empty", file: "playbooks:\n  APSS-001: {}\n", wantErr: "needs a url or a body"},
+		{name: "null", file: "playbooks:\n  APSS-001:\n", wantErr: "empty playbook"},
+		{name: "relative url", file: "playbooks:\n  APSS-001: {url: /wiki/revshell}\n", wantErr: "APSS-001: playbook url"},
+		{name: "unknown field", file: "playbooks:\n  APSS-001: {link: https://x}\n", wantErr: "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "playbooks.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			playbooks, err := LoadPlaybooks(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPlaybooks: %v", err)
+			}
+			if playbooks["APSS-001"].URL == "" || !strings.Contains(playbooks["APSS-002"].Body, "Rotate") {
+				t.Errorf("playbooks = %+v", playbooks)
+			}
+		})
+	}
+}
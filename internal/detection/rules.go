@@ -4,6 +4,8 @@ package detection
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
@@ -19,28 +21,66 @@ type Rule struct {
 	MitreID     string
 	Condition   func(event *types.SecurityEvent) bool
 	Actions     []string
+	// Playbook is attached to every alert the rule raises.
+	Playbook *types.Playbook
+	// Shadow loads the rule in shadow mode; see Engine.SetShadow.
+	Shadow bool
 }
 
+// Observer is called after each rule is evaluated against an event, with
+// how long the evaluation took and whether the rule matched.
+type Observer func(rule *Rule, took time.Duration, matched bool)
+
 // Engine evaluates events against rules and produces alerts.
 type Engine struct {
-	rules []*Rule
+	rules    []*Rule
+	observer Observer
+	// shadow and disabled hold the IDs of rules in shadow mode and of rules
+	// not evaluated. They change while events are evaluated, so they are
+	// guarded by mu.
+	mu       sync.RWMutex
+	shadow   map[string]bool
+	disabled map[string]bool
 }
 
 // NewEngine creates a detection engine with the default rule set.
 func NewEngine() *Engine {
-	e := &Engine{}
-	e.rules = defaultRules()
+	e := &Engine{shadow: make(map[string]bool), disabled: make(map[string]bool)}
+	e.AddRules(defaultRules()...)
 	return e
 }
 
+// SetObserver sets the function told about every rule evaluation, e.g. to
+// time rules. It must be called before the engine starts evaluating events,
+// and o must not call back into the engine.
+func (e *Engine) SetObserver(o Observer) {
+	e.observer = o
+}
+
 // Evaluate runs all rules against the event and returns any matching alerts.
 func (e *Engine) Evaluate(event *types.SecurityEvent) []*types.Alert {
 	var alerts []*types.Alert
+	observed := event.Timestamp
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 	for _, rule := range e.rules {
-		if rule.Condition(event) {
+		if e.disabled[rule.ID] {
+			continue
+		}
+		var start time.Time
+		if e.observer != nil {
+			start = time.Now()
+		}
+		matched := rule.Condition(event)
+		if e.observer != nil {
+			e.observer(rule, time.Since(start), matched)
+		}
+		if matched {
 			alerts = append(alerts, &types.Alert{
 				ID:          fmt.Sprintf("alert-%d", time.Now().UnixNano()),
 				Timestamp:   time.Now(),
+				ObservedAt:  &observed,
+				OccurredAt:  event.OccurredAt,
 				Severity:    rule.Severity,
 				RuleID:      rule.ID,
 				RuleName:    rule.Name,
@@ -48,15 +88,78 @@ func (e *Engine) Evaluate(event *types.SecurityEvent) []*types.Alert {
 				EventIDs:    []string{event.ID},
 				PodName:     event.PodName,
 				PodNS:       event.PodNamespace,
+				Identity:    event.Identity,
+				ClusterName: event.ClusterName,
+				Environment: event.Environment,
 				MitreTactic: rule.MitreTactic,
 				MitreID:     rule.MitreID,
 				Actions:     rule.Actions,
+				Playbook:    rule.Playbook,
+				Status:      types.AlertStatusOpen,
+				Shadow:      e.shadow[rule.ID],
 			})
 		}
 	}
 	return alerts
 }
 
+// AddRules appends rules to the engine, e.g. ones converted from Sigma.
+// It must be called before the engine starts evaluating events.
+func (e *Engine) AddRules(rules ...*Rule) {
+	e.rules = append(e.rules, rules...)
+	for _, r := range rules {
+		if r.Shadow {
+			e.shadow[r.ID] = true
+		}
+	}
+}
+
+// SetShadow puts rule id in or out of shadow mode. A shadow rule is
+// evaluated as usual, but its alerts are marked Shadow so they are counted
+// rather than raised, for burning in a new rule before it pages anyone. It
+// reports whether the rule exists.
+func (e *Engine) SetShadow(id string, shadow bool) bool {
+	return e.setFlag(e.shadow, id, shadow)
+}
+
+// SetDisabled stops or resumes evaluating rule id, such as a rule too slow
+// to keep up with ingestion. It reports whether the rule exists.
+func (e *Engine) SetDisabled(id string, disabled bool) bool {
+	return e.setFlag(e.disabled, id, disabled)
+}
+
+// IsDisabled reports whether rule id is disabled.
+func (e *Engine) IsDisabled(id string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.disabled[id]
+}
+
+func (e *Engine) setFlag(flags map[string]bool, id string, on bool) bool {
+	found := false
+	for _, r := range e.rules {
+		found = found || r.ID == id
+	}
+	if !found {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if on {
+		flags[id] = true
+	} else {
+		delete(flags, id)
+	}
+	return true
+}
+
+// IsShadow reports whether rule id is in shadow mode.
+func (e *Engine) IsShadow(id string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.shadow[id]
+}
+
 // Rules returns the loaded rules (read-only).
 func (e *Engine) Rules() []*Rule {
 	return e.rules
@@ -157,5 +260,462 @@ func defaultRules() []*Rule {
 			},
 			Actions: []string{"Verify database connection is authorized", "Review network policies", "Check for data exfiltration"},
 		},
+		{
+			ID:          "APSS-007",
+			Name:        "Rapid Storage Growth",
+			Description: "Files under a writable path grew abnormally fast (possible ransomware staging or log bomb)",
+			Severity:    "HIGH",
+			MitreTactic: "Impact",
+			MitreID:     "T1499.001",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Resource == nil {
+					return false
+				}
+				return e.Resource.AnomalyType == "disk_growth" || e.Resource.AnomalyType == "file_count_growth"
+			},
+			Actions: []string{"Inspect the top growing paths", "Check for encryption or mass file writes", "Review the pod's ephemeral storage limit"},
+		},
+		{
+			ID:          "APSS-008",
+			Name:        "Resource Exhaustion",
+			Description: "A process is close to its file descriptor limit or a filesystem is running out of inodes",
+			Severity:    "MEDIUM",
+			MitreTactic: "Impact",
+			MitreID:     "T1499",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Resource == nil {
+					return false
+				}
+				return e.Resource.AnomalyType == "fd_exhaustion" || e.Resource.AnomalyType == "inode_exhaustion"
+			},
+			Actions: []string{"Identify the process or path consuming the resource", "Check for connection floods or runaway exploits", "Review fd limits and ephemeral storage"},
+		},
+		{
+			ID:          "APSS-009",
+			Name:        "Admission Policy Violation",
+			Description: "A pod was created that violates the image or security posture policy (privileged, hostPath, root or unpinned images)",
+			Severity:    "MEDIUM",
+			MitreTactic: "Execution",
+			MitreID:     "T1610",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Audit != nil && len(e.Audit.PolicyViolations) > 0
+			},
+			Actions: []string{"Review who created the pod and why", "Check whether the workload needs the flagged privileges", "Move the namespace to enforce mode once compliant"},
+		},
+		{
+			ID:          "APSS-010",
+			Name:        "File Timestomping",
+			Description: "A watched file's content changed but its modification time was kept or rolled back (touch -r style anti-forensics)",
+			Severity:    "HIGH",
+			MitreTactic: "Defense Evasion",
+			MitreID:     "T1070.006",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.File == nil {
+					return false
+				}
+				for _, ind := range e.File.Indicators {
+					if ind == "timestomp" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Diff the file against its baseline", "Identify the process that modified it", "Treat the container as compromised"},
+		},
+		{
+			ID:          "APSS-011",
+			Name:        "Connection to Known Malicious IP",
+			Description: "Network connection to an address on a threat intelligence blocklist",
+			Severity:    "HIGH",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1071",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Network != nil && e.Network.MatchedIOC != nil && e.Network.MatchedIOC.Type == types.IOCTypeIP && e.Network.MatchedIOC.Category == ""
+			},
+			Actions: []string{"Check the matched feed entry", "Identify the process that opened the connection", "Block the address with a network policy"},
+		},
+		{
+			ID:          "APSS-012",
+			Name:        "Known Malicious Domain",
+			Description: "DNS lookup of or connection to a domain on a threat intelligence blocklist",
+			Severity:    "HIGH",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1071.004",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Network != nil && e.Network.MatchedIOC != nil && e.Network.MatchedIOC.Type == types.IOCTypeDomain
+			},
+			Actions: []string{"Check the matched feed entry", "Identify the process that resolved the domain", "Review the pod's other outbound traffic"},
+		},
+		{
+			ID:          "APSS-015",
+			Name:        "Known Malicious File Hash",
+			Description: "Process executable or written file whose hash was extracted from an earlier critical alert",
+			Severity:    "HIGH",
+			MitreTactic: "Execution",
+			MitreID:     "T1204.002",
+			Condition: func(e *types.SecurityEvent) bool {
+				isHash := func(m *types.IOCMatch) bool { return m != nil && m.Type == types.IOCTypeHash }
+				return (e.Process != nil && isHash(e.Process.MatchedIOC)) || (e.File != nil && isHash(e.File.MatchedIOC))
+			},
+			Actions: []string{"Review the alert the hash was extracted from", "Kill the process and quarantine the file", "Check how the file reached this pod"},
+		},
+		{
+			ID:          "APSS-016",
+			Name:        "Shell Spawned by Server Process",
+			Description: "A shell was started by a web or application server, as a web shell or remote code execution would",
+			Severity:    "HIGH",
+			MitreTactic: "Persistence",
+			MitreID:     "T1505.003",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Process != nil && shells[e.Process.Name] && serverAncestor(e.Process) != ""
+			},
+			Actions: []string{"Review the server's recent requests", "Inspect the shell's command line and children", "Check the application for injection flaws"},
+		},
+		{
+			ID:          "APSS-017",
+			Name:        "Download Tool Run by Server Process",
+			Description: "curl or wget was run by a web or application server, possibly fetching a second-stage payload",
+			Severity:    "HIGH",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1105",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Process != nil && downloadTools[e.Process.Name] && serverAncestor(e.Process) != ""
+			},
+			Actions: []string{"Check the URL in the command line", "Look for files written to /tmp", "Review the server's recent requests"},
+		},
+		{
+			ID:          "APSS-018",
+			Name:        "Denylisted Executable",
+			Description: "A process was started from an executable whose SHA-256 is on the agent's denylist",
+			Severity:    "CRITICAL",
+			MitreTactic: "Execution",
+			MitreID:     "T1204.002",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "denylisted_hash" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Terminate pod", "Find how the binary reached the container", "Scan other workloads for the same hash"},
+		},
+		{
+			ID:          "APSS-019",
+			Name:        "Fileless Execution",
+			Description: "A process is running from a memfd, /dev/shm or a deleted binary, or has anonymous executable memory",
+			Severity:    "HIGH",
+			MitreTactic: "Defense Evasion",
+			MitreID:     "T1620",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "fileless_execution" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Capture the process memory before terminating it", "Check fileless_reason in the event metadata", "Review the parent process and how it was started"},
+		},
+		{
+			ID:          "APSS-020",
+			Name:        "Dynamic Linker Hijacking",
+			Description: "A process started with LD_PRELOAD outside the system library directories or an LD_LIBRARY_PATH that searches the working directory or a world-writable one",
+			Severity:    "HIGH",
+			MitreTactic: "Defense Evasion",
+			MitreID:     "T1574.006",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "ld_preload" || ind == "ld_library_path_hijack" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Inspect the preloaded library", "Check the environment in the event", "Look for other processes with the same variables"},
+		},
+		{
+			ID:          "APSS-021",
+			Name:        "Shell History Disabled",
+			Description: "A process started with HISTFILE pointing at /dev/null or a zero history size",
+			Severity:    "MEDIUM",
+			MitreTactic: "Defense Evasion",
+			MitreID:     "T1562.003",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "history_disabled" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Review what the session ran", "Check who opened the shell"},
+		},
+		{
+			ID:          "APSS-022",
+			Name:        "Credentials in Process Environment",
+			Description: "A process environment holds a value shaped like a credential: a cloud access key, API token, private key or URL with a password",
+			Severity:    "MEDIUM",
+			MitreTactic: "Credential Access",
+			MitreID:     "T1552",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "credentials_in_env" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Move the credential to a mounted Secret", "Rotate the credential if the pod is suspected compromised"},
+		},
+		{
+			ID:          "APSS-023",
+			Name:        "Sustained High CPU Process",
+			Description: "A process kept most of a CPU core busy for several scans in a row, as a renamed cryptominer does",
+			Severity:    "HIGH",
+			MitreTactic: "Impact",
+			MitreID:     "T1496",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "sustained_high_cpu" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Check the process's executable hash and outbound connections", "Compare its CPU use with the workload's normal profile", "Allowlist the executable hash if the load is expected"},
+		},
+		{
+			ID:          "APSS-024",
+			Name:        "Unexpected GPU Device Access",
+			Description: "A process opened an NVIDIA device in a pod not labelled as a GPU workload, or one outside its allowed processes",
+			Severity:    "HIGH",
+			MitreTactic: "Impact",
+			MitreID:     "T1496",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "gpu_device_access" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Check the process's executable and outbound connections for mining pools", "Label the pod apss.invisible.tech/gpu-workload=true or allow the process if the use is expected"},
+		},
+		{
+			ID:          "APSS-025",
+			Name:        "nvidia-smi in Non-GPU Workload",
+			Description: "nvidia-smi ran, or was found in the filesystem, in a pod not labelled as a GPU workload, as attackers probing for GPUs do",
+			Severity:    "MEDIUM",
+			MitreTactic: "Discovery",
+			MitreID:     "T1082",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.Process == nil {
+					return false
+				}
+				for _, ind := range e.Process.SuspiciousIndicators {
+					if ind == "nvidia_smi" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Check how nvidia-smi got into the container and what ran it", "Review the pod for other reconnaissance"},
+		},
+		{
+			ID:          "APSS-026",
+			Name:        "Sustained GPU Utilization in Non-GPU Workload",
+			Description: "A GPU on the pod's node stayed busy for several scans while the pod is not labelled as a GPU workload",
+			Severity:    "HIGH",
+			MitreTactic: "Impact",
+			MitreID:     "T1496",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Resource != nil && e.Resource.AnomalyType == "gpu_utilization"
+			},
+			Actions: []string{"Find the process holding the GPU with nvidia-smi on the node", "Check the pod for unexpected GPU device access alerts"},
+		},
+		{
+			ID:          "APSS-027",
+			Name:        "Listener Outside Baseline",
+			Description: "A port was opened for listening after the agent learned the pod's listening ports, as a bind shell does",
+			Severity:    "MEDIUM",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1571",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Type == "network_listen" && e.Metadata["listen_baseline"] == "new_listener"
+			},
+			Actions: []string{"Find the process listening on the port", "Check for inbound connections to it", "Raise LISTEN_BASELINE_WINDOW if the service opens ports late in startup"},
+		},
+		{
+			ID:          "APSS-028",
+			Name:        "Outbound SMTP Connection",
+			Description: "Connection to a mail port on an external address, as spam bots make from compromised workloads",
+			Severity:    "MEDIUM",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1071.003",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Network != nil && e.Metadata["outbound_protocol"] == "smtp"
+			},
+			Actions: []string{"Identify the process sending mail", "Check whether the workload is meant to send mail directly rather than through a relay"},
+		},
+		{
+			ID:          "APSS-029",
+			Name:        "IRC Connection",
+			Description: "Connection to an IRC port, a common botnet command and control channel",
+			Severity:    "HIGH",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1071",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Network != nil && e.Metadata["outbound_protocol"] == "irc"
+			},
+			Actions: []string{"Identify the process that opened the connection", "Block the destination with a network policy", "Treat the container as compromised"},
+		},
+		{
+			ID:          "APSS-030",
+			Name:        "Connection to Tor Entry Node",
+			Description: "Network connection to an address on a Tor relay list, used to hide command and control or exfiltration",
+			Severity:    "HIGH",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1090.003",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Network != nil && e.Network.MatchedIOC != nil && e.Network.MatchedIOC.Category == types.IOCCategoryTor
+			},
+			Actions: []string{"Identify the process that opened the connection", "Look for a tor binary or embedded Tor client in the container", "Block egress to Tor relays"},
+		},
+		{
+			ID:          "APSS-031",
+			Name:        "Connection Fan-out Anomaly",
+			Description: "A burst of new external connections or destinations far above the pod's baseline, as port scanning or exfiltration causes",
+			Severity:    "HIGH",
+			MitreTactic: "Discovery",
+			MitreID:     "T1046",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.Resource != nil && e.Resource.AnomalyType == "connection_fanout"
+			},
+			Actions: []string{"Check the top destinations for scanning or upload patterns", "Identify the process behind the connections", "Raise the pod's fan-out annotations if the burst is expected"},
+		},
+		{
+			ID:          "APSS-033",
+			Name:        "Privilege-Escalating Permission Change",
+			Description: "A watched file gained the SUID or SGID bit, became world-writable or changed owner, a common persistence and privilege escalation step",
+			Severity:    "HIGH",
+			MitreTactic: "Privilege Escalation",
+			MitreID:     "T1548.001",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.File == nil {
+					return false
+				}
+				for _, ind := range e.File.Indicators {
+					switch ind {
+					case "setuid", "setgid", "world_writable", "owner_change":
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Identify the process that changed the file", "Compare the mode and owner with the image", "Remove the bit or restore the owner and treat the container as compromised"},
+		},
+		{
+			ID:          "APSS-034",
+			Name:        "Executable Dropped in Writable Path",
+			Description: "A new executable or ELF binary appeared in a writable directory such as /tmp or /dev/shm, where droppers stage payloads",
+			Severity:    "HIGH",
+			MitreTactic: "Command and Control",
+			MitreID:     "T1105",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.File == nil {
+					return false
+				}
+				for _, ind := range e.File.Indicators {
+					if ind == "dropped_executable" {
+						return true
+					}
+				}
+				return false
+			},
+			Actions: []string{"Look the hash up in threat intelligence", "Identify the process that wrote the file", "Preserve a copy and treat the container as compromised if the file is unexpected"},
+		},
+		{
+			ID:          "APSS-035",
+			Name:        "Malicious File Content",
+			Description: "A new or changed file matched a YARA rule, such as a known malware, miner or web shell signature",
+			Severity:    "CRITICAL",
+			MitreTactic: "Execution",
+			MitreID:     "T1204.002",
+			Condition: func(e *types.SecurityEvent) bool {
+				return e.File != nil && len(e.File.YaraRules) > 0
+			},
+			Actions: []string{"Check which YARA rules matched and the file's hash", "Identify the process that wrote the file", "Quarantine the pod and preserve the file for analysis"},
+		},
+		{
+			ID:          "APSS-036",
+			Name:        "Credential File Access",
+			Description: "A process read the service account token or a cloud credential file, or a credential file changed, as attackers do to move to the cluster API or cloud account",
+			Severity:    "HIGH",
+			MitreTactic: "Credential Access",
+			MitreID:     "T1552.001",
+			Condition: func(e *types.SecurityEvent) bool {
+				if e.File != nil {
+					for _, ind := range e.File.Indicators {
+						if ind == "credential_access" {
+							return true
+						}
+					}
+				}
+				if e.Process != nil {
+					for _, ind := range e.Process.SuspiciousIndicators {
+						if ind == "credential_access" {
+							return true
+						}
+					}
+				}
+				return false
+			},
+			Actions: []string{"Check whether the process is expected to use the credential", "Review the service account's or cloud identity's recent API calls", "Rotate the credential if the access is unexplained"},
+		},
+	}
+}
+
+var (
+	shells        = map[string]bool{"sh": true, "bash": true, "dash": true, "ash": true, "zsh": true, "ksh": true, "csh": true, "tcsh": true, "fish": true}
+	downloadTools = map[string]bool{"curl": true, "wget": true}
+	// serverProcesses are web and application servers, whose children are
+	// rarely shells or download tools outside an attack.
+	serverProcesses = map[string]bool{
+		"java": true, "nginx": true, "httpd": true, "apache2": true, "node": true,
+		"gunicorn": true, "uwsgi": true, "puma": true, "unicorn": true, "caddy": true,
+	}
+)
+
+// serverAncestor returns the name of the nearest server process in p's
+// lineage, or "" if there is none. php-fpm is matched by prefix, since its
+// process name carries the PHP version.
+func serverAncestor(p *types.ProcessEventData) string {
+	for _, a := range p.Ancestors {
+		if serverProcesses[a.Name] || strings.HasPrefix(a.Name, "php-fpm") {
+			return a.Name
+		}
 	}
+	return ""
 }
@@ -141,7 +141,8 @@ func TestEngine_Evaluate_AlertFields(t *testing.T) {
 	ev := &types.SecurityEvent{
 		ID: "ev-99", Type: "process_start", Severity: "CRITICAL",
 		Timestamp: time.Now(), PodName: "my-pod", PodNamespace: "prod",
-		Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}},
+		Process:  &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}},
+		Identity: &types.Identity{ServiceAccount: "api", GCPServiceAccount: "api@proj.iam.gserviceaccount.com"},
 	}
 	alerts := e.Evaluate(ev)
 	if len(alerts) != 1 {
@@ -154,4 +155,110 @@ func TestEngine_Evaluate_AlertFields(t *testing.T) {
 	if len(a.Actions) == 0 {
 		t.Error("alert should have recommended actions")
 	}
+	if a.Identity != ev.Identity {
+		t.Errorf("alert identity = %+v, want the event's %+v", a.Identity, ev.Identity)
+	}
+	if a.ObservedAt == nil || !a.ObservedAt.Equal(ev.Timestamp) || a.OccurredAt != nil {
+		t.Errorf("alert times: observed %v occurred %v, want observed %v and no occurred", a.ObservedAt, a.OccurredAt, ev.Timestamp)
+	}
+}
+
+func TestEngine_Evaluate_OccurredAt(t *testing.T) {
+	observed := time.Date(2024, 5, 1, 12, 0, 10, 0, time.UTC)
+	occurred := observed.Add(-9 * time.Second)
+	ev := &types.SecurityEvent{
+		ID: "ev-1", Type: "process_start", Timestamp: observed, OccurredAt: &occurred,
+		Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}},
+	}
+	alerts := NewEngine().Evaluate(ev)
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts))
+	}
+	a := alerts[0]
+	if !a.ObservedAt.Equal(observed) || a.OccurredAt == nil || !a.OccurredAt.Equal(occurred) {
+		t.Errorf("alert times: observed %v occurred %v", a.ObservedAt, a.OccurredAt)
+	}
+	if a.Timestamp.Before(observed) {
+		t.Errorf("alert raised at %v, before the event was observed", a.Timestamp)
+	}
+}
+
+func TestEngine_SetShadow(t *testing.T) {
+	e := NewEngine()
+	ev := &types.SecurityEvent{
+		ID: "ev-1", Type: "network_connect", Timestamp: time.Now(),
+		Network: &types.NetworkEventData{DstIP: "1.2.3.4", DstPort: 4444, IsExternal: true},
+	}
+	if !e.SetShadow("APSS-001", true) || !e.IsShadow("APSS-001") {
+		t.Fatal("SetShadow(APSS-001) did not take")
+	}
+	if e.SetShadow("APSS-999", true) {
+		t.Error("SetShadow accepted an unknown rule")
+	}
+	if alerts := e.Evaluate(ev); len(alerts) != 1 || !alerts[0].Shadow {
+		t.Fatalf("shadow evaluation = %+v", alerts)
+	}
+	e.SetShadow("APSS-001", false)
+	if alerts := e.Evaluate(ev); len(alerts) != 1 || alerts[0].Shadow {
+		t.Errorf("promoted evaluation = %+v", alerts)
+	}
+
+	e.AddRules(&Rule{ID: "CUSTOM-1", Shadow: true, Condition: func(*types.SecurityEvent) bool { return true }})
+	if !e.IsShadow("CUSTOM-1") {
+		t.Error("rule added with Shadow is not in shadow mode")
+	}
+}
+
+func TestEngine_ObserverAndDisabled(t *testing.T) {
+	e := NewEngine()
+	ev := &types.SecurityEvent{
+		ID: "ev-1", Type: "network_connect", Timestamp: time.Now(),
+		Network: &types.NetworkEventData{DstIP: "1.2.3.4", DstPort: 4444, IsExternal: true},
+	}
+	seen := make(map[string]bool)
+	e.SetObserver(func(r *Rule, took time.Duration, matched bool) { seen[r.ID] = matched })
+	e.Evaluate(ev)
+	if len(seen) != len(e.Rules()) || !seen["APSS-001"] || seen["APSS-002"] {
+		t.Fatalf("observed %d of %d rules, APSS-001 matched %v", len(seen), len(e.Rules()), seen["APSS-001"])
+	}
+
+	if !e.SetDisabled("APSS-001", true) || !e.IsDisabled("APSS-001") || e.SetDisabled("APSS-999", true) {
+		t.Fatal("SetDisabled")
+	}
+	clear(seen)
+	if alerts := e.Evaluate(ev); len(alerts) != 0 {
+		t.Errorf("disabled rule raised %+v", alerts)
+	}
+	if _, ok := seen["APSS-001"]; ok {
+		t.Error("disabled rule was evaluated")
+	}
+	e.SetDisabled("APSS-001", false)
+	if alerts := e.Evaluate(ev); len(alerts) != 1 {
+		t.Errorf("re-enabled rule raised %d alerts", len(alerts))
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	e := NewEngine()
+	rules := make(map[string]*Rule)
+	for _, r := range e.Rules() {
+		rules[r.ID] = r
+	}
+	for _, f := range Fixtures() {
+		t.Run(f.RuleID+"/"+f.Name, func(t *testing.T) {
+			rule, ok := rules[f.RuleID]
+			if !ok {
+				t.Fatalf("fixture for unknown rule %s", f.RuleID)
+			}
+			if got := rule.Condition(f.Event); got != f.Match {
+				t.Errorf("Condition = %v, want %v", got, f.Match)
+			}
+		})
+	}
+	counts := FixtureCounts()
+	for id := range rules {
+		if counts[id] == 0 {
+			t.Errorf("rule %s has no fixtures", id)
+		}
+	}
 }
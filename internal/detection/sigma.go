@@ -0,0 +1,621 @@
+package detection
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// SigmaRulePrefix is prepended to a Sigma rule's id to form the APSS rule ID.
+const SigmaRulePrefix = "SIGMA-"
+
+// sigmaRule is the subset of the Sigma rule format the converter understands.
+type sigmaRule struct {
+	Title          string                 `json:"title"`
+	ID             string                 `json:"id"`
+	Status         string                 `json:"status"`
+	Description    string                 `json:"description"`
+	Level          string                 `json:"level"`
+	Tags           []string               `json:"tags"`
+	FalsePositives []string               `json:"falsepositives"`
+	LogSource      sigmaLogSource         `json:"logsource"`
+	Detection      map[string]interface{} `json:"detection"`
+	// Playbook is an APSS extension: the runbook attached to the rule's alerts.
+	Playbook *types.Playbook `json:"playbook"`
+	// Shadow is an APSS extension: load the rule in shadow mode.
+	Shadow bool `json:"shadow"`
+}
+
+type sigmaLogSource struct {
+	Category string `json:"category"`
+	Product  string `json:"product"`
+}
+
+// sigmaField reads one Sigma field from an event; ok is false when the event
+// does not carry the payload the field belongs to.
+type sigmaField func(e *types.SecurityEvent) (value string, ok bool)
+
+// sigmaCategories maps each supported logsource category to its fields.
+var sigmaCategories = map[string]map[string]sigmaField{
+	"process_creation": {
+		"Image":           processField(func(p *types.ProcessEventData) string { return p.ExePath }),
+		"CommandLine":     processField(func(p *types.ProcessEventData) string { return strings.Join(p.Cmdline, " ") }),
+		"ProcessId":       processField(func(p *types.ProcessEventData) string { return strconv.Itoa(p.PID) }),
+		"ParentProcessId": processField(func(p *types.ProcessEventData) string { return strconv.Itoa(p.PPID) }),
+		"ParentImage": processField(func(p *types.ProcessEventData) string {
+			if len(p.Ancestors) == 0 {
+				return ""
+			}
+			return p.Ancestors[0].ExePath
+		}),
+		"ParentCommandLine": processField(func(p *types.ProcessEventData) string {
+			if len(p.Ancestors) == 0 {
+				return ""
+			}
+			return strings.Join(p.Ancestors[0].Cmdline, " ")
+		}),
+		"User": processField(func(p *types.ProcessEventData) string {
+			if p.UID == nil {
+				return ""
+			}
+			return strconv.Itoa(*p.UID)
+		}),
+	},
+	"network_connection": {
+		"DestinationIp":   networkField(func(n *types.NetworkEventData) string { return n.DstIP }),
+		"DestinationPort": networkField(func(n *types.NetworkEventData) string { return strconv.Itoa(n.DstPort) }),
+		"SourceIp":        networkField(func(n *types.NetworkEventData) string { return n.SrcIP }),
+		"SourcePort":      networkField(func(n *types.NetworkEventData) string { return strconv.Itoa(n.SrcPort) }),
+		"Protocol":        networkField(func(n *types.NetworkEventData) string { return n.Protocol }),
+	},
+}
+
+func processField(get func(*types.ProcessEventData) string) sigmaField {
+	return func(e *types.SecurityEvent) (string, bool) {
+		if e.Process == nil {
+			return "", false
+		}
+		return get(e.Process), true
+	}
+}
+
+func networkField(get func(*types.NetworkEventData) string) sigmaField {
+	return func(e *types.SecurityEvent) (string, bool) {
+		if e.Network == nil {
+			return "", false
+		}
+		return get(e.Network), true
+	}
+}
+
+var sigmaLevels = map[string]string{
+	"informational": "INFO",
+	"low":           "LOW",
+	"medium":        "MEDIUM",
+	"high":          "HIGH",
+	"critical":      "CRITICAL",
+}
+
+// sigmaTactics maps ATT&CK tactic tags to the tactic names used by the
+// built-in rules. Older rules spell tags with underscores; they are
+// normalised to hyphens before lookup.
+var sigmaTactics = map[string]string{
+	"attack.reconnaissance":       "Reconnaissance",
+	"attack.resource-development": "Resource Development",
+	"attack.initial-access":       "Initial Access",
+	"attack.execution":            "Execution",
+	"attack.persistence":          "Persistence",
+	"attack.privilege-escalation": "Privilege Escalation",
+	"attack.defense-evasion":      "Defense Evasion",
+	"attack.credential-access":    "Credential Access",
+	"attack.discovery":            "Discovery",
+	"attack.lateral-movement":     "Lateral Movement",
+	"attack.collection":           "Collection",
+	"attack.command-and-control":  "Command and Control",
+	"attack.exfiltration":         "Exfiltration",
+	"attack.impact":               "Impact",
+}
+
+var mitreTechniqueTag = regexp.MustCompile(`^attack\.(t\d{4}(\.\d{3})?)$`)
+
+// ParseSigma converts a single Sigma rule into a detection rule. Only the
+// process_creation and network_connection categories are supported; fields,
+// modifiers or condition syntax the engine cannot evaluate are an error
+// rather than being silently dropped.
+func ParseSigma(data []byte) (*Rule, error) {
+	var sr sigmaRule
+	if err := yaml.Unmarshal(data, &sr); err != nil {
+		return nil, fmt.Errorf("parse sigma rule: %w", err)
+	}
+	if sr.ID == "" {
+		return nil, errors.New("sigma rule has no id")
+	}
+	fields, ok := sigmaCategories[sr.LogSource.Category]
+	if !ok {
+		return nil, fmt.Errorf("sigma rule %s: unsupported logsource category %q", sr.ID, sr.LogSource.Category)
+	}
+	severity, ok := sigmaLevels[strings.ToLower(sr.Level)]
+	if !ok {
+		return nil, fmt.Errorf("sigma rule %s: unknown level %q", sr.ID, sr.Level)
+	}
+
+	cond, err := compileSigmaDetection(sr.Detection, fields)
+	if err != nil {
+		return nil, fmt.Errorf("sigma rule %s: %w", sr.ID, err)
+	}
+	if sr.Playbook != nil {
+		if err := ValidatePlaybook(sr.Playbook); err != nil {
+			return nil, fmt.Errorf("sigma rule %s: %w", sr.ID, err)
+		}
+	}
+
+	rule := &Rule{
+		ID:          SigmaRulePrefix + sr.ID,
+		Name:        sr.Title,
+		Description: sr.Description,
+		Severity:    severity,
+		Condition:   cond,
+		Actions:     []string{"Review the matching pod against the Sigma rule"},
+		Playbook:    sr.Playbook,
+		Shadow:      sr.Shadow,
+	}
+	for _, tag := range sr.Tags {
+		tag = strings.ReplaceAll(strings.ToLower(tag), "_", "-")
+		if m := mitreTechniqueTag.FindStringSubmatch(tag); m != nil && rule.MitreID == "" {
+			rule.MitreID = strings.ToUpper(m[1])
+		}
+		if tactic, ok := sigmaTactics[tag]; ok && rule.MitreTactic == "" {
+			rule.MitreTactic = tactic
+		}
+	}
+	for _, fp := range sr.FalsePositives {
+		rule.Actions = append(rule.Actions, "Rule out known false positive: "+fp)
+	}
+	return rule, nil
+}
+
+// LoadSigmaDir converts every .yml and .yaml file in dir. A file that fails
+// to convert does not stop the rest from loading; its error is joined into
+// the returned error.
+func LoadSigmaDir(dir string) ([]*Rule, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read sigma rules dir: %w", err)
+	}
+	var rules []*Rule
+	var errs []error
+	seen := make(map[string]string)
+	for _, ent := range entries {
+		ext := filepath.Ext(ent.Name())
+		if ent.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		path := filepath.Join(dir, ent.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rule, err := ParseSigma(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ent.Name(), err))
+			continue
+		}
+		if prev, dup := seen[rule.ID]; dup {
+			errs = append(errs, fmt.Errorf("%s: duplicate rule id %s (also in %s)", ent.Name(), rule.ID, prev))
+			continue
+		}
+		seen[rule.ID] = ent.Name()
+		rules = append(rules, rule)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// eventMatcher is a compiled selection or condition.
+type eventMatcher func(e *types.SecurityEvent) bool
+
+func compileSigmaDetection(detection map[string]interface{}, fields map[string]sigmaField) (func(*types.SecurityEvent) bool, error) {
+	rawCond, ok := detection["condition"]
+	if !ok {
+		return nil, errors.New("detection has no condition")
+	}
+	if _, ok := detection["timeframe"]; ok {
+		return nil, errors.New("timeframe aggregations are not supported")
+	}
+
+	selections := make(map[string]eventMatcher)
+	for name, body := range detection {
+		if name == "condition" {
+			continue
+		}
+		m, err := compileSelection(body, fields)
+		if err != nil {
+			return nil, fmt.Errorf("selection %s: %w", name, err)
+		}
+		selections[name] = m
+	}
+
+	var conds []string
+	switch c := rawCond.(type) {
+	case string:
+		conds = []string{c}
+	case []interface{}:
+		for _, v := range c {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("condition entry %v is not a string", v)
+			}
+			conds = append(conds, s)
+		}
+	default:
+		return nil, fmt.Errorf("condition has unexpected type %T", rawCond)
+	}
+
+	// A list of conditions matches when any of them does.
+	var compiled []eventMatcher
+	for _, c := range conds {
+		m, err := parseCondition(c, selections)
+		if err != nil {
+			return nil, fmt.Errorf("condition %q: %w", c, err)
+		}
+		compiled = append(compiled, m)
+	}
+	return func(e *types.SecurityEvent) bool {
+		for _, m := range compiled {
+			if m(e) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// compileSelection handles a map of field conditions (all must match) or a
+// list of such maps (any may match).
+func compileSelection(body interface{}, fields map[string]sigmaField) (eventMatcher, error) {
+	switch b := body.(type) {
+	case map[string]interface{}:
+		return compileFieldMap(b, fields)
+	case []interface{}:
+		var alts []eventMatcher
+		for _, item := range b {
+			fm, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("keyword selections are not supported")
+			}
+			m, err := compileFieldMap(fm, fields)
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, m)
+		}
+		return func(e *types.SecurityEvent) bool {
+			for _, m := range alts {
+				if m(e) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected selection type %T", body)
+	}
+}
+
+func compileFieldMap(fm map[string]interface{}, fields map[string]sigmaField) (eventMatcher, error) {
+	var checks []eventMatcher
+	for key, raw := range fm {
+		parts := strings.Split(key, "|")
+		get, ok := fields[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported field %q", parts[0])
+		}
+		match, err := compileValues(parts[1:], raw)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", key, err)
+		}
+		checks = append(checks, func(e *types.SecurityEvent) bool {
+			v, ok := get(e)
+			return ok && match(v)
+		})
+	}
+	return func(e *types.SecurityEvent) bool {
+		for _, c := range checks {
+			if !c(e) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// compileValues builds the matcher for one field. A list of values matches
+// when any value does, or when all do with the "all" modifier.
+func compileValues(modifiers []string, raw interface{}) (func(string) bool, error) {
+	var values []interface{}
+	if list, ok := raw.([]interface{}); ok {
+		values = list
+	} else {
+		values = []interface{}{raw}
+	}
+
+	kind, all := "", false
+	for _, mod := range modifiers {
+		switch mod {
+		case "all":
+			all = true
+		case "contains", "startswith", "endswith", "re", "cidr":
+			if kind != "" {
+				return nil, fmt.Errorf("modifiers %s and %s cannot be combined", kind, mod)
+			}
+			kind = mod
+		default:
+			return nil, fmt.Errorf("unsupported modifier %q", mod)
+		}
+	}
+
+	var matchers []func(string) bool
+	for _, v := range values {
+		m, err := compileValue(kind, v)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return func(s string) bool {
+		for _, m := range matchers {
+			if m(s) != all {
+				return !all
+			}
+		}
+		return all
+	}, nil
+}
+
+func compileValue(kind string, raw interface{}) (func(string) bool, error) {
+	var value string
+	switch v := raw.(type) {
+	case nil:
+		return func(s string) bool { return s == "" }, nil
+	case string:
+		value = v
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		value = strconv.FormatBool(v)
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", raw)
+	}
+
+	switch kind {
+	case "re":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	case "cidr":
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(s string) bool {
+			ip := net.ParseIP(s)
+			return ip != nil && network.Contains(ip)
+		}, nil
+	}
+
+	pattern := globPattern(value)
+	switch kind {
+	case "contains":
+		pattern = ".*" + pattern + ".*"
+	case "startswith":
+		pattern += ".*"
+	case "endswith":
+		pattern = ".*" + pattern
+	}
+	re, err := regexp.Compile(`(?is)^` + pattern + `$`)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+// globPattern turns a Sigma value into a regular expression: * and ? are
+// wildcards unless escaped with a backslash.
+func globPattern(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value) && strings.IndexByte(`*?\`, value[i+1]) >= 0:
+			i++
+			b.WriteString(regexp.QuoteMeta(string(value[i])))
+		case c == '*':
+			b.WriteString(".*")
+		case c == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// parseCondition compiles a Sigma condition expression: selection names,
+// and/or/not, parentheses, and "1 of"/"all of" over a name pattern or "them".
+func parseCondition(cond string, selections map[string]eventMatcher) (eventMatcher, error) {
+	if strings.Contains(cond, "|") {
+		return nil, errors.New("aggregations are not supported")
+	}
+	p := &condParser{tokens: tokenizeCondition(cond), selections: selections}
+	m, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return m, nil
+}
+
+func tokenizeCondition(cond string) []string {
+	cond = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(cond)
+	return strings.Fields(cond)
+}
+
+type condParser struct {
+	tokens     []string
+	pos        int
+	selections map[string]eventMatcher
+}
+
+func (p *condParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+	return ""
+}
+
+func (p *condParser) next() string {
+	tok := ""
+	if p.pos < len(p.tokens) {
+		tok = p.tokens[p.pos]
+		p.pos++
+	}
+	return tok
+}
+
+func (p *condParser) parseOr() (eventMatcher, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *types.SecurityEvent) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (eventMatcher, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *types.SecurityEvent) bool { return l(e) && right(e) }
+	}
+	return left, nil
+}
+
+func (p *condParser) parseNot() (eventMatcher, error) {
+	if p.peek() == "not" {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *types.SecurityEvent) bool { return !inner(e) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *condParser) parsePrimary() (eventMatcher, error) {
+	tok := p.next()
+	switch strings.ToLower(tok) {
+	case "":
+		return nil, errors.New("unexpected end of condition")
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return inner, nil
+	case "1", "all":
+		if strings.ToLower(p.next()) != "of" {
+			return nil, fmt.Errorf("expected \"of\" after %q", tok)
+		}
+		group, err := p.selectionGroup(p.next())
+		if err != nil {
+			return nil, err
+		}
+		if tok == "all" {
+			return func(e *types.SecurityEvent) bool {
+				for _, m := range group {
+					if !m(e) {
+						return false
+					}
+				}
+				return true
+			}, nil
+		}
+		return func(e *types.SecurityEvent) bool {
+			for _, m := range group {
+				if m(e) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	m, ok := p.selections[tok]
+	if !ok {
+		return nil, fmt.Errorf("unknown selection %q", tok)
+	}
+	return m, nil
+}
+
+// selectionGroup resolves the target of "1 of"/"all of": "them", or a name
+// with an optional trailing wildcard.
+func (p *condParser) selectionGroup(target string) ([]eventMatcher, error) {
+	if target == "" {
+		return nil, errors.New("unexpected end of condition")
+	}
+	var names []string
+	for name := range p.selections {
+		switch {
+		case target == "them":
+			names = append(names, name)
+		case strings.HasSuffix(target, "*"):
+			if strings.HasPrefix(name, strings.TrimSuffix(target, "*")) {
+				names = append(names, name)
+			}
+		case name == target:
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no selections match %q", target)
+	}
+	sort.Strings(names)
+	group := make([]eventMatcher, len(names))
+	for i, name := range names {
+		group[i] = p.selections[name]
+	}
+	return group, nil
+}
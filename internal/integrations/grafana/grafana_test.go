@@ -0,0 +1,58 @@
+package grafana
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		m    types.MetricDesc
+		want string
+	}{
+		{
+			types.MetricDesc{Name: "apss_alerts_generated_total", Type: types.MetricTypeCounter, Labels: []string{"rule", "severity"}},
+			`sum by (rule, severity) (rate(apss_alerts_generated_total{rule=~"$rule", severity=~"$severity"}[5m]))`,
+		},
+		{
+			types.MetricDesc{Name: "apss_active_agents", Type: types.MetricTypeGauge},
+			`sum (apss_active_agents)`,
+		},
+		{
+			types.MetricDesc{Name: "apss_eval_seconds", Type: types.MetricTypeHistogram, Labels: []string{"rule"}},
+			`histogram_quantile(0.95, sum by (le, rule) (rate(apss_eval_seconds_bucket{rule=~"$rule"}[5m])))`,
+		},
+	}
+	for _, tt := range tests {
+		if got := Query(tt.m); got != tt.want {
+			t.Errorf("Query(%s) = %s, want %s", tt.m.Name, got, tt.want)
+		}
+	}
+}
+
+func TestOverview(t *testing.T) {
+	metrics := []types.MetricDesc{
+		{Name: "apss_active_agents", Type: types.MetricTypeGauge},
+		{Name: "apss_events_received_total", Type: types.MetricTypeCounter, Labels: []string{"type", "namespace"}},
+	}
+	d := Overview(metrics)
+	if len(d.Panels) != 2 {
+		t.Fatalf("panels = %d, want 2", len(d.Panels))
+	}
+	if d.Panels[0].Title != "Active agents" || d.Panels[1].GridPos.X != panelWidth {
+		t.Errorf("panel layout: %+v", d.Panels)
+	}
+	var vars []string
+	for _, v := range d.Templating.List {
+		vars = append(vars, v.Name)
+	}
+	if strings.Join(vars, ",") != "DS_PROMETHEUS,namespace,type" {
+		t.Errorf("variables = %v", vars)
+	}
+	if _, err := json.Marshal(d); err != nil {
+		t.Errorf("Marshal: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package kube is a minimal Kubernetes API client for the controller and
+// webhook, which only need a few JSON reads and writes.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Client is a minimal Kubernetes API client authenticated with the pod's
+// service account. The token is re-read on every request because projected
+// tokens are rotated by the kubelet.
+type Client struct {
+	base      string
+	tokenFile string
+	http      *http.Client
+}
+
+// NewInCluster returns a client for the API server the pod runs under.
+func NewInCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster")
+	}
+	caPEM, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates in cluster CA")
+	}
+	return &Client{
+		base:      "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountDir + "/token",
+		// No client timeout: watches are long-lived and bounded by their
+		// context and timeoutSeconds instead.
+		http: &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}, nil
+}
+
+// NewClient returns an unauthenticated client for the API server at base,
+// such as a test server or a local proxy.
+func NewClient(base string, hc *http.Client) *Client {
+	return &Client{base: base, http: hc}
+}
+
+// apiError is a non-2xx response from the API server.
+type apiError struct {
+	method, path string
+	code         int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: status %d", strings.ToLower(e.method), e.path, e.code)
+}
+
+// IsStatus reports whether err is an API server response with status code.
+func IsStatus(err error, code int) bool {
+	var ae *apiError
+	return errors.As(err, &ae) && ae.code == code
+}
+
+// Open issues a GET for path and returns the response body on 200 OK.
+func (c *Client) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return c.do(ctx, http.MethodGet, path, "", nil)
+}
+
+// do issues a request and returns the response body on a 2xx status.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (io.ReadCloser, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", strings.ToLower(method), path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &apiError{method: method, path: path, code: resp.StatusCode}
+	}
+	return resp.Body, nil
+}
+
+// Send issues a write request with a JSON (or patch) body and decodes the
+// response into out when out is non-nil.
+func (c *Client) Send(ctx context.Context, method, path, contentType string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	body, err := c.do(ctx, method, path, contentType, data)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// Get decodes the JSON response for path into out.
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	body, err := c.Open(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// CloudLoggingURL is the Cloud Logging entries.write endpoint.
+const CloudLoggingURL = "https://logging.googleapis.com/v2/entries:write"
+
+// DefaultCloudLoggingLogName is the log alerts are written to by default.
+const DefaultCloudLoggingLogName = "apss-alerts"
+
+// cloudLoggingSeverities maps alert severities onto Cloud Logging's.
+var cloudLoggingSeverities = map[string]string{
+	"CRITICAL": "CRITICAL",
+	"HIGH":     "ERROR",
+	"MEDIUM":   "WARNING",
+	"LOW":      "NOTICE",
+}
+
+// CloudLogging writes alerts as structured entries to Google Cloud Logging.
+type CloudLogging struct {
+	auth    *GCPAuth
+	project string
+	logName string
+	url     string
+	http    *http.Client
+
+	maxPayload int
+
+	// cluster and location label entries with the k8s_pod resource; they
+	// are looked up once, on first use.
+	once     sync.Once
+	cluster  string
+	location string
+}
+
+// NewCloudLogging creates a Cloud Logging sink writing to logName in
+// project. An empty project is looked up from the metadata server on first
+// use.
+func NewCloudLogging(auth *GCPAuth, project, logName string) *CloudLogging {
+	if logName == "" {
+		logName = DefaultCloudLoggingLogName
+	}
+	return &CloudLogging{auth: auth, project: project, logName: logName, url: CloudLoggingURL, http: auth.client(), maxPayload: cloudLoggingMaxPayload}
+}
+
+// Name implements Sink.
+func (c *CloudLogging) Name() string { return "cloud-logging" }
+
+type monitoredResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+type logEntry struct {
+	Severity    string                 `json:"severity"`
+	Timestamp   string                 `json:"timestamp"`
+	InsertID    string                 `json:"insertId"`
+	Labels      map[string]string      `json:"labels"`
+	JSONPayload map[string]interface{} `json:"jsonPayload"`
+}
+
+type writeEntries struct {
+	LogName  string            `json:"logName"`
+	Resource monitoredResource `json:"resource"`
+	Entries  []logEntry        `json:"entries"`
+}
+
+// resource returns the k8s_pod resource of the alert's pod, or the global
+// resource when the cluster is unknown (outside GKE).
+func (c *CloudLogging) resource(ctx context.Context, project string, alert *types.Alert) monitoredResource {
+	c.once.Do(func() { c.cluster, c.location = c.auth.Cluster(ctx) })
+	if c.cluster == "" || c.location == "" || alert.PodName == "" {
+		return monitoredResource{Type: "global", Labels: map[string]string{"project_id": project}}
+	}
+	return monitoredResource{Type: "k8s_pod", Labels: map[string]string{
+		"project_id":     project,
+		"location":       c.location,
+		"cluster_name":   c.cluster,
+		"namespace_name": alert.PodNS,
+		"pod_name":       alert.PodName,
+	}}
+}
+
+// Send implements Sink. The entry's jsonPayload is the alert with a message
+// summarizing it, which the Logs Explorer shows as the entry's summary line.
+func (c *CloudLogging) Send(ctx context.Context, alert *types.Alert) error {
+	project := c.project
+	if project == "" {
+		var err error
+		if project, err = c.auth.ProjectID(ctx); err != nil {
+			return err
+		}
+	}
+	resource := c.resource(ctx, project, alert)
+	body, err := fit(c.Name(), c.maxPayload, alert, func(a *types.Alert) ([]byte, error) {
+		return c.entries(project, resource, a)
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, c.http, c.url, body, http.StatusOK)
+}
+
+// entries renders the entries.write request for alert.
+func (c *CloudLogging) entries(project string, resource monitoredResource, alert *types.Alert) ([]byte, error) {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	payload["message"] = fmt.Sprintf("%s: %s in %s/%s", alert.RuleID, alert.RuleName, alert.PodNS, alert.PodName)
+
+	severity, ok := cloudLoggingSeverities[alert.Severity]
+	if !ok {
+		severity = "DEFAULT"
+	}
+	return json.Marshal(writeEntries{
+		LogName:  fmt.Sprintf("projects/%s/logs/%s", project, url.PathEscape(c.logName)),
+		Resource: resource,
+		Entries: []logEntry{{
+			Severity:  severity,
+			Timestamp: alert.Timestamp.UTC().Format(time.RFC3339Nano),
+			// Alert IDs are unique, so a retried write is not duplicated.
+			InsertID:    alert.ID,
+			Labels:      map[string]string{"rule_id": alert.RuleID, "alert_id": alert.ID},
+			JSONPayload: payload,
+		}},
+	})
+}
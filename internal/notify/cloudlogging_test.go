@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func cloudLoggingServer(t *testing.T, got *writeEntries) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.Write([]byte(`{}`))
+	}))
+}
+
+func TestCloudLogging_Send(t *testing.T) {
+	var tokens int32
+	meta := fakeMetadata(t, "prod", &tokens)
+	defer meta.Close()
+	var got writeEntries
+	api := cloudLoggingServer(t, &got)
+	defer api.Close()
+
+	c := NewCloudLogging(testGCPAuth(meta), "", "")
+	c.url = api.URL
+	alert := testAlert()
+	alert.Severity = "CRITICAL"
+	if err := c.Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.LogName != "projects/my-project/logs/apss-alerts" {
+		t.Errorf("logName = %q", got.LogName)
+	}
+	res := got.Resource
+	if res.Type != "k8s_pod" || res.Labels["cluster_name"] != "prod" || res.Labels["location"] != "us-central1" ||
+		res.Labels["namespace_name"] != "prod" || res.Labels["pod_name"] != "web-1" || res.Labels["project_id"] != "my-project" {
+		t.Errorf("resource = %+v", res)
+	}
+	if len(got.Entries) != 1 {
+		t.Fatalf("entries = %d", len(got.Entries))
+	}
+	e := got.Entries[0]
+	if e.Severity != "CRITICAL" || e.InsertID != "alert-1" || e.Timestamp != "2026-01-02T03:04:05Z" || e.Labels["rule_id"] != "APSS-004" {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.JSONPayload["message"] != "APSS-004: Shell Spawned in prod/web-1" || e.JSONPayload["mitre_id"] != "T1059" {
+		t.Errorf("jsonPayload = %v", e.JSONPayload)
+	}
+}
+
+func TestCloudLogging_SeverityAndGlobalResource(t *testing.T) {
+	var tokens int32
+	meta := fakeMetadata(t, "", &tokens)
+	defer meta.Close()
+	var got writeEntries
+	api := cloudLoggingServer(t, &got)
+	defer api.Close()
+
+	c := NewCloudLogging(testGCPAuth(meta), "sec-project", "security")
+	c.url = api.URL
+	for sev, want := range map[string]string{"CRITICAL": "CRITICAL", "HIGH": "ERROR", "MEDIUM": "WARNING", "LOW": "NOTICE", "INFO": "DEFAULT"} {
+		alert := testAlert()
+		alert.Severity = sev
+		if err := c.Send(context.Background(), alert); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if got.Entries[0].Severity != want {
+			t.Errorf("%s mapped to %q, want %q", sev, got.Entries[0].Severity, want)
+		}
+	}
+	if got.LogName != "projects/sec-project/logs/security" || got.Resource.Type != "global" || got.Resource.Labels["project_id"] != "sec-project" {
+		t.Errorf("request = %+v, want the global resource outside GKE", got)
+	}
+}
@@ -0,0 +1,316 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	// DefaultDigestWindow is used for digests that set no window.
+	DefaultDigestWindow = 15 * time.Minute
+	// digestMaxGroups bounds the groups listed in one digest; the rest are
+	// only counted.
+	digestMaxGroups = 20
+	// digestTopOffenders is how many workloads each group lists.
+	digestTopOffenders = 3
+	// digestMaxWorkloads bounds the workloads counted per group, so a rule
+	// firing across thousands of pods cannot grow a window without limit.
+	digestMaxWorkloads = 256
+	// DigestRuleID is the rule ID of the summary alert sent to sinks that
+	// cannot render digests themselves.
+	DigestRuleID = "APSS-DIGEST"
+)
+
+var digestAlerts = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_notification_digest_alerts_total",
+		Help: "Total alerts batched into notification digests instead of sent one by one, by sink",
+	},
+	[]string{"sink"},
+)
+
+func init() {
+	prometheus.MustRegister(digestAlerts)
+}
+
+// DefaultDigestTemplate renders Digest.Text when no template is set.
+const DefaultDigestTemplate = `{{ .Total }} alert{{ if ne .Total 1 }}s{{ end }} from {{ rfc3339 .Start }} to {{ rfc3339 .End }}
+{{- range .Groups }}
+• [{{ .Severity }}] {{ .Namespace }}: {{ .RuleID }} {{ .RuleName }} ×{{ .Count }}
+{{- if .TopOffenders }} (top: {{ range $i, $o := .TopOffenders }}{{ if $i }}, {{ end }}{{ $o.Workload }} ×{{ $o.Count }}{{ end }}){{ end }}
+{{- end }}
+{{- if .OmittedGroups }}
+…and {{ .OmittedGroups }} more group{{ if ne .OmittedGroups 1 }}s{{ end }}
+{{- end }}`
+
+// DigestConfig batches a sink's alerts of Severities into one message per
+// Window instead of sending them one by one.
+type DigestConfig struct {
+	Severities []string
+	// Window defaults to DefaultDigestWindow.
+	Window time.Duration
+	// Template is a Go text/template executed with the *Digest to render
+	// its Text; empty uses DefaultDigestTemplate.
+	Template string
+}
+
+// LoadDigestTemplate reads a digest template from file and checks that it
+// parses.
+func LoadDigestTemplate(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if _, err := parseDigestTemplate(string(data)); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func parseDigestTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultDigestTemplate
+	}
+	tmpl, err := template.New("digest").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("digest template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Digest summarizes the alerts one sink batched over a window, grouped by
+// namespace and rule, largest groups first.
+type Digest struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Severity is the highest of the alerts'.
+	Severity string        `json:"severity"`
+	Total    int           `json:"total"`
+	Groups   []DigestGroup `json:"groups"`
+	// OmittedGroups counts groups beyond the listed ones.
+	OmittedGroups int `json:"omitted_groups,omitempty"`
+	// ClusterName and Environment are the alerts' when they all share them.
+	ClusterName string `json:"cluster_name,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	// Text is the digest rendered by the sink's digest template.
+	Text string `json:"text"`
+}
+
+// DigestGroup counts the alerts one rule raised in one namespace.
+type DigestGroup struct {
+	Namespace string    `json:"namespace"`
+	RuleID    string    `json:"rule_id"`
+	RuleName  string    `json:"rule_name"`
+	Severity  string    `json:"severity"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// TopOffenders are the workloads that raised the most alerts.
+	TopOffenders []DigestOffender `json:"top_offenders,omitempty"`
+}
+
+// DigestOffender is a workload and how many of a group's alerts it raised.
+type DigestOffender struct {
+	Workload string `json:"workload"`
+	Count    int    `json:"count"`
+}
+
+// DigestSink is a Sink that renders digests natively. Digests for sinks
+// without it are sent as a summary alert; see Digest.Alert.
+type DigestSink interface {
+	Sink
+	SendDigest(ctx context.Context, digest *Digest) error
+}
+
+// Alert returns the digest as an alert carrying its text as description,
+// for sinks that only send alerts.
+func (d *Digest) Alert() *types.Alert {
+	return &types.Alert{
+		ID:          fmt.Sprintf("digest-%d", d.End.UnixNano()),
+		Timestamp:   d.End,
+		Severity:    d.Severity,
+		RuleID:      DigestRuleID,
+		RuleName:    fmt.Sprintf("Digest of %d alerts", d.Total),
+		Description: d.Text,
+		ClusterName: d.ClusterName,
+		Environment: d.Environment,
+		Status:      types.AlertStatusOpen,
+	}
+}
+
+// digestGroup accumulates a DigestGroup; workloads counts its alerts per
+// workload, up to digestMaxWorkloads.
+type digestGroup struct {
+	DigestGroup
+	workloads map[string]int
+}
+
+// digester accumulates one route's digest alerts until flushed.
+type digester struct {
+	window     time.Duration
+	severities map[string]bool
+	tmpl       *template.Template
+
+	mu          sync.Mutex
+	start       time.Time
+	total       int
+	groups      map[string]*digestGroup
+	cluster     string
+	environment string
+}
+
+func newDigester(cfg DigestConfig) (*digester, error) {
+	tmpl, err := parseDigestTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	d := &digester{window: cfg.Window, severities: make(map[string]bool), tmpl: tmpl, groups: make(map[string]*digestGroup)}
+	if d.window <= 0 {
+		d.window = DefaultDigestWindow
+	}
+	for _, s := range cfg.Severities {
+		d.severities[strings.ToUpper(s)] = true
+	}
+	return d, nil
+}
+
+// add folds alert into the pending digest.
+func (d *digester) add(alert *types.Alert, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.total == 0 {
+		d.start = now
+		d.cluster, d.environment = alert.ClusterName, alert.Environment
+	}
+	if alert.ClusterName != d.cluster {
+		d.cluster = ""
+	}
+	if alert.Environment != d.environment {
+		d.environment = ""
+	}
+	d.total++
+
+	key := alert.PodNS + "|" + alert.RuleID
+	g := d.groups[key]
+	if g == nil {
+		g = &digestGroup{
+			DigestGroup: DigestGroup{Namespace: alert.PodNS, RuleID: alert.RuleID, RuleName: alert.RuleName, FirstSeen: alert.Timestamp},
+			workloads:   make(map[string]int),
+		}
+		d.groups[key] = g
+	}
+	g.Count++
+	if types.SeverityRank(alert.Severity) > types.SeverityRank(g.Severity) {
+		g.Severity = alert.Severity
+	}
+	if alert.Timestamp.Before(g.FirstSeen) {
+		g.FirstSeen = alert.Timestamp
+	}
+	if alert.Timestamp.After(g.LastSeen) {
+		g.LastSeen = alert.Timestamp
+	}
+	workload := alert.PodName
+	if k := alert.Kubernetes; k != nil && k.OwnerName != "" {
+		workload = k.OwnerKind + "/" + k.OwnerName
+	}
+	if _, ok := g.workloads[workload]; ok || len(g.workloads) < digestMaxWorkloads {
+		g.workloads[workload]++
+	}
+}
+
+// flush returns the pending digest and starts a new one, or returns nil if
+// no alerts are pending. The digest is returned even when its template
+// fails, along with the error.
+func (d *digester) flush(now time.Time) (*Digest, error) {
+	d.mu.Lock()
+	if d.total == 0 {
+		d.mu.Unlock()
+		return nil, nil
+	}
+	digest := &Digest{Start: d.start, End: now, Total: d.total, ClusterName: d.cluster, Environment: d.environment}
+	groups := make([]DigestGroup, 0, len(d.groups))
+	for _, g := range d.groups {
+		g.TopOffenders = topOffenders(g.workloads, digestTopOffenders)
+		groups = append(groups, g.DigestGroup)
+	}
+	d.total = 0
+	d.groups = make(map[string]*digestGroup)
+	d.mu.Unlock()
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		if groups[i].Namespace != groups[j].Namespace {
+			return groups[i].Namespace < groups[j].Namespace
+		}
+		return groups[i].RuleID < groups[j].RuleID
+	})
+	for _, g := range groups {
+		if types.SeverityRank(g.Severity) > types.SeverityRank(digest.Severity) {
+			digest.Severity = g.Severity
+		}
+	}
+	if len(groups) > digestMaxGroups {
+		digest.OmittedGroups = len(groups) - digestMaxGroups
+		groups = groups[:digestMaxGroups]
+	}
+	digest.Groups = groups
+
+	// A template that fails on real data still sends the digest, rendered
+	// by the default template.
+	text, err := renderDigest(d.tmpl, digest)
+	if err != nil {
+		tmpl, _ := parseDigestTemplate("")
+		text, _ = renderDigest(tmpl, digest)
+	}
+	digest.Text = text
+	return digest, err
+}
+
+func renderDigest(tmpl *template.Template, digest *Digest) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, digest); err != nil {
+		return "", fmt.Errorf("render digest: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// topOffenders returns the n workloads with the highest counts.
+func topOffenders(workloads map[string]int, n int) []DigestOffender {
+	out := make([]DigestOffender, 0, len(workloads))
+	for w, count := range workloads {
+		if w != "" {
+			out = append(out, DigestOffender{Workload: w, Count: count})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Workload < out[j].Workload
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// sendDigest sends digest to sink, natively if it is a DigestSink.
+func sendDigest(ctx context.Context, sink Sink, digest *Digest) error {
+	if ds, ok := sink.(DigestSink); ok {
+		return ds.SendDigest(ctx, digest)
+	}
+	return sink.Send(ctx, digest.Alert())
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestDigester_Flush(t *testing.T) {
+	d, err := newDigester(DigestConfig{Severities: []string{"medium"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.window != DefaultDigestWindow || !d.severities["MEDIUM"] {
+		t.Errorf("digester = window %v, severities %v", d.window, d.severities)
+	}
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	if digest, _ := d.flush(start); digest != nil {
+		t.Fatal("empty digester flushed a digest")
+	}
+
+	api := &types.KubeMetadata{OwnerKind: "Deployment", OwnerName: "api"}
+	add := func(ns, rule, pod string, k *types.KubeMetadata) {
+		d.add(&types.Alert{Severity: "MEDIUM", RuleID: rule, RuleName: "Rule " + rule, PodNS: ns, PodName: pod,
+			Kubernetes: k, Timestamp: start, ClusterName: "prod-eu"}, start)
+	}
+	for i := 0; i < 4; i++ {
+		add("payments", "APSS-007", "api-x", api)
+	}
+	add("payments", "APSS-007", "worker-0", nil)
+	add("data", "APSS-012", "db-0", nil)
+
+	digest, err := d.flush(start.Add(15 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest.Total != 6 || len(digest.Groups) != 2 || digest.Severity != "MEDIUM" || digest.ClusterName != "prod-eu" {
+		t.Fatalf("digest = %+v", digest)
+	}
+	g := digest.Groups[0]
+	if g.RuleID != "APSS-007" || g.Count != 5 || len(g.TopOffenders) != 2 ||
+		g.TopOffenders[0] != (DigestOffender{Workload: "Deployment/api", Count: 4}) {
+		t.Errorf("largest group = %+v", g)
+	}
+	want := "6 alerts from 2026-01-02T03:00:00Z to 2026-01-02T03:15:00Z\n" +
+		"• [MEDIUM] payments: APSS-007 Rule APSS-007 ×5 (top: Deployment/api ×4, worker-0 ×1)\n" +
+		"• [MEDIUM] data: APSS-012 Rule APSS-012 ×1 (top: db-0 ×1)"
+	if digest.Text != want {
+		t.Errorf("text:\n got %s\nwant %s", digest.Text, want)
+	}
+	if digest, _ := d.flush(start.Add(30 * time.Minute)); digest != nil {
+		t.Error("flush did not start a new digest")
+	}
+
+	// Groups beyond digestMaxGroups are only counted.
+	for i := 0; i < digestMaxGroups+2; i++ {
+		add("ns", strings.Repeat("R", i+1), "p", nil)
+	}
+	if digest, _ = d.flush(start); len(digest.Groups) != digestMaxGroups || digest.OmittedGroups != 2 ||
+		!strings.HasSuffix(digest.Text, "…and 2 more groups") {
+		t.Errorf("groups = %d, omitted %d", len(digest.Groups), digest.OmittedGroups)
+	}
+
+	// A template failing on real data falls back to the default.
+	d, _ = newDigester(DigestConfig{Severities: []string{"LOW"}, Template: "{{ .Nope }}"})
+	add("ns", "APSS-001", "p", nil)
+	if digest, err = d.flush(start); err == nil || !strings.HasPrefix(digest.Text, "1 alert from") {
+		t.Errorf("failing template: err %v, text %q", err, digest.Text)
+	}
+	if _, err := newDigester(DigestConfig{Template: "{{ .Total"}); err == nil {
+		t.Error("unparseable template accepted")
+	}
+}
+
+func TestRouter_Digest(t *testing.T) {
+	sink := &fakeSink{name: "digest-test"}
+	r := NewRouter(logrus.New())
+	if err := r.AddDigestRoute(sink, []string{"HIGH"}, DigestConfig{Severities: []string{"MEDIUM"}, Window: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	r.Notify(&types.Alert{ID: "a1", Severity: "HIGH"})
+	r.Notify(&types.Alert{ID: "a2", Severity: "MEDIUM", RuleID: "APSS-007"})
+	r.Notify(&types.Alert{ID: "a3", Severity: "MEDIUM", RuleID: "APSS-007"})
+	r.Notify(&types.Alert{ID: "a4", Severity: "MEDIUM", Test: true})
+	r.Notify(&types.Alert{ID: "a5", Severity: "LOW"})
+	time.Sleep(100 * time.Millisecond)
+
+	got := sink.received()
+	if len(got) != 3 || got[0] != "a1" || got[1] != "a4" || !strings.HasPrefix(got[2], "digest-") {
+		t.Errorf("received %v, want [a1 a4 digest-…]", got)
+	}
+}
+
+func TestSlack_SendDigest(t *testing.T) {
+	var got slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	digest := &Digest{Start: start, End: start.Add(15 * time.Minute), Severity: "MEDIUM", Total: 7,
+		Groups: make([]DigestGroup, 2), Text: "7 alerts\n• two lines", ClusterName: "prod-eu"}
+	if err := NewSlack(srv.URL, "", nil).SendDigest(context.Background(), digest); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "[DIGEST] 7 alerts in 2 groups" || len(got.Attachments) != 1 {
+		t.Fatalf("message = %+v", got)
+	}
+	att := got.Attachments[0]
+	if att.Text != digest.Text || att.Color != severityColors["MEDIUM"] || att.Fields[0].Value != "15m0s" || att.Fields[2].Value != "prod-eu" {
+		t.Errorf("attachment = %+v", att)
+	}
+}
+
+func TestWebhook_Digest(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	for _, d := range []*WebhookDigest{{}, {Severities: []string{"LOW"}, Window: "soon"}, {Severities: []string{"LOW"}, Body: "{{"}} {
+		if _, err := NewWebhook(WebhookConfig{Name: "bad", URL: srv.URL, Digest: d}); err == nil {
+			t.Errorf("digest %+v accepted", d)
+		}
+	}
+
+	w, err := NewWebhook(WebhookConfig{Name: "teams", URL: srv.URL, Digest: &WebhookDigest{
+		Severities: []string{"MEDIUM"}, Window: "1h", Body: `{"text": {{ .Text | json }}, "n": {{ .Total }}}`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, ok := w.Digest(); !ok || cfg.Window != time.Hour || cfg.Severities[0] != "MEDIUM" {
+		t.Errorf("Digest() = %+v, %v", cfg, ok)
+	}
+	if err := w.SendDigest(context.Background(), &Digest{Total: 3, Text: "a\nb"}); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"text": "a\nb", "n": 3}` {
+		t.Errorf("body = %s", body)
+	}
+	if _, ok := (&Webhook{}).Digest(); ok {
+		t.Error("webhook without digest reports one")
+	}
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcpMetadataURL is the GKE metadata server. With Workload Identity it hands
+// out tokens for the Google service account bound to the pod's Kubernetes
+// service account, so no key file is needed.
+const gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1"
+
+// tokenRefreshMargin is how long before expiry a cached token is replaced.
+const tokenRefreshMargin = time.Minute
+
+// GCPAuth gets OAuth2 access tokens and project details from the metadata
+// server. It is shared by the Google Cloud sinks.
+type GCPAuth struct {
+	metadataURL string
+	http        *http.Client
+	// transport carries authenticated API requests; the metadata server is
+	// always reached directly.
+	transport http.RoundTripper
+
+	mu      sync.Mutex
+	token   string
+	expiry  time.Time
+	project string
+}
+
+// NewGCPAuth creates metadata server credentials. GCE_METADATA_HOST
+// overrides the server address, as in the Google client libraries. Google
+// API requests go through transport, or http.DefaultTransport if it is nil.
+func NewGCPAuth(transport http.RoundTripper) *GCPAuth {
+	url := gcpMetadataURL
+	if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+		url = "http://" + host + "/computeMetadata/v1"
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &GCPAuth{metadataURL: url, http: &http.Client{Timeout: 5 * time.Second}, transport: transport}
+}
+
+// metadata fetches a metadata server value as text.
+func (a *GCPAuth) metadata(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.metadataURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", fmt.Errorf("metadata server: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server %s: unexpected status %d", path, resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// Token returns an access token, fetching a new one when the cached token
+// is about to expire.
+func (a *GCPAuth) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Until(a.expiry) > tokenRefreshMargin {
+		return a.token, nil
+	}
+	body, err := a.metadata(ctx, "/instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(body), &tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("metadata server returned no access token")
+	}
+	a.token = tok.AccessToken
+	a.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return a.token, nil
+}
+
+// ProjectID returns the project the cluster runs in.
+func (a *GCPAuth) ProjectID(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.project != "" {
+		return a.project, nil
+	}
+	project, err := a.metadata(ctx, "/project/project-id")
+	if err != nil {
+		return "", err
+	}
+	a.project = project
+	return project, nil
+}
+
+// Cluster returns the GKE cluster name and location, or empty strings
+// outside GKE.
+func (a *GCPAuth) Cluster(ctx context.Context) (name, location string) {
+	name, _ = a.metadata(ctx, "/instance/attributes/cluster-name")
+	location, _ = a.metadata(ctx, "/instance/attributes/cluster-location")
+	return name, location
+}
+
+// client returns an HTTP client that authenticates requests with a token.
+func (a *GCPAuth) client() *http.Client {
+	return &http.Client{Transport: &gcpTransport{auth: a, base: a.transport}}
+}
+
+// gcpTransport adds a bearer token to each request.
+type gcpTransport struct {
+	auth *GCPAuth
+	base http.RoundTripper
+}
+
+func (t *gcpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.auth.Token(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("get access token: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
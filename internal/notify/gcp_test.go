@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeMetadata serves the metadata server paths the Google Cloud sinks use.
+// cluster is empty to behave like a non-GKE host.
+func fakeMetadata(t *testing.T, cluster string, tokens *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			atomic.AddInt32(tokens, 1)
+			w.Write([]byte(`{"access_token":"ya29.tok","expires_in":3599,"token_type":"Bearer"}`))
+		case "/computeMetadata/v1/project/project-id":
+			w.Write([]byte("my-project"))
+		case "/computeMetadata/v1/instance/attributes/cluster-name":
+			if cluster == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(cluster))
+		case "/computeMetadata/v1/instance/attributes/cluster-location":
+			w.Write([]byte("us-central1"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func testGCPAuth(srv *httptest.Server) *GCPAuth {
+	a := NewGCPAuth(nil)
+	a.metadataURL = srv.URL + "/computeMetadata/v1"
+	return a
+}
+
+func TestGCPAuth(t *testing.T) {
+	var tokens int32
+	srv := fakeMetadata(t, "prod", &tokens)
+	defer srv.Close()
+	auth := testGCPAuth(srv)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		tok, err := auth.Token(ctx)
+		if err != nil || tok != "ya29.tok" {
+			t.Fatalf("Token = %q, %v", tok, err)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("token fetched %d times, want 1 (cached)", tokens)
+	}
+	if project, err := auth.ProjectID(ctx); err != nil || project != "my-project" {
+		t.Errorf("ProjectID = %q, %v", project, err)
+	}
+	if name, loc := auth.Cluster(ctx); name != "prod" || loc != "us-central1" {
+		t.Errorf("Cluster = %q, %q", name, loc)
+	}
+}
+
+func TestGCPAuth_MetadataUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	if _, err := testGCPAuth(srv).Token(context.Background()); err == nil {
+		t.Error("Token succeeded without a metadata server")
+	}
+}
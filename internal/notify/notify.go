@@ -0,0 +1,212 @@
+// Package notify delivers alerts to external systems such as Slack and
+// PagerDuty, routing each alert to the sinks configured for its severity.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	// queueSize bounds alerts waiting for delivery; beyond it alerts are
+	// dropped rather than blocking alert processing.
+	queueSize = 256
+	// sendTimeout bounds a single delivery attempt.
+	sendTimeout = 10 * time.Second
+)
+
+var notifications = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_notifications_total",
+		Help: "Total alert notifications by sink and result (sent, failed, dropped)",
+	},
+	[]string{"sink", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(notifications)
+}
+
+// Sink delivers an alert to one external system.
+type Sink interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+	Send(ctx context.Context, alert *types.Alert) error
+}
+
+type route struct {
+	sink       Sink
+	severities map[string]bool
+	// digest batches the alerts of its severities; nil sends every alert
+	// on its own.
+	digest *digester
+}
+
+// delivery is one alert or one digest for a sink.
+type delivery struct {
+	sink   Sink
+	alert  *types.Alert
+	digest *Digest
+}
+
+// Router sends each alert to every sink whose route includes the alert's
+// severity. Deliveries are queued and sent by Run, one at a time.
+type Router struct {
+	routes []route
+	queue  chan delivery
+	log    *logrus.Logger
+}
+
+// NewRouter creates a router with no routes.
+func NewRouter(log *logrus.Logger) *Router {
+	return &Router{queue: make(chan delivery, queueSize), log: log}
+}
+
+// AddRoute sends alerts with any of severities (case-insensitive) to sink.
+func (r *Router) AddRoute(sink Sink, severities []string) {
+	rt := route{sink: sink, severities: make(map[string]bool)}
+	for _, s := range severities {
+		rt.severities[strings.ToUpper(s)] = true
+	}
+	r.routes = append(r.routes, rt)
+}
+
+// AddDigestRoute sends alerts with any of severities to sink like AddRoute,
+// except that alerts of digest.Severities are batched into one digest per
+// digest.Window. Test alerts are always sent on their own.
+func (r *Router) AddDigestRoute(sink Sink, severities []string, digest DigestConfig) error {
+	d, err := newDigester(digest)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sink.Name(), err)
+	}
+	r.AddRoute(sink, append(append([]string(nil), severities...), digest.Severities...))
+	r.routes[len(r.routes)-1].digest = d
+	return nil
+}
+
+// Empty reports whether the router has no routes.
+func (r *Router) Empty() bool {
+	return len(r.routes) == 0
+}
+
+// Notify queues alert for every matching sink. It never blocks; if the queue
+// is full the delivery is dropped and counted.
+func (r *Router) Notify(alert *types.Alert) {
+	for _, rt := range r.routes {
+		if !rt.severities[alert.Severity] {
+			continue
+		}
+		if rt.digest != nil && rt.digest.severities[alert.Severity] && !alert.Test {
+			rt.digest.add(alert, time.Now())
+			digestAlerts.WithLabelValues(rt.sink.Name()).Inc()
+			continue
+		}
+		select {
+		case r.queue <- delivery{sink: rt.sink, alert: alert}:
+		default:
+			notifications.WithLabelValues(rt.sink.Name(), "dropped").Inc()
+			r.log.WithFields(logrus.Fields{"sink": rt.sink.Name(), "alert_id": alert.ID}).Warn("Notification queue full, dropping alert")
+		}
+	}
+}
+
+// SendAll sends alert to every sink now, bypassing severity routes and the
+// queue, and returns each sink's error by name, nil when it delivered. It is
+// for test alerts whose delivery must be confirmed.
+func (r *Router) SendAll(ctx context.Context, alert *types.Alert) map[string]error {
+	results := make(map[string]error, len(r.routes))
+	for _, rt := range r.routes {
+		name := rt.sink.Name()
+		if _, sent := results[name]; sent {
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		results[name] = rt.sink.Send(sendCtx, alert)
+		cancel()
+	}
+	return results
+}
+
+// Run delivers queued alerts and digests until ctx is done, then sends the
+// digests pending.
+func (r *Router) Run(ctx context.Context) {
+	for _, rt := range r.routes {
+		if rt.digest != nil {
+			go r.runDigest(ctx, rt)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-r.queue:
+			r.deliver(ctx, d)
+		}
+	}
+}
+
+// runDigest queues rt's digest every window until ctx is done, then sends
+// the last one directly.
+func (r *Router) runDigest(ctx context.Context, rt route) {
+	ticker := time.NewTicker(rt.digest.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if digest := r.flushDigest(rt); digest != nil {
+				r.deliver(context.Background(), delivery{sink: rt.sink, digest: digest})
+			}
+			return
+		case <-ticker.C:
+			digest := r.flushDigest(rt)
+			if digest == nil {
+				continue
+			}
+			select {
+			case r.queue <- delivery{sink: rt.sink, digest: digest}:
+			default:
+				notifications.WithLabelValues(rt.sink.Name(), "dropped").Inc()
+				r.log.WithFields(logrus.Fields{"sink": rt.sink.Name(), "alerts": digest.Total}).Warn("Notification queue full, dropping digest")
+			}
+		}
+	}
+}
+
+func (r *Router) flushDigest(rt route) *Digest {
+	digest, err := rt.digest.flush(time.Now())
+	if err != nil {
+		r.log.WithError(err).WithField("sink", rt.sink.Name()).Warn("Digest template failed, using the default")
+	}
+	return digest
+}
+
+func (r *Router) deliver(ctx context.Context, d delivery) {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	if d.digest != nil {
+		if err := sendDigest(ctx, d.sink, d.digest); err != nil {
+			notifications.WithLabelValues(d.sink.Name(), "failed").Inc()
+			r.log.WithError(err).WithFields(logrus.Fields{
+				"sink": d.sink.Name(), "alerts": d.digest.Total,
+			}).Error("Failed to send alert digest")
+			return
+		}
+		notifications.WithLabelValues(d.sink.Name(), "sent").Inc()
+		return
+	}
+	if err := d.sink.Send(ctx, d.alert); err != nil {
+		notifications.WithLabelValues(d.sink.Name(), "failed").Inc()
+		r.log.WithError(err).WithFields(logrus.Fields{
+			"sink": d.sink.Name(), "alert_id": d.alert.ID, "rule_id": d.alert.RuleID,
+		}).Error("Failed to send alert notification")
+		return
+	}
+	notifications.WithLabelValues(d.sink.Name(), "sent").Inc()
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+type fakeSink struct {
+	name string
+	err  error
+	mu   sync.Mutex
+	got  []string
+}
+
+func (f *fakeSink) Name() string { return f.name }
+
+func (f *fakeSink) Send(ctx context.Context, alert *types.Alert) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.got = append(f.got, alert.ID)
+	return f.err
+}
+
+func (f *fakeSink) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.got...)
+}
+
+func TestRouter_RoutesBySeverity(t *testing.T) {
+	pager := &fakeSink{name: "pager"}
+	channel := &fakeSink{name: "channel"}
+	r := NewRouter(logrus.New())
+	r.AddRoute(pager, []string{"critical"})
+	r.AddRoute(channel, []string{"HIGH", "CRITICAL"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	r.Notify(&types.Alert{ID: "a1", Severity: "CRITICAL"})
+	r.Notify(&types.Alert{ID: "a2", Severity: "HIGH"})
+	r.Notify(&types.Alert{ID: "a3", Severity: "MEDIUM"})
+	time.Sleep(50 * time.Millisecond)
+
+	if got := pager.received(); len(got) != 1 || got[0] != "a1" {
+		t.Errorf("pager received %v, want [a1]", got)
+	}
+	if got := channel.received(); len(got) != 2 || got[0] != "a1" || got[1] != "a2" {
+		t.Errorf("channel received %v, want [a1 a2]", got)
+	}
+}
+
+func TestRouter_CountsFailuresAndDrops(t *testing.T) {
+	failing := &fakeSink{name: "failing-test", err: errors.New("boom")}
+	r := NewRouter(logrus.New())
+	r.AddRoute(failing, []string{"HIGH"})
+	if r.Empty() {
+		t.Fatal("router with a route should not be empty")
+	}
+
+	// Without Run nothing drains the queue, so the overflow is dropped.
+	for i := 0; i < queueSize+3; i++ {
+		r.Notify(&types.Alert{ID: "a", Severity: "HIGH"})
+	}
+	if got := testutil.ToFloat64(notifications.WithLabelValues("failing-test", "dropped")); got != 3 {
+		t.Errorf("dropped = %v, want 3", got)
+	}
+
+	r.deliver(context.Background(), <-r.queue)
+	if got := testutil.ToFloat64(notifications.WithLabelValues("failing-test", "failed")); got != 1 {
+		t.Errorf("failed = %v, want 1", got)
+	}
+}
+
+func TestRouter_SendAll(t *testing.T) {
+	pager := &fakeSink{name: "pager", err: errors.New("invalid routing key")}
+	channel := &fakeSink{name: "channel"}
+	r := NewRouter(logrus.New())
+	r.AddRoute(pager, []string{"CRITICAL"})
+	r.AddRoute(channel, []string{"HIGH"})
+	r.AddRoute(channel, []string{"CRITICAL"})
+
+	// Sent to every sink once, whatever the severity, without Run.
+	results := r.SendAll(context.Background(), &types.Alert{ID: "canary", Severity: "INFO", Test: true})
+	if len(results) != 2 || results["pager"] == nil || results["channel"] != nil {
+		t.Errorf("results = %v", results)
+	}
+	if got := channel.received(); len(got) != 1 || got[0] != "canary" {
+		t.Errorf("channel received %v", got)
+	}
+	if got := pager.received(); len(got) != 1 {
+		t.Errorf("pager received %v", got)
+	}
+}
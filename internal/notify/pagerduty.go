@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutySeverities maps alert severities onto the four PagerDuty accepts.
+var pagerDutySeverities = map[string]string{
+	"CRITICAL": "critical",
+	"HIGH":     "error",
+	"MEDIUM":   "warning",
+}
+
+// PagerDuty triggers incidents through the PagerDuty Events API v2.
+type PagerDuty struct {
+	routingKey string
+	url        string
+	maxPayload int
+	http       *http.Client
+}
+
+// NewPagerDuty creates a PagerDuty sink for the integration's routing key.
+// A nil transport uses http.DefaultTransport.
+func NewPagerDuty(routingKey string, transport http.RoundTripper) *PagerDuty {
+	return &PagerDuty{routingKey: routingKey, url: PagerDutyEventsURL, maxPayload: pagerDutyMaxPayload, http: &http.Client{Transport: transport}}
+}
+
+// Name implements Sink.
+func (p *PagerDuty) Name() string { return "pagerduty" }
+
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links,omitempty"`
+}
+
+// Send implements Sink. Repeat alerts for the same rule and pod share a dedup
+// key, so they update one open incident instead of paging again. Test alerts
+// are sent as resolve events, which check the routing key without paging.
+func (p *PagerDuty) Send(ctx context.Context, alert *types.Alert) error {
+	data, err := fit(p.Name(), p.maxPayload, alert, func(a *types.Alert) ([]byte, error) {
+		return json.Marshal(p.event(a))
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, p.http, p.url, data, http.StatusAccepted)
+}
+
+func (p *PagerDuty) event(alert *types.Alert) pagerDutyEvent {
+	severity, ok := pagerDutySeverities[alert.Severity]
+	if !ok {
+		severity = "info"
+	}
+	source := alert.PodNS + "/" + alert.PodName
+	if alert.ClusterName != "" {
+		// The same pod name in two clusters is two incidents.
+		source = alert.ClusterName + "/" + source
+	}
+	ev := pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    fmt.Sprintf("apss/%s/%s", alert.RuleID, source),
+		Payload: pagerDutyPayload{
+			Summary:   fmt.Sprintf("%s: %s in %s", alert.RuleID, alert.RuleName, source),
+			Source:    source,
+			Severity:  severity,
+			Timestamp: alert.Timestamp.UTC().Format(time.RFC3339),
+			Component: alert.PodName,
+			Group:     alert.PodNS,
+			Class:     alert.RuleID,
+			CustomDetails: map[string]interface{}{
+				"alert_id":            alert.ID,
+				"description":         alert.Description,
+				"mitre_tactic":        alert.MitreTactic,
+				"mitre_id":            alert.MitreID,
+				"event_ids":           alert.EventIDs,
+				"recommended_actions": alert.Actions,
+			},
+		},
+	}
+	if alert.Test {
+		ev.EventAction = "resolve"
+		ev.Payload.CustomDetails["test"] = true
+	}
+	if alert.Truncated {
+		ev.Payload.CustomDetails["truncated"] = true
+	}
+	if alert.Kubernetes != nil {
+		ev.Payload.CustomDetails["kubernetes"] = alert.Kubernetes
+	}
+	if alert.ClusterName != "" {
+		ev.Payload.CustomDetails["cluster_name"] = alert.ClusterName
+	}
+	if alert.Environment != "" {
+		ev.Payload.CustomDetails["environment"] = alert.Environment
+	}
+	if alert.OccurredAt != nil {
+		ev.Payload.CustomDetails["occurred_at"] = alert.OccurredAt.UTC().Format(time.RFC3339)
+	}
+	if pb := alert.Playbook; pb != nil {
+		if pb.URL != "" {
+			ev.Links = append(ev.Links, pagerDutyLink{Href: pb.URL, Text: "Playbook"})
+		}
+		if pb.Body != "" {
+			ev.Payload.CustomDetails["playbook"] = pb.Body
+		}
+	}
+	return ev
+}
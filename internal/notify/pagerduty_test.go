@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestPagerDuty_Send(t *testing.T) {
+	var got pagerDutyEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"success","dedup_key":"x"}`))
+	}))
+	defer srv.Close()
+
+	p := NewPagerDuty("R0UT1NGKEY", nil)
+	p.url = srv.URL
+	alert := testAlert()
+	alert.Severity = "CRITICAL"
+	occurred := alert.Timestamp.Add(-9 * time.Second)
+	alert.OccurredAt = &occurred
+	if err := p.Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.RoutingKey != "R0UT1NGKEY" || got.EventAction != "trigger" || got.DedupKey != "apss/APSS-004/prod/web-1" {
+		t.Errorf("event = %+v", got)
+	}
+	pl := got.Payload
+	if pl.Severity != "critical" || pl.Source != "prod/web-1" || pl.Class != "APSS-004" || pl.Timestamp != "2026-01-02T03:04:05Z" {
+		t.Errorf("payload = %+v", pl)
+	}
+	if pl.CustomDetails["alert_id"] != "alert-1" || pl.CustomDetails["occurred_at"] != "2026-01-02T03:03:56Z" {
+		t.Errorf("custom_details = %v", pl.CustomDetails)
+	}
+	if len(got.Links) != 0 || pl.CustomDetails["playbook"] != nil {
+		t.Errorf("playbook sent for an alert without one: links %v", got.Links)
+	}
+
+	alert.Playbook = &types.Playbook{URL: "https://runbooks.example.com/shell", Body: "1. Exec into the pod"}
+	if err := p.Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(got.Links) != 1 || got.Links[0].Href != alert.Playbook.URL || got.Payload.CustomDetails["playbook"] != alert.Playbook.Body {
+		t.Errorf("playbook: links %v, custom_details %v", got.Links, got.Payload.CustomDetails)
+	}
+
+	// Test alerts resolve rather than trigger, so they never page.
+	alert.Test = true
+	if err := p.Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.EventAction != "resolve" || got.Payload.CustomDetails["test"] != true {
+		t.Errorf("test alert: action %q, custom_details %v", got.EventAction, got.Payload.CustomDetails)
+	}
+}
+
+func TestPagerDuty_SeverityMapping(t *testing.T) {
+	var got pagerDutyEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	p := NewPagerDuty("k", nil)
+	p.url = srv.URL
+	for sev, want := range map[string]string{"CRITICAL": "critical", "HIGH": "error", "MEDIUM": "warning", "LOW": "info", "INFO": "info"} {
+		alert := testAlert()
+		alert.Severity = sev
+		if err := p.Send(context.Background(), alert); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if got.Payload.Severity != want {
+			t.Errorf("%s mapped to %q, want %q", sev, got.Payload.Severity, want)
+		}
+	}
+}
+
+func TestPagerDuty_RejectedEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"status":"invalid event"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	p := NewPagerDuty("k", nil)
+	p.url = srv.URL
+	if err := p.Send(context.Background(), testAlert()); err == nil {
+		t.Error("expected error for rejected event")
+	}
+}
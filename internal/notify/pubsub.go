@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// PubSubURL is the Pub/Sub API endpoint.
+const PubSubURL = "https://pubsub.googleapis.com/v1/"
+
+// PubSub publishes alerts as JSON messages to a Google Cloud Pub/Sub topic.
+type PubSub struct {
+	auth    *GCPAuth
+	project string
+	topic   string
+	url     string
+	http    *http.Client
+
+	maxPayload int
+}
+
+// NewPubSub creates a Pub/Sub sink. topic is a topic ID in project, or a
+// full "projects/<project>/topics/<topic>" name. An empty project is looked
+// up from the metadata server on first use.
+func NewPubSub(auth *GCPAuth, project, topic string) *PubSub {
+	return &PubSub{auth: auth, project: project, topic: topic, url: PubSubURL, http: auth.client(), maxPayload: pubSubMaxPayload}
+}
+
+// Name implements Sink.
+func (p *PubSub) Name() string { return "pubsub" }
+
+type pubSubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+type pubSubPublish struct {
+	Messages []pubSubMessage `json:"messages"`
+}
+
+// topicName returns the full resource name of the topic.
+func (p *PubSub) topicName(ctx context.Context) (string, error) {
+	if strings.HasPrefix(p.topic, "projects/") {
+		return p.topic, nil
+	}
+	project := p.project
+	if project == "" {
+		var err error
+		if project, err = p.auth.ProjectID(ctx); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("projects/%s/topics/%s", project, p.topic), nil
+}
+
+// Send implements Sink. The message body is the alert as JSON; its
+// attributes carry the fields subscribers most often filter on.
+func (p *PubSub) Send(ctx context.Context, alert *types.Alert) error {
+	topic, err := p.topicName(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := fit(p.Name(), p.maxPayload, alert, func(a *types.Alert) ([]byte, error) {
+		data, err := json.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(pubSubPublish{Messages: []pubSubMessage{{
+			Data: data,
+			Attributes: map[string]string{
+				"alert_id":      a.ID,
+				"rule_id":       a.RuleID,
+				"severity":      a.Severity,
+				"pod_namespace": a.PodNS,
+				"pod_name":      a.PodName,
+			},
+		}}})
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, p.http, p.url+topic+":publish", body, http.StatusOK)
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestPubSub_Send(t *testing.T) {
+	var tokens int32
+	meta := fakeMetadata(t, "", &tokens)
+	defer meta.Close()
+
+	var path string
+	var got pubSubPublish
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.Write([]byte(`{"messageIds":["1"]}`))
+	}))
+	defer api.Close()
+
+	p := NewPubSub(testGCPAuth(meta), "", "apss-alerts")
+	p.url = api.URL + "/v1/"
+	if err := p.Send(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if path != "/v1/projects/my-project/topics/apss-alerts:publish" {
+		t.Errorf("published to %q", path)
+	}
+	if len(got.Messages) != 1 {
+		t.Fatalf("messages = %d", len(got.Messages))
+	}
+	msg := got.Messages[0]
+	var alert types.Alert
+	if err := json.Unmarshal(msg.Data, &alert); err != nil || alert.ID != "alert-1" {
+		t.Errorf("data = %s (%v)", msg.Data, err)
+	}
+	if msg.Attributes["rule_id"] != "APSS-004" || msg.Attributes["severity"] != "HIGH" || msg.Attributes["pod_namespace"] != "prod" {
+		t.Errorf("attributes = %v", msg.Attributes)
+	}
+}
+
+func TestPubSub_FullTopicName(t *testing.T) {
+	p := NewPubSub(NewGCPAuth(nil), "ignored", "projects/sec-project/topics/alerts")
+	topic, err := p.topicName(context.Background())
+	if err != nil || topic != "projects/sec-project/topics/alerts" {
+		t.Errorf("topicName = %q, %v", topic, err)
+	}
+}
@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// severityColors are the Slack attachment colors per alert severity.
+var severityColors = map[string]string{
+	"CRITICAL": "#8b0000",
+	"HIGH":     "#e01e5a",
+	"MEDIUM":   "#ecb22e",
+	"LOW":      "#2eb67d",
+}
+
+// Slack posts alerts to a Slack incoming webhook.
+type Slack struct {
+	webhookURL string
+	channel    string
+	maxPayload int
+	http       *http.Client
+}
+
+// NewSlack creates a Slack sink. channel overrides the webhook's default
+// channel when set. A nil transport uses http.DefaultTransport.
+func NewSlack(webhookURL, channel string, transport http.RoundTripper) *Slack {
+	return &Slack{webhookURL: webhookURL, channel: channel, maxPayload: slackMaxPayload, http: &http.Client{Transport: transport}}
+}
+
+// Name implements Sink.
+func (s *Slack) Name() string { return "slack" }
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Color    string       `json:"color,omitempty"`
+	Fallback string       `json:"fallback"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields"`
+	Ts       int64        `json:"ts"`
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// Send implements Sink.
+func (s *Slack) Send(ctx context.Context, alert *types.Alert) error {
+	data, err := fit(s.Name(), s.maxPayload, alert, func(a *types.Alert) ([]byte, error) {
+		return json.Marshal(s.message(a))
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.http, s.webhookURL, data, http.StatusOK)
+}
+
+func (s *Slack) message(alert *types.Alert) slackMessage {
+	title := fmt.Sprintf("[%s] %s: %s", alert.Severity, alert.RuleID, alert.RuleName)
+	if alert.Test {
+		title = "[TEST] " + title
+	}
+	fields := []slackField{
+		{Title: "Pod", Value: alert.PodNS + "/" + alert.PodName, Short: true},
+		{Title: "Severity", Value: alert.Severity, Short: true},
+	}
+	if cluster := strings.Trim(alert.ClusterName+"/"+alert.Environment, "/"); cluster != "" {
+		fields = append(fields, slackField{Title: "Cluster", Value: cluster, Short: true})
+	}
+	if k := alert.Kubernetes; k != nil {
+		if w := k.String(); w != "" {
+			fields = append(fields, slackField{Title: "Workload", Value: w, Short: true})
+		}
+		if k.Node != "" {
+			fields = append(fields, slackField{Title: "Node", Value: k.Node, Short: true})
+		}
+	}
+	if alert.MitreID != "" {
+		fields = append(fields, slackField{Title: "MITRE ATT&CK", Value: strings.TrimSpace(alert.MitreTactic + " " + alert.MitreID), Short: true})
+	}
+	if alert.OccurredAt != nil {
+		fields = append(fields, slackField{Title: "Occurred", Value: alert.OccurredAt.UTC().Format(time.RFC3339), Short: true})
+	}
+	fields = append(fields, slackField{Title: "Alert ID", Value: alert.ID, Short: true})
+	if len(alert.Actions) > 0 {
+		fields = append(fields, slackField{Title: "Recommended actions", Value: "• " + strings.Join(alert.Actions, "\n• ")})
+	}
+	if p := alert.Playbook; p != nil {
+		fields = append(fields, slackField{Title: "Playbook", Value: strings.TrimSpace(p.URL + "\n" + p.Body)})
+	}
+	if alert.Truncated {
+		fields = append(fields, slackField{Title: "Truncated", Value: "Shortened to fit Slack; see the alert for full details", Short: true})
+	}
+	return slackMessage{
+		Channel: s.channel,
+		Text:    title,
+		Attachments: []slackAttachment{{
+			Color:    severityColors[alert.Severity],
+			Fallback: title,
+			Text:     alert.Description,
+			Fields:   fields,
+			Ts:       alert.Timestamp.Unix(),
+		}},
+	}
+}
+
+// SendDigest implements DigestSink.
+func (s *Slack) SendDigest(ctx context.Context, digest *Digest) error {
+	data, err := json.Marshal(s.digestMessage(digest))
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.http, s.webhookURL, data, http.StatusOK)
+}
+
+func (s *Slack) digestMessage(digest *Digest) slackMessage {
+	title := fmt.Sprintf("[DIGEST] %d alerts in %d groups", digest.Total, len(digest.Groups)+digest.OmittedGroups)
+	fields := []slackField{
+		{Title: "Window", Value: digest.End.Sub(digest.Start).Round(time.Second).String(), Short: true},
+		{Title: "Highest severity", Value: digest.Severity, Short: true},
+	}
+	if cluster := strings.Trim(digest.ClusterName+"/"+digest.Environment, "/"); cluster != "" {
+		fields = append(fields, slackField{Title: "Cluster", Value: cluster, Short: true})
+	}
+	return slackMessage{
+		Channel: s.channel,
+		Text:    title,
+		Attachments: []slackAttachment{{
+			Color:    severityColors[digest.Severity],
+			Fallback: title,
+			// Leave room in the budget for the rest of the message.
+			Text:   truncateString(digest.Text, s.maxPayload-4<<10),
+			Fields: fields,
+			Ts:     digest.End.Unix(),
+		}},
+	}
+}
+
+// post POSTs data as JSON and expects the want status code.
+func post(ctx context.Context, client *http.Client, url string, data []byte, want int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func testAlert() *types.Alert {
+	return &types.Alert{
+		ID: "alert-1", Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Severity: "HIGH", RuleID: "APSS-004", RuleName: "Shell Spawned",
+		Description: "Interactive shell started in container", EventIDs: []string{"ev-1"},
+		PodName: "web-1", PodNS: "prod", MitreTactic: "Execution", MitreID: "T1059",
+		Actions: []string{"Review pod logs", "Check for unauthorized processes"},
+	}
+}
+
+func TestSlack_Send(t *testing.T) {
+	var got slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	s := NewSlack(srv.URL, "#security-alerts", nil)
+	if err := s.Send(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.Channel != "#security-alerts" || !strings.Contains(got.Text, "[HIGH] APSS-004: Shell Spawned") {
+		t.Errorf("message: channel=%q text=%q", got.Channel, got.Text)
+	}
+	if len(got.Attachments) != 1 {
+		t.Fatalf("attachments = %d, want 1", len(got.Attachments))
+	}
+	att := got.Attachments[0]
+	if att.Color != severityColors["HIGH"] || att.Text != "Interactive shell started in container" || att.Ts != testAlert().Timestamp.Unix() {
+		t.Errorf("attachment = %+v", att)
+	}
+	var pod, actions string
+	for _, f := range att.Fields {
+		switch f.Title {
+		case "Pod":
+			pod = f.Value
+		case "Recommended actions":
+			actions = f.Value
+		case "Playbook":
+			t.Errorf("playbook field %q for an alert without one", f.Value)
+		}
+	}
+	if pod != "prod/web-1" || !strings.Contains(actions, "• Review pod logs\n• Check") {
+		t.Errorf("fields: pod=%q actions=%q", pod, actions)
+	}
+
+	alert := testAlert()
+	alert.Test = true
+	if err := s.Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if !strings.HasPrefix(got.Text, "[TEST] [HIGH] APSS-004") {
+		t.Errorf("test alert text = %q", got.Text)
+	}
+}
+
+func TestSlack_SendPlaybook(t *testing.T) {
+	var got slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	alert := testAlert()
+	alert.Playbook = &types.Playbook{URL: "https://runbooks.example.com/shell", Body: "1. Exec into the pod"}
+	if err := NewSlack(srv.URL, "", nil).Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for _, f := range got.Attachments[0].Fields {
+		if f.Title == "Playbook" {
+			if f.Value != "https://runbooks.example.com/shell\n1. Exec into the pod" {
+				t.Errorf("playbook field = %q", f.Value)
+			}
+			return
+		}
+	}
+	t.Error("no playbook field")
+}
+
+func TestSlack_SendWorkload(t *testing.T) {
+	var got slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	alert := testAlert()
+	alert.Kubernetes = &types.KubeMetadata{
+		OwnerKind: "Deployment", OwnerName: "checkout", Node: "gk3-pool-1",
+		Labels: map[string]string{"team": "payments", "app": "checkout"},
+	}
+	if err := NewSlack(srv.URL, "", nil).Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	fields := map[string]string{}
+	for _, f := range got.Attachments[0].Fields {
+		fields[f.Title] = f.Value
+	}
+	if fields["Workload"] != "deployment=checkout, app=checkout, team=payments" || fields["Node"] != "gk3-pool-1" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestSlack_SendError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	if err := NewSlack(srv.URL, "", nil).Send(context.Background(), testAlert()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("err = %v, want status 403", err)
+	}
+}
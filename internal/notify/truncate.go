@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// Payload budgets bound the request body each sink sends. They sit below
+// the services' documented limits, which reject larger requests outright.
+const (
+	// Slack stops rendering messages well before its 1 MB request limit;
+	// attachment text past ~40,000 characters is dropped.
+	slackMaxPayload = 40 << 10
+	// PagerDuty rejects events over 512 KB.
+	pagerDutyMaxPayload = 512 << 10
+	// Cloud Logging rejects entries over 256 KB.
+	cloudLoggingMaxPayload = 256 << 10
+	// Pub/Sub rejects publish requests over 10 MB.
+	pubSubMaxPayload = 9 << 20
+	// DefaultWebhookMaxPayload is used for webhooks that set no
+	// maxPayloadBytes.
+	DefaultWebhookMaxPayload = 1 << 20
+)
+
+// truncatedMarker ends a string that was shortened to fit a budget.
+const truncatedMarker = "…[truncated]"
+
+// ErrPayloadTooLarge is returned when an alert exceeds a sink's budget even
+// after every truncation step.
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+var truncations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_notification_truncations_total",
+		Help: "Total alert notifications truncated to fit a sink's payload budget, by sink",
+	},
+	[]string{"sink"},
+)
+
+func init() {
+	prometheus.MustRegister(truncations)
+}
+
+// truncationSteps shorten an alert's bulkiest, least essential fields,
+// gentlest first. Each applies on top of the ones before it, so a payload
+// is always cut the same way: the rule, pod, severity and IDs survive every
+// step.
+var truncationSteps = []func(a *types.Alert){
+	func(a *types.Alert) { a.EventIDs = capStrings(a.EventIDs, 20, 0) },
+	func(a *types.Alert) { a.Enrichments = nil },
+	func(a *types.Alert) { setPlaybookBody(a, truncateString(playbookBody(a), 1024)) },
+	func(a *types.Alert) { a.Actions = capStrings(a.Actions, 5, 256) },
+	func(a *types.Alert) { a.Description = truncateString(a.Description, 2048) },
+	func(a *types.Alert) {
+		a.Description = truncateString(a.Description, 256)
+		a.EventIDs = capStrings(a.EventIDs, 1, 0)
+		a.Actions = nil
+		a.Identity = nil
+		setPlaybookBody(a, "")
+	},
+}
+
+// fit renders alert with render and, if the result exceeds budget bytes,
+// applies truncationSteps to a copy of the alert, marked Truncated, until it
+// fits. alert itself is never modified. A budget of zero or less disables
+// the check.
+func fit(sink string, budget int, alert *types.Alert, render func(*types.Alert) ([]byte, error)) ([]byte, error) {
+	data, err := render(alert)
+	if err != nil || budget <= 0 || len(data) <= budget {
+		return data, err
+	}
+	size := len(data)
+	cut := *alert
+	cut.Truncated = true
+	for _, step := range truncationSteps {
+		step(&cut)
+		if data, err = render(&cut); err != nil {
+			return nil, err
+		}
+		if len(data) <= budget {
+			truncations.WithLabelValues(sink).Inc()
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d bytes exceeds the %d byte budget", ErrPayloadTooLarge, size, budget)
+}
+
+// truncateString shortens s to at most n bytes, including truncatedMarker,
+// without splitting a UTF-8 sequence.
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	keep := n - len(truncatedMarker)
+	if keep <= 0 {
+		return truncatedMarker
+	}
+	for keep > 0 && !utf8.RuneStart(s[keep]) {
+		keep--
+	}
+	return s[:keep] + truncatedMarker
+}
+
+// capStrings returns the first max of ss, each shortened to n bytes when n
+// is positive. It copies rather than modifying ss.
+func capStrings(ss []string, max, n int) []string {
+	if len(ss) > max {
+		ss = ss[:max]
+	}
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		if n > 0 {
+			s = truncateString(s, n)
+		}
+		out[i] = s
+	}
+	return out
+}
+
+func playbookBody(a *types.Alert) string {
+	if a.Playbook == nil {
+		return ""
+	}
+	return a.Playbook.Body
+}
+
+// setPlaybookBody replaces the body on a copy of the playbook, which is
+// shared by every alert of the rule.
+func setPlaybookBody(a *types.Alert, body string) {
+	if a.Playbook == nil || a.Playbook.Body == body {
+		return
+	}
+	p := *a.Playbook
+	p.Body = body
+	a.Playbook = &p
+}
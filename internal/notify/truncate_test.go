@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestTruncateString(t *testing.T) {
+	if got := truncateString("short", 10); got != "short" {
+		t.Errorf("short = %q", got)
+	}
+	// "é" is two bytes; a cut inside it backs up to the rune start.
+	s := strings.Repeat("é", 20)
+	got := truncateString(s, len(truncatedMarker)+5)
+	if !utf8.ValidString(got) || got != "éé"+truncatedMarker {
+		t.Errorf("utf-8 = %q", got)
+	}
+	if got := truncateString(s, 3); got != truncatedMarker {
+		t.Errorf("tiny budget = %q", got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	alert := testAlert()
+	alert.Description = strings.Repeat("x", 10000)
+	alert.Playbook = &types.Playbook{URL: "https://runbooks.example.com/shell", Body: strings.Repeat("step\n", 1000)}
+	for i := 0; i < 100; i++ {
+		alert.EventIDs = append(alert.EventIDs, "ev-0000000000")
+	}
+	playbook := alert.Playbook
+	before := testutil.ToFloat64(truncations.WithLabelValues("fit-test"))
+
+	data, err := fit("fit-test", 4096, alert, func(a *types.Alert) ([]byte, error) { return json.Marshal(a) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 4096 {
+		t.Errorf("payload is %d bytes", len(data))
+	}
+	var got types.Alert
+	json.Unmarshal(data, &got)
+	if !got.Truncated || got.ID != alert.ID || got.RuleID != alert.RuleID || got.Playbook.URL != playbook.URL {
+		t.Errorf("truncated alert = %+v", got)
+	}
+	if len(got.EventIDs) != 20 || !strings.HasSuffix(got.Description, truncatedMarker) || len(got.Description) != 2048 {
+		t.Errorf("event ids %d, description %d bytes", len(got.EventIDs), len(got.Description))
+	}
+	// The original alert and its shared playbook are untouched.
+	if alert.Truncated || len(alert.EventIDs) != 101 || len(alert.Description) != 10000 || alert.Playbook != playbook || len(playbook.Body) != 5000 {
+		t.Error("fit modified the alert")
+	}
+	if n := testutil.ToFloat64(truncations.WithLabelValues("fit-test")); n != before+1 {
+		t.Errorf("truncations = %v, want %v", n, before+1)
+	}
+
+	// Alerts within budget are sent as they are.
+	data, _ = fit("fit-test", 1<<20, alert, func(a *types.Alert) ([]byte, error) { return json.Marshal(a) })
+	if strings.Contains(string(data), `"truncated"`) {
+		t.Error("alert within budget marked truncated")
+	}
+
+	if _, err := fit("fit-test", 10, alert, func(a *types.Alert) ([]byte, error) { return json.Marshal(a) }); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("err = %v, want ErrPayloadTooLarge", err)
+	}
+}
+
+func TestWebhook_MaxPayloadBytes(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhook(WebhookConfig{Name: "small", URL: srv.URL, MaxPayloadBytes: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert := testAlert()
+	alert.Description = strings.Repeat("cmdline ", 1000)
+	if err := w.Send(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if len(body) > 2048 || !strings.Contains(string(body), `"truncated":true`) {
+		t.Errorf("body is %d bytes: %.200s", len(body), body)
+	}
+
+	w, _ = NewWebhook(WebhookConfig{Name: "unlimited", URL: srv.URL, MaxPayloadBytes: -1})
+	if err := w.Send(context.Background(), alert); err != nil || strings.Contains(string(body), `"truncated"`) {
+		t.Errorf("unlimited webhook: err = %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+)
+
+// AllSeverities is the default route for webhooks that list no severities.
+var AllSeverities = []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// WebhookConfig describes one generic webhook sink.
+type WebhookConfig struct {
+	// Name identifies the sink in logs and metrics; it must be unique.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Method defaults to POST.
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// ContentType defaults to application/json.
+	ContentType string `json:"contentType,omitempty"`
+	// Body is a Go text/template executed with the *types.Alert. Empty sends
+	// the alert as JSON.
+	Body string `json:"body,omitempty"`
+	// Severities the sink receives; empty means all of them.
+	Severities []string `json:"severities,omitempty"`
+	// Egress sets the proxy and TLS trust used to reach URL.
+	Egress egress.Config `json:"egress,omitempty"`
+	// MaxPayloadBytes bounds the rendered body; larger alerts are
+	// truncated to fit. Zero uses DefaultWebhookMaxPayload and a negative
+	// value disables the limit.
+	MaxPayloadBytes int `json:"maxPayloadBytes,omitempty"`
+	// Digest batches the alerts of its severities into one request per
+	// window; nil sends every alert on its own.
+	Digest *WebhookDigest `json:"digest,omitempty"`
+}
+
+// WebhookDigest configures a webhook's digest mode.
+type WebhookDigest struct {
+	Severities []string `json:"severities"`
+	// Window is a duration such as 15m; empty uses DefaultDigestWindow.
+	Window string `json:"window,omitempty"`
+	// Template renders the digest's text; empty uses
+	// DefaultDigestTemplate.
+	Template string `json:"template,omitempty"`
+	// Body is a Go text/template executed with the *Digest. Empty sends
+	// the digest as JSON.
+	Body string `json:"body,omitempty"`
+}
+
+// WebhooksFile is the layout of the file named by WEBHOOK_SINKS_FILE.
+type WebhooksFile struct {
+	Webhooks []WebhookConfig `json:"webhooks"`
+}
+
+// LoadWebhooks reads webhook sink definitions from a YAML or JSON file.
+// ${VAR} references in URLs, proxy URLs and header values are expanded from
+// the environment, so credentials can be injected from a Secret.
+func LoadWebhooks(file string) ([]WebhookConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var f WebhooksFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i := range f.Webhooks {
+		w := &f.Webhooks[i]
+		if w.Name == "" {
+			return nil, fmt.Errorf("webhook %d: name is required", i)
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("webhook %q: duplicate name", w.Name)
+		}
+		seen[w.Name] = true
+		w.URL = os.ExpandEnv(w.URL)
+		w.Egress.ProxyURL = os.ExpandEnv(w.Egress.ProxyURL)
+		for k, v := range w.Headers {
+			w.Headers[k] = os.ExpandEnv(v)
+		}
+	}
+	return f.Webhooks, nil
+}
+
+// templateFuncs are available in webhook body templates in addition to the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. {{ .Description | json }} for a quoted,
+	// escaped JSON string.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// rfc3339 formats a time.Time or *time.Time; nil renders as "".
+	"rfc3339": func(v interface{}) string {
+		switch t := v.(type) {
+		case time.Time:
+			return t.UTC().Format(time.RFC3339)
+		case *time.Time:
+			if t != nil {
+				return t.UTC().Format(time.RFC3339)
+			}
+		}
+		return ""
+	},
+}
+
+// Webhook sends alerts to an arbitrary HTTP endpoint, rendering the request
+// body from a template.
+type Webhook struct {
+	cfg        WebhookConfig
+	body       *template.Template
+	digest     DigestConfig
+	digestBody *template.Template
+	http       *http.Client
+}
+
+// NewWebhook validates cfg and parses its body template.
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook %q: url is required", cfg.Name)
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+	if cfg.MaxPayloadBytes == 0 {
+		cfg.MaxPayloadBytes = DefaultWebhookMaxPayload
+	}
+	transport, err := cfg.Egress.Transport()
+	if err != nil {
+		return nil, fmt.Errorf("webhook %q: %w", cfg.Name, err)
+	}
+	w := &Webhook{cfg: cfg, http: &http.Client{Transport: transport}}
+	if cfg.Body != "" {
+		tmpl, err := template.New(cfg.Name).Funcs(templateFuncs).Parse(cfg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %q: body template: %w", cfg.Name, err)
+		}
+		w.body = tmpl
+	}
+	if d := cfg.Digest; d != nil {
+		if len(d.Severities) == 0 {
+			return nil, fmt.Errorf("webhook %q: digest needs severities", cfg.Name)
+		}
+		w.digest = DigestConfig{Severities: d.Severities, Template: d.Template}
+		if d.Window != "" {
+			if w.digest.Window, err = time.ParseDuration(d.Window); err != nil || w.digest.Window <= 0 {
+				return nil, fmt.Errorf("webhook %q: invalid digest window %q", cfg.Name, d.Window)
+			}
+		}
+		if _, err := parseDigestTemplate(d.Template); err != nil {
+			return nil, fmt.Errorf("webhook %q: %w", cfg.Name, err)
+		}
+		if d.Body != "" {
+			tmpl, err := template.New(cfg.Name + "-digest").Funcs(templateFuncs).Parse(d.Body)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %q: digest body template: %w", cfg.Name, err)
+			}
+			w.digestBody = tmpl
+		}
+	}
+	return w, nil
+}
+
+// Digest returns the webhook's digest mode and whether it has one.
+func (w *Webhook) Digest() (DigestConfig, bool) {
+	return w.digest, w.cfg.Digest != nil
+}
+
+// Name implements Sink.
+func (w *Webhook) Name() string { return w.cfg.Name }
+
+// Severities returns the alert severities routed to the webhook.
+func (w *Webhook) Severities() []string {
+	if len(w.cfg.Severities) == 0 {
+		return AllSeverities
+	}
+	return w.cfg.Severities
+}
+
+// Render returns the request body for alert.
+func (w *Webhook) Render(alert *types.Alert) ([]byte, error) {
+	if w.body == nil {
+		return json.Marshal(alert)
+	}
+	var buf bytes.Buffer
+	if err := w.body.Execute(&buf, alert); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Send implements Sink. Any 2xx response counts as delivered.
+func (w *Webhook) Send(ctx context.Context, alert *types.Alert) error {
+	body, err := fit(w.Name(), w.cfg.MaxPayloadBytes, alert, w.Render)
+	if errors.Is(err, ErrPayloadTooLarge) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("render body: %w", err)
+	}
+	return w.send(ctx, body)
+}
+
+// SendDigest implements DigestSink.
+func (w *Webhook) SendDigest(ctx context.Context, digest *Digest) error {
+	var body []byte
+	if w.digestBody == nil {
+		var err error
+		if body, err = json.Marshal(digest); err != nil {
+			return err
+		}
+	} else {
+		var buf bytes.Buffer
+		if err := w.digestBody.Execute(&buf, digest); err != nil {
+			return fmt.Errorf("render digest body: %w", err)
+		}
+		body = buf.Bytes()
+	}
+	if w.cfg.MaxPayloadBytes > 0 && len(body) > w.cfg.MaxPayloadBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the %d byte budget", ErrPayloadTooLarge, len(body), w.cfg.MaxPayloadBytes)
+	}
+	return w.send(ctx, body)
+}
+
+func (w *Webhook) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, w.cfg.Method, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.cfg.ContentType)
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
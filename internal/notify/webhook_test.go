@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+)
+
+func TestWebhook_SendTemplate(t *testing.T) {
+	var (
+		method, contentType, auth string
+		body                      []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, contentType, auth = r.Method, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhook(WebhookConfig{
+		Name:    "teams",
+		URL:     srv.URL,
+		Method:  "put",
+		Headers: map[string]string{"Authorization": "Bearer t0k3n"},
+		Body: `{"title": {{ printf "[%s] %s" .Severity .RuleName | json }}, "pod": "{{ .PodNS }}/{{ .PodName }}", ` +
+			`"at": "{{ rfc3339 .Timestamp }}", "occurred": "{{ rfc3339 .OccurredAt }}", "actions": {{ join .Actions "; " | json }}}`,
+	})
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	alert := testAlert()
+	alert.RuleName = `Shell "Spawned"`
+	if err := w.Send(context.Background(), alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if method != http.MethodPut || contentType != "application/json" || auth != "Bearer t0k3n" {
+		t.Errorf("method=%s content-type=%s auth=%s", method, contentType, auth)
+	}
+	want := `{"title": "[HIGH] Shell \"Spawned\"", "pod": "prod/web-1", "at": "2026-01-02T03:04:05Z", "occurred": "", ` +
+		`"actions": "Review pod logs; Check for unauthorized processes"}`
+	if string(body) != want {
+		t.Errorf("body:\n got %s\nwant %s", body, want)
+	}
+}
+
+func TestWebhook_DefaultBodyAndErrors(t *testing.T) {
+	status := http.StatusOK
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhook(WebhookConfig{Name: "raw", URL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	if err := w.Send(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if !strings.Contains(string(body), `"rule_id":"APSS-004"`) {
+		t.Errorf("default body = %s, want the alert as JSON", body)
+	}
+	if got := w.Severities(); len(got) != len(AllSeverities) {
+		t.Errorf("Severities = %v, want all", got)
+	}
+
+	status = http.StatusBadGateway
+	if err := w.Send(context.Background(), testAlert()); err == nil {
+		t.Error("expected error for 502")
+	}
+
+	if _, err := NewWebhook(WebhookConfig{Name: "bad", URL: srv.URL, Body: "{{ .RuleID"}); err == nil {
+		t.Error("expected template parse error")
+	}
+	if _, err := NewWebhook(WebhookConfig{Name: "nourl"}); err == nil {
+		t.Error("expected error for missing url")
+	}
+	w, _ = NewWebhook(WebhookConfig{Name: "typo", URL: srv.URL, Body: "{{ .RuleNmae }}"})
+	if err := w.Send(context.Background(), testAlert()); err == nil {
+		t.Error("expected render error for unknown field")
+	}
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	t.Setenv("JIRA_TOKEN", "s3cret")
+	t.Setenv("PROXY_HOST", "proxy.corp:3128")
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "webhooks.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	got, err := LoadWebhooks(write(`webhooks:
+  - name: jira
+    url: https://jira.example.com/rest/api/2/issue
+    headers:
+      Authorization: Bearer ${JIRA_TOKEN}
+    severities: [HIGH, CRITICAL]
+    egress:
+      proxyURL: http://${PROXY_HOST}
+    body: |
+      {"fields": {"summary": {{ .RuleName | json }}}}
+`))
+	if err != nil {
+		t.Fatalf("LoadWebhooks: %v", err)
+	}
+	if len(got) != 1 || got[0].Headers["Authorization"] != "Bearer s3cret" || len(got[0].Severities) != 2 {
+		t.Errorf("webhooks = %+v", got)
+	}
+	if got[0].Egress.ProxyURL != "http://proxy.corp:3128" {
+		t.Errorf("proxy URL = %q, want it expanded from the environment", got[0].Egress.ProxyURL)
+	}
+	if _, err := NewWebhook(WebhookConfig{Name: "a", URL: "http://x", Egress: egress.Config{ProxyURL: "proxy.corp:3128"}}); err == nil {
+		t.Error("expected an error for a proxy URL without a scheme")
+	}
+
+	for name, content := range map[string]string{
+		"unknown field":  "webhooks:\n  - name: a\n    url: http://x\n    bodyTemplate: x\n",
+		"missing name":   "webhooks:\n  - url: http://x\n",
+		"duplicate name": "webhooks:\n  - {name: a, url: 'http://x'}\n  - {name: a, url: 'http://y'}\n",
+	} {
+		if _, err := LoadWebhooks(write(content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package search is a trigram index for case-insensitive substring search
+// over documents added in increasing ID order and removed oldest first, as
+// the controller retains events.
+package search
+
+import "strings"
+
+// MaxFieldLen caps how much of each field is indexed and matched, so a
+// huge command line does not bloat the index.
+const MaxFieldLen = 1024
+
+// Index maps each trigram to the IDs of the documents containing it, in
+// increasing order. It is not safe for concurrent use.
+type Index struct {
+	postings map[string][]int64
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{postings: make(map[string][]int64)}
+}
+
+// Normalize returns field as it is indexed and matched: lower-cased and cut
+// to MaxFieldLen.
+func Normalize(field string) string {
+	if len(field) > MaxFieldLen {
+		field = field[:MaxFieldLen]
+	}
+	return strings.ToLower(field)
+}
+
+// Terms splits a query into lower-cased, whitespace-separated terms.
+func Terms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// Add indexes the fields of document id, which must be greater than every
+// ID added before.
+func (ix *Index) Add(id int64, fields []string) {
+	for t := range trigrams(fields) {
+		ix.postings[t] = append(ix.postings[t], id)
+	}
+}
+
+// Remove drops document id, the oldest in the index, given the same fields
+// it was added with.
+func (ix *Index) Remove(id int64, fields []string) {
+	for t := range trigrams(fields) {
+		ids := ix.postings[t]
+		if len(ids) == 0 || ids[0] != id {
+			continue
+		}
+		if len(ids) == 1 {
+			delete(ix.postings, t)
+		} else {
+			ix.postings[t] = ids[1:]
+		}
+	}
+}
+
+// Candidates returns the IDs, in increasing order, of documents that may
+// contain every term: a superset of the matches, to be verified against
+// the fields. ok is false when no term is long enough to narrow the search
+// and every document is a candidate.
+func (ix *Index) Candidates(terms []string) (ids []int64, ok bool) {
+	for _, term := range terms {
+		for i := 0; i+3 <= len(term); i++ {
+			list := ix.postings[term[i:i+3]]
+			if !ok {
+				ids, ok = list, true
+			} else {
+				ids = intersect(ids, list)
+			}
+			if len(ids) == 0 {
+				return nil, true
+			}
+		}
+	}
+	return ids, ok
+}
+
+// Match reports whether every term is a substring of one of the normalized
+// fields, and returns the index of the field holding the first term.
+func Match(terms []string, fields []string) (field int, ok bool) {
+	field = -1
+	for _, term := range terms {
+		found := false
+		for i, f := range fields {
+			if strings.Contains(f, term) {
+				if field < 0 {
+					field = i
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return -1, false
+		}
+	}
+	return field, true
+}
+
+func trigrams(fields []string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, f := range fields {
+		for i := 0; i+3 <= len(f); i++ {
+			set[f[i:i+3]] = struct{}{}
+		}
+	}
+	return set
+}
+
+func intersect(a, b []int64) []int64 {
+	var out []int64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
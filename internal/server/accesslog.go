@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// latencyWindow is how many recent request durations the slow request
+	// threshold is taken from when AccessLogSlow is not set.
+	latencyWindow = 1024
+	// latencyRecompute is how many requests pass between recomputing it.
+	latencyRecompute = 128
+	// minSlowRequest keeps requests faster than this from being logged as
+	// slow, however fast the rest are.
+	minSlowRequest = 100 * time.Millisecond
+)
+
+// streamingPaths respond for as long as the client stays connected, so
+// their duration says nothing about how slow the controller is.
+var streamingPaths = map[string]bool{
+	"/api/v1/alerts/stream": true,
+	"/api/v1/export":        true,
+}
+
+type accessKey struct{}
+
+// accessRecord is what the access log knows of a request beyond the
+// request itself.
+type accessRecord struct {
+	mu      sync.Mutex
+	agentID string
+}
+
+// noteAgent records which agent sent r, as decoded from its body, for the
+// access log.
+func noteAgent(r *http.Request, id string) {
+	if rec, ok := r.Context().Value(accessKey{}).(*accessRecord); ok && id != "" {
+		rec.mu.Lock()
+		if rec.agentID == "" {
+			rec.agentID = id
+		}
+		rec.mu.Unlock()
+	}
+}
+
+// latencies keeps the durations of recent requests and their p99.
+type latencies struct {
+	mu     sync.Mutex
+	ring   []time.Duration
+	next   int
+	since  int
+	p99    time.Duration
+	static time.Duration
+}
+
+// slow records d and reports whether it is slower than the threshold:
+// static when set, or else the p99 of recent requests.
+func (l *latencies) slow(d time.Duration) bool {
+	if l.static > 0 {
+		return d > l.static
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.ring) < latencyWindow {
+		l.ring = append(l.ring, d)
+	} else {
+		l.ring[l.next] = d
+		l.next = (l.next + 1) % latencyWindow
+	}
+	if l.since++; l.since >= latencyRecompute {
+		l.since = 0
+		sorted := append([]time.Duration(nil), l.ring...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		l.p99 = sorted[len(sorted)*99/100]
+	}
+	// Until enough requests are seen there is no p99 to go by.
+	return l.p99 > 0 && d > l.p99 && d >= minSlowRequest
+}
+
+// accessLog logs a sample of AccessLogSample of requests, and every failed
+// or slow one, with their size and duration and the agent that sent them.
+// 404s are logged only in the sample, as agents get them polling for
+// features that are off. Streaming responses are never slow.
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	lat := &latencies{static: s.cfg.AccessLogSlow}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &accessRecord{}
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, rec))
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		aw := &accessWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(aw, r)
+		elapsed := time.Since(start)
+
+		slow := !streamingPaths[r.URL.Path] && lat.slow(elapsed)
+		failed := aw.status >= 400 && aw.status != http.StatusNotFound
+		if !slow && !failed && (s.cfg.AccessLogSample <= 0 || rand.Float64() >= s.cfg.AccessLogSample) {
+			return
+		}
+		size := r.ContentLength
+		if size < 0 {
+			size = body.n
+		}
+		remote := remoteIP(r)
+		rec.mu.Lock()
+		agentID := rec.agentID
+		rec.mu.Unlock()
+		if agentID == "" {
+			agentID = s.controller.AgentByIP(remote)
+		}
+		fields := logrus.Fields{
+			"method":         r.Method,
+			"path":           r.URL.Path,
+			"status":         aw.status,
+			"duration_ms":    float64(elapsed.Microseconds()) / 1000,
+			"request_bytes":  size,
+			"response_bytes": aw.written,
+			"remote":         remote,
+		}
+		if agentID != "" {
+			fields["agent_id"] = agentID
+		}
+		entry := s.log.WithFields(fields)
+		switch {
+		case aw.status >= 500:
+			entry.Warn("HTTP request failed")
+		case slow:
+			entry.Warn("Slow HTTP request")
+		case failed:
+			entry.Info("HTTP request rejected")
+		default:
+			entry.Info("HTTP request")
+		}
+	})
+}
+
+// remoteIP is the IP address r came from.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// accessWriter records the status and size of a response.
+type accessWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	written     int64
+}
+
+func (w *accessWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush lets alert streams and exports flush through the access log.
+func (w *accessWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_AccessLog(t *testing.T) {
+	serve := func(cfg config.ControllerConfig, req *http.Request) *test.Hook {
+		t.Helper()
+		log, hook := test.NewNullLogger()
+		cfg.EventBufferSize, cfg.AlertBufferSize = 10, 10
+		ctrl := controller.New(cfg, log)
+		ctrl.RegisterAgent(&types.AgentRegistration{AgentID: "agent-1", PodIP: "10.0.0.5"})
+		srv := New(cfg, ctrl, log)
+		hook.Reset()
+		srv.httpServer.Handler.ServeHTTP(httptest.NewRecorder(), req)
+		return hook
+	}
+	health := func() *http.Request { return httptest.NewRequest(http.MethodGet, "/health", nil) }
+
+	// A malformed event is logged with the agent its pod IP belongs to.
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(`{"id":`))
+	req.RemoteAddr = "10.0.0.5:41234"
+	hook := serve(config.ControllerConfig{}, req)
+	if e := hook.LastEntry(); e == nil || e.Message != "HTTP request rejected" || e.Data["agent_id"] != "agent-1" ||
+		e.Data["status"] != http.StatusBadRequest || e.Data["request_bytes"] != int64(6) {
+		t.Errorf("rejected request entry = %+v", e)
+	}
+	// An event names its agent.
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(`{"id":"e","agent_id":"agent-2"}`))
+	hook = serve(config.ControllerConfig{AccessLogSample: 1}, req)
+	if e := hook.LastEntry(); e == nil || e.Message != "HTTP request" || e.Data["agent_id"] != "agent-2" {
+		t.Errorf("sampled request entry = %+v", e)
+	}
+
+	if hook := serve(config.ControllerConfig{}, health()); len(hook.AllEntries()) != 0 {
+		t.Errorf("unsampled request logged: %+v", hook.LastEntry())
+	}
+	if e := serve(config.ControllerConfig{AccessLogSlow: time.Nanosecond}, health()).LastEntry(); e == nil || e.Message != "Slow HTTP request" {
+		t.Errorf("slow request entry = %+v", e)
+	}
+}
+
+func TestLatencies_P99(t *testing.T) {
+	var l latencies
+	for i := 0; i < latencyRecompute-2; i++ {
+		l.slow(time.Second)
+	}
+	if l.slow(time.Hour) {
+		t.Error("slow before a p99 was known")
+	}
+	for i := 0; i < latencyWindow; i++ {
+		l.slow(time.Duration(i%100+1) * 10 * time.Millisecond)
+	}
+	if l.p99 < 980*time.Millisecond || l.p99 > time.Second || l.slow(500*time.Millisecond) || !l.slow(2*time.Second) {
+		t.Errorf("p99 = %s", l.p99)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// handleAgentConfig reads (GET) or replaces (PUT) the runtime config pushed
+// to all agents.
+func (s *Server) handleAgentConfig(w http.ResponseWriter, r *http.Request) {
+	var (
+		cfg *types.AgentRuntimeConfig
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err = s.controller.AgentConfig()
+	case http.MethodPut:
+		var update types.AgentRuntimeConfig
+		if err := json.NewDecoder(s.limitBody(w, r)).Decode(&update); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		cfg, err = s.controller.SetAgentConfig(update)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case errors.Is(err, controller.ErrNoAgentConfig):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrInvalidAgentConfig):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", configETag(cfg))
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// handleAgent serves per-agent resources under /api/v1/agents/{id}/: the
+// pushed config, the YARA rules, the brownout and the workload's file
+// baseline. Agents poll GET .../config, .../yara and .../brownout with
+// If-None-Match set to the ETag of what they last applied and get 304 when
+// nothing changed.
+func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/agents/")
+	id, resource, ok := strings.Cut(rest, "/")
+	switch {
+	case !ok || id == "":
+		http.NotFound(w, r)
+		return
+	case resource == "baseline":
+		s.handleAgentBaseline(w, r, id)
+		return
+	case resource == "yara":
+		s.handleAgentYara(w, r)
+		return
+	case resource == "brownout":
+		s.handleAgentBrownout(w, r)
+		return
+	case resource != "config":
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, err := s.controller.AgentConfig()
+	if errors.Is(err, controller.ErrNoAgentConfig) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	etag := configETag(cfg)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// configETag is a hash of the config, so it changes with the config and
+// not with the revision counter alone.
+func configETag(cfg *types.AgentRuntimeConfig) string {
+	data, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// handleAgentYara serves the YARA rule source agents scan files with.
+func (s *Server) handleAgentYara(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	source, etag, err := s.controller.YaraRules()
+	if errors.Is(err, controller.ErrNoYaraRules) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", etag)
+	w.Write(source)
+}
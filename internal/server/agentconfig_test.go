@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// TestServer_AgentConfigETag_Restart checks that an agent holding the ETag
+// of a config from before a restart gets the new config, though both are
+// revision 1.
+func TestServer_AgentConfigETag_Restart(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}
+	poll := func(ctrl *controller.Controller, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/agents/agent-1/config", nil)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		New(cfg, ctrl, log).httpServer.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	before := controller.New(cfg, log)
+	if _, err := before.SetAgentConfig(types.AgentRuntimeConfig{SuspiciousPorts: []int{4444}}); err != nil {
+		t.Fatal(err)
+	}
+	etag := poll(before, "").Header().Get("ETag")
+	after := controller.New(cfg, log)
+	if _, err := after.SetAgentConfig(types.AgentRuntimeConfig{SuspiciousPorts: []int{5555}}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := poll(after, etag); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "5555") {
+		t.Errorf("poll with the ETag from before the restart: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServer_AgentConfigPush(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	srv := New(cfg, controller.New(cfg, log), log)
+	h := srv.httpServer.Handler
+
+	do := func(method, path, body, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/api/v1/agents/agent-1/config", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("poll before any config: status %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/v1/agents/config", `{"suspicious_ports":[0]}`, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT invalid config: status %d", rec.Code)
+	}
+	rec := do(http.MethodPut, "/api/v1/agents/config", `{"suspicious_processes":["xmrig"],"suspicious_ports":[4444]}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT config: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, "/api/v1/agents/agent-1/config", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("poll config: status %d", rec.Code)
+	}
+	var got types.AgentRuntimeConfig
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Revision != 1 || len(got.SuspiciousProcesses) != 1 || got.WatchPaths != nil {
+		t.Errorf("config = %+v", got)
+	}
+	etag := rec.Header().Get("ETag")
+	if rec := do(http.MethodGet, "/api/v1/agents/agent-1/config", "", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("poll with current ETag: status %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/agents/agent-1/config", "", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST agent config: status %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/agents/agent-1/other", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown agent resource: status %d", rec.Code)
+	}
+}
+
+func TestServer_AgentYaraRules(t *testing.T) {
+	log := logrus.New()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "miners.yar"), []byte(`rule xmrig { strings: $a = "xmrig" condition: $a }`), 0o600)
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, YaraRulesDir: dir}
+	h := New(cfg, controller.New(cfg, log), log).httpServer.Handler
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/agents/agent-1/yara", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "rule xmrig") || rec.Header().Get("ETag") == "" {
+		t.Fatalf("GET yara: status %d, etag %q: %s", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/agents/agent-1/yara", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("GET yara with current ETag: status %d", rec.Code)
+	}
+
+	cfg.YaraRulesDir = ""
+	h = New(cfg, controller.New(cfg, log), log).httpServer.Handler
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/agents/agent-1/yara", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET yara without rules: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/storage"
+)
+
+// handleAudit lists the stored audit log, oldest first. Query parameters:
+// since (RFC 3339) and limit, which keeps the newest entries.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid since %q", v), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	limit := defaultAlertLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAlertLimit)
+	}
+	entries, err := s.controller.AuditLog(r.Context(), since, limit)
+	switch {
+	case errors.Is(err, controller.ErrStorageDisabled):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleStorageMigrations reports the storage schema version and the
+// migrations applied.
+func (s *Server) handleStorageMigrations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := s.controller.StorageMigrations(r.Context())
+	switch {
+	case errors.Is(err, controller.ErrStorageDisabled), errors.Is(err, storage.ErrNoMigrations):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+func TestServer_Audit(t *testing.T) {
+	log := logrus.New()
+	get := func(cfg config.ControllerConfig, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		New(cfg, controller.New(cfg, log), log).httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	if rec := get(cfg, "/api/v1/audit"); rec.Code != http.StatusNotFound {
+		t.Errorf("without storage: status %d", rec.Code)
+	}
+	cfg.StorageBackend = "memory"
+	// Only Postgres has a schema to migrate.
+	if rec := get(cfg, "/api/v1/storage/migrations"); rec.Code != http.StatusNotFound {
+		t.Errorf("memory migrations: status %d", rec.Code)
+	}
+	for _, q := range []string{"since=yesterday", "limit=0"} {
+		if rec := get(cfg, "/api/v1/audit?"+q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", q, rec.Code)
+		}
+	}
+	if rec := get(cfg, "/api/v1/audit?since=2026-01-01T00:00:00Z&limit=5"); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("audit: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+// publicPaths are served without authentication (probes and Prometheus scrapes).
+var publicPaths = map[string]bool{
+	"/health":  true,
+	"/metrics": true,
+}
+
+// agentRoutes are the only method+path pairs agent tokens may call, with
+// agentResources. Operator tokens may call everything.
+var agentRoutes = map[string]bool{
+	http.MethodPost + " /api/v1/events":           true,
+	http.MethodPost + " /api/v1/events/batch":     true,
+	http.MethodPost + " /api/v1/agents/register":  true,
+	http.MethodPost + " /api/v1/agents/heartbeat": true,
+	http.MethodPost + " /api/v1/agents/handshake": true,
+	http.MethodGet + " /api/v1/routing":           true,
+}
+
+// agentResources are the method+resource pairs under
+// /api/v1/agents/{id}/ agent tokens may call: polling pushed config, YARA
+// rules and brownouts, and fetching or offering the agent's file baseline.
+var agentResources = map[string]bool{
+	http.MethodGet + " config":    true,
+	http.MethodGet + " yara":      true,
+	http.MethodGet + " brownout":  true,
+	http.MethodGet + " baseline":  true,
+	http.MethodPost + " baseline": true,
+}
+
+// integrationRoutes are the only method+path pairs integration tokens may
+// call: inbound callbacks from third-party services and edge controller
+// federation reports.
+var integrationRoutes = map[string]bool{
+	http.MethodPost + " /api/v1/integrations/sweetsecurity/enrichments": true,
+	http.MethodPost + " /api/v1/federation":                             true,
+}
+
+// agentKey marks the context of a request made with an agent token.
+type agentKey struct{}
+
+// agentCaller reports whether r was made with an agent token, which may
+// name any agent and so must be checked against the agent it acts for.
+func agentCaller(r *http.Request) bool {
+	return r.Context().Value(agentKey{}) != nil
+}
+
+// isAgentRoute reports whether an agent token may make request r: the fixed
+// agentRoutes, or an agentResources pair at exactly
+// /api/v1/agents/{id}/{resource}.
+func isAgentRoute(r *http.Request) bool {
+	if agentRoutes[r.Method+" "+r.URL.Path] {
+		return true
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/agents/")
+	if !ok {
+		return false
+	}
+	id, resource, ok := strings.Cut(rest, "/")
+	return ok && id != "" && agentResources[r.Method+" "+resource]
+}
+
+// verifyAgent checks that a request made with an agent token comes from
+// the pod of agent id, the agent it acts for. Other callers may act for
+// any agent.
+func (s *Server) verifyAgent(r *http.Request, id string) error {
+	if !agentCaller(r) {
+		return nil
+	}
+	return s.controller.VerifyAgentPod(id, s.callerIP(r))
+}
+
+// verifyRegistration is verifyAgent for a request that registers agent id,
+// or heartbeats for it, as running in pod ns/name with podIP.
+func (s *Server) verifyRegistration(r *http.Request, id, ns, name, podIP string) error {
+	if !agentCaller(r) {
+		return nil
+	}
+	return s.controller.VerifyRegistration(id, ns, name, podIP, s.callerIP(r))
+}
+
+// rejectAgent answers a request verifyAgent refused.
+func (s *Server) rejectAgent(w http.ResponseWriter, r *http.Request, err error) {
+	status, msg := s.agentRejection(w, r, err)
+	http.Error(w, msg, status)
+}
+
+// agentRejection returns the status and message for a request verifyAgent
+// refused. An agent the controller does not know yet gets a 503 to retry
+// once it has heartbeated; one acting for another agent gets a 403.
+func (s *Server) agentRejection(w http.ResponseWriter, r *http.Request, err error) (int, string) {
+	if errors.Is(err, controller.ErrAgentNotRegistered) {
+		w.Header().Set("Retry-After", "5")
+		return http.StatusServiceUnavailable, "agent not registered; retry after its next heartbeat"
+	}
+	s.log.WithError(err).WithFields(logrus.Fields{"path": r.URL.Path, "remote": r.RemoteAddr}).Warn("Rejected agent request for another agent")
+	return http.StatusForbidden, "request does not come from the agent's pod"
+}
+
+// tokenFile is a set of bearer tokens read from a file (one per line, '#'
+// comments allowed), typically a mounted Secret. The file is re-read when its
+// modification time or size changes so rotated Secrets take effect without a
+// restart.
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	hashes  [][sha256.Size]byte
+}
+
+func (f *tokenFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("stat token file %s: %w", f.path, err)
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("read token file %s: %w", f.path, err)
+	}
+	var hashes [][sha256.Size]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hashes = append(hashes, sha256.Sum256([]byte(line)))
+	}
+	f.hashes, f.modTime, f.size = hashes, info.ModTime(), info.Size()
+	return nil
+}
+
+// contains reports whether token is in the file. Comparison is constant-time
+// over hashed tokens so timing does not leak token contents or lengths.
+func (f *tokenFile) contains(token string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.reload()
+	sum := sha256.Sum256([]byte(token))
+	found := 0
+	for _, h := range f.hashes {
+		found |= subtle.ConstantTimeCompare(sum[:], h[:])
+	}
+	return found == 1, err
+}
+
+// authenticator enforces bearer-token auth with agent, operator and
+// integration roles.
+type authenticator struct {
+	agent       *tokenFile
+	operator    *tokenFile
+	integration *tokenFile
+	log         *logrus.Logger
+}
+
+// newAuthenticator returns nil when no token files are configured, which
+// leaves the API unauthenticated.
+func newAuthenticator(agentFile, operatorFile, integrationFile string, log *logrus.Logger) *authenticator {
+	if agentFile == "" && operatorFile == "" && integrationFile == "" {
+		return nil
+	}
+	a := &authenticator{log: log}
+	if agentFile != "" {
+		a.agent = &tokenFile{path: agentFile}
+	}
+	if operatorFile != "" {
+		a.operator = &tokenFile{path: operatorFile}
+	}
+	if integrationFile != "" {
+		a.integration = &tokenFile{path: integrationFile}
+	}
+	return a
+}
+
+func (a *authenticator) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := bearerToken(r)
+		if !ok {
+			unauthorized(w)
+			return
+		}
+		if a.match(a.operator, token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.match(a.agent, token) {
+			if isAgentRoute(r) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), agentKey{}, true)))
+				return
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if a.match(a.integration, token) {
+			if integrationRoutes[r.Method+" "+r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		a.log.WithFields(logrus.Fields{"path": r.URL.Path, "remote": r.RemoteAddr}).Warn("Rejected request with invalid token")
+		unauthorized(w)
+	})
+}
+
+func (a *authenticator) match(f *tokenFile, token string) bool {
+	if f == nil {
+		return false
+	}
+	ok, err := f.contains(token)
+	if err != nil {
+		a.log.WithError(err).Error("Failed to load API tokens")
+	}
+	return ok
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="apss"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
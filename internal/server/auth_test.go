@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+func writeTokens(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write tokens: %v", err)
+	}
+	return path
+}
+
+func TestAuthenticator_Roles(t *testing.T) {
+	dir := t.TempDir()
+	agentFile := writeTokens(t, dir, "agent", "# agent tokens\nagent-secret\n")
+	operatorFile := writeTokens(t, dir, "operator", "operator-secret\n")
+	integrationFile := writeTokens(t, dir, "integration", "sweet-secret\n")
+	auth := newAuthenticator(agentFile, operatorFile, integrationFile, logrus.New())
+	handler := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name, method, path, token string
+		want                      int
+	}{
+		{"health is public", http.MethodGet, "/health", "", http.StatusOK},
+		{"metrics is public", http.MethodGet, "/metrics", "", http.StatusOK},
+		{"no token", http.MethodGet, "/api/v1/alerts", "", http.StatusUnauthorized},
+		{"bad token", http.MethodPost, "/api/v1/events", "nope", http.StatusUnauthorized},
+		{"agent posts events", http.MethodPost, "/api/v1/events", "agent-secret", http.StatusOK},
+		{"agent posts event batches", http.MethodPost, "/api/v1/events/batch", "agent-secret", http.StatusOK},
+		{"agent heartbeat", http.MethodPost, "/api/v1/agents/heartbeat", "agent-secret", http.StatusOK},
+		{"agent polls its config", http.MethodGet, "/api/v1/agents/agent-1/config", "agent-secret", http.StatusOK},
+		{"agent polls YARA rules", http.MethodGet, "/api/v1/agents/agent-1/yara", "agent-secret", http.StatusOK},
+		{"agent polls the brownout", http.MethodGet, "/api/v1/agents/agent-1/brownout", "agent-secret", http.StatusOK},
+		{"agent cannot push config", http.MethodPut, "/api/v1/agents/config", "agent-secret", http.StatusForbidden},
+		{"agent cannot start a brownout", http.MethodPut, "/api/v1/brownout", "agent-secret", http.StatusForbidden},
+		{"agent offers its baseline", http.MethodPost, "/api/v1/agents/agent-1/baseline", "agent-secret", http.StatusOK},
+		{"agent cannot poll nested paths", http.MethodGet, "/api/v1/agents/x/y/config", "agent-secret", http.StatusForbidden},
+		{"agent cannot poll without an ID", http.MethodGet, "/api/v1/agents//config", "agent-secret", http.StatusForbidden},
+		{"agent cannot post its config", http.MethodPost, "/api/v1/agents/agent-1/config", "agent-secret", http.StatusForbidden},
+		{"agent cannot import baselines", http.MethodPut, "/api/v1/baselines/ns/api", "agent-secret", http.StatusForbidden},
+		{"agent cannot read alerts", http.MethodGet, "/api/v1/alerts", "agent-secret", http.StatusForbidden},
+		{"agent cannot read events", http.MethodGet, "/api/v1/events", "agent-secret", http.StatusForbidden},
+		{"operator reads alerts", http.MethodGet, "/api/v1/alerts", "operator-secret", http.StatusOK},
+		{"operator patches alerts", http.MethodPatch, "/api/v1/alerts/a1", "operator-secret", http.StatusOK},
+		{"integration posts enrichments", http.MethodPost, "/api/v1/integrations/sweetsecurity/enrichments", "sweet-secret", http.StatusOK},
+		{"integration cannot read alerts", http.MethodGet, "/api/v1/alerts", "sweet-secret", http.StatusForbidden},
+		{"agent cannot post enrichments", http.MethodPost, "/api/v1/integrations/sweetsecurity/enrichments", "agent-secret", http.StatusForbidden},
+		{"integration posts federation reports", http.MethodPost, "/api/v1/federation", "sweet-secret", http.StatusOK},
+		{"integration cannot read federated alerts", http.MethodGet, "/api/v1/federation/alerts", "sweet-secret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_AgentTokenBoundToPod(t *testing.T) {
+	dir := t.TempDir()
+	log := logrus.New()
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10,
+		AgentTokensFile: writeTokens(t, dir, "agent", "agent-secret\n"),
+	}
+	srv := New(cfg, controller.New(cfg, log), log)
+	do := func(path, remote, body string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer agent-secret")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		req.RemoteAddr = remote + ":40000"
+		rec := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	event := func(agent string) string {
+		return `{"id":"ev-` + agent + `","agent_id":"` + agent + `","type":"process_start","severity":"INFO"}`
+	}
+
+	for _, tc := range []struct {
+		name, path, remote, body string
+		want                     int
+	}{
+		{"agent registers", "/api/v1/agents/register", "10.0.0.5",
+			`{"agent_id":"a1","pod_name":"api-0","pod_namespace":"shop","pod_ip":"10.0.0.5"}`, http.StatusNoContent},
+		{"agent registers another pod's IP", "/api/v1/agents/register", "10.0.0.6",
+			`{"agent_id":"a2","pod_name":"web-0","pod_namespace":"shop","pod_ip":"10.0.0.5"}`, http.StatusForbidden},
+		{"pod takes over a registered agent", "/api/v1/agents/register", "10.0.0.6",
+			`{"agent_id":"a1","pod_name":"web-0","pod_namespace":"shop","pod_ip":"10.0.0.6"}`, http.StatusForbidden},
+		{"agent posts its events", "/api/v1/events", "10.0.0.5", event("a1"), http.StatusAccepted},
+		{"pod posts another agent's events", "/api/v1/events", "10.0.0.6", event("a1"), http.StatusForbidden},
+		{"unregistered agent posts events", "/api/v1/events", "10.0.0.7", event("a3"), http.StatusServiceUnavailable},
+		{"pod heartbeats for another agent", "/api/v1/agents/heartbeat", "10.0.0.6",
+			`{"agent_id":"a1","pod_name":"api-0","pod_namespace":"shop","pod_ip":"10.0.0.6"}`, http.StatusForbidden},
+		{"lost agent heartbeats", "/api/v1/agents/heartbeat", "10.0.0.8",
+			`{"agent_id":"a4","pod_name":"db-0","pod_namespace":"shop","pod_ip":"10.0.0.8"}`, http.StatusNoContent},
+		{"lost agent posts events", "/api/v1/events", "10.0.0.8", event("a4"), http.StatusAccepted},
+		{"new agent handshakes", "/api/v1/agents/handshake", "10.0.0.9",
+			`{"agent_id":"a5","protocol_versions":[1],"schema_versions":["v1"]}`, http.StatusOK},
+		{"pod handshakes for another agent", "/api/v1/agents/handshake", "10.0.0.6",
+			`{"agent_id":"a1","protocol_versions":[1],"schema_versions":["v1"]}`, http.StatusForbidden},
+	} {
+		if rec := do(tc.path, tc.remote, tc.body); rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+
+	// Only another replica is believed about the agent's IP.
+	if rec := do("/api/v1/events", "10.0.0.6", event("a1"), headerForwardedBy, "ctl-0", headerCallerIP, "10.0.0.5"); rec.Code != http.StatusForbidden {
+		t.Errorf("agent IP from a non-replica: status %d", rec.Code)
+	}
+
+	// A batch stops at the first event of another agent.
+	rec := do("/api/v1/events/batch", "10.0.0.5", "["+event("a1")+","+event("a4")+"]")
+	var res batchResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || rec.Code != http.StatusForbidden || res.Accepted != 1 {
+		t.Errorf("batch with another agent's event: status %d, %+v, %v", rec.Code, res, err)
+	}
+}
+
+func TestTokenFile_ReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTokens(t, dir, "operator", "old-token\n")
+	f := &tokenFile{path: path}
+	if ok, err := f.contains("old-token"); !ok || err != nil {
+		t.Fatalf("old-token: ok=%v err=%v", ok, err)
+	}
+
+	writeTokens(t, dir, "operator", "rotated-token\n")
+	// Ensure a distinct mtime even on coarse-grained filesystems.
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(path, future, future)
+	if ok, _ := f.contains("old-token"); ok {
+		t.Error("old-token should be rejected after rotation")
+	}
+	if ok, _ := f.contains("rotated-token"); !ok {
+		t.Error("rotated-token should be accepted after rotation")
+	}
+}
+
+func TestNewAuthenticator_Disabled(t *testing.T) {
+	if newAuthenticator("", "", "", logrus.New()) != nil {
+		t.Error("authenticator should be nil when no token files are configured")
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+// handleAgentBaseline serves an agent its workload's signed file baseline on
+// GET and takes the agent's startup hashes as the baseline on POST when the
+// workload has none, answering 409 when it does. With an agent token, the
+// request must come from agent id's pod, so one compromised pod cannot read
+// or seed the baselines of other workloads.
+func (s *Server) handleAgentBaseline(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.verifyAgent(r, id); err != nil {
+		s.rejectAgent(w, r, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		b, err := s.controller.AgentBaseline(id)
+		s.writeBaseline(w, http.StatusOK, b, err)
+	case http.MethodPost:
+		var b fileintegrity.Baseline
+		if err := json.NewDecoder(s.limitBody(w, r)).Decode(&b); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		stored, err := s.controller.OfferBaseline(id, b)
+		s.writeBaseline(w, http.StatusCreated, stored, err)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBaselines lists the stored file baselines.
+func (s *Server) handleBaselines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.controller.GetBaselines())
+}
+
+// handleBaseline reads (GET), imports (PUT) or deletes (DELETE) the file
+// baseline of a workload at /api/v1/baselines/{namespace}/{workload}.
+func (s *Server) handleBaseline(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/api/v1/baselines/")
+	if ns, name, ok := strings.Cut(key, "/"); !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		b, err := s.controller.GetBaseline(key)
+		s.writeBaseline(w, http.StatusOK, b, err)
+	case http.MethodPut:
+		var b fileintegrity.Baseline
+		if err := json.NewDecoder(s.limitBody(w, r)).Decode(&b); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		stored, err := s.controller.ImportBaseline(key, b)
+		s.writeBaseline(w, http.StatusOK, stored, err)
+	case http.MethodDelete:
+		if err := s.controller.DeleteBaseline(key); errors.Is(err, controller.ErrBaselineNotFound) {
+			http.Error(w, "Baseline not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeBaseline(w http.ResponseWriter, status int, b *fileintegrity.Baseline, err error) {
+	switch {
+	case errors.Is(err, controller.ErrBaselinesDisabled), errors.Is(err, controller.ErrBaselineNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrBaselineExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, controller.ErrInvalidBaseline):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(b)
+}
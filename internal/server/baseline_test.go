@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+func TestServer_Baselines(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	keyFile := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, FileBaselineSigningKeyFile: keyFile}
+	ctrl := controller.New(cfg, log)
+	if err := ctrl.RegisterAgent(&types.AgentRegistration{AgentID: "a1", PodName: "api-0", PodNamespace: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(cfg, ctrl, log)
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		rec := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, &buf))
+		return rec
+	}
+	offered := fileintegrity.Baseline{
+		Version: fileintegrity.BaselineVersion,
+		Files:   []fileintegrity.BaselineFile{{Path: "/etc/passwd", Hash: "aaa", Mode: 0o644}},
+	}
+
+	if rec := do(http.MethodGet, "/api/v1/agents/a1/baseline", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET before offer: status %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/agents/a1/baseline", offered); rec.Code != http.StatusCreated {
+		t.Fatalf("POST offer: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/api/v1/agents/a1/baseline", offered); rec.Code != http.StatusConflict {
+		t.Errorf("second POST: status %d, want 409", rec.Code)
+	}
+	rec := do(http.MethodGet, "/api/v1/agents/a1/baseline", nil)
+	var got fileintegrity.Baseline
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got.Key != "shop/api" || got.Verify(pub) != nil {
+		t.Fatalf("GET baseline = %+v, err %v", got, err)
+	}
+
+	offered.Files[0].Hash = "bbb"
+	if rec := do(http.MethodPut, "/api/v1/baselines/shop/api", offered); rec.Code != http.StatusOK {
+		t.Fatalf("PUT import: status %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = do(http.MethodGet, "/api/v1/baselines", nil)
+	var list []fileintegrity.Baseline
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list) != 1 || list[0].Source != "import" || list[0].Files[0].Hash != "bbb" {
+		t.Fatalf("GET baselines = %+v, err %v", list, err)
+	}
+	if rec := do(http.MethodPut, "/api/v1/baselines/shop", offered); rec.Code != http.StatusNotFound {
+		t.Errorf("PUT without workload: status %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/baselines/shop/api", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: status %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/baselines/shop/api", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after delete: status %d", rec.Code)
+	}
+}
+
+func TestServer_AgentBaseline_OtherPod(t *testing.T) {
+	dir := t.TempDir()
+	_, priv, _ := ed25519.GenerateKey(nil)
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	keyFile := filepath.Join(dir, "signing.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	log := logrus.New()
+	cfg := config.ControllerConfig{
+		EventBufferSize: 10, AlertBufferSize: 10, FileBaselineSigningKeyFile: keyFile,
+		AgentTokensFile:    writeTokens(t, dir, "agent", "agent-secret\n"),
+		OperatorTokensFile: writeTokens(t, dir, "operator", "operator-secret\n"),
+	}
+	ctrl := controller.New(cfg, log)
+	if err := ctrl.RegisterAgent(&types.AgentRegistration{AgentID: "a1", PodName: "api-0", PodNamespace: "shop", PodIP: "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(cfg, ctrl, log)
+
+	for _, tc := range []struct {
+		name, method, token, remote string
+		want                        int
+	}{
+		{"agent's own pod", http.MethodGet, "agent-secret", "10.0.0.5", http.StatusNotFound},
+		{"another pod reads", http.MethodGet, "agent-secret", "10.0.0.6", http.StatusForbidden},
+		{"another pod seeds", http.MethodPost, "agent-secret", "10.0.0.6", http.StatusForbidden},
+		{"operator", http.MethodGet, "operator-secret", "10.9.9.9", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(tc.method, "/api/v1/agents/a1/baseline", bytes.NewBufferString(`{}`))
+		req.RemoteAddr = tc.remote + ":40000"
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rec := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
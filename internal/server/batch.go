@@ -0,0 +1,171 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// batchResult is the response to an event batch. Events are ingested as
+// they are decoded, so a batch stopped part way still has its first
+// Accepted events queued; the sender should resend only the rest.
+type batchResult struct {
+	Accepted int    `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// handleEventBatch ingests a JSON array of events. The array is decoded one
+// event at a time, so memory use is bounded by the largest event rather
+// than the whole batch.
+func (s *Server) handleEventBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := s.eventBody(w, r)
+	if err != nil {
+		status, msg := s.bodyError(err)
+		writeBatchResult(w, status, batchResult{Error: msg})
+		return
+	}
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		status, msg := http.StatusBadRequest, "request body must be a JSON array of events"
+		if errors.As(err, new(*http.MaxBytesError)) {
+			status, msg = s.bodyError(err)
+		}
+		writeBatchResult(w, status, batchResult{Error: msg})
+		return
+	}
+
+	ctx := controller.WithCaller(r.Context(), s.callerIP(r))
+	var (
+		res batchResult
+		// Batches come from one agent, verified once.
+		verified string
+		checked  bool
+	)
+	for dec.More() {
+		if s.cfg.MaxBatchEvents > 0 && res.Accepted == s.cfg.MaxBatchEvents {
+			res.Error = fmt.Sprintf("batch has more than %d events; send at most %d per request (MAX_BATCH_EVENTS)",
+				s.cfg.MaxBatchEvents, s.cfg.MaxBatchEvents)
+			writeBatchResult(w, http.StatusRequestEntityTooLarge, res)
+			return
+		}
+		event := new(types.SecurityEvent)
+		if err := dec.Decode(event); err != nil {
+			status, msg := s.bodyError(err)
+			res.Error = fmt.Sprintf("event %d: %s", res.Accepted, msg)
+			writeBatchResult(w, status, res)
+			return
+		}
+		noteAgent(r, event.AgentID)
+		if !checked || event.AgentID != verified {
+			if err := s.verifyAgent(r, event.AgentID); err != nil {
+				status, msg := s.agentRejection(w, r, err)
+				res.Error = fmt.Sprintf("event %d: %s", res.Accepted, msg)
+				writeBatchResult(w, status, res)
+				return
+			}
+			verified, checked = event.AgentID, true
+		}
+		if err := s.controller.IngestEvent(ctx, event); err != nil {
+			var limited *controller.RateLimitError
+			if errors.As(err, &limited) {
+				setRetryAfter(w, limited.RetryAfter)
+				res.Error = fmt.Sprintf("event %d: %v", res.Accepted, limited)
+				writeBatchResult(w, http.StatusTooManyRequests, res)
+				return
+			}
+			res.Error = fmt.Sprintf("event %d: event buffer full; retry the remaining events later", res.Accepted)
+			writeBatchResult(w, http.StatusServiceUnavailable, res)
+			return
+		}
+		res.Accepted++
+	}
+	if _, err := dec.Token(); err != nil {
+		status, msg := s.bodyError(err)
+		res.Error = msg
+		writeBatchResult(w, status, res)
+		return
+	}
+	writeBatchResult(w, http.StatusAccepted, res)
+}
+
+func writeBatchResult(w http.ResponseWriter, status int, res batchResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// setRetryAfter tells the sender how long to wait, in whole seconds, before
+// sending again.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// limitBody caps the request body at MaxRequestBytes.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) io.Reader {
+	if s.cfg.MaxRequestBytes <= 0 {
+		return r.Body
+	}
+	return http.MaxBytesReader(w, r.Body, s.cfg.MaxRequestBytes)
+}
+
+// jsonBody returns the body of an agent request, capped at MaxRequestBytes.
+// The body must be sent as JSON; a request without a Content-Type is taken
+// to be JSON too, as older agents may not set one.
+func (s *Server) jsonBody(w http.ResponseWriter, r *http.Request) (io.Reader, error) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "application/json" {
+			return nil, errUnsupportedMediaType
+		}
+	}
+	return s.limitBody(w, r), nil
+}
+
+// decodeAgentRequest decodes the JSON body of an agent request into v,
+// answering the request itself when it cannot.
+func (s *Server) decodeAgentRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := s.jsonBody(w, r)
+	if err == nil {
+		err = json.NewDecoder(body).Decode(v)
+	}
+	if err != nil {
+		status, msg := s.bodyError(err)
+		http.Error(w, msg, status)
+		return false
+	}
+	return true
+}
+
+// bodyError maps an error reading or decoding an ingestion request to a
+// status code and a message telling the sender what to change.
+func (s *Server) bodyError(err error) (int, string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"request body exceeds %d bytes; split it into smaller requests (MAX_REQUEST_BODY_MB)", tooLarge.Limit)
+	case errors.Is(err, errUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType, "Content-Type must be application/json"
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType, "Content-Encoding must be gzip or absent"
+	case errors.Is(err, gzip.ErrHeader), errors.Is(err, gzip.ErrChecksum):
+		return http.StatusBadRequest, "invalid gzip body: " + err.Error()
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return http.StatusBadRequest, "invalid JSON: unexpected end of body"
+	default:
+		return http.StatusBadRequest, "invalid JSON: " + err.Error()
+	}
+}
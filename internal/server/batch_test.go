@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+func batchBody(n int) string {
+	events := make([]string, n)
+	for i := range events {
+		events[i] = fmt.Sprintf(`{"id":"ev-%d","agent_id":"a1","type":"process_start","severity":"LOW","pod_name":"p","pod_namespace":"ns"}`, i)
+	}
+	return "[" + strings.Join(events, ",") + "]"
+}
+
+func postBatch(t *testing.T, cfg config.ControllerConfig, body string) (*httptest.ResponseRecorder, batchResult) {
+	t.Helper()
+	log := logrus.New()
+	srv := New(cfg, controller.New(cfg, log), log)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/events/batch", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.handleEventBatch(rec, req)
+	var res batchResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("decode batch response: %v", err)
+	}
+	return rec, res
+}
+
+func TestServer_EventBatch(t *testing.T) {
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, MaxBatchEvents: 5, MaxRequestBytes: 1 << 20}
+	tests := []struct {
+		name       string
+		cfg        config.ControllerConfig
+		body       string
+		wantStatus int
+		wantCount  int
+		wantError  string
+	}{
+		{name: "accepted", cfg: cfg, body: batchBody(3), wantStatus: http.StatusAccepted, wantCount: 3},
+		{name: "empty", cfg: cfg, body: "[]", wantStatus: http.StatusAccepted},
+		{name: "not an array", cfg: cfg, body: `{"id":"ev-1"}`, wantStatus: http.StatusBadRequest, wantError: "JSON array"},
+		{name: "too many events", cfg: cfg, body: batchBody(6), wantStatus: http.StatusRequestEntityTooLarge, wantCount: 5, wantError: "at most 5 per request"},
+		{name: "invalid event", cfg: cfg, body: `[{"id":"ev-0"},{"id":7}]`, wantStatus: http.StatusBadRequest, wantCount: 1, wantError: "event 1: invalid JSON"},
+		{name: "truncated", cfg: cfg, body: `[{"id":"ev-0"},{"id":`, wantStatus: http.StatusBadRequest, wantCount: 1, wantError: "unexpected end"},
+		{
+			name: "body too large", cfg: config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, MaxRequestBytes: 256},
+			body: batchBody(4), wantStatus: http.StatusRequestEntityTooLarge, wantCount: 2, wantError: "exceeds 256 bytes",
+		},
+		{
+			name: "buffer full", cfg: config.ControllerConfig{EventBufferSize: 2, AlertBufferSize: 10},
+			body: batchBody(3), wantStatus: http.StatusServiceUnavailable, wantCount: 2, wantError: "event 2: event buffer full",
+		},
+		{
+			name: "rate limited", cfg: config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, AgentEventRate: 1, AgentEventBurst: 2},
+			body: batchBody(3), wantStatus: http.StatusTooManyRequests, wantCount: 2, wantError: "event 2: agent a1 is over its event rate",
+		},
+		{
+			name: "unlimited", cfg: config.ControllerConfig{EventBufferSize: 100, AlertBufferSize: 10},
+			body: batchBody(50), wantStatus: http.StatusAccepted, wantCount: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, res := postBatch(t, tt.cfg, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%+v)", rec.Code, tt.wantStatus, res)
+			}
+			if res.Accepted != tt.wantCount {
+				t.Errorf("accepted = %d, want %d", res.Accepted, tt.wantCount)
+			}
+			if !strings.Contains(res.Error, tt.wantError) || (tt.wantError == "") != (res.Error == "") {
+				t.Errorf("error = %q, want it to contain %q", res.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestServer_EventBatch_MethodNotAllowed(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}
+	srv := New(cfg, controller.New(cfg, log), log)
+	rec := httptest.NewRecorder()
+	srv.handleEventBatch(rec, httptest.NewRequest(http.MethodGet, "/api/v1/events/batch", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET batch: status %d", rec.Code)
+	}
+}
+
+func TestServer_Events_RateLimited(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, AgentEventRate: 0.5, AgentEventBurst: 1}
+	srv := New(cfg, controller.New(cfg, log), log)
+	body := `{"id":"ev-1","agent_id":"a1","type":"process_start","severity":"LOW","pod_name":"api-0"}`
+	for i, want := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		srv.handleEvents(rec, httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("event %d: status %d, want %d", i, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "2" {
+			t.Errorf("Retry-After = %q", rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// Callers are limited by where they send from, not the agent ID they
+	// put in events.
+	for _, tc := range []struct {
+		remote, agent string
+		want          int
+	}{
+		{"192.0.2.1", "a2", http.StatusTooManyRequests},
+		{"192.0.2.2", "a1", http.StatusAccepted},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(strings.Replace(body, "a1", tc.agent, 1)))
+		req.RemoteAddr = tc.remote + ":40000"
+		rec := httptest.NewRecorder()
+		srv.handleEvents(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s from %s: status %d, want %d", tc.agent, tc.remote, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestServer_Events_BodyTooLarge(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, MaxRequestBytes: 64}
+	srv := New(cfg, controller.New(cfg, log), log)
+	body := `{"id":"ev-1","agent_id":"a1","type":"process_start","severity":"LOW","pod_name":"api-0"}`
+	rec := httptest.NewRecorder()
+	srv.handleEvents(rec, httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "MAX_REQUEST_BODY_MB") {
+		t.Errorf("oversized event: status %d, body %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServer_AgentRequests_BodyChecks(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, MaxRequestBytes: 64}
+	srv := New(cfg, controller.New(cfg, log), log)
+	event := `{"id":"ev-1","agent_id":"a1"}`
+
+	for _, tc := range []struct {
+		name, path, contentType, body string
+		want                          int
+	}{
+		{"json with charset", "/api/v1/events", "application/json; charset=utf-8", event, http.StatusAccepted},
+		{"no content type", "/api/v1/events", "", event, http.StatusAccepted},
+		{"form", "/api/v1/events", "application/x-www-form-urlencoded", event, http.StatusUnsupportedMediaType},
+		{"batch as text", "/api/v1/events/batch", "text/plain", "[" + event + "]", http.StatusUnsupportedMediaType},
+		{"register as form", "/api/v1/agents/register", "application/x-www-form-urlencoded", `{"agent_id":"a1"}`, http.StatusUnsupportedMediaType},
+		{"oversized register", "/api/v1/agents/register", "application/json", `{"agent_id":"a1","pod_name":"` + strings.Repeat("p", 64) + `"}`, http.StatusRequestEntityTooLarge},
+		{"oversized heartbeat", "/api/v1/agents/heartbeat", "application/json", `{"agent_id":"a1","pod_name":"` + strings.Repeat("p", 64) + `"}`, http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		rec := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d (%q)", tc.name, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// handleBrownout reads (GET), starts or replaces (PUT) and ends (DELETE)
+// the monitoring brownout. The PUT body is a types.BrownoutRequest, which
+// may be empty to use the controller's defaults.
+func (s *Server) handleBrownout(w http.ResponseWriter, r *http.Request) {
+	var (
+		b   *types.Brownout
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		b, err = s.controller.Brownout()
+	case http.MethodPut:
+		var req types.BrownoutRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(s.limitBody(w, r)).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		b, err = s.controller.StartBrownout(req)
+	case http.MethodDelete:
+		err = s.controller.EndBrownout()
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case errors.Is(err, controller.ErrNoBrownout):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrInvalidBrownout):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", brownoutETag(b))
+	json.NewEncoder(w).Encode(b)
+}
+
+// handleAgentBrownout serves the brownout agents poll, with a 404 when
+// there is none so they restore their scan intervals.
+func (s *Server) handleAgentBrownout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := s.controller.Brownout()
+	if errors.Is(err, controller.ErrNoBrownout) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	etag := brownoutETag(b)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(b)
+}
+
+// brownoutETag changes with every brownout started.
+func brownoutETag(b *types.Brownout) string {
+	return `"` + strconv.FormatInt(b.StartedAt.UnixNano(), 36) + `"`
+}
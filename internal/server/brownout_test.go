@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_Brownout(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{
+		HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10,
+		BrownoutFactor: 4, BrownoutDuration: 30 * time.Minute,
+	}
+	h := New(cfg, controller.New(cfg, log), log).httpServer.Handler
+
+	do := func(method, path, body, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/api/v1/agents/agent-1/brownout", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("poll without a brownout: status %d", rec.Code)
+	}
+	for _, body := range []string{`{"factor":1}`, `{"factor":100}`, `{"ttl":"forever"}`, `{"ttl":"72h"}`, `{`} {
+		if rec := do(http.MethodPut, "/api/v1/brownout", body, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status %d", body, rec.Code)
+		}
+	}
+
+	rec := do(http.MethodPut, "/api/v1/brownout", "", "")
+	var b types.Brownout
+	if err := json.NewDecoder(rec.Body).Decode(&b); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("PUT defaults: status %d, err %v", rec.Code, err)
+	}
+	if b.Factor != 4 || b.Until.Sub(b.StartedAt) != 30*time.Minute {
+		t.Errorf("default brownout = %+v", b)
+	}
+
+	rec = do(http.MethodPut, "/api/v1/brownout", `{"factor":8,"ttl":"10m","reason":"node pressure"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = do(http.MethodGet, "/api/v1/agents/agent-1/brownout", "", "")
+	b = types.Brownout{}
+	if err := json.NewDecoder(rec.Body).Decode(&b); err != nil || b.Factor != 8 || b.Reason != "node pressure" {
+		t.Errorf("poll: status %d, brownout %+v, err %v", rec.Code, b, err)
+	}
+	etag := rec.Header().Get("ETag")
+	if rec := do(http.MethodGet, "/api/v1/agents/agent-1/brownout", "", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("poll with current ETag: status %d", rec.Code)
+	}
+
+	if rec := do(http.MethodDelete, "/api/v1/brownout", "", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: status %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/brownout", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE without a brownout: status %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/brownout", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after DELETE: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// handleSweetEnrichment takes a verdict Sweet Security pushes back about a
+// forwarded alert or incident and returns it as applied, with escalated_from
+// set if it raised the severity.
+func (s *Server) handleSweetEnrichment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var e types.Enrichment
+	if err := json.NewDecoder(s.limitBody(w, r)).Decode(&e); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	applied, err := s.controller.ApplyEnrichment(e)
+	switch {
+	case errors.Is(err, controller.ErrAlertNotFound):
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrIncidentNotFound):
+		http.Error(w, "Incident not found", http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrInvalidEnrichment):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(applied)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_SweetEnrichment(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a1", Type: "process_start", Timestamp: time.Now(), PodName: "p", PodNamespace: "ns",
+		Process: &types.ProcessEventData{SuspiciousIndicators: []string{"shell_spawn"}},
+	})
+	time.Sleep(150 * time.Millisecond)
+	alerts, _ := ctrl.GetAlerts(types.AlertFilter{Limit: 1})
+	if len(alerts) != 1 || alerts[0].Severity != "MEDIUM" {
+		t.Fatalf("alerts = %+v, want one MEDIUM alert", alerts)
+	}
+	id := alerts[0].ID
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/integrations/sweetsecurity/enrichments", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		srv.handleSweetEnrichment(rec, req)
+		return rec
+	}
+	rec := post(`{"alert_id":"` + id + `","verdict":"malicious","indicator":"203.0.113.9","summary":"C2 server"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST enrichment: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var got types.Enrichment
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode enrichment: %v", err)
+	}
+	if got.EscalatedFrom != "MEDIUM" {
+		t.Errorf("escalated_from = %q, want MEDIUM", got.EscalatedFrom)
+	}
+	if alert, _ := ctrl.GetAlert(id); alert.Severity != "CRITICAL" {
+		t.Errorf("alert severity = %s, want CRITICAL", alert.Severity)
+	}
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"alert_id":"missing","verdict":"benign"}`, http.StatusNotFound},
+		{`{"incident_id":"missing","verdict":"benign"}`, http.StatusNotFound},
+		{`{"alert_id":"` + id + `","verdict":"maybe"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := post(tt.body); rec.Code != tt.want {
+			t.Errorf("POST %s: status %d, want %d", tt.body, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// exportFlushEvery is how many records are written between flushes, so large
+// exports go out as a chunked stream instead of one buffered body.
+const exportFlushEvery = 500
+
+// Export formats for /api/v1/export.
+const (
+	exportFormatNDJSON = "ndjson"
+	exportFormatCSV    = "csv"
+)
+
+var (
+	alertCSVHeader = []string{"id", "timestamp", "severity", "rule_id", "rule_name", "pod_namespace", "pod_name",
+		"status", "assignee", "mitre_tactic", "mitre_id", "description", "event_ids"}
+	eventCSVHeader = []string{"id", "timestamp", "agent_id", "type", "severity", "pod_namespace", "pod_name", "schema_version"}
+)
+
+// handleExport streams retained alerts (type=alerts, the default) or events
+// (type=events) oldest first as NDJSON (format=ndjson, the default) or CSV
+// (format=csv). Selection uses the /api/v1/alerts parameters for alerts and
+// severity, namespace, pod, event_type and since/until for events. cursor and
+// limit page through history: the X-Next-Cursor header is the cursor for the
+// next request, and X-Export-Truncated is set when records between the
+// requested cursor and the oldest retained one were already dropped.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	switch format {
+	case "":
+		format = exportFormatNDJSON
+	case exportFormatNDJSON, exportFormatCSV:
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+	cursor, limit, err := parseExportRange(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		records   []interface{}
+		header    []string
+		row       func(interface{}) []string
+		next      int64
+		truncated bool
+	)
+	switch kind := q.Get("type"); kind {
+	case "", "alerts":
+		filter, err := parseAlertFilter(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page := s.controller.ExportAlerts(cursor, limit, filter)
+		next, truncated, header, row = page.Next, page.Truncated, alertCSVHeader, alertCSVRow
+		for i := range page.Items {
+			records = append(records, &page.Items[i])
+		}
+	case "events":
+		match, err := parseEventMatch(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page := s.controller.ExportEvents(cursor, limit, match)
+		next, truncated, header, row = page.Next, page.Truncated, eventCSVHeader, eventCSVRow
+		for _, e := range page.Items {
+			records = append(records, e)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("invalid type %q", kind), http.StatusBadRequest)
+		return
+	}
+
+	// Large exports can outlast the server-wide WriteTimeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("X-Next-Cursor", strconv.FormatInt(next, 10))
+	if truncated {
+		w.Header().Set("X-Export-Truncated", "true")
+	}
+	if format == exportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		for i, rec := range records {
+			cw.Write(row(rec))
+			if (i+1)%exportFlushEvery == 0 {
+				cw.Flush()
+				flush()
+			}
+		}
+		cw.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for i, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return
+		}
+		if (i+1)%exportFlushEvery == 0 {
+			flush()
+		}
+	}
+}
+
+func parseExportRange(q url.Values) (cursor int64, limit int, err error) {
+	if v := q.Get("cursor"); v != "" {
+		if cursor, err = strconv.ParseInt(v, 10, 64); err != nil || cursor < 0 {
+			return 0, 0, fmt.Errorf("invalid cursor %q", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	return cursor, limit, nil
+}
+
+// parseEventMatch builds an event predicate from export query parameters.
+func parseEventMatch(q url.Values) (func(*types.SecurityEvent) bool, error) {
+	since, err := parseTimeParam(q, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseTimeParam(q, "until")
+	if err != nil {
+		return nil, err
+	}
+	severities := map[string]bool{}
+	if v := q.Get("severity"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.ToUpper(strings.TrimSpace(s))
+			if types.SeverityRank(s) == 0 {
+				return nil, fmt.Errorf("invalid severity %q", s)
+			}
+			severities[s] = true
+		}
+	}
+	namespace, pod, eventType := q.Get("namespace"), q.Get("pod"), q.Get("event_type")
+	return func(e *types.SecurityEvent) bool {
+		return (len(severities) == 0 || severities[e.Severity]) &&
+			(namespace == "" || e.PodNamespace == namespace) &&
+			(pod == "" || e.PodName == pod) &&
+			(eventType == "" || e.Type == eventType) &&
+			(since.IsZero() || !e.Timestamp.Before(since)) &&
+			(until.IsZero() || !e.Timestamp.After(until))
+	}, nil
+}
+
+func alertCSVRow(rec interface{}) []string {
+	a := rec.(*types.Alert)
+	return []string{a.ID, a.Timestamp.Format(time.RFC3339Nano), a.Severity, a.RuleID, a.RuleName, a.PodNS, a.PodName,
+		a.Status, a.Assignee, a.MitreTactic, a.MitreID, a.Description, strings.Join(a.EventIDs, ";")}
+}
+
+func eventCSVRow(rec interface{}) []string {
+	e := rec.(*types.SecurityEvent)
+	return []string{e.ID, e.Timestamp.Format(time.RFC3339Nano), e.AgentID, e.Type, e.Severity, e.PodNamespace, e.PodName, e.SchemaVersion}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func newExportServer(t *testing.T, events ...*types.SecurityEvent) *Server {
+	t.Helper()
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, EventRetentionCount: 100}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ctrl.Start(ctx)
+	for _, e := range events {
+		_ = ctrl.IngestEvent(ctx, e)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for ctrl.ExportEvents(0, 0, func(*types.SecurityEvent) bool { return true }).Next < int64(len(events)) {
+		if time.Now().After(deadline) {
+			t.Fatal("events were not processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return New(cfg, ctrl, log)
+}
+
+func export(s *Server, query string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.handleExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/export?"+query, nil))
+	return rec
+}
+
+func TestHandleExport_EventsNDJSONCursor(t *testing.T) {
+	now := time.Now()
+	var events []*types.SecurityEvent
+	for _, id := range []string{"ev-1", "ev-2", "ev-3"} {
+		events = append(events, &types.SecurityEvent{ID: id, AgentID: "a1", Type: "process_start", Severity: "INFO", Timestamp: now, PodNamespace: "ns"})
+	}
+	s := newExportServer(t, events...)
+
+	rec := export(s, "type=events&limit=2")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status=%d content-type=%q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var ids []string
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		var e types.SecurityEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if strings.Join(ids, ",") != "ev-1,ev-2" || rec.Header().Get("X-Next-Cursor") != "2" {
+		t.Fatalf("first page = %v, next cursor %q", ids, rec.Header().Get("X-Next-Cursor"))
+	}
+
+	rec = export(s, "type=events&cursor=2")
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 1 || !strings.Contains(rec.Body.String(), `"ev-3"`) {
+		t.Errorf("second page = %q", rec.Body.String())
+	}
+	if rec := export(s, "type=events&namespace=other"); rec.Body.Len() != 0 {
+		t.Errorf("namespace filter returned %q", rec.Body.String())
+	}
+}
+
+func TestHandleExport_AlertsCSV(t *testing.T) {
+	s := newExportServer(t, &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a1", Type: "process_start", Severity: "CRITICAL", Timestamp: time.Now(),
+		PodName: "p", PodNamespace: "ns",
+		Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}},
+	})
+	deadline := time.Now().Add(2 * time.Second)
+	for _, total := s.controller.GetAlerts(types.AlertFilter{}); total == 0; _, total = s.controller.GetAlerts(types.AlertFilter{}) {
+		if time.Now().After(deadline) {
+			t.Fatal("alert was not raised")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := export(s, "format=csv&severity=critical")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("status=%d content-type=%q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "id" || rows[1][3] != "APSS-002" || rows[1][12] != "ev-1" {
+		t.Errorf("rows = %v", rows)
+	}
+}
+
+func TestHandleExport_BadParams(t *testing.T) {
+	s := newExportServer(t)
+	for _, q := range []string{"format=xml", "type=agents", "cursor=-1", "limit=0", "type=events&since=yesterday"} {
+		if rec := export(s, q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", q, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// handleFederation receives an edge controller's report (POST) on the
+// central controller.
+func (s *Server) handleFederation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var report types.FederationReport
+	if err := json.NewDecoder(s.limitBody(w, r)).Decode(&report); err != nil {
+		status, msg := s.bodyError(err)
+		http.Error(w, msg, status)
+		return
+	}
+	ack, err := s.controller.ReceiveFederationReport(&report)
+	if err != nil {
+		federationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ack)
+}
+
+// handleFederationClusters lists the edge clusters that have reported.
+func (s *Server) handleFederationClusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	clusters, err := s.controller.FederationClusters()
+	if err != nil {
+		federationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clusters)
+}
+
+// handleFederationAlerts lists alerts consolidated across clusters, most
+// recently fired first. Query parameters: cluster, severity, rule_id,
+// namespace, limit and offset. The total match count is returned in the
+// X-Total-Count header.
+func (s *Server) handleFederationAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseFederatedAlertFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alerts, total, err := s.controller.FederatedAlerts(filter)
+	if err != nil {
+		federationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	json.NewEncoder(w).Encode(alerts)
+}
+
+func federationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, controller.ErrFederationDisabled):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, controller.ErrInvalidFederationReport):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func parseFederatedAlertFilter(q url.Values) (types.FederatedAlertFilter, error) {
+	f := types.FederatedAlertFilter{
+		Cluster:   q.Get("cluster"),
+		Severity:  strings.ToUpper(q.Get("severity")),
+		RuleID:    q.Get("rule_id"),
+		Namespace: q.Get("namespace"),
+		Limit:     defaultAlertLimit,
+	}
+	if f.Severity != "" && types.SeverityRank(f.Severity) == 0 {
+		return f, fmt.Errorf("invalid severity %q", f.Severity)
+	}
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 {
+			return f, fmt.Errorf("invalid limit %q", v)
+		}
+		if f.Limit > maxAlertLimit {
+			f.Limit = maxAlertLimit
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			return f, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_Federation(t *testing.T) {
+	log := logrus.New()
+	do := func(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewReader([]byte(body))))
+		return rec
+	}
+
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, MaxRequestBytes: 1 << 20}
+	h := New(cfg, controller.New(cfg, log), log).httpServer.Handler
+	if rec := do(h, http.MethodPost, "/api/v1/federation", `{"cluster_name":"eu-1"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("report to a non-central controller: status %d", rec.Code)
+	}
+
+	cfg.FederationCentral = true
+	h = New(cfg, controller.New(cfg, log), log).httpServer.Handler
+	for _, body := range []string{`{}`, `{`} {
+		if rec := do(h, http.MethodPost, "/api/v1/federation", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s: status %d", body, rec.Code)
+		}
+	}
+	report := `{"cluster_name":"eu-1","interval":"30s","agents":{"healthy":2},
+		"alerts":[{"id":"a1","rule_id":"APSS-001","severity":"HIGH","pod_name":"api-0","pod_namespace":"payments"}]}`
+	rec := do(h, http.MethodPost, "/api/v1/federation", report)
+	var ack types.FederationAck
+	if err := json.NewDecoder(rec.Body).Decode(&ack); err != nil || rec.Code != http.StatusOK || ack.Accepted != 1 {
+		t.Fatalf("report: status %d, ack %+v, err %v", rec.Code, ack, err)
+	}
+
+	rec = do(h, http.MethodGet, "/api/v1/federation/clusters", "")
+	var clusters []types.ClusterSummary
+	if err := json.NewDecoder(rec.Body).Decode(&clusters); err != nil || len(clusters) != 1 || clusters[0].AgentsTotal != 2 {
+		t.Errorf("clusters = %+v, err %v", clusters, err)
+	}
+
+	if rec = do(h, http.MethodGet, "/api/v1/federation/alerts?severity=bogus", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad severity: status %d", rec.Code)
+	}
+	rec = do(h, http.MethodGet, "/api/v1/federation/alerts?cluster=eu-1&severity=high", "")
+	var alerts []types.FederatedAlert
+	if err := json.NewDecoder(rec.Body).Decode(&alerts); err != nil || len(alerts) != 1 || rec.Header().Get("X-Total-Count") != "1" {
+		t.Fatalf("alerts = %+v, total %q, err %v", alerts, rec.Header().Get("X-Total-Count"), err)
+	}
+	if alerts[0].Clusters[0] != "eu-1" || alerts[0].Workload != "api-0" {
+		t.Errorf("alert = %+v", alerts[0])
+	}
+}
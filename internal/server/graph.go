@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	defaultGraphDepth = 1
+	maxGraphDepth     = 3
+	defaultGraphLimit = 500
+	maxGraphLimit     = 5000
+)
+
+// graphNodeParams are the shortcuts for ?node=<kind>:<key>.
+var graphNodeParams = []string{types.GraphNodePod, types.GraphNodeIP, types.GraphNodeDomain, types.GraphNodeHash}
+
+// handleGraph returns part of the entity graph. ?node=<id>, or one of
+// ?pod=<namespace>/<name>, ?ip=, ?domain= and ?hash=, selects the
+// neighborhood within ?depth= hops (1 to 3) of that node; without one the
+// most recently seen nodes are returned. ?window= (a duration such as 1h)
+// or ?since= (RFC 3339) keeps relations seen since then, and ?limit= caps
+// the number of nodes.
+func (s *Server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseGraphQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	graph, err := s.controller.GetGraph(q)
+	switch {
+	case errors.Is(err, controller.ErrGraphDisabled):
+		http.Error(w, "Entity graph disabled", http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrGraphNodeNotFound):
+		http.Error(w, "Node not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+func parseGraphQuery(q url.Values, now time.Time) (types.GraphQuery, error) {
+	gq := types.GraphQuery{Node: q.Get("node"), Depth: defaultGraphDepth, Limit: defaultGraphLimit}
+	for _, kind := range graphNodeParams {
+		v := q.Get(kind)
+		if v == "" {
+			continue
+		}
+		if gq.Node != "" {
+			return gq, errors.New("set only one of node, pod, ip, domain and hash")
+		}
+		gq.Node = kind + ":" + v
+	}
+	var err error
+	if v := q.Get("depth"); v != "" {
+		if gq.Depth, err = strconv.Atoi(v); err != nil || gq.Depth < 1 || gq.Depth > maxGraphDepth {
+			return gq, fmt.Errorf("invalid depth %q: want 1 to %d", v, maxGraphDepth)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if gq.Limit, err = strconv.Atoi(v); err != nil || gq.Limit < 1 {
+			return gq, fmt.Errorf("invalid limit %q", v)
+		}
+		if gq.Limit > maxGraphLimit {
+			gq.Limit = maxGraphLimit
+		}
+	}
+	if gq.Since, err = parseTimeParam(q, "since"); err != nil {
+		return gq, err
+	}
+	if v := q.Get("window"); v != "" {
+		if !gq.Since.IsZero() {
+			return gq, errors.New("set only one of since and window")
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return gq, fmt.Errorf("invalid window %q", v)
+		}
+		gq.Since = now.Add(-d)
+	}
+	return gq, nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_Graph(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, GraphRetention: time.Hour, GraphMaxNodes: 100}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a1", Type: "network_connection", Severity: "HIGH", Timestamp: time.Now(), PodName: "web-1", PodNamespace: "prod",
+		Process: &types.ProcessEventData{PID: 42, Name: "curl"},
+		Network: &types.NetworkEventData{DstIP: "203.0.113.9", DstPort: 443, IsExternal: true},
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/graph"+query, nil)
+		rec := httptest.NewRecorder()
+		srv.handleGraph(rec, req)
+		return rec
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for get("?ip=203.0.113.9").Code == http.StatusNotFound {
+		if time.Now().After(deadline) {
+			t.Fatal("event was not added to the graph")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var graph types.Graph
+	if err := json.NewDecoder(get("?ip=203.0.113.9&depth=2&window=1h").Body).Decode(&graph); err != nil {
+		t.Fatalf("decode graph: %v", err)
+	}
+	if len(graph.Nodes) != 3 || graph.Nodes[0].ID != "ip:203.0.113.9" || len(graph.Edges) != 2 {
+		t.Errorf("graph = %+v, want the IP, curl and web-1", graph)
+	}
+
+	for _, q := range []string{"?depth=4", "?ip=1.2.3.4&pod=a/b", "?window=-1h", "?since=yesterday", "?limit=0"} {
+		if rec := get(q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+	if rec := get("?domain=unknown.example"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown node: status %d", rec.Code)
+	}
+
+	disabled := New(config.ControllerConfig{}, controller.New(config.ControllerConfig{EventBufferSize: 1, AlertBufferSize: 1}, log), log)
+	rec := httptest.NewRecorder()
+	disabled.handleGraph(rec, httptest.NewRequest(http.MethodGet, "/api/v1/graph", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("disabled graph: status %d", rec.Code)
+	}
+}
+
+func TestParseGraphQuery(t *testing.T) {
+	now := time.Now()
+	q, err := parseGraphQuery(url.Values{"pod": {"prod/web-1"}, "window": {"30m"}, "limit": {"99999"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Node != "pod:prod/web-1" || q.Depth != defaultGraphDepth || q.Limit != maxGraphLimit || !q.Since.Equal(now.Add(-30*time.Minute)) {
+		t.Errorf("query = %+v", q)
+	}
+}
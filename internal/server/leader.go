@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+// headerForwardedBy marks a request one replica forwarded to another: a
+// follower to the leader, or an alert update to the replica that raised
+// the alert. A forwarded request is not forwarded again.
+const headerForwardedBy = "X-APSS-Forwarded-By"
+
+// headerCallerIP carries the IP a follower received a request from to the
+// leader, which sees the follower's IP instead.
+const headerCallerIP = "X-APSS-Caller-IP"
+
+// localRoutes are served by every replica, leader or not.
+var localRoutes = map[string]bool{
+	"/health":        true,
+	"/metrics":       true,
+	"/api/v1/leader": true,
+}
+
+// leaderProxy forwards follower requests to the current leader.
+type leaderProxy struct {
+	mu      sync.Mutex
+	address string
+	proxy   *httputil.ReverseProxy
+}
+
+// forwardToLeader serves requests on the leader and forwards them to it
+// from followers, so agents and operators can reach any replica. While no
+// replica leads, followers answer 503 and agents retry. status is the
+// controller's LeaderStatus.
+func (s *Server) forwardToLeader(next http.Handler, status func() controller.LeaderStatus) http.Handler {
+	lp := &leaderProxy{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := status()
+		if st.Leading || localRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if st.LeaderAddress == "" || st.Leader == st.Identity || r.Header.Get(headerForwardedBy) != "" {
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "No controller leader elected", http.StatusServiceUnavailable)
+			return
+		}
+		proxy, err := lp.to(st.LeaderAddress, s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		r.Header.Set(headerForwardedBy, st.Identity)
+		r.Header.Set(headerCallerIP, remoteIP(r))
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// callerIP returns the IP r came from: the remote address, or for a request
+// another replica forwarded, the IP the replica received it from.
+func (s *Server) callerIP(r *http.Request) string {
+	ip := remoteIP(r)
+	by, forwarded := r.Header.Get(headerForwardedBy), r.Header.Get(headerCallerIP)
+	if by != "" && forwarded != "" && s.controller.IsReplica(by, ip) {
+		return forwarded
+	}
+	return ip
+}
+
+// to returns the proxy to address, replacing the previous one when the
+// leader has changed.
+func (lp *leaderProxy) to(address string, s *Server) (*httputil.ReverseProxy, error) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	if lp.proxy != nil && lp.address == address {
+		return lp.proxy, nil
+	}
+	target, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	// Flush at once so alert streams reach clients as they are written.
+	proxy.FlushInterval = -1
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		s.log.WithError(err).WithField("leader", address).Warn("Failed to forward request to the leader")
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, "Controller leader unreachable", http.StatusBadGateway)
+	}
+	lp.address, lp.proxy = address, proxy
+	return proxy, nil
+}
+
+// handleLeader returns this replica's view of the leader election.
+func (s *Server) handleLeader(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.controller.LeaderStatus())
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+func TestServer_ForwardToLeader(t *testing.T) {
+	var forwardedBy, callerIP string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy, callerIP = r.Header.Get(headerForwardedBy), r.Header.Get(headerCallerIP)
+		w.Write([]byte("from leader " + r.URL.Path))
+	}))
+	defer leader.Close()
+
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	s := New(cfg, controller.New(cfg, log), log)
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("local"))
+	})
+	st := controller.LeaderStatus{Enabled: true, Identity: "pod-b"}
+	h := s.forwardToLeader(local, func() controller.LeaderStatus { return st })
+	do := func(path, forwardedBy string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if forwardedBy != "" {
+			req.Header.Set(headerForwardedBy, forwardedBy)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("/api/v1/alerts", ""); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("no leader: status %d", rec.Code)
+	}
+	if rec := do("/health", ""); rec.Body.String() != "local" {
+		t.Errorf("health on a follower: %q", rec.Body.String())
+	}
+
+	st.Leader, st.LeaderAddress = "pod-a", leader.URL
+	if rec := do("/api/v1/alerts", ""); rec.Body.String() != "from leader /api/v1/alerts" || forwardedBy != "pod-b" {
+		t.Errorf("follower: %d %q, forwarded by %q", rec.Code, rec.Body.String(), forwardedBy)
+	}
+	// The leader is told the IP the request came from, not one the caller
+	// made up.
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/events", nil)
+	req.Header.Set(headerCallerIP, "10.0.0.5")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if callerIP != "192.0.2.1" {
+		t.Errorf("forwarded caller IP = %q", callerIP)
+	}
+	// A request already forwarded is not forwarded again.
+	if rec := do("/api/v1/alerts", "pod-c"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("forwarded twice: status %d", rec.Code)
+	}
+
+	st.Leading, st.Leader = true, "pod-b"
+	if rec := do("/api/v1/alerts", ""); rec.Body.String() != "local" {
+		t.Errorf("leader: %q", rec.Body.String())
+	}
+
+	// Without leader election the replica always leads.
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/leader", nil))
+	var got controller.LeaderStatus
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got.Enabled || !got.Leading {
+		t.Errorf("GET /api/v1/leader = %+v, %v", got, err)
+	}
+}
+
+func TestServer_RoutingWithoutSharding(t *testing.T) {
+	s := New(config.ControllerConfig{}, controller.New(config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10}, logrus.New()), logrus.New())
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/routing", nil))
+	// Agents keep sending to the Service.
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /api/v1/routing: status %d", rec.Code)
+	}
+}
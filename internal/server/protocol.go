@@ -0,0 +1,78 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+var (
+	// errUnsupportedEncoding is an ingestion request with a Content-Encoding
+	// other than gzip.
+	errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+	// errUnsupportedMediaType is an agent request with a Content-Type other
+	// than JSON.
+	errUnsupportedMediaType = errors.New("unsupported Content-Type")
+)
+
+// handleHandshake negotiates the protocol an agent talks to the controller
+// with. An agent that shares no protocol with the controller gets a 409,
+// with the reason in the response's error.
+func (s *Server) handleHandshake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var h types.AgentHandshake
+	if !s.decodeAgentRequest(w, r, &h) {
+		return
+	}
+	noteAgent(r, h.AgentID)
+	// Agents handshake before they register.
+	if err := s.verifyAgent(r, h.AgentID); err != nil && !errors.Is(err, controller.ErrAgentNotRegistered) {
+		s.rejectAgent(w, r, err)
+		return
+	}
+	resp, err := s.controller.Handshake(&h)
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, controller.ErrIncompatibleAgent):
+		status = http.StatusConflict
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// eventBody returns the body of an ingestion request, capped at
+// MaxRequestBytes. A gzip body is decompressed, and the decompressed events
+// are capped too, so a small body cannot expand without bound.
+func (s *Server) eventBody(w http.ResponseWriter, r *http.Request) (io.Reader, error) {
+	body, err := s.jsonBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+		return body, nil
+	case types.CapabilityGzip:
+	default:
+		return nil, errUnsupportedEncoding
+	}
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.MaxRequestBytes <= 0 {
+		return zr, nil
+	}
+	return http.MaxBytesReader(w, zr, s.cfg.MaxRequestBytes), nil
+}
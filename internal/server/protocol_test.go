@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_Handshake(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, MaxBatchEvents: 500,
+		AgentMinProtocol: 2, AgentCapabilities: []string{"batch"}}
+	ctrl := controller.New(cfg, log)
+	srv := New(cfg, ctrl, log)
+	handshake := func(body string) (int, types.HandshakeResponse) {
+		rec := httptest.NewRecorder()
+		srv.handleHandshake(rec, httptest.NewRequest(http.MethodPost, "/api/v1/agents/handshake", strings.NewReader(body)))
+		var resp types.HandshakeResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp
+	}
+
+	code, resp := handshake(`{"agent_id":"new","protocol_versions":[1,2,3],"schema_versions":["v2","v3"],"capabilities":["batch","gzip","grpc"]}`)
+	if code != http.StatusOK || resp.ProtocolVersion != 2 || resp.SchemaVersion != "v2" ||
+		strings.Join(resp.Capabilities, ",") != "batch" || resp.MaxBatchEvents != 500 {
+		t.Errorf("handshake = %d %+v", code, resp)
+	}
+	code, resp = handshake(`{"agent_id":"old","protocol_versions":[1],"schema_versions":["v1"]}`)
+	if code != http.StatusConflict || !strings.Contains(resp.Error, "accepts 2 to 2") {
+		t.Errorf("old agent handshake = %d %+v", code, resp)
+	}
+	if code, _ := handshake(`{"protocol_versions":[2]}`); code != http.StatusBadRequest {
+		t.Errorf("handshake without agent_id: status %d", code)
+	}
+	ctrl.RecordHeartbeat(&types.AgentHeartbeat{AgentID: "legacy"})
+
+	rec := httptest.NewRecorder()
+	srv.handleAgents(rec, httptest.NewRequest(http.MethodGet, "/api/v1/agents?incompatible=true", nil))
+	var agents []*types.AgentInfo
+	json.NewDecoder(rec.Body).Decode(&agents)
+	var ids []string
+	for _, a := range agents {
+		ids = append(ids, a.ID)
+	}
+	if len(ids) != 2 || strings.Contains(strings.Join(ids, ","), "new") {
+		t.Errorf("incompatible agents = %v", ids)
+	}
+}
+
+func TestServer_Events_Gzip(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{EventBufferSize: 10, AlertBufferSize: 10, MaxRequestBytes: 1 << 10}
+	srv := New(cfg, controller.New(cfg, log), log)
+	gzipped := func(body string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(body))
+		zw.Close()
+		return &buf
+	}
+	post := func(body *bytes.Buffer, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/events/batch", body)
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		srv.handleEventBatch(rec, req)
+		return rec
+	}
+
+	if rec := post(gzipped(batchBody(3)), "gzip"); rec.Code != http.StatusAccepted {
+		t.Errorf("gzip batch: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	// Compresses to well under the limit but expands past it.
+	if rec := post(gzipped("["+strings.Repeat(" ", 4<<10)+"]"), "gzip"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("gzip bomb: status %d", rec.Code)
+	}
+	if rec := post(bytes.NewBufferString(batchBody(1)), "gzip"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid gzip body") {
+		t.Errorf("plain body marked gzip: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if rec := post(bytes.NewBufferString(batchBody(1)), "br"); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("brotli: status %d", rec.Code)
+	}
+}
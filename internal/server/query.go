@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// parseAlertFilter builds an AlertFilter from /api/v1/alerts query parameters.
+func parseAlertFilter(q url.Values) (types.AlertFilter, error) {
+	f := types.AlertFilter{
+		Status:    q.Get("status"),
+		RuleID:    q.Get("rule_id"),
+		Namespace: q.Get("namespace"),
+		Pod:       q.Get("pod"),
+		Sort:      q.Get("sort"),
+		Order:     q.Get("order"),
+		Limit:     defaultAlertLimit,
+	}
+	if f.Status != "" && !types.ValidAlertStatus(f.Status) {
+		return f, fmt.Errorf("invalid status %q", f.Status)
+	}
+	if v := q.Get("severity"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.ToUpper(strings.TrimSpace(s))
+			if types.SeverityRank(s) == 0 {
+				return f, fmt.Errorf("invalid severity %q", s)
+			}
+			f.Severities = append(f.Severities, s)
+		}
+	}
+	switch f.Sort {
+	case "", types.AlertSortTimestamp, types.AlertSortSeverity:
+	default:
+		return f, fmt.Errorf("invalid sort %q", f.Sort)
+	}
+	switch f.Order {
+	case "", types.SortAsc, types.SortDesc:
+	default:
+		return f, fmt.Errorf("invalid order %q", f.Order)
+	}
+
+	var err error
+	if f.Since, err = parseTimeParam(q, "since"); err != nil {
+		return f, err
+	}
+	if f.Until, err = parseTimeParam(q, "until"); err != nil {
+		return f, err
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 {
+			return f, fmt.Errorf("invalid limit %q", v)
+		}
+		if f.Limit > maxAlertLimit {
+			f.Limit = maxAlertLimit
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			return f, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	return f, nil
+}
+
+func parseTimeParam(q url.Values, key string) (time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: want RFC 3339", key, v)
+	}
+	return t, nil
+}
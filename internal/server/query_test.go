@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestParseAlertFilter(t *testing.T) {
+	q, _ := url.ParseQuery("severity=high,Critical&rule_id=APSS-001&namespace=web&pod=p1" +
+		"&since=2026-01-01T00:00:00Z&sort=severity&order=asc&limit=5000&offset=20")
+	f, err := parseAlertFilter(q)
+	if err != nil {
+		t.Fatalf("parseAlertFilter: %v", err)
+	}
+	if len(f.Severities) != 2 || f.Severities[0] != "HIGH" || f.Severities[1] != "CRITICAL" {
+		t.Errorf("Severities = %v", f.Severities)
+	}
+	if f.RuleID != "APSS-001" || f.Namespace != "web" || f.Pod != "p1" {
+		t.Errorf("selectors: %+v", f)
+	}
+	if !f.Since.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) || !f.Until.IsZero() {
+		t.Errorf("time range: since=%v until=%v", f.Since, f.Until)
+	}
+	if f.Sort != types.AlertSortSeverity || f.Order != types.SortAsc {
+		t.Errorf("sort=%q order=%q", f.Sort, f.Order)
+	}
+	if f.Limit != maxAlertLimit || f.Offset != 20 {
+		t.Errorf("limit=%d offset=%d", f.Limit, f.Offset)
+	}
+
+	f, err = parseAlertFilter(url.Values{})
+	if err != nil || f.Limit != defaultAlertLimit {
+		t.Errorf("defaults: limit=%d err=%v", f.Limit, err)
+	}
+}
+
+func TestParseAlertFilter_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"status=closed", "severity=urgent", "sort=pod", "order=up",
+		"since=yesterday", "until=1700000000", "limit=0", "limit=abc", "offset=-1",
+	} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := parseAlertFilter(q); err == nil {
+			t.Errorf("parseAlertFilter(%q): expected error", raw)
+		}
+	}
+}
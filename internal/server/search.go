@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// handleSearch serves /api/v1/search?q=: retained events whose process
+// name, executable, command line, file path, destination IP or domain
+// contain every term of q, newest first. ?namespace= and ?pod= narrow it,
+// and ?limit= and ?offset= page through it; the total is in X-Total-Count.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hits, total, err := s.controller.SearchEvents(q)
+	if errors.Is(err, controller.ErrSearchDisabled) {
+		http.Error(w, "Event search disabled: events are not retained", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	json.NewEncoder(w).Encode(hits)
+}
+
+func parseSearchQuery(q url.Values) (types.SearchQuery, error) {
+	sq := types.SearchQuery{
+		Text:      q.Get("q"),
+		Namespace: q.Get("namespace"),
+		Pod:       q.Get("pod"),
+		Limit:     defaultSearchLimit,
+	}
+	if strings.TrimSpace(sq.Text) == "" {
+		return sq, errors.New("missing q")
+	}
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if sq.Limit, err = strconv.Atoi(v); err != nil || sq.Limit < 1 {
+			return sq, fmt.Errorf("invalid limit %q", v)
+		}
+		if sq.Limit > maxSearchLimit {
+			sq.Limit = maxSearchLimit
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if sq.Offset, err = strconv.Atoi(v); err != nil || sq.Offset < 0 {
+			return sq, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	return sq, nil
+}
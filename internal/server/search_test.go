@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_Search(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, EventRetentionCount: 100}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a1", Type: "process_start", Severity: "HIGH", Timestamp: time.Now(), PodName: "web-1", PodNamespace: "prod",
+		Process: &types.ProcessEventData{Name: "xmrig", Cmdline: []string{"./xmrig", "--url", "pool.example:3333"}},
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.handleSearch(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	var rec *httptest.ResponseRecorder
+	for {
+		rec = get("/api/v1/search?q=POOL.example")
+		if rec.Code == http.StatusOK && rec.Header().Get("X-Total-Count") == "1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("search status %d, total %q", rec.Code, rec.Header().Get("X-Total-Count"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var hits []types.SearchHit
+	if err := json.NewDecoder(rec.Body).Decode(&hits); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].ID != "ev-1" || hits[0].Field != "process.cmdline" || hits[0].Event == nil {
+		t.Errorf("hits = %+v", hits)
+	}
+
+	for path, code := range map[string]int{
+		"/api/v1/search":                 http.StatusBadRequest,
+		"/api/v1/search?q=x&limit=0":     http.StatusBadRequest,
+		"/api/v1/search?q=x&offset=-1":   http.StatusBadRequest,
+		"/api/v1/search?q=nothing-like":  http.StatusOK,
+		"/api/v1/search?q=xmrig&pod=web": http.StatusOK,
+	} {
+		if rec := get(path); rec.Code != code {
+			t.Errorf("GET %s: status %d, want %d", path, rec.Code, code)
+		}
+	}
+}
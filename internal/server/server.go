@@ -2,9 +2,14 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -12,10 +17,17 @@ import (
 
 	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/integrations/grafana"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/threatintel"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
 	"github.com/invisible-tech/autopilot-security-sensor/internal/version"
 )
 
+const (
+	defaultAlertLimit = 100
+	maxAlertLimit     = 1000
+)
+
 // Server is the HTTP server for the controller API.
 type Server struct {
 	cfg        config.ControllerConfig
@@ -29,14 +41,54 @@ func New(cfg config.ControllerConfig, ctrl *controller.Controller, log *logrus.L
 	mux := http.NewServeMux()
 	s := &Server{cfg: cfg, controller: ctrl, log: log}
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/api/v1/leader", s.handleLeader)
+	mux.HandleFunc("/api/v1/routing", s.handleRouting)
 	mux.HandleFunc("/api/v1/events", s.handleEvents)
+	mux.HandleFunc("/api/v1/events/batch", s.handleEventBatch)
 	mux.HandleFunc("/api/v1/agents", s.handleAgents)
+	mux.HandleFunc("/api/v1/agents/migration", s.handleAgentMigration)
+	mux.HandleFunc("/api/v1/agents/config", s.handleAgentConfig)
+	mux.HandleFunc("/api/v1/agents/", s.handleAgent)
+	mux.HandleFunc("/api/v1/agents/register", s.handleRegister)
+	mux.HandleFunc("/api/v1/agents/heartbeat", s.handleHeartbeat)
+	mux.HandleFunc("/api/v1/agents/handshake", s.handleHandshake)
+	mux.HandleFunc("/api/v1/brownout", s.handleBrownout)
+	mux.HandleFunc("/api/v1/federation", s.handleFederation)
+	mux.HandleFunc("/api/v1/federation/clusters", s.handleFederationClusters)
+	mux.HandleFunc("/api/v1/federation/alerts", s.handleFederationAlerts)
 	mux.HandleFunc("/api/v1/alerts", s.handleAlerts)
+	mux.HandleFunc("/api/v1/alerts/", s.handleAlert)
+	mux.HandleFunc("/api/v1/alerts/stream", s.handleAlertStream)
+	mux.HandleFunc("/api/v1/suppressions", s.handleSuppressions)
+	mux.HandleFunc("/api/v1/suppressions/", s.handleSuppression)
+	mux.HandleFunc("/api/v1/baselines", s.handleBaselines)
+	mux.HandleFunc("/api/v1/baselines/", s.handleBaseline)
+	mux.HandleFunc("/api/v1/incidents", s.handleIncidents)
+	mux.HandleFunc("/api/v1/incidents/", s.handleIncident)
+	mux.HandleFunc("/api/v1/iocs", s.handleIOCs)
+	mux.HandleFunc("/api/v1/graph", s.handleGraph)
+	mux.HandleFunc("/api/v1/pods/", s.handlePod)
+	mux.HandleFunc("/api/v1/search", s.handleSearch)
+	mux.HandleFunc("/api/v1/rules/coverage", s.handleRuleCoverage)
+	mux.HandleFunc("/api/v1/rules/", s.handleRule)
+	mux.HandleFunc("/api/v1/export", s.handleExport)
+	mux.HandleFunc("/api/v1/audit", s.handleAudit)
+	mux.HandleFunc("/api/v1/storage/migrations", s.handleStorageMigrations)
+	mux.HandleFunc("/api/v1/integrations/grafana/dashboards", s.handleGrafanaDashboards)
+	mux.HandleFunc("/api/v1/integrations/sweetsecurity/enrichments", s.handleSweetEnrichment)
 	mux.Handle("/metrics", promhttp.Handler())
 
+	handler := s.forwardToLeader(mux, s.controller.LeaderStatus)
+	if auth := newAuthenticator(cfg.AgentTokensFile, cfg.OperatorTokensFile, cfg.IntegrationTokensFile, log); auth != nil {
+		handler = auth.wrap(handler)
+	} else {
+		log.Warn("No API token files configured, controller API is unauthenticated")
+	}
+	handler = s.accessLog(handler)
+
 	s.httpServer = &http.Server{
 		Addr:         cfg.HTTPAddr,
-		Handler:      mux,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -68,29 +120,306 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	var event types.SecurityEvent
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+	buf := bodyPool.Get().(*bytes.Buffer)
+	defer releaseBody(buf)
+	body, err := s.eventBody(w, r)
+	if err == nil {
+		_, err = buf.ReadFrom(body)
+	}
+	if err != nil {
+		status, msg := s.bodyError(err)
+		http.Error(w, msg, status)
+		return
+	}
+	event := new(types.SecurityEvent)
+	if err := json.Unmarshal(buf.Bytes(), event); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if err := s.controller.IngestEvent(r.Context(), &event); err != nil {
-		http.Error(w, "Event buffer full", http.StatusServiceUnavailable)
+	noteAgent(r, event.AgentID)
+	if err := s.verifyAgent(r, event.AgentID); err != nil {
+		s.rejectAgent(w, r, err)
 		return
 	}
-	if event.Severity == "CRITICAL" || event.Severity == "HIGH" {
-		s.controller.SendHighSeverityEvent(r.Context(), &event)
+	if err := s.controller.IngestEvent(controller.WithCaller(r.Context(), s.callerIP(r)), event); err != nil {
+		var limited *controller.RateLimitError
+		if errors.As(err, &limited) {
+			setRetryAfter(w, limited.RetryAfter)
+			http.Error(w, limited.Error(), http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Event buffer full", http.StatusServiceUnavailable)
+		return
 	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// maxPooledBody is the largest request buffer kept for reuse, so one huge
+// request does not pin its memory.
+const maxPooledBody = 64 << 10
+
+// bodyPool recycles request body buffers. Decoding copies everything it
+// keeps out of the buffer, so it can be reused as soon as the event is
+// decoded.
+var bodyPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func releaseBody(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBody {
+		return
+	}
+	buf.Reset()
+	bodyPool.Put(buf)
+}
+
+// handleAgents lists the agents; ?incompatible=true lists only those that
+// share no protocol with the controller.
 func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
 	agents := s.controller.GetAgents()
+	if r.URL.Query().Get("incompatible") == "true" {
+		incompatible := agents[:0]
+		for _, a := range agents {
+			if a.Protocol.Incompatible != "" {
+				incompatible = append(incompatible, a)
+			}
+		}
+		agents = incompatible
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(agents)
 }
 
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var reg types.AgentRegistration
+	if !s.decodeAgentRequest(w, r, &reg) {
+		return
+	}
+	noteAgent(r, reg.AgentID)
+	if err := s.verifyRegistration(r, reg.AgentID, reg.PodNamespace, reg.PodName, reg.PodIP); err != nil {
+		s.rejectAgent(w, r, err)
+		return
+	}
+	if err := s.controller.RegisterAgent(&reg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var hb types.AgentHeartbeat
+	if !s.decodeAgentRequest(w, r, &hb) {
+		return
+	}
+	noteAgent(r, hb.AgentID)
+	// A heartbeat re-registers an agent the controller lost, such as after
+	// a restart.
+	err := s.verifyAgent(r, hb.AgentID)
+	if errors.Is(err, controller.ErrAgentNotRegistered) {
+		err = s.verifyRegistration(r, hb.AgentID, hb.PodNamespace, hb.PodName, hb.PodIP)
+	}
+	if err != nil {
+		s.rejectAgent(w, r, err)
+		return
+	}
+	if err := s.controller.RecordHeartbeat(&hb); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAgentMigration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.controller.SchemaMigration())
+}
+
+// handleAlerts lists alerts. Query parameters: status, severity (comma-separated),
+// rule_id, namespace, pod, since/until (RFC 3339), sort (timestamp|severity),
+// order (asc|desc, oldest first by default), limit and offset. The total
+// match count is returned in the X-Total-Count header.
 func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
-	alerts := s.controller.GetAlerts(100)
+	filter, err := parseAlertFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alerts, total := s.controller.GetAlerts(filter)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	json.NewEncoder(w).Encode(alerts)
 }
+
+// handleAlert serves GET and PATCH on /api/v1/alerts/{id} for alert triage,
+// and POST on /api/v1/alerts/{id}/suppress.
+func (s *Server) handleAlert(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/alerts/")
+	if alertID, ok := strings.CutSuffix(id, "/suppress"); ok && alertID != "" && !strings.Contains(alertID, "/") {
+		s.handleSuppressAlert(w, r, alertID)
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		alert *types.Alert
+		err   error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		alert, err = s.controller.GetAlert(id)
+	case http.MethodPatch:
+		if owner := s.controller.AlertOwner(id); owner != "" && s.forwardToOwner(w, r, owner) {
+			return
+		}
+		var update types.AlertUpdate
+		if err := json.NewDecoder(s.limitBody(w, r)).Decode(&update); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		alert, err = s.controller.UpdateAlert(id, update)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case errors.Is(err, controller.ErrAlertNotFound):
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrInvalidAlertStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
+
+// handleIncidents lists retained incidents, newest first. ?type= keeps one
+// incident type.
+func (s *Server) handleIncidents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.controller.GetIncidents(r.URL.Query().Get("type")))
+}
+
+func (s *Server) handleIncident(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/incidents/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	incident, err := s.controller.GetIncident(id)
+	if errors.Is(err, controller.ErrIncidentNotFound) {
+		http.Error(w, "Incident not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incident)
+}
+
+// handleIOCs lists IOCs extracted from CRITICAL alerts, most recently seen
+// first. ?type= keeps one IOC type; ?format=stix returns a STIX 2.1 bundle.
+func (s *Server) handleIOCs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	iocs := s.controller.GetIOCs(q.Get("type"))
+	switch q.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(iocs)
+	case "stix":
+		w.Header().Set("Content-Type", threatintel.STIXMediaType)
+		json.NewEncoder(w).Encode(threatintel.ToSTIX(iocs))
+	default:
+		http.Error(w, "format must be json or stix", http.StatusBadRequest)
+	}
+}
+
+// handleRuleCoverage reports fixture counts and match history per rule.
+// ?untested=true keeps rules without fixtures; ?unmatched=true keeps rules
+// that have never fired.
+func (s *Server) handleRuleCoverage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	untested := q.Get("untested") == "true"
+	unmatched := q.Get("unmatched") == "true"
+	coverage := make([]*types.RuleCoverage, 0)
+	for _, cov := range s.controller.RuleCoverage() {
+		if (untested && cov.Fixtures > 0) || (unmatched && cov.EverMatched) {
+			continue
+		}
+		coverage = append(coverage, cov)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coverage)
+}
+
+// handleRule serves PATCH /api/v1/rules/{id} with a types.RuleUpdate body,
+// moving the rule into shadow mode or promoting it to active, or disabling
+// or re-enabling it, and returns the rule's coverage.
+func (s *Server) handleRule(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/rules/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var update types.RuleUpdate
+	if err := json.NewDecoder(s.limitBody(w, r)).Decode(&update); err != nil || (update.Shadow == nil && update.Disabled == nil) {
+		http.Error(w, "Invalid JSON: shadow or disabled is required", http.StatusBadRequest)
+		return
+	}
+	var cov *types.RuleCoverage
+	var err error
+	if update.Shadow != nil {
+		cov, err = s.controller.SetRuleShadow(id, *update.Shadow)
+	}
+	if update.Disabled != nil && err == nil {
+		cov, err = s.controller.SetRuleDisabled(id, *update.Disabled)
+	}
+	if errors.Is(err, controller.ErrRuleNotFound) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cov)
+}
+
+// handleGrafanaDashboards returns dashboards generated from the controller's
+// registered metrics, ready to import into Grafana.
+func (s *Server) handleGrafanaDashboards(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grafana.Dashboards(controller.Metrics()))
+}
@@ -1,11 +1,16 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -190,3 +195,428 @@ func TestServer_Events_HighSeverityCallsSendHighSeverityEvent(t *testing.T) {
 		t.Errorf("POST CRITICAL event: status %d", rec.Code)
 	}
 }
+
+func TestServer_Alert_PatchLifecycle(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	ev := &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a1", Type: "process_start", Severity: "CRITICAL",
+		Timestamp: time.Now(), PodName: "p", PodNamespace: "ns",
+		Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}},
+	}
+	_ = ctrl.IngestEvent(ctx, ev)
+	time.Sleep(150 * time.Millisecond)
+	alerts, _ := ctrl.GetAlerts(types.AlertFilter{Limit: 1})
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts))
+	}
+	id := alerts[0].ID
+
+	body := []byte(`{"status":"acked","assignee":"alice"}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/alerts/"+id, bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.handleAlert(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH alert: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var got types.Alert
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode alert: %v", err)
+	}
+	if got.Status != types.AlertStatusAcked || got.Assignee != "alice" {
+		t.Errorf("patched alert: status=%q assignee=%q", got.Status, got.Assignee)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/alerts?status=open", nil)
+	rec = httptest.NewRecorder()
+	srv.handleAlerts(rec, req)
+	var open []*types.Alert
+	if err := json.NewDecoder(rec.Body).Decode(&open); err != nil {
+		t.Fatalf("decode alerts: %v", err)
+	}
+	if len(open) != 0 {
+		t.Errorf("status=open after ack: want 0, got %d", len(open))
+	}
+}
+
+func TestServer_Alert_Errors(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	ctrl := controller.New(cfg, log)
+	srv := New(cfg, ctrl, log)
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPatch, "/api/v1/alerts/missing", `{"status":"acked"}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/v1/alerts/missing", `not json`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/alerts/missing", ``, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/alerts/", ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+		rec := httptest.NewRecorder()
+		srv.handleAlert(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/alerts?status=bogus", nil)
+	rec := httptest.NewRecorder()
+	srv.handleAlerts(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET alerts?status=bogus: status %d", rec.Code)
+	}
+}
+
+func TestServer_Incidents(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	srv := New(cfg, controller.New(cfg, log), log)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/incidents?type=lateral_movement", nil)
+	rec := httptest.NewRecorder()
+	srv.handleIncidents(rec, req)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("GET incidents: status %d body %q", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/v1/incidents/missing", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/incidents/", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/incidents/missing", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		rec := httptest.NewRecorder()
+		srv.handleIncident(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestServer_IOCs(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, IOCExtraction: true}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "ev-1", AgentID: "a1", Timestamp: time.Now(), PodName: "p", PodNamespace: "ns",
+		Process: &types.ProcessEventData{ExeHash: "abc123", SuspiciousIndicators: []string{"possible_cryptominer"}},
+	})
+	time.Sleep(150 * time.Millisecond)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/iocs"+query, nil)
+		rec := httptest.NewRecorder()
+		srv.handleIOCs(rec, req)
+		return rec
+	}
+	var iocs []types.IOC
+	if err := json.NewDecoder(get("?type=hash").Body).Decode(&iocs); err != nil {
+		t.Fatalf("decode iocs: %v", err)
+	}
+	if len(iocs) != 1 || iocs[0].Value != "abc123" {
+		t.Errorf("iocs = %+v", iocs)
+	}
+
+	rec := get("?format=stix")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/stix+json") {
+		t.Errorf("STIX content type = %q", ct)
+	}
+	var bundle struct {
+		Type    string `json:"type"`
+		Objects []struct {
+			Pattern string `json:"pattern"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&bundle); err != nil {
+		t.Fatalf("decode bundle: %v", err)
+	}
+	if bundle.Type != "bundle" || len(bundle.Objects) != 1 || bundle.Objects[0].Pattern != "[file:hashes.'SHA-256' = 'abc123']" {
+		t.Errorf("bundle = %+v", bundle)
+	}
+
+	if rec := get("?format=csv"); rec.Code != http.StatusBadRequest {
+		t.Errorf("format=csv: status %d", rec.Code)
+	}
+}
+
+func TestServer_RuleCoverage(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	srv := New(cfg, controller.New(cfg, log), log)
+
+	get := func(query string) []types.RuleCoverage {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/rules/coverage"+query, nil)
+		rec := httptest.NewRecorder()
+		srv.handleRuleCoverage(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET coverage%s: status %d", query, rec.Code)
+		}
+		var cov []types.RuleCoverage
+		if err := json.NewDecoder(rec.Body).Decode(&cov); err != nil {
+			t.Fatalf("decode coverage: %v", err)
+		}
+		return cov
+	}
+	all := get("")
+	if len(all) == 0 || all[0].RuleID != "APSS-001" || all[0].Fixtures == 0 {
+		t.Errorf("coverage = %+v", all)
+	}
+	if unmatched := get("?unmatched=true"); len(unmatched) != len(all) {
+		t.Errorf("unmatched = %d, want all %d rules on a fresh controller", len(unmatched), len(all))
+	}
+	if untested := get("?untested=true"); len(untested) != 0 {
+		t.Errorf("untested = %+v, want none", untested)
+	}
+}
+
+func TestServer_PatchRule(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	srv := New(cfg, controller.New(cfg, log), log)
+
+	patch := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.handleRule(rec, req)
+		return rec
+	}
+	rec := patch("/api/v1/rules/APSS-001", `{"shadow": true}`)
+	var cov types.RuleCoverage
+	if err := json.NewDecoder(rec.Body).Decode(&cov); err != nil || rec.Code != http.StatusOK || !cov.Shadow || cov.RuleID != "APSS-001" {
+		t.Fatalf("PATCH shadow: status %d, coverage %+v, err %v", rec.Code, cov, err)
+	}
+	if rec := patch("/api/v1/rules/APSS-999", `{"shadow": true}`); rec.Code != http.StatusNotFound {
+		t.Errorf("PATCH unknown rule: status %d", rec.Code)
+	}
+	if rec := patch("/api/v1/rules/APSS-001", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("PATCH without shadow: status %d", rec.Code)
+	}
+	rec = patch("/api/v1/rules/APSS-002", `{"disabled": true}`)
+	cov = types.RuleCoverage{}
+	if err := json.NewDecoder(rec.Body).Decode(&cov); err != nil || rec.Code != http.StatusOK || !cov.Disabled || cov.Shadow {
+		t.Errorf("PATCH disabled: status %d, coverage %+v, err %v", rec.Code, cov, err)
+	}
+}
+
+func TestServer_GrafanaDashboards(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	srv := New(cfg, controller.New(cfg, log), log)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/integrations/grafana/dashboards", nil)
+	rec := httptest.NewRecorder()
+	srv.handleGrafanaDashboards(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET grafana dashboards: status %d", rec.Code)
+	}
+	var dashboards []struct {
+		UID    string `json:"uid"`
+		Panels []struct {
+			Targets []struct {
+				Expr string `json:"expr"`
+			} `json:"targets"`
+		} `json:"panels"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&dashboards); err != nil {
+		t.Fatalf("decode dashboards: %v", err)
+	}
+	if len(dashboards) == 0 || len(dashboards[0].Panels) != len(controller.Metrics()) {
+		t.Fatalf("expected one panel per controller metric, got %+v", dashboards)
+	}
+	found := false
+	for _, p := range dashboards[0].Panels {
+		if strings.Contains(p.Targets[0].Expr, "apss_alerts_generated_total") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected a panel for apss_alerts_generated_total")
+	}
+}
+
+func TestServer_AlertStream(t *testing.T) {
+	if !canListen(t) {
+		return
+	}
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/alerts/stream?severity=critical", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	// One MEDIUM alert (filtered out) then one CRITICAL alert.
+	_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-1", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"shell_spawn"}}})
+	_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{ID: "ev-2", AgentID: "a", Process: &types.ProcessEventData{SuspiciousIndicators: []string{"possible_cryptominer"}}})
+
+	scanner := bufio.NewScanner(resp.Body)
+	deadline := time.After(2 * time.Second)
+	lines := make(chan string)
+	go func() {
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed before alert")
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var a types.Alert
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &a); err != nil {
+				t.Fatalf("decode alert: %v", err)
+			}
+			if a.RuleID != "APSS-002" {
+				t.Errorf("streamed alert rule = %q, want APSS-002 (MEDIUM should be filtered)", a.RuleID)
+			}
+			return
+		case <-deadline:
+			t.Fatal("timed out waiting for streamed alert")
+		}
+	}
+}
+
+func canListen(t *testing.T) bool {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+func TestServer_Heartbeat(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	ctrl := controller.New(cfg, log)
+	srv := New(cfg, ctrl, log)
+
+	body := []byte(`{"agent_id":"agent-1","pod_name":"p","pod_namespace":"ns","monitor_crashes":{"netpolicy":1}}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/agents/heartbeat", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.handleHeartbeat(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("POST heartbeat: status %d", rec.Code)
+	}
+	agents := ctrl.GetAgents()
+	if len(agents) != 1 || agents[0].MonitorCrashes["netpolicy"] != 1 {
+		t.Errorf("agents after heartbeat: %+v", agents)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/agents/heartbeat", bytes.NewReader([]byte(`{}`)))
+	rec = httptest.NewRecorder()
+	srv.handleHeartbeat(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("heartbeat without agent_id: status %d", rec.Code)
+	}
+}
+
+func TestServer_Register(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10}
+	ctrl := controller.New(cfg, log)
+	srv := New(cfg, ctrl, log)
+
+	body := []byte(`{"agent_id":"agent-1","pod_name":"p","pod_namespace":"ns","version":"1.2.3","config_hash":"abc","monitors":["netpolicy"]}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/agents/register", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.handleRegister(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("POST register: status %d", rec.Code)
+	}
+	agents := ctrl.GetAgents()
+	if len(agents) != 1 || agents[0].Version != "1.2.3" || agents[0].Monitors["netpolicy"] != "running" {
+		t.Errorf("agents after register: %+v", agents)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/agents/register", nil)
+	rec = httptest.NewRecorder()
+	srv.handleRegister(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET register: status %d", rec.Code)
+	}
+}
+
+// discardResponse is a ResponseWriter that keeps only the status code.
+type discardResponse struct {
+	header http.Header
+	code   int
+}
+
+func (d *discardResponse) Header() http.Header         { return d.header }
+func (d *discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardResponse) WriteHeader(code int)        { d.code = code }
+
+// BenchmarkServer_Events measures allocations per event from HTTP decode
+// through detection, with the controller processing events concurrently.
+func BenchmarkServer_Events(b *testing.B) {
+	log := logrus.New()
+	log.SetLevel(logrus.ErrorLevel)
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 64, AlertBufferSize: 64}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	body, _ := json.Marshal(types.SecurityEvent{
+		SchemaVersion: types.SchemaVersionV2, ID: "ev-1", AgentID: "a1", Type: "process_start", Severity: "LOW",
+		Timestamp: time.Now(), PodName: "api-0", PodNamespace: "payments",
+		Process: &types.ProcessEventData{PID: 42, PPID: 1, Name: "curl", Cmdline: []string{"curl", "-s", "http://example.com"}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/events", nil)
+	w := &discardResponse{header: http.Header{}}
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			srv.handleEvents(w, req)
+			if w.code != http.StatusServiceUnavailable {
+				break
+			}
+			// The buffer is full; let the controller catch up.
+			runtime.Gosched()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+)
+
+// handleRouting returns the routing table agents pick their replica from,
+// or 404 when replicas do not shard agents and agents keep using the
+// Service.
+func (s *Server) handleRouting(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	table, err := s.controller.RoutingTable()
+	if errors.Is(err, controller.ErrShardingDisabled) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+table.Generation+`"`)
+	json.NewEncoder(w).Encode(table)
+}
+
+// forwardToOwner sends r to the replica at address, which raised the alert
+// r updates. A request that was already forwarded once is not forwarded
+// again, and forwardToOwner reports false for the caller to serve it.
+func (s *Server) forwardToOwner(w http.ResponseWriter, r *http.Request, address string) bool {
+	if r.Header.Get(headerForwardedBy) != "" {
+		return false
+	}
+	target, err := url.Parse(address)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return true
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		s.log.WithError(err).WithField("replica", address).Warn("Failed to forward alert update")
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, "Controller replica unreachable", http.StatusBadGateway)
+	}
+	r.Header.Set(headerForwardedBy, s.cfg.PodName)
+	proxy.ServeHTTP(w, r)
+	return true
+}
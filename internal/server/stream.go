@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// streamKeepAlive is how often an SSE comment is sent to keep idle connections open.
+const streamKeepAlive = 15 * time.Second
+
+// handleAlertStream pushes new alerts to the client as Server-Sent Events.
+// It accepts the same selection parameters as /api/v1/alerts (status,
+// severity, rule_id, namespace, pod). Clients that fall behind are evicted
+// and receive a final "evicted" event; they should reconnect and backfill
+// from /api/v1/alerts.
+func (s *Server) handleAlertStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	filter, err := parseAlertFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The server-wide WriteTimeout would otherwise cut the stream.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	alerts, cancel := s.controller.SubscribeAlerts()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case alert, ok := <-alerts:
+			if !ok {
+				fmt.Fprint(w, "event: evicted\ndata: {}\n\n")
+				flusher.Flush()
+				s.log.WithField("remote", r.RemoteAddr).Warn("Evicted slow alert stream client")
+				return
+			}
+			if !filter.Matches(alert) {
+				continue
+			}
+			data, err := json.Marshal(alert)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: alert\ndata: %s\n\n", alert.ID, data)
+			flusher.Flush()
+		}
+	}
+}
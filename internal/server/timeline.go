@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	defaultTimelineLimit = 200
+	maxTimelineLimit     = 1000
+)
+
+// handlePod serves /api/v1/pods/{namespace}/{name}/timeline: the pod's
+// events, alerts and lifecycle in one ordered list. ?since= and ?until=
+// (RFC 3339) bound it, ?order=desc puts the newest first, and ?limit= and
+// ?offset= page through it; the total is in X-Total-Count.
+func (s *Server) handlePod(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/pods/"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] != "timeline" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseTimelineQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Namespace, q.Pod = parts[0], parts[1]
+
+	timeline, err := s.controller.GetTimeline(r.Context(), q)
+	if errors.Is(err, controller.ErrPodNotFound) {
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(timeline.Total))
+	json.NewEncoder(w).Encode(timeline)
+}
+
+func parseTimelineQuery(q url.Values) (types.TimelineQuery, error) {
+	tq := types.TimelineQuery{Order: q.Get("order"), Limit: defaultTimelineLimit}
+	switch tq.Order {
+	case "", types.SortAsc, types.SortDesc:
+	default:
+		return tq, fmt.Errorf("invalid order %q", tq.Order)
+	}
+	var err error
+	if tq.Since, err = parseTimeParam(q, "since"); err != nil {
+		return tq, err
+	}
+	if tq.Until, err = parseTimeParam(q, "until"); err != nil {
+		return tq, err
+	}
+	if v := q.Get("limit"); v != "" {
+		if tq.Limit, err = strconv.Atoi(v); err != nil || tq.Limit < 1 {
+			return tq, fmt.Errorf("invalid limit %q", v)
+		}
+		if tq.Limit > maxTimelineLimit {
+			tq.Limit = maxTimelineLimit
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if tq.Offset, err = strconv.Atoi(v); err != nil || tq.Offset < 0 {
+			return tq, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	return tq, nil
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_PodTimeline(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, EventRetentionCount: 100}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	for i, id := range []string{"ev-1", "ev-2", "ev-3"} {
+		_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{
+			ID: id, AgentID: "a1", Type: "network_connection", Severity: "INFO", Timestamp: time.Now().Add(time.Duration(i) * time.Second),
+			PodName: "web-1", PodNamespace: "prod", Network: &types.NetworkEventData{DstIP: "10.0.0.5", DstPort: 5432},
+		})
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.handlePod(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	var rec *httptest.ResponseRecorder
+	for {
+		rec = get("/api/v1/pods/prod/web-1/timeline?limit=2&offset=1")
+		if rec.Code == http.StatusOK && rec.Header().Get("X-Total-Count") == "3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeline status %d, total %q", rec.Code, rec.Header().Get("X-Total-Count"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var tl types.Timeline
+	if err := json.NewDecoder(rec.Body).Decode(&tl); err != nil {
+		t.Fatal(err)
+	}
+	if len(tl.Entries) != 2 || tl.Entries[0].ID != "ev-2" || tl.Entries[0].Kind != types.TimelineEvent {
+		t.Errorf("timeline = %+v", tl)
+	}
+
+	for path, code := range map[string]int{
+		"/api/v1/pods/prod/web-2/timeline":           http.StatusNotFound,
+		"/api/v1/pods/prod/web-1":                    http.StatusNotFound,
+		"/api/v1/pods/prod/web-1/timeline?order=up":  http.StatusBadRequest,
+		"/api/v1/pods/prod/web-1/timeline?offset=-1": http.StatusBadRequest,
+	} {
+		if rec := get(path); rec.Code != code {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// handleSuppressAlert accepts a triage hint of alert id as a suppression.
+// The body, a types.SuppressRequest, is optional.
+func (s *Server) handleSuppressAlert(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req types.SuppressRequest
+	if err := json.NewDecoder(s.limitBody(w, r)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	sup, err := s.controller.SuppressAlert(id, req)
+	s.writeSuppression(w, sup, err)
+}
+
+// handleSuppressions lists suppressions on GET and adds one from a
+// types.Suppression body, such as a hint's suggested suppression, on POST.
+func (s *Server) handleSuppressions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.controller.GetSuppressions())
+	case http.MethodPost:
+		var sup types.Suppression
+		if err := json.NewDecoder(s.limitBody(w, r)).Decode(&sup); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		added, err := s.controller.AddSuppression(sup)
+		s.writeSuppression(w, added, err)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSuppression serves DELETE on /api/v1/suppressions/{id}.
+func (s *Server) handleSuppression(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/suppressions/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.controller.DeleteSuppression(id); errors.Is(err, controller.ErrSuppressionNotFound) {
+		http.Error(w, "Suppression not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writeSuppression(w http.ResponseWriter, sup *types.Suppression, err error) {
+	switch {
+	case errors.Is(err, controller.ErrAlertNotFound):
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	case errors.Is(err, controller.ErrInvalidSuppression):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sup)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/controller"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestServer_SuppressAlert(t *testing.T) {
+	log := logrus.New()
+	cfg := config.ControllerConfig{HTTPAddr: ":0", EventBufferSize: 10, AlertBufferSize: 10, TriageWindow: 5 * time.Second}
+	ctrl := controller.New(cfg, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl.Start(ctx)
+	srv := New(cfg, ctrl, log)
+
+	now := time.Now()
+	_ = ctrl.IngestEvent(ctx, &types.SecurityEvent{
+		ID: "audit-1", AgentID: "apss-webhook", Type: "k8s_audit", Severity: "INFO", Timestamp: now, PodName: "p", PodNamespace: "ns",
+		Audit: &types.AuditEventData{Verb: "connect", Resource: "pods/exec", Name: "p", Namespace: "ns", User: "alice"},
+	})
+	shell := func(id string) *types.SecurityEvent {
+		return &types.SecurityEvent{
+			ID: id, AgentID: "a1", Type: "process_start", Severity: "MEDIUM", Timestamp: now.Add(time.Second), PodName: "p", PodNamespace: "ns",
+			Process: &types.ProcessEventData{Name: "bash", SuspiciousIndicators: []string{"shell_spawn"}},
+		}
+	}
+	_ = ctrl.IngestEvent(ctx, shell("ev-1"))
+	time.Sleep(150 * time.Millisecond)
+	alerts, _ := ctrl.GetAlerts(types.AlertFilter{RuleID: "APSS-004"})
+	if len(alerts) != 1 || len(alerts[0].Hints) != 1 || alerts[0].Hints[0].Cause != types.CauseKubectlExec {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/alerts/"+alerts[0].ID+"/suppress", nil)
+	rec := httptest.NewRecorder()
+	srv.handleAlert(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST suppress: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var sup types.Suppression
+	if err := json.NewDecoder(rec.Body).Decode(&sup); err != nil || sup.Cause != types.CauseKubectlExec {
+		t.Fatalf("suppression = %+v, err %v", sup, err)
+	}
+
+	_ = ctrl.IngestEvent(ctx, shell("ev-2"))
+	time.Sleep(150 * time.Millisecond)
+	if alerts, _ := ctrl.GetAlerts(types.AlertFilter{RuleID: "APSS-004"}); len(alerts) != 1 {
+		t.Errorf("suppressed alert retained: %d alerts", len(alerts))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/suppressions", nil)
+	rec = httptest.NewRecorder()
+	srv.handleSuppressions(rec, req)
+	var list []*types.Suppression
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list) != 1 || list[0].Matches != 1 {
+		t.Fatalf("GET suppressions = %s", rec.Body.String())
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/v1/alerts/missing/suppress", ``, http.StatusNotFound},
+		{http.MethodGet, "/api/v1/alerts/missing/suppress", ``, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/alerts/" + alerts[0].ID + "/suppress", `{"ttl":"never"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/suppressions", `{"namespace":"ns"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/suppressions/" + sup.ID, ``, http.StatusNoContent},
+		{http.MethodDelete, "/api/v1/suppressions/" + sup.ID, ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+		rec := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
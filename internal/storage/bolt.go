@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltDB keeps each kind in a bucket keyed by a big-endian sequence
+// number, so a cursor walks records in the order they were first stored. A
+// second bucket per kind maps record IDs to their keys.
+type boltDB struct {
+	db *bolt.DB
+}
+
+func openBolt(path string) (*boltDB, error) {
+	if path == "" {
+		return nil, errors.New("bbolt storage needs a path")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("create storage directory: %w", err)
+	}
+	// The timeout fails the open, instead of hanging, while another process
+	// holds the file.
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, kind := range allKinds {
+			if _, err := tx.CreateBucketIfNotExists([]byte(kind)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucketIfNotExists(idsBucket(kind)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create buckets: %w", err)
+	}
+	return &boltDB{db: db}, nil
+}
+
+func idsBucket(kind string) []byte {
+	return []byte(kind + ".ids")
+}
+
+// encodeBolt lays a record out as its time in Unix nanoseconds, the length
+// of its ID, the ID and the data.
+func encodeBolt(r record) []byte {
+	buf := make([]byte, 8, 8+binary.MaxVarintLen64+len(r.id)+len(r.data))
+	binary.BigEndian.PutUint64(buf, uint64(r.at.UnixNano()))
+	buf = binary.AppendUvarint(buf, uint64(len(r.id)))
+	buf = append(buf, r.id...)
+	return append(buf, r.data...)
+}
+
+func decodeBolt(v []byte) (record, error) {
+	if len(v) < 8 {
+		return record{}, errors.New("short record")
+	}
+	at := time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+	n, size := binary.Uvarint(v[8:])
+	if size <= 0 || uint64(len(v)-8-size) < n {
+		return record{}, errors.New("corrupt record")
+	}
+	id := v[8+size : 8+size+int(n)]
+	return record{id: string(id), at: at, data: v[8+size+int(n):]}, nil
+}
+
+func (b *boltDB) put(_ context.Context, kind string, recs []record) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, ids := tx.Bucket([]byte(kind)), tx.Bucket(idsBucket(kind))
+		for _, r := range recs {
+			key := ids.Get([]byte(r.id))
+			if r.id == "" || key == nil {
+				seq, err := bucket.NextSequence()
+				if err != nil {
+					return err
+				}
+				key = binary.BigEndian.AppendUint64(nil, seq)
+				if r.id != "" {
+					if err := ids.Put([]byte(r.id), key); err != nil {
+						return err
+					}
+				}
+			}
+			if err := bucket.Put(key, encodeBolt(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltDB) recent(_ context.Context, kind string, since time.Time, limit int) ([][]byte, error) {
+	var out [][]byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(kind)).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(out) < limit); k, v = c.Prev() {
+			r, err := decodeBolt(v)
+			if err != nil {
+				return fmt.Errorf("key %x: %w", k, err)
+			}
+			if !r.at.Before(since) {
+				// Values are only valid for the transaction.
+				out = append(out, bytes.Clone(r.data))
+			}
+		}
+		return nil
+	})
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, err
+}
+
+func (b *boltDB) remove(_ context.Context, kind, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		ids := tx.Bucket(idsBucket(kind))
+		key := ids.Get([]byte(id))
+		if key == nil {
+			return nil
+		}
+		if err := tx.Bucket([]byte(kind)).Delete(key); err != nil {
+			return err
+		}
+		return ids.Delete([]byte(id))
+	})
+}
+
+func (b *boltDB) prune(_ context.Context, kind string, cutoff time.Time) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		ids := tx.Bucket(idsBucket(kind))
+		c := tx.Bucket([]byte(kind)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			r, err := decodeBolt(v)
+			if err != nil {
+				return fmt.Errorf("key %x: %w", k, err)
+			}
+			if !r.at.Before(cutoff) {
+				return nil
+			}
+			if r.id != "" {
+				if err := ids.Delete([]byte(r.id)); err != nil {
+					return err
+				}
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltDB) close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memory keeps records in process. Nothing survives a restart, so it is
+// meant for tests and development.
+type memory struct {
+	mu    sync.Mutex
+	kinds map[string][]record
+}
+
+func newMemory() *memory {
+	return &memory{kinds: make(map[string][]record)}
+}
+
+func (m *memory) put(_ context.Context, kind string, recs []record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range recs {
+		if i := m.index(kind, r.id); i >= 0 {
+			m.kinds[kind][i] = r
+			continue
+		}
+		m.kinds[kind] = append(m.kinds[kind], r)
+	}
+	return nil
+}
+
+func (m *memory) recent(_ context.Context, kind string, since time.Time, limit int) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out [][]byte
+	recs := m.kinds[kind]
+	for i := len(recs) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if !recs[i].at.Before(since) {
+			out = append(out, recs[i].data)
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (m *memory) remove(_ context.Context, kind, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.index(kind, id); i >= 0 {
+		recs := m.kinds[kind]
+		m.kinds[kind] = append(recs[:i:i], recs[i+1:]...)
+	}
+	return nil
+}
+
+func (m *memory) prune(_ context.Context, kind string, cutoff time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.kinds[kind][:0]
+	for _, r := range m.kinds[kind] {
+		if !r.at.Before(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	m.kinds[kind] = kept
+	return nil
+}
+
+func (m *memory) close() error {
+	return nil
+}
+
+// index returns the position of id in kind, or -1. Caller must hold mu.
+func (m *memory) index(kind, id string) int {
+	if id == "" {
+		return -1
+	}
+	recs := m.kinds[kind]
+	for i := len(recs) - 1; i >= 0; i-- {
+		if recs[i].id == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles are the Postgres schema migrations, named
+// NNNN_description.sql and applied in version order. A released migration
+// is never edited; schema changes add a new one.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	// ErrSchemaTooNew is returned when the database was migrated by a newer
+	// controller than this one, whose code may not match the schema.
+	ErrSchemaTooNew = errors.New("database schema is newer than this controller supports")
+	// ErrPendingMigrations is returned when migrations are needed but
+	// Config.Migrate is off.
+	ErrPendingMigrations = errors.New("database schema has pending migrations")
+	// ErrNoMigrations is returned by MigrationStatus for backends without
+	// a schema.
+	ErrNoMigrations = errors.New("storage backend has no schema migrations")
+)
+
+// migrationLockID is the Postgres advisory lock held while migrating, so
+// replicas starting together apply each migration once.
+const migrationLockID = 0x61707373 // "apss"
+
+var migrationName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.sql$`)
+
+// Migration is one schema change.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	SQL     string `json:"-"`
+}
+
+// AppliedMigration is a migration recorded in the database.
+type AppliedMigration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// MigrationStatus is a database's schema version against the migrations
+// this controller embeds.
+type MigrationStatus struct {
+	Backend string `json:"backend"`
+	// Version is the latest applied migration, 0 for an empty database.
+	Version int                `json:"version"`
+	Latest  int                `json:"latest"`
+	Applied []AppliedMigration `json:"applied"`
+	Pending []Migration        `json:"pending,omitempty"`
+}
+
+// Migrations returns the embedded Postgres migrations in version order.
+func Migrations() ([]Migration, error) {
+	return parseMigrations(migrationFiles, "migrations")
+}
+
+// parseMigrations reads the migrations in dir, which must be numbered 1, 2,
+// 3 and so on without gaps.
+func parseMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, ent := range entries {
+		m := migrationName.FindStringSubmatch(ent.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name is not NNNN_description.sql", ent.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, ent.Name()))
+		if err != nil {
+			return nil, err
+		}
+		version, _ := strconv.Atoi(m[1])
+		out = append(out, Migration{Version: version, Name: m[2], SQL: string(data)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s: expected version %d", m.Version, m.Name, i+1)
+		}
+	}
+	return out, nil
+}
+
+// PlanMigrations reports the schema version of the Postgres database at
+// dsn and the migrations the controller would apply, without changing it.
+func PlanMigrations(ctx context.Context, dsn string) (*MigrationStatus, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+	defer db.Close()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	defer conn.Close()
+	return migrationStatus(ctx, conn)
+}
+
+// migrate brings the database's schema up to date, or only checks it when
+// apply is false, and returns its status after.
+func migrate(ctx context.Context, db *sql.DB, apply bool) (*MigrationStatus, error) {
+	// The advisory lock belongs to the session, so everything runs on one
+	// connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return nil, fmt.Errorf("lock schema: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	status, err := migrationStatus(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if status.Version > status.Latest {
+		return status, fmt.Errorf("%w: version %d, latest known %d", ErrSchemaTooNew, status.Version, status.Latest)
+	}
+	if len(status.Pending) == 0 {
+		return status, nil
+	}
+	if !apply {
+		return status, fmt.Errorf("%w: version %d, latest %d", ErrPendingMigrations, status.Version, status.Latest)
+	}
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS apss_schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return status, fmt.Errorf("create migrations table: %w", err)
+	}
+	for _, m := range status.Pending {
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return status, err
+		}
+	}
+	return migrationStatus(ctx, conn)
+}
+
+// applyMigration runs m and records it in one transaction, so a failed
+// migration leaves no trace.
+func applyMigration(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO apss_schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+		return fmt.Errorf("record migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	return tx.Commit()
+}
+
+// migrationStatus reads the applied migrations. A database without the
+// migrations table has none.
+func migrationStatus(ctx context.Context, conn *sql.Conn) (*MigrationStatus, error) {
+	all, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	status := &MigrationStatus{Backend: BackendPostgres, Latest: len(all), Applied: []AppliedMigration{}}
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass('apss_schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("read schema version: %w", err)
+	}
+	if exists {
+		rows, err := conn.QueryContext(ctx, `SELECT version, name, applied_at FROM apss_schema_migrations ORDER BY version`)
+		if err != nil {
+			return nil, fmt.Errorf("read schema version: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var a AppliedMigration
+			if err := rows.Scan(&a.Version, &a.Name, &a.AppliedAt); err != nil {
+				return nil, err
+			}
+			status.Applied = append(status.Applied, a)
+			if a.Version > status.Version {
+				status.Version = a.Version
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range all {
+		if m.Version > status.Version {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+	return status, nil
+}
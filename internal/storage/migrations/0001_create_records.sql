@@ -0,0 +1,11 @@
+-- Every kind of record in one table. seq orders records by when they were
+-- first stored; the partial index makes IDs unique per kind.
+CREATE TABLE IF NOT EXISTS apss_records (
+	seq  BIGSERIAL PRIMARY KEY,
+	kind TEXT NOT NULL,
+	id   TEXT NOT NULL,
+	at   TIMESTAMPTZ NOT NULL,
+	data JSONB NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS apss_records_kind_id ON apss_records (kind, id) WHERE id <> '';
+CREATE INDEX IF NOT EXISTS apss_records_kind_at ON apss_records (kind, at);
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// Registers the "postgres" database/sql driver.
+	_ "github.com/lib/pq"
+)
+
+// postgres stores records in a database shared by every controller
+// replica, so a new leader starts from what the previous one stored. Its
+// schema is kept up to date by the embedded migrations.
+type postgres struct {
+	db *sql.DB
+}
+
+// openPostgres connects to dsn and migrates its schema, or when apply is
+// false fails if the schema is not current.
+func openPostgres(ctx context.Context, dsn string, apply bool) (*postgres, error) {
+	if dsn == "" {
+		return nil, errors.New("postgres storage needs a DSN")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+	if _, err := migrate(ctx, db, apply); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &postgres{db: db}, nil
+}
+
+func (p *postgres) put(ctx context.Context, kind string, recs []record) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO apss_records (kind, id, at, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kind, id) WHERE id <> '' DO UPDATE SET at = EXCLUDED.at, data = EXCLUDED.data`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range recs {
+		if _, err := stmt.ExecContext(ctx, kind, r.id, r.at, r.data); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *postgres) recent(ctx context.Context, kind string, since time.Time, limit int) ([][]byte, error) {
+	// A NULL limit is no limit.
+	var lim sql.NullInt64
+	if limit > 0 {
+		lim = sql.NullInt64{Int64: int64(limit), Valid: true}
+	}
+	rows, err := p.db.QueryContext(ctx, `SELECT data FROM (
+		SELECT seq, data FROM apss_records WHERE kind = $1 AND at >= $2 ORDER BY seq DESC LIMIT $3
+	) r ORDER BY seq`, kind, since, lim)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out [][]byte
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		out = append(out, data)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgres) remove(ctx context.Context, kind, id string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM apss_records WHERE kind = $1 AND id = $2`, kind, id)
+	return err
+}
+
+func (p *postgres) prune(ctx context.Context, kind string, cutoff time.Time) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM apss_records WHERE kind = $1 AND at < $2`, kind, cutoff)
+	return err
+}
+
+func (p *postgres) status(ctx context.Context) (*MigrationStatus, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return migrationStatus(ctx, conn)
+}
+
+func (p *postgres) close() error {
+	return p.db.Close()
+}
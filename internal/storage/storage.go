@@ -0,0 +1,251 @@
+// Package storage persists the controller's events, alerts, incidents,
+// suppressions and audit log. The backend is chosen by deployment size:
+// memory for tests, bbolt for a single replica and Postgres for replicas
+// sharing one store.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// Backends accepted by Open.
+const (
+	BackendMemory   = "memory"
+	BackendBolt     = "bbolt"
+	BackendPostgres = "postgres"
+)
+
+// ErrUnknownBackend is returned by Open for a backend it does not know.
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Record kinds, each kept apart by the backends.
+const (
+	kindEvents       = "events"
+	kindAlerts       = "alerts"
+	kindIncidents    = "incidents"
+	kindSuppressions = "suppressions"
+	kindAudit        = "audit"
+)
+
+var (
+	allKinds = []string{kindEvents, kindAlerts, kindIncidents, kindSuppressions, kindAudit}
+	// timedKinds are pruned by age; suppressions are removed once expired.
+	timedKinds = []string{kindEvents, kindAlerts, kindIncidents, kindAudit}
+)
+
+// Storage persists controller records. Each list is oldest first, in the
+// order records were first stored; storing a record again under the same
+// ID replaces it in place.
+type Storage interface {
+	AppendEvents(ctx context.Context, events []*types.SecurityEvent) error
+	// RecentEvents returns up to limit of the newest events; 0 is no limit.
+	RecentEvents(ctx context.Context, limit int) ([]*types.SecurityEvent, error)
+	PutAlert(ctx context.Context, alert *types.Alert) error
+	RecentAlerts(ctx context.Context, limit int) ([]*types.Alert, error)
+	PutIncident(ctx context.Context, incident *types.Incident) error
+	RecentIncidents(ctx context.Context, limit int) ([]*types.Incident, error)
+	PutSuppression(ctx context.Context, s *types.Suppression) error
+	DeleteSuppression(ctx context.Context, id string) error
+	Suppressions(ctx context.Context) ([]*types.Suppression, error)
+	AppendAudit(ctx context.Context, entry *types.AuditEntry) error
+	// AuditLog returns up to limit of the newest entries at or after since.
+	AuditLog(ctx context.Context, since time.Time, limit int) ([]*types.AuditEntry, error)
+	// Prune removes events, alerts, incidents and audit entries from before
+	// cutoff, and expired suppressions.
+	Prune(ctx context.Context, cutoff time.Time) error
+	// MigrationStatus reports the schema version, or ErrNoMigrations for
+	// backends without a schema.
+	MigrationStatus(ctx context.Context) (*MigrationStatus, error)
+	Close() error
+}
+
+// Config selects and configures a backend.
+type Config struct {
+	// Backend is BackendMemory, BackendBolt or BackendPostgres.
+	Backend string
+	// Path is the bbolt database file.
+	Path string
+	// PostgresDSN is the Postgres connection string.
+	PostgresDSN string
+	// Migrate applies pending schema migrations on open; otherwise a
+	// database that needs them fails to open with ErrPendingMigrations.
+	Migrate bool
+}
+
+// Open returns the backend cfg selects.
+func Open(ctx context.Context, cfg Config) (Storage, error) {
+	var (
+		b   backend
+		err error
+	)
+	switch cfg.Backend {
+	case BackendMemory:
+		b = newMemory()
+	case BackendBolt:
+		b, err = openBolt(cfg.Path)
+	case BackendPostgres:
+		b, err = openPostgres(ctx, cfg.PostgresDSN, cfg.Migrate)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &store{b: b}, nil
+}
+
+// record is one stored record: its ID, the time it is pruned by, and its
+// JSON encoding.
+type record struct {
+	id   string
+	at   time.Time
+	data []byte
+}
+
+// backend stores records of each kind as opaque documents; store maps the
+// controller's types onto it.
+type backend interface {
+	// put stores recs in order, replacing records with the same non-empty
+	// ID in place.
+	put(ctx context.Context, kind string, recs []record) error
+	// recent returns the data of up to limit of the newest records at or
+	// after since, oldest first; limit 0 is no limit.
+	recent(ctx context.Context, kind string, since time.Time, limit int) ([][]byte, error)
+	remove(ctx context.Context, kind, id string) error
+	// prune removes records from before cutoff. Records are assumed to be
+	// stored in time order; backends may stop at the first newer record.
+	prune(ctx context.Context, kind string, cutoff time.Time) error
+	close() error
+}
+
+// migrator is a backend with a versioned schema.
+type migrator interface {
+	status(ctx context.Context) (*MigrationStatus, error)
+}
+
+type store struct {
+	b backend
+}
+
+func (s *store) AppendEvents(ctx context.Context, events []*types.SecurityEvent) error {
+	recs := make([]record, 0, len(events))
+	for _, e := range events {
+		r, err := newRecord(e.ID, e.Timestamp, e)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, r)
+	}
+	return s.b.put(ctx, kindEvents, recs)
+}
+
+func (s *store) RecentEvents(ctx context.Context, limit int) ([]*types.SecurityEvent, error) {
+	return recent[types.SecurityEvent](ctx, s.b, kindEvents, time.Time{}, limit)
+}
+
+func (s *store) PutAlert(ctx context.Context, alert *types.Alert) error {
+	return s.putOne(ctx, kindAlerts, alert.ID, alert.Timestamp, alert)
+}
+
+func (s *store) RecentAlerts(ctx context.Context, limit int) ([]*types.Alert, error) {
+	return recent[types.Alert](ctx, s.b, kindAlerts, time.Time{}, limit)
+}
+
+func (s *store) PutIncident(ctx context.Context, incident *types.Incident) error {
+	return s.putOne(ctx, kindIncidents, incident.ID, incident.Timestamp, incident)
+}
+
+func (s *store) RecentIncidents(ctx context.Context, limit int) ([]*types.Incident, error) {
+	return recent[types.Incident](ctx, s.b, kindIncidents, time.Time{}, limit)
+}
+
+func (s *store) PutSuppression(ctx context.Context, sup *types.Suppression) error {
+	return s.putOne(ctx, kindSuppressions, sup.ID, sup.CreatedAt, sup)
+}
+
+func (s *store) DeleteSuppression(ctx context.Context, id string) error {
+	return s.b.remove(ctx, kindSuppressions, id)
+}
+
+func (s *store) Suppressions(ctx context.Context) ([]*types.Suppression, error) {
+	return recent[types.Suppression](ctx, s.b, kindSuppressions, time.Time{}, 0)
+}
+
+func (s *store) AppendAudit(ctx context.Context, entry *types.AuditEntry) error {
+	return s.putOne(ctx, kindAudit, entry.ID, entry.Time, entry)
+}
+
+func (s *store) AuditLog(ctx context.Context, since time.Time, limit int) ([]*types.AuditEntry, error) {
+	return recent[types.AuditEntry](ctx, s.b, kindAudit, since, limit)
+}
+
+func (s *store) Prune(ctx context.Context, cutoff time.Time) error {
+	for _, kind := range timedKinds {
+		if err := s.b.prune(ctx, kind, cutoff); err != nil {
+			return fmt.Errorf("prune %s: %w", kind, err)
+		}
+	}
+	sups, err := s.Suppressions(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, sup := range sups {
+		if sup.ExpiresAt != nil && !now.Before(*sup.ExpiresAt) {
+			if err := s.b.remove(ctx, kindSuppressions, sup.ID); err != nil {
+				return fmt.Errorf("prune suppressions: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *store) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	m, ok := s.b.(migrator)
+	if !ok {
+		return nil, ErrNoMigrations
+	}
+	return m.status(ctx)
+}
+
+func (s *store) Close() error {
+	return s.b.close()
+}
+
+func (s *store) putOne(ctx context.Context, kind, id string, at time.Time, v interface{}) error {
+	r, err := newRecord(id, at, v)
+	if err != nil {
+		return err
+	}
+	return s.b.put(ctx, kind, []record{r})
+}
+
+func newRecord(id string, at time.Time, v interface{}) (record, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return record{}, fmt.Errorf("encode %s: %w", id, err)
+	}
+	return record{id: id, at: at, data: data}, nil
+}
+
+func recent[T any](ctx context.Context, b backend, kind string, since time.Time, limit int) ([]*T, error) {
+	docs, err := b.recent(ctx, kind, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", kind, err)
+	}
+	out := make([]*T, 0, len(docs))
+	for _, doc := range docs {
+		v := new(T)
+		if err := json.Unmarshal(doc, v); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", kind, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
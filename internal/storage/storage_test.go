@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// TestStorage runs the same checks against every backend. Postgres runs
+// only when APSS_TEST_POSTGRES_DSN names a scratch database.
+func TestStorage(t *testing.T) {
+	configs := map[string]Config{
+		BackendMemory: {Backend: BackendMemory},
+		BackendBolt:   {Backend: BackendBolt, Path: filepath.Join(t.TempDir(), "db", "apss.db")},
+	}
+	if dsn := os.Getenv("APSS_TEST_POSTGRES_DSN"); dsn != "" {
+		configs[BackendPostgres] = Config{Backend: BackendPostgres, PostgresDSN: dsn, Migrate: true}
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s, err := Open(ctx, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if name == BackendPostgres {
+				s.Prune(ctx, time.Now().Add(24*time.Hour))
+			}
+			testStorage(t, s)
+		})
+	}
+}
+
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+
+	var events []*types.SecurityEvent
+	for i, id := range []string{"e1", "e2", "e3"} {
+		events = append(events, &types.SecurityEvent{ID: id, Type: "process", Timestamp: base.Add(time.Duration(i) * time.Minute)})
+	}
+	if err := s.AppendEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.RecentEvents(ctx, 2)
+	if err != nil || len(got) != 2 || got[0].ID != "e2" || got[1].ID != "e3" || !got[1].Timestamp.Equal(events[2].Timestamp) {
+		t.Fatalf("RecentEvents(2) = %v, %v", got, err)
+	}
+
+	for _, id := range []string{"a1", "a2"} {
+		s.PutAlert(ctx, &types.Alert{ID: id, Timestamp: base, Status: types.AlertStatusOpen})
+	}
+	// An update replaces the alert in place.
+	if err := s.PutAlert(ctx, &types.Alert{ID: "a1", Timestamp: base, Status: types.AlertStatusAcked}); err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := s.RecentAlerts(ctx, 0)
+	if err != nil || len(alerts) != 2 || alerts[0].ID != "a1" || alerts[0].Status != types.AlertStatusAcked {
+		t.Fatalf("RecentAlerts = %v, %v", alerts, err)
+	}
+
+	s.PutIncident(ctx, &types.Incident{ID: "i1", Type: "lateral_movement", Timestamp: base})
+	if incidents, err := s.RecentIncidents(ctx, 10); err != nil || len(incidents) != 1 || incidents[0].Type != "lateral_movement" {
+		t.Errorf("RecentIncidents = %v, %v", incidents, err)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	s.PutSuppression(ctx, &types.Suppression{ID: "s1", RuleID: "APSS-001", CreatedAt: base})
+	s.PutSuppression(ctx, &types.Suppression{ID: "s2", RuleID: "APSS-002", CreatedAt: base})
+	s.PutSuppression(ctx, &types.Suppression{ID: "s3", RuleID: "APSS-003", CreatedAt: base, ExpiresAt: &expired})
+	if err := s.DeleteSuppression(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if sups, err := s.Suppressions(ctx); err != nil || len(sups) != 2 || sups[0].ID != "s2" {
+		t.Errorf("Suppressions = %v, %v", sups, err)
+	}
+
+	s.AppendAudit(ctx, &types.AuditEntry{ID: "audit-1", Time: base, Action: types.AuditAlertUpdated, Target: "a1"})
+	s.AppendAudit(ctx, &types.AuditEntry{ID: "audit-2", Time: base.Add(30 * time.Minute), Action: types.AuditSuppressionDeleted, Target: "s1"})
+	if log, err := s.AuditLog(ctx, base.Add(time.Minute), 0); err != nil || len(log) != 1 || log[0].Target != "s1" {
+		t.Errorf("AuditLog since = %v, %v", log, err)
+	}
+
+	if err := s.Prune(ctx, base.Add(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.RecentEvents(ctx, 0); len(got) != 1 || got[0].ID != "e3" {
+		t.Errorf("events after prune = %v", got)
+	}
+	if alerts, _ := s.RecentAlerts(ctx, 0); len(alerts) != 0 {
+		t.Errorf("alerts after prune = %v", alerts)
+	}
+	if sups, _ := s.Suppressions(ctx); len(sups) != 1 || sups[0].ID != "s2" {
+		t.Errorf("suppressions after prune = %v", sups)
+	}
+	if log, _ := s.AuditLog(ctx, time.Time{}, 0); len(log) != 1 {
+		t.Errorf("audit after prune = %v", log)
+	}
+}
+
+func TestBolt_Reopen(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{Backend: BackendBolt, Path: filepath.Join(t.TempDir(), "apss.db")}
+	s, err := Open(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PutAlert(ctx, &types.Alert{ID: "a1", Timestamp: time.Now()})
+	s.Close()
+
+	if s, err = Open(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if alerts, err := s.RecentAlerts(ctx, 0); err != nil || len(alerts) != 1 || alerts[0].ID != "a1" {
+		t.Errorf("alerts after reopen = %v, %v", alerts, err)
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Open(ctx, Config{Backend: "sqlite"}); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("unknown backend: %v", err)
+	}
+	if _, err := Open(ctx, Config{Backend: BackendBolt}); err == nil {
+		t.Error("bbolt without a path opened")
+	}
+	if _, err := Open(ctx, Config{Backend: BackendPostgres}); err == nil {
+		t.Error("postgres without a DSN opened")
+	}
+	s, _ := Open(ctx, Config{Backend: BackendMemory})
+	if _, err := s.MigrationStatus(ctx); !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("memory migration status: %v", err)
+	}
+}
+
+func TestParseMigrations(t *testing.T) {
+	all, err := Migrations()
+	if err != nil || len(all) == 0 || all[0].Version != 1 || all[0].Name != "create_records" {
+		t.Fatalf("embedded migrations = %v, %v", all, err)
+	}
+	for name, files := range map[string]fstest.MapFS{
+		"bad name": {"m/0001_init.sql": {}, "m/init2.sql": {}},
+		"gap":      {"m/0001_init.sql": {}, "m/0003_more.sql": {}},
+	} {
+		if _, err := parseMigrations(files, "m"); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+// TestPostgres_Migrations needs APSS_TEST_POSTGRES_DSN, like TestStorage.
+func TestPostgres_Migrations(t *testing.T) {
+	dsn := os.Getenv("APSS_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("APSS_TEST_POSTGRES_DSN not set")
+	}
+	ctx := context.Background()
+	s, err := Open(ctx, Config{Backend: BackendPostgres, PostgresDSN: dsn, Migrate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	status, err := s.MigrationStatus(ctx)
+	if err != nil || status.Version != status.Latest || len(status.Pending) != 0 || len(status.Applied) != status.Latest {
+		t.Errorf("status = %+v, %v", status, err)
+	}
+	if plan, err := PlanMigrations(ctx, dsn); err != nil || len(plan.Pending) != 0 {
+		t.Errorf("plan = %+v, %v", plan, err)
+	}
+}
@@ -0,0 +1,95 @@
+package threatintel
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// STIXMediaType is the content type of a STIX 2.1 bundle.
+const STIXMediaType = "application/stix+json;version=2.1"
+
+// stixNamespace seeds the deterministic object IDs, so re-exporting an IOC
+// yields the same indicator ID and consumers update rather than duplicate it.
+const stixNamespace = "apss-autopilot-security-sensor"
+
+// STIXBundle is a STIX 2.1 bundle of indicator objects.
+type STIXBundle struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Objects []STIXIndicator `json:"objects"`
+}
+
+// STIXIndicator is a STIX 2.1 indicator object.
+type STIXIndicator struct {
+	Type           string    `json:"type"`
+	SpecVersion    string    `json:"spec_version"`
+	ID             string    `json:"id"`
+	Created        time.Time `json:"created"`
+	Modified       time.Time `json:"modified"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description,omitempty"`
+	IndicatorTypes []string  `json:"indicator_types"`
+	Pattern        string    `json:"pattern"`
+	PatternType    string    `json:"pattern_type"`
+	ValidFrom      time.Time `json:"valid_from"`
+}
+
+// stixID returns a UUIDv5-style identifier for an object of type typ derived
+// from name.
+func stixID(typ, name string) string {
+	h := sha1.Sum([]byte(stixNamespace + "/" + name))
+	h[6] = (h[6] & 0x0f) | 0x50
+	h[8] = (h[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%s--%x-%x-%x-%x-%x", typ, h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// stixPattern returns the STIX pattern for an IOC, or "" for unknown types.
+func stixPattern(ioc types.IOC) string {
+	value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(ioc.Value)
+	switch ioc.Type {
+	case types.IOCTypeIP:
+		if ip := net.ParseIP(ioc.Value); ip != nil && ip.To4() == nil {
+			return fmt.Sprintf("[ipv6-addr:value = '%s']", value)
+		}
+		return fmt.Sprintf("[ipv4-addr:value = '%s']", value)
+	case types.IOCTypeDomain:
+		return fmt.Sprintf("[domain-name:value = '%s']", value)
+	case types.IOCTypeHash:
+		return fmt.Sprintf("[file:hashes.'SHA-256' = '%s']", value)
+	}
+	return ""
+}
+
+// ToSTIX converts IOCs to a STIX 2.1 bundle of indicators.
+func ToSTIX(iocs []types.IOC) STIXBundle {
+	b := STIXBundle{Type: "bundle", Objects: make([]STIXIndicator, 0, len(iocs))}
+	names := make([]string, 0, len(iocs))
+	for _, ioc := range iocs {
+		pattern := stixPattern(ioc)
+		if pattern == "" {
+			continue
+		}
+		name := ioc.Type + ":" + ioc.Value
+		names = append(names, name)
+		b.Objects = append(b.Objects, STIXIndicator{
+			Type:           "indicator",
+			SpecVersion:    "2.1",
+			ID:             stixID("indicator", name),
+			Created:        ioc.FirstSeen.UTC(),
+			Modified:       ioc.LastSeen.UTC(),
+			Name:           fmt.Sprintf("%s %s", ioc.Type, ioc.Value),
+			Description:    fmt.Sprintf("Extracted from %s alert %s in %s/%s", ioc.RuleID, ioc.AlertID, ioc.PodNamespace, ioc.PodName),
+			IndicatorTypes: []string{"malicious-activity"},
+			Pattern:        pattern,
+			PatternType:    "stix",
+			ValidFrom:      ioc.FirstSeen.UTC(),
+		})
+	}
+	b.ID = stixID("bundle", strings.Join(names, ","))
+	return b
+}
@@ -0,0 +1,42 @@
+package threatintel
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestToSTIX(t *testing.T) {
+	seen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	iocs := []types.IOC{
+		{Type: types.IOCTypeIP, Value: "198.51.100.9", RuleID: "APSS-001", FirstSeen: seen, LastSeen: seen},
+		{Type: types.IOCTypeIP, Value: "2001:db8::1", FirstSeen: seen, LastSeen: seen},
+		{Type: types.IOCTypeDomain, Value: "drop.example", FirstSeen: seen, LastSeen: seen},
+		{Type: types.IOCTypeHash, Value: "abcdef", FirstSeen: seen, LastSeen: seen},
+		{Type: "url", Value: "http://x"},
+	}
+	b := ToSTIX(iocs)
+	if b.Type != "bundle" || len(b.Objects) != 4 {
+		t.Fatalf("bundle = %+v", b)
+	}
+	want := []string{
+		"[ipv4-addr:value = '198.51.100.9']",
+		"[ipv6-addr:value = '2001:db8::1']",
+		"[domain-name:value = 'drop.example']",
+		"[file:hashes.'SHA-256' = 'abcdef']",
+	}
+	id := regexp.MustCompile(`^indicator--[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for i, obj := range b.Objects {
+		if obj.Pattern != want[i] {
+			t.Errorf("pattern[%d] = %q, want %q", i, obj.Pattern, want[i])
+		}
+		if !id.MatchString(obj.ID) || obj.SpecVersion != "2.1" || !obj.ValidFrom.Equal(seen) {
+			t.Errorf("indicator[%d] = %+v", i, obj)
+		}
+	}
+	if again := ToSTIX(iocs); again.Objects[0].ID != b.Objects[0].ID || again.ID != b.ID {
+		t.Error("STIX IDs are not stable across exports")
+	}
+}
@@ -0,0 +1,324 @@
+// Package threatintel downloads IP and domain blocklists and matches events
+// against them and against IOCs extracted locally, so detection rules can
+// alert on known-bad destinations and binaries.
+package threatintel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+// maxFeedSize bounds a single feed download.
+const maxFeedSize = 64 << 20
+
+// LocalFeed is the feed name reported in matches of locally extracted IOCs.
+const LocalFeed = "apss:extracted"
+
+var (
+	feedIndicators = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_threatintel_indicators",
+			Help: "Number of indicators loaded from each threat intelligence feed",
+		},
+		[]string{"feed"},
+	)
+	feedRefreshErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_threatintel_refresh_errors_total",
+			Help: "Total failed threat intelligence feed downloads",
+		},
+		[]string{"feed"},
+	)
+	iocMatches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_threatintel_matches_total",
+			Help: "Total events that matched a threat intelligence indicator",
+		},
+		[]string{"type"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(feedIndicators, feedRefreshErrors, iocMatches)
+}
+
+// Feed is a blocklist URL and the kind of indicator it lists.
+type Feed struct {
+	URL  string
+	Type string // types.IOCTypeIP or types.IOCTypeDomain
+	// Category is copied to matches, such as types.IOCCategoryTor for
+	// lists of Tor relays; empty for blocklists.
+	Category string
+}
+
+// index is the parsed content of one feed.
+type index struct {
+	ips     map[string]bool
+	nets    []*net.IPNet
+	domains map[string]bool
+	// hashes are only listed by local IOCs.
+	hashes map[string]bool
+}
+
+func newIndex() *index {
+	return &index{ips: make(map[string]bool), domains: make(map[string]bool), hashes: make(map[string]bool)}
+}
+
+func (ix *index) size() int {
+	return len(ix.ips) + len(ix.nets) + len(ix.domains) + len(ix.hashes)
+}
+
+// Store holds the most recent successful download of every feed. A feed that
+// fails to refresh keeps serving its previous entries.
+type Store struct {
+	feeds   []Feed
+	refresh time.Duration
+	http    *http.Client
+	log     *logrus.Logger
+
+	mu      sync.RWMutex
+	indexes map[string]*index // by feed URL
+	local   *index
+}
+
+// New creates a store for feeds, refreshed every refresh interval by Run.
+func New(feeds []Feed, refresh time.Duration, log *logrus.Logger) *Store {
+	return &Store{
+		feeds:   feeds,
+		refresh: refresh,
+		http:    &http.Client{Timeout: time.Minute},
+		log:     log,
+		indexes: make(map[string]*index),
+		local:   newIndex(),
+	}
+}
+
+// Run downloads every feed immediately and then on each refresh interval
+// until ctx is done.
+func (s *Store) Run(ctx context.Context) {
+	s.Refresh(ctx)
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh downloads every feed once, replacing the entries of those that
+// succeed.
+func (s *Store) Refresh(ctx context.Context) {
+	for _, f := range s.feeds {
+		ix, err := s.fetch(ctx, f)
+		if err != nil {
+			feedRefreshErrors.WithLabelValues(f.URL).Inc()
+			s.log.WithError(err).WithField("feed", f.URL).Warn("Threat intel feed refresh failed, keeping previous entries")
+			continue
+		}
+		s.mu.Lock()
+		s.indexes[f.URL] = ix
+		s.mu.Unlock()
+		feedIndicators.WithLabelValues(f.URL).Set(float64(ix.size()))
+		s.log.WithFields(logrus.Fields{"feed": f.URL, "indicators": ix.size()}).Debug("Threat intel feed refreshed")
+	}
+}
+
+func (s *Store) fetch(ctx context.Context, f Feed) (*index, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return parseFeed(io.LimitReader(resp.Body, maxFeedSize), f.Type)
+}
+
+// parseFeed reads one indicator per line. Blank lines and lines starting with
+// #, ; or // are skipped, as are lines whose indicator does not parse, such
+// as CSV headers. IP feeds take the first field of each line, which may be an
+// address, a CIDR block or host:port. Domain feeds take the first field, or
+// the second when the first is an address, as in hosts files.
+func parseFeed(r io.Reader, typ string) (*index, error) {
+	ix := newIndex()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || r == ',' || r == ';'
+		})
+		for i := range fields {
+			fields[i] = strings.Trim(fields[i], `"'`)
+		}
+		switch typ {
+		case types.IOCTypeIP:
+			ix.addIP(fields[0])
+		case types.IOCTypeDomain:
+			d := fields[0]
+			if net.ParseIP(d) != nil && len(fields) > 1 {
+				d = fields[1]
+			}
+			ix.addDomain(d)
+		default:
+			return nil, fmt.Errorf("unknown feed type %q", typ)
+		}
+	}
+	return ix, sc.Err()
+}
+
+func (ix *index) addIP(s string) {
+	if strings.Contains(s, "/") {
+		if _, n, err := net.ParseCIDR(s); err == nil {
+			ix.nets = append(ix.nets, n)
+		}
+		return
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		ix.ips[ip.String()] = true
+	}
+}
+
+func (ix *index) addDomain(s string) {
+	d := normalizeDomain(s)
+	if !strings.Contains(d, ".") || net.ParseIP(d) != nil {
+		return
+	}
+	ix.domains[d] = true
+}
+
+func normalizeDomain(s string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".")
+}
+
+// SetLocal replaces the locally extracted IOCs matched after the feeds.
+func (s *Store) SetLocal(iocs []types.IOC) {
+	ix := newIndex()
+	for _, ioc := range iocs {
+		switch ioc.Type {
+		case types.IOCTypeIP:
+			ix.addIP(ioc.Value)
+		case types.IOCTypeDomain:
+			ix.addDomain(ioc.Value)
+		case types.IOCTypeHash:
+			ix.hashes[strings.ToLower(ioc.Value)] = true
+		}
+	}
+	s.mu.Lock()
+	s.local = ix
+	s.mu.Unlock()
+	feedIndicators.WithLabelValues(LocalFeed).Set(float64(ix.size()))
+}
+
+// Match returns the first indicator matching ip or domain, checking feeds in
+// configuration order and then local IOCs. A listed domain also matches its
+// subdomains.
+func (s *Store) Match(ip, domain string) *types.IOCMatch {
+	parsed := net.ParseIP(ip)
+	domain = normalizeDomain(domain)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, f := range s.feeds {
+		if m := s.indexes[f.URL].match(parsed, domain, f.URL); m != nil {
+			m.Category = f.Category
+			return m
+		}
+	}
+	return s.local.match(parsed, domain, LocalFeed)
+}
+
+func (ix *index) match(ip net.IP, domain, feed string) *types.IOCMatch {
+	if ix == nil {
+		return nil
+	}
+	if ip != nil {
+		if ix.ips[ip.String()] {
+			return &types.IOCMatch{Type: types.IOCTypeIP, Indicator: ip.String(), Feed: feed}
+		}
+		for _, n := range ix.nets {
+			if n.Contains(ip) {
+				return &types.IOCMatch{Type: types.IOCTypeIP, Indicator: n.String(), Feed: feed}
+			}
+		}
+	}
+	for d := domain; strings.Contains(d, "."); d = d[strings.Index(d, ".")+1:] {
+		if ix.domains[d] {
+			return &types.IOCMatch{Type: types.IOCTypeDomain, Indicator: d, Feed: feed}
+		}
+	}
+	return nil
+}
+
+// MatchHash returns the local IOC matching a file or executable hash.
+func (s *Store) MatchHash(hash string) *types.IOCMatch {
+	if hash == "" {
+		return nil
+	}
+	hash = strings.ToLower(hash)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.local.hashes[hash] {
+		return &types.IOCMatch{Type: types.IOCTypeHash, Indicator: hash, Feed: LocalFeed}
+	}
+	return nil
+}
+
+// Enrich sets MatchedIOC on the event's network, process and file data when
+// the destination address or domain, the executable hash or the new file
+// hash is a known indicator. It reports whether any match was found.
+func (s *Store) Enrich(event *types.SecurityEvent) bool {
+	matched := false
+	note := func(m *types.IOCMatch) bool {
+		if m == nil {
+			return false
+		}
+		matched = true
+		iocMatches.WithLabelValues(m.Type).Inc()
+		return true
+	}
+	if n := event.Network; n != nil {
+		if m := s.Match(n.DstIP, n.Domain); note(m) {
+			n.MatchedIOC = m
+		}
+	}
+	if p := event.Process; p != nil {
+		if m := s.MatchHash(p.ExeHash); note(m) {
+			p.MatchedIOC = m
+		}
+	}
+	if f := event.File; f != nil {
+		if m := s.MatchHash(f.NewHash); note(m) {
+			f.MatchedIOC = m
+		}
+	}
+	return matched
+}
@@ -0,0 +1,174 @@
+package threatintel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const ipFeed = `# Feodo Tracker botnet C2 IP blocklist
+"first_seen_utc","dst_ip","dst_port"
+198.51.100.7
+203.0.113.0/24
+192.0.2.44:8080
+not-an-ip
+`
+
+const domainFeed = `# URLhaus hostfile
+127.0.0.1	localhost
+0.0.0.0 evil.example
+Bad.Example.
+`
+
+func TestParseFeed(t *testing.T) {
+	ix, err := parseFeed(strings.NewReader(ipFeed), types.IOCTypeIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ix.ips["198.51.100.7"] || !ix.ips["192.0.2.44"] || len(ix.nets) != 1 || ix.size() != 3 {
+		t.Errorf("ip index: ips=%v nets=%v", ix.ips, ix.nets)
+	}
+
+	ix, err = parseFeed(strings.NewReader(domainFeed), types.IOCTypeDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ix.domains["evil.example"] || !ix.domains["bad.example"] || ix.size() != 2 {
+		t.Errorf("domain index: %v", ix.domains)
+	}
+
+	if _, err := parseFeed(strings.NewReader("x\n"), "url"); err == nil {
+		t.Error("expected error for unknown feed type")
+	}
+}
+
+func newTestStore(t *testing.T, handler http.HandlerFunc) (*Store, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	s := New([]Feed{
+		{URL: srv.URL + "/ips.txt", Type: types.IOCTypeIP},
+		{URL: srv.URL + "/domains.txt", Type: types.IOCTypeDomain},
+	}, time.Hour, logrus.New())
+	return s, srv
+}
+
+func TestStore_MatchAndEnrich(t *testing.T) {
+	s, srv := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ips.txt" {
+			w.Write([]byte(ipFeed))
+		} else {
+			w.Write([]byte(domainFeed))
+		}
+	})
+	s.Refresh(context.Background())
+
+	tests := []struct {
+		ip, domain string
+		want       *types.IOCMatch
+	}{
+		{"198.51.100.7", "", &types.IOCMatch{Type: "ip", Indicator: "198.51.100.7", Feed: srv.URL + "/ips.txt"}},
+		{"203.0.113.99", "", &types.IOCMatch{Type: "ip", Indicator: "203.0.113.0/24", Feed: srv.URL + "/ips.txt"}},
+		{"10.0.0.1", "cdn.EVIL.example.", &types.IOCMatch{Type: "domain", Indicator: "evil.example", Feed: srv.URL + "/domains.txt"}},
+		{"10.0.0.1", "example", nil},
+		{"10.0.0.1", "notevil.example", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		got := s.Match(tt.ip, tt.domain)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("Match(%q, %q) = %+v, want %+v", tt.ip, tt.domain, got, tt.want)
+		}
+	}
+
+	ev := &types.SecurityEvent{Network: &types.NetworkEventData{DstIP: "198.51.100.7", DstPort: 443}}
+	if !s.Enrich(ev) || ev.Network.MatchedIOC == nil || ev.Network.MatchedIOC.Type != types.IOCTypeIP {
+		t.Errorf("Enrich: %+v", ev.Network.MatchedIOC)
+	}
+	if s.Enrich(&types.SecurityEvent{Process: &types.ProcessEventData{}}) {
+		t.Error("events without a network payload should not be enriched")
+	}
+}
+
+func TestStore_RefreshFailureKeepsEntries(t *testing.T) {
+	var fail atomic.Bool
+	s, _ := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(ipFeed))
+	})
+	s.Refresh(context.Background())
+	fail.Store(true)
+	s.Refresh(context.Background())
+	if s.Match("198.51.100.7", "") == nil {
+		t.Error("entries from the last good download should be kept")
+	}
+}
+
+func TestStore_TorFeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tor.txt" {
+			w.Write([]byte("# Tor guard relays\n192.0.2.10\n"))
+		} else {
+			w.Write([]byte(ipFeed))
+		}
+	}))
+	defer srv.Close()
+	s := New([]Feed{
+		{URL: srv.URL + "/ips.txt", Type: types.IOCTypeIP},
+		{URL: srv.URL + "/tor.txt", Type: types.IOCTypeIP, Category: types.IOCCategoryTor},
+	}, time.Hour, logrus.New())
+	s.Refresh(context.Background())
+
+	if m := s.Match("192.0.2.10", ""); m == nil || m.Category != types.IOCCategoryTor || m.Feed != srv.URL+"/tor.txt" {
+		t.Errorf("Match(tor relay) = %+v", m)
+	}
+	if m := s.Match("198.51.100.7", ""); m == nil || m.Category != "" {
+		t.Errorf("Match(blocklisted) = %+v", m)
+	}
+}
+
+func TestStore_LocalIOCs(t *testing.T) {
+	s := New(nil, time.Hour, logrus.New())
+	s.SetLocal([]types.IOC{
+		{Type: types.IOCTypeIP, Value: "198.51.100.9"},
+		{Type: types.IOCTypeDomain, Value: "drop.example"},
+		{Type: types.IOCTypeHash, Value: "ABCDEF"},
+	})
+
+	if m := s.Match("198.51.100.9", ""); m == nil || m.Feed != LocalFeed {
+		t.Errorf("Match(ip) = %+v", m)
+	}
+	if m := s.Match("", "cdn.drop.example"); m == nil || m.Indicator != "drop.example" {
+		t.Errorf("Match(subdomain) = %+v", m)
+	}
+
+	ev := &types.SecurityEvent{
+		Process: &types.ProcessEventData{ExeHash: "abcdef"},
+		File:    &types.FileEventData{NewHash: "123456"},
+	}
+	if !s.Enrich(ev) {
+		t.Fatal("Enrich found no match")
+	}
+	if m := ev.Process.MatchedIOC; m == nil || m.Type != types.IOCTypeHash || m.Indicator != "abcdef" {
+		t.Errorf("process match = %+v", m)
+	}
+	if ev.File.MatchedIOC != nil {
+		t.Errorf("file match = %+v, want none", ev.File.MatchedIOC)
+	}
+
+	s.SetLocal(nil)
+	if m := s.MatchHash("abcdef"); m != nil {
+		t.Errorf("MatchHash after clearing = %+v", m)
+	}
+}
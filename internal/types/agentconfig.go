@@ -0,0 +1,39 @@
+package types
+
+import "time"
+
+// AgentRuntimeConfig is detection config pushed from the controller to every
+// agent. A null list leaves the agent's local setting in place; an empty list
+// clears it.
+type AgentRuntimeConfig struct {
+	// Revision increases on every update; agents report the revision they applied.
+	Revision            int64     `json:"revision"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	SuspiciousProcesses []string  `json:"suspicious_processes"`
+	WatchPaths          []string  `json:"watch_paths"`
+	WatchExclude        []string  `json:"watch_exclude"`
+	SuspiciousPorts     []int     `json:"suspicious_ports"`
+	// ExeHashAllowlist and ExeHashDenylist are hex SHA-256 digests of
+	// executables whose processes are ignored or raise a CRITICAL event.
+	ExeHashAllowlist []string `json:"exe_hash_allowlist"`
+	ExeHashDenylist  []string `json:"exe_hash_denylist"`
+}
+
+// Brownout is a fleet-wide slowdown of agent scans, such as during a cluster
+// incident when monitoring competes with workloads for node resources.
+// Agents multiply their scan intervals by Factor until Until, even if they
+// lose contact with the controller.
+type Brownout struct {
+	Factor    int       `json:"factor"`
+	Reason    string    `json:"reason,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Until     time.Time `json:"until"`
+}
+
+// BrownoutRequest starts a brownout. Factor and TTL, a Go duration, default
+// to the controller's BrownoutFactor and BrownoutDuration.
+type BrownoutRequest struct {
+	Factor int    `json:"factor,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	TTL    string `json:"ttl,omitempty"`
+}
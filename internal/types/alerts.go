@@ -1,29 +1,316 @@
 package types
 
-import "time"
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Alert lifecycle states.
+const (
+	AlertStatusOpen     = "open"
+	AlertStatusAcked    = "acked"
+	AlertStatusResolved = "resolved"
+)
+
+// ValidAlertStatus reports whether s is a known alert lifecycle state.
+func ValidAlertStatus(s string) bool {
+	switch s {
+	case AlertStatusOpen, AlertStatusAcked, AlertStatusResolved:
+		return true
+	}
+	return false
+}
 
 // Alert is a generated security alert from the detection engine.
 type Alert struct {
-	ID          string    `json:"id"`
-	Timestamp   time.Time `json:"timestamp"`
-	Severity    string    `json:"severity"`
-	RuleID      string    `json:"rule_id"`
-	RuleName    string    `json:"rule_name"`
-	Description string    `json:"description"`
-	EventIDs    []string  `json:"event_ids"`
-	PodName     string    `json:"pod_name"`
-	PodNS       string    `json:"pod_namespace"`
-	MitreTactic string    `json:"mitre_tactic,omitempty"`
-	MitreID     string    `json:"mitre_id,omitempty"`
-	Actions     []string  `json:"recommended_actions"`
+	ID          string     `json:"id"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Severity    string     `json:"severity"`
+	RuleID      string     `json:"rule_id"`
+	RuleName    string     `json:"rule_name"`
+	Description string     `json:"description"`
+	EventIDs    []string   `json:"event_ids"`
+	PodName     string     `json:"pod_name"`
+	PodNS       string     `json:"pod_namespace"`
+	MitreTactic string     `json:"mitre_tactic,omitempty"`
+	MitreID     string     `json:"mitre_id,omitempty"`
+	Actions     []string   `json:"recommended_actions"`
+	Status      string     `json:"status"`
+	Assignee    string     `json:"assignee,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	AckedAt     *time.Time `json:"acked_at,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+
+	// ObservedAt and OccurredAt are copied from the triggering event: when the
+	// agent saw the activity and, if known, when it actually happened.
+	// Timestamp is when the alert was raised.
+	ObservedAt *time.Time `json:"observed_at,omitempty"`
+	OccurredAt *time.Time `json:"occurred_at,omitempty"`
+
+	// IncidentID links alerts raised by cross-pod correlation to their incident.
+	IncidentID string `json:"incident_id,omitempty"`
+
+	// Identity is copied from the triggering event: the credentials a
+	// compromised pod could use.
+	Identity *Identity `json:"identity,omitempty"`
+
+	// Kubernetes is the alert's pod as the Kubernetes API describes it, so
+	// responders see the owning Deployment and its team rather than a pod
+	// name. Nil when the controller runs outside a cluster or does not know
+	// the pod.
+	Kubernetes *KubeMetadata `json:"kubernetes,omitempty"`
+
+	// ClusterName and Environment are where the alert originated, copied
+	// from the triggering event or, for alerts the controller raises
+	// itself, the controller's own.
+	ClusterName string `json:"cluster_name,omitempty"`
+	Environment string `json:"environment,omitempty"`
+
+	// Replica is the controller replica that raised the alert when replicas
+	// shard agents between them; triage updates are made there.
+	Replica string `json:"replica,omitempty"`
+
+	// Playbook is the response runbook of the rule that raised the alert.
+	Playbook *Playbook `json:"playbook,omitempty"`
+
+	// Enrichments are verdicts Sweet Security pushed back about the alert or
+	// its incident, oldest first.
+	Enrichments []Enrichment `json:"enrichments,omitempty"`
+
+	// Hints are likely-benign explanations found when the alert was raised.
+	Hints []TriageHint `json:"triage_hints,omitempty"`
+
+	// Test marks synthetic alerts, such as pipeline canaries, that are not
+	// about real activity.
+	Test bool `json:"test,omitempty"`
+
+	// Shadow marks a match of a rule in shadow mode. It is counted on the
+	// rule but never retained, notified or sent to Sweet Security.
+	Shadow bool `json:"shadow,omitempty"`
+
+	// Truncated marks a notification whose fields were shortened to fit the
+	// sink's payload budget; the stored alert is always complete.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// KubeMetadata is what the Kubernetes API says about a pod: its top-level
+// owner, such as Deployment checkout, where it runs and a chosen set of its
+// labels. It is shared by every alert of the pod and must not be modified.
+type KubeMetadata struct {
+	OwnerKind      string            `json:"owner_kind,omitempty"`
+	OwnerName      string            `json:"owner_name,omitempty"`
+	Node           string            `json:"node,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+// String summarizes m as "deployment=checkout, team=payments": the owner,
+// then the labels sorted by key.
+func (m *KubeMetadata) String() string {
+	var parts []string
+	if m.OwnerKind != "" {
+		parts = append(parts, strings.ToLower(m.OwnerKind)+"="+m.OwnerName)
+	}
+	keys := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, k+"="+m.Labels[k])
+	}
+	return strings.Join(parts, ", ")
 }
 
+// Playbook tells on-call engineers how to respond to a rule's alerts: a link
+// to a runbook, inline markdown steps, or both. It is shared by every alert
+// of the rule and must not be modified.
+type Playbook struct {
+	URL  string `json:"url,omitempty"`
+	Body string `json:"body,omitempty"`
+}
+
+// AlertUpdate is the PATCH body for triaging an alert. Nil fields are left unchanged.
+type AlertUpdate struct {
+	Status   *string `json:"status,omitempty"`
+	Assignee *string `json:"assignee,omitempty"`
+}
+
+// Agent status values reported in AgentInfo.Status.
+const (
+	// AgentStatusHealthy agents sent events recently and report all monitors running.
+	AgentStatusHealthy = "healthy"
+	// AgentStatusIdle agents are heartbeating but have not sent events recently.
+	AgentStatusIdle = "idle"
+	// AgentStatusDegraded agents report at least one monitor that is not running.
+	AgentStatusDegraded = "degraded"
+	// AgentStatusUnknown agents have never heartbeated, so only event traffic is known.
+	AgentStatusUnknown = "unknown"
+)
+
 // AgentInfo tracks a connected agent for the controller.
 type AgentInfo struct {
 	ID           string    `json:"id"`
 	PodName      string    `json:"pod_name"`
 	PodNamespace string    `json:"pod_namespace"`
+	NodeName     string    `json:"node_name,omitempty"`
+	PodIP        string    `json:"pod_ip,omitempty"`
 	ConnectedAt  time.Time `json:"connected_at"`
-	LastSeen     time.Time `json:"last_seen"`
-	EventCount   int64     `json:"event_count"`
+	// LastSeen is the last event or heartbeat from the agent.
+	LastSeen    time.Time  `json:"last_seen"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+	EventCount  int64      `json:"event_count"`
+	// Version and ConfigHash come from registration and heartbeats.
+	Version      string     `json:"version,omitempty"`
+	ConfigHash   string     `json:"config_hash,omitempty"`
+	RegisteredAt *time.Time `json:"registered_at,omitempty"`
+	// ConfigRevision is the pushed AgentRuntimeConfig revision the agent applied.
+	ConfigRevision int64 `json:"config_revision,omitempty"`
+	// Status is derived when agents are listed; see the AgentStatus constants.
+	Status string `json:"status"`
+	// MonitoringMode is "degraded" when the agent cannot see application processes.
+	MonitoringMode string `json:"monitoring_mode,omitempty"`
+	// SchemaVersion is the payload schema of the agent's most recent event.
+	SchemaVersion string `json:"schema_version"`
+	// Monitors is the per-monitor state (running, restarting, failed, stopped)
+	// from the latest heartbeat.
+	Monitors map[string]string `json:"monitors,omitempty"`
+	// MonitorCrashes is the per-monitor panic count from the latest heartbeat.
+	MonitorCrashes map[string]int `json:"monitor_crashes,omitempty"`
+	LastHeartbeat  *time.Time     `json:"last_heartbeat,omitempty"`
+	// Identity is the pod's service account and workload identity, from
+	// registration or the agent's events.
+	Identity *Identity `json:"identity,omitempty"`
+	// ClusterName and Environment are where the agent runs, from
+	// registration or the agent's events.
+	ClusterName string `json:"cluster_name,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	// Protocol is what the agent negotiated in its handshake, filled in as
+	// protocol 1 when agents are listed for agents that did not send one.
+	Protocol *AgentProtocol `json:"protocol,omitempty"`
+	// ThrottledEvents counts the agent's events rejected for its event
+	// rate, the latest at LastThrottledAt.
+	ThrottledEvents int64      `json:"throttled_events,omitempty"`
+	LastThrottledAt *time.Time `json:"last_throttled_at,omitempty"`
+}
+
+// AgentRegistration is sent once by an agent at startup.
+type AgentRegistration struct {
+	AgentID        string   `json:"agent_id"`
+	PodName        string   `json:"pod_name"`
+	PodNamespace   string   `json:"pod_namespace"`
+	NodeName       string   `json:"node_name,omitempty"`
+	PodIP          string   `json:"pod_ip,omitempty"`
+	Version        string   `json:"version"`
+	ConfigHash     string   `json:"config_hash"`
+	SchemaVersion  string   `json:"schema_version"`
+	MonitoringMode string   `json:"monitoring_mode,omitempty"`
+	Monitors       []string `json:"monitors,omitempty"`
+
+	Identity    *Identity `json:"identity,omitempty"`
+	ClusterName string    `json:"cluster_name,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+}
+
+// AgentHeartbeat is the periodic liveness report sent by agents.
+type AgentHeartbeat struct {
+	AgentID        string            `json:"agent_id"`
+	PodName        string            `json:"pod_name"`
+	PodNamespace   string            `json:"pod_namespace"`
+	PodIP          string            `json:"pod_ip,omitempty"`
+	Timestamp      time.Time         `json:"timestamp"`
+	Version        string            `json:"version,omitempty"`
+	ConfigHash     string            `json:"config_hash,omitempty"`
+	ConfigRevision int64             `json:"config_revision,omitempty"`
+	SchemaVersion  string            `json:"schema_version"`
+	Monitors       map[string]string `json:"monitors,omitempty"`
+	MonitorCrashes map[string]int    `json:"monitor_crashes,omitempty"`
+}
+
+// SchemaMigration summarizes how far the agent fleet has moved to the current schema.
+type SchemaMigration struct {
+	TotalAgents     int            `json:"total_agents"`
+	ByVersion       map[string]int `json:"by_version"`
+	LegacyAgents    []string       `json:"legacy_agents"`
+	PercentMigrated float64        `json:"percent_migrated"`
+	TargetVersion   string         `json:"target_version"`
+}
+
+// Alert sort keys and orders for AlertFilter.
+const (
+	AlertSortTimestamp = "timestamp"
+	AlertSortSeverity  = "severity"
+	SortAsc            = "asc"
+	SortDesc           = "desc"
+)
+
+// AlertFilter selects, orders and pages alerts. Zero-valued fields match everything.
+type AlertFilter struct {
+	Status     string
+	Severities []string
+	RuleID     string
+	Namespace  string
+	Pod        string
+	Since      time.Time
+	Until      time.Time
+	// Sort is AlertSortTimestamp (default) or AlertSortSeverity.
+	Sort string
+	// Order is SortAsc (default, oldest or least severe first) or SortDesc.
+	Order  string
+	Offset int
+	// Limit <= 0 returns all matching alerts after Offset.
+	Limit int
+}
+
+// Matches reports whether a satisfies the filter's selection criteria.
+func (f AlertFilter) Matches(a *Alert) bool {
+	if f.Status != "" && a.Status != f.Status {
+		return false
+	}
+	if len(f.Severities) > 0 {
+		ok := false
+		for _, s := range f.Severities {
+			if s == a.Severity {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.RuleID != "" && a.RuleID != f.RuleID {
+		return false
+	}
+	if f.Namespace != "" && a.PodNS != f.Namespace {
+		return false
+	}
+	if f.Pod != "" && a.PodName != f.Pod {
+		return false
+	}
+	if !f.Since.IsZero() && a.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && a.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// SeverityRank orders severities from INFO (1) to CRITICAL (5); unknown is 0.
+func SeverityRank(s string) int {
+	switch s {
+	case "CRITICAL":
+		return 5
+	case "HIGH":
+		return 4
+	case "MEDIUM":
+		return 3
+	case "LOW":
+		return 2
+	case "INFO":
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+// Audit actions recorded by the controller.
+const (
+	AuditAlertUpdated       = "alert.updated"
+	AuditSuppressionAdded   = "suppression.added"
+	AuditSuppressionDeleted = "suppression.deleted"
+)
+
+// AuditEntry records an operator change made through the controller API.
+type AuditEntry struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Target is the ID of the alert or suppression changed.
+	Target string `json:"target"`
+	// Detail describes the change, such as the new status and assignee.
+	Detail map[string]string `json:"detail,omitempty"`
+}
@@ -0,0 +1,59 @@
+package types
+
+import "time"
+
+// Enrichment verdicts. A malicious verdict escalates to CRITICAL and a
+// suspicious one to at least HIGH; benign only annotates.
+const (
+	VerdictMalicious  = "malicious"
+	VerdictSuspicious = "suspicious"
+	VerdictBenign     = "benign"
+)
+
+// Enrichment is context Sweet Security pushes back about an alert or
+// incident the controller forwarded, e.g. that its destination IP is
+// confirmed malicious. Exactly one of AlertID and IncidentID is set.
+type Enrichment struct {
+	AlertID    string `json:"alert_id,omitempty"`
+	IncidentID string `json:"incident_id,omitempty"`
+	Verdict    string `json:"verdict"`
+	// Severity is Sweet Security's own assessment. The alert or incident is
+	// raised to the higher of it and the verdict's severity, never lowered.
+	Severity  string `json:"severity,omitempty"`
+	Indicator string `json:"indicator,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	FindingID string `json:"finding_id,omitempty"`
+	URL       string `json:"url,omitempty"`
+
+	ReceivedAt time.Time `json:"received_at"`
+	// EscalatedFrom is the severity before this enrichment raised it.
+	EscalatedFrom string `json:"escalated_from,omitempty"`
+}
+
+// ValidVerdict reports whether v is a known enrichment verdict.
+func ValidVerdict(v string) bool {
+	switch v {
+	case VerdictMalicious, VerdictSuspicious, VerdictBenign:
+		return true
+	}
+	return false
+}
+
+// EscalatedSeverity returns the severity current should be raised to for e,
+// or current if e does not raise it.
+func (e *Enrichment) EscalatedSeverity(current string) string {
+	target := current
+	switch e.Verdict {
+	case VerdictMalicious:
+		target = "CRITICAL"
+	case VerdictSuspicious:
+		target = "HIGH"
+	}
+	if SeverityRank(e.Severity) > SeverityRank(target) {
+		target = e.Severity
+	}
+	if SeverityRank(target) > SeverityRank(current) {
+		return target
+	}
+	return current
+}
@@ -4,19 +4,50 @@ package types
 
 import "time"
 
+// Agent payload schema versions. Events without a schema_version field were sent
+// by legacy (v1) agents and are converted by the controller on ingest.
+const (
+	SchemaVersionV1      = "v1"
+	SchemaVersionV2      = "v2"
+	CurrentSchemaVersion = SchemaVersionV2
+)
+
 // SecurityEvent is the HTTP/API representation of a security event from agents.
 type SecurityEvent struct {
-	ID           string                 `json:"id"`
-	AgentID      string                 `json:"agent_id"`
-	Type         string                 `json:"type"`
-	Severity     string                 `json:"severity"`
-	Timestamp    time.Time              `json:"timestamp"`
-	PodName      string                 `json:"pod_name"`
-	PodNamespace string                 `json:"pod_namespace"`
-	Process      *ProcessEventData      `json:"process,omitempty"`
-	Network      *NetworkEventData      `json:"network,omitempty"`
-	File         *FileEventData         `json:"file,omitempty"`
-	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	SchemaVersion string                 `json:"schema_version,omitempty"`
+	ID            string                 `json:"id"`
+	AgentID       string                 `json:"agent_id"`
+	Type          string                 `json:"type"`
+	Severity      string                 `json:"severity"`
+	Timestamp     time.Time              `json:"timestamp"`
+	PodName       string                 `json:"pod_name"`
+	PodNamespace  string                 `json:"pod_namespace"`
+	Process       *ProcessEventData      `json:"process,omitempty"`
+	Network       *NetworkEventData      `json:"network,omitempty"`
+	File          *FileEventData         `json:"file,omitempty"`
+	Resource      *ResourceEventData     `json:"resource,omitempty"`
+	Audit         *AuditEventData        `json:"audit,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+
+	// OccurredAt is when the activity actually happened, sent when the agent
+	// can derive it (process start time, file mtime). Timestamp is when the
+	// agent observed it, up to one scan interval later.
+	OccurredAt *time.Time `json:"occurred_at,omitempty"`
+
+	// Identity is what the pod runs as. Agents send it; the controller fills
+	// it in from the agent's registration when they do not.
+	Identity *Identity `json:"identity,omitempty"`
+
+	// ClusterName and Environment say where the pod runs, such as
+	// "prod-us-east1" and "production". Agents send them; the controller
+	// fills them in from the agent's registration, then its own settings,
+	// when they do not.
+	ClusterName string `json:"cluster_name,omitempty"`
+	Environment string `json:"environment,omitempty"`
+
+	// Extensions holds top-level fields sent by agents newer than this
+	// controller; see UnknownFields.
+	Extensions Extensions `json:"-"`
 }
 
 // ProcessEventData is process-related payload in a security event.
@@ -24,18 +55,77 @@ type ProcessEventData struct {
 	PID                  int      `json:"pid"`
 	PPID                 int      `json:"ppid"`
 	Name                 string   `json:"name"`
+	ExePath              string   `json:"exe_path,omitempty"`
+	UID                  *int     `json:"uid,omitempty"`
 	Cmdline              []string `json:"cmdline"`
 	SuspiciousIndicators []string `json:"suspicious_indicators,omitempty"`
+	// ExeHash is the SHA-256 of the process executable, when the agent could
+	// read it.
+	ExeHash string `json:"exe_hash,omitempty"`
+	// MatchedIOC is set by the controller when ExeHash is a known IOC.
+	MatchedIOC *IOCMatch `json:"matched_ioc,omitempty"`
+	// Ancestors is the process lineage, parent first, as far as the agent
+	// could follow it.
+	Ancestors []ProcessAncestor `json:"ancestors,omitempty"`
+	// Environment holds the environment variables behind the process's
+	// environment indicators. Credential values are "sha256:<hex>" when the
+	// agent redacts them.
+	Environment map[string]string `json:"environment,omitempty"`
+	// CPUPercent is the CPU the process used between the agent's last two
+	// scans, in percent of one core; MemoryBytes is its resident set size.
+	CPUPercent  float64 `json:"cpu_percent,omitempty"`
+	MemoryBytes int64   `json:"memory_bytes,omitempty"`
+
+	Extensions Extensions `json:"-"`
+}
+
+// ProcessAncestor is one process in an event's process lineage.
+type ProcessAncestor struct {
+	PID     int      `json:"pid"`
+	Name    string   `json:"name"`
+	ExePath string   `json:"exe_path,omitempty"`
+	Cmdline []string `json:"cmdline,omitempty"`
 }
 
 // NetworkEventData is network-related payload in a security event.
 type NetworkEventData struct {
 	Protocol         string `json:"protocol"`
+	SrcIP            string `json:"src_ip,omitempty"`
+	SrcPort          int    `json:"src_port,omitempty"`
 	DstIP            string `json:"dst_ip"`
 	DstPort          int    `json:"dst_port"`
 	State            string `json:"state"`
 	IsExternal       bool   `json:"is_external"`
 	IsSuspiciousPort bool   `json:"is_suspicious_port"`
+	// Domain is the hostname looked up or connected to, when known (for
+	// example on dns_query events).
+	Domain string `json:"domain,omitempty"`
+	// MatchedIOC is set by the controller when DstIP or Domain is on a
+	// threat intelligence blocklist.
+	MatchedIOC *IOCMatch `json:"matched_ioc,omitempty"`
+
+	Extensions Extensions `json:"-"`
+}
+
+// IOC types reported in IOCMatch.Type.
+const (
+	IOCTypeIP     = "ip"
+	IOCTypeDomain = "domain"
+	IOCTypeHash   = "hash"
+)
+
+// IOCCategoryTor is the IOCMatch.Category of indicators from Tor relay
+// feeds.
+const IOCCategoryTor = "tor"
+
+// IOCMatch is a threat intelligence indicator that matched an event.
+type IOCMatch struct {
+	Type      string `json:"type"`
+	Indicator string `json:"indicator"`
+	Feed      string `json:"feed"`
+	// Category is set for feeds listing something other than known-bad
+	// indicators, such as IOCCategoryTor.
+	Category string `json:"category,omitempty"`
 }
 
 // FileEventData is file-related payload in a security event.
@@ -44,4 +134,87 @@ type FileEventData struct {
 	Operation string `json:"operation"`
 	OldHash   string `json:"old_hash,omitempty"`
 	NewHash   string `json:"new_hash,omitempty"`
+	// OldModTime and NewModTime are the file's mtime before and after the
+	// change; nil when the agent did not report them.
+	OldModTime *time.Time `json:"old_mtime,omitempty"`
+	NewModTime *time.Time `json:"new_mtime,omitempty"`
+	// Mode and OldMode are the file's mode bits in octal, such as 4755, and
+	// UID, GID, OldUID and OldGID its owner, after and before the change.
+	Mode    string `json:"mode,omitempty"`
+	OldMode string `json:"old_mode,omitempty"`
+	UID     *int   `json:"uid,omitempty"`
+	GID     *int   `json:"gid,omitempty"`
+	OldUID  *int   `json:"old_uid,omitempty"`
+	OldGID  *int   `json:"old_gid,omitempty"`
+	// Indicators are anti-forensics and privilege escalation signs seen on
+	// the change, e.g. "timestomp" or "setuid".
+	Indicators []string `json:"indicators,omitempty"`
+	// YaraRules are the YARA rules the file's content matched.
+	YaraRules []string `json:"yara_rules,omitempty"`
+	// PID and ProcessName are the process that accessed the file, when the
+	// agent knows it.
+	PID         int    `json:"pid,omitempty"`
+	ProcessName string `json:"process_name,omitempty"`
+	// MatchedIOC is set by the controller when NewHash is a known IOC.
+	MatchedIOC *IOCMatch `json:"matched_ioc,omitempty"`
+
+	Extensions Extensions `json:"-"`
+}
+
+// ResourceEventData is resource-anomaly payload in a security event.
+type ResourceEventData struct {
+	AnomalyType  string  `json:"anomaly_type"`
+	AnomalyScore float64 `json:"anomaly_score,omitempty"`
+	// CPUPercent and MemoryBytes describe a process sustaining high CPU.
+	CPUPercent  float64 `json:"cpu_percent,omitempty"`
+	MemoryBytes int64   `json:"memory_bytes,omitempty"`
+	// Path, DiskWriteBytes, FileCountDelta and TopPaths describe disk usage
+	// growth of a watched path since the previous scan.
+	Path           string      `json:"path,omitempty"`
+	DiskWriteBytes int64       `json:"disk_write_bytes,omitempty"`
+	FileCountDelta int         `json:"file_count_delta,omitempty"`
+	TopPaths       []PathUsage `json:"top_paths,omitempty"`
+	// InodesUsed and InodesTotal describe inode exhaustion of Path's filesystem.
+	InodesUsed  uint64 `json:"inodes_used,omitempty"`
+	InodesTotal uint64 `json:"inodes_total,omitempty"`
+	// PID, ProcessName, OpenFDs and FDLimit describe a process close to its
+	// open file descriptor limit.
+	PID         int    `json:"pid,omitempty"`
+	ProcessName string `json:"process_name,omitempty"`
+	OpenFDs     int    `json:"open_fds,omitempty"`
+	FDLimit     int    `json:"fd_limit,omitempty"`
+
+	Extensions Extensions `json:"-"`
+}
+
+// PathUsage is the growth of one directory between two disk usage scans.
+type PathUsage struct {
+	Path        string `json:"path"`
+	GrowthBytes int64  `json:"growth_bytes"`
+	GrowthFiles int    `json:"growth_files"`
+}
+
+// AuditEventData is Kubernetes API payload in a security event, such as a pod
+// the admission webhook rejected or warned about.
+type AuditEventData struct {
+	Verb             string   `json:"verb"`
+	Resource         string   `json:"resource"`
+	Name             string   `json:"name,omitempty"`
+	Namespace        string   `json:"namespace,omitempty"`
+	User             string   `json:"user,omitempty"`
+	Groups           []string `json:"groups,omitempty"`
+	PolicyViolations []string `json:"policy_violations,omitempty"`
+
+	Extensions Extensions `json:"-"`
+}
+
+// Identity is the Kubernetes and cloud identity a pod runs as, the first
+// thing to revoke when it is compromised. Once attached to an event or agent
+// it is shared and must not be modified.
+type Identity struct {
+	// ServiceAccount is the pod's Kubernetes ServiceAccount.
+	ServiceAccount string `json:"service_account,omitempty"`
+	// GCPServiceAccount is the Google service account the ServiceAccount is
+	// bound to through GKE Workload Identity, if any.
+	GCPServiceAccount string `json:"gcp_service_account,omitempty"`
 }
@@ -0,0 +1,317 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extensions holds JSON fields this build does not know about, keyed by the
+// name the sender used. They are kept verbatim and written back out when the
+// value is re-encoded, so events from agents newer than the controller pass
+// through without losing telemetry.
+type Extensions map[string]json.RawMessage
+
+// Keys returns the extension field names, sorted.
+func (x Extensions) Keys() []string {
+	keys := make([]string, 0, len(x))
+	for k := range x {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// knownFields caches, per struct type, the lower-cased JSON names of its
+// fields. encoding/json matches object keys case-insensitively, so the
+// comparison here does too.
+var knownFields sync.Map
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	if names, ok := knownFields.Load(t); ok {
+		return names.(map[string]bool)
+	}
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	knownFields.Store(t, names)
+	return names
+}
+
+// unmarshalExtensions decodes data into v, a pointer to a struct, and returns
+// the object's fields that v has no field for.
+//
+// Once data has decoded, it is valid JSON, so unknown fields are found by
+// scanning the keys of its top-level object without decoding the values.
+// Only an object with an escaped key is decoded again into a map to read
+// its keys. Nothing depends on the wording of encoding/json's errors.
+func unmarshalExtensions(data []byte, v interface{}) (Extensions, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	known := jsonFieldNames(reflect.TypeOf(v).Elem())
+	if ext, ok := scanExtensions(data, known); ok {
+		return ext, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var ext Extensions
+	for k, val := range raw {
+		if known[strings.ToLower(k)] {
+			continue
+		}
+		if ext == nil {
+			ext = make(Extensions)
+		}
+		ext[k] = val
+	}
+	return ext, nil
+}
+
+// scanExtensions returns the members of the object in data whose keys are
+// not in known, copying their values. data must be valid JSON. It reports
+// false for an object with an escaped key, which it does not unescape.
+func scanExtensions(data []byte, known map[string]bool) (Extensions, bool) {
+	i := skipSpace(data, 0)
+	if i == len(data) || data[i] != '{' {
+		return nil, true
+	}
+	var ext Extensions
+	i = skipSpace(data, i+1)
+	for data[i] != '}' {
+		if data[i] == ',' {
+			i = skipSpace(data, i+1)
+		}
+		end := i + 1
+		for data[end] != '"' {
+			if data[end] == '\\' {
+				return nil, false
+			}
+			end++
+		}
+		key := data[i+1 : end]
+		start := skipSpace(data, skipSpace(data, end+1)+1)
+		i = skipValue(data, start)
+		// Most keys are written lower-case, found without allocating.
+		if !known[string(key)] && !known[strings.ToLower(string(key))] {
+			if ext == nil {
+				ext = make(Extensions)
+			}
+			ext[string(key)] = append(json.RawMessage(nil), data[start:i]...)
+		}
+		i = skipSpace(data, i)
+	}
+	return ext, true
+}
+
+// skipValue returns the index just past the JSON value starting at i.
+func skipValue(data []byte, i int) int {
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for {
+			switch data[i] {
+			case '"':
+				i = skipString(data, i)
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+	}
+	// A number, true, false or null.
+	for i < len(data) && data[i] != ',' && data[i] != '}' && data[i] != ']' && !isSpace(data[i]) {
+		i++
+	}
+	return i
+}
+
+// skipString returns the index just past the JSON string starting at i.
+func skipString(data []byte, i int) int {
+	for i++; data[i] != '"'; i++ {
+		if data[i] == '\\' {
+			i++
+		}
+	}
+	return i + 1
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && isSpace(data[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// marshalExtensions encodes v and appends the extension fields to the object.
+// Fields v already writes take precedence over extensions with the same name.
+func marshalExtensions(v interface{}, ext Extensions) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(ext) == 0 {
+		return data, err
+	}
+	known := jsonFieldNames(reflect.TypeOf(v))
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	first := len(data) == 2
+	for _, k := range ext.Keys() {
+		if known[strings.ToLower(k)] {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		name, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(ext[k])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnknownFields returns every extension field on the event and its payloads,
+// keyed by dotted path such as "process.container_id". It is nil when the
+// event has none.
+func (e *SecurityEvent) UnknownFields() map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	add := func(prefix string, ext Extensions) {
+		for k, v := range ext {
+			if fields == nil {
+				fields = make(map[string]json.RawMessage)
+			}
+			fields[prefix+k] = v
+		}
+	}
+	add("", e.Extensions)
+	if e.Process != nil {
+		add("process.", e.Process.Extensions)
+	}
+	if e.Network != nil {
+		add("network.", e.Network.Extensions)
+	}
+	if e.File != nil {
+		add("file.", e.File.Extensions)
+	}
+	if e.Resource != nil {
+		add("resource.", e.Resource.Extensions)
+	}
+	if e.Audit != nil {
+		add("audit.", e.Audit.Extensions)
+	}
+	return fields
+}
+
+// UnmarshalJSON decodes the event, keeping unknown fields in Extensions.
+func (e *SecurityEvent) UnmarshalJSON(data []byte) error {
+	type plain SecurityEvent
+	ext, err := unmarshalExtensions(data, (*plain)(e))
+	e.Extensions = ext
+	return err
+}
+
+// MarshalJSON encodes the event including its Extensions.
+func (e SecurityEvent) MarshalJSON() ([]byte, error) {
+	type plain SecurityEvent
+	return marshalExtensions(plain(e), e.Extensions)
+}
+
+// UnmarshalJSON decodes the payload, keeping unknown fields in Extensions.
+func (p *ProcessEventData) UnmarshalJSON(data []byte) error {
+	type plain ProcessEventData
+	ext, err := unmarshalExtensions(data, (*plain)(p))
+	p.Extensions = ext
+	return err
+}
+
+// MarshalJSON encodes the payload including its Extensions.
+func (p ProcessEventData) MarshalJSON() ([]byte, error) {
+	type plain ProcessEventData
+	return marshalExtensions(plain(p), p.Extensions)
+}
+
+// UnmarshalJSON decodes the payload, keeping unknown fields in Extensions.
+func (n *NetworkEventData) UnmarshalJSON(data []byte) error {
+	type plain NetworkEventData
+	ext, err := unmarshalExtensions(data, (*plain)(n))
+	n.Extensions = ext
+	return err
+}
+
+// MarshalJSON encodes the payload including its Extensions.
+func (n NetworkEventData) MarshalJSON() ([]byte, error) {
+	type plain NetworkEventData
+	return marshalExtensions(plain(n), n.Extensions)
+}
+
+// UnmarshalJSON decodes the payload, keeping unknown fields in Extensions.
+func (f *FileEventData) UnmarshalJSON(data []byte) error {
+	type plain FileEventData
+	ext, err := unmarshalExtensions(data, (*plain)(f))
+	f.Extensions = ext
+	return err
+}
+
+// MarshalJSON encodes the payload including its Extensions.
+func (f FileEventData) MarshalJSON() ([]byte, error) {
+	type plain FileEventData
+	return marshalExtensions(plain(f), f.Extensions)
+}
+
+// UnmarshalJSON decodes the payload, keeping unknown fields in Extensions.
+func (r *ResourceEventData) UnmarshalJSON(data []byte) error {
+	type plain ResourceEventData
+	ext, err := unmarshalExtensions(data, (*plain)(r))
+	r.Extensions = ext
+	return err
+}
+
+// MarshalJSON encodes the payload including its Extensions.
+func (r ResourceEventData) MarshalJSON() ([]byte, error) {
+	type plain ResourceEventData
+	return marshalExtensions(plain(r), r.Extensions)
+}
+
+// UnmarshalJSON decodes the payload, keeping unknown fields in Extensions.
+func (a *AuditEventData) UnmarshalJSON(data []byte) error {
+	type plain AuditEventData
+	ext, err := unmarshalExtensions(data, (*plain)(a))
+	a.Extensions = ext
+	return err
+}
+
+// MarshalJSON encodes the payload including its Extensions.
+func (a AuditEventData) MarshalJSON() ([]byte, error) {
+	type plain AuditEventData
+	return marshalExtensions(plain(a), a.Extensions)
+}
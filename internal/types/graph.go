@@ -0,0 +1,82 @@
+package types
+
+import "time"
+
+// Entity graph node kinds.
+const (
+	GraphNodePod     = "pod"
+	GraphNodeProcess = "process"
+	GraphNodeIP      = "ip"
+	GraphNodeDomain  = "domain"
+	GraphNodeFile    = "file"
+	GraphNodeHash    = "hash"
+)
+
+// Entity graph edge kinds, from the acting entity to the one acted on.
+const (
+	// GraphEdgeRuns links a pod to a process in it.
+	GraphEdgeRuns = "runs"
+	// GraphEdgeSpawned links a parent process to its child.
+	GraphEdgeSpawned = "spawned"
+	// GraphEdgeConnects links a pod or process to an IP, or to the pod
+	// behind the IP.
+	GraphEdgeConnects = "connects"
+	// GraphEdgeResolves links a pod or process to a domain it looked up or
+	// connected to.
+	GraphEdgeResolves = "resolves"
+	// GraphEdgeModifies links a pod or process to a file it changed.
+	GraphEdgeModifies = "modifies"
+	// GraphEdgeHashes links a process or file to the hash of its content.
+	GraphEdgeHashes = "hashes_to"
+)
+
+// GraphNode is an entity seen in events: a pod, a process in a pod, a
+// destination IP or domain, a file in a pod, or a content hash.
+type GraphNode struct {
+	// ID is "<kind>:<key>", e.g. "ip:203.0.113.9", "pod:prod/web-1",
+	// "process:prod/web-1/42/curl" or "file:prod/web-1:/tmp/x".
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+	// Attributes describe the entity as last seen, e.g. a process's
+	// exe_path or whether an IP is external.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Severity is the highest severity of the events naming the entity.
+	Severity   string    `json:"severity"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	EventCount int64     `json:"event_count"`
+}
+
+// GraphEdge is a relation between two nodes, seen in EventCount events.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+	// Ports are the destination ports of connects edges.
+	Ports      []int     `json:"ports,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	EventCount int64     `json:"event_count"`
+	// EventIDs are the most recent events behind the edge.
+	EventIDs []string `json:"event_ids,omitempty"`
+}
+
+// Graph is a part of the entity graph returned by a query.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+	// Truncated is set when the node limit cut the result short.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// GraphQuery selects part of the entity graph. With a Node, it is the
+// neighborhood within Depth hops of it; without one, the most recently
+// seen nodes. Only edges seen since Since count, and at most Limit nodes
+// are returned.
+type GraphQuery struct {
+	Node  string
+	Depth int
+	Since time.Time
+	Limit int
+}
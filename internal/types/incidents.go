@@ -0,0 +1,72 @@
+package types
+
+import "time"
+
+// Incident types.
+const (
+	// IncidentTypeLateralMovement links a connection from one pod to another
+	// with a shell spawned in the destination pod.
+	IncidentTypeLateralMovement = "lateral_movement"
+	// IncidentTypeCampaign is one indicator seen across several workloads,
+	// as from worm-like spread or a compromised base image.
+	IncidentTypeCampaign = "campaign"
+)
+
+// Campaign indicator types reported in Incident.IndicatorType.
+const (
+	IndicatorExeHash = "exe_hash"
+	IndicatorDstIP   = "dst_ip"
+	IndicatorCmdline = "cmdline"
+)
+
+// Roles of pods in an incident.
+const (
+	PodRoleSource = "source"
+	PodRoleTarget = "target"
+	// PodRoleImpacted marks the pods of a campaign.
+	PodRoleImpacted = "impacted"
+)
+
+// PodRef identifies a pod involved in an incident.
+type PodRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Role      string `json:"role,omitempty"`
+}
+
+// Incident groups events and alerts from one or more pods that together
+// indicate a single attack. Incidents are raised by controller-level
+// correlation across agents; an alert is raised alongside each one so it
+// reaches the usual notification sinks.
+type Incident struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Timestamp   time.Time `json:"timestamp"`
+	Severity    string    `json:"severity"`
+	RuleID      string    `json:"rule_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Pods        []PodRef  `json:"pods"`
+	EventIDs    []string  `json:"event_ids"`
+	AlertIDs    []string  `json:"alert_ids,omitempty"`
+	MitreTactic string    `json:"mitre_tactic,omitempty"`
+	MitreID     string    `json:"mitre_id,omitempty"`
+
+	// IndicatorType and Indicator are what a campaign's pods have in common;
+	// Workloads is its impacted-workload inventory.
+	IndicatorType string     `json:"indicator_type,omitempty"`
+	Indicator     string     `json:"indicator,omitempty"`
+	Workloads     []Workload `json:"workloads,omitempty"`
+
+	// Enrichments are verdicts Sweet Security pushed back about the
+	// incident, oldest first.
+	Enrichments []Enrichment `json:"enrichments,omitempty"`
+}
+
+// Workload is a set of pods from one controller (Deployment, StatefulSet,
+// DaemonSet, Job), identified by namespace and name.
+type Workload struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Pods      []string `json:"pods"`
+}
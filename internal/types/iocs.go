@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+// IOC is an indicator of compromise extracted by the controller from a
+// CRITICAL alert. Extracted IOCs are matched against later events from every
+// pod, like entries of a threat intelligence feed.
+type IOC struct {
+	// Type is IOCTypeIP, IOCTypeDomain or IOCTypeHash.
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// AlertID, RuleID and the pod are those of the alert the IOC was first
+	// extracted from.
+	AlertID      string    `json:"alert_id"`
+	RuleID       string    `json:"rule_id"`
+	PodName      string    `json:"pod_name"`
+	PodNamespace string    `json:"pod_namespace"`
+	FirstSeen    time.Time `json:"first_seen"`
+	// LastSeen is when a CRITICAL alert last carried the IOC.
+	LastSeen time.Time `json:"last_seen"`
+}
@@ -0,0 +1,16 @@
+package types
+
+// Metric types reported in MetricDesc.
+const (
+	MetricTypeCounter   = "counter"
+	MetricTypeGauge     = "gauge"
+	MetricTypeHistogram = "histogram"
+)
+
+// MetricDesc describes a Prometheus metric exposed by the controller.
+type MetricDesc struct {
+	Name   string   `json:"name"`
+	Help   string   `json:"help"`
+	Type   string   `json:"type"`
+	Labels []string `json:"labels,omitempty"`
+}
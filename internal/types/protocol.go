@@ -0,0 +1,57 @@
+package types
+
+// Agent-to-controller protocol versions. Protocol 1 agents post events one
+// at a time without a handshake; protocol 2 agents send an AgentHandshake
+// before registering and use the capabilities the controller grants.
+const (
+	ProtocolV1      = 1
+	ProtocolV2      = 2
+	CurrentProtocol = ProtocolV2
+)
+
+// Capabilities agents and controllers agree on in the handshake.
+const (
+	// CapabilityBatch sends events as arrays to /api/v1/events/batch.
+	CapabilityBatch = "batch"
+	// CapabilityGzip gzip-compresses event request bodies.
+	CapabilityGzip = "gzip"
+	// CapabilityGRPC streams events over the SecurityEventService gRPC API.
+	CapabilityGRPC = "grpc"
+)
+
+// AgentHandshake is what an agent supports, sent before it registers.
+type AgentHandshake struct {
+	AgentID          string   `json:"agent_id"`
+	Version          string   `json:"version,omitempty"`
+	ProtocolVersions []int    `json:"protocol_versions"`
+	SchemaVersions   []string `json:"schema_versions"`
+	Capabilities     []string `json:"capabilities,omitempty"`
+}
+
+// HandshakeResponse is how the controller tells an agent to talk to it: the
+// protocol and schema to use and the capabilities it may use. An agent
+// uses no capability it was not granted.
+type HandshakeResponse struct {
+	ProtocolVersion int      `json:"protocol_version"`
+	SchemaVersion   string   `json:"schema_version"`
+	Capabilities    []string `json:"capabilities"`
+	// MaxBatchEvents and MaxRequestBytes are the controller's ingestion
+	// limits, 0 when there is none.
+	MaxBatchEvents  int   `json:"max_batch_events,omitempty"`
+	MaxRequestBytes int64 `json:"max_request_bytes,omitempty"`
+	// Error says why the agent and controller share no protocol, in which
+	// case the other fields are empty.
+	Error string `json:"error,omitempty"`
+}
+
+// AgentProtocol is the protocol an agent talks to the controller with.
+type AgentProtocol struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Negotiated is false for agents that never sent a handshake, which
+	// are taken to speak protocol 1.
+	Negotiated bool `json:"negotiated"`
+	// Incompatible says why the agent and controller share no protocol,
+	// empty when they do.
+	Incompatible string `json:"incompatible,omitempty"`
+}
@@ -0,0 +1,43 @@
+package types
+
+import "time"
+
+// RuleCoverage reports how well a detection rule is tested and whether it has
+// ever fired, to find dead or untested rules.
+type RuleCoverage struct {
+	RuleID   string `json:"rule_id"`
+	RuleName string `json:"rule_name"`
+	Severity string `json:"severity"`
+	// Fixtures is the number of sample events the rule is tested against.
+	Fixtures int `json:"fixtures"`
+	// Matches counts alerts fired by the rule since the controller started.
+	Matches     int64      `json:"matches"`
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	EverMatched bool       `json:"ever_matched"`
+	// Shadow rules are evaluated but raise no alerts. ShadowMatches counts
+	// what they would have raised, in shadow mode now or earlier, with the
+	// latest in ShadowSamples.
+	Shadow            bool          `json:"shadow,omitempty"`
+	ShadowMatches     int64         `json:"shadow_matches,omitempty"`
+	LastShadowMatchAt *time.Time    `json:"last_shadow_match_at,omitempty"`
+	ShadowSamples     []ShadowMatch `json:"shadow_samples,omitempty"`
+	// Slow rules took the slow rule threshold or longer on their latest
+	// evaluations. Disabled rules are not evaluated, whether turned off
+	// for being slow or through the API.
+	Slow     bool `json:"slow,omitempty"`
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// ShadowMatch is an alert a shadow rule would have raised.
+type ShadowMatch struct {
+	At       time.Time `json:"at"`
+	PodName  string    `json:"pod_name"`
+	PodNS    string    `json:"pod_namespace"`
+	EventIDs []string  `json:"event_ids"`
+}
+
+// RuleUpdate changes a rule's mode; nil fields are left as they are.
+type RuleUpdate struct {
+	Shadow   *bool `json:"shadow"`
+	Disabled *bool `json:"disabled"`
+}
@@ -0,0 +1,28 @@
+package types
+
+import "time"
+
+// SearchQuery selects retained events whose searchable fields contain every
+// whitespace-separated term of Text, case-insensitively, newest first.
+// Namespace and Pod narrow it when set.
+type SearchQuery struct {
+	Text      string
+	Namespace string
+	Pod       string
+	Limit     int
+	Offset    int
+}
+
+// SearchHit is an event matching a search and the field the query's first
+// term was found in, such as "process.cmdline" or "network.dst_ip".
+type SearchHit struct {
+	ID           string         `json:"id"`
+	Timestamp    time.Time      `json:"timestamp"`
+	Type         string         `json:"type"`
+	Severity     string         `json:"severity"`
+	PodNamespace string         `json:"pod_namespace"`
+	PodName      string         `json:"pod_name"`
+	Field        string         `json:"field"`
+	Value        string         `json:"value"`
+	Event        *SecurityEvent `json:"event"`
+}
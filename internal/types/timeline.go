@@ -0,0 +1,91 @@
+package types
+
+import "time"
+
+// Timeline entry kinds.
+const (
+	TimelineEvent     = "event"
+	TimelineAlert     = "alert"
+	TimelineLifecycle = "lifecycle"
+)
+
+// Pod lifecycle actions.
+const (
+	LifecyclePodCreated          = "pod_created"
+	LifecycleContainerStarted    = "container_started"
+	LifecycleContainerRestarted  = "container_restarted"
+	LifecycleContainerTerminated = "container_terminated"
+	// LifecycleExec is a process started in the pod from outside it, as
+	// kubectl exec does, rather than by a container starting.
+	LifecycleExec = "exec"
+	// LifecycleKubeEvent is a Kubernetes Event about the pod, such as
+	// Scheduled, Pulled, Killing or BackOff.
+	LifecycleKubeEvent       = "kube_event"
+	LifecycleAgentRegistered = "agent_registered"
+)
+
+// Lifecycle sources.
+const (
+	LifecycleSourceKubernetes = "kubernetes"
+	LifecycleSourceAgent      = "agent"
+)
+
+// TimelineEntry is one thing that happened to or in a pod: a security
+// event, an alert raised on it, or a lifecycle change. Exactly one of
+// Event, Alert and Lifecycle is set, matching Kind.
+type TimelineEntry struct {
+	// ID is the event or alert ID, or one derived from the lifecycle change.
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	// Summary is a one-line description for display.
+	Summary  string `json:"summary"`
+	Severity string `json:"severity,omitempty"`
+
+	Event     *SecurityEvent     `json:"event,omitempty"`
+	Alert     *Alert             `json:"alert,omitempty"`
+	Lifecycle *PodLifecycleEntry `json:"lifecycle,omitempty"`
+}
+
+// PodLifecycleEntry is a change in a pod's life, from the Kubernetes API or
+// the pod's agent.
+type PodLifecycleEntry struct {
+	Action    string `json:"action"`
+	Source    string `json:"source"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message,omitempty"`
+	// ExitCode is set when a container terminated.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// RestartCount is the container's restart count when it started.
+	RestartCount int32 `json:"restart_count,omitempty"`
+	// Count is how many times a Kubernetes Event repeated.
+	Count int32 `json:"count,omitempty"`
+	// PID is the exec'd process.
+	PID int `json:"pid,omitempty"`
+}
+
+// Timeline is a page of a pod's merged history, ordered by Time.
+type Timeline struct {
+	Namespace string          `json:"namespace"`
+	Pod       string          `json:"pod"`
+	Entries   []TimelineEntry `json:"entries"`
+	// Total is the number of entries matching the query before paging.
+	Total int `json:"total"`
+	// Warnings name sources that could not be read, so a gap in the
+	// timeline is not mistaken for a quiet pod.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TimelineQuery selects a page of a pod's timeline: entries between Since
+// and Until (zero for unbounded) in Order (SortAsc by default), skipping
+// Offset and returning at most Limit.
+type TimelineQuery struct {
+	Namespace string
+	Pod       string
+	Since     time.Time
+	Until     time.Time
+	Order     string
+	Limit     int
+	Offset    int
+}
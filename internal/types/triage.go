@@ -0,0 +1,77 @@
+package types
+
+import "time"
+
+// Probable causes named by triage hints.
+const (
+	// CauseKubectlExec is a shell started shortly after a kubectl exec or
+	// attach into the pod.
+	CauseKubectlExec = "kubectl_exec"
+	// CauseAccountTool is an account file changed by useradd, groupadd or a
+	// similar tool run in the pod.
+	CauseAccountTool = "account_tool"
+	// CauseContainerInit is an account file changed while the container was
+	// starting up.
+	CauseContainerInit = "container_init"
+)
+
+// TriageHint is a likely-benign explanation for an alert, found by
+// correlating it with nearby activity in the same pod. It is a hint for the
+// analyst, not a verdict: the alert is raised either way.
+type TriageHint struct {
+	Cause       string `json:"cause"`
+	Explanation string `json:"explanation"`
+	// EventIDs are the events that support the explanation, such as the
+	// kubectl exec audit event.
+	EventIDs []string `json:"event_ids,omitempty"`
+	// Suppression is the suppression that would silence alerts like this
+	// one with the same probable cause; POST it to accept the hint.
+	Suppression *Suppression `json:"suppression,omitempty"`
+}
+
+// Suppression silences future alerts of a rule. Only alerts in Namespace,
+// when set, and with a triage hint of Cause, when set, are dropped, so a
+// suppression created from a hint keeps firing for the same rule without
+// the benign explanation.
+type Suppression struct {
+	ID        string `json:"id"`
+	RuleID    string `json:"rule_id"`
+	Namespace string `json:"namespace,omitempty"`
+	Cause     string `json:"cause,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// AlertID is the alert the suppression was created from, if any.
+	AlertID   string     `json:"alert_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Matches counts the alerts dropped; LastMatched is the latest.
+	Matches     int64      `json:"matches"`
+	LastMatched *time.Time `json:"last_matched,omitempty"`
+}
+
+// Silences reports whether the suppression silences alert at now.
+func (s *Suppression) Silences(alert *Alert, now time.Time) bool {
+	if s.ExpiresAt != nil && !now.Before(*s.ExpiresAt) {
+		return false
+	}
+	if s.RuleID != alert.RuleID || s.Namespace != "" && s.Namespace != alert.PodNS {
+		return false
+	}
+	if s.Cause == "" {
+		return true
+	}
+	for _, h := range alert.Hints {
+		if h.Cause == s.Cause {
+			return true
+		}
+	}
+	return false
+}
+
+// SuppressRequest is the optional POST body for suppressing an alert. Cause
+// picks one of the alert's hints, defaulting to the first; TTL is a Go
+// duration after which the suppression expires.
+type SuppressRequest struct {
+	Cause  string `json:"cause,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	TTL    string `json:"ttl,omitempty"`
+}
@@ -4,6 +4,7 @@ package webhook
 
 import (
 	"fmt"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -11,6 +12,24 @@ import (
 	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
 )
 
+// Annotation keys read and written by the webhook.
+const (
+	// AnnotationShareProcessNamespace set to "false" injects the sidecar without
+	// enabling shareProcessNamespace, for workloads that rely on being PID 1.
+	AnnotationShareProcessNamespace = "apss.invisible.tech/share-process-namespace"
+	// AnnotationMonitoringMode records the agent monitoring mode ("full" or "degraded").
+	AnnotationMonitoringMode = "apss.invisible.tech/monitoring-mode"
+	// LabelShareProcessNamespace set to "false" on a namespace does the same
+	// for its pods without the annotation.
+	LabelShareProcessNamespace = AnnotationShareProcessNamespace
+)
+
+// Agent monitoring modes passed to the sidecar via APSS_MONITORING_MODE.
+const (
+	MonitoringModeFull     = "full"
+	MonitoringModeDegraded = "degraded"
+)
+
 // PatchOperation represents a JSON patch operation (RFC 6902).
 type PatchOperation struct {
 	Op    string      `json:"op"`
@@ -30,40 +49,112 @@ func ShouldSkipInjection(cfg config.WebhookConfig, pod *corev1.Pod, namespace st
 			return true
 		}
 	}
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == "apss-agent" {
+			return true
+		}
+	}
 	if pod.Annotations != nil {
 		if val, ok := pod.Annotations["apss.invisible.tech/inject"]; ok && val == "false" {
 			return true
 		}
 	}
+	var nsLabels map[string]string
+	if cfg.NamespaceLabels != nil {
+		nsLabels, _ = cfg.NamespaceLabels(namespace)
+	}
+	if !namespaceAllowsInjection(nsLabels, cfg.NamespaceInjectionDefault, pod.Annotations["apss.invisible.tech/inject"] == "true") {
+		return true
+	}
 	if pod.Spec.HostNetwork {
 		return true
 	}
+	if matchesAny(pod.Labels, cfg.ExcludeLabels) || matchesAny(pod.Annotations, cfg.ExcludeAnnotations) {
+		return true
+	}
+	for _, c := range pod.Spec.Containers {
+		if imageFromRegistry(c.Image, cfg.ExcludeImageRegistries) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether kv contains any key of exclude with the same
+// value, or any value when the excluded value is "*".
+func matchesAny(kv, exclude map[string]string) bool {
+	for k, want := range exclude {
+		if got, ok := kv[k]; ok && (want == "*" || got == want) {
+			return true
+		}
+	}
 	return false
 }
 
+// imageFromRegistry reports whether image comes from one of registries. Entries
+// match on path boundaries, so "gcr.io/google-containers" matches
+// "gcr.io/google-containers/pause:3.9" but not "gcr.io/google-containers-x/app".
+// Images without a registry host are treated as docker.io images, and bare
+// names as docker.io/library images.
+func imageFromRegistry(image string, registries []string) bool {
+	if len(registries) == 0 {
+		return false
+	}
+	first, _, found := strings.Cut(image, "/")
+	switch {
+	case !found:
+		image = "docker.io/library/" + image
+	case !strings.ContainsAny(first, ".:") && first != "localhost":
+		image = "docker.io/" + image
+	}
+	for _, r := range registries {
+		r = strings.TrimSuffix(r, "/")
+		if r != "" && strings.HasPrefix(image, r+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MonitoringMode returns the agent monitoring mode for pod. Pods that opt out of
+// shareProcessNamespace, by annotation or by a label on their namespace, get
+// degraded monitoring because the agent cannot see application processes. The
+// pod's annotation, when set, overrides its namespace's label. Pods that
+// already share their process namespace are fully monitored either way.
+func MonitoringMode(cfg config.WebhookConfig, pod *corev1.Pod) string {
+	if pod.Spec.ShareProcessNamespace != nil && *pod.Spec.ShareProcessNamespace {
+		return MonitoringModeFull
+	}
+	share, ok := pod.Annotations[AnnotationShareProcessNamespace]
+	if !ok && cfg.NamespaceLabels != nil {
+		labels, _ := cfg.NamespaceLabels(pod.Namespace)
+		share = labels[LabelShareProcessNamespace]
+	}
+	if share == "false" {
+		return MonitoringModeDegraded
+	}
+	return MonitoringModeFull
+}
+
 // CreateSidecarPatches returns JSON patch operations to inject the APSS sidecar.
 func CreateSidecarPatches(cfg config.WebhookConfig, pod *corev1.Pod) []PatchOperation {
 	var patches []PatchOperation
+	mode := MonitoringMode(cfg, pod)
 
 	sidecar := corev1.Container{
-		Name:  "apss-agent",
-		Image: cfg.SidecarImage,
-		Resources: corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("10m"),
-				corev1.ResourceMemory: resource.MustParse("32Mi"),
-			},
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("100m"),
-				corev1.ResourceMemory: resource.MustParse("128Mi"),
-			},
-		},
+		Name:      "apss-agent",
+		Image:     cfg.SidecarImage,
+		Resources: SidecarResources(cfg, pod),
 		Env: []corev1.EnvVar{
 			{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
 			{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
 			{Name: "NODE_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+			{Name: "POD_IP", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}}},
+			{Name: "POD_SERVICE_ACCOUNT", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.serviceAccountName"}}},
 			{Name: "AGENT_ID", Value: fmt.Sprintf("%s-%s", pod.Name, pod.Namespace)},
 			{Name: "CONTROLLER_ENDPOINT", Value: cfg.ControllerEndpoint},
+			{Name: "APSS_MONITORING_MODE", Value: mode},
+			{Name: "SPOOL_DIR", Value: spoolMountPath},
 		},
 		SecurityContext: &corev1.SecurityContext{
 			RunAsNonRoot:             boolPtr(true),
@@ -73,10 +164,56 @@ func CreateSidecarPatches(cfg config.WebhookConfig, pod *corev1.Pod) []PatchOper
 		},
 		VolumeMounts: []corev1.VolumeMount{
 			{Name: "apss-proc", MountPath: "/proc", ReadOnly: true},
+			{Name: "apss-spool", MountPath: spoolMountPath},
 		},
 	}
 
-	patches = append(patches, PatchOperation{Op: "add", Path: "/spec/containers/-", Value: sidecar})
+	if cfg.AgentTokenSecretName != "" {
+		// Referenced rather than copied, so the token is not readable from
+		// the pod spec. Optional, so a namespace without the Secret still
+		// starts its pods; their agents are then rejected by the controller.
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "CONTROLLER_TOKEN", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cfg.AgentTokenSecretName},
+				Key:                  cfg.AgentTokenSecretKey,
+				Optional:             boolPtr(true),
+			},
+		}})
+	}
+	if cfg.FileBaselineKey != "" {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "FIM_BASELINE_PUBLIC_KEY", Value: cfg.FileBaselineKey})
+	}
+	if cfg.ClusterName != "" {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "CLUSTER_NAME", Value: cfg.ClusterName})
+	}
+	if cfg.Environment != "" {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "ENVIRONMENT", Value: cfg.Environment})
+	}
+	if !cfg.WorkloadIdentityLookup {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "WORKLOAD_IDENTITY_LOOKUP", Value: "false"})
+	}
+	if !cfg.RedactEnvSecrets {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "REDACT_ENV_SECRETS", Value: "false"})
+	}
+	if cfg.ExecProbePolicy != "" {
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "EXEC_PROBE_POLICY", Value: cfg.ExecProbePolicy})
+	}
+	probes, probeEnv := probeAnnotation(pod)
+	sidecar.Env = append(sidecar.Env, probeEnv...)
+	sidecar.Env = append(sidecar.Env, gpuEnv(cfg, pod)...)
+	sidecar.Env = append(sidecar.Env, fanoutEnv(pod)...)
+
+	switch {
+	case !cfg.NativeSidecar:
+		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/containers/-", Value: sidecar})
+	case len(pod.Spec.InitContainers) == 0:
+		sidecar.RestartPolicy = &containerRestartAlways
+		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/initContainers", Value: []corev1.Container{sidecar}})
+	default:
+		// First, so the agent also watches the pod's own init containers.
+		sidecar.RestartPolicy = &containerRestartAlways
+		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/initContainers/0", Value: sidecar})
+	}
 
 	procVolume := corev1.Volume{
 		Name: "apss-proc",
@@ -84,30 +221,64 @@ func CreateSidecarPatches(cfg config.WebhookConfig, pod *corev1.Pod) []PatchOper
 			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: "Memory"},
 		},
 	}
+	// Events spooled while the controller is unreachable; the root filesystem
+	// is read-only, so the agent needs a writable volume that survives restarts.
+	spoolVolume := corev1.Volume{
+		Name: "apss-spool",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: &spoolSizeLimit},
+		},
+	}
 	if len(pod.Spec.Volumes) == 0 {
-		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/volumes", Value: []corev1.Volume{procVolume}})
+		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/volumes", Value: []corev1.Volume{procVolume, spoolVolume}})
 	} else {
-		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/volumes/-", Value: procVolume})
+		patches = append(patches,
+			PatchOperation{Op: "add", Path: "/spec/volumes/-", Value: procVolume},
+			PatchOperation{Op: "add", Path: "/spec/volumes/-", Value: spoolVolume},
+		)
 	}
 
-	if pod.Spec.ShareProcessNamespace == nil || !*pod.Spec.ShareProcessNamespace {
+	if mode == MonitoringModeFull && (pod.Spec.ShareProcessNamespace == nil || !*pod.Spec.ShareProcessNamespace) {
 		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/shareProcessNamespace", Value: true})
 	}
 
 	if pod.Annotations == nil {
+		annotations := map[string]string{"apss.invisible.tech/injected": "true", AnnotationMonitoringMode: mode}
+		if probes != "" {
+			annotations[AnnotationProbeCommands] = probes
+		}
 		patches = append(patches, PatchOperation{
-			Op: "add", Path: "/metadata/annotations",
-			Value: map[string]string{"apss.invisible.tech/injected": "true"},
+			Op: "add", Path: "/metadata/annotations", Value: annotations,
 		})
 	} else {
 		patches = append(patches, PatchOperation{
 			Op: "add", Path: "/metadata/annotations/apss.invisible.tech~1injected", Value: "true",
+		}, PatchOperation{
+			Op: "add", Path: "/metadata/annotations/" + escapeJSONPointer(AnnotationMonitoringMode), Value: mode,
 		})
+		if probes != "" {
+			patches = append(patches, PatchOperation{
+				Op: "add", Path: "/metadata/annotations/" + escapeJSONPointer(AnnotationProbeCommands), Value: probes,
+			})
+		}
 	}
 
 	return patches
 }
 
+// escapeJSONPointer escapes a map key for use in a JSON patch path (RFC 6901).
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+var containerRestartAlways = corev1.ContainerRestartPolicyAlways
+
+// spoolMountPath is where the agent spools events it could not send. The
+// volume is sized a little above the agent's default SPOOL_MAX_MB.
+const spoolMountPath = "/var/spool/apss"
+
+var spoolSizeLimit = resource.MustParse("80Mi")
+
 func boolPtr(b bool) *bool {
 	return &b
 }
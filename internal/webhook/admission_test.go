@@ -1,6 +1,8 @@
 package webhook
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
@@ -63,6 +65,42 @@ func TestShouldSkipInjection_HostNetwork(t *testing.T) {
 	}
 }
 
+func TestShouldSkipInjection_LabelsAnnotationsRegistries(t *testing.T) {
+	cfg := config.WebhookConfig{
+		ExcludeLabels:          map[string]string{"team": "platform", "batch": "*"},
+		ExcludeAnnotations:     map[string]string{"sidecar.istio.io/inject": "false"},
+		ExcludeImageRegistries: []string{"gke.gcr.io", "gcr.io/google-containers", "docker.io/library"},
+	}
+	tests := []struct {
+		name   string
+		labels map[string]string
+		annos  map[string]string
+		image  string
+		want   bool
+	}{
+		{"label value match", map[string]string{"team": "platform"}, nil, "app:1", true},
+		{"label value mismatch", map[string]string{"team": "web"}, nil, "gcr.io/app/web:1", false},
+		{"label wildcard", map[string]string{"batch": "nightly"}, nil, "gcr.io/app/web:1", true},
+		{"annotation match", nil, map[string]string{"sidecar.istio.io/inject": "false"}, "gcr.io/app/web:1", true},
+		{"registry host", nil, nil, "gke.gcr.io/kube-proxy:v1", true},
+		{"registry path prefix", nil, nil, "gcr.io/google-containers/pause:3.9", true},
+		{"registry path boundary", nil, nil, "gcr.io/google-containers-x/app:1", false},
+		{"docker hub short name", nil, nil, "nginx:1.25", true},
+		{"docker hub user image", nil, nil, "someuser/app:1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: tt.labels, Annotations: tt.annos},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: tt.image}}},
+			}
+			if got := ShouldSkipInjection(cfg, pod, "default"); got != tt.want {
+				t.Errorf("ShouldSkipInjection = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestCreateSidecarPatches(t *testing.T) {
 	cfg := config.WebhookConfig{
 		SidecarImage:       "apss-agent:test",
@@ -114,3 +152,369 @@ func TestCreateSidecarPatches_PodWithVolumes(t *testing.T) {
 		t.Error("expected patch for /spec/volumes/- when pod already has volumes")
 	}
 }
+
+func TestCreateSidecarPatches_SpoolVolume(t *testing.T) {
+	cfg := config.WebhookConfig{SidecarImage: "agent:test", ControllerEndpoint: "ctrl:8080"}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	patches := CreateSidecarPatches(cfg, pod)
+	sidecar := patches[0].Value.(corev1.Container)
+	mounted := false
+	for _, m := range sidecar.VolumeMounts {
+		if m.Name == "apss-spool" && m.MountPath == spoolMountPath && !m.ReadOnly {
+			mounted = true
+		}
+	}
+	if !mounted {
+		t.Errorf("sidecar mounts %v, want writable apss-spool at %s", sidecar.VolumeMounts, spoolMountPath)
+	}
+	spoolEnv := ""
+	for _, e := range sidecar.Env {
+		if e.Name == "SPOOL_DIR" {
+			spoolEnv = e.Value
+		}
+	}
+	if spoolEnv != spoolMountPath {
+		t.Errorf("SPOOL_DIR = %q, want %q", spoolEnv, spoolMountPath)
+	}
+	podIP, serviceAccount := false, false
+	for _, e := range sidecar.Env {
+		if e.ValueFrom == nil || e.ValueFrom.FieldRef == nil {
+			continue
+		}
+		switch {
+		case e.Name == "POD_IP" && e.ValueFrom.FieldRef.FieldPath == "status.podIP":
+			podIP = true
+		case e.Name == "POD_SERVICE_ACCOUNT" && e.ValueFrom.FieldRef.FieldPath == "spec.serviceAccountName":
+			serviceAccount = true
+		}
+	}
+	if !podIP {
+		t.Error("sidecar env has no POD_IP from status.podIP")
+	}
+	if !serviceAccount {
+		t.Error("sidecar env has no POD_SERVICE_ACCOUNT from spec.serviceAccountName")
+	}
+	for _, p := range patches {
+		if p.Path != "/spec/volumes" {
+			continue
+		}
+		vols := p.Value.([]corev1.Volume)
+		if len(vols) != 2 || vols[1].Name != "apss-spool" || vols[1].EmptyDir == nil {
+			t.Errorf("volumes = %+v, want apss-proc and an apss-spool emptyDir", vols)
+		}
+		return
+	}
+	t.Error("no /spec/volumes patch")
+}
+
+func TestCreateSidecarPatches_WorkloadIdentityLookup(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	for _, enabled := range []bool{true, false} {
+		cfg := config.WebhookConfig{SidecarImage: "agent:test", WorkloadIdentityLookup: enabled}
+		sidecar := CreateSidecarPatches(cfg, pod)[0].Value.(corev1.Container)
+		disabled := false
+		for _, e := range sidecar.Env {
+			if e.Name == "WORKLOAD_IDENTITY_LOOKUP" && e.Value == "false" {
+				disabled = true
+			}
+		}
+		if disabled == enabled {
+			t.Errorf("lookup enabled %v: sidecar env %v", enabled, sidecar.Env)
+		}
+	}
+}
+
+func TestCreateSidecarPatches_Cluster(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	cfg := config.WebhookConfig{SidecarImage: "agent:test", ClusterName: "prod-us", Environment: "production"}
+	sidecar := CreateSidecarPatches(cfg, pod)[0].Value.(corev1.Container)
+	env := map[string]string{}
+	for _, e := range sidecar.Env {
+		env[e.Name] = e.Value
+	}
+	if env["CLUSTER_NAME"] != "prod-us" || env["ENVIRONMENT"] != "production" {
+		t.Errorf("sidecar env = %v", sidecar.Env)
+	}
+
+	sidecar = CreateSidecarPatches(config.WebhookConfig{SidecarImage: "agent:test"}, pod)[0].Value.(corev1.Container)
+	for _, e := range sidecar.Env {
+		if e.Name == "CLUSTER_NAME" || e.Name == "ENVIRONMENT" {
+			t.Errorf("unset %s injected", e.Name)
+		}
+	}
+}
+
+func TestCreateSidecarPatches_AgentToken(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	cfg := config.WebhookConfig{SidecarImage: "agent:test", AgentToken: "fleet-secret",
+		AgentTokenSecretName: "apss-agent-token", AgentTokenSecretKey: "token"}
+	patches := CreateSidecarPatches(cfg, pod)
+	if data, _ := json.Marshal(patches); strings.Contains(string(data), "fleet-secret") {
+		t.Fatalf("token value copied into the patch: %s", data)
+	}
+	var token *corev1.EnvVar
+	for _, e := range patches[0].Value.(corev1.Container).Env {
+		if e.Name == "CONTROLLER_TOKEN" {
+			token = &e
+		}
+	}
+	if token == nil || token.ValueFrom == nil || token.ValueFrom.SecretKeyRef == nil ||
+		token.ValueFrom.SecretKeyRef.Name != "apss-agent-token" || token.ValueFrom.SecretKeyRef.Key != "token" {
+		t.Errorf("CONTROLLER_TOKEN = %+v", token)
+	}
+
+	cfg.AgentTokenSecretName = ""
+	for _, e := range CreateSidecarPatches(cfg, pod)[0].Value.(corev1.Container).Env {
+		if e.Name == "CONTROLLER_TOKEN" {
+			t.Errorf("CONTROLLER_TOKEN injected without a Secret: %+v", e)
+		}
+	}
+}
+
+func TestCreateSidecarPatches_ProbeCommands(t *testing.T) {
+	probe := func(cmd ...string) *corev1.Probe {
+		return &corev1.Probe{ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: cmd}}}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns", Annotations: map[string]string{}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "db", LivenessProbe: probe("sh", "-c", "pg_isready"), ReadinessProbe: probe("sh", "-c", "pg_isready")},
+			{Name: "web", StartupProbe: probe("cat", "/tmp/ready"), LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/"}}}},
+		}},
+	}
+	patches := CreateSidecarPatches(config.WebhookConfig{SidecarImage: "agent:test"}, pod)
+	var annotation string
+	for _, p := range patches {
+		if p.Path == "/metadata/annotations/apss.invisible.tech~1probe-commands" {
+			annotation = p.Value.(string)
+		}
+	}
+	if want := `[["sh","-c","pg_isready"],["cat","/tmp/ready"]]`; annotation != want {
+		t.Errorf("probe commands annotation = %s, want %s", annotation, want)
+	}
+	found := false
+	for _, e := range patches[0].Value.(corev1.Container).Env {
+		if e.Name == "PROBE_COMMANDS" && e.ValueFrom != nil && e.ValueFrom.FieldRef.FieldPath == "metadata.annotations['apss.invisible.tech/probe-commands']" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("PROBE_COMMANDS not read from the annotation")
+	}
+
+	pod.Spec.Containers = []corev1.Container{{Name: "app"}}
+	for _, p := range CreateSidecarPatches(config.WebhookConfig{SidecarImage: "agent:test"}, pod) {
+		if p.Path == "/metadata/annotations/apss.invisible.tech~1probe-commands" {
+			t.Error("probe commands annotated on a pod without exec probes")
+		}
+	}
+}
+
+func TestCreateSidecarPatches_RedactEnvSecrets(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	for _, redact := range []bool{true, false} {
+		cfg := config.WebhookConfig{SidecarImage: "agent:test", RedactEnvSecrets: redact}
+		sidecar := CreateSidecarPatches(cfg, pod)[0].Value.(corev1.Container)
+		clear := false
+		for _, e := range sidecar.Env {
+			if e.Name == "REDACT_ENV_SECRETS" && e.Value == "false" {
+				clear = true
+			}
+		}
+		if clear == redact {
+			t.Errorf("redact %v: sidecar env %v", redact, sidecar.Env)
+		}
+	}
+}
+
+func TestCreateSidecarPatches_GPU(t *testing.T) {
+	cfg := config.WebhookConfig{
+		SidecarImage:        "agent:test",
+		GPUNamespaces:       []string{"ml"},
+		GPUMetricsURL:       "http://$(NODE_IP):9400/metrics",
+		GPUAllowedProcesses: []string{"dcgm-exporter"},
+	}
+	env := func(ns string, labels map[string]string) map[string]string {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: ns, Labels: labels},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		}
+		got := map[string]string{}
+		for _, e := range CreateSidecarPatches(cfg, pod)[0].Value.(corev1.Container).Env {
+			got[e.Name] = e.Value
+			if e.ValueFrom != nil && e.ValueFrom.FieldRef != nil {
+				got[e.Name] = e.ValueFrom.FieldRef.FieldPath
+			}
+		}
+		return got
+	}
+
+	if got := env("web", nil); got["GPU_MONITOR"] != "" {
+		t.Errorf("outside GPU namespaces: GPU_MONITOR = %q", got["GPU_MONITOR"])
+	}
+	got := env("ml", map[string]string{LabelGPUWorkload: "true"})
+	if got["GPU_MONITOR"] != "true" || got["GPU_WORKLOAD"] != "true" || got["GPU_ALLOWED_PROCESSES"] != "dcgm-exporter" ||
+		got["NODE_IP"] != "status.hostIP" || got["GPU_METRICS_URL"] != cfg.GPUMetricsURL {
+		t.Errorf("GPU workload env = %v", got)
+	}
+	if got := env("ml", nil); got["GPU_MONITOR"] != "true" || got["GPU_WORKLOAD"] != "false" {
+		t.Errorf("unlabelled pod env = %v", got)
+	}
+	cfg.GPUNamespaces = []string{"*"}
+	if got := env("web", nil); got["GPU_MONITOR"] != "true" {
+		t.Errorf("with *: GPU_MONITOR = %q", got["GPU_MONITOR"])
+	}
+}
+
+func TestCreateSidecarPatches_FanoutAnnotations(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns", Annotations: map[string]string{
+			AnnotationFanoutConnections:  "200",
+			AnnotationFanoutDestinations: "lots",
+			AnnotationFanoutSigma:        "4.5",
+		}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	got := map[string]string{}
+	for _, e := range CreateSidecarPatches(config.WebhookConfig{SidecarImage: "agent:test"}, pod)[0].Value.(corev1.Container).Env {
+		got[e.Name] = e.Value
+	}
+	if got["FANOUT_MIN_CONNECTIONS"] != "200" || got["FANOUT_SIGMA"] != "4.5" {
+		t.Errorf("sidecar env = %v", got)
+	}
+	if _, ok := got["FANOUT_MIN_DESTINATIONS"]; ok {
+		t.Error("unparseable annotation should be ignored")
+	}
+}
+
+func TestCreateSidecarPatches_ShareProcessNamespaceOptOut(t *testing.T) {
+	cfg := config.WebhookConfig{SidecarImage: "agent:test", ControllerEndpoint: "ctrl:8080"}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "p", Namespace: "ns",
+			Annotations: map[string]string{AnnotationShareProcessNamespace: "false"},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	if mode := MonitoringMode(cfg, pod); mode != MonitoringModeDegraded {
+		t.Fatalf("MonitoringMode = %q, want degraded", mode)
+	}
+	patches := CreateSidecarPatches(cfg, pod)
+	foundMode := false
+	for _, p := range patches {
+		if p.Path == "/spec/shareProcessNamespace" {
+			t.Error("shareProcessNamespace must not be patched when opted out")
+		}
+		if p.Path == "/metadata/annotations/apss.invisible.tech~1monitoring-mode" && p.Value == MonitoringModeDegraded {
+			foundMode = true
+		}
+	}
+	if !foundMode {
+		t.Error("expected monitoring-mode=degraded annotation patch")
+	}
+	sidecar := patches[0].Value.(corev1.Container)
+	foundEnv := false
+	for _, e := range sidecar.Env {
+		if e.Name == "APSS_MONITORING_MODE" && e.Value == MonitoringModeDegraded {
+			foundEnv = true
+		}
+	}
+	if !foundEnv {
+		t.Error("expected APSS_MONITORING_MODE=degraded on sidecar")
+	}
+}
+
+func TestMonitoringMode(t *testing.T) {
+	labels := map[string]map[string]string{"legacy": {LabelShareProcessNamespace: "false"}}
+	cfg := config.WebhookConfig{NamespaceLabels: func(ns string) (map[string]string, bool) {
+		l, ok := labels[ns]
+		return l, ok
+	}}
+	optOut := map[string]string{AnnotationShareProcessNamespace: "false"}
+	optIn := map[string]string{AnnotationShareProcessNamespace: "true"}
+	tests := []struct {
+		name        string
+		namespace   string
+		annotations map[string]string
+		share       *bool
+		want        string
+	}{
+		{"default", "plain", nil, nil, MonitoringModeFull},
+		{"pod annotation", "plain", optOut, nil, MonitoringModeDegraded},
+		{"namespace label", "legacy", nil, nil, MonitoringModeDegraded},
+		{"pod annotation overrides namespace label", "legacy", optIn, nil, MonitoringModeFull},
+		{"already sharing", "plain", optOut, boolPtr(true), MonitoringModeFull},
+		{"already sharing in labelled namespace", "legacy", nil, boolPtr(true), MonitoringModeFull},
+		{"explicitly not sharing", "plain", optOut, boolPtr(false), MonitoringModeDegraded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: tt.namespace, Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}, ShareProcessNamespace: tt.share},
+			}
+			if got := MonitoringMode(cfg, pod); got != tt.want {
+				t.Errorf("MonitoringMode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := MonitoringMode(config.WebhookConfig{}, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "legacy"}}); got != MonitoringModeFull {
+		t.Errorf("MonitoringMode without a namespace cache = %q, want full", got)
+	}
+}
+
+func TestCreateSidecarPatches_NativeSidecar(t *testing.T) {
+	cfg := config.WebhookConfig{SidecarImage: "agent:test", ControllerEndpoint: "ctrl:8080", NativeSidecar: true}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "ns"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	patches := CreateSidecarPatches(cfg, pod)
+	if patches[0].Path != "/spec/initContainers" {
+		t.Fatalf("first patch path = %q, want /spec/initContainers", patches[0].Path)
+	}
+	containers, ok := patches[0].Value.([]corev1.Container)
+	if !ok || len(containers) != 1 {
+		t.Fatalf("first patch value = %#v", patches[0].Value)
+	}
+	if rp := containers[0].RestartPolicy; rp == nil || *rp != corev1.ContainerRestartPolicyAlways {
+		t.Errorf("restartPolicy = %v, want Always", rp)
+	}
+
+	pod.Spec.InitContainers = []corev1.Container{{Name: "migrate"}}
+	patches = CreateSidecarPatches(cfg, pod)
+	if patches[0].Path != "/spec/initContainers/0" {
+		t.Errorf("with init containers, path = %q, want /spec/initContainers/0", patches[0].Path)
+	}
+	if sidecar := patches[0].Value.(corev1.Container); sidecar.RestartPolicy == nil {
+		t.Error("native sidecar must set restartPolicy")
+	}
+}
+
+func TestShouldSkipInjection_NativeSidecarPresent(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "apss-agent"}},
+			Containers:     []corev1.Container{{Name: "app"}},
+		},
+	}
+	if !ShouldSkipInjection(config.WebhookConfig{}, pod, "default") {
+		t.Error("expected skip when apss-agent is already a native sidecar")
+	}
+}
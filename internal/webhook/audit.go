@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+const (
+	// AuditAgentID identifies the webhook as the source of admission events.
+	AuditAgentID = "apss-webhook"
+	// auditEventType matches the agents' k8s_audit event type.
+	auditEventType = "k8s_audit"
+	// auditQueueSize bounds admission events waiting to be sent; more are
+	// dropped so admission never blocks on the controller.
+	auditQueueSize = 1000
+)
+
+// AuditReporter sends admission events to the controller's event API in the
+// background. A nil *AuditReporter discards events.
+type AuditReporter struct {
+	url    string
+	token  string
+	client *http.Client
+	log    *logrus.Logger
+	queue  chan *types.SecurityEvent
+}
+
+// NewAuditReporter returns a reporter posting to the controller at endpoint
+// (host:port), authenticating with token if set. Call Run to start sending.
+func NewAuditReporter(endpoint, token string, log *logrus.Logger) *AuditReporter {
+	return &AuditReporter{
+		url:    fmt.Sprintf("http://%s/api/v1/events", endpoint),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+		log:    log,
+		queue:  make(chan *types.SecurityEvent, auditQueueSize),
+	}
+}
+
+// Report queues event, dropping it if the queue is full.
+func (r *AuditReporter) Report(event *types.SecurityEvent) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.queue <- event:
+	default:
+		r.log.WithField("event_id", event.ID).Warn("Audit event queue full, dropping admission event")
+	}
+}
+
+// Run sends queued events until ctx is done.
+func (r *AuditReporter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-r.queue:
+			if err := r.send(ctx, event); err != nil {
+				r.log.WithError(err).WithField("event_id", event.ID).Warn("Failed to send admission event to controller")
+			}
+		}
+	}
+}
+
+func (r *AuditReporter) send(ctx context.Context, event *types.SecurityEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("controller returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+func TestAuditReporter_SendsEvents(t *testing.T) {
+	received := make(chan types.SecurityEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/events" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("request %s auth=%q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var event types.SecurityEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	r := NewAuditReporter(strings.TrimPrefix(srv.URL, "http://"), "secret", logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	r.Report(&types.SecurityEvent{ID: "admission-1", Type: auditEventType, Audit: &types.AuditEventData{Verb: "create"}})
+	select {
+	case event := <-received:
+		if event.ID != "admission-1" || event.Audit == nil || event.Audit.Verb != "create" {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not sent")
+	}
+}
+
+func TestAuditReporter_NilAndFullQueue(t *testing.T) {
+	var nilReporter *AuditReporter
+	nilReporter.Report(&types.SecurityEvent{ID: "x"})
+
+	r := NewAuditReporter("controller:8080", "", logrus.New())
+	for i := 0; i < auditQueueSize+10; i++ {
+		r.Report(&types.SecurityEvent{ID: "x"})
+	}
+	if len(r.queue) != auditQueueSize {
+		t.Errorf("queue length = %d, want %d", len(r.queue), auditQueueSize)
+	}
+}
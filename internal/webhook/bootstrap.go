@@ -0,0 +1,348 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+const (
+	// Secret keys; tls.crt and tls.key match the kubernetes.io/tls layout.
+	secretKeyCACert = "ca.crt"
+	secretKeyCAKey  = "ca.key"
+	secretKeyCert   = "tls.crt"
+	secretKeyKey    = "tls.key"
+
+	caValidity      = 10 * 365 * 24 * time.Hour
+	servingValidity = 365 * 24 * time.Hour
+	// certRenewBefore is how long before expiry a certificate is replaced.
+	certRenewBefore = 30 * 24 * time.Hour
+	// certCheckInterval is how often Run re-checks the Secret and CA bundles.
+	certCheckInterval = 12 * time.Hour
+	// certEnsureAttempts bounds retries when replicas race to write the Secret.
+	certEnsureAttempts = 3
+)
+
+// certBundle is the CA and serving key pair kept in the certificate Secret.
+type certBundle struct {
+	caCert, caKey, cert, key []byte
+}
+
+// CertBootstrapper issues and renews the webhook's own CA and serving
+// certificate without cert-manager. The pair is shared between replicas
+// through a Secret, written to the files the CertReloader serves, and the CA
+// is patched into the mutating and validating webhook configurations.
+type CertBootstrapper struct {
+	client                *kube.Client
+	namespace, secretName string
+	webhookConfig         string
+	dnsNames              []string
+	certFile, keyFile     string
+	log                   *logrus.Logger
+	now                   func() time.Time
+}
+
+// NewCertBootstrapper returns a bootstrapper for cfg using the in-cluster
+// API client.
+func NewCertBootstrapper(cfg config.WebhookConfig, log *logrus.Logger) (*CertBootstrapper, error) {
+	client, err := kube.NewInCluster()
+	if err != nil {
+		return nil, err
+	}
+	return newCertBootstrapper(client, cfg, log), nil
+}
+
+func newCertBootstrapper(client *kube.Client, cfg config.WebhookConfig, log *logrus.Logger) *CertBootstrapper {
+	svc, ns := cfg.ServiceName, cfg.Namespace
+	return &CertBootstrapper{
+		client:        client,
+		namespace:     ns,
+		secretName:    cfg.CertSecretName,
+		webhookConfig: cfg.WebhookConfigName,
+		dnsNames:      []string{svc, svc + "." + ns, svc + "." + ns + ".svc", svc + "." + ns + ".svc.cluster.local"},
+		certFile:      cfg.TLSCertFile,
+		keyFile:       cfg.TLSKeyFile,
+		log:           log,
+		now:           time.Now,
+	}
+}
+
+// Run re-checks the certificates every certCheckInterval until ctx is done,
+// renewing them before they expire.
+func (b *CertBootstrapper) Run(ctx context.Context) {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.Ensure(ctx); err != nil {
+				b.log.WithError(err).Error("Failed to renew webhook certificates")
+			}
+		}
+	}
+}
+
+// Ensure makes sure the Secret holds a valid CA and serving certificate,
+// writes the serving pair to disk and patches the CA bundle into the webhook
+// configurations. It is safe to run from several replicas at once: a replica
+// that loses the race to write the Secret adopts the winner's certificates.
+func (b *CertBootstrapper) Ensure(ctx context.Context) error {
+	var (
+		bundle *certBundle
+		err    error
+	)
+	for attempt := 0; attempt < certEnsureAttempts; attempt++ {
+		if bundle, err = b.ensureSecret(ctx); err == nil || !kube.IsStatus(err, http.StatusConflict) {
+			break
+		}
+		b.log.Debug("Certificate Secret changed concurrently, retrying")
+	}
+	if err != nil {
+		return err
+	}
+	if err := b.writeKeyPair(bundle); err != nil {
+		return err
+	}
+	for _, kind := range []string{"mutatingwebhookconfigurations", "validatingwebhookconfigurations"} {
+		if err := b.patchCABundle(ctx, kind, bundle.caCert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureSecret loads the Secret and issues or renews certificates as needed.
+// A 409 from the API server means another replica wrote it first.
+func (b *CertBootstrapper) ensureSecret(ctx context.Context) (*certBundle, error) {
+	path := fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", b.namespace, b.secretName)
+	var secret corev1.Secret
+	err := b.client.Get(ctx, path, &secret)
+	exists := err == nil
+	if err != nil && !kube.IsStatus(err, http.StatusNotFound) {
+		return nil, fmt.Errorf("get certificate secret: %w", err)
+	}
+
+	bundle := &certBundle{
+		caCert: secret.Data[secretKeyCACert],
+		caKey:  secret.Data[secretKeyCAKey],
+		cert:   secret.Data[secretKeyCert],
+		key:    secret.Data[secretKeyKey],
+	}
+	now := b.now()
+	switch {
+	case !certUsable(bundle.caCert, bundle.caKey, now, nil):
+		b.log.Info("Issuing webhook CA and serving certificate")
+		if bundle, err = issueCertBundle(b.dnsNames, now); err != nil {
+			return nil, err
+		}
+	case !certUsable(bundle.cert, bundle.key, now, b.dnsNames):
+		b.log.Info("Renewing webhook serving certificate")
+		if bundle.cert, bundle.key, err = issueServingCert(bundle.caCert, bundle.caKey, b.dnsNames, now); err != nil {
+			return nil, err
+		}
+	default:
+		return bundle, nil
+	}
+
+	secret.Type = corev1.SecretTypeTLS
+	secret.Data = map[string][]byte{
+		secretKeyCACert: bundle.caCert,
+		secretKeyCAKey:  bundle.caKey,
+		secretKeyCert:   bundle.cert,
+		secretKeyKey:    bundle.key,
+	}
+	if exists {
+		// The resourceVersion from the GET makes this fail with 409 if
+		// another replica updated the Secret in between.
+		err = b.client.Send(ctx, http.MethodPut, path, "application/json", &secret, nil)
+	} else {
+		secret.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+		secret.ObjectMeta = metav1.ObjectMeta{Name: b.secretName, Namespace: b.namespace}
+		err = b.client.Send(ctx, http.MethodPost, fmt.Sprintf("/api/v1/namespaces/%s/secrets", b.namespace), "application/json", &secret, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("save certificate secret: %w", err)
+	}
+	return bundle, nil
+}
+
+// writeKeyPair writes the serving pair for the CertReloader, skipping files
+// that are already up to date. Each file is replaced atomically.
+func (b *CertBootstrapper) writeKeyPair(bundle *certBundle) error {
+	for _, f := range []struct {
+		path string
+		data []byte
+	}{{b.keyFile, bundle.key}, {b.certFile, bundle.cert}} {
+		if old, err := os.ReadFile(f.path); err == nil && bytes.Equal(old, f.data) {
+			continue
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(f.path), ".tmp-"+filepath.Base(f.path))
+		if err != nil {
+			return fmt.Errorf("write %s: %w", f.path, err)
+		}
+		_, err = tmp.Write(f.data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), f.path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("write %s: %w", f.path, err)
+		}
+	}
+	return nil
+}
+
+// patchCABundle sets caBundle on every webhook in the named configuration of
+// kind. A missing configuration (e.g. no policies enabled) is skipped.
+func (b *CertBootstrapper) patchCABundle(ctx context.Context, kind string, ca []byte) error {
+	path := fmt.Sprintf("/apis/admissionregistration.k8s.io/v1/%s/%s", kind, b.webhookConfig)
+	// Mutating and validating configurations share the webhooks/clientConfig
+	// layout, so one type decodes both.
+	var cfg admissionregistrationv1.ValidatingWebhookConfiguration
+	if err := b.client.Get(ctx, path, &cfg); err != nil {
+		if kube.IsStatus(err, http.StatusNotFound) {
+			b.log.WithField("kind", kind).Debug("Webhook configuration not found, skipping CA bundle")
+			return nil
+		}
+		return fmt.Errorf("get %s: %w", kind, err)
+	}
+	var ops []PatchOperation
+	for i, wh := range cfg.Webhooks {
+		if !bytes.Equal(wh.ClientConfig.CABundle, ca) {
+			ops = append(ops, PatchOperation{Op: "add", Path: fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i), Value: ca})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	if err := b.client.Send(ctx, http.MethodPatch, path, "application/json-patch+json", ops, nil); err != nil {
+		return fmt.Errorf("patch %s CA bundle: %w", kind, err)
+	}
+	b.log.WithFields(logrus.Fields{"kind": kind, "name": b.webhookConfig}).Info("Patched webhook CA bundle")
+	return nil
+}
+
+// certUsable reports whether certPEM/keyPEM form a valid pair that is not
+// within certRenewBefore of expiry and covers every name in dnsNames.
+func certUsable(certPEM, keyPEM []byte, now time.Time, dnsNames []string) bool {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || now.Add(certRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// issueCertBundle creates a new CA and a serving certificate signed by it.
+func issueCertBundle(dnsNames []string, now time.Time) (*certBundle, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: "apss-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create CA certificate: %w", err)
+	}
+	caKey, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &certBundle{caCert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), caKey: caKey}
+	if bundle.cert, bundle.key, err = issueServingCert(bundle.caCert, bundle.caKey, dnsNames, now); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// issueServingCert signs a serving certificate for dnsNames with the CA.
+func issueServingCert(caCertPEM, caKeyPEM []byte, dnsNames []string, now time.Time) ([]byte, []byte, error) {
+	ca, err := tls.X509KeyPair(caCertPEM, caKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load CA: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	notAfter := now.Add(servingValidity)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerial(),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create serving certificate: %w", err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func newSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return serial
+}
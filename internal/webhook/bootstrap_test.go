@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// fakeCertAPI serves the Secret and webhook configuration endpoints the
+// bootstrapper uses, recording writes.
+type fakeCertAPI struct {
+	mu       sync.Mutex
+	secret   *corev1.Secret
+	caBundle []byte
+	writes   []string
+}
+
+func (f *fakeCertAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	const secretPath = "/api/v1/namespaces/apss-system/secrets/apss-webhook-certs"
+	const mutatingPath = "/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations/apss-webhook"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == secretPath:
+		if f.secret == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.secret)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/apss-system/secrets",
+		r.Method == http.MethodPut && r.URL.Path == secretPath:
+		f.writes = append(f.writes, r.Method+" secret")
+		f.secret = &corev1.Secret{}
+		json.NewDecoder(r.Body).Decode(f.secret)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodGet && r.URL.Path == mutatingPath:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"webhooks": []map[string]interface{}{{"name": "sidecar", "clientConfig": map[string]interface{}{"caBundle": f.caBundle}}},
+		})
+	case r.Method == http.MethodPatch && r.URL.Path == mutatingPath:
+		if ct := r.Header.Get("Content-Type"); ct != "application/json-patch+json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		var ops []struct {
+			Path  string `json:"path"`
+			Value []byte `json:"value"`
+		}
+		json.NewDecoder(r.Body).Decode(&ops)
+		if len(ops) == 1 && ops[0].Path == "/webhooks/0/clientConfig/caBundle" {
+			f.caBundle = ops[0].Value
+		}
+		f.writes = append(f.writes, "PATCH mutating")
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeCertAPI) takeWrites() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.writes
+	f.writes = nil
+	return w
+}
+
+func TestCertBootstrapper_Ensure(t *testing.T) {
+	api := &fakeCertAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := config.WebhookConfig{
+		TLSCertFile: filepath.Join(dir, "tls.crt"), TLSKeyFile: filepath.Join(dir, "tls.key"),
+		CertSecretName: "apss-webhook-certs", WebhookConfigName: "apss-webhook",
+		Namespace: "apss-system", ServiceName: "apss-webhook",
+	}
+	b := newCertBootstrapper(kube.NewClient(srv.URL, srv.Client()), cfg, logrus.New())
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := b.Ensure(ctx); err != nil {
+		t.Fatalf("first Ensure: %v", err)
+	}
+	if got := api.takeWrites(); !equalStrings(got, []string{"POST secret", "PATCH mutating"}) {
+		t.Errorf("first Ensure writes = %v", got)
+	}
+	ca := api.secret.Data[secretKeyCACert]
+	if !bytes.Equal(api.caBundle, ca) {
+		t.Error("mutating webhook caBundle not set to the CA")
+	}
+	servingCert := readCert(t, cfg.TLSCertFile)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	if _, err := servingCert.Verify(x509.VerifyOptions{DNSName: "apss-webhook.apss-system.svc", Roots: pool}); err != nil {
+		t.Errorf("serving certificate does not verify against the CA: %v", err)
+	}
+
+	if err := b.Ensure(ctx); err != nil {
+		t.Fatalf("second Ensure: %v", err)
+	}
+	if got := api.takeWrites(); len(got) != 0 {
+		t.Errorf("up-to-date Ensure should not write, got %v", got)
+	}
+
+	// Close to expiry the serving certificate is renewed under the same CA.
+	now = servingCert.NotAfter.Add(-time.Hour)
+	if err := b.Ensure(ctx); err != nil {
+		t.Fatalf("renewal Ensure: %v", err)
+	}
+	if got := api.takeWrites(); !equalStrings(got, []string{"PUT secret"}) {
+		t.Errorf("renewal writes = %v", got)
+	}
+	if !bytes.Equal(api.secret.Data[secretKeyCACert], ca) {
+		t.Error("renewal replaced the CA")
+	}
+	if renewed := readCert(t, cfg.TLSCertFile); renewed.SerialNumber.Cmp(servingCert.SerialNumber) == 0 {
+		t.Error("serving certificate file was not renewed")
+	}
+}
+
+func readCert(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s is not PEM", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse %s: %v", path, err)
+	}
+	return cert
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var certExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "apss_webhook_certificate_expiry_timestamp_seconds",
+	Help: "NotAfter of the TLS certificate the webhook is serving, as a Unix timestamp",
+})
+
+func init() {
+	prometheus.MustRegister(certExpiry)
+}
+
+// CertReloader serves the webhook's TLS key pair and reloads it when the
+// mounted Secret is rotated, so renewed certificates are picked up without a
+// restart. The cert and key are expected to live in the same directory, as
+// they do in a Secret volume.
+type CertReloader struct {
+	certFile, keyFile string
+	log               *logrus.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader loads the key pair from certFile and keyFile.
+func NewCertReloader(certFile, keyFile string, log *logrus.Logger) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, log: log}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current key pair. It is meant for
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *CertReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair from %s: %w", r.certFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parse certificate %s: %w", r.certFile, err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	certExpiry.Set(float64(leaf.NotAfter.Unix()))
+	r.log.WithFields(logrus.Fields{
+		"file":      r.certFile,
+		"serial":    leaf.SerialNumber.String(),
+		"not_after": leaf.NotAfter,
+	}).Info("Loaded TLS certificate")
+	return nil
+}
+
+// Watch reloads the key pair whenever the certificate directory changes
+// until ctx is done. A pair that fails to load (for example while only one
+// of the two files has been replaced) leaves the previous one in service.
+func (r *CertReloader) Watch(ctx context.Context) error {
+	return watchFile(ctx, r.certFile, func() {
+		if err := r.reload(); err != nil {
+			r.log.WithError(err).Error("Failed to reload TLS certificate, keeping previous one")
+		}
+	}, r.log)
+}
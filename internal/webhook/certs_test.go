@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeKeyPair writes a self-signed certificate with the given serial to dir.
+func writeKeyPair(t *testing.T, dir string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "apss-webhook"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func servingSerial(t *testing.T, r *CertReloader) int64 {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil || cert == nil || cert.Leaf == nil {
+		t.Fatalf("GetCertificate: %v, %v", cert, err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, 1)
+	r, err := NewCertReloader(certFile, keyFile, logrus.New())
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	if got := servingSerial(t, r); got != 1 {
+		t.Fatalf("serial = %d, want 1", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	writeKeyPair(t, dir, 2)
+	deadline := time.Now().Add(2 * time.Second)
+	for servingSerial(t, r) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated certificate was not picked up")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// A broken pair keeps the previous certificate in service.
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	time.Sleep(4 * fileReloadDelay)
+	if got := servingSerial(t, r); got != 2 {
+		t.Errorf("serial after bad rotation = %d, want 2", got)
+	}
+}
+
+func TestNewCertReloader_Missing(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), logrus.New()); err == nil {
+		t.Error("expected error for missing key pair")
+	}
+}
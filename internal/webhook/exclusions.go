@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+// fileReloadDelay coalesces the burst of events a ConfigMap update produces.
+const fileReloadDelay = 100 * time.Millisecond
+
+// Exclusions are the injection exclusion rules. In a ConfigMap file they are
+// written as YAML (or JSON) with the same keys.
+type Exclusions struct {
+	Namespaces      []string          `json:"namespaces"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	ImageRegistries []string          `json:"image_registries,omitempty"`
+}
+
+// ExclusionStatus is the active exclusion set and where it came from, served
+// on /api/v1/exclusions.
+type ExclusionStatus struct {
+	Exclusions
+	// Source is "env" or the path of the ConfigMap file.
+	Source   string    `json:"source"`
+	LoadedAt time.Time `json:"loaded_at"`
+	// LastError is the most recent reload failure; the previous rules stay
+	// active until the file parses again.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ExclusionWatcher holds the active exclusions, loaded from the environment
+// or from a mounted ConfigMap file that is reloaded when it changes.
+type ExclusionWatcher struct {
+	path string
+	log  *logrus.Logger
+	// namespaces are the namespaces excluded by the environment, kept when
+	// the file has no namespaces key.
+	namespaces []string
+
+	mu     sync.RWMutex
+	status ExclusionStatus
+}
+
+// NewExclusionWatcher starts from the exclusions in cfg and, if
+// cfg.ExclusionsFile is set, replaces them with the file's contents. A file
+// without a namespaces key keeps cfg's excluded namespaces, so system
+// namespaces stay excluded; an empty list excludes none.
+func NewExclusionWatcher(cfg config.WebhookConfig, log *logrus.Logger) (*ExclusionWatcher, error) {
+	w := &ExclusionWatcher{
+		path:       cfg.ExclusionsFile,
+		log:        log,
+		namespaces: cfg.ExcludeNamespaces,
+		status: ExclusionStatus{
+			Exclusions: Exclusions{
+				Namespaces:      cfg.ExcludeNamespaces,
+				Labels:          cfg.ExcludeLabels,
+				Annotations:     cfg.ExcludeAnnotations,
+				ImageRegistries: cfg.ExcludeImageRegistries,
+			},
+			Source:   "env",
+			LoadedAt: time.Now(),
+		},
+	}
+	if w.path != "" {
+		if err := w.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Status returns the active exclusions.
+func (w *ExclusionWatcher) Status() ExclusionStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.status
+}
+
+// Apply returns cfg with its exclusion fields replaced by the active rules.
+func (w *ExclusionWatcher) Apply(cfg config.WebhookConfig) config.WebhookConfig {
+	w.mu.RLock()
+	ex := w.status.Exclusions
+	w.mu.RUnlock()
+	cfg.ExcludeNamespaces = ex.Namespaces
+	cfg.ExcludeLabels = ex.Labels
+	cfg.ExcludeAnnotations = ex.Annotations
+	cfg.ExcludeImageRegistries = ex.ImageRegistries
+	return cfg
+}
+
+func (w *ExclusionWatcher) reload() error {
+	data, err := os.ReadFile(w.path)
+	if err == nil && len(bytes.TrimSpace(data)) == 0 {
+		// A half-written file must not silently drop every exclusion.
+		err = errors.New("file is empty")
+	}
+	if err == nil {
+		ex := Exclusions{Namespaces: w.namespaces}
+		if err = yaml.UnmarshalStrict(data, &ex); err == nil {
+			w.mu.Lock()
+			w.status = ExclusionStatus{Exclusions: ex, Source: w.path, LoadedAt: time.Now()}
+			w.mu.Unlock()
+			w.log.WithFields(logrus.Fields{
+				"file":             w.path,
+				"namespaces":       len(ex.Namespaces),
+				"labels":           len(ex.Labels),
+				"annotations":      len(ex.Annotations),
+				"image_registries": len(ex.ImageRegistries),
+			}).Info("Loaded injection exclusions")
+			return nil
+		}
+	}
+	err = fmt.Errorf("load exclusions from %s: %w", w.path, err)
+	w.mu.Lock()
+	w.status.LastError = err.Error()
+	w.mu.Unlock()
+	return err
+}
+
+// Watch reloads the exclusions file whenever it changes until ctx is done.
+func (w *ExclusionWatcher) Watch(ctx context.Context) error {
+	return watchFile(ctx, w.path, func() {
+		if err := w.reload(); err != nil {
+			w.log.WithError(err).Error("Failed to reload exclusions, keeping previous rules")
+		}
+	}, w.log)
+}
+
+// watchFile calls reload whenever path changes until ctx is done. The parent
+// directory is watched because Kubernetes updates ConfigMap volumes by
+// swapping a symlink rather than writing the file. Bursts of events are
+// coalesced into one reload.
+func watchFile(ctx context.Context, path string, reload func(), log *logrus.Logger) error {
+	if path == "" {
+		return nil
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+	if err := fw.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename|fsnotify.Remove) != 0 {
+				debounce.Reset(fileReloadDelay)
+			}
+		case <-debounce.C:
+			reload()
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			log.WithError(err).WithField("file", path).Warn("File watcher error")
+		}
+	}
+}
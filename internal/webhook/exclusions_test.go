@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+func TestExclusionWatcher_EnvOnly(t *testing.T) {
+	w, err := NewExclusionWatcher(config.WebhookConfig{ExcludeNamespaces: []string{"kube-system"}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExclusionWatcher: %v", err)
+	}
+	st := w.Status()
+	if st.Source != "env" || len(st.Namespaces) != 1 {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestExclusionWatcher_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "exclusions.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("namespaces: [kube-system]\nimage_registries: [gke.gcr.io]\n")
+
+	w, err := NewExclusionWatcher(config.WebhookConfig{ExcludeNamespaces: []string{"ignored"}, ExclusionsFile: path}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExclusionWatcher: %v", err)
+	}
+	applied := w.Apply(config.WebhookConfig{SidecarImage: "agent:1"})
+	if applied.SidecarImage != "agent:1" || len(applied.ExcludeNamespaces) != 1 || applied.ExcludeNamespaces[0] != "kube-system" {
+		t.Errorf("applied = %+v", applied)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	write("namespaces: [kube-system, batch]\nlabels:\n  team: platform\n")
+	waitFor(t, func() bool { return len(w.Status().Namespaces) == 2 })
+	if st := w.Status(); st.Labels["team"] != "platform" || st.LastError != "" || st.Source != path {
+		t.Errorf("status after reload = %+v", st)
+	}
+
+	write("namespaces: [oops\n")
+	waitFor(t, func() bool { return w.Status().LastError != "" })
+	if st := w.Status(); len(st.Namespaces) != 2 {
+		t.Errorf("bad file should keep previous rules: %+v", st)
+	}
+}
+
+func TestExclusionWatcher_KeepsEnvNamespaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclusions.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("labels:\n  team: platform\n")
+	env := []string{"kube-system", "apss-system"}
+	w, err := NewExclusionWatcher(config.WebhookConfig{ExcludeNamespaces: env, ExclusionsFile: path}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExclusionWatcher: %v", err)
+	}
+	if st := w.Status(); len(st.Namespaces) != 2 || st.Labels["team"] != "platform" {
+		t.Errorf("file without namespaces = %+v, want the environment's namespaces", st)
+	}
+	if !ShouldSkipInjection(w.Apply(config.WebhookConfig{}), &corev1.Pod{}, "kube-system") {
+		t.Error("kube-system not excluded")
+	}
+
+	write("namespaces: []\n")
+	if err := w.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if st := w.Status(); len(st.Namespaces) != 0 {
+		t.Errorf("empty namespaces list = %v, want none excluded", st.Namespaces)
+	}
+}
+
+func TestNewExclusionWatcher_BadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclusions.yaml")
+	if err := os.WriteFile(path, []byte("unknown_key: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewExclusionWatcher(config.WebhookConfig{ExclusionsFile: path}, logrus.New()); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
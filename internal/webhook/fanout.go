@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Pod annotations overriding the agent's connection fan-out thresholds.
+const (
+	AnnotationFanoutConnections  = "apss.invisible.tech/fanout-min-connections"
+	AnnotationFanoutDestinations = "apss.invisible.tech/fanout-min-destinations"
+	// AnnotationFanoutSigma "0" turns fan-out detection off for the pod.
+	AnnotationFanoutSigma = "apss.invisible.tech/fanout-sigma"
+)
+
+// fanoutEnv returns the sidecar environment for the pod's fan-out
+// threshold annotations. Unparseable or negative values are ignored.
+func fanoutEnv(pod *corev1.Pod) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, a := range []struct {
+		annotation, env string
+		integer         bool
+	}{
+		{AnnotationFanoutConnections, "FANOUT_MIN_CONNECTIONS", true},
+		{AnnotationFanoutDestinations, "FANOUT_MIN_DESTINATIONS", true},
+		{AnnotationFanoutSigma, "FANOUT_SIGMA", false},
+	} {
+		v, ok := pod.Annotations[a.annotation]
+		if !ok {
+			continue
+		}
+		if a.integer {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				continue
+			}
+		} else if f, err := strconv.ParseFloat(v, 64); err != nil || f < 0 {
+			continue
+		}
+		env = append(env, corev1.EnvVar{Name: a.env, Value: v})
+	}
+	return env
+}
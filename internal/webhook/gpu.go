@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+// LabelGPUWorkload set to "true" marks a pod whose GPU use is expected.
+const LabelGPUWorkload = "apss.invisible.tech/gpu-workload"
+
+// gpuEnv returns the sidecar environment that turns on GPU monitoring for
+// pods in cfg.GPUNamespaces ("*" for every namespace), or nil.
+func gpuEnv(cfg config.WebhookConfig, pod *corev1.Pod) []corev1.EnvVar {
+	monitored := false
+	for _, ns := range cfg.GPUNamespaces {
+		if ns == "*" || ns == pod.Namespace {
+			monitored = true
+			break
+		}
+	}
+	if !monitored {
+		return nil
+	}
+	workload := "false"
+	if pod.Labels[LabelGPUWorkload] == "true" {
+		workload = "true"
+	}
+	env := []corev1.EnvVar{
+		{Name: "GPU_MONITOR", Value: "true"},
+		{Name: "GPU_WORKLOAD", Value: workload},
+	}
+	if len(cfg.GPUAllowedProcesses) > 0 {
+		env = append(env, corev1.EnvVar{Name: "GPU_ALLOWED_PROCESSES", Value: strings.Join(cfg.GPUAllowedProcesses, ",")})
+	}
+	if cfg.GPUMetricsURL != "" {
+		// NODE_IP first, so the URL can refer to it as $(NODE_IP) for a
+		// dcgm-exporter on the node.
+		env = append(env,
+			corev1.EnvVar{Name: "NODE_IP", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.hostIP"}}},
+			corev1.EnvVar{Name: "GPU_METRICS_URL", Value: cfg.GPUMetricsURL},
+		)
+	}
+	return env
+}
@@ -44,6 +44,11 @@ func processRequest(req *admissionv1.AdmissionRequest, cfg config.WebhookConfig,
 		}
 	}
 
+	if pod.Namespace == "" {
+		// Pods created through controllers arrive without a namespace.
+		pod.Namespace = req.Namespace
+	}
+
 	log.WithFields(logrus.Fields{"pod": pod.Name, "namespace": req.Namespace}).Debug("Processing pod admission")
 
 	if ShouldSkipInjection(cfg, &pod, req.Namespace) {
@@ -62,6 +67,14 @@ func processRequest(req *admissionv1.AdmissionRequest, cfg config.WebhookConfig,
 	}
 
 	log.WithFields(logrus.Fields{"pod": pod.Name, "namespace": req.Namespace, "patches": len(patches)}).Info("Injecting APSS sidecar")
+	if MonitoringMode(cfg, &pod) == MonitoringModeDegraded {
+		name := pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+		degraded.record(req.Namespace, name)
+		log.WithFields(logrus.Fields{"pod": name, "namespace": req.Namespace}).Warn("Injected without shareProcessNamespace, agent will run degraded")
+	}
 
 	patchType := admissionv1.PatchTypeJSONPatch
 	return &admissionv1.AdmissionResponse{
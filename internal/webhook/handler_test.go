@@ -108,7 +108,7 @@ func TestProcessAdmissionReview_Pod_InvalidPodJSON(t *testing.T) {
 			UID:       "req-1",
 			Kind:      metav1.GroupVersionKind{Kind: "Pod"},
 			Namespace: "default",
-			Object:    runtime.RawExtension{Raw: []byte("not a pod")},
+			Object:    runtime.RawExtension{Raw: []byte(`"not a pod"`)},
 		},
 	}
 	body, _ := json.Marshal(review)
@@ -127,3 +127,37 @@ func TestProcessAdmissionReview_Pod_InvalidPodJSON(t *testing.T) {
 		t.Error("expected Result with Message")
 	}
 }
+
+func TestProcessAdmissionReview_Pod_DegradedReported(t *testing.T) {
+	log := logrus.New()
+	cfg := config.DefaultWebhookConfig()
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "worker-",
+			Annotations:  map[string]string{AnnotationShareProcessNamespace: "false"},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	podRaw, _ := json.Marshal(pod)
+	review := admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "req-3",
+			Kind:      metav1.GroupVersionKind{Kind: "Pod"},
+			Namespace: "batch",
+			Object:    runtime.RawExtension{Raw: podRaw},
+		},
+	}
+	body, _ := json.Marshal(review)
+	if _, err := ProcessAdmissionReview(body, cfg, log); err != nil {
+		t.Fatalf("ProcessAdmissionReview: %v", err)
+	}
+	found := false
+	for _, p := range DegradedPods() {
+		if p.Namespace == "batch" && p.Name == "worker-" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected batch/worker- in degraded report, got %+v", DegradedPods())
+	}
+}
@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Admission policy modes. An empty mode disables the policy.
+const (
+	PolicyModeWarn    = "warn"
+	PolicyModeEnforce = "enforce"
+)
+
+// Image policy rules, used as the "rule" label on violation metrics.
+const (
+	ImageRuleRegistry = "registry"
+	ImageRuleLatest   = "latest_tag"
+	ImageRuleDigest   = "digest"
+)
+
+// ImagePolicy constrains the images a pod may run. In warn mode violations
+// are returned as admission warnings; in enforce mode the pod is rejected.
+type ImagePolicy struct {
+	Mode string `json:"mode"`
+	// AllowedRegistries are registry hosts or registry/path prefixes, matched
+	// like exclusion image registries. Empty allows any registry.
+	AllowedRegistries []string `json:"allowed_registries,omitempty"`
+	// DenyLatest rejects ":latest" and untagged images.
+	DenyLatest bool `json:"deny_latest,omitempty"`
+	// RequireDigest rejects images not pinned by digest.
+	RequireDigest bool `json:"require_digest,omitempty"`
+}
+
+// ImagePolicies is the default policy plus per-namespace overrides. Namespace
+// keys may be globs ("prod-*"); an exact name wins over a glob, and an
+// override replaces the default rather than merging with it.
+type ImagePolicies struct {
+	Default    ImagePolicy            `json:"default"`
+	Namespaces map[string]ImagePolicy `json:"namespaces,omitempty"`
+}
+
+// ImageViolation is one container image that breaks a policy rule.
+type ImageViolation struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Rule      string `json:"rule"`
+}
+
+func (v ImageViolation) String() string {
+	switch v.Rule {
+	case ImageRuleRegistry:
+		return fmt.Sprintf("container %q: image %q is not from an allowed registry", v.Container, v.Image)
+	case ImageRuleLatest:
+		return fmt.Sprintf("container %q: image %q uses the latest tag", v.Container, v.Image)
+	case ImageRuleDigest:
+		return fmt.Sprintf("container %q: image %q is not pinned by digest", v.Container, v.Image)
+	}
+	return fmt.Sprintf("container %q: image %q violates %s", v.Container, v.Image, v.Rule)
+}
+
+// LoadImagePolicies reads image policies from a YAML (or JSON) file. An empty
+// path disables image policy checks.
+func LoadImagePolicies(file string) (ImagePolicies, error) {
+	var p ImagePolicies
+	if err := loadPolicyFile(file, &p); err != nil {
+		return ImagePolicies{}, fmt.Errorf("load image policies from %s: %w", file, err)
+	}
+	return p, nil
+}
+
+func (p *ImagePolicies) validate() error {
+	modes := make(map[string]string, len(p.Namespaces))
+	for ns, pol := range p.Namespaces {
+		modes[ns] = pol.Mode
+	}
+	return validatePolicyModes(p.Default.Mode, modes)
+}
+
+// For returns the policy that applies to namespace.
+func (p ImagePolicies) For(namespace string) ImagePolicy {
+	return policyFor(p.Default, p.Namespaces, namespace)
+}
+
+// loadPolicyFile strictly decodes a YAML (or JSON) policy file into p and
+// validates it. An empty path leaves p unchanged.
+func loadPolicyFile(file string, p interface{ validate() error }) error {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err == nil && len(bytes.TrimSpace(data)) == 0 {
+		err = errors.New("file is empty")
+	}
+	if err == nil {
+		err = yaml.UnmarshalStrict(data, p)
+	}
+	if err == nil {
+		err = p.validate()
+	}
+	return err
+}
+
+// validatePolicyModes checks the default mode and the per-namespace modes,
+// whose keys must be valid namespace globs.
+func validatePolicyModes(defaultMode string, namespaces map[string]string) error {
+	check := func(name, mode string) error {
+		switch mode {
+		case "", PolicyModeWarn, PolicyModeEnforce:
+			return nil
+		}
+		return fmt.Errorf("%s: unknown mode %q", name, mode)
+	}
+	if err := check("default", defaultMode); err != nil {
+		return err
+	}
+	for ns, mode := range namespaces {
+		if _, err := path.Match(ns, ""); err != nil {
+			return fmt.Errorf("namespace %q: %w", ns, err)
+		}
+		if err := check("namespace "+ns, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// policyFor returns the override for namespace, matching exact names before
+// globs, or def when none applies.
+func policyFor[P any](def P, overrides map[string]P, namespace string) P {
+	if pol, ok := overrides[namespace]; ok {
+		return pol
+	}
+	for pattern, pol := range overrides {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return pol
+		}
+	}
+	return def
+}
+
+// Check returns the violations of every container, init container and
+// ephemeral container image in pod.
+func (pol ImagePolicy) Check(pod *corev1.Pod) []ImageViolation {
+	if pol.Mode == "" {
+		return nil
+	}
+	var out []ImageViolation
+	check := func(name, image string) {
+		if len(pol.AllowedRegistries) > 0 && !imageFromRegistry(image, pol.AllowedRegistries) {
+			out = append(out, ImageViolation{Container: name, Image: image, Rule: ImageRuleRegistry})
+		}
+		tag, digest := imageTagDigest(image)
+		if pol.DenyLatest && digest == "" && (tag == "" || tag == "latest") {
+			out = append(out, ImageViolation{Container: name, Image: image, Rule: ImageRuleLatest})
+		}
+		if pol.RequireDigest && digest == "" {
+			out = append(out, ImageViolation{Container: name, Image: image, Rule: ImageRuleDigest})
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		check(c.Name, c.Image)
+	}
+	for _, c := range pod.Spec.Containers {
+		check(c.Name, c.Image)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		check(c.Name, c.Image)
+	}
+	return out
+}
+
+// imageTagDigest splits the tag and digest off an image reference. The tag is
+// only looked for in the last path component so registry ports are not
+// mistaken for tags.
+func imageTagDigest(image string) (tag, digest string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image, digest = image[:i], image[i+1:]
+	}
+	last := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(last, ":"); i >= 0 {
+		tag = last[i+1:]
+	}
+	return tag, digest
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestImageTagDigest(t *testing.T) {
+	tests := []struct {
+		image, tag, digest string
+	}{
+		{"nginx", "", ""},
+		{"nginx:1.25", "1.25", ""},
+		{"localhost:5000/app", "", ""},
+		{"localhost:5000/app:v2", "v2", ""},
+		{"gcr.io/p/app@sha256:abc", "", "sha256:abc"},
+		{"gcr.io/p/app:1@sha256:abc", "1", "sha256:abc"},
+	}
+	for _, tt := range tests {
+		tag, digest := imageTagDigest(tt.image)
+		if tag != tt.tag || digest != tt.digest {
+			t.Errorf("imageTagDigest(%q) = %q, %q", tt.image, tag, digest)
+		}
+	}
+}
+
+func TestImagePolicy_Check(t *testing.T) {
+	pol := ImagePolicy{
+		Mode:              PolicyModeEnforce,
+		AllowedRegistries: []string{"gcr.io/my-project"},
+		DenyLatest:        true,
+		RequireDigest:     true,
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: "init", Image: "gcr.io/my-project/migrate@sha256:abc"}},
+		Containers: []corev1.Container{
+			{Name: "app", Image: "gcr.io/my-project/app:latest"},
+			{Name: "side", Image: "docker.io/proxy"},
+		},
+	}}
+	got := map[string][]string{}
+	for _, v := range pol.Check(pod) {
+		got[v.Container] = append(got[v.Container], v.Rule)
+	}
+	if len(got["init"]) != 0 {
+		t.Errorf("pinned image from allowed registry flagged: %v", got["init"])
+	}
+	if want := []string{ImageRuleLatest, ImageRuleDigest}; !equalStrings(got["app"], want) {
+		t.Errorf("app violations = %v, want %v", got["app"], want)
+	}
+	if want := []string{ImageRuleRegistry, ImageRuleLatest, ImageRuleDigest}; !equalStrings(got["side"], want) {
+		t.Errorf("side violations = %v, want %v", got["side"], want)
+	}
+
+	pol.Mode = ""
+	if v := pol.Check(pod); len(v) != 0 {
+		t.Errorf("disabled policy returned %v", v)
+	}
+}
+
+func TestImagePolicies_For(t *testing.T) {
+	p := ImagePolicies{
+		Default: ImagePolicy{Mode: PolicyModeWarn},
+		Namespaces: map[string]ImagePolicy{
+			"prod-*":   {Mode: PolicyModeEnforce, DenyLatest: true},
+			"prod-sbx": {},
+		},
+	}
+	if got := p.For("dev").Mode; got != PolicyModeWarn {
+		t.Errorf("dev mode = %q", got)
+	}
+	if got := p.For("prod-eu").Mode; got != PolicyModeEnforce {
+		t.Errorf("prod-eu mode = %q", got)
+	}
+	if got := p.For("prod-sbx").Mode; got != "" {
+		t.Errorf("exact match should win over glob, got mode %q", got)
+	}
+}
+
+func TestLoadImagePolicies(t *testing.T) {
+	if p, err := LoadImagePolicies(""); err != nil || p.Default.Mode != "" {
+		t.Errorf("empty path: %+v, %v", p, err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image-policy.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("default:\n  mode: warn\n  allowed_registries: [gcr.io]\nnamespaces:\n  prod:\n    mode: enforce\n    require_digest: true\n")
+	p, err := LoadImagePolicies(path)
+	if err != nil {
+		t.Fatalf("LoadImagePolicies: %v", err)
+	}
+	if p.Default.Mode != PolicyModeWarn || !p.Namespaces["prod"].RequireDigest {
+		t.Errorf("policies = %+v", p)
+	}
+
+	for name, content := range map[string]string{
+		"unknown mode":  "default:\n  mode: block\n",
+		"unknown field": "default:\n  mode: warn\n  deny_latset: true\n",
+		"bad glob":      "namespaces:\n  \"prod-[\":\n    mode: warn\n",
+		"empty":         "\n",
+	} {
+		write(content)
+		if _, err := LoadImagePolicies(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
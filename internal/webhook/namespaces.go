@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// LabelNamespaceInjection on a namespace turns injection on ("enabled") or
+// off ("disabled") for its pods, like istio-injection. Unlabelled namespaces
+// follow WebhookConfig.NamespaceInjectionDefault.
+const LabelNamespaceInjection = "apss.invisible.tech/injection"
+
+// Namespace injection policies.
+const (
+	NamespaceInjectionEnabled  = "enabled"
+	NamespaceInjectionDisabled = "disabled"
+)
+
+const (
+	// namespaceWatchTimeout bounds each watch request; the cache re-watches
+	// from the last resource version when it expires.
+	namespaceWatchTimeout = 5 * time.Minute
+	namespaceRetryMin     = time.Second
+	namespaceRetryMax     = time.Minute
+)
+
+// errWatchExpired is returned when the API server no longer has the watched
+// resource version and the cache must list again.
+var errWatchExpired = errors.New("watch resource version expired")
+
+// NamespaceCache keeps the labels of every namespace in memory, filled by a
+// list and kept current with a watch, so admission never waits on the API
+// server.
+type NamespaceCache struct {
+	client *kube.Client
+	log    *logrus.Logger
+
+	mu     sync.RWMutex
+	labels map[string]map[string]string
+	synced chan struct{}
+	once   sync.Once
+}
+
+// NewNamespaceCache returns a cache backed by the in-cluster API server. Call
+// Run to fill it.
+func NewNamespaceCache(log *logrus.Logger) (*NamespaceCache, error) {
+	client, err := kube.NewInCluster()
+	if err != nil {
+		return nil, err
+	}
+	return newNamespaceCache(client, log), nil
+}
+
+func newNamespaceCache(client *kube.Client, log *logrus.Logger) *NamespaceCache {
+	return &NamespaceCache{
+		client: client,
+		log:    log,
+		labels: make(map[string]map[string]string),
+		synced: make(chan struct{}),
+	}
+}
+
+// Labels returns the labels of namespace and whether it is in the cache.
+func (c *NamespaceCache) Labels(namespace string) (map[string]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	labels, ok := c.labels[namespace]
+	return labels, ok
+}
+
+// WaitForSync blocks until the first list completes or ctx is done, and
+// reports whether the cache synced.
+func (c *NamespaceCache) WaitForSync(ctx context.Context) bool {
+	select {
+	case <-c.synced:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run lists and watches namespaces until ctx is done, retrying with backoff
+// on errors.
+func (c *NamespaceCache) Run(ctx context.Context) {
+	backoff := namespaceRetryMin
+	for ctx.Err() == nil {
+		rv, err := c.list(ctx)
+		for err == nil {
+			backoff = namespaceRetryMin
+			rv, err = c.watch(ctx, rv)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !errors.Is(err, errWatchExpired) {
+			c.log.WithError(err).WithField("retry_in", backoff).Warn("Namespace cache list/watch failed")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, namespaceRetryMax)
+		}
+	}
+}
+
+type namespaceMeta struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+}
+
+func (c *NamespaceCache) list(ctx context.Context) (string, error) {
+	var list struct {
+		Metadata metav1.ListMeta `json:"metadata"`
+		Items    []namespaceMeta `json:"items"`
+	}
+	if err := c.client.Get(ctx, "/api/v1/namespaces", &list); err != nil {
+		return "", err
+	}
+	labels := make(map[string]map[string]string, len(list.Items))
+	for _, ns := range list.Items {
+		labels[ns.Metadata.Name] = ns.Metadata.Labels
+	}
+	c.mu.Lock()
+	c.labels = labels
+	c.mu.Unlock()
+	c.once.Do(func() { close(c.synced) })
+	c.log.WithField("namespaces", len(labels)).Debug("Listed namespaces")
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies namespace events from rv until the watch ends, returning the
+// last resource version seen.
+func (c *NamespaceCache) watch(ctx context.Context, rv string) (string, error) {
+	path := fmt.Sprintf("/api/v1/namespaces?watch=true&allowWatchBookmarks=true&resourceVersion=%s&timeoutSeconds=%d",
+		rv, int(namespaceWatchTimeout.Seconds()))
+	body, err := c.client.Open(ctx, path)
+	if err != nil {
+		return rv, err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var ev struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return rv, ctx.Err()
+			}
+			// The server closes the stream when timeoutSeconds expires.
+			return rv, nil
+		}
+		if ev.Type == "ERROR" {
+			var status metav1.Status
+			_ = json.Unmarshal(ev.Object, &status)
+			if status.Code == http.StatusGone {
+				return rv, errWatchExpired
+			}
+			return rv, fmt.Errorf("watch namespaces: %s", status.Message)
+		}
+		var ns namespaceMeta
+		if err := json.Unmarshal(ev.Object, &ns); err != nil {
+			return rv, fmt.Errorf("decode namespace event: %w", err)
+		}
+		rv = ns.Metadata.ResourceVersion
+		c.mu.Lock()
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			c.labels[ns.Metadata.Name] = ns.Metadata.Labels
+		case "DELETED":
+			delete(c.labels, ns.Metadata.Name)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// namespaceAllowsInjection applies the namespace label and default policy.
+// A pod annotated apss.invisible.tech/inject=true opts in when its namespace
+// is unlabelled; an explicit "disabled" label always wins.
+func namespaceAllowsInjection(labels map[string]string, defaultPolicy string, podOptIn bool) bool {
+	switch labels[LabelNamespaceInjection] {
+	case NamespaceInjectionEnabled:
+		return true
+	case NamespaceInjectionDisabled:
+		return false
+	}
+	return defaultPolicy != NamespaceInjectionDisabled || podOptIn
+}
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+func TestNamespaceCache_ListAndWatch(t *testing.T) {
+	var lists, watches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" {
+			atomic.AddInt32(&lists, 1)
+			fmt.Fprint(w, `{"metadata":{"resourceVersion":"10"},"items":[
+				{"metadata":{"name":"web","labels":{"apss.invisible.tech/injection":"enabled"}}},
+				{"metadata":{"name":"old"}}]}`)
+			return
+		}
+		if atomic.AddInt32(&watches, 1) == 1 {
+			if rv := r.URL.Query().Get("resourceVersion"); rv != "10" {
+				t.Errorf("watch resourceVersion = %q, want 10", rv)
+			}
+			fmt.Fprintln(w, `{"type":"ADDED","object":{"metadata":{"name":"batch","resourceVersion":"11","labels":{"apss.invisible.tech/injection":"disabled"}}}}`)
+			fmt.Fprintln(w, `{"type":"DELETED","object":{"metadata":{"name":"old","resourceVersion":"12"}}}`)
+			fmt.Fprintln(w, `{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old"}}`)
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := newNamespaceCache(kube.NewClient(srv.URL, srv.Client()), logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	syncCtx, syncCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer syncCancel()
+	if !c.WaitForSync(syncCtx) {
+		t.Fatal("cache did not sync")
+	}
+	// The expired watch forces a relist, which restores "old" and drops "batch".
+	waitFor(t, func() bool { return atomic.LoadInt32(&lists) >= 2 })
+	waitFor(t, func() bool { return atomic.LoadInt32(&watches) >= 2 })
+	if labels, ok := c.Labels("web"); !ok || labels[LabelNamespaceInjection] != NamespaceInjectionEnabled {
+		t.Errorf("web labels = %v, %v", labels, ok)
+	}
+	if _, ok := c.Labels("old"); !ok {
+		t.Error("relist should restore namespace old")
+	}
+	if _, ok := c.Labels("missing"); ok {
+		t.Error("unknown namespace reported as cached")
+	}
+}
+
+func TestShouldSkipInjection_NamespaceLabels(t *testing.T) {
+	labels := map[string]map[string]string{
+		"on":  {LabelNamespaceInjection: NamespaceInjectionEnabled},
+		"off": {LabelNamespaceInjection: NamespaceInjectionDisabled},
+	}
+	lookup := func(ns string) (map[string]string, bool) {
+		l, ok := labels[ns]
+		return l, ok
+	}
+	optIn := map[string]string{"apss.invisible.tech/inject": "true"}
+	tests := []struct {
+		name          string
+		defaultPolicy string
+		namespace     string
+		annotations   map[string]string
+		wantSkip      bool
+	}{
+		{"default enabled, unlabelled", NamespaceInjectionEnabled, "plain", nil, false},
+		{"default enabled, disabled label", NamespaceInjectionEnabled, "off", nil, true},
+		{"disabled label beats pod opt-in", NamespaceInjectionEnabled, "off", optIn, true},
+		{"default disabled, unlabelled", NamespaceInjectionDisabled, "plain", nil, true},
+		{"default disabled, enabled label", NamespaceInjectionDisabled, "on", nil, false},
+		{"default disabled, pod opt-in", NamespaceInjectionDisabled, "plain", optIn, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.WebhookConfig{NamespaceInjectionDefault: tt.defaultPolicy, NamespaceLabels: lookup}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "p", Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			}
+			if got := ShouldSkipInjection(cfg, pod, tt.namespace); got != tt.wantSkip {
+				t.Errorf("ShouldSkipInjection = %v, want %v", got, tt.wantSkip)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+// OPA failure policies: what /validate does when OPA cannot be queried or
+// its policy is undefined.
+const (
+	OPAFailureIgnore = "ignore"
+	OPAFailureDeny   = "deny"
+)
+
+// maxOPACacheEntries bounds the decision cache.
+const maxOPACacheEntries = 1000
+
+var opaDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "apss_webhook_opa_decisions_total",
+	Help: "Admission decisions delegated to OPA, by result (allow, deny, warn, error) and whether they came from the cache",
+}, []string{"result", "cached"})
+
+func init() {
+	prometheus.MustRegister(opaDecisions)
+}
+
+// OPADecision is the document the OPA policy evaluates to. A pod is denied
+// when Deny has messages or Allow is false; Warn messages become admission
+// warnings. A policy that only sets deny and warn leaves Allow unset.
+type OPADecision struct {
+	Allow *bool    `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	Warn  []string `json:"warn,omitempty"`
+}
+
+type opaCacheEntry struct {
+	decision OPADecision
+	expires  time.Time
+}
+
+// OPA delegates admission decisions to an Open Policy Agent server through
+// its Data API. Decisions are cached by request, minus its UID, so the pods
+// of a scaling ReplicaSet are evaluated once.
+type OPA struct {
+	url           string
+	failurePolicy string
+	cacheTTL      time.Duration
+	client        *http.Client
+	log           *logrus.Logger
+
+	mu    sync.Mutex
+	cache map[string]opaCacheEntry
+}
+
+// NewOPA returns a client for the policy at cfg.OPAURL, e.g.
+// http://localhost:8181/v1/data/apss/admission.
+func NewOPA(cfg config.WebhookConfig, log *logrus.Logger) (*OPA, error) {
+	u, err := url.Parse(cfg.OPAURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OPA URL %q: want an http or https URL", cfg.OPAURL)
+	}
+	switch cfg.OPAFailurePolicy {
+	case OPAFailureIgnore, OPAFailureDeny:
+	default:
+		return nil, fmt.Errorf("invalid OPA failure policy %q: want %s or %s", cfg.OPAFailurePolicy, OPAFailureIgnore, OPAFailureDeny)
+	}
+	return &OPA{
+		url:           cfg.OPAURL,
+		failurePolicy: cfg.OPAFailurePolicy,
+		cacheTTL:      cfg.OPACacheTTL,
+		client:        &http.Client{Timeout: cfg.OPATimeout},
+		log:           log,
+		cache:         make(map[string]opaCacheEntry),
+	}, nil
+}
+
+// Check returns the denial and warning messages for req. When OPA fails, the
+// failure policy either admits the pod with a warning or denies it.
+func (o *OPA) Check(req *admissionv1.AdmissionRequest) (denied, warned []string) {
+	d, cached, err := o.decide(req)
+	if err != nil {
+		opaDecisions.WithLabelValues("error", "false").Inc()
+		o.log.WithError(err).WithField("namespace", req.Namespace).Error("OPA admission decision failed")
+		if o.failurePolicy == OPAFailureDeny {
+			return []string{"opa: policy unavailable"}, nil
+		}
+		return nil, []string{"opa: policy unavailable, pod admitted unchecked"}
+	}
+
+	for _, msg := range d.Deny {
+		denied = append(denied, "opa: "+msg)
+	}
+	if len(denied) == 0 && d.Allow != nil && !*d.Allow {
+		denied = []string{"opa: denied by policy"}
+	}
+	for _, msg := range d.Warn {
+		warned = append(warned, "opa: "+msg)
+	}
+
+	result := "allow"
+	if len(denied) > 0 {
+		result = "deny"
+	} else if len(warned) > 0 {
+		result = "warn"
+	}
+	opaDecisions.WithLabelValues(result, fmt.Sprint(cached)).Inc()
+	return denied, warned
+}
+
+// decide returns the cached decision for req or queries OPA for one.
+func (o *OPA) decide(req *admissionv1.AdmissionRequest) (OPADecision, bool, error) {
+	keyed := *req
+	keyed.UID = ""
+	keyJSON, err := json.Marshal(&keyed)
+	if err != nil {
+		return OPADecision{}, false, err
+	}
+	sum := sha256.Sum256(keyJSON)
+	key := hex.EncodeToString(sum[:])
+	if d, ok := o.cached(key); ok {
+		return d, true, nil
+	}
+
+	d, err := o.query(req)
+	if err != nil {
+		return OPADecision{}, false, err
+	}
+	o.store(key, d)
+	return d, false, nil
+}
+
+// query evaluates the policy with the admission request as input.request,
+// the layout of OPA's Kubernetes admission examples.
+func (o *OPA) query(req *admissionv1.AdmissionRequest) (OPADecision, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"input": map[string]interface{}{"request": req},
+	})
+	if err != nil {
+		return OPADecision{}, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return OPADecision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return OPADecision{}, fmt.Errorf("query OPA: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return OPADecision{}, fmt.Errorf("OPA returned status %d", resp.StatusCode)
+	}
+	var out struct {
+		Result *OPADecision `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return OPADecision{}, fmt.Errorf("decode OPA response: %w", err)
+	}
+	if out.Result == nil {
+		return OPADecision{}, fmt.Errorf("OPA policy at %s is undefined", o.url)
+	}
+	return *out.Result, nil
+}
+
+func (o *OPA) cached(key string) (OPADecision, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e, ok := o.cache[key]
+	if !ok || time.Now().After(e.expires) {
+		return OPADecision{}, false
+	}
+	return e.decision, true
+}
+
+func (o *OPA) store(key string, d OPADecision) {
+	if o.cacheTTL <= 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	if _, ok := o.cache[key]; !ok && len(o.cache) >= maxOPACacheEntries {
+		o.evict(now)
+	}
+	o.cache[key] = opaCacheEntry{decision: d, expires: now.Add(o.cacheTTL)}
+}
+
+// evict drops expired entries, or the one closest to expiry if none are.
+// Caller must hold mu.
+func (o *OPA) evict(now time.Time) {
+	var soonestKey string
+	var soonest time.Time
+	for k, e := range o.cache {
+		if now.After(e.expires) {
+			delete(o.cache, k)
+			continue
+		}
+		if soonestKey == "" || e.expires.Before(soonest) {
+			soonestKey, soonest = k, e.expires
+		}
+	}
+	if len(o.cache) >= maxOPACacheEntries {
+		delete(o.cache, soonestKey)
+	}
+}
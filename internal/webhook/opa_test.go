@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+// opaServer answers Data API queries with the decision for the pod's first
+// container image and counts the queries.
+func opaServer(t *testing.T, decisions map[string]string, queries *int32) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(queries, 1)
+		if r.URL.Path != "/v1/data/apss/admission" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		var body struct {
+			Input struct {
+				Request struct {
+					Object corev1.Pod
+				}
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		image := body.Input.Request.Object.Spec.Containers[0].Image
+		w.Write([]byte(`{"result": ` + decisions[image] + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func newTestOPA(t *testing.T, url, failurePolicy string) *OPA {
+	t.Helper()
+	opa, err := NewOPA(config.WebhookConfig{
+		OPAURL:           url,
+		OPATimeout:       time.Second,
+		OPAFailurePolicy: failurePolicy,
+		OPACacheTTL:      time.Minute,
+	}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opa
+}
+
+func imagePod(image string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "web-"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+	}
+}
+
+func TestNewOPA_Invalid(t *testing.T) {
+	for _, cfg := range []config.WebhookConfig{
+		{OPAURL: "localhost:8181", OPAFailurePolicy: OPAFailureIgnore},
+		{OPAURL: "http://localhost:8181/v1/data/apss/admission", OPAFailurePolicy: "fail"},
+	} {
+		if _, err := NewOPA(cfg, logrus.New()); err == nil {
+			t.Errorf("NewOPA(%q, %q) succeeded", cfg.OPAURL, cfg.OPAFailurePolicy)
+		}
+	}
+}
+
+func TestProcessValidationReview_OPA(t *testing.T) {
+	var queries int32
+	url := opaServer(t, map[string]string{
+		"app:1.2":    `{"allow": true}`,
+		"app:latest": `{"deny": ["latest tag not allowed"], "warn": ["no resource limits"]}`,
+		"app:beta":   `{"warn": ["beta image"]}`,
+		"app:old":    `{"allow": false}`,
+	}, &queries)
+	policies := ValidationPolicies{OPA: newTestOPA(t, url+"/v1/data/apss/admission", OPAFailureIgnore)}
+
+	if resp := reviewPod(t, "prod", policies, nil, imagePod("app:1.2")); !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Errorf("allowed pod: allowed=%v warnings=%v", resp.Allowed, resp.Warnings)
+	}
+	resp := reviewPod(t, "prod", policies, nil, imagePod("app:latest"))
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != http.StatusForbidden || !strings.Contains(resp.Result.Message, "latest tag not allowed") {
+		t.Errorf("denied pod: allowed=%v result=%+v", resp.Allowed, resp.Result)
+	}
+	if len(resp.Warnings) != 1 || resp.Warnings[0] != "opa: no resource limits" {
+		t.Errorf("denied pod warnings = %v", resp.Warnings)
+	}
+	if resp := reviewPod(t, "prod", policies, nil, imagePod("app:beta")); !resp.Allowed || len(resp.Warnings) != 1 {
+		t.Errorf("warned pod: allowed=%v warnings=%v", resp.Allowed, resp.Warnings)
+	}
+	if resp := reviewPod(t, "prod", policies, nil, imagePod("app:old")); resp.Allowed {
+		t.Error("pod with allow=false was admitted")
+	}
+
+	// Identical requests, such as the pods of one ReplicaSet, are answered
+	// from the cache.
+	before := atomic.LoadInt32(&queries)
+	reviewPod(t, "prod", policies, nil, imagePod("app:latest"))
+	if after := atomic.LoadInt32(&queries); after != before {
+		t.Errorf("OPA queried %d more times for a cached decision", after-before)
+	}
+}
+
+func TestProcessValidationReview_OPAFailurePolicy(t *testing.T) {
+	var queries int32
+	// The policy path is undefined, so OPA returns no result.
+	url := opaServer(t, nil, &queries) + "/v1/data/missing"
+
+	resp := reviewPod(t, "prod", ValidationPolicies{OPA: newTestOPA(t, url, OPAFailureIgnore)}, nil, imagePod("app:1.2"))
+	if !resp.Allowed || len(resp.Warnings) != 1 {
+		t.Errorf("ignore: allowed=%v warnings=%v, want admitted with a warning", resp.Allowed, resp.Warnings)
+	}
+	resp = reviewPod(t, "prod", ValidationPolicies{OPA: newTestOPA(t, url, OPAFailureDeny)}, nil, imagePod("app:1.2"))
+	if resp.Allowed {
+		t.Error("deny: pod admitted while OPA failed")
+	}
+
+	// Failures are not cached.
+	opa := newTestOPA(t, url, OPAFailureIgnore)
+	reviewPod(t, "prod", ValidationPolicies{OPA: opa}, nil, imagePod("app:1.2"))
+	if len(opa.cache) != 0 {
+		t.Errorf("cache has %d entries after a failure", len(opa.cache))
+	}
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Posture policy rules, used as the "rule" label on violation metrics.
+const (
+	PostureRulePrivileged   = "privileged"
+	PostureRuleHostPath     = "host_path"
+	PostureRuleRunAsNonRoot = "run_as_non_root"
+)
+
+// PosturePolicy rejects or warns on pods with a risky security posture. Modes
+// are the same as for ImagePolicy.
+type PosturePolicy struct {
+	Mode string `json:"mode"`
+	// DenyPrivileged flags privileged containers.
+	DenyPrivileged bool `json:"deny_privileged,omitempty"`
+	// DenyHostPath flags hostPath volumes outside AllowedHostPaths.
+	DenyHostPath     bool     `json:"deny_host_path,omitempty"`
+	AllowedHostPaths []string `json:"allowed_host_paths,omitempty"`
+	// RequireRunAsNonRoot flags containers without runAsNonRoot set to true,
+	// either on the container or inherited from the pod.
+	RequireRunAsNonRoot bool `json:"require_run_as_non_root,omitempty"`
+}
+
+// PosturePolicies is the default posture policy plus per-namespace overrides,
+// resolved like ImagePolicies.
+type PosturePolicies struct {
+	Default    PosturePolicy            `json:"default"`
+	Namespaces map[string]PosturePolicy `json:"namespaces,omitempty"`
+}
+
+// PostureViolation is one container or volume that breaks a posture rule.
+type PostureViolation struct {
+	// Container is empty for pod-level violations such as volumes.
+	Container string `json:"container,omitempty"`
+	Volume    string `json:"volume,omitempty"`
+	Rule      string `json:"rule"`
+}
+
+func (v PostureViolation) String() string {
+	switch v.Rule {
+	case PostureRulePrivileged:
+		return fmt.Sprintf("container %q is privileged", v.Container)
+	case PostureRuleHostPath:
+		return fmt.Sprintf("volume %q mounts a host path", v.Volume)
+	case PostureRuleRunAsNonRoot:
+		return fmt.Sprintf("container %q does not set runAsNonRoot", v.Container)
+	}
+	return fmt.Sprintf("violates %s", v.Rule)
+}
+
+// LoadPosturePolicies reads posture policies from a YAML (or JSON) file. An
+// empty path disables posture checks.
+func LoadPosturePolicies(file string) (PosturePolicies, error) {
+	var p PosturePolicies
+	if err := loadPolicyFile(file, &p); err != nil {
+		return PosturePolicies{}, fmt.Errorf("load posture policies from %s: %w", file, err)
+	}
+	return p, nil
+}
+
+func (p *PosturePolicies) validate() error {
+	modes := make(map[string]string, len(p.Namespaces))
+	for ns, pol := range p.Namespaces {
+		modes[ns] = pol.Mode
+	}
+	return validatePolicyModes(p.Default.Mode, modes)
+}
+
+// For returns the policy that applies to namespace.
+func (p PosturePolicies) For(namespace string) PosturePolicy {
+	return policyFor(p.Default, p.Namespaces, namespace)
+}
+
+// Check returns pod's posture violations.
+func (pol PosturePolicy) Check(pod *corev1.Pod) []PostureViolation {
+	if pol.Mode == "" {
+		return nil
+	}
+	var out []PostureViolation
+	check := func(name string, sc *corev1.SecurityContext) {
+		if pol.DenyPrivileged && sc != nil && sc.Privileged != nil && *sc.Privileged {
+			out = append(out, PostureViolation{Container: name, Rule: PostureRulePrivileged})
+		}
+		if pol.RequireRunAsNonRoot && !runsAsNonRoot(pod.Spec.SecurityContext, sc) {
+			out = append(out, PostureViolation{Container: name, Rule: PostureRuleRunAsNonRoot})
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		check(c.Name, c.SecurityContext)
+	}
+	for _, c := range pod.Spec.Containers {
+		check(c.Name, c.SecurityContext)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		check(c.Name, c.SecurityContext)
+	}
+	if pol.DenyHostPath {
+		for _, v := range pod.Spec.Volumes {
+			if v.HostPath != nil && !hostPathAllowed(v.HostPath.Path, pol.AllowedHostPaths) {
+				out = append(out, PostureViolation{Volume: v.Name, Rule: PostureRuleHostPath})
+			}
+		}
+	}
+	return out
+}
+
+// runsAsNonRoot reports whether runAsNonRoot is true for a container, with
+// the container setting taking precedence over the pod's.
+func runsAsNonRoot(podSC *corev1.PodSecurityContext, sc *corev1.SecurityContext) bool {
+	if sc != nil && sc.RunAsNonRoot != nil {
+		return *sc.RunAsNonRoot
+	}
+	return podSC != nil && podSC.RunAsNonRoot != nil && *podSC.RunAsNonRoot
+}
+
+// hostPathAllowed reports whether p is one of allowed or below one of them.
+func hostPathAllowed(p string, allowed []string) bool {
+	for _, a := range allowed {
+		a = strings.TrimSuffix(a, "/")
+		if p == a || strings.HasPrefix(p, a+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPosturePolicy_Check(t *testing.T) {
+	yes, no := true, false
+	pol := PosturePolicy{
+		Mode:                PolicyModeEnforce,
+		DenyPrivileged:      true,
+		DenyHostPath:        true,
+		AllowedHostPaths:    []string{"/var/log/"},
+		RequireRunAsNonRoot: true,
+	}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: &yes},
+		InitContainers:  []corev1.Container{{Name: "init"}},
+		Containers: []corev1.Container{
+			{Name: "app", SecurityContext: &corev1.SecurityContext{Privileged: &yes}},
+			{Name: "root", SecurityContext: &corev1.SecurityContext{RunAsNonRoot: &no}},
+		},
+		Volumes: []corev1.Volume{
+			{Name: "logs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log/pods"}}},
+			{Name: "docker", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/run/docker.sock"}}},
+			{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+	}}
+	got := map[string][]string{}
+	for _, v := range pol.Check(pod) {
+		got[v.Container+v.Volume] = append(got[v.Container+v.Volume], v.Rule)
+	}
+	if len(got["init"]) != 0 {
+		t.Errorf("init inherits pod runAsNonRoot but was flagged: %v", got["init"])
+	}
+	if want := []string{PostureRulePrivileged}; !equalStrings(got["app"], want) {
+		t.Errorf("app violations = %v, want %v", got["app"], want)
+	}
+	if want := []string{PostureRuleRunAsNonRoot}; !equalStrings(got["root"], want) {
+		t.Errorf("root violations = %v, want %v", got["root"], want)
+	}
+	if want := []string{PostureRuleHostPath}; !equalStrings(got["docker"], want) {
+		t.Errorf("docker violations = %v, want %v", got["docker"], want)
+	}
+	if len(got["logs"]) != 0 || len(got["tmp"]) != 0 {
+		t.Errorf("allowed volumes flagged: %v", got)
+	}
+
+	pol.Mode = ""
+	if v := pol.Check(pod); len(v) != 0 {
+		t.Errorf("disabled policy returned %v", v)
+	}
+}
+
+func TestLoadPosturePolicies(t *testing.T) {
+	if p, err := LoadPosturePolicies(""); err != nil || p.Default.Mode != "" {
+		t.Fatalf("empty path: %+v, %v", p, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "posture.yaml")
+	os.WriteFile(path, []byte(`
+default:
+  mode: warn
+  deny_privileged: true
+namespaces:
+  prod:
+    mode: enforce
+    deny_privileged: true
+    require_run_as_non_root: true
+`), 0o600)
+	p, err := LoadPosturePolicies(path)
+	if err != nil {
+		t.Fatalf("LoadPosturePolicies: %v", err)
+	}
+	if pol := p.For("prod"); pol.Mode != PolicyModeEnforce || !pol.RequireRunAsNonRoot {
+		t.Errorf("prod policy = %+v", pol)
+	}
+	if pol := p.For("dev"); pol.Mode != PolicyModeWarn || pol.RequireRunAsNonRoot {
+		t.Errorf("default policy = %+v", pol)
+	}
+
+	os.WriteFile(path, []byte("default:\n  mode: block\n"), 0o600)
+	if _, err := LoadPosturePolicies(path); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AnnotationProbeCommands lists the pod's exec probe commands as a JSON list
+// of argv lists. The sidecar reads it through the downward API as
+// PROBE_COMMANDS, so the agent can tell probe processes from exec sessions.
+const AnnotationProbeCommands = "apss.invisible.tech/probe-commands"
+
+// probeCommands returns the distinct exec commands of the liveness,
+// readiness and startup probes of pod's containers and init containers.
+func probeCommands(pod *corev1.Pod) [][]string {
+	var commands [][]string
+	seen := make(map[string]bool)
+	add := func(p *corev1.Probe) {
+		if p == nil || p.Exec == nil || len(p.Exec.Command) == 0 {
+			return
+		}
+		key, _ := json.Marshal(p.Exec.Command)
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			commands = append(commands, p.Exec.Command)
+		}
+	}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			add(c.LivenessProbe)
+			add(c.ReadinessProbe)
+			add(c.StartupProbe)
+		}
+	}
+	return commands
+}
+
+// probeAnnotation returns the AnnotationProbeCommands value for pod and the
+// sidecar environment reading it, or "" and nil if pod has no exec probes.
+func probeAnnotation(pod *corev1.Pod) (string, []corev1.EnvVar) {
+	commands := probeCommands(pod)
+	if len(commands) == 0 {
+		return "", nil
+	}
+	value, err := json.Marshal(commands)
+	if err != nil {
+		return "", nil
+	}
+	return string(value), []corev1.EnvVar{{
+		Name: "PROBE_COMMANDS",
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{
+			FieldPath: "metadata.annotations['" + AnnotationProbeCommands + "']",
+		}},
+	}}
+}
@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxDegradedPods bounds the in-memory degraded pod report.
+const maxDegradedPods = 1000
+
+// DegradedPod records a pod that was injected without shareProcessNamespace.
+type DegradedPod struct {
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	InjectedAt time.Time `json:"injected_at"`
+}
+
+type degradedReport struct {
+	mu   sync.Mutex
+	pods map[string]DegradedPod
+}
+
+var degraded = &degradedReport{pods: make(map[string]DegradedPod)}
+
+func (r *degradedReport) record(namespace, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := namespace + "/" + name
+	if _, ok := r.pods[key]; !ok && len(r.pods) >= maxDegradedPods {
+		r.evictOldest()
+	}
+	r.pods[key] = DegradedPod{Namespace: namespace, Name: name, InjectedAt: time.Now()}
+}
+
+// evictOldest drops the oldest entry. Caller must hold mu.
+func (r *degradedReport) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for k, p := range r.pods {
+		if oldestKey == "" || p.InjectedAt.Before(oldest) {
+			oldestKey, oldest = k, p.InjectedAt
+		}
+	}
+	delete(r.pods, oldestKey)
+}
+
+// DegradedPods returns pods injected in degraded monitoring mode since the webhook
+// started, sorted by namespace and name.
+func DegradedPods() []DegradedPod {
+	degraded.mu.Lock()
+	out := make([]DegradedPod, 0, len(degraded.pods))
+	for _, p := range degraded.pods {
+		out = append(out, p)
+	}
+	degraded.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
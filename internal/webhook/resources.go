@@ -0,0 +1,186 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+// Pod annotations overriding the sidecar's requests and limits. The same keys
+// are used in the resource defaults file.
+const (
+	AnnotationCPURequest    = "apss.invisible.tech/cpu-request"
+	AnnotationCPULimit      = "apss.invisible.tech/cpu-limit"
+	AnnotationMemoryRequest = "apss.invisible.tech/memory-request"
+	AnnotationMemoryLimit   = "apss.invisible.tech/memory-limit"
+)
+
+// resourceDefaultsAll is the resource defaults key applying to namespaces
+// without their own entry.
+const resourceDefaultsAll = "*"
+
+// sidecarResourceKeys maps each override key (file key or annotation suffix)
+// to the resource it sets and whether it is a limit.
+var sidecarResourceKeys = map[string]struct {
+	name  corev1.ResourceName
+	limit bool
+}{
+	"cpu-request":    {corev1.ResourceCPU, false},
+	"cpu-limit":      {corev1.ResourceCPU, true},
+	"memory-request": {corev1.ResourceMemory, false},
+	"memory-limit":   {corev1.ResourceMemory, true},
+}
+
+// Built-in sidecar resources, used when nothing overrides them.
+var defaultSidecarResources = map[string]string{
+	"cpu-request":    "10m",
+	"cpu-limit":      "100m",
+	"memory-request": "32Mi",
+	"memory-limit":   "128Mi",
+}
+
+// SidecarResources returns the sidecar requests and limits for pod. Each value
+// comes from, in order: the pod's apss.invisible.tech/<key> annotation, the
+// namespace's entry in cfg.SidecarResourceDefaults, the "*" entry, and the
+// built-in default. Unparseable overrides are ignored. A request above its
+// limit raises the limit so the pod stays valid.
+func SidecarResources(cfg config.WebhookConfig, pod *corev1.Pod) corev1.ResourceRequirements {
+	res := corev1.ResourceRequirements{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+	for key, r := range sidecarResourceKeys {
+		candidates := []string{
+			pod.Annotations["apss.invisible.tech/"+key],
+			cfg.SidecarResourceDefaults[pod.Namespace][key],
+			cfg.SidecarResourceDefaults[resourceDefaultsAll][key],
+			defaultSidecarResources[key],
+		}
+		for _, v := range candidates {
+			q, err := resource.ParseQuantity(v)
+			if v == "" || err != nil {
+				continue
+			}
+			if r.limit {
+				res.Limits[r.name] = q
+			} else {
+				res.Requests[r.name] = q
+			}
+			break
+		}
+	}
+	for name, req := range res.Requests {
+		if limit, ok := res.Limits[name]; ok && req.Cmp(limit) > 0 {
+			res.Limits[name] = req
+		}
+	}
+	return res
+}
+
+// ResourceDefaultsStatus is the active resource defaults, served on
+// /api/v1/resources.
+type ResourceDefaultsStatus struct {
+	// Defaults maps namespace ("*" for all others) to override keys such as
+	// "cpu-limit" and their quantities.
+	Defaults  map[string]map[string]string `json:"defaults"`
+	Source    string                       `json:"source,omitempty"`
+	LoadedAt  time.Time                    `json:"loaded_at"`
+	LastError string                       `json:"last_error,omitempty"`
+}
+
+// ResourceDefaultsWatcher holds the per-namespace sidecar resource defaults
+// loaded from a mounted ConfigMap file, reloaded when it changes.
+type ResourceDefaultsWatcher struct {
+	path string
+	log  *logrus.Logger
+
+	mu     sync.RWMutex
+	status ResourceDefaultsStatus
+}
+
+// NewResourceDefaultsWatcher loads cfg.SidecarResourcesFile if it is set.
+func NewResourceDefaultsWatcher(cfg config.WebhookConfig, log *logrus.Logger) (*ResourceDefaultsWatcher, error) {
+	w := &ResourceDefaultsWatcher{
+		path:   cfg.SidecarResourcesFile,
+		log:    log,
+		status: ResourceDefaultsStatus{LoadedAt: time.Now()},
+	}
+	if w.path != "" {
+		if err := w.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Status returns the active resource defaults.
+func (w *ResourceDefaultsWatcher) Status() ResourceDefaultsStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.status
+}
+
+// Apply returns cfg with SidecarResourceDefaults set to the active defaults.
+func (w *ResourceDefaultsWatcher) Apply(cfg config.WebhookConfig) config.WebhookConfig {
+	w.mu.RLock()
+	cfg.SidecarResourceDefaults = w.status.Defaults
+	w.mu.RUnlock()
+	return cfg
+}
+
+// Watch reloads the defaults file whenever it changes until ctx is done.
+func (w *ResourceDefaultsWatcher) Watch(ctx context.Context) error {
+	return watchFile(ctx, w.path, func() {
+		if err := w.reload(); err != nil {
+			w.log.WithError(err).Error("Failed to reload sidecar resource defaults, keeping previous values")
+		}
+	}, w.log)
+}
+
+func (w *ResourceDefaultsWatcher) reload() error {
+	data, err := os.ReadFile(w.path)
+	if err == nil && len(bytes.TrimSpace(data)) == 0 {
+		err = errors.New("file is empty")
+	}
+	var defaults map[string]map[string]string
+	if err == nil {
+		err = yaml.UnmarshalStrict(data, &defaults)
+	}
+	if err == nil {
+		err = validateResourceDefaults(defaults)
+	}
+	if err != nil {
+		err = fmt.Errorf("load sidecar resource defaults from %s: %w", w.path, err)
+		w.mu.Lock()
+		w.status.LastError = err.Error()
+		w.mu.Unlock()
+		return err
+	}
+	w.mu.Lock()
+	w.status = ResourceDefaultsStatus{Defaults: defaults, Source: w.path, LoadedAt: time.Now()}
+	w.mu.Unlock()
+	w.log.WithFields(logrus.Fields{"file": w.path, "namespaces": len(defaults)}).Info("Loaded sidecar resource defaults")
+	return nil
+}
+
+func validateResourceDefaults(defaults map[string]map[string]string) error {
+	for ns, values := range defaults {
+		for key, v := range values {
+			if _, ok := sidecarResourceKeys[key]; !ok {
+				return fmt.Errorf("namespace %q: unknown key %q", ns, key)
+			}
+			if _, err := resource.ParseQuantity(v); err != nil {
+				return fmt.Errorf("namespace %q: %s: %w", ns, key, err)
+			}
+		}
+	}
+	return nil
+}
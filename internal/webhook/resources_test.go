@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/config"
+)
+
+func TestSidecarResources_Precedence(t *testing.T) {
+	cfg := config.WebhookConfig{SidecarResourceDefaults: map[string]map[string]string{
+		"*":     {"memory-limit": "256Mi"},
+		"batch": {"cpu-limit": "500m", "memory-limit": "512Mi"},
+	}}
+	pod := func(ns string, annos map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Annotations: annos}}
+	}
+	tests := []struct {
+		name           string
+		pod            *corev1.Pod
+		cpuReq, cpuLim string
+		memReq, memLim string
+	}{
+		{"built-in and wildcard", pod("web", nil), "10m", "100m", "32Mi", "256Mi"},
+		{"namespace defaults", pod("batch", nil), "10m", "500m", "32Mi", "512Mi"},
+		{"annotation wins", pod("batch", map[string]string{AnnotationCPULimit: "1", AnnotationMemoryRequest: "16Mi"}), "10m", "1", "16Mi", "512Mi"},
+		{"invalid annotation ignored", pod("web", map[string]string{AnnotationCPULimit: "lots"}), "10m", "100m", "32Mi", "256Mi"},
+		{"request above limit raises limit", pod("web", map[string]string{AnnotationCPURequest: "250m"}), "250m", "250m", "32Mi", "256Mi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := SidecarResources(cfg, tt.pod)
+			got := []string{
+				res.Requests.Cpu().String(), res.Limits.Cpu().String(),
+				res.Requests.Memory().String(), res.Limits.Memory().String(),
+			}
+			want := []string{tt.cpuReq, tt.cpuLim, tt.memReq, tt.memLim}
+			if !equalStrings(got, want) {
+				t.Errorf("resources = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResourceDefaultsWatcher_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("\"*\":\n  cpu-limit: 200m\n")
+
+	w, err := NewResourceDefaultsWatcher(config.WebhookConfig{SidecarResourcesFile: path}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewResourceDefaultsWatcher: %v", err)
+	}
+	if got := w.Apply(config.WebhookConfig{}).SidecarResourceDefaults["*"]["cpu-limit"]; got != "200m" {
+		t.Errorf("cpu-limit = %q", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	write("batch:\n  memory-limit: 1Gi\n")
+	waitFor(t, func() bool { return w.Status().Defaults["batch"] != nil })
+
+	write("batch:\n  gpu-limit: 1\n")
+	waitFor(t, func() bool { return w.Status().LastError != "" })
+	if got := w.Status().Defaults["batch"]["memory-limit"]; got != "1Gi" {
+		t.Errorf("bad file should keep previous defaults, memory-limit = %q", got)
+	}
+}
+
+func TestNewResourceDefaultsWatcher_BadQuantity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.yaml")
+	if err := os.WriteFile(path, []byte("web:\n  cpu-limit: fast\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewResourceDefaultsWatcher(config.WebhookConfig{SidecarResourcesFile: path}, logrus.New()); err == nil {
+		t.Error("expected error for invalid quantity")
+	}
+}
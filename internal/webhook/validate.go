@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/types"
+)
+
+var (
+	imagePolicyViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "apss_webhook_image_policy_violations_total",
+		Help: "Container images violating the admission image policy, by rule and mode",
+	}, []string{"namespace", "rule", "mode"})
+	posturePolicyViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "apss_webhook_posture_policy_violations_total",
+		Help: "Pod security posture violations at admission, by rule and mode",
+	}, []string{"namespace", "rule", "mode"})
+)
+
+func init() {
+	prometheus.MustRegister(imagePolicyViolations, posturePolicyViolations)
+}
+
+// ValidationPolicies are the policies checked on /validate.
+type ValidationPolicies struct {
+	Images  ImagePolicies
+	Posture PosturePolicies
+	// OPA, when set, is also asked about every pod.
+	OPA *OPA
+}
+
+// ProcessValidationReview decodes a validating admission review, checks the
+// pod against policies and returns the response body. Pods that violate a
+// policy, and kubectl exec and attach into pods, are reported to audit as
+// k8s_audit events.
+func ProcessValidationReview(body []byte, policies ValidationPolicies, audit *AuditReporter, log *logrus.Logger) ([]byte, error) {
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil {
+		return nil, fmt.Errorf("decode admission review: %w", err)
+	}
+	if review.Request == nil {
+		return nil, fmt.Errorf("admission review has no request")
+	}
+
+	review.Response = validateRequest(review.Request, policies, audit, log)
+	review.Response.UID = review.Request.UID
+
+	return json.Marshal(review)
+}
+
+func validateRequest(req *admissionv1.AdmissionRequest, policies ValidationPolicies, audit *AuditReporter, log *logrus.Logger) *admissionv1.AdmissionResponse {
+	if req.Operation == admissionv1.Connect {
+		if req.Resource.Resource == "pods" && (req.SubResource == "exec" || req.SubResource == "attach") {
+			audit.Report(execEvent(req))
+		}
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	if req.Kind.Kind != "Pod" {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	images := policies.Images.For(req.Namespace)
+	posture := policies.Posture.For(req.Namespace)
+	if images.Mode == "" && posture.Mode == "" && policies.OPA == nil {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	var pod corev1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		log.WithError(err).Error("Failed to unmarshal pod")
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result:  &metav1.Status{Message: fmt.Sprintf("Failed to unmarshal pod: %v", err)},
+		}
+	}
+
+	// Violations are split by the mode of the policy they broke.
+	var denied, warned []string
+	record := func(mode, msg string) {
+		if mode == PolicyModeEnforce {
+			denied = append(denied, msg)
+		} else {
+			warned = append(warned, msg)
+		}
+	}
+	for _, v := range images.Check(&pod) {
+		imagePolicyViolations.WithLabelValues(req.Namespace, v.Rule, images.Mode).Inc()
+		record(images.Mode, "image policy: "+v.String())
+	}
+	for _, v := range posture.Check(&pod) {
+		posturePolicyViolations.WithLabelValues(req.Namespace, v.Rule, posture.Mode).Inc()
+		record(posture.Mode, "posture policy: "+v.String())
+	}
+	if policies.OPA != nil {
+		opaDenied, opaWarned := policies.OPA.Check(req)
+		denied = append(denied, opaDenied...)
+		warned = append(warned, opaWarned...)
+	}
+	if len(denied) == 0 && len(warned) == 0 {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	name := pod.Name
+	if name == "" {
+		name = pod.GenerateName
+	}
+	log.WithFields(logrus.Fields{
+		"pod":       name,
+		"namespace": req.Namespace,
+		"denied":    denied,
+		"warned":    warned,
+	}).Warn("Pod violates admission policy")
+	audit.Report(admissionEvent(req, name, denied, warned))
+
+	if len(denied) > 0 {
+		return &admissionv1.AdmissionResponse{
+			Allowed:  false,
+			Warnings: warned,
+			Result: &metav1.Status{
+				Code:    http.StatusForbidden,
+				Reason:  metav1.StatusReasonForbidden,
+				Message: strings.Join(denied, "; "),
+			},
+		}
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true, Warnings: warned}
+}
+
+// admissionEvent builds the k8s_audit event for a pod that violated policy.
+// Rejected pods are HIGH severity, warned ones MEDIUM.
+func admissionEvent(req *admissionv1.AdmissionRequest, name string, denied, warned []string) *types.SecurityEvent {
+	severity, decision := "MEDIUM", "warned"
+	if len(denied) > 0 {
+		severity, decision = "HIGH", "denied"
+	}
+	return &types.SecurityEvent{
+		SchemaVersion: types.CurrentSchemaVersion,
+		ID:            "admission-" + string(req.UID),
+		AgentID:       AuditAgentID,
+		Type:          auditEventType,
+		Severity:      severity,
+		Timestamp:     time.Now(),
+		PodName:       name,
+		PodNamespace:  req.Namespace,
+		Audit: &types.AuditEventData{
+			Verb:             strings.ToLower(string(req.Operation)),
+			Resource:         "pods",
+			Name:             name,
+			Namespace:        req.Namespace,
+			User:             req.UserInfo.Username,
+			Groups:           req.UserInfo.Groups,
+			PolicyViolations: append(append([]string(nil), denied...), warned...),
+		},
+		Metadata: map[string]interface{}{"admission_decision": decision},
+	}
+}
+
+// execEvent builds the INFO k8s_audit event for a kubectl exec or attach into
+// a pod, which the controller uses to explain the shells that follow it.
+func execEvent(req *admissionv1.AdmissionRequest) *types.SecurityEvent {
+	event := &types.SecurityEvent{
+		SchemaVersion: types.CurrentSchemaVersion,
+		ID:            "exec-" + string(req.UID),
+		AgentID:       AuditAgentID,
+		Type:          auditEventType,
+		Severity:      "INFO",
+		Timestamp:     time.Now(),
+		PodName:       req.Name,
+		PodNamespace:  req.Namespace,
+		Audit: &types.AuditEventData{
+			Verb:      strings.ToLower(string(req.Operation)),
+			Resource:  "pods/" + req.SubResource,
+			Name:      req.Name,
+			Namespace: req.Namespace,
+			User:      req.UserInfo.Username,
+			Groups:    req.UserInfo.Groups,
+		},
+	}
+	var opts corev1.PodExecOptions
+	if req.SubResource == "exec" && json.Unmarshal(req.Object.Raw, &opts) == nil {
+		event.Metadata = map[string]interface{}{"container": opts.Container, "command": opts.Command}
+	}
+	return event
+}
@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func validationReview(t *testing.T, namespace string, policies ImagePolicies, images ...string) *admissionv1.AdmissionResponse {
+	t.Helper()
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "web-"}}
+	for i, image := range images {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: string(rune('a' + i)), Image: image})
+	}
+	return reviewPod(t, namespace, ValidationPolicies{Images: policies}, nil, pod)
+}
+
+func reviewPod(t *testing.T, namespace string, policies ValidationPolicies, audit *AuditReporter, pod corev1.Pod) *admissionv1.AdmissionResponse {
+	t.Helper()
+	podRaw, _ := json.Marshal(pod)
+	body, _ := json.Marshal(admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "req-v",
+			Kind:      metav1.GroupVersionKind{Kind: "Pod"},
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "alice", Groups: []string{"devs"}},
+			Object:    runtime.RawExtension{Raw: podRaw},
+		},
+	})
+	respBody, err := ProcessValidationReview(body, policies, audit, logrus.New())
+	if err != nil {
+		t.Fatalf("ProcessValidationReview: %v", err)
+	}
+	var resp admissionv1.AdmissionReview
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		t.Fatalf("Unmarshal response: %v", err)
+	}
+	if resp.Response.UID != "req-v" {
+		t.Errorf("response UID = %q", resp.Response.UID)
+	}
+	return resp.Response
+}
+
+func TestProcessValidationReview_ImagePolicy(t *testing.T) {
+	policies := ImagePolicies{
+		Default: ImagePolicy{Mode: PolicyModeWarn, DenyLatest: true},
+		Namespaces: map[string]ImagePolicy{
+			"prod": {Mode: PolicyModeEnforce, DenyLatest: true},
+			"free": {},
+		},
+	}
+
+	resp := validationReview(t, "dev", policies, "app:latest")
+	if !resp.Allowed || len(resp.Warnings) != 1 {
+		t.Errorf("warn mode: allowed=%v warnings=%v", resp.Allowed, resp.Warnings)
+	}
+
+	before := testutil.ToFloat64(imagePolicyViolations.WithLabelValues("prod", ImageRuleLatest, PolicyModeEnforce))
+	resp = validationReview(t, "prod", policies, "app", "app:1.2")
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != http.StatusForbidden {
+		t.Errorf("enforce mode: allowed=%v result=%+v", resp.Allowed, resp.Result)
+	}
+	after := testutil.ToFloat64(imagePolicyViolations.WithLabelValues("prod", ImageRuleLatest, PolicyModeEnforce))
+	if after-before != 1 {
+		t.Errorf("violation counter delta = %v, want 1", after-before)
+	}
+
+	if resp := validationReview(t, "prod", policies, "app:1.2"); !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Errorf("compliant pod: allowed=%v warnings=%v", resp.Allowed, resp.Warnings)
+	}
+	if resp := validationReview(t, "free", policies, "app:latest"); !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Errorf("disabled namespace: allowed=%v warnings=%v", resp.Allowed, resp.Warnings)
+	}
+}
+
+func TestProcessValidationReview_NoRequest(t *testing.T) {
+	body, _ := json.Marshal(admissionv1.AdmissionReview{})
+	if _, err := ProcessValidationReview(body, ValidationPolicies{}, nil, logrus.New()); err == nil {
+		t.Error("expected error when Request is nil")
+	}
+}
+
+func TestProcessValidationReview_PosturePolicy(t *testing.T) {
+	privileged := true
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:            "app",
+			Image:           "app:latest",
+			SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+		}}},
+	}
+	policies := ValidationPolicies{
+		Images:  ImagePolicies{Default: ImagePolicy{Mode: PolicyModeWarn, DenyLatest: true}},
+		Posture: PosturePolicies{Default: PosturePolicy{Mode: PolicyModeEnforce, DenyPrivileged: true}},
+	}
+	audit := NewAuditReporter("controller:8080", "", logrus.New())
+
+	before := testutil.ToFloat64(posturePolicyViolations.WithLabelValues("prod", PostureRulePrivileged, PolicyModeEnforce))
+	resp := reviewPod(t, "prod", policies, audit, pod)
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != http.StatusForbidden {
+		t.Fatalf("enforce mode: allowed=%v result=%+v", resp.Allowed, resp.Result)
+	}
+	if len(resp.Warnings) != 1 {
+		t.Errorf("warn-mode image violation should still be a warning: %v", resp.Warnings)
+	}
+	if d := testutil.ToFloat64(posturePolicyViolations.WithLabelValues("prod", PostureRulePrivileged, PolicyModeEnforce)) - before; d != 1 {
+		t.Errorf("violation counter delta = %v, want 1", d)
+	}
+
+	if len(audit.queue) != 1 {
+		t.Fatalf("queued audit events = %d, want 1", len(audit.queue))
+	}
+	event := <-audit.queue
+	if event.Type != auditEventType || event.AgentID != AuditAgentID || event.Severity != "HIGH" || event.ID != "admission-req-v" {
+		t.Errorf("event = %+v", event)
+	}
+	if a := event.Audit; a == nil || a.Verb != "create" || a.Name != "web" || a.Namespace != "prod" ||
+		a.User != "alice" || len(a.PolicyViolations) != 2 {
+		t.Errorf("audit data = %+v", event.Audit)
+	}
+	if event.Metadata["admission_decision"] != "denied" {
+		t.Errorf("admission_decision = %v", event.Metadata["admission_decision"])
+	}
+
+	pod.Spec.Containers[0].SecurityContext = nil
+	pod.Spec.Containers[0].Image = "app:1.2"
+	if resp := reviewPod(t, "prod", policies, audit, pod); !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Errorf("compliant pod: allowed=%v warnings=%v", resp.Allowed, resp.Warnings)
+	}
+	if len(audit.queue) != 0 {
+		t.Error("compliant pods must not be audited")
+	}
+}
+
+func TestProcessValidationReview_ExecAudited(t *testing.T) {
+	opts, _ := json.Marshal(corev1.PodExecOptions{Container: "app", Command: []string{"sh"}})
+	body, _ := json.Marshal(admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:         "req-x",
+			Kind:        metav1.GroupVersionKind{Kind: "PodExecOptions"},
+			Resource:    metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			SubResource: "exec",
+			Name:        "web-1",
+			Namespace:   "prod",
+			Operation:   admissionv1.Connect,
+			UserInfo:    authenticationv1.UserInfo{Username: "alice"},
+			Object:      runtime.RawExtension{Raw: opts},
+		},
+	})
+	audit := NewAuditReporter("controller:8080", "", logrus.New())
+	respBody, err := ProcessValidationReview(body, ValidationPolicies{}, audit, logrus.New())
+	if err != nil {
+		t.Fatalf("ProcessValidationReview: %v", err)
+	}
+	var resp admissionv1.AdmissionReview
+	if err := json.Unmarshal(respBody, &resp); err != nil || !resp.Response.Allowed {
+		t.Fatalf("exec must be allowed: %s", respBody)
+	}
+	if len(audit.queue) != 1 {
+		t.Fatalf("queued audit events = %d, want 1", len(audit.queue))
+	}
+	event := <-audit.queue
+	if event.ID != "exec-req-x" || event.Severity != "INFO" || event.PodName != "web-1" || event.PodNamespace != "prod" {
+		t.Errorf("event = %+v", event)
+	}
+	if a := event.Audit; a == nil || a.Resource != "pods/exec" || a.Verb != "connect" || a.User != "alice" {
+		t.Errorf("audit data = %+v", event.Audit)
+	}
+	if event.Metadata["container"] != "app" {
+		t.Errorf("metadata = %v", event.Metadata)
+	}
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/kube"
+)
+
+// Sidecar injection modes for WebhookConfig.SidecarMode.
+const (
+	SidecarModeAuto    = "auto"
+	SidecarModeNative  = "native"
+	SidecarModeClassic = "classic"
+)
+
+// nativeSidecarMinor is the first Kubernetes 1.x minor with native sidecars
+// enabled by default.
+const nativeSidecarMinor = 29
+
+// ServerVersionFunc returns the API server's major and minor version.
+type ServerVersionFunc func(ctx context.Context) (major, minor int, err error)
+
+// ResolveNativeSidecar decides whether to inject native sidecars. In auto mode
+// the cluster version is detected; if detection fails the webhook falls back to
+// classic sidecars, which work on every version.
+func ResolveNativeSidecar(ctx context.Context, mode string, version ServerVersionFunc, log *logrus.Logger) bool {
+	switch mode {
+	case SidecarModeNative:
+		return true
+	case SidecarModeClassic:
+		return false
+	case SidecarModeAuto, "":
+	default:
+		log.WithField("mode", mode).Warn("Unknown sidecar mode, using auto")
+	}
+
+	major, minor, err := version(ctx)
+	if err != nil {
+		log.WithError(err).Warn("Cannot detect Kubernetes version, injecting classic sidecars")
+		return false
+	}
+	native := major > 1 || (major == 1 && minor >= nativeSidecarMinor)
+	log.WithFields(logrus.Fields{"version": fmt.Sprintf("%d.%d", major, minor), "native_sidecar": native}).Info("Detected Kubernetes version")
+	return native
+}
+
+// InClusterServerVersion queries /version on the API server using the pod's
+// service account.
+func InClusterServerVersion(ctx context.Context) (int, int, error) {
+	client, err := kube.NewInCluster()
+	if err != nil {
+		return 0, 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var v struct {
+		Major string `json:"major"`
+		Minor string `json:"minor"`
+	}
+	if err := client.Get(ctx, "/version", &v); err != nil {
+		return 0, 0, err
+	}
+	return parseVersion(v.Major, v.Minor)
+}
+
+// parseVersion parses /version major and minor fields, which providers such
+// as GKE suffix with "+" (e.g. "29+").
+func parseVersion(major, minor string) (int, int, error) {
+	trim := func(s string) string { return strings.TrimRight(s, "+") }
+	ma, err := strconv.Atoi(trim(major))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid major version %q", major)
+	}
+	mi, err := strconv.Atoi(trim(minor))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid minor version %q", minor)
+	}
+	return ma, mi, nil
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		major, minor string
+		wantMajor    int
+		wantMinor    int
+		wantErr      bool
+	}{
+		{"1", "29", 1, 29, false},
+		{"1", "28+", 1, 28, false},
+		{"1", "", 0, 0, true},
+		{"v1", "29", 0, 0, true},
+	}
+	for _, tt := range tests {
+		ma, mi, err := parseVersion(tt.major, tt.minor)
+		if (err != nil) != tt.wantErr || ma != tt.wantMajor || mi != tt.wantMinor {
+			t.Errorf("parseVersion(%q, %q) = %d, %d, %v", tt.major, tt.minor, ma, mi, err)
+		}
+	}
+}
+
+func TestResolveNativeSidecar(t *testing.T) {
+	version := func(major, minor int, err error) ServerVersionFunc {
+		return func(context.Context) (int, int, error) { return major, minor, err }
+	}
+	tests := []struct {
+		name    string
+		mode    string
+		version ServerVersionFunc
+		want    bool
+	}{
+		{"native forced", SidecarModeNative, version(1, 20, nil), true},
+		{"classic forced", SidecarModeClassic, version(1, 30, nil), false},
+		{"auto old cluster", SidecarModeAuto, version(1, 28, nil), false},
+		{"auto 1.29", SidecarModeAuto, version(1, 29, nil), true},
+		{"auto detection fails", SidecarModeAuto, version(0, 0, errors.New("offline")), false},
+		{"unknown mode falls back to auto", "sideways", version(1, 30, nil), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveNativeSidecar(context.Background(), tt.mode, tt.version, logrus.New()); got != tt.want {
+				t.Errorf("ResolveNativeSidecar = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
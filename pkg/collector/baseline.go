@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ErrBaselineExists is returned by UploadBaseline when the controller
+// already holds a baseline for the agent's workload.
+var ErrBaselineExists = errors.New("baseline already exists")
+
+// maxBaselineBytes bounds a baseline fetched from the controller.
+const maxBaselineBytes = 16 << 20
+
+func (ec *EventCollector) baselinePath() string {
+	return fmt.Sprintf("/api/v1/agents/%s/baseline", url.PathEscape(ec.cfg.AgentID))
+}
+
+// FetchBaseline returns the signed file integrity baseline the controller
+// holds for the agent's workload, as JSON, or nil if it has none.
+func (ec *EventCollector) FetchBaseline(ctx context.Context) ([]byte, error) {
+	if ec.cfg.ControllerEndpoint == "" {
+		return nil, fmt.Errorf("controller endpoint not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ec.baseURL()+ec.baselinePath(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if ec.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ec.cfg.AuthToken)
+	}
+	resp, err := ec.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBaselineBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	return body, nil
+}
+
+// UploadBaseline offers the agent's startup baseline, as JSON, to the
+// controller to sign and keep as its workload's baseline.
+func (ec *EventCollector) UploadBaseline(ctx context.Context, baseline []byte) error {
+	if ec.cfg.ControllerEndpoint == "" {
+		return fmt.Errorf("controller endpoint not configured")
+	}
+	status, err := ec.doPost(ctx, ec.baselinePath(), baseline, nil)
+	switch {
+	case err != nil:
+		return err
+	case status == http.StatusConflict:
+		return ErrBaselineExists
+	case status >= 300:
+		return fmt.Errorf("unexpected status code: %d", status)
+	}
+	return nil
+}
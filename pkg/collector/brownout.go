@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Brownout is a fleet-wide slowdown of scans started on the controller:
+// scan intervals are multiplied by Factor until Until.
+type Brownout struct {
+	Factor int       `json:"factor"`
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+// FetchBrownout polls the controller for the brownout in effect. etag is
+// the ETag of the brownout last applied; nil is returned with the same etag
+// when it did not change, and nil with an empty etag when there is none.
+func (ec *EventCollector) FetchBrownout(ctx context.Context, etag string) (*Brownout, string, error) {
+	if ec.cfg.ControllerEndpoint == "" {
+		return nil, etag, fmt.Errorf("controller endpoint not configured")
+	}
+
+	u := fmt.Sprintf("%s/api/v1/agents/%s/brownout", ec.baseURL(), url.PathEscape(ec.cfg.AgentID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, etag, fmt.Errorf("failed to create request: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if ec.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ec.cfg.AuthToken)
+	}
+
+	resp, err := ec.httpClient.Do(req)
+	if err != nil {
+		return nil, etag, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusNotFound:
+		return nil, "", nil
+	case http.StatusOK:
+	default:
+		return nil, etag, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var b Brownout
+	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		return nil, etag, fmt.Errorf("failed to decode brownout: %w", err)
+	}
+	return &b, resp.Header.Get("ETag"), nil
+}
@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/breaker"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/jitter"
 )
 
 // EventType represents the type of security event
@@ -31,6 +35,10 @@ const (
 	EventTypeSuspiciousActivity
 )
 
+// SchemaVersion is the controller payload schema produced by this collector.
+// Controllers treat payloads without a schema_version as legacy v1.
+const SchemaVersion = "v2"
+
 // Severity levels for events
 type Severity int
 
@@ -50,6 +58,11 @@ type SecurityEvent struct {
 	Severity  Severity
 	Timestamp time.Time
 
+	// OccurredAt is when the activity actually happened, where the monitor
+	// can derive it from kernel data (process start time, file mtime); zero
+	// if unknown. Timestamp is when the agent observed it.
+	OccurredAt time.Time
+
 	// Source context (filled by collector)
 	PodName       string
 	PodNamespace  string
@@ -81,6 +94,26 @@ type ProcessEvent struct {
 	StartTime            time.Time
 	ExitCode             int
 	SuspiciousIndicators []string
+
+	// ExeHash is the hex SHA-256 of the executable, when it could be read.
+	ExeHash string
+	// Ancestors is the process lineage, parent first.
+	Ancestors []ProcessAncestor
+	// Environment holds the flagged environment variables, with credential
+	// values hashed when redaction is on.
+	Environment map[string]string
+	// CPUPercent is the CPU used between the last two scans, in percent of
+	// one core; MemoryBytes is the resident set size.
+	CPUPercent  float64
+	MemoryBytes int64
+}
+
+// ProcessAncestor is one process in a ProcessEvent's lineage.
+type ProcessAncestor struct {
+	PID     int      `json:"pid"`
+	Name    string   `json:"name"`
+	ExePath string   `json:"exe_path,omitempty"`
+	Cmdline []string `json:"cmdline,omitempty"`
 }
 
 // NetworkEvent contains network-related event data
@@ -107,7 +140,29 @@ type FileEvent struct {
 	OldHash     string
 	NewHash     string
 	SizeBytes   int64
-	Permissions string
+	// Permissions and OldPermissions are the file's mode bits in octal, such
+	// as 4755, after and before the change, when known.
+	Permissions    string
+	OldPermissions string
+	// Owner and OldOwner are the file's owner after and before the change,
+	// when known.
+	Owner    *FileOwner
+	OldOwner *FileOwner
+	// OldModTime and NewModTime are the file's mtime before and after the
+	// change, when known.
+	OldModTime time.Time
+	NewModTime time.Time
+	// Indicators are anti-forensics and privilege escalation signs seen on
+	// the change, e.g. "timestomp" or "setuid".
+	Indicators []string
+	// YaraRules are the YARA rules the file's content matched.
+	YaraRules []string
+}
+
+// FileOwner is the numeric owner and group of a file.
+type FileOwner struct {
+	UID int
+	GID int
 }
 
 // ResourceEvent contains resource usage event data
@@ -122,6 +177,26 @@ type ResourceEvent struct {
 	NetworkTxBytes   int64
 	AnomalyType      string
 	AnomalyScore     float64
+	// Disk usage anomalies: the watched path, its file count change and the
+	// directories that grew the most.
+	Path           string
+	FileCountDelta int
+	TopPaths       []PathUsage
+	// Inode exhaustion: used and total inodes of the path's filesystem.
+	InodesUsed  uint64
+	InodesTotal uint64
+	// File descriptor exhaustion: the process and its open fds and limit.
+	PID         int
+	ProcessName string
+	OpenFDs     int
+	FDLimit     int
+}
+
+// PathUsage is the growth of one directory between two disk usage scans
+type PathUsage struct {
+	Path        string `json:"path"`
+	GrowthBytes int64  `json:"growth_bytes"`
+	GrowthFiles int    `json:"growth_files"`
 }
 
 // DNSEvent contains DNS query event data
@@ -156,7 +231,35 @@ type Config struct {
 	AgentID            string
 	PodName            string
 	PodNamespace       string
+	NodeName           string
+	PodIP              string
 	BufferSize         int
+	// Version and ConfigHash identify the agent build and effective config
+	// in registration and heartbeats.
+	Version    string
+	ConfigHash string
+	// DegradedMode tags every event with monitoring_mode=degraded so the
+	// controller knows process visibility is missing for this agent.
+	DegradedMode bool
+	// AuthToken is sent as a bearer token when the controller requires auth.
+	AuthToken string
+	// BreakerThreshold consecutive failures to a controller path stop sends
+	// to it for BreakerCooldown, after which one probe is let through.
+	// 0 disables circuit breaking.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// SpoolDir holds events that could not be sent, up to SpoolMaxBytes,
+	// until the controller is reachable again. Empty disables spooling.
+	SpoolDir      string
+	SpoolMaxBytes int64
+	// ServiceAccount is the pod's Kubernetes ServiceAccount; IdentityResolvers
+	// add to it when ResolveIdentity is called.
+	ServiceAccount    string
+	IdentityResolvers []IdentityResolver
+	// ClusterName and Environment tag registration and every event with
+	// where the agent runs
+	ClusterName string
+	Environment string
 }
 
 // EventCollector collects and sends events to the controller
@@ -171,6 +274,25 @@ type EventCollector struct {
 	httpClient *http.Client
 	mu         sync.RWMutex
 
+	// Per-path circuit breakers and the spool for events sent while the
+	// controller is unreachable
+	breakers   map[string]*breaker.Breaker
+	breakersMu sync.Mutex
+	spool      *spool
+
+	// identity is set once by ResolveIdentity
+	identity *Identity
+
+	// route is the base URL of the controller replica the routing table
+	// assigns this agent, empty when the controller does not shard agents
+	route string
+
+	// protocol is what the handshake negotiated, nil for protocol 1
+	protocol *Protocol
+	// pending is the batch of events not yet sent when batching
+	pending      [][]byte
+	pendingBytes int
+
 	// Stats
 	eventsSent    int64
 	eventsDropped int64
@@ -181,15 +303,27 @@ func New(cfg Config, log *logrus.Logger) (*EventCollector, error) {
 	if cfg.BufferSize == 0 {
 		cfg.BufferSize = 10000
 	}
+	if cfg.BreakerCooldown == 0 {
+		cfg.BreakerCooldown = 30 * time.Second
+	}
 
-	return &EventCollector{
+	ec := &EventCollector{
 		cfg: cfg,
 		log: log,
 		eventChan: make(chan SecurityEvent, cfg.BufferSize),
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-	}, nil
+		breakers: make(map[string]*breaker.Breaker),
+	}
+	if cfg.SpoolDir != "" {
+		sp, err := openSpool(cfg.SpoolDir, cfg.SpoolMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spool: %w", err)
+		}
+		ec.spool = sp
+	}
+	return ec, nil
 }
 
 // EventChannel returns the channel for sending events
@@ -201,14 +335,29 @@ func (ec *EventCollector) EventChannel() chan<- SecurityEvent {
 func (ec *EventCollector) Start(ctx context.Context) error {
 	ec.log.WithField("endpoint", ec.cfg.ControllerEndpoint).Info("Starting event collector")
 
+	// Spooled events are also replayed on a timer so they are delivered
+	// even when no new events arrive
+	drainTicker := jitter.NewTicker(ec.cfg.BreakerCooldown)
+	defer drainTicker.Stop()
+	// Batched events are sent at least this often
+	flushTicker := time.NewTicker(batchFlushInterval)
+	defer flushTicker.Stop()
+
 	// Process events
 	for {
 		select {
 		case <-ctx.Done():
+			ec.spoolPending()
 			return ctx.Err()
 
 		case event := <-ec.eventChan:
 			ec.processEvent(ctx, event)
+
+		case <-drainTicker.C:
+			ec.drainSpool(ctx)
+
+		case <-flushTicker.C:
+			ec.flushBatch(ctx)
 		}
 	}
 }
@@ -227,12 +376,73 @@ func (ec *EventCollector) processEvent(ctx context.Context, event SecurityEvent)
 	// Log event locally (always)
 	ec.logEvent(event)
 
-	// Send to controller if connected
-	if err := ec.sendEvent(ctx, event); err != nil {
+	// Send to controller if connected, spooling it otherwise
+	eventJSON, err := ec.eventToJSON(event)
+	if err != nil {
 		ec.eventsDropped++
-		ec.log.WithError(err).Debug("Failed to send event")
-	} else {
+		ec.log.WithError(err).Debug("Failed to marshal event")
+		return
+	}
+	if p := ec.negotiated(); p.Has(CapabilityBatch) {
+		ec.batchEvent(ctx, p, eventJSON)
+		return
+	}
+	if err := ec.sendEvent(ctx, eventJSON); err != nil {
+		ec.spoolEvent(eventJSON, err)
+		return
+	}
+	ec.eventsSent++
+	ec.drainSpool(ctx)
+}
+
+// spoolEvent keeps an event that failed to send for later replay. Events
+// the controller rejected outright, and events that do not fit in the spool,
+// are dropped.
+func (ec *EventCollector) spoolEvent(eventJSON []byte, sendErr error) {
+	var se *statusError
+	if ec.spool == nil || (errors.As(sendErr, &se) && !se.retryable()) {
+		ec.eventsDropped++
+		ec.log.WithError(sendErr).Debug("Failed to send event")
+		return
+	}
+	if err := ec.spool.append(eventJSON); err != nil {
+		ec.eventsDropped++
+		ec.log.WithError(err).Debug("Failed to spool event")
+		return
+	}
+}
+
+// spoolDrainBatch bounds how many spooled events are replayed per drain, so
+// a large backlog does not stall processing of new events.
+const spoolDrainBatch = 200
+
+// drainSpool replays spooled events while the controller accepts them.
+// A spooled event the controller rejects outright is dropped so it cannot
+// block the rest of the spool.
+func (ec *EventCollector) drainSpool(ctx context.Context) {
+	if ec.spool == nil || !ec.spool.pending() {
+		return
+	}
+	replayed := 0
+	_, err := ec.spool.drain(spoolDrainBatch, func(eventJSON []byte) error {
+		err := ec.sendEvent(ctx, eventJSON)
+		var se *statusError
+		switch {
+		case errors.As(err, &se) && !se.retryable():
+			ec.eventsDropped++
+			return nil
+		case err != nil:
+			return err
+		}
 		ec.eventsSent++
+		replayed++
+		return nil
+	})
+	if replayed > 0 {
+		ec.log.WithField("events", replayed).Info("Replayed spooled events")
+	}
+	if err != nil && !errors.Is(err, errCircuitOpen) {
+		ec.log.WithError(err).Debug("Spool replay stopped")
 	}
 }
 
@@ -269,6 +479,9 @@ func (ec *EventCollector) logEvent(event SecurityEvent) {
 		if event.File.OldHash != "" && event.File.NewHash != "" {
 			fields["hash_changed"] = event.File.OldHash != event.File.NewHash
 		}
+		if len(event.File.Indicators) > 0 {
+			fields["file_indicators"] = event.File.Indicators
+		}
 
 	case event.DNS != nil:
 		fields["dns_query"] = event.DNS.QueryName
@@ -290,58 +503,132 @@ func (ec *EventCollector) logEvent(event SecurityEvent) {
 	}
 }
 
-// sendEvent sends an event to the controller via HTTP
-func (ec *EventCollector) sendEvent(ctx context.Context, event SecurityEvent) error {
+// sendEvent sends an encoded event to the controller via HTTP
+func (ec *EventCollector) sendEvent(ctx context.Context, eventJSON []byte) error {
 	if ec.cfg.ControllerEndpoint == "" {
 		return fmt.Errorf("controller endpoint not configured")
 	}
 
-	// Convert event to JSON for HTTP API
-	eventJSON, err := ec.eventToJSON(event)
+	status, err := ec.postJSON(ctx, "/api/v1/events", eventJSON)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return err
 	}
+	if status != http.StatusAccepted {
+		return &statusError{code: status}
+	}
+
+	return nil
+}
+
+// statusError is an unexpected controller response status
+type statusError struct {
+	code int
+}
 
-	// Build HTTP request
-	url := fmt.Sprintf("http://%s/api/v1/events", ec.cfg.ControllerEndpoint)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(eventJSON))
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
+
+// retryable reports whether the request may succeed if sent again later:
+// server errors and throttling, as opposed to a rejected request
+func (e *statusError) retryable() bool {
+	return e.code >= 500 || e.code == http.StatusTooManyRequests
+}
+
+// postJSON POSTs a JSON body to the controller and returns the response status.
+// Requests to a path whose circuit is open fail immediately with errCircuitOpen.
+func (ec *EventCollector) postJSON(ctx context.Context, path string, body []byte) (int, error) {
+	return ec.post(ctx, path, body, nil)
+}
+
+// post is postJSON decoding a JSON response into out, when not nil
+func (ec *EventCollector) post(ctx context.Context, path string, body []byte, out interface{}) (int, error) {
+	b := ec.breakerFor(path)
+	if !b.Allow() {
+		return 0, errCircuitOpen
+	}
+	status, err := ec.doPost(ctx, path, body, out)
+	ok := err == nil && status < 500 && status != http.StatusTooManyRequests
+	if from, to := b.Record(ok); from != to {
+		entry := ec.log.WithFields(logrus.Fields{"path": path, "circuit": to.String()})
+		switch to {
+		case breaker.Open:
+			entry.WithError(err).Warnf("Controller unreachable, pausing sends for %s", ec.cfg.BreakerCooldown)
+		case breaker.Closed:
+			entry.Info("Controller reachable again, resuming sends")
+		}
+	}
+	return status, err
+}
+
+// errCircuitOpen is returned without contacting the controller while a
+// destination's breaker is open.
+var errCircuitOpen = errors.New("circuit open: controller unreachable, not sending")
+
+func (ec *EventCollector) breakerFor(path string) *breaker.Breaker {
+	ec.breakersMu.Lock()
+	defer ec.breakersMu.Unlock()
+	b, ok := ec.breakers[path]
+	if !ok {
+		b = breaker.New(ec.cfg.BreakerThreshold, ec.cfg.BreakerCooldown)
+		ec.breakers[path] = b
+	}
+	return b
+}
+
+func (ec *EventCollector) doPost(ctx context.Context, path string, body []byte, out interface{}) (int, error) {
+	url := ec.baseURL() + path
+	body, encoding := ec.encodeBody(path, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if ec.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ec.cfg.AuthToken)
+	}
 
-	// Send request
 	resp, err := ec.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return 0, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if out != nil {
+		// An error response may have no JSON body
+		json.NewDecoder(resp.Body).Decode(out)
 	}
-
-	return nil
+	return resp.StatusCode, nil
 }
 
 // eventToJSON converts SecurityEvent to JSON format expected by controller
 func (ec *EventCollector) eventToJSON(event SecurityEvent) ([]byte, error) {
 	// Map internal event types to controller's expected format
 	type ControllerEvent struct {
+		SchemaVersion string                `json:"schema_version"`
 		ID           string                 `json:"id"`
 		AgentID      string                 `json:"agent_id"`
 		Type         string                 `json:"type"`
 		Severity     string                 `json:"severity"`
 		Timestamp    time.Time              `json:"timestamp"`
+		OccurredAt   *time.Time             `json:"occurred_at,omitempty"`
 		PodName      string                 `json:"pod_name"`
 		PodNamespace string                 `json:"pod_namespace"`
 		Process      interface{}            `json:"process,omitempty"`
 		Network      interface{}            `json:"network,omitempty"`
 		File         interface{}            `json:"file,omitempty"`
+		Resource     interface{}            `json:"resource,omitempty"`
 		Metadata     map[string]interface{} `json:"metadata,omitempty"`
+		Identity     *Identity              `json:"identity,omitempty"`
+		ClusterName  string                 `json:"cluster_name,omitempty"`
+		Environment  string                 `json:"environment,omitempty"`
 	}
 
 	ce := ControllerEvent{
+		SchemaVersion: SchemaVersion,
 		ID:           event.ID,
 		AgentID:      ec.cfg.AgentID,
 		Type:         eventTypeToString(event.Type),
@@ -350,27 +637,56 @@ func (ec *EventCollector) eventToJSON(event SecurityEvent) ([]byte, error) {
 		PodName:      event.PodName,
 		PodNamespace: event.PodNamespace,
 		Metadata:     make(map[string]interface{}),
+		Identity:     ec.podIdentity(),
+		ClusterName:  ec.cfg.ClusterName,
+		Environment:  ec.cfg.Environment,
+	}
+	if !event.OccurredAt.IsZero() {
+		ce.OccurredAt = &event.OccurredAt
 	}
 
 	// Convert metadata
 	for k, v := range event.Metadata {
 		ce.Metadata[k] = v
 	}
+	if ec.cfg.DegradedMode {
+		ce.Metadata["monitoring_mode"] = "degraded"
+	}
 
 	// Add event-specific data
 	if event.Process != nil {
-		ce.Process = map[string]interface{}{
+		process := map[string]interface{}{
 			"pid":                   event.Process.PID,
 			"ppid":                  event.Process.PPID,
 			"name":                  event.Process.Name,
+			"exe_path":              event.Process.ExePath,
+			"uid":                   event.Process.UID,
 			"cmdline":               event.Process.Cmdline,
 			"suspicious_indicators": event.Process.SuspiciousIndicators,
 		}
+		if event.Process.ExeHash != "" {
+			process["exe_hash"] = event.Process.ExeHash
+		}
+		if len(event.Process.Ancestors) > 0 {
+			process["ancestors"] = event.Process.Ancestors
+		}
+		if len(event.Process.Environment) > 0 {
+			process["environment"] = event.Process.Environment
+		}
+		if event.Process.CPUPercent > 0 {
+			process["cpu_percent"] = event.Process.CPUPercent
+		}
+		if event.Process.MemoryBytes > 0 {
+			process["memory_bytes"] = event.Process.MemoryBytes
+		}
+		ce.Process = process
 	}
 
 	if event.Network != nil {
 		ce.Network = map[string]interface{}{
 			"protocol":          event.Network.Protocol,
+			"src_ip":            event.Network.SrcIP,
+			"src_port":          event.Network.SrcPort,
 			"dst_ip":            event.Network.DstIP,
 			"dst_port":           event.Network.DstPort,
 			"state":             event.Network.State,
@@ -380,12 +696,58 @@ func (ec *EventCollector) eventToJSON(event SecurityEvent) ([]byte, error) {
 	}
 
 	if event.File != nil {
-		ce.File = map[string]interface{}{
+		file := map[string]interface{}{
 			"path":      event.File.Path,
 			"operation": event.File.Operation,
 			"old_hash":  event.File.OldHash,
 			"new_hash":  event.File.NewHash,
 		}
+		if !event.File.OldModTime.IsZero() && !event.File.NewModTime.IsZero() {
+			file["old_mtime"] = event.File.OldModTime
+			file["new_mtime"] = event.File.NewModTime
+		}
+		if event.File.Permissions != "" {
+			file["mode"] = event.File.Permissions
+		}
+		if event.File.OldPermissions != "" {
+			file["old_mode"] = event.File.OldPermissions
+		}
+		if o := event.File.Owner; o != nil {
+			file["uid"], file["gid"] = o.UID, o.GID
+		}
+		if o := event.File.OldOwner; o != nil {
+			file["old_uid"], file["old_gid"] = o.UID, o.GID
+		}
+		if len(event.File.Indicators) > 0 {
+			file["indicators"] = event.File.Indicators
+		}
+		if len(event.File.YaraRules) > 0 {
+			file["yara_rules"] = event.File.YaraRules
+		}
+		if event.File.PID != 0 {
+			file["pid"] = event.File.PID
+			file["process_name"] = event.File.ProcessName
+		}
+		ce.File = file
+	}
+
+	if event.Resource != nil {
+		ce.Resource = map[string]interface{}{
+			"anomaly_type":     event.Resource.AnomalyType,
+			"anomaly_score":    event.Resource.AnomalyScore,
+			"cpu_percent":      event.Resource.CPUPercent,
+			"memory_bytes":     event.Resource.MemoryBytes,
+			"path":             event.Resource.Path,
+			"disk_write_bytes": event.Resource.DiskWriteBytes,
+			"file_count_delta": event.Resource.FileCountDelta,
+			"top_paths":        event.Resource.TopPaths,
+			"inodes_used":      event.Resource.InodesUsed,
+			"inodes_total":     event.Resource.InodesTotal,
+			"pid":              event.Resource.PID,
+			"process_name":     event.Resource.ProcessName,
+			"open_fds":         event.Resource.OpenFDs,
+			"fd_limit":         event.Resource.FDLimit,
+		}
 	}
 
 	return json.Marshal(ce)
@@ -410,6 +772,8 @@ func eventTypeToString(et EventType) string {
 		return "file_delete"
 	case EventTypeFileAccess:
 		return "file_access"
+	case EventTypeResourceAnomaly:
+		return "resource_anomaly"
 	default:
 		return "unknown"
 	}
@@ -1,16 +1,21 @@
 package collector
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/shard"
 )
 
 func TestNew(t *testing.T) {
@@ -150,6 +155,289 @@ func TestCollector_SendEvent(t *testing.T) {
 	}
 }
 
+func TestEventToJSON_SchemaV2Fields(t *testing.T) {
+	ec, _ := New(Config{AgentID: "a"}, logrus.New())
+	data, err := ec.eventToJSON(SecurityEvent{
+		Type:    EventTypeNetworkConnect,
+		Network: &NetworkEvent{Protocol: "tcp", SrcIP: "10.0.0.1", SrcPort: 5555, DstIP: "1.2.3.4", DstPort: 443},
+	})
+	if err != nil {
+		t.Fatalf("eventToJSON: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got["schema_version"] != SchemaVersion {
+		t.Errorf("schema_version = %v, want %q", got["schema_version"], SchemaVersion)
+	}
+	network, _ := got["network"].(map[string]interface{})
+	if network["src_ip"] != "10.0.0.1" || network["src_port"] != float64(5555) {
+		t.Errorf("network src fields: %v", network)
+	}
+}
+
+func TestEventToJSON_OccurredAt(t *testing.T) {
+	ec, _ := New(Config{AgentID: "a"}, logrus.New())
+	observed := time.Date(2024, 5, 1, 12, 0, 10, 0, time.UTC)
+	for _, tc := range []struct {
+		occurred time.Time
+		want     string
+	}{
+		{observed.Add(-9 * time.Second), "2024-05-01T12:00:01Z"},
+		{time.Time{}, ""},
+	} {
+		data, err := ec.eventToJSON(SecurityEvent{Type: EventTypeProcessStart, Timestamp: observed, OccurredAt: tc.occurred})
+		if err != nil {
+			t.Fatalf("eventToJSON: %v", err)
+		}
+		var got struct {
+			Timestamp  string `json:"timestamp"`
+			OccurredAt string `json:"occurred_at"`
+		}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if got.Timestamp != "2024-05-01T12:00:10Z" || got.OccurredAt != tc.want {
+			t.Errorf("timestamp = %q occurred_at = %q, want occurred_at %q", got.Timestamp, got.OccurredAt, tc.want)
+		}
+	}
+}
+
+func TestEventToJSON_Resource(t *testing.T) {
+	ec, _ := New(Config{AgentID: "a"}, logrus.New())
+	data, err := ec.eventToJSON(SecurityEvent{
+		Type: EventTypeResourceAnomaly,
+		Resource: &ResourceEvent{
+			AnomalyType:    "disk_growth",
+			Path:           "/tmp",
+			DiskWriteBytes: 1 << 30,
+			TopPaths:       []PathUsage{{Path: "/tmp/x", GrowthBytes: 1 << 30, GrowthFiles: 3}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("eventToJSON: %v", err)
+	}
+	var got struct {
+		Type     string `json:"type"`
+		Resource struct {
+			AnomalyType string      `json:"anomaly_type"`
+			Path        string      `json:"path"`
+			TopPaths    []PathUsage `json:"top_paths"`
+		} `json:"resource"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Type != "resource_anomaly" || got.Resource.AnomalyType != "disk_growth" || got.Resource.Path != "/tmp" {
+		t.Errorf("event = %+v", got)
+	}
+	if len(got.Resource.TopPaths) != 1 || got.Resource.TopPaths[0].GrowthFiles != 3 {
+		t.Errorf("top_paths = %+v", got.Resource.TopPaths)
+	}
+}
+
+func TestEventToJSON_FileIndicators(t *testing.T) {
+	ec, _ := New(Config{AgentID: "a"}, logrus.New())
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data, err := ec.eventToJSON(SecurityEvent{
+		Type: EventTypeFileModify,
+		File: &FileEvent{
+			Path: "/etc/passwd", Operation: "chmod", OldHash: "a", NewHash: "b",
+			OldModTime: mtime, NewModTime: mtime, Indicators: []string{"timestomp"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("eventToJSON: %v", err)
+	}
+	var got struct {
+		File struct {
+			NewModTime *time.Time `json:"new_mtime"`
+			Indicators []string   `json:"indicators"`
+		} `json:"file"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.File.NewModTime == nil || !got.File.NewModTime.Equal(mtime) || len(got.File.Indicators) != 1 {
+		t.Errorf("file = %+v", got.File)
+	}
+}
+
+func TestEventToJSON_ProcessAncestors(t *testing.T) {
+	ec, _ := New(Config{AgentID: "a"}, logrus.New())
+	data, err := ec.eventToJSON(SecurityEvent{
+		Type: EventTypeProcessStart,
+		Process: &ProcessEvent{
+			PID: 30, PPID: 20, Name: "curl",
+			Ancestors:   []ProcessAncestor{{PID: 20, Name: "sh", Cmdline: []string{"sh", "-c", "curl x"}}, {PID: 1, Name: "nginx"}},
+			Environment: map[string]string{"LD_PRELOAD": "/tmp/x.so"},
+			CPUPercent:  92.5,
+			MemoryBytes: 4096,
+		},
+	})
+	if err != nil {
+		t.Fatalf("eventToJSON: %v", err)
+	}
+	var got struct {
+		Process struct {
+			Ancestors   []ProcessAncestor `json:"ancestors"`
+			Environment map[string]string `json:"environment"`
+			CPUPercent  float64           `json:"cpu_percent"`
+			MemoryBytes int64             `json:"memory_bytes"`
+		} `json:"process"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if a := got.Process.Ancestors; len(a) != 2 || a[0].Name != "sh" || len(a[0].Cmdline) != 3 || a[1].PID != 1 {
+		t.Errorf("ancestors = %+v", a)
+	}
+	if got.Process.Environment["LD_PRELOAD"] != "/tmp/x.so" {
+		t.Errorf("environment = %v", got.Process.Environment)
+	}
+	if got.Process.CPUPercent != 92.5 || got.Process.MemoryBytes != 4096 {
+		t.Errorf("cpu_percent = %v, memory_bytes = %v", got.Process.CPUPercent, got.Process.MemoryBytes)
+	}
+}
+
+func TestCollector_SendHeartbeat(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+	}
+	ln.Close()
+
+	var got Heartbeat
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if r.URL.Path != "/api/v1/agents/heartbeat" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ec, _ := New(Config{ControllerEndpoint: server.Listener.Addr().String(), AgentID: "agent-hb", AuthToken: "tok", Version: "1.2.3", ConfigHash: "abc"}, logrus.New())
+	if err := ec.SendHeartbeat(context.Background(), map[string]string{"procmon": "restarting"}, map[string]int{"procmon": 2}, 0); err != nil {
+		t.Fatalf("SendHeartbeat: %v", err)
+	}
+	if got.AgentID != "agent-hb" || got.MonitorCrashes["procmon"] != 2 || got.SchemaVersion != SchemaVersion {
+		t.Errorf("heartbeat = %+v", got)
+	}
+	if got.Version != "1.2.3" || got.ConfigHash != "abc" || got.Monitors["procmon"] != "restarting" {
+		t.Errorf("heartbeat identity/health = %+v", got)
+	}
+	if gotAuth != "Bearer tok" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+}
+
+func TestCollector_Register(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+	}
+	ln.Close()
+
+	var got Registration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/agents/register" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ec, _ := New(Config{ControllerEndpoint: server.Listener.Addr().String(), AgentID: "agent-reg", NodeName: "node-1", Version: "1.2.3", ConfigHash: "abc", DegradedMode: true, ServiceAccount: "api"}, logrus.New())
+	ec.ResolveIdentity(context.Background())
+	if err := ec.Register(context.Background(), []string{"netpolicy", "fileintegrity"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if got.AgentID != "agent-reg" || got.NodeName != "node-1" || got.Version != "1.2.3" || got.ConfigHash != "abc" {
+		t.Errorf("registration = %+v", got)
+	}
+	if got.MonitoringMode != "degraded" || len(got.Monitors) != 2 {
+		t.Errorf("registration mode/monitors = %+v", got)
+	}
+	if got.Identity == nil || got.Identity.ServiceAccount != "api" {
+		t.Errorf("registration identity = %+v, want service account api", got.Identity)
+	}
+}
+
+func TestCollector_FetchConfig(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+	}
+	ln.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/agents/agent-cfg/config" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"3"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"3"`)
+		w.Write([]byte(`{"revision":3,"suspicious_ports":[],"watch_paths":["/etc/shadow"]}`))
+	}))
+	defer server.Close()
+
+	ec, _ := New(Config{ControllerEndpoint: server.Listener.Addr().String(), AgentID: "agent-cfg"}, logrus.New())
+	rc, etag, err := ec.FetchConfig(context.Background(), "")
+	if err != nil {
+		t.Fatalf("FetchConfig: %v", err)
+	}
+	if rc == nil || rc.Revision != 3 || etag != `"3"` {
+		t.Fatalf("config = %+v, etag %q", rc, etag)
+	}
+	if rc.SuspiciousPorts == nil || len(rc.SuspiciousPorts) != 0 || rc.SuspiciousProcesses != nil {
+		t.Errorf("empty list should clear and missing list should keep: %+v", rc)
+	}
+
+	rc, etag, err = ec.FetchConfig(context.Background(), etag)
+	if err != nil || rc != nil || etag != `"3"` {
+		t.Errorf("unchanged poll = %+v, %q, %v", rc, etag, err)
+	}
+}
+
+func TestCollector_FetchYaraRules(t *testing.T) {
+	rules := "yes"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/api/v1/agents/agent-y/yara" || rules == "":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("If-None-Match") == `"r1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"r1"`)
+			w.Write([]byte("rule a { condition: true }"))
+		}
+	}))
+	defer server.Close()
+
+	ec, _ := New(Config{ControllerEndpoint: server.Listener.Addr().String(), AgentID: "agent-y"}, logrus.New())
+	source, etag, err := ec.FetchYaraRules(context.Background(), "")
+	if err != nil || string(source) != "rule a { condition: true }" || etag != `"r1"` {
+		t.Fatalf("FetchYaraRules = %q, %q, %v", source, etag, err)
+	}
+	if source, etag, err = ec.FetchYaraRules(context.Background(), etag); err != nil || source != nil || etag != `"r1"` {
+		t.Errorf("unchanged poll = %q, %q, %v", source, etag, err)
+	}
+	rules = ""
+	if source, etag, err = ec.FetchYaraRules(context.Background(), etag); err != nil || source != nil || etag != "" {
+		t.Errorf("removed rules = %q, %q, %v", source, etag, err)
+	}
+}
+
 func TestGetStats(t *testing.T) {
 	log := logrus.New()
 	cfg := Config{
@@ -182,6 +470,7 @@ func TestEventTypeToString(t *testing.T) {
 		{EventTypeFileModify, "file_modify"},
 		{EventTypeFileDelete, "file_delete"},
 		{EventTypeFileAccess, "file_access"},
+		{EventTypeResourceAnomaly, "resource_anomaly"},
 		{EventTypeUnknown, "unknown"},
 		{EventType(99), "unknown"},
 	}
@@ -213,3 +502,195 @@ func TestSeverityToString(t *testing.T) {
 		}
 	}
 }
+
+func TestCollector_BreakerAndSpool(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		down     = true
+		attempts int
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var ev struct{ ID string }
+		json.NewDecoder(r.Body).Decode(&ev)
+		received = append(received, ev.ID)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	ec, err := New(Config{
+		ControllerEndpoint: server.Listener.Addr().String(),
+		AgentID:            "a",
+		BreakerThreshold:   2,
+		BreakerCooldown:    time.Hour,
+		SpoolDir:           t.TempDir(),
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Now()
+	ec.breakerFor("/api/v1/events").Now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for _, id := range []string{"ev-1", "ev-2", "ev-3", "ev-4"} {
+		ec.processEvent(ctx, SecurityEvent{ID: id, Type: EventTypeProcessStart, Process: &ProcessEvent{Name: "sh"}})
+	}
+	mu.Lock()
+	if attempts != 2 {
+		t.Errorf("controller saw %d attempts, want 2 before the circuit opened", attempts)
+	}
+	down = false
+	mu.Unlock()
+	if sent, dropped := ec.GetStats(); sent != 0 || dropped != 0 || !ec.spool.pending() {
+		t.Fatalf("sent=%d dropped=%d pending=%v, want all four spooled", sent, dropped, ec.spool.pending())
+	}
+
+	// After the cooldown the probe succeeds and the backlog is replayed.
+	now = now.Add(time.Hour)
+	ec.processEvent(ctx, SecurityEvent{ID: "ev-5", Type: EventTypeProcessStart, Process: &ProcessEvent{Name: "sh"}})
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"ev-5", "ev-1", "ev-2", "ev-3", "ev-4"}
+	if len(received) != len(want) {
+		t.Fatalf("received %v, want %v", received, want)
+	}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Fatalf("received %v, want %v", received, want)
+		}
+	}
+	if sent, _ := ec.GetStats(); sent != 5 || ec.spool.pending() {
+		t.Errorf("sent=%d pending=%v", sent, ec.spool.pending())
+	}
+}
+
+func TestCollector_RejectedEventNotSpooled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	ec, err := New(Config{ControllerEndpoint: server.Listener.Addr().String(), AgentID: "a", BreakerThreshold: 1, SpoolDir: t.TempDir()}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ec.processEvent(context.Background(), SecurityEvent{ID: "ev-1"})
+	ec.processEvent(context.Background(), SecurityEvent{ID: "ev-2"})
+	if _, dropped := ec.GetStats(); dropped != 2 || ec.spool.pending() {
+		t.Errorf("dropped=%d pending=%v, want rejected events dropped", dropped, ec.spool.pending())
+	}
+	if !ec.breakerFor("/api/v1/events").Allow() {
+		t.Error("4xx responses should not open the circuit")
+	}
+}
+
+func TestCollector_FetchRouting(t *testing.T) {
+	var replicaEvents int
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replicaEvents++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer replica.Close()
+	sharded := true
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/routing" && sharded:
+			json.NewEncoder(w).Encode(shard.NewTable([]shard.Member{{Name: "controller-a", Address: replica.URL}}))
+		case r.URL.Path == "/api/v1/routing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer service.Close()
+
+	ec, _ := New(Config{ControllerEndpoint: service.Listener.Addr().String(), AgentID: "agent-r"}, logrus.New())
+	route, changed, err := ec.FetchRouting(context.Background())
+	if err != nil || route != replica.URL || !changed {
+		t.Fatalf("FetchRouting = %q, %v, %v", route, changed, err)
+	}
+	if err := ec.sendEvent(context.Background(), []byte(`{}`)); err != nil || replicaEvents != 1 {
+		t.Errorf("event not sent to the replica: %v, %d", err, replicaEvents)
+	}
+	if _, changed, _ := ec.FetchRouting(context.Background()); changed {
+		t.Error("unchanged table reported as changed")
+	}
+
+	// A controller that stops sharding gets requests on its Service again.
+	sharded = false
+	if route, changed, err := ec.FetchRouting(context.Background()); err != nil || route != "" || !changed {
+		t.Fatalf("unsharded FetchRouting = %q, %v, %v", route, changed, err)
+	}
+	if err := ec.sendEvent(context.Background(), []byte(`{}`)); err != nil || replicaEvents != 1 {
+		t.Errorf("event sent to the replica: %v, %d", err, replicaEvents)
+	}
+}
+
+func TestCollector_Handshake(t *testing.T) {
+	var (
+		legacy    bool
+		encodings []string
+		batches   [][]json.RawMessage
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/agents/handshake" && legacy:
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/api/v1/agents/handshake":
+			var h Handshake
+			json.NewDecoder(r.Body).Decode(&h)
+			json.NewEncoder(w).Encode(Protocol{Version: 2, SchemaVersion: "v2", Capabilities: h.Capabilities, MaxBatchEvents: 3})
+		case r.URL.Path == "/api/v1/events/batch":
+			encodings = append(encodings, r.Header.Get("Content-Encoding"))
+			body := io.Reader(r.Body)
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				body, _ = gzip.NewReader(r.Body)
+			}
+			var batch []json.RawMessage
+			json.NewDecoder(body).Decode(&batch)
+			batches = append(batches, batch)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	ec, _ := New(Config{ControllerEndpoint: server.Listener.Addr().String(), AgentID: "a"}, logrus.New())
+	ctx := context.Background()
+	p, err := ec.Handshake(ctx)
+	if err != nil || p == nil || !p.Has(CapabilityBatch) || !p.Has(CapabilityGzip) {
+		t.Fatalf("Handshake = %+v, %v", p, err)
+	}
+	// The controller's limit of 3 events sends the first batch; the rest is
+	// sent on flush.
+	for i := 0; i < 4; i++ {
+		ec.processEvent(ctx, SecurityEvent{Type: EventTypeProcessStart, Process: &ProcessEvent{Name: "sh", Cmdline: []string{strings.Repeat("x", 500)}}})
+	}
+	ec.flushBatch(ctx)
+	if len(batches) != 2 || len(batches[0]) != 3 || len(batches[1]) != 1 {
+		t.Fatalf("batches = %d", len(batches))
+	}
+	if encodings[0] != "gzip" {
+		t.Errorf("large batch sent with Content-Encoding %q", encodings[0])
+	}
+	if sent, _ := ec.GetStats(); sent != 4 {
+		t.Errorf("sent = %d", sent)
+	}
+
+	// A controller without the handshake gets single events again.
+	legacy = true
+	if p, err := ec.Handshake(ctx); p != nil || err != nil {
+		t.Fatalf("legacy Handshake = %+v, %v", p, err)
+	}
+	ec.processEvent(ctx, SecurityEvent{Type: EventTypeProcessStart})
+	if sent, _ := ec.GetStats(); sent != 5 || len(batches) != 2 {
+		t.Errorf("sent = %d, batches = %d", sent, len(batches))
+	}
+}
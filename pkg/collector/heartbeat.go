@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Registration is sent once at agent startup so the controller knows the
+// agent exists before it produces any events
+type Registration struct {
+	AgentID        string    `json:"agent_id"`
+	PodName        string    `json:"pod_name"`
+	PodNamespace   string    `json:"pod_namespace"`
+	NodeName       string    `json:"node_name,omitempty"`
+	PodIP          string    `json:"pod_ip,omitempty"`
+	Version        string    `json:"version"`
+	ConfigHash     string    `json:"config_hash"`
+	SchemaVersion  string    `json:"schema_version"`
+	MonitoringMode string    `json:"monitoring_mode,omitempty"`
+	Monitors       []string  `json:"monitors,omitempty"`
+	Identity       *Identity `json:"identity,omitempty"`
+	ClusterName    string    `json:"cluster_name,omitempty"`
+	Environment    string    `json:"environment,omitempty"`
+}
+
+// Heartbeat is the periodic agent liveness report sent to the controller
+type Heartbeat struct {
+	AgentID        string            `json:"agent_id"`
+	PodName        string            `json:"pod_name"`
+	PodNamespace   string            `json:"pod_namespace"`
+	PodIP          string            `json:"pod_ip,omitempty"`
+	Timestamp      time.Time         `json:"timestamp"`
+	Version        string            `json:"version,omitempty"`
+	ConfigHash     string            `json:"config_hash,omitempty"`
+	ConfigRevision int64             `json:"config_revision,omitempty"`
+	SchemaVersion  string            `json:"schema_version"`
+	Monitors       map[string]string `json:"monitors,omitempty"`
+	MonitorCrashes map[string]int    `json:"monitor_crashes,omitempty"`
+}
+
+// Register announces the agent and the monitors it runs to the controller
+func (ec *EventCollector) Register(ctx context.Context, monitors []string) error {
+	mode := ""
+	if ec.cfg.DegradedMode {
+		mode = "degraded"
+	}
+	return ec.sendAgentReport(ctx, "/api/v1/agents/register", Registration{
+		AgentID:        ec.cfg.AgentID,
+		PodName:        ec.cfg.PodName,
+		PodNamespace:   ec.cfg.PodNamespace,
+		NodeName:       ec.cfg.NodeName,
+		PodIP:          ec.cfg.PodIP,
+		Version:        ec.cfg.Version,
+		ConfigHash:     ec.configHash(),
+		SchemaVersion:  SchemaVersion,
+		MonitoringMode: mode,
+		Monitors:       monitors,
+		Identity:       ec.podIdentity(),
+		ClusterName:    ec.cfg.ClusterName,
+		Environment:    ec.cfg.Environment,
+	})
+}
+
+// SendHeartbeat reports agent liveness, per-monitor state, crash counts and
+// the applied pushed-config revision to the controller
+func (ec *EventCollector) SendHeartbeat(ctx context.Context, monitors map[string]string, monitorCrashes map[string]int, configRevision int64) error {
+	return ec.sendAgentReport(ctx, "/api/v1/agents/heartbeat", Heartbeat{
+		AgentID:        ec.cfg.AgentID,
+		PodName:        ec.cfg.PodName,
+		PodNamespace:   ec.cfg.PodNamespace,
+		PodIP:          ec.cfg.PodIP,
+		Timestamp:      time.Now(),
+		Version:        ec.cfg.Version,
+		ConfigHash:     ec.configHash(),
+		ConfigRevision: configRevision,
+		SchemaVersion:  SchemaVersion,
+		Monitors:       monitors,
+		MonitorCrashes: monitorCrashes,
+	})
+}
+
+func (ec *EventCollector) sendAgentReport(ctx context.Context, path string, report interface{}) error {
+	if ec.cfg.ControllerEndpoint == "" {
+		return fmt.Errorf("controller endpoint not configured")
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal agent report: %w", err)
+	}
+
+	status, err := ec.postJSON(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("unexpected status code: %d", status)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// identityTimeout bounds resolving the pod identity at startup, so an
+// unreachable metadata server delays the agent by seconds at most.
+const identityTimeout = 5 * time.Second
+
+// Identity is the Kubernetes and cloud identity the pod runs as. It is sent
+// with registration and every event.
+type Identity struct {
+	ServiceAccount    string `json:"service_account,omitempty"`
+	GCPServiceAccount string `json:"gcp_service_account,omitempty"`
+}
+
+// IdentityResolver fills in the parts of a pod's identity it can discover,
+// such as a cloud service account from a metadata server.
+type IdentityResolver interface {
+	ResolveIdentity(ctx context.Context, id *Identity) error
+}
+
+// GKEMetadataResolver reads the Google service account bound to the pod's
+// ServiceAccount through GKE Workload Identity.
+type GKEMetadataResolver struct {
+	// Host is the metadata server address. Empty uses GCE_METADATA_HOST, as
+	// Google client libraries do, or metadata.google.internal.
+	Host   string
+	Client *http.Client
+}
+
+// ResolveIdentity sets GCPServiceAccount when the metadata server reports a
+// Google service account. Pods whose ServiceAccount is not bound get the
+// workload pool name instead, which is ignored.
+func (r GKEMetadataResolver) ResolveIdentity(ctx context.Context, id *Identity) error {
+	host := r.Host
+	if host == "" {
+		host = os.Getenv("GCE_METADATA_HOST")
+	}
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	url := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/email"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("metadata server unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("metadata server returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return fmt.Errorf("failed to read service account email: %w", err)
+	}
+	if email := strings.TrimSpace(string(body)); strings.HasSuffix(email, ".gserviceaccount.com") {
+		id.GCPServiceAccount = email
+	}
+	return nil
+}
+
+// ResolveIdentity works out the pod identity from the configured
+// ServiceAccount and IdentityResolvers. It is called once at startup; a
+// resolver that fails leaves its part of the identity empty.
+func (ec *EventCollector) ResolveIdentity(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, identityTimeout)
+	defer cancel()
+
+	id := Identity{ServiceAccount: ec.cfg.ServiceAccount}
+	for _, r := range ec.cfg.IdentityResolvers {
+		if err := r.ResolveIdentity(ctx, &id); err != nil {
+			ec.log.WithError(err).Debug("Failed to resolve pod identity")
+		}
+	}
+	if id == (Identity{}) {
+		return
+	}
+
+	ec.mu.Lock()
+	ec.identity = &id
+	ec.mu.Unlock()
+	ec.log.WithFields(logrus.Fields{
+		"service_account":     id.ServiceAccount,
+		"gcp_service_account": id.GCPServiceAccount,
+	}).Info("Resolved pod identity")
+}
+
+// podIdentity returns the resolved identity, or nil if there is none.
+func (ec *EventCollector) podIdentity() *Identity {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.identity
+}
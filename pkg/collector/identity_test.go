@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// metadataServer serves email as the default service account, like the GKE
+// metadata server.
+func metadataServer(t *testing.T, email string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+	}
+	ln.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/email" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(email))
+	}))
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+func TestGKEMetadataResolver(t *testing.T) {
+	tests := map[string]string{
+		"api@proj.iam.gserviceaccount.com": "api@proj.iam.gserviceaccount.com",
+		// Unbound ServiceAccounts get the workload pool, not an account.
+		"proj.svc.id.goog": "",
+	}
+	for email, want := range tests {
+		var id Identity
+		if err := (GKEMetadataResolver{Host: metadataServer(t, email)}).ResolveIdentity(context.Background(), &id); err != nil {
+			t.Fatalf("ResolveIdentity(%s): %v", email, err)
+		}
+		if id.GCPServiceAccount != want {
+			t.Errorf("metadata email %q: GCPServiceAccount = %q, want %q", email, id.GCPServiceAccount, want)
+		}
+	}
+}
+
+func TestGKEMetadataResolver_HostFromEnv(t *testing.T) {
+	t.Setenv("GCE_METADATA_HOST", metadataServer(t, "api@proj.iam.gserviceaccount.com"))
+	var id Identity
+	if err := (GKEMetadataResolver{}).ResolveIdentity(context.Background(), &id); err != nil || id.GCPServiceAccount == "" {
+		t.Errorf("ResolveIdentity = %+v, %v; want the account from GCE_METADATA_HOST", id, err)
+	}
+}
+
+type failingResolver struct{}
+
+func (failingResolver) ResolveIdentity(context.Context, *Identity) error {
+	return errors.New("no metadata server")
+}
+
+func TestCollector_ResolveIdentity(t *testing.T) {
+	ec, _ := New(Config{AgentID: "a"}, logrus.New())
+	ec.ResolveIdentity(context.Background())
+	if id := ec.podIdentity(); id != nil {
+		t.Errorf("identity with nothing configured = %+v, want nil", id)
+	}
+
+	ec, _ = New(Config{
+		AgentID:           "a",
+		ServiceAccount:    "api",
+		IdentityResolvers: []IdentityResolver{failingResolver{}, GKEMetadataResolver{Host: metadataServer(t, "api@proj.iam.gserviceaccount.com")}},
+	}, logrus.New())
+	ec.ResolveIdentity(context.Background())
+	data, err := ec.eventToJSON(SecurityEvent{Type: EventTypeProcessStart})
+	if err != nil {
+		t.Fatalf("eventToJSON: %v", err)
+	}
+	var got struct{ Identity *Identity }
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := Identity{ServiceAccount: "api", GCPServiceAccount: "api@proj.iam.gserviceaccount.com"}
+	if got.Identity == nil || *got.Identity != want {
+		t.Errorf("event identity = %+v, want %+v", got.Identity, want)
+	}
+}
@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ProtocolVersion is the newest agent-to-controller protocol this collector
+// speaks. Protocol 1 posts single uncompressed events and is used with
+// controllers that do not answer the handshake.
+const ProtocolVersion = 2
+
+// Capabilities this collector offers in the handshake
+const (
+	CapabilityBatch = "batch"
+	CapabilityGzip  = "gzip"
+)
+
+const (
+	// maxBatchEvents bounds a batch when the controller sets no limit
+	maxBatchEvents = 500
+	// batchFlushInterval is the longest an event waits in a batch
+	batchFlushInterval = time.Second
+	// gzipMinBytes is the smallest body worth compressing
+	gzipMinBytes = 1024
+)
+
+// ErrIncompatibleController is returned by Handshake when the controller
+// shares no protocol version with this agent
+var ErrIncompatibleController = errors.New("controller is incompatible with this agent")
+
+// Handshake tells the controller which protocols, schemas and capabilities
+// the agent supports
+type Handshake struct {
+	AgentID          string   `json:"agent_id"`
+	Version          string   `json:"version,omitempty"`
+	ProtocolVersions []int    `json:"protocol_versions"`
+	SchemaVersions   []string `json:"schema_versions"`
+	Capabilities     []string `json:"capabilities"`
+}
+
+// Protocol is what the controller told the agent to use in the handshake
+type Protocol struct {
+	Version         int      `json:"protocol_version"`
+	SchemaVersion   string   `json:"schema_version"`
+	Capabilities    []string `json:"capabilities"`
+	MaxBatchEvents  int      `json:"max_batch_events,omitempty"`
+	MaxRequestBytes int64    `json:"max_request_bytes,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// Has reports whether the controller granted capability; nothing is granted
+// under protocol 1
+func (p *Protocol) Has(capability string) bool {
+	if p == nil {
+		return false
+	}
+	for _, c := range p.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Handshake negotiates the protocol with the controller and uses it for
+// every later request. It returns nil, speaking protocol 1, when the
+// controller predates the handshake, and ErrIncompatibleController when it
+// shares no protocol with this agent. A failed request keeps the protocol
+// in use.
+func (ec *EventCollector) Handshake(ctx context.Context) (*Protocol, error) {
+	if ec.cfg.ControllerEndpoint == "" {
+		return nil, fmt.Errorf("controller endpoint not configured")
+	}
+	body, err := json.Marshal(Handshake{
+		AgentID:          ec.cfg.AgentID,
+		Version:          ec.cfg.Version,
+		ProtocolVersions: []int{1, ProtocolVersion},
+		SchemaVersions:   []string{SchemaVersion},
+		Capabilities:     []string{CapabilityBatch, CapabilityGzip},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal handshake: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ec.baseURL()+"/api/v1/agents/handshake", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ec.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ec.cfg.AuthToken)
+	}
+
+	resp, err := ec.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var p *Protocol
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+	case http.StatusOK, http.StatusConflict:
+		p = &Protocol{}
+		if err := json.NewDecoder(resp.Body).Decode(p); err != nil {
+			return nil, fmt.Errorf("failed to decode handshake: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if p != nil && p.Error != "" {
+		err = fmt.Errorf("%w: %s", ErrIncompatibleController, p.Error)
+		p = nil
+	}
+	ec.mu.Lock()
+	ec.protocol = p
+	ec.mu.Unlock()
+	return p, err
+}
+
+// negotiated is the protocol in use, nil for protocol 1
+func (ec *EventCollector) negotiated() *Protocol {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.protocol
+}
+
+// batchEvent adds an event to the pending batch, sending the batch once it
+// reaches the controller's limits
+func (ec *EventCollector) batchEvent(ctx context.Context, p *Protocol, eventJSON []byte) {
+	limit := maxBatchEvents
+	if p.MaxBatchEvents > 0 && p.MaxBatchEvents < limit {
+		limit = p.MaxBatchEvents
+	}
+	// The array brackets and commas, and the event, must fit too
+	if maxBytes := p.MaxRequestBytes; maxBytes > 0 && int64(ec.pendingBytes+len(ec.pending)+len(eventJSON)+2) > maxBytes {
+		ec.flushBatch(ctx)
+	}
+	ec.pending = append(ec.pending, eventJSON)
+	ec.pendingBytes += len(eventJSON)
+	if len(ec.pending) >= limit {
+		ec.flushBatch(ctx)
+	}
+}
+
+// flushBatch sends the pending events as one batch. Events the controller
+// did not accept are spooled like events that failed to send alone.
+func (ec *EventCollector) flushBatch(ctx context.Context) {
+	if len(ec.pending) == 0 {
+		return
+	}
+	batch := ec.pending
+	ec.pending, ec.pendingBytes = nil, 0
+
+	accepted, err := ec.sendBatch(ctx, batch)
+	ec.eventsSent += int64(accepted)
+	for _, eventJSON := range batch[accepted:] {
+		ec.spoolEvent(eventJSON, err)
+	}
+	if err == nil {
+		ec.drainSpool(ctx)
+	}
+}
+
+// sendBatch posts events as a JSON array and returns how many the
+// controller accepted. A batch stopped part way keeps its first events.
+func (ec *EventCollector) sendBatch(ctx context.Context, batch [][]byte) (int, error) {
+	body := append(append([]byte{'['}, bytes.Join(batch, []byte{','})...), ']')
+	var res struct {
+		Accepted int    `json:"accepted"`
+		Error    string `json:"error"`
+	}
+	status, err := ec.post(ctx, "/api/v1/events/batch", body, &res)
+	if err != nil {
+		return 0, err
+	}
+	if status != http.StatusAccepted {
+		if res.Accepted < 0 || res.Accepted > len(batch) {
+			res.Accepted = 0
+		}
+		if res.Error != "" {
+			ec.log.WithField("status", status).Debugf("Controller stopped event batch: %s", res.Error)
+		}
+		return res.Accepted, &statusError{code: status}
+	}
+	return len(batch), nil
+}
+
+// spoolPending keeps the pending batch on shutdown, when it can no longer
+// be sent
+func (ec *EventCollector) spoolPending() {
+	for _, eventJSON := range ec.pending {
+		ec.spoolEvent(eventJSON, context.Canceled)
+	}
+	ec.pending, ec.pendingBytes = nil, 0
+}
+
+// encodeBody gzips a body for path when the controller granted gzip, which
+// covers the event endpoints only, and the body is large enough to gain
+// from it. It returns the Content-Encoding to send.
+func (ec *EventCollector) encodeBody(path string, body []byte) ([]byte, string) {
+	if !strings.HasPrefix(path, "/api/v1/events") || len(body) < gzipMinBytes || !ec.negotiated().Has(CapabilityGzip) {
+		return body, ""
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return body, ""
+	}
+	if err := zw.Close(); err != nil {
+		return body, ""
+	}
+	return buf.Bytes(), CapabilityGzip
+}
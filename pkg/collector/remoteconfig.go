@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RemoteConfig is detection config pushed by the controller. A nil list
+// means keep the local setting; an empty list clears it.
+type RemoteConfig struct {
+	Revision            int64    `json:"revision"`
+	SuspiciousProcesses []string `json:"suspicious_processes"`
+	WatchPaths          []string `json:"watch_paths"`
+	WatchExclude        []string `json:"watch_exclude"`
+	SuspiciousPorts     []int    `json:"suspicious_ports"`
+	ExeHashAllowlist    []string `json:"exe_hash_allowlist"`
+	ExeHashDenylist     []string `json:"exe_hash_denylist"`
+}
+
+// FetchConfig polls the controller for pushed config. etag is the ETag of
+// the last applied config; nil is returned with the same etag when nothing
+// changed or no config has been pushed.
+func (ec *EventCollector) FetchConfig(ctx context.Context, etag string) (*RemoteConfig, string, error) {
+	if ec.cfg.ControllerEndpoint == "" {
+		return nil, etag, fmt.Errorf("controller endpoint not configured")
+	}
+
+	u := fmt.Sprintf("%s/api/v1/agents/%s/config", ec.baseURL(), url.PathEscape(ec.cfg.AgentID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, etag, fmt.Errorf("failed to create request: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if ec.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ec.cfg.AuthToken)
+	}
+
+	resp, err := ec.httpClient.Do(req)
+	if err != nil {
+		return nil, etag, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified, http.StatusNotFound:
+		return nil, etag, nil
+	case http.StatusOK:
+	default:
+		return nil, etag, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var rc RemoteConfig
+	if err := json.NewDecoder(resp.Body).Decode(&rc); err != nil {
+		return nil, etag, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return &rc, resp.Header.Get("ETag"), nil
+}
+
+// SetConfigHash updates the config hash reported in heartbeats after the
+// agent applies pushed config.
+func (ec *EventCollector) SetConfigHash(hash string) {
+	ec.mu.Lock()
+	ec.cfg.ConfigHash = hash
+	ec.mu.Unlock()
+}
+
+func (ec *EventCollector) configHash() string {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.cfg.ConfigHash
+}
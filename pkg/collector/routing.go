@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/breaker"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/shard"
+)
+
+// FetchRouting reads the controller's routing table through
+// ControllerEndpoint and, when the controller shards agents between
+// replicas, sends every later request to the replica assigned to this
+// agent. It returns that replica's address, empty when the controller does
+// not shard agents, and whether it changed.
+func (ec *EventCollector) FetchRouting(ctx context.Context) (string, bool, error) {
+	if ec.cfg.ControllerEndpoint == "" {
+		return "", false, fmt.Errorf("controller endpoint not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+ec.cfg.ControllerEndpoint+"/api/v1/routing", nil)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create request: %w", err)
+	}
+	if ec.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ec.cfg.AuthToken)
+	}
+
+	resp, err := ec.httpClient.Do(req)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	route := ""
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+	case http.StatusOK:
+		var table shard.Table
+		if err := json.NewDecoder(resp.Body).Decode(&table); err != nil {
+			return "", false, fmt.Errorf("failed to decode routing table: %w", err)
+		}
+		// A table without replicas leaves requests on the Service.
+		if owner, ok := table.Owner(ec.cfg.AgentID); ok {
+			route = owner.Address
+		}
+	default:
+		return "", false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	ec.mu.Lock()
+	changed := route != ec.route
+	ec.route = route
+	ec.mu.Unlock()
+	if changed {
+		// Failures sending to the previous replica say nothing about
+		// the new one
+		ec.breakersMu.Lock()
+		ec.breakers = make(map[string]*breaker.Breaker)
+		ec.breakersMu.Unlock()
+	}
+	return route, changed, nil
+}
+
+// baseURL is where requests to the controller go: the replica the routing
+// table assigns this agent, or else ControllerEndpoint
+func (ec *EventCollector) baseURL() string {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	if ec.route != "" {
+		return ec.route
+	}
+	return "http://" + ec.cfg.ControllerEndpoint
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const spoolFile = "events.spool"
+
+// errSpoolFull is returned when a record would grow the spool past its limit.
+var errSpoolFull = errors.New("spool full")
+
+// spool is an append-only file of encoded events that could not be sent,
+// one JSON document per line, replayed once the controller is reachable.
+type spool struct {
+	path     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+// openSpool opens or creates the spool in dir, keeping anything left by a
+// previous run of the agent.
+func openSpool(dir string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	s := &spool{path: filepath.Join(dir, spoolFile), maxBytes: maxBytes}
+	if fi, err := os.Stat(s.path); err == nil {
+		s.size = fi.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// append adds one record to the end of the spool.
+func (s *spool) append(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := int64(len(record)) + 1
+	if s.maxBytes > 0 && s.size+n > s.maxBytes {
+		return errSpoolFull
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(record, '\n')); err != nil {
+		return err
+	}
+	s.size += n
+	return nil
+}
+
+// pending reports whether the spool holds any records.
+func (s *spool) pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size > 0
+}
+
+// drain sends up to max records, oldest first, stopping at the first send
+// error. Sent records are removed; the rest stay for the next drain. It
+// returns how many records were sent.
+func (s *spool) drain(max int, send func([]byte) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.size = 0
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	sent, consumed := 0, 0
+	var sendErr error
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), len(data)+1)
+	for sent < max && sc.Scan() {
+		line := sc.Bytes()
+		if len(line) > 0 {
+			if sendErr = send(line); sendErr != nil {
+				break
+			}
+			sent++
+		}
+		consumed += len(line) + 1
+	}
+	if consumed > len(data) {
+		consumed = len(data)
+	}
+	if consumed == 0 {
+		return 0, sendErr
+	}
+	if err := s.rewrite(data[consumed:]); err != nil {
+		return sent, err
+	}
+	return sent, sendErr
+}
+
+// rewrite atomically replaces the spool with rest. Caller must hold mu.
+func (s *spool) rewrite(rest []byte) error {
+	if len(rest) == 0 {
+		s.size = 0
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, rest, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.size = int64(len(rest))
+	return nil
+}
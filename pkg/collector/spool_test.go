@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpool_AppendAndDrain(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.pending() {
+		t.Error("new spool should be empty")
+	}
+	for _, r := range []string{`{"id":"1"}`, `{"id":"2"}`, `{"id":"3"}`} {
+		if err := s.append([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stop at the first failure and keep the rest in order.
+	var sent []string
+	n, err := s.drain(10, func(b []byte) error {
+		if string(b) == `{"id":"2"}` {
+			return errors.New("down")
+		}
+		sent = append(sent, string(b))
+		return nil
+	})
+	if n != 1 || err == nil || len(sent) != 1 {
+		t.Fatalf("drain = %d, %v; sent %v", n, err, sent)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, spoolFile))
+	if string(data) != "{\"id\":\"2\"}\n{\"id\":\"3\"}\n" || s.size != int64(len(data)) {
+		t.Errorf("remaining spool %q (size %d)", data, s.size)
+	}
+
+	// A reopened spool picks up where the last run stopped.
+	s, err = openSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent = nil
+	n, err = s.drain(1, func(b []byte) error { sent = append(sent, string(b)); return nil })
+	if n != 1 || err != nil || sent[0] != `{"id":"2"}` || !s.pending() {
+		t.Fatalf("batch drain = %d, %v; sent %v", n, err, sent)
+	}
+	n, _ = s.drain(10, func(b []byte) error { return nil })
+	if n != 1 || s.pending() {
+		t.Errorf("final drain = %d, pending = %v", n, s.pending())
+	}
+	if _, err := os.Stat(filepath.Join(dir, spoolFile)); !os.IsNotExist(err) {
+		t.Error("drained spool file should be removed")
+	}
+}
+
+func TestSpool_Full(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]byte("12345678")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]byte("1")); !errors.Is(err, errSpoolFull) {
+		t.Errorf("append past limit: err = %v, want errSpoolFull", err)
+	}
+}
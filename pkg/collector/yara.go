@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// maxYaraRulesBytes bounds the YARA rules fetched from the controller.
+const maxYaraRulesBytes = 8 << 20
+
+// FetchYaraRules polls the controller for the YARA rules agents scan files
+// with. etag is the ETag of the rules last applied; nil is returned with the
+// same etag when they did not change, and nil with an empty etag when the
+// controller has none.
+func (ec *EventCollector) FetchYaraRules(ctx context.Context, etag string) ([]byte, string, error) {
+	if ec.cfg.ControllerEndpoint == "" {
+		return nil, etag, fmt.Errorf("controller endpoint not configured")
+	}
+
+	u := fmt.Sprintf("%s/api/v1/agents/%s/yara", ec.baseURL(), url.PathEscape(ec.cfg.AgentID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, etag, fmt.Errorf("failed to create request: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if ec.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ec.cfg.AuthToken)
+	}
+
+	resp, err := ec.httpClient.Do(req)
+	if err != nil {
+		return nil, etag, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusNotFound:
+		return nil, "", nil
+	case http.StatusOK:
+	default:
+		return nil, etag, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxYaraRulesBytes))
+	if err != nil {
+		return nil, etag, fmt.Errorf("failed to read yara rules: %w", err)
+	}
+	return body, resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,341 @@
+// Package diskusage watches disk usage under writable paths and reports
+// sudden growth, such as ransomware staging areas or log bombs filling /tmp.
+package diskusage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/jitter"
+)
+
+// Anomaly types reported in ResourceEvent.AnomalyType.
+const (
+	AnomalyDiskGrowth      = "disk_growth"
+	AnomalyFileCountGrowth = "file_count_growth"
+	AnomalyInodeExhaustion = "inode_exhaustion"
+)
+
+// errTooManyEntries stops a walk once Config.MaxEntries is reached.
+var errTooManyEntries = errors.New("too many entries")
+
+// Config for disk usage monitoring
+type Config struct {
+	ScanInterval time.Duration
+	Paths        []string
+	// GrowthBytes and GrowthFiles are the growth of a path between two scans
+	// that raises an anomaly.
+	GrowthBytes int64
+	GrowthFiles int
+	// InodeUsagePercent of the inodes of a path's filesystem in use raises an
+	// inode_exhaustion anomaly; 0 disables the check.
+	InodeUsagePercent int
+	// TopN is how many of the fastest-growing directories an anomaly lists.
+	TopN int
+	// MaxEntries bounds the files and directories walked per path and scan.
+	MaxEntries int
+	EventChan  chan<- collector.SecurityEvent
+}
+
+// usage is one scan of a path: totals plus per-directory usage of the files
+// directly inside each directory, like ncdu without the cumulative roll-up.
+type usage struct {
+	bytes     int64
+	files     int
+	dirs      map[string]dirUsage
+	truncated bool
+}
+
+type dirUsage struct {
+	bytes int64
+	files int
+}
+
+// DiskMonitor scans watched paths periodically and compares each scan with
+// the previous one.
+type DiskMonitor struct {
+	cfg Config
+	log *logrus.Logger
+
+	// Previous scan per path and paths over the inode threshold (scan
+	// goroutine only)
+	prev         map[string]*usage
+	inodeAlerted map[string]bool
+
+	scans *jitter.Schedule
+}
+
+// New creates a new DiskMonitor
+func New(cfg Config, log *logrus.Logger) *DiskMonitor {
+	if cfg.ScanInterval <= 0 {
+		cfg.ScanInterval = time.Minute
+	}
+	if cfg.TopN <= 0 {
+		cfg.TopN = 5
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 200000
+	}
+	return &DiskMonitor{
+		cfg: cfg, log: log, prev: make(map[string]*usage), inodeAlerted: make(map[string]bool),
+		scans: jitter.NewSchedule(cfg.ScanInterval),
+	}
+}
+
+// SetSlowdown multiplies the scan interval by factor; 1 restores it.
+func (dm *DiskMonitor) SetSlowdown(factor int) {
+	dm.scans.SetSlowdown(factor)
+}
+
+// Start begins disk usage monitoring. The first scan of each path is the
+// baseline; anomalies are only raised from the second scan on.
+func (dm *DiskMonitor) Start(ctx context.Context) {
+	dm.log.WithField("paths", dm.cfg.Paths).Info("Starting disk usage monitor")
+
+	ticker := dm.scans.NewTicker()
+	defer ticker.Stop()
+
+	dm.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			dm.log.Info("Disk usage monitor stopping")
+			return
+		case <-ticker.C:
+			dm.scan(ctx)
+		}
+	}
+}
+
+// scan measures every watched path and reports those that grew too fast.
+func (dm *DiskMonitor) scan(ctx context.Context) {
+	for _, path := range dm.cfg.Paths {
+		cur, err := measure(path, dm.cfg.MaxEntries)
+		if err != nil {
+			dm.log.WithError(err).WithField("path", path).Debug("Cannot measure path")
+			delete(dm.prev, path)
+			continue
+		}
+		if prev := dm.prev[path]; prev != nil {
+			if event, ok := dm.compare(path, prev, cur); ok {
+				dm.emit(ctx, event)
+			}
+		}
+		dm.prev[path] = cur
+
+		if event, ok := dm.checkInodes(path); ok {
+			dm.emit(ctx, event)
+		}
+	}
+}
+
+func (dm *DiskMonitor) emit(ctx context.Context, event collector.SecurityEvent) {
+	select {
+	case dm.cfg.EventChan <- event:
+	case <-ctx.Done():
+	default:
+		dm.log.Debug("Event channel full, dropping disk usage event")
+	}
+}
+
+// checkInodes returns an inode_exhaustion event the first time the
+// filesystem holding path reaches InodeUsagePercent inode usage, and re-arms
+// once usage drops back below it. Filesystems without a fixed inode table
+// report no inodes and are skipped.
+func (dm *DiskMonitor) checkInodes(path string) (collector.SecurityEvent, bool) {
+	if dm.cfg.InodeUsagePercent <= 0 {
+		return collector.SecurityEvent{}, false
+	}
+	used, total, err := statInodes(path)
+	if err != nil || total == 0 {
+		return collector.SecurityEvent{}, false
+	}
+	over := used*100 >= total*uint64(dm.cfg.InodeUsagePercent)
+	if !over || dm.inodeAlerted[path] {
+		dm.inodeAlerted[path] = over
+		return collector.SecurityEvent{}, false
+	}
+	dm.inodeAlerted[path] = true
+
+	dm.log.WithFields(logrus.Fields{"path": path, "inodes_used": used, "inodes_total": total}).Warn("Filesystem running out of inodes")
+	return collector.SecurityEvent{
+		Type:      collector.EventTypeResourceAnomaly,
+		Severity:  collector.SeverityHigh,
+		Timestamp: time.Now(),
+		Resource: &collector.ResourceEvent{
+			AnomalyType:  AnomalyInodeExhaustion,
+			AnomalyScore: float64(used) / float64(total),
+			Path:         path,
+			InodesUsed:   used,
+			InodesTotal:  total,
+		},
+	}, true
+}
+
+// statInodes is replaced in tests.
+var statInodes = inodeUsage
+
+// inodeUsage returns the used and total inodes of the filesystem holding path.
+func inodeUsage(path string) (used, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	total = uint64(st.Files)
+	free := uint64(st.Ffree)
+	if free > total {
+		free = total
+	}
+	return total - free, total, nil
+}
+
+// compare returns a ResourceAnomaly event if path grew by more than the
+// configured thresholds between prev and cur.
+func (dm *DiskMonitor) compare(path string, prev, cur *usage) (collector.SecurityEvent, bool) {
+	growthBytes := cur.bytes - prev.bytes
+	growthFiles := cur.files - prev.files
+
+	var anomaly string
+	var score float64
+	if dm.cfg.GrowthBytes > 0 && growthBytes >= dm.cfg.GrowthBytes {
+		anomaly = AnomalyDiskGrowth
+		score = float64(growthBytes) / float64(dm.cfg.GrowthBytes)
+	}
+	if dm.cfg.GrowthFiles > 0 && growthFiles >= dm.cfg.GrowthFiles {
+		if s := float64(growthFiles) / float64(dm.cfg.GrowthFiles); anomaly == "" || s > score {
+			anomaly, score = AnomalyFileCountGrowth, s
+		}
+	}
+	if anomaly == "" {
+		return collector.SecurityEvent{}, false
+	}
+
+	event := collector.SecurityEvent{
+		Type:      collector.EventTypeResourceAnomaly,
+		Severity:  collector.SeverityHigh,
+		Timestamp: time.Now(),
+		Resource: &collector.ResourceEvent{
+			DiskWriteBytes: growthBytes,
+			AnomalyType:    anomaly,
+			AnomalyScore:   score,
+			Path:           path,
+			FileCountDelta: growthFiles,
+			TopPaths:       topGrowth(prev, cur, dm.cfg.TopN),
+		},
+		Metadata: map[string]string{
+			"bytes_before": strconv.FormatInt(prev.bytes, 10),
+			"bytes_after":  strconv.FormatInt(cur.bytes, 10),
+			"files_before": strconv.Itoa(prev.files),
+			"files_after":  strconv.Itoa(cur.files),
+			"interval":     dm.scans.Period().String(),
+		},
+	}
+	if cur.truncated {
+		event.Metadata["truncated"] = "true"
+	}
+	dm.log.WithFields(logrus.Fields{
+		"path":         path,
+		"anomaly":      anomaly,
+		"growth_bytes": growthBytes,
+		"growth_files": growthFiles,
+	}).Warn("Rapid disk usage growth")
+	return event, true
+}
+
+// topGrowth returns the n directories whose own files grew the most.
+func topGrowth(prev, cur *usage, n int) []collector.PathUsage {
+	var out []collector.PathUsage
+	for dir, u := range cur.dirs {
+		p := prev.dirs[dir]
+		gb, gf := u.bytes-p.bytes, u.files-p.files
+		if gb > 0 || gf > 0 {
+			out = append(out, collector.PathUsage{Path: dir, GrowthBytes: gb, GrowthFiles: gf})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].GrowthBytes != out[j].GrowthBytes {
+			return out[i].GrowthBytes > out[j].GrowthBytes
+		}
+		if out[i].GrowthFiles != out[j].GrowthFiles {
+			return out[i].GrowthFiles > out[j].GrowthFiles
+		}
+		return out[i].Path < out[j].Path
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// measure walks root without crossing into other filesystems (like ncdu -x)
+// and sums the sizes of regular files. Symlinks are not followed.
+func measure(root string, maxEntries int) (*usage, error) {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return nil, err
+	}
+	dev, hasDev := device(info)
+
+	u := &usage{dirs: make(map[string]dirUsage)}
+	entries := 0
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped, not fatal.
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entries++; entries > maxEntries {
+			u.truncated = true
+			return errTooManyEntries
+		}
+		if d.IsDir() {
+			if path != root && hasDev {
+				if fi, err := d.Info(); err == nil {
+					if dv, ok := device(fi); ok && dv != dev {
+						return fs.SkipDir
+					}
+				}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		du := u.dirs[dir]
+		du.bytes += fi.Size()
+		du.files++
+		u.dirs[dir] = du
+		u.bytes += fi.Size()
+		u.files++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errTooManyEntries) {
+		return nil, err
+	}
+	return u, nil
+}
+
+func device(info fs.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
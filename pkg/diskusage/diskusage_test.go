@@ -0,0 +1,143 @@
+package diskusage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 100)
+	writeFile(t, filepath.Join(root, "sub", "b"), 50)
+	writeFile(t, filepath.Join(root, "sub", "c"), 25)
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := measure(root, 1000)
+	if err != nil {
+		t.Fatalf("measure: %v", err)
+	}
+	if u.bytes != 175 || u.files != 3 || u.truncated {
+		t.Errorf("usage = %d bytes, %d files, truncated=%v", u.bytes, u.files, u.truncated)
+	}
+	if d := u.dirs[filepath.Join(root, "sub")]; d.bytes != 75 || d.files != 2 {
+		t.Errorf("sub usage = %+v", d)
+	}
+
+	u, err = measure(root, 2)
+	if err != nil || !u.truncated {
+		t.Errorf("expected truncated walk, got %+v, %v", u, err)
+	}
+}
+
+func TestScan_ReportsGrowth(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "steady"), 10)
+
+	events := make(chan collector.SecurityEvent, 1)
+	dm := New(Config{Paths: []string{root}, GrowthBytes: 1000, GrowthFiles: 50, TopN: 1, EventChan: events}, logrus.New())
+
+	dm.scan(context.Background())
+	if len(events) != 0 {
+		t.Fatal("baseline scan must not raise an anomaly")
+	}
+
+	writeFile(t, filepath.Join(root, "staging", "blob"), 2000)
+	writeFile(t, filepath.Join(root, "logs", "app.log"), 500)
+	dm.scan(context.Background())
+	select {
+	case ev := <-events:
+		r := ev.Resource
+		if ev.Type != collector.EventTypeResourceAnomaly || r == nil || r.AnomalyType != AnomalyDiskGrowth {
+			t.Fatalf("event = %+v", ev)
+		}
+		if r.DiskWriteBytes != 2500 || r.FileCountDelta != 2 || r.Path != root {
+			t.Errorf("resource = %+v", r)
+		}
+		if len(r.TopPaths) != 1 || r.TopPaths[0].Path != filepath.Join(root, "staging") {
+			t.Errorf("top paths = %+v", r.TopPaths)
+		}
+	default:
+		t.Fatal("expected disk growth anomaly")
+	}
+
+	dm.scan(context.Background())
+	if len(events) != 0 {
+		t.Error("no growth since last scan should not raise an anomaly")
+	}
+}
+
+func TestScan_ReportsFileCountGrowth(t *testing.T) {
+	root := t.TempDir()
+	events := make(chan collector.SecurityEvent, 1)
+	dm := New(Config{Paths: []string{root}, GrowthBytes: 1 << 30, GrowthFiles: 20, ScanInterval: time.Second, EventChan: events}, logrus.New())
+	dm.scan(context.Background())
+
+	for i := 0; i < 25; i++ {
+		writeFile(t, filepath.Join(root, "spool", strconv.Itoa(i)), 1)
+	}
+	dm.scan(context.Background())
+	select {
+	case ev := <-events:
+		if ev.Resource.AnomalyType != AnomalyFileCountGrowth || ev.Metadata["files_after"] != "25" {
+			t.Errorf("event = %+v, metadata = %v", ev.Resource, ev.Metadata)
+		}
+	default:
+		t.Fatal("expected file count anomaly")
+	}
+}
+
+func TestCheckInodes_AlertsOncePerCrossing(t *testing.T) {
+	var used uint64
+	statInodes = func(string) (uint64, uint64, error) { return used, 100, nil }
+	defer func() { statInodes = inodeUsage }()
+
+	dm := New(Config{InodeUsagePercent: 90}, logrus.New())
+	used = 50
+	if _, ok := dm.checkInodes("/tmp"); ok {
+		t.Error("50% inode usage should not alert")
+	}
+	used = 95
+	ev, ok := dm.checkInodes("/tmp")
+	if !ok || ev.Resource.AnomalyType != AnomalyInodeExhaustion || ev.Resource.InodesUsed != 95 {
+		t.Fatalf("event = %+v, ok = %v", ev.Resource, ok)
+	}
+	if _, ok := dm.checkInodes("/tmp"); ok {
+		t.Error("should not alert again while still over the threshold")
+	}
+	used = 10
+	dm.checkInodes("/tmp")
+	used = 99
+	if _, ok := dm.checkInodes("/tmp"); !ok {
+		t.Error("should alert again after usage dropped below the threshold")
+	}
+}
+
+func TestInodeUsage(t *testing.T) {
+	used, total, err := inodeUsage(t.TempDir())
+	if err != nil {
+		t.Fatalf("inodeUsage: %v", err)
+	}
+	if used > total {
+		t.Errorf("used %d > total %d", used, total)
+	}
+}
@@ -0,0 +1,119 @@
+package egress
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func canListen(t *testing.T) bool {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+func TestTransport_Zero(t *testing.T) {
+	tr, err := Config{}.Transport()
+	if err != nil || tr != http.DefaultTransport {
+		t.Errorf("Transport() = %v, %v; want http.DefaultTransport", tr, err)
+	}
+}
+
+func TestTransport_InvalidProxy(t *testing.T) {
+	for _, proxy := range []string{"proxy.corp:3128", "socks5://proxy.corp:1080", "http://"} {
+		if _, err := (Config{ProxyURL: proxy}).Transport(); err == nil {
+			t.Errorf("ProxyURL %q: expected an error", proxy)
+		}
+	}
+}
+
+func TestTransport_CAFile(t *testing.T) {
+	if !canListen(t) {
+		return
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	// The test server's certificate is not in the system roots.
+	if _, err := (&http.Client{Transport: http.DefaultTransport}).Get(srv.URL); err == nil {
+		t.Fatal("expected the default transport to reject the test certificate")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := Config{CAFile: caFile}.Transport()
+	if err != nil {
+		t.Fatalf("Transport: %v", err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get with CA file: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTransport_CAFileWithoutCertificates(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Config{CAFile: caFile}).Transport(); err == nil {
+		t.Error("expected an error for a CA file with no certificates")
+	}
+	if _, err := (Config{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).Transport(); err == nil {
+		t.Error("expected an error for a missing CA file")
+	}
+}
+
+func TestTransport_InsecureSkipVerify(t *testing.T) {
+	if !canListen(t) {
+		return
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	tr, err := Config{InsecureSkipVerify: true}.Transport()
+	if err != nil {
+		t.Fatalf("Transport: %v", err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get with verification disabled: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTransport_Proxy(t *testing.T) {
+	if !canListen(t) {
+		return
+	}
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	tr, err := Config{ProxyURL: proxy.URL}.Transport()
+	if err != nil {
+		t.Fatalf("Transport: %v", err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get("http://collector.example.com/ingest")
+	if err != nil {
+		t.Fatalf("Get through proxy: %v", err)
+	}
+	resp.Body.Close()
+	if proxied != "http://collector.example.com/ingest" {
+		t.Errorf("proxy saw %q, want the absolute collector URL", proxied)
+	}
+}
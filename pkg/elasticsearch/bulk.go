@@ -0,0 +1,272 @@
+// Package elasticsearch bulk-indexes events and alerts into Elasticsearch or
+// OpenSearch, one index per kind and UTC day (e.g. apss-events-2026.01.02),
+// so old days can be dropped by deleting their indices.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults for Config fields left zero.
+const (
+	DefaultIndexPrefix   = "apss"
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+	DefaultQueueSize     = 10000
+	DefaultTimeout       = 30 * time.Second
+)
+
+// Document kinds; each has its own index template and daily indices.
+const (
+	KindEvents = "events"
+	KindAlerts = "alerts"
+)
+
+var indexed = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_elasticsearch_documents_total",
+		Help: "Total documents bulk-indexed into Elasticsearch by kind and result (indexed, failed, dropped)",
+	},
+	[]string{"kind", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(indexed)
+}
+
+// Config for the bulk indexer.
+type Config struct {
+	// URL is the cluster base URL, e.g. https://es.example.com:9200.
+	URL string
+	// APIKey is sent as "Authorization: ApiKey ..."; otherwise Username and
+	// Password are used for basic auth when set.
+	APIKey   string
+	Username string
+	Password string
+	// IndexPrefix starts every index and template name.
+	IndexPrefix string
+	// BatchSize documents are sent in one bulk request; a partial batch is
+	// sent after FlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueueSize bounds documents waiting to be sent; beyond it they are
+	// dropped.
+	QueueSize int
+	Timeout   time.Duration
+	// Transport carries requests to the cluster, e.g. through a proxy; nil
+	// uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// document is one queued bulk index operation.
+type document struct {
+	kind string
+	id   string
+	at   time.Time
+	body interface{}
+}
+
+// Indexer queues documents and bulk-indexes them from Run.
+type Indexer struct {
+	cfg        Config
+	url        string
+	httpClient *http.Client
+	queue      chan document
+	log        *logrus.Logger
+}
+
+// NewIndexer creates a bulk indexer, filling in defaults for zero fields.
+func NewIndexer(cfg Config, log *logrus.Logger) *Indexer {
+	if cfg.IndexPrefix == "" {
+		cfg.IndexPrefix = DefaultIndexPrefix
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Indexer{
+		cfg:        cfg,
+		url:        strings.TrimRight(cfg.URL, "/"),
+		httpClient: &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+		queue:      make(chan document, cfg.QueueSize),
+		log:        log,
+	}
+}
+
+// IndexName returns the daily index for documents of kind dated t.
+func (ix *Indexer) IndexName(kind string, t time.Time) string {
+	return fmt.Sprintf("%s-%s-%s", ix.cfg.IndexPrefix, kind, t.UTC().Format("2006.01.02"))
+}
+
+// IndexEvent queues an event with ID id dated t. It never blocks; it
+// returns false if the queue is full and the event was dropped.
+func (ix *Indexer) IndexEvent(id string, t time.Time, event interface{}) bool {
+	return ix.enqueue(document{kind: KindEvents, id: id, at: t, body: event})
+}
+
+// IndexAlert queues an alert with ID id dated t. It never blocks; it
+// returns false if the queue is full and the alert was dropped.
+func (ix *Indexer) IndexAlert(id string, t time.Time, alert interface{}) bool {
+	return ix.enqueue(document{kind: KindAlerts, id: id, at: t, body: alert})
+}
+
+func (ix *Indexer) enqueue(d document) bool {
+	if d.at.IsZero() {
+		d.at = time.Now()
+	}
+	select {
+	case ix.queue <- d:
+		return true
+	default:
+		indexed.WithLabelValues(d.kind, "dropped").Inc()
+		return false
+	}
+}
+
+// Run installs the index templates, then bulk-indexes queued documents
+// until ctx is done and sends what is left. A template that cannot be
+// installed is logged; documents are still sent and get dynamic mappings.
+func (ix *Indexer) Run(ctx context.Context) {
+	if err := ix.PutTemplates(ctx); err != nil {
+		ix.log.WithError(err).Warn("Failed to install Elasticsearch index templates")
+	}
+	ticker := time.NewTicker(ix.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]document, 0, ix.cfg.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := ix.bulk(ctx, batch); err != nil {
+			ix.log.WithError(err).WithField("documents", len(batch)).Error("Failed to bulk-index documents")
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), ix.cfg.Timeout)
+			defer cancel()
+			for n := len(ix.queue); n > 0; n-- {
+				batch = append(batch, <-ix.queue)
+				if len(batch) >= ix.cfg.BatchSize {
+					flush(drainCtx)
+				}
+			}
+			flush(drainCtx)
+			return
+		case d := <-ix.queue:
+			batch = append(batch, d)
+			if len(batch) >= ix.cfg.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// bulkResponse is the part of a _bulk response needed to count failures.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// bulk sends batch as one _bulk request and counts each document's outcome.
+// Documents are indexed by ID, so a retried batch does not duplicate them.
+func (ix *Indexer) bulk(ctx context.Context, batch []document) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, d := range batch {
+		action := map[string]map[string]string{"index": {"_index": ix.IndexName(d.kind, d.at), "_id": d.id}}
+		if err := enc.Encode(action); err != nil {
+			return fmt.Errorf("failed to marshal action: %w", err)
+		}
+		if err := enc.Encode(d.body); err != nil {
+			return fmt.Errorf("failed to marshal document %s: %w", d.id, err)
+		}
+	}
+
+	var resp bulkResponse
+	if err := ix.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", &body, &resp); err != nil {
+		for _, d := range batch {
+			indexed.WithLabelValues(d.kind, "failed").Inc()
+		}
+		return err
+	}
+	var firstErr error
+	failed := 0
+	for i, d := range batch {
+		result := "indexed"
+		if i < len(resp.Items) {
+			for _, item := range resp.Items[i] {
+				if item.Error != nil || item.Status >= 300 {
+					result = "failed"
+					failed++
+					if firstErr == nil && item.Error != nil {
+						firstErr = fmt.Errorf("%s: %s", item.Error.Type, item.Error.Reason)
+					}
+				}
+			}
+		}
+		indexed.WithLabelValues(d.kind, result).Inc()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d documents failed, first: %v", failed, len(batch), firstErr)
+	}
+	return nil
+}
+
+// do sends a request to the cluster and decodes a JSON response into out,
+// if not nil.
+func (ix *Indexer) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, ix.url+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case ix.cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+ix.cfg.APIKey)
+	case ix.cfg.Username != "":
+		req.SetBasicAuth(ix.cfg.Username, ix.cfg.Password)
+	}
+
+	resp, err := ix.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
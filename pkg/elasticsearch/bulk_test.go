@@ -0,0 +1,161 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// decodeBulk splits a _bulk request body into its action and document lines.
+func decodeBulk(t *testing.T, r io.Reader) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var line map[string]interface{}
+		if err := dec.Decode(&line); err != nil {
+			t.Errorf("decode line: %v", err)
+			return out
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func TestIndexer_IndexName(t *testing.T) {
+	ix := NewIndexer(Config{URL: "http://es:9200"}, logrus.New())
+	at := time.Date(2026, 1, 2, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600))
+	if got := ix.IndexName(KindEvents, at); got != "apss-events-2026.01.03" {
+		t.Errorf("IndexName = %q, want the UTC day", got)
+	}
+}
+
+func TestIndexer_Run(t *testing.T) {
+	var mu sync.Mutex
+	templates := map[string]map[string]interface{}{}
+	bulks := make(chan []map[string]interface{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "ApiKey key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/"):
+			var tmpl map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&tmpl)
+			mu.Lock()
+			templates[strings.TrimPrefix(r.URL.Path, "/_index_template/")] = tmpl
+			mu.Unlock()
+			io.WriteString(w, `{"acknowledged":true}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+			if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("bulk Content-Type = %q", ct)
+			}
+			lines := decodeBulk(t, r.Body)
+			bulks <- lines
+			io.WriteString(w, `{"errors":false,"items":[`+strings.Repeat(`{"index":{"status":201}},`, len(lines)/2-1)+`{"index":{"status":201}}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ix := NewIndexer(Config{URL: srv.URL, APIKey: "key", IndexPrefix: "sec", FlushInterval: 20 * time.Millisecond}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ix.Run(ctx)
+
+	at := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	ix.IndexEvent("ev-1", at, map[string]string{"id": "ev-1"})
+	ix.IndexAlert("alert-1", at.AddDate(0, 0, 1), map[string]string{"id": "alert-1"})
+
+	var lines []map[string]interface{}
+	for len(lines) < 4 {
+		select {
+		case b := <-bulks:
+			lines = append(lines, b...)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d bulk lines, want 4", len(lines))
+		}
+	}
+	action := lines[0]["index"].(map[string]interface{})
+	if action["_index"] != "sec-events-2026.03.04" || action["_id"] != "ev-1" {
+		t.Errorf("event action = %v", action)
+	}
+	if lines[1]["id"] != "ev-1" {
+		t.Errorf("event document = %v", lines[1])
+	}
+	if action := lines[2]["index"].(map[string]interface{}); action["_index"] != "sec-alerts-2026.03.05" {
+		t.Errorf("alert action = %v", action)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"sec-events", "sec-alerts"} {
+		tmpl, ok := templates[name]
+		if !ok {
+			t.Errorf("template %s not installed", name)
+			continue
+		}
+		if p := tmpl["index_patterns"].([]interface{}); len(p) != 1 || p[0] != name+"-*" {
+			t.Errorf("template %s index_patterns = %v", name, p)
+		}
+	}
+	props := templates["sec-events"]["template"].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	if ts := props["timestamp"].(map[string]interface{}); ts["type"] != "date" {
+		t.Errorf("timestamp mapping = %v", ts)
+	}
+}
+
+func TestIndexer_ItemErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"errors":true,"items":[
+			{"index":{"status":201}},
+			{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [timestamp]"}}}]}`)
+	}))
+	defer srv.Close()
+
+	ix := NewIndexer(Config{URL: srv.URL, Username: "elastic", Password: "secret"}, logrus.New())
+	err := ix.bulk(context.Background(), []document{
+		{kind: KindEvents, id: "a", at: time.Now(), body: 1},
+		{kind: KindEvents, id: "b", at: time.Now(), body: 2},
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Errorf("bulk err = %v, want the failed item", err)
+	}
+}
+
+func TestIndexer_Rejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error":"no permission"}`)
+	}))
+	defer srv.Close()
+
+	ix := NewIndexer(Config{URL: srv.URL}, logrus.New())
+	if err := ix.PutTemplates(context.Background()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("PutTemplates err = %v, want the status", err)
+	}
+}
+
+func TestIndexer_QueueFull(t *testing.T) {
+	ix := NewIndexer(Config{URL: "http://127.0.0.1:1", QueueSize: 1}, logrus.New())
+	if !ix.IndexEvent("a", time.Now(), 1) {
+		t.Fatal("first event dropped")
+	}
+	if ix.IndexAlert("b", time.Now(), 2) {
+		t.Error("second document queued past QueueSize")
+	}
+}
@@ -0,0 +1,100 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type mapping map[string]interface{}
+
+func keyword() mapping { return mapping{"type": "keyword"} }
+func date() mapping    { return mapping{"type": "date"} }
+func text() mapping    { return mapping{"type": "text"} }
+func ip() mapping      { return mapping{"type": "ip"} }
+func integer() mapping { return mapping{"type": "integer"} }
+
+func object(props mapping) mapping { return mapping{"properties": props} }
+
+// stringsAsKeywords maps string fields not listed in a template to keyword,
+// which suits the IDs, names and hashes that make up most of the documents.
+var stringsAsKeywords = []mapping{{
+	"strings_as_keywords": mapping{
+		"match_mapping_type": "string",
+		"mapping":            mapping{"type": "keyword", "ignore_above": 1024},
+	},
+}}
+
+// templateMappings are the mappings of each document kind. Only fields
+// worth typing explicitly are listed: dates, addresses, ports and free text.
+var templateMappings = map[string]mapping{
+	KindEvents: {
+		"dynamic_templates": stringsAsKeywords,
+		"properties": mapping{
+			"timestamp":   date(),
+			"occurred_at": date(),
+			"process": object(mapping{
+				"pid":     integer(),
+				"ppid":    integer(),
+				"cmdline": mapping{"type": "text", "fields": mapping{"raw": mapping{"type": "keyword", "ignore_above": 1024}}},
+			}),
+			"network": object(mapping{
+				"src_ip":   ip(),
+				"dst_ip":   ip(),
+				"src_port": integer(),
+				"dst_port": integer(),
+			}),
+			"file": object(mapping{
+				"old_mtime": date(),
+				"new_mtime": date(),
+			}),
+		},
+	},
+	KindAlerts: {
+		"dynamic_templates": stringsAsKeywords,
+		"properties": mapping{
+			"timestamp":   date(),
+			"observed_at": date(),
+			"occurred_at": date(),
+			"updated_at":  date(),
+			"acked_at":    date(),
+			"resolved_at": date(),
+			"description": text(),
+		},
+	},
+}
+
+// TemplateName returns the name of the index template for kind.
+func (ix *Indexer) TemplateName(kind string) string {
+	return ix.cfg.IndexPrefix + "-" + kind
+}
+
+// Template returns the composable index template applied to the daily
+// indices of kind.
+func (ix *Indexer) Template(kind string) mapping {
+	return mapping{
+		"index_patterns": []string{ix.cfg.IndexPrefix + "-" + kind + "-*"},
+		"template": mapping{
+			"mappings": templateMappings[kind],
+		},
+	}
+}
+
+// PutTemplates installs or updates the index templates for events and
+// alerts. Templates apply to indices created afterwards, so each day's
+// index picks up changes.
+func (ix *Indexer) PutTemplates(ctx context.Context) error {
+	for _, kind := range []string{KindEvents, KindAlerts} {
+		body, err := json.Marshal(ix.Template(kind))
+		if err != nil {
+			return err
+		}
+		path := "/_index_template/" + ix.TemplateName(kind)
+		if err := ix.do(ctx, http.MethodPut, path, "application/json", bytes.NewReader(body), nil); err != nil {
+			return fmt.Errorf("put template %s: %w", ix.TemplateName(kind), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package fileintegrity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// DetectedByBaseline is the MetadataDetectedBy value of events for
+// differences from a known-good baseline.
+const DetectedByBaseline = "baseline"
+
+// BaselineVersion is the current Baseline format.
+const BaselineVersion = 1
+
+// ErrBaselineSignature is returned by Verify for an unsigned baseline or one
+// whose signature does not match.
+var ErrBaselineSignature = errors.New("baseline signature invalid")
+
+// Baseline is a known-good snapshot of the watched files, captured at image
+// build or on first deploy and signed by the controller, that agents compare
+// against at startup so tampering before the agent started is not silently
+// taken as the starting point.
+type Baseline struct {
+	Version int `json:"version"`
+	// Key names what the baseline is for, such as namespace/workload.
+	Key       string         `json:"key"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []BaselineFile `json:"files"`
+	// Source is how the baseline was captured: "agent" on first deploy or
+	// "import" for one captured elsewhere, such as at image build.
+	Source string `json:"source,omitempty"`
+	// Signature is the base64 Ed25519 signature of the baseline with
+	// Signature empty.
+	Signature string `json:"signature,omitempty"`
+}
+
+// BaselineFile is one file in a Baseline.
+type BaselineFile struct {
+	Path string      `json:"path"`
+	Hash string      `json:"hash"`
+	Mode os.FileMode `json:"mode"`
+	Size int64       `json:"size"`
+	// UID and GID are the file's owner; baselines captured before owners
+	// were recorded have none, and owners are then not compared.
+	UID *int `json:"uid,omitempty"`
+	GID *int `json:"gid,omitempty"`
+}
+
+func baselineFile(h *FileHash) BaselineFile {
+	f := BaselineFile{Path: h.Path, Hash: h.Hash, Mode: h.Mode, Size: h.Size}
+	if h.UID >= 0 {
+		uid, gid := h.UID, h.GID
+		f.UID, f.GID = &uid, &gid
+	}
+	return f
+}
+
+func (f BaselineFile) fileHash() *FileHash {
+	h := &FileHash{Path: f.Path, Hash: f.Hash, Mode: f.Mode, Size: f.Size, UID: -1, GID: -1}
+	if f.UID != nil && f.GID != nil {
+		h.UID, h.GID = *f.UID, *f.GID
+	}
+	return h
+}
+
+// signedBytes is the encoding the signature covers.
+func (b *Baseline) signedBytes() ([]byte, error) {
+	cp := *b
+	cp.Signature = ""
+	return json.Marshal(cp)
+}
+
+// Sign sorts the files by path and signs the baseline with key.
+func (b *Baseline) Sign(key ed25519.PrivateKey) error {
+	sort.Slice(b.Files, func(i, j int) bool { return b.Files[i].Path < b.Files[j].Path })
+	data, err := b.signedBytes()
+	if err != nil {
+		return err
+	}
+	b.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	return nil
+}
+
+// Verify checks the baseline's signature against key.
+func (b *Baseline) Verify(key ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(b.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrBaselineSignature
+	}
+	data, err := b.signedBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return ErrBaselineSignature
+	}
+	return nil
+}
+
+// ParsePrivateKey decodes a PEM PKCS #8 Ed25519 private key, as written by
+// openssl genpkey -algorithm ed25519.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is %T, not Ed25519", key)
+	}
+	return priv, nil
+}
+
+// ParsePublicKey decodes a PEM PKIX Ed25519 public key, as written by
+// openssl pkey -pubout.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is %T, not Ed25519", key)
+	}
+	return pub, nil
+}
+
+// Capture hashes the files covered by watch and exclude without watching
+// them, for capturing a baseline at image build.
+func Capture(key string, watch, exclude []string, log *logrus.Logger) (*Baseline, error) {
+	m, err := NewMatcher(watch, exclude)
+	if err != nil {
+		return nil, err
+	}
+	fm := &FileMonitor{log: log, baseline: make(map[string]*FileHash), matcher: m}
+	for _, root := range m.Roots() {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if !m.WatchDir(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if m.Match(path) {
+				fm.hashFile(path)
+			}
+			return nil
+		})
+	}
+	return fm.Export(key), nil
+}
+
+// Export snapshots the current baseline, unsigned.
+func (fm *FileMonitor) Export(key string) *Baseline {
+	b := &Baseline{Version: BaselineVersion, Key: key, CreatedAt: time.Now().UTC()}
+	fm.mu.RLock()
+	for _, h := range fm.baseline {
+		b.Files = append(b.Files, baselineFile(h))
+	}
+	fm.mu.RUnlock()
+	sort.Slice(b.Files, func(i, j int) bool { return b.Files[i].Path < b.Files[j].Path })
+	return b
+}
+
+// CompareBaseline reports every difference between the files as hashed at
+// startup and the known-good baseline b: changed content, mode or owner, files
+// missing and files b does not have, within the watched paths. It returns
+// the number of differences. The startup hashes stay the reference for
+// later changes, so each difference is reported once.
+func (fm *FileMonitor) CompareBaseline(ctx context.Context, b *Baseline) int {
+	m := fm.currentMatcher()
+	known := make(map[string]*FileHash, len(b.Files))
+	for _, f := range b.Files {
+		if m.Match(f.Path) {
+			known[f.Path] = f.fileHash()
+		}
+	}
+	fm.mu.RLock()
+	current := make(map[string]*FileHash, len(fm.baseline))
+	for p, h := range fm.baseline {
+		current[p] = h
+	}
+	fm.mu.RUnlock()
+
+	metadata := func() map[string]string {
+		return map[string]string{
+			MetadataDetectedBy:    DetectedByBaseline,
+			"baseline_key":        b.Key,
+			"baseline_created_at": b.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	paths := make([]string, 0, len(current)+len(known))
+	for p := range current {
+		paths = append(paths, p)
+	}
+	for p := range known {
+		if current[p] == nil {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	diffs := 0
+	for _, path := range paths {
+		want, got := known[path], current[path]
+		switch {
+		case want == nil:
+			fm.emitChange(ctx, path, "create", collector.EventTypeFileCreate, collector.SeverityMedium, nil, got, metadata())
+		case got == nil:
+			fm.emitChange(ctx, path, "delete", collector.EventTypeFileDelete, collector.SeverityHigh, want, nil, metadata())
+		case got.Hash != want.Hash:
+			fm.emitChange(ctx, path, "modify", collector.EventTypeFileModify, collector.SeverityMedium, want, got, metadata())
+		case got.Mode != want.Mode:
+			fm.emitChange(ctx, path, "chmod", collector.EventTypeFileModify, collector.SeverityMedium, want, got, metadata())
+		case ownerChanged(want, got):
+			fm.emitChange(ctx, path, "chown", collector.EventTypeFileModify, collector.SeverityMedium, want, got, metadata())
+		default:
+			continue
+		}
+		diffs++
+	}
+	return diffs
+}
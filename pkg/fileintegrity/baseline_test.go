@@ -0,0 +1,108 @@
+package fileintegrity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func TestBaseline_SignVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	b := &Baseline{Version: BaselineVersion, Key: "shop/web", Files: []BaselineFile{
+		{Path: "/etc/shadow", Hash: "bb"}, {Path: "/etc/passwd", Hash: "aa"},
+	}}
+	if err := b.Verify(pub); !errors.Is(err, ErrBaselineSignature) {
+		t.Errorf("unsigned baseline: err = %v", err)
+	}
+	if err := b.Sign(priv); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if b.Files[0].Path != "/etc/passwd" {
+		t.Errorf("files not sorted: %+v", b.Files)
+	}
+	if err := b.Verify(pub); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	b.Files[0].Hash = "cc"
+	if err := b.Verify(pub); !errors.Is(err, ErrBaselineSignature) {
+		t.Errorf("tampered baseline: err = %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	gotPriv, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	if err != nil || !gotPriv.Equal(priv) {
+		t.Errorf("ParsePrivateKey: %v", err)
+	}
+	gotPub, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	if err != nil || !gotPub.Equal(pub) {
+		t.Errorf("ParsePublicKey: %v", err)
+	}
+	if _, err := ParsePublicKey([]byte("not pem")); err == nil {
+		t.Error("garbage public key accepted")
+	}
+}
+
+func TestFileMonitor_CompareBaseline(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	same, changed, removed := write("same", "a"), write("changed", "b"), write("removed", "c")
+	known, err := Capture("ns/web", []string{dir}, nil, logrus.New())
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(known.Files) != 3 {
+		t.Fatalf("captured %d files", len(known.Files))
+	}
+
+	// Tampering before the agent starts.
+	write("changed", "tampered")
+	os.Remove(removed)
+	added := write("added", "d")
+
+	ch := make(chan collector.SecurityEvent, 10)
+	fm, err := New(Config{WatchPaths: []string{dir}, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.watcher.Close()
+	if n := fm.CompareBaseline(context.Background(), known); n != 3 {
+		t.Errorf("differences = %d, want 3", n)
+	}
+	got := map[string]string{}
+	for len(ch) > 0 {
+		e := <-ch
+		if e.Metadata[MetadataDetectedBy] != DetectedByBaseline || e.Metadata["baseline_key"] != "ns/web" {
+			t.Errorf("metadata = %v", e.Metadata)
+		}
+		got[e.File.Path] = e.File.Operation
+	}
+	want := map[string]string{changed: "modify", removed: "delete", added: "create"}
+	for p, op := range want {
+		if got[p] != op {
+			t.Errorf("%s: operation %q, want %q", p, got[p], op)
+		}
+	}
+	if _, ok := got[same]; ok {
+		t.Error("unchanged file reported")
+	}
+}
@@ -0,0 +1,48 @@
+package fileintegrity
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IndicatorCredentialAccess marks a change to a Kubernetes or cloud
+// credential file. The process monitor uses it too, for processes reading
+// one.
+const IndicatorCredentialAccess = "credential_access"
+
+// ExpandCredentialPaths returns paths with a leading ~/ expanded to both
+// /root/ and every /home/*/ directory, for credentials that live in a home
+// directory.
+func ExpandCredentialPaths(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		rest, ok := strings.CutPrefix(p, "~/")
+		if !ok {
+			out = append(out, p)
+			continue
+		}
+		out = append(out, "/root/"+rest, "/home/*/"+rest)
+	}
+	return out
+}
+
+// NewCredentialMatcher compiles credential paths, which may start with ~/.
+func NewCredentialMatcher(paths []string) (*Matcher, error) {
+	return NewMatcher(ExpandCredentialPaths(paths), nil)
+}
+
+// kubeletManaged reports whether path is content of a Secret, ConfigMap or
+// projected volume. The kubelet updates those by writing a new ..<timestamp>
+// directory and swapping the ..data symlink every visible entry points
+// through, such as when it rotates a service account token; the volume is
+// read-only to the pod, so such changes are not worth reporting.
+func kubeletManaged(path string) bool {
+	for _, seg := range strings.Split(path, string(filepath.Separator)) {
+		if strings.HasPrefix(seg, "..") {
+			return true
+		}
+	}
+	target, err := os.Readlink(path)
+	return err == nil && strings.HasPrefix(target, "..data"+string(filepath.Separator))
+}
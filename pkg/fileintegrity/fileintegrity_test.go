@@ -1,11 +1,18 @@
 package fileintegrity
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/yara"
 )
 
 func TestNew_EmptyWatchPaths(t *testing.T) {
@@ -46,3 +53,454 @@ func TestFileMonitor_classifySeverity(t *testing.T) {
 		}
 	}
 }
+
+func TestFileMonitor_SetWatchPaths(t *testing.T) {
+	dir := t.TempDir()
+	keep := filepath.Join(dir, "keep")
+	drop := filepath.Join(dir, "drop")
+	for _, p := range []string{keep, drop} {
+		if err := os.WriteFile(p, []byte(p), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fm, err := New(Config{WatchPaths: []string{keep, drop}}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	fm.SetWatchPaths([]string{keep, sub})
+	if _, ok := fm.baseline[drop]; ok {
+		t.Error("dropped path still baselined")
+	}
+	if _, ok := fm.baseline[keep]; !ok {
+		t.Error("kept path lost its baseline")
+	}
+	watched := map[string]bool{}
+	for _, w := range fm.watcher.WatchList() {
+		watched[w] = true
+	}
+	if !watched[dir] || !watched[sub] {
+		t.Errorf("watch list = %v", fm.watcher.WatchList())
+	}
+}
+
+func TestTimestomped(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	tests := []struct {
+		name     string
+		old, new *FileHash
+		want     bool
+	}{
+		{"normal edit", &FileHash{Hash: "a", ModTime: t0}, &FileHash{Hash: "b", ModTime: t1}, false},
+		{"edit with mtime kept", &FileHash{Hash: "a", ModTime: t0}, &FileHash{Hash: "b", ModTime: t0}, true},
+		{"edit with mtime rolled back", &FileHash{Hash: "a", ModTime: t1}, &FileHash{Hash: "b", ModTime: t0}, true},
+		{"chmod only", &FileHash{Hash: "a", ModTime: t0}, &FileHash{Hash: "a", ModTime: t0}, false},
+		{"mtime rolled back after edit",
+			&FileHash{Hash: "b", ModTime: t1, PrevHash: "a", PrevModTime: t0},
+			&FileHash{Hash: "b", ModTime: t0, PrevHash: "a", PrevModTime: t0}, true},
+		{"mtime rolled back without edit", &FileHash{Hash: "a", ModTime: t1}, &FileHash{Hash: "a", ModTime: t0}, false},
+		{"new file", nil, &FileHash{Hash: "a", ModTime: t0}, false},
+	}
+	for _, tt := range tests {
+		if got := timestomped(tt.old, tt.new); got != tt.want {
+			t.Errorf("%s: timestomped = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileMonitor_TimestompIndicator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte("original"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	orig := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	os.Chtimes(path, orig, orig)
+
+	ch := make(chan collector.SecurityEvent, 4)
+	fm, err := New(Config{WatchPaths: []string{path}, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	next := func(op fsnotify.Op) collector.SecurityEvent {
+		t.Helper()
+		fm.handleFsEvent(context.Background(), fsnotify.Event{Name: path, Op: op})
+		return <-ch
+	}
+
+	// The write event is handled before touch -r restores the mtime.
+	os.WriteFile(path, []byte("backdoor"), 0o600)
+	if ev := next(fsnotify.Write); len(ev.File.Indicators) != 0 {
+		t.Errorf("plain write flagged: %v", ev.File.Indicators)
+	}
+	os.Chtimes(path, orig, orig)
+	if ev := next(fsnotify.Chmod); len(ev.File.Indicators) != 1 || ev.File.Indicators[0] != IndicatorTimestomp {
+		t.Errorf("rolled-back mtime after write: indicators = %v", ev.File.Indicators)
+	}
+
+	// touch -r lands before the write event is handled.
+	os.WriteFile(path, []byte("backdoor v2"), 0o600)
+	os.Chtimes(path, orig, orig)
+	ev := next(fsnotify.Write)
+	if len(ev.File.Indicators) != 1 || ev.Severity != collector.SeverityHigh {
+		t.Errorf("write with kept mtime: indicators = %v severity = %v", ev.File.Indicators, ev.Severity)
+	}
+	if !ev.File.OldModTime.Equal(orig) || !ev.File.NewModTime.Equal(orig) {
+		t.Errorf("mtimes = %v -> %v, want %v", ev.File.OldModTime, ev.File.NewModTime, orig)
+	}
+}
+
+func TestPermissionIndicators(t *testing.T) {
+	owned := func(mode os.FileMode, uid, gid int) *FileHash { return &FileHash{Mode: mode, UID: uid, GID: gid} }
+	tests := []struct {
+		name     string
+		old, new *FileHash
+		want     []string
+	}{
+		{"chmod u+s", owned(0o755, 0, 0), owned(os.ModeSetuid|0o755, 0, 0), []string{IndicatorSetuid}},
+		{"chmod g+s o+w", owned(0o755, 0, 0), owned(os.ModeSetgid|0o757, 0, 0), []string{IndicatorSetgid, IndicatorWorldWritable}},
+		{"already setuid", owned(os.ModeSetuid|0o755, 0, 0), owned(os.ModeSetuid|0o700, 0, 0), nil},
+		{"created world-writable", nil, owned(0o666, 0, 0), []string{IndicatorWorldWritable}},
+		{"chown", owned(0o644, 1000, 1000), owned(0o644, 0, 1000), []string{IndicatorOwnerChange}},
+		{"owner unknown", owned(0o644, -1, -1), owned(0o644, 0, 0), nil},
+		{"chmod go-r", owned(0o644, 0, 0), owned(0o600, 0, 0), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := permissionIndicators(tt.old, tt.new)
+			if len(got) != len(tt.want) {
+				t.Fatalf("indicators = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("indicators = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileMonitor_PermissionChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helper")
+	if err := os.WriteFile(path, []byte("#!/bin/sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(path, 0o755)
+	ch := make(chan collector.SecurityEvent, 4)
+	fm, err := New(Config{WatchPaths: []string{path}, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	os.Chmod(path, os.ModeSetuid|0o757)
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: path, Op: fsnotify.Chmod})
+	ev := <-ch
+	if ev.Severity != collector.SeverityHigh || len(ev.File.Indicators) != 2 ||
+		ev.File.Indicators[0] != IndicatorSetuid || ev.File.Indicators[1] != IndicatorWorldWritable {
+		t.Errorf("severity = %v indicators = %v", ev.Severity, ev.File.Indicators)
+	}
+	if ev.File.Operation != "chmod" || ev.File.OldPermissions != "0755" || ev.File.Permissions != "4757" {
+		t.Errorf("operation %s mode %s -> %s", ev.File.Operation, ev.File.OldPermissions, ev.File.Permissions)
+	}
+	if ev.File.Owner == nil || ev.File.Owner.UID != os.Getuid() {
+		t.Errorf("owner = %+v, want uid %d", ev.File.Owner, os.Getuid())
+	}
+}
+
+func TestFileMonitor_Yara(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.php")
+	if err := os.WriteFile(path, []byte("<?php echo 'hi';"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan collector.SecurityEvent, 4)
+	fm, err := New(Config{WatchPaths: []string{dir}, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	rules, err := yara.Compile(`rule webshell { strings: $e = /eval\(\$_(POST|GET)/ condition: $e }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.SetYaraRules(rules)
+
+	os.WriteFile(path, []byte("<?php eval($_POST['c']);"), 0o644)
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: path, Op: fsnotify.Write})
+	ev := <-ch
+	if ev.Severity != collector.SeverityCritical || len(ev.File.YaraRules) != 1 || ev.File.YaraRules[0] != "webshell" ||
+		ev.File.Indicators[len(ev.File.Indicators)-1] != IndicatorYaraMatch {
+		t.Errorf("severity = %v indicators = %v rules = %v", ev.Severity, ev.File.Indicators, ev.File.YaraRules)
+	}
+
+	fm.SetYaraRules(nil)
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: path, Op: fsnotify.Write})
+	if ev := <-ch; len(ev.File.YaraRules) != 0 {
+		t.Errorf("scanned without rules: %v", ev.File.YaraRules)
+	}
+}
+
+func TestFileMonitor_OccurredAt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(path, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	orig := time.Now().Add(-time.Hour)
+	os.Chtimes(path, orig, orig)
+	ch := make(chan collector.SecurityEvent, 4)
+	fm, err := New(Config{WatchPaths: []string{path}, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	next := func(op fsnotify.Op) collector.SecurityEvent {
+		t.Helper()
+		fm.handleFsEvent(context.Background(), fsnotify.Event{Name: path, Op: op})
+		return <-ch
+	}
+
+	// A write noticed late is dated by its mtime, not when it was handled.
+	written := time.Now().Add(-8 * time.Second).Truncate(time.Second)
+	os.WriteFile(path, []byte("v2"), 0o600)
+	os.Chtimes(path, written, written)
+	if ev := next(fsnotify.Write); !ev.OccurredAt.Equal(written) || !ev.Timestamp.After(written) {
+		t.Errorf("write: occurred %v observed %v, want occurred %v", ev.OccurredAt, ev.Timestamp, written)
+	}
+
+	// chmod does not touch the mtime, and a future mtime is not trusted.
+	if ev := next(fsnotify.Chmod); !ev.OccurredAt.IsZero() {
+		t.Errorf("chmod: OccurredAt = %v, want zero", ev.OccurredAt)
+	}
+	future := time.Now().Add(time.Hour)
+	os.WriteFile(path, []byte("v3"), 0o600)
+	os.Chtimes(path, future, future)
+	if ev := next(fsnotify.Write); !ev.OccurredAt.IsZero() {
+		t.Errorf("future mtime: OccurredAt = %v, want zero", ev.OccurredAt)
+	}
+}
+
+func TestFileMonitor_rescan(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "app.conf")
+	gone := filepath.Join(dir, "gone.conf")
+	single := filepath.Join(t.TempDir(), "authorized_keys")
+	for _, p := range []string{conf, gone, single} {
+		if err := os.WriteFile(p, []byte("original"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ch := make(chan collector.SecurityEvent, 10)
+	fm, err := New(Config{WatchPaths: []string{dir, single}, EventChan: ch}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.watcher.Close()
+	old := fm.baseline[conf].Hash
+
+	// Changes the watcher never reported: Start is not running.
+	mtime := fm.baseline[conf].ModTime
+	if err := os.WriteFile(conf, []byte("tampered"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(conf, mtime, mtime)
+	os.Remove(gone)
+	os.Chmod(single, 0o644)
+	added := filepath.Join(dir, "dropper.sh")
+	os.WriteFile(added, []byte("#!/bin/sh"), 0o700)
+
+	fm.rescan(context.Background())
+	got := map[string]collector.SecurityEvent{}
+	for len(ch) > 0 {
+		ev := <-ch
+		if ev.Metadata[MetadataDetectedBy] != DetectedByRescan {
+			t.Errorf("metadata = %v", ev.Metadata)
+		}
+		got[ev.File.Path+" "+ev.File.Operation] = ev
+	}
+	if len(got) != 4 {
+		t.Errorf("events = %v", got)
+	}
+	mod, ok := got[conf+" modify"]
+	if !ok || mod.File.OldHash != old || mod.File.NewHash == old || len(mod.File.Indicators) != 1 || mod.Severity != collector.SeverityHigh {
+		t.Errorf("modify = %+v", mod.File)
+	}
+	if ev, ok := got[gone+" delete"]; !ok || ev.Type != collector.EventTypeFileDelete {
+		t.Errorf("delete = %+v", ev)
+	}
+	if _, ok := got[single+" chmod"]; !ok {
+		t.Error("mode change not reported")
+	}
+	if ev, ok := got[added+" create"]; !ok || ev.Type != collector.EventTypeFileCreate {
+		t.Errorf("create = %+v", ev)
+	}
+
+	// Drift is reported once.
+	fm.rescan(context.Background())
+	if len(ch) != 0 {
+		t.Errorf("second rescan sent %d events", len(ch))
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	m, err := NewMatcher(
+		[]string{"/etc/passwd", "/app/config/*.yaml", "/home/*/.ssh", "/srv/**/*.conf", "/usr/bin"},
+		[]string{"*.log", "/srv/cache/**", "/usr/bin/python*"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{
+		"/etc/passwd":                      true,
+		"/etc/group":                       false,
+		"/app/config/db.yaml":              true,
+		"/app/config/db.json":              false,
+		"/app/config/sub/db.yaml":          false,
+		"/home/alice/.ssh/authorized_keys": true,
+		"/srv/app.conf":                    true,
+		"/srv/a/b/app.conf":                true,
+		"/srv/cache/app.conf":              false,
+		"/srv/a/debug.log":                 false,
+		"/usr/bin/ls":                      true,
+		"/usr/bin/python3":                 false,
+		"/usr/bin/audit.log":               false,
+	} {
+		if got := m.Match(p); got != want {
+			t.Errorf("Match(%s) = %v, want %v", p, got, want)
+		}
+	}
+	for p, want := range map[string]bool{
+		"/etc":         true,
+		"/app":         true,
+		"/app/config":  true,
+		"/app/other":   false,
+		"/home/bob":    true,
+		"/srv/a/b":     true,
+		"/srv/cache":   false,
+		"/var":         false,
+		"/usr/bin/sub": true,
+	} {
+		if got := m.WatchDir(p); got != want {
+			t.Errorf("WatchDir(%s) = %v, want %v", p, got, want)
+		}
+	}
+	roots := m.Roots()
+	want := []string{"/etc/passwd", "/app/config", "/home", "/srv", "/usr/bin"}
+	for i := range want {
+		if roots[i] != want[i] {
+			t.Errorf("roots = %v, want %v", roots, want)
+			break
+		}
+	}
+
+	if _, err := NewMatcher([]string{"/app/[config"}, nil); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestFileMonitor_GlobWatchPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"config/app.yaml", "config/app.json", "config/debug.log.yaml", "cache/x.yaml"} {
+		p = filepath.Join(dir, p)
+		os.MkdirAll(filepath.Dir(p), 0o700)
+		if err := os.WriteFile(p, []byte(p), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ch := make(chan collector.SecurityEvent, 10)
+	fm, err := New(Config{
+		WatchPaths:   []string{filepath.Join(dir, "*/*.yaml")},
+		WatchExclude: []string{"debug.*", filepath.Join(dir, "cache")},
+		EventChan:    ch,
+	}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.watcher.Close()
+	if len(fm.baseline) != 1 || fm.baseline[filepath.Join(dir, "config/app.yaml")] == nil {
+		t.Errorf("baseline = %v", fm.baseline)
+	}
+
+	// Events on uncovered files in a watched directory are ignored.
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: filepath.Join(dir, "config/app.json"), Op: fsnotify.Write})
+	if len(ch) != 0 {
+		t.Errorf("uncovered file raised %d events", len(ch))
+	}
+	added := filepath.Join(dir, "config/new.yaml")
+	os.WriteFile(added, []byte("x"), 0o600)
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: added, Op: fsnotify.Create})
+	if len(ch) != 1 {
+		t.Fatalf("covered file raised %d events", len(ch))
+	}
+	<-ch
+
+	// Lifting the cache exclusion baselines its files without reporting them.
+	fm.SetWatchExclude([]string{"debug.*"})
+	if fm.baseline[filepath.Join(dir, "cache/x.yaml")] == nil || len(ch) != 0 {
+		t.Errorf("baseline = %v, events = %d", fm.baseline, len(ch))
+	}
+	fm.SetWatchExclude([]string{"*.yaml"})
+	if len(fm.baseline) != 0 {
+		t.Errorf("excluded files still baselined: %v", fm.baseline)
+	}
+}
+
+func TestFileMonitor_CredentialPaths(t *testing.T) {
+	dir := t.TempDir()
+	aws := filepath.Join(dir, "aws")
+	sa := filepath.Join(dir, "serviceaccount")
+	data := filepath.Join(sa, "..2026_10_16_08_00_00.1")
+	for _, d := range []string{aws, data} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	creds := filepath.Join(aws, "credentials")
+	os.WriteFile(creds, []byte("[default]"), 0o600)
+	os.WriteFile(filepath.Join(data, "token"), []byte("t1"), 0o600)
+	os.Symlink(filepath.Base(data), filepath.Join(sa, "..data"))
+	token := filepath.Join(sa, "token")
+	os.Symlink(filepath.Join("..data", "token"), token)
+
+	ch := make(chan collector.SecurityEvent, 4)
+	fm, err := New(Config{EventChan: ch, CredentialPaths: []string{aws, sa}}, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !fm.currentMatcher().Match(creds) {
+		t.Fatal("credential paths are not watched")
+	}
+
+	os.WriteFile(creds, []byte("[default]\naws_access_key_id = AKIA"), 0o600)
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: creds, Op: fsnotify.Write})
+	ev := <-ch
+	if ev.File.Path != creds || !slices.Contains(ev.File.Indicators, IndicatorCredentialAccess) {
+		t.Errorf("file = %+v", ev.File)
+	}
+
+	// A token rotation only touches kubelet-managed entries.
+	os.WriteFile(filepath.Join(data, "token"), []byte("t2"), 0o600)
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: token, Op: fsnotify.Write})
+	fm.handleFsEvent(context.Background(), fsnotify.Event{Name: filepath.Join(data, "token"), Op: fsnotify.Write})
+	fm.rescan(context.Background())
+	if len(ch) != 0 {
+		t.Errorf("reported kubelet update: %+v", (<-ch).File)
+	}
+
+	fm.SetWatchPaths(nil)
+	if !fm.currentMatcher().Match(creds) {
+		t.Error("credential paths dropped by SetWatchPaths")
+	}
+}
+
+func TestExpandCredentialPaths(t *testing.T) {
+	got := ExpandCredentialPaths([]string{"/var/run/secrets/x", "~/.aws"})
+	want := []string{"/var/run/secrets/x", "/root/.aws", "/home/*/.aws"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExpandCredentialPaths = %v", got)
+	}
+}
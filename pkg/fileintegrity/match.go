@@ -0,0 +1,174 @@
+package fileintegrity
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Matcher decides which files the monitor covers. A watch path is either a
+// literal file or directory, covering everything beneath it, or a glob
+// pattern such as /app/config/*.yaml. Exclusions are globs too; one without
+// a slash, such as *.log, is matched against every name in the path. Globs
+// use path.Match syntax per path segment, plus ** for any number of
+// segments, and a match on a directory covers everything beneath it.
+type Matcher struct {
+	watch   [][]string
+	literal []bool
+	exclude [][]string
+	names   []string
+}
+
+// ValidatePattern reports whether p is a well-formed watch or exclude
+// pattern.
+func ValidatePattern(p string) error {
+	for _, seg := range strings.Split(p, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// NewMatcher compiles watch paths and exclusions. Invalid patterns are
+// returned as an error and left out of the matcher.
+func NewMatcher(watch, exclude []string) (*Matcher, error) {
+	m := &Matcher{}
+	var errs []string
+	for _, p := range watch {
+		if err := ValidatePattern(p); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		m.watch = append(m.watch, splitPath(p))
+		m.literal = append(m.literal, !hasMeta(p))
+	}
+	for _, p := range exclude {
+		if err := ValidatePattern(p); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			m.names = append(m.names, p)
+		} else {
+			m.exclude = append(m.exclude, splitPath(p))
+		}
+	}
+	if len(errs) > 0 {
+		return m, fmt.Errorf("invalid watch patterns: %s", strings.Join(errs, "; "))
+	}
+	return m, nil
+}
+
+// Roots returns the directories or files to walk: each literal watch path,
+// and the longest literal directory at the head of each pattern.
+func (m *Matcher) Roots() []string {
+	roots := make([]string, 0, len(m.watch))
+	for _, segs := range m.watch {
+		n := 0
+		for n < len(segs) && !hasMeta(segs[n]) {
+			n++
+		}
+		root := strings.Join(segs[:n], "/")
+		if root == "" {
+			root = "/"
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// Match reports whether the monitor covers p.
+func (m *Matcher) Match(p string) bool {
+	segs := splitPath(p)
+	if m.excluded(segs) {
+		return false
+	}
+	for _, w := range m.watch {
+		if matchSegments(w, segs) {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchDir reports whether dir needs a watch: it could hold a covered file,
+// or it is the parent of a literal watch path.
+func (m *Matcher) WatchDir(dir string) bool {
+	segs := splitPath(dir)
+	if m.excluded(segs) {
+		return false
+	}
+	for i, w := range m.watch {
+		if matchPrefix(w, segs) || m.literal[i] && len(w) == len(segs)+1 && matchSegments(w[:len(segs)], segs) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) excluded(segs []string) bool {
+	for _, e := range m.exclude {
+		if matchSegments(e, segs) {
+			return true
+		}
+	}
+	for _, name := range m.names {
+		for _, seg := range segs {
+			if ok, _ := path.Match(name, seg); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSegments reports whether segs, or one of its ancestors, matches the
+// pattern pat.
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return true
+}
+
+// matchPrefix reports whether a path beneath segs could match pat.
+func matchPrefix(pat, segs []string) bool {
+	for len(segs) > 0 {
+		if len(pat) == 0 || pat[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return true
+}
+
+func splitPath(p string) []string {
+	p = filepath.Clean(p)
+	if p == "/" {
+		return []string{""}
+	}
+	return strings.Split(p, "/")
+}
+
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[\`)
+}
@@ -0,0 +1,55 @@
+package fileintegrity
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/yara"
+)
+
+// IndicatorYaraMatch marks a file whose content matched YARA rules, named in
+// the event's YaraRules.
+const IndicatorYaraMatch = "yara_match"
+
+// yaraMaxFileSize bounds the files scanned with YARA rules, which are read
+// into memory whole.
+const yaraMaxFileSize = 32 << 20
+
+// yaraScanner scans files with the YARA rules pushed by the controller. The
+// rules are swapped while the monitor runs.
+type yaraScanner struct {
+	rules atomic.Pointer[yara.Rules]
+}
+
+// SetYaraRules replaces the YARA rules new and changed files are scanned
+// with; nil stops scanning.
+func (s *yaraScanner) SetYaraRules(rules *yara.Rules) {
+	s.rules.Store(rules)
+}
+
+// scanFile returns the names of the rules path matches. Without rules, and
+// for files that cannot be read or are over yaraMaxFileSize, it returns nil.
+func (s *yaraScanner) scanFile(path string) []string {
+	rules := s.rules.Load()
+	if rules == nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() || info.Size() > yaraMaxFileSize {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(f, yaraMaxFileSize))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, m := range rules.Scan(data) {
+		names = append(names, m.Rule)
+	}
+	return names
+}
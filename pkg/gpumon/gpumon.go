@@ -0,0 +1,406 @@
+// Package gpumon watches for GPU use a pod is not meant to make: processes
+// opening NVIDIA devices, nvidia-smi probing for GPUs, and sustained GPU
+// utilization in pods not labeled as GPU workloads. Cryptominers that land
+// in a GPU pool do all three.
+package gpumon
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/jitter"
+)
+
+// Indicators in ProcessEvent.SuspiciousIndicators.
+const (
+	IndicatorGPUDeviceAccess = "gpu_device_access"
+	IndicatorNvidiaSMI       = "nvidia_smi"
+)
+
+// AnomalyGPUUtilization is the ResourceEvent.AnomalyType of sustained GPU
+// utilization; AnomalyScore is the utilization as a fraction.
+const AnomalyGPUUtilization = "gpu_utilization"
+
+// utilMetric is the dcgm-exporter gauge of GPU utilization in percent.
+const utilMetric = "DCGM_FI_DEV_GPU_UTIL"
+
+// nvidiaSMIPaths are where nvidia-smi is found in container images and, on
+// GKE, where the driver installer mounts it.
+var nvidiaSMIPaths = []string{
+	"/usr/bin/nvidia-smi",
+	"/usr/local/bin/nvidia-smi",
+	"/usr/local/nvidia/bin/nvidia-smi",
+}
+
+// Config for GPU monitoring
+type Config struct {
+	ScanInterval time.Duration
+	// PodName and PodNamespace select this pod's series from MetricsURL.
+	PodName      string
+	PodNamespace string
+	// Workload is set for pods labeled as GPU workloads. Their GPU use and
+	// nvidia-smi are expected; only device access by processes outside
+	// AllowedProcesses, if any are set, is reported.
+	Workload bool
+	// AllowedProcesses are patterns of process names or command lines
+	// expected to open GPU devices.
+	AllowedProcesses []string
+	// MetricsURL is a dcgm-exporter /metrics endpoint with per-pod
+	// DCGM_FI_DEV_GPU_UTIL series; empty disables the utilization check.
+	MetricsURL string
+	// Utilization of at least UtilPercent for UtilScans scans in a row in a
+	// pod that is not a GPU workload raises an anomaly.
+	UtilPercent int
+	UtilScans   int
+	EventChan   chan<- collector.SecurityEvent
+}
+
+// GPUMonitor scans processes for GPU device use and polls GPU utilization.
+type GPUMonitor struct {
+	cfg     Config
+	log     *logrus.Logger
+	allowed []*regexp.Regexp
+	http    *http.Client
+	// procRoot is /proc, replaced in tests.
+	procRoot string
+
+	// Scan goroutine only: what was reported of each process, keyed by PID
+	// and start time, the nvidia-smi binaries reported, keyed by mount
+	// namespace and path, and the utilization streak.
+	procs       map[string]*procState
+	binaries    map[string]bool
+	utilScans   int
+	utilAlerted bool
+
+	scans *jitter.Schedule
+}
+
+type procState struct {
+	devices, smi bool
+}
+
+// New creates a new GPUMonitor
+func New(cfg Config, log *logrus.Logger) *GPUMonitor {
+	if cfg.ScanInterval <= 0 {
+		cfg.ScanInterval = 15 * time.Second
+	}
+	gm := &GPUMonitor{
+		cfg:      cfg,
+		log:      log,
+		http:     &http.Client{Timeout: 5 * time.Second},
+		procRoot: "/proc",
+		procs:    make(map[string]*procState),
+		binaries: make(map[string]bool),
+		scans:    jitter.NewSchedule(cfg.ScanInterval),
+	}
+	for _, pattern := range cfg.AllowedProcesses {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.WithError(err).WithField("pattern", pattern).Warn("Invalid GPU process pattern")
+			continue
+		}
+		gm.allowed = append(gm.allowed, re)
+	}
+	return gm
+}
+
+// Start begins GPU monitoring
+func (gm *GPUMonitor) Start(ctx context.Context) {
+	gm.log.WithField("workload", gm.cfg.Workload).Info("Starting GPU monitor")
+
+	ticker := gm.scans.NewTicker()
+	defer ticker.Stop()
+
+	gm.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			gm.log.Info("GPU monitor stopping")
+			return
+		case <-ticker.C:
+			gm.scan(ctx)
+		}
+	}
+}
+
+// SetSlowdown multiplies the scan interval by factor; 1 restores it.
+func (gm *GPUMonitor) SetSlowdown(factor int) {
+	gm.scans.SetSlowdown(factor)
+}
+
+// scan checks every process, then the pod's GPU utilization.
+func (gm *GPUMonitor) scan(ctx context.Context) {
+	entries, err := os.ReadDir(gm.procRoot)
+	if err != nil {
+		gm.log.WithError(err).Error("Failed to read /proc")
+		return
+	}
+	procs := make(map[string]*procState, len(gm.procs))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		proc, ok := gm.readProcess(pid)
+		if !ok {
+			continue
+		}
+		st := gm.procs[proc.key]
+		if st == nil {
+			st = &procState{}
+		}
+		procs[proc.key] = st
+		gm.checkProcess(ctx, proc, st)
+	}
+	// Exited processes are forgotten.
+	gm.procs = procs
+
+	if gm.cfg.MetricsURL != "" && !gm.cfg.Workload {
+		gm.checkUtilization(ctx)
+	}
+}
+
+// process is what the checks need to know about one process.
+type process struct {
+	pid     int
+	key     string
+	name    string
+	exe     string
+	cmdline []string
+	mntNS   string
+}
+
+func (gm *GPUMonitor) readProcess(pid int) (process, bool) {
+	dir := filepath.Join(gm.procRoot, strconv.Itoa(pid))
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return process{}, false
+	}
+	// The start time, field 22, tells a reused PID from the process
+	// already reported.
+	s := string(stat)
+	var startTime string
+	if end := strings.LastIndex(s, ")"); end != -1 && end+2 <= len(s) {
+		if fields := strings.Fields(s[end+2:]); len(fields) > 19 {
+			startTime = fields[19]
+		}
+	}
+	p := process{pid: pid, key: strconv.Itoa(pid) + ":" + startTime}
+	if comm, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		p.name = strings.TrimSpace(string(comm))
+	}
+	p.exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		p.cmdline = strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	}
+	p.mntNS, _ = os.Readlink(filepath.Join(dir, "ns", "mnt"))
+	return p, true
+}
+
+// checkProcess reports a process holding GPU devices open that should not,
+// nvidia-smi running, and nvidia-smi installed in the process's container,
+// each once.
+func (gm *GPUMonitor) checkProcess(ctx context.Context, p process, st *procState) {
+	dir := filepath.Join(gm.procRoot, strconv.Itoa(p.pid))
+
+	if devices := gpuDevices(dir); !st.devices && len(devices) > 0 && !gm.expected(p) {
+		st.devices = true
+		gm.log.WithFields(logrus.Fields{"pid": p.pid, "name": p.name, "devices": devices}).Warn("Unexpected process using GPU devices")
+		gm.emit(ctx, gm.processEvent(p, collector.SeverityHigh, IndicatorGPUDeviceAccess, map[string]string{
+			"gpu_devices": strings.Join(devices, ","),
+		}))
+	}
+
+	if gm.cfg.Workload {
+		return
+	}
+	if p.name == "nvidia-smi" && !st.smi {
+		st.smi = true
+		gm.emit(ctx, gm.processEvent(p, collector.SeverityMedium, IndicatorNvidiaSMI, map[string]string{"nvidia_smi": "executed"}))
+	}
+	if p.mntNS == "" {
+		return
+	}
+	for _, path := range nvidiaSMIPaths {
+		key := p.mntNS + ":" + path
+		if gm.binaries[key] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, "root", path)); err != nil {
+			continue
+		}
+		gm.binaries[key] = true
+		gm.log.WithFields(logrus.Fields{"pid": p.pid, "path": path}).Warn("nvidia-smi present in a pod that is not a GPU workload")
+		gm.emit(ctx, gm.processEvent(p, collector.SeverityMedium, IndicatorNvidiaSMI, map[string]string{"nvidia_smi": path}))
+	}
+}
+
+// expected reports whether p may use the GPU: in a GPU workload, any
+// process when no patterns are set, otherwise those matching one.
+func (gm *GPUMonitor) expected(p process) bool {
+	if !gm.cfg.Workload {
+		return false
+	}
+	if len(gm.allowed) == 0 {
+		return true
+	}
+	cmdline := strings.Join(p.cmdline, " ")
+	for _, re := range gm.allowed {
+		if re.MatchString(p.name) || re.MatchString(cmdline) {
+			return true
+		}
+	}
+	return false
+}
+
+// gpuDevices returns the NVIDIA device files open in procPath/fd.
+func gpuDevices(procPath string) []string {
+	fdDir := filepath.Join(procPath, "fd")
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+	var devices []string
+	have := make(map[string]bool)
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+		if err != nil || !strings.HasPrefix(target, "/dev/nvidia") || have[target] {
+			continue
+		}
+		have[target] = true
+		devices = append(devices, target)
+	}
+	return devices
+}
+
+func (gm *GPUMonitor) processEvent(p process, severity collector.Severity, indicator string, metadata map[string]string) collector.SecurityEvent {
+	return collector.SecurityEvent{
+		Type:      collector.EventTypeResourceAnomaly,
+		Severity:  severity,
+		Timestamp: time.Now(),
+		Process: &collector.ProcessEvent{
+			PID:                  p.pid,
+			Name:                 p.name,
+			ExePath:              p.exe,
+			Cmdline:              p.cmdline,
+			SuspiciousIndicators: []string{indicator},
+		},
+		Metadata: metadata,
+	}
+}
+
+// checkUtilization raises an anomaly the first time the pod's GPUs stay at
+// UtilPercent or more for UtilScans scans, and re-arms once they drop.
+func (gm *GPUMonitor) checkUtilization(ctx context.Context) {
+	util, ok, err := gm.podUtilization(ctx)
+	if err != nil {
+		gm.log.WithError(err).Debug("Cannot read GPU utilization")
+		return
+	}
+	if !ok || util < float64(gm.cfg.UtilPercent) {
+		gm.utilScans, gm.utilAlerted = 0, false
+		return
+	}
+	gm.utilScans++
+	if gm.cfg.UtilScans <= 0 || gm.utilScans < gm.cfg.UtilScans || gm.utilAlerted {
+		return
+	}
+	gm.utilAlerted = true
+
+	gm.log.WithFields(logrus.Fields{"utilization": util, "scans": gm.utilScans}).Warn("Sustained GPU utilization in a pod that is not a GPU workload")
+	gm.emit(ctx, collector.SecurityEvent{
+		Type:      collector.EventTypeResourceAnomaly,
+		Severity:  collector.SeverityHigh,
+		Timestamp: time.Now(),
+		Resource: &collector.ResourceEvent{
+			AnomalyType:  AnomalyGPUUtilization,
+			AnomalyScore: util / 100,
+		},
+		Metadata: map[string]string{
+			"gpu_utilization_percent": strconv.FormatFloat(util, 'f', 0, 64),
+			"gpu_utilization_scans":   strconv.Itoa(gm.utilScans),
+		},
+	})
+}
+
+// podUtilization returns the highest utilization of the GPUs dcgm-exporter
+// attributes to this pod, and false if it attributes none.
+func (gm *GPUMonitor) podUtilization(ctx context.Context) (float64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gm.cfg.MetricsURL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := gm.http.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	util, ok := parseUtilization(resp.Body, gm.cfg.PodNamespace, gm.cfg.PodName)
+	return util, ok, nil
+}
+
+var labelPattern = regexp.MustCompile(`(\w+)="((?:[^"\\]|\\.)*)"`)
+
+// parseUtilization reads Prometheus text exposition and returns the highest
+// DCGM_FI_DEV_GPU_UTIL of the series labeled with the pod.
+func parseUtilization(r io.Reader, namespace, pod string) (float64, bool) {
+	var (
+		highest float64
+		found   bool
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, utilMetric+"{") {
+			continue
+		}
+		end := strings.LastIndex(line, "}")
+		if end == -1 {
+			continue
+		}
+		labels := make(map[string]string)
+		for _, m := range labelPattern.FindAllStringSubmatch(line[len(utilMetric)+1:end], -1) {
+			labels[m[1]] = m[2]
+		}
+		if labels["namespace"] != namespace || labels["pod"] != pod {
+			continue
+		}
+		fields := strings.Fields(line[end+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		if !found || v > highest {
+			highest, found = v, true
+		}
+	}
+	return highest, found
+}
+
+func (gm *GPUMonitor) emit(ctx context.Context, event collector.SecurityEvent) {
+	select {
+	case gm.cfg.EventChan <- event:
+	case <-ctx.Done():
+	default:
+		gm.log.Debug("Event channel full, dropping GPU event")
+	}
+}
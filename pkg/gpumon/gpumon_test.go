@@ -0,0 +1,137 @@
+package gpumon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// fakeProc writes a /proc/<pid> with the given name, open fd targets and
+// files in its root filesystem.
+func fakeProc(t *testing.T, root string, pid int, name string, fds []string, files ...string) {
+	t.Helper()
+	dir := filepath.Join(root, fmt.Sprint(pid))
+	for _, sub := range []string{"fd", "ns", "root"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat := fmt.Sprintf("%d (%s) S 1 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 5000 0 0", pid, name)
+	os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o644)
+	os.WriteFile(filepath.Join(dir, "comm"), []byte(name+"\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "cmdline"), []byte(name+"\x00--run\x00"), 0o644)
+	os.Symlink(fmt.Sprintf("mnt:[%d]", 4000+pid), filepath.Join(dir, "ns", "mnt"))
+	for i, target := range fds {
+		os.Symlink(target, filepath.Join(dir, "fd", fmt.Sprint(i)))
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, "root", f)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, nil, 0o755)
+	}
+}
+
+func drain(events chan collector.SecurityEvent) map[string][]collector.SecurityEvent {
+	got := make(map[string][]collector.SecurityEvent)
+	for {
+		select {
+		case e := <-events:
+			key := ""
+			if e.Process != nil {
+				key = e.Process.Name + ":" + e.Process.SuspiciousIndicators[0]
+			} else {
+				key = e.Resource.AnomalyType
+			}
+			got[key] = append(got[key], e)
+		default:
+			return got
+		}
+	}
+}
+
+func TestGPUMonitor_processes(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, 10, "xmrig", []string{"/dev/nvidia0", "/dev/nvidiactl", "/dev/nvidia0", "pipe:[1]"})
+	fakeProc(t, root, 11, "python", []string{"/dev/nvidia0"}, "usr/local/nvidia/bin/nvidia-smi")
+	fakeProc(t, root, 12, "nvidia-smi", nil)
+
+	events := make(chan collector.SecurityEvent, 10)
+	gm := New(Config{EventChan: events}, logrus.New())
+	gm.procRoot = root
+	gm.scan(context.Background())
+	gm.scan(context.Background())
+
+	got := drain(events)
+	if e := got["xmrig:gpu_device_access"]; len(e) != 1 || e[0].Severity != collector.SeverityHigh || e[0].Metadata["gpu_devices"] != "/dev/nvidia0,/dev/nvidiactl" {
+		t.Errorf("xmrig device access = %+v", e)
+	}
+	if e := got["python:nvidia_smi"]; len(e) != 1 || e[0].Metadata["nvidia_smi"] != "/usr/local/nvidia/bin/nvidia-smi" {
+		t.Errorf("nvidia-smi binary = %+v", e)
+	}
+	if e := got["nvidia-smi:nvidia_smi"]; len(e) != 1 || e[0].Metadata["nvidia_smi"] != "executed" {
+		t.Errorf("nvidia-smi run = %+v", e)
+	}
+	if len(got) != 4 {
+		t.Errorf("events = %v", got)
+	}
+
+	// In a GPU workload, only processes outside the allowlist are reported.
+	gm = New(Config{EventChan: events, Workload: true, AllowedProcesses: []string{"^python$"}}, logrus.New())
+	gm.procRoot = root
+	gm.scan(context.Background())
+	got = drain(events)
+	if len(got) != 1 || len(got["xmrig:gpu_device_access"]) != 1 {
+		t.Errorf("workload events = %v", got)
+	}
+}
+
+func TestGPUMonitor_utilization(t *testing.T) {
+	util := "97"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# TYPE DCGM_FI_DEV_GPU_UTIL gauge\n"+
+			"DCGM_FI_DEV_GPU_UTIL{gpu=\"0\",UUID=\"GPU-1\",namespace=\"ml\",pod=\"other\"} 100\n"+
+			"DCGM_FI_DEV_GPU_UTIL{gpu=\"1\",UUID=\"GPU-2\",namespace=\"ml\",pod=\"web-1\"} %s\n"+
+			"DCGM_FI_DEV_MEM_COPY_UTIL{gpu=\"1\",namespace=\"ml\",pod=\"web-1\"} 99\n", util)
+	}))
+	defer srv.Close()
+
+	events := make(chan collector.SecurityEvent, 10)
+	gm := New(Config{EventChan: events, PodNamespace: "ml", PodName: "web-1", MetricsURL: srv.URL, UtilPercent: 80, UtilScans: 2}, logrus.New())
+	gm.procRoot = t.TempDir()
+	for i := 0; i < 3; i++ {
+		gm.scan(context.Background())
+	}
+	got := drain(events)[AnomalyGPUUtilization]
+	if len(got) != 1 || got[0].Resource.AnomalyScore != 0.97 || got[0].Metadata["gpu_utilization_percent"] != "97" {
+		t.Fatalf("utilization events = %+v", got)
+	}
+
+	// It re-arms once utilization drops.
+	util = "5"
+	gm.scan(context.Background())
+	util = "90"
+	gm.scan(context.Background())
+	gm.scan(context.Background())
+	if got := drain(events)[AnomalyGPUUtilization]; len(got) != 1 {
+		t.Errorf("re-armed events = %d, want 1", len(got))
+	}
+}
+
+func TestParseUtilization(t *testing.T) {
+	in := `DCGM_FI_DEV_GPU_UTIL{namespace="ml",pod="a",container="x\"y"} 12` + "\n" + `DCGM_FI_DEV_GPU_UTIL{namespace="ml",pod="a"} 40 1700000000000`
+	if v, ok := parseUtilization(strings.NewReader(in), "ml", "a"); !ok || v != 40 {
+		t.Errorf("utilization = %v, %v", v, ok)
+	}
+	if _, ok := parseUtilization(strings.NewReader(in), "ml", "b"); ok {
+		t.Error("found utilization for another pod")
+	}
+}
@@ -0,0 +1,142 @@
+// Package jitter spreads periodic work of many agents over time. Pods that
+// restart together, such as during a node upgrade, would otherwise scan and
+// report to the controller in lockstep.
+package jitter
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Duration returns a random duration in [0, max), or 0 if max is not
+// positive.
+func Duration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// Ticker is a time.Ticker whose first tick comes after a random phase
+// within its period rather than a full period after it was created, so
+// tickers started at the same time do not fire together.
+type Ticker struct {
+	C    <-chan time.Time
+	stop chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	period time.Duration
+	reset  chan struct{}
+}
+
+// NewTicker returns a Ticker with period, which must be positive. Like a
+// time.Ticker, it drops ticks for slow receivers.
+func NewTicker(period time.Duration) *Ticker {
+	c := make(chan time.Time, 1)
+	t := &Ticker{C: c, stop: make(chan struct{}), period: period, reset: make(chan struct{}, 1)}
+	go t.run(c, period)
+	return t
+}
+
+func (t *Ticker) run(c chan<- time.Time, period time.Duration) {
+	phase := time.NewTimer(Duration(period))
+wait:
+	for {
+		select {
+		case <-t.stop:
+			phase.Stop()
+			return
+		case <-t.reset:
+			// The phase stays within the old period; the new one applies
+			// from the first tick.
+		case now := <-phase.C:
+			c <- now
+			break wait
+		}
+	}
+	ticker := time.NewTicker(t.currentPeriod())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-t.reset:
+			ticker.Reset(t.currentPeriod())
+		case now := <-ticker.C:
+			select {
+			case c <- now:
+			default:
+			}
+		}
+	}
+}
+
+func (t *Ticker) currentPeriod() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.period
+}
+
+// Reset changes the ticker's period, which must be positive. The next tick
+// comes a full new period after the call.
+func (t *Ticker) Reset(period time.Duration) {
+	t.mu.Lock()
+	t.period = period
+	t.mu.Unlock()
+	select {
+	case t.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Stop turns off the ticker. It does not close C.
+func (t *Ticker) Stop() {
+	t.once.Do(func() { close(t.stop) })
+}
+
+// Schedule is the period of a monitor's scans, which can be stretched
+// while the monitor runs, such as during a monitoring brownout.
+type Schedule struct {
+	mu     sync.Mutex
+	period time.Duration
+	factor int
+	ticker *Ticker
+}
+
+// NewSchedule returns a Schedule of period, which must be positive.
+func NewSchedule(period time.Duration) *Schedule {
+	return &Schedule{period: period, factor: 1}
+}
+
+// Period returns the current, possibly stretched, period.
+func (s *Schedule) Period() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.period * time.Duration(s.factor)
+}
+
+// NewTicker returns a Ticker with the current period that follows later
+// changes of the slowdown. Only the latest Ticker follows them, so a
+// monitor restarted by its supervisor keeps its schedule.
+func (s *Schedule) NewTicker() *Ticker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ticker = NewTicker(s.period * time.Duration(s.factor))
+	return s.ticker
+}
+
+// SetSlowdown multiplies the period by factor; 1, or less, restores it.
+func (s *Schedule) SetSlowdown(factor int) {
+	factor = max(factor, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if factor == s.factor {
+		return
+	}
+	s.factor = factor
+	if s.ticker != nil {
+		s.ticker.Reset(s.period * time.Duration(factor))
+	}
+}
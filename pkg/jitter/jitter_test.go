@@ -0,0 +1,77 @@
+package jitter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	if d := Duration(0); d != 0 {
+		t.Errorf("Duration(0) = %v", d)
+	}
+	for i := 0; i < 100; i++ {
+		if d := Duration(time.Second); d < 0 || d >= time.Second {
+			t.Fatalf("Duration(1s) = %v", d)
+		}
+	}
+}
+
+func TestTicker(t *testing.T) {
+	const period = 50 * time.Millisecond
+	start := time.Now()
+	tk := NewTicker(period)
+	defer tk.Stop()
+
+	first := <-tk.C
+	if took := first.Sub(start); took > period+20*time.Millisecond {
+		t.Errorf("first tick after %v, want within one period", took)
+	}
+	second := <-tk.C
+	if gap := second.Sub(first); gap < period-10*time.Millisecond {
+		t.Errorf("ticks %v apart, want %v", gap, period)
+	}
+
+	tk.Stop()
+	tk.Stop()
+	select {
+	case <-tk.C:
+	default:
+	}
+	select {
+	case <-tk.C:
+		t.Error("tick after Stop")
+	case <-time.After(2 * period):
+	}
+}
+
+func TestSchedule_SetSlowdown(t *testing.T) {
+	const period = 20 * time.Millisecond
+	s := NewSchedule(period)
+	tk := s.NewTicker()
+	defer tk.Stop()
+	<-tk.C
+
+	s.SetSlowdown(10)
+	if got := s.Period(); got != 10*period {
+		t.Errorf("Period() = %v, want %v", got, 10*period)
+	}
+	select {
+	case <-tk.C:
+	default:
+	}
+	select {
+	case <-tk.C:
+		t.Error("tick within the old period after slowing down")
+	case <-time.After(5 * period):
+	}
+
+	s.SetSlowdown(0)
+	if got := s.Period(); got != period {
+		t.Errorf("Period() = %v after restoring, want %v", got, period)
+	}
+	select {
+	case <-tk.C:
+	case <-time.After(5 * period):
+		t.Error("no tick after restoring the period")
+	}
+}
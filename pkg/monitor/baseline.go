@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+// syncBaseline compares the files hashed at startup with the workload's
+// signed baseline from the controller, or offers them as the baseline when
+// the controller has none. It reports whether it is done; a failed fetch or
+// upload is retried on the next heartbeat. A baseline with a bad signature
+// is not used and not retried, as fetching it again gives the same one.
+func (m *Monitor) syncBaseline(ctx context.Context) bool {
+	data, err := m.collector.FetchBaseline(ctx)
+	if err != nil {
+		m.log.WithError(err).Debug("Failed to fetch file baseline")
+		return false
+	}
+	if data == nil {
+		err := m.collector.UploadBaseline(ctx, mustJSON(m.fileMon.Export("")))
+		switch {
+		case errors.Is(err, collector.ErrBaselineExists):
+			// Another replica won; compare against it next time.
+			return false
+		case err != nil:
+			m.log.WithError(err).Debug("Failed to upload file baseline")
+			return false
+		}
+		m.log.Info("No file baseline for workload, offered startup hashes as baseline")
+		return true
+	}
+
+	var b fileintegrity.Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		m.log.WithError(err).Error("Invalid file baseline from controller, not comparing")
+		return true
+	}
+	if err := b.Verify(m.baselineKey); err != nil {
+		m.log.WithError(err).WithField("baseline_key", b.Key).Error("File baseline signature invalid, not comparing")
+		return true
+	}
+	diffs := m.fileMon.CompareBaseline(ctx, &b)
+	m.log.WithFields(logrus.Fields{
+		"baseline_key": b.Key, "baseline_created_at": b.CreatedAt, "differences": diffs,
+	}).Info("Compared files with signed baseline")
+	return true
+}
+
+func mustJSON(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
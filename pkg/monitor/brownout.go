@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pollBrownout fetches the brownout from the controller and slows the scans
+// of every monitor down while it lasts. A brownout that runs out ends here
+// too, so scans recover even when the controller is unreachable.
+func (m *Monitor) pollBrownout(ctx context.Context) {
+	now := time.Now()
+	b, etag, err := m.collector.FetchBrownout(ctx, m.brownoutETag)
+	if err != nil {
+		m.log.WithError(err).Debug("Failed to fetch brownout")
+		m.expireBrownout(now)
+		return
+	}
+	if etag == m.brownoutETag {
+		m.expireBrownout(now)
+		return
+	}
+	m.brownoutETag = etag
+	if b == nil || !now.Before(b.Until) {
+		m.endBrownout()
+		return
+	}
+	m.setSlowdown(b.Factor)
+	m.brownoutUntil = b.Until
+	m.log.WithFields(logrus.Fields{
+		"factor": b.Factor,
+		"until":  b.Until,
+		"reason": b.Reason,
+	}).Warn("Monitoring brownout from controller, scanning less often")
+}
+
+// expireBrownout ends the brownout if it ran out by now.
+func (m *Monitor) expireBrownout(now time.Time) {
+	if !m.brownoutUntil.IsZero() && !now.Before(m.brownoutUntil) {
+		m.endBrownout()
+	}
+}
+
+// endBrownout restores the monitors' scan intervals.
+func (m *Monitor) endBrownout() {
+	if m.brownoutUntil.IsZero() {
+		return
+	}
+	m.setSlowdown(1)
+	m.brownoutUntil = time.Time{}
+	m.log.Info("Monitoring brownout ended, scan intervals restored")
+}
+
+// setSlowdown multiplies the scan intervals of every monitor by factor.
+// Watches and process connector events are not slowed down.
+func (m *Monitor) setSlowdown(factor int) {
+	if m.procMon != nil {
+		m.procMon.SetSlowdown(factor)
+	}
+	m.netMon.SetSlowdown(factor)
+	m.fileMon.SetSlowdown(factor)
+	if m.diskMon != nil {
+		m.diskMon.SetSlowdown(factor)
+	}
+	if m.gpuMon != nil {
+		m.gpuMon.SetSlowdown(factor)
+	}
+}
@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Agent health values
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// Health is the agent health report served on the health endpoint
+type Health struct {
+	Status       string                   `json:"status"`
+	AgentID      string                   `json:"agent_id"`
+	DegradedMode bool                     `json:"degraded_mode"`
+	Monitors     map[string]MonitorStatus `json:"monitors"`
+}
+
+// Health reports ok when every supervised monitor is running
+func (m *Monitor) Health() Health {
+	h := Health{
+		Status:       HealthOK,
+		AgentID:      m.cfg.AgentID,
+		DegradedMode: m.cfg.DegradedMode,
+		Monitors:     m.MonitorStatuses(),
+	}
+	for _, st := range h.Monitors {
+		if st.State != MonitorStateRunning {
+			h.Status = HealthDegraded
+			break
+		}
+	}
+	return h
+}
+
+// HealthHandler serves the health report, with 503 when any monitor is not running
+func (m *Monitor) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := m.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if h.Status != HealthOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(h)
+	})
+}
+
+// serveHealth runs the health endpoint until ctx is cancelled
+func (m *Monitor) serveHealth(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", m.HealthHandler())
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{
+		Addr:        m.cfg.HealthAddr,
+		Handler:     mux,
+		ReadTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	m.log.WithField("addr", m.cfg.HealthAddr).Info("Serving agent health endpoint")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		m.log.WithError(err).Error("Agent health endpoint failed")
+	}
+}
@@ -2,6 +2,10 @@ package monitor
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -9,7 +13,10 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/diskusage"
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/gpumon"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/jitter"
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/netpolicy"
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/procmon"
 )
@@ -20,17 +27,115 @@ type AgentConfig struct {
 	PodName            string
 	PodNamespace       string
 	NodeName           string
+	PodIP              string
+	ServiceAccount     string
 	ControllerEndpoint string
+	ControllerToken    string
+	// Version is the agent build version reported at registration.
+	Version string
 
 	// Monitoring intervals
 	ProcScanInterval time.Duration
 	NetScanInterval  time.Duration
 	FileScanInterval time.Duration
 
+	// FileBaselineKey is the PEM Ed25519 public key of the controller's
+	// file integrity baselines. When set, the agent compares its startup
+	// hashes with its workload's baseline, or offers them as the baseline
+	// if there is none yet
+	FileBaselineKey string
+
 	// Detection patterns
 	WatchPaths          []string
+	WatchExclude        []string
 	SuspiciousProcesses []string
 	SuspiciousPorts     []int
+	ExeHashAllowlist    []string
+	ExeHashDenylist     []string
+	// CredentialPaths are procmon.Config's and fileintegrity.Config's
+	CredentialPaths []string
+	// ListenBaseline is netpolicy.Config.ListenBaselineWindow
+	ListenBaseline time.Duration
+	// SMTPPorts and IRCPorts are netpolicy.Config's
+	SMTPPorts []int
+	IRCPorts  []int
+	// Connection fan-out thresholds; see netpolicy.FanoutConfig
+	FanoutConnections  int
+	FanoutDestinations int
+	FanoutSigma        float64
+
+	// Disk usage growth detection; no paths disables it
+	DiskWatchPaths   []string
+	DiskScanInterval time.Duration
+	DiskGrowthBytes  int64
+	DiskGrowthFiles  int
+
+	// Dropped executable detection; no paths disables it
+	DropWatchPaths []string
+
+	// Exhaustion thresholds in percent; 0 disables the check
+	InodeUsagePercent int
+	FDUsagePercent    int
+
+	// Sustained CPU use of a process, in percent of one core, and for how
+	// many process scans; 0 scans disables the check
+	HighCPUPercent int
+	HighCPUScans   int
+
+	// ProcEventMode is procmon.Config.EventMode
+	ProcEventMode string
+	// ProcScanMinInterval and ProcScanSamples are procmon.Config's
+	// MinScanInterval and ScanSamples
+	ProcScanMinInterval time.Duration
+	ProcScanSamples     int
+	// ProbeCommands and ExecProbePolicy are procmon.Config's ProbeCommands
+	// and ProbePolicy
+	ProbeCommands   [][]string
+	ExecProbePolicy string
+
+	// GPU monitoring; see gpumon.Config
+	GPUMonitor          bool
+	GPUWorkload         bool
+	GPUScanInterval     time.Duration
+	GPUAllowedProcesses []string
+	GPUMetricsURL       string
+	GPUUtilPercent      int
+	GPUUtilScans        int
+
+	// DegradedMode is set when the pod does not share its process namespace
+	// with the sidecar. Process monitoring is disabled since only the agent's
+	// own processes are visible; network and file monitoring still run.
+	DegradedMode bool
+
+	// Supervision: monitors that panic or exit early are restarted with
+	// exponential backoff starting at RestartBackoff, up to MaxMonitorRestarts times.
+	MaxMonitorRestarts int
+	RestartBackoff     time.Duration
+	HeartbeatInterval  time.Duration
+
+	// StartupJitter delays the monitors and registration by a random time
+	// up to it, so agents restarted together do not scan and report in
+	// lockstep; 0 starts them at once
+	StartupJitter time.Duration
+
+	// HealthAddr is the listen address of the agent health endpoint; empty disables it.
+	HealthAddr string
+
+	// Controller send circuit breaking and on-disk spooling; an empty
+	// SpoolDir drops events while the controller is unreachable
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	SpoolDir         string
+	SpoolMaxBytes    int64
+
+	// WorkloadIdentity looks up the Google service account bound to
+	// ServiceAccount from the GKE metadata server
+	WorkloadIdentity bool
+	// ClusterName and Environment are collector.Config's
+	ClusterName string
+	Environment string
+	// RedactEnvSecrets hashes credentials found in process environments
+	RedactEnvSecrets bool
 }
 
 // Monitor orchestrates all security monitoring components
@@ -42,10 +147,28 @@ type Monitor struct {
 	procMon *procmon.ProcessMonitor
 	netMon  *netpolicy.NetworkMonitor
 	fileMon *fileintegrity.FileMonitor
+	diskMon *diskusage.DiskMonitor
+	dropMon *fileintegrity.DropWatcher
+	gpuMon  *gpumon.GPUMonitor
+
+	// baselineKey verifies file integrity baselines; nil disables them
+	baselineKey ed25519.PublicKey
 
 	// Event collector (sends to controller)
 	collector *collector.EventCollector
 
+	// Supervision status per monitor name
+	monitors map[string]*MonitorStatus
+	statusMu sync.Mutex
+
+	// Last applied controller-pushed config, YARA rules and brownout, and
+	// when the brownout ends (heartbeat goroutine only)
+	configETag     string
+	configRevision int64
+	yaraETag       string
+	brownoutETag   string
+	brownoutUntil  time.Time
+
 	// Synchronization
 	wg     sync.WaitGroup
 	stopCh chan struct{}
@@ -54,83 +177,220 @@ type Monitor struct {
 // New creates a new Monitor instance
 func New(cfg *AgentConfig, log *logrus.Logger) (*Monitor, error) {
 	m := &Monitor{
-		cfg:    cfg,
-		log:    log,
-		stopCh: make(chan struct{}),
+		cfg:      cfg,
+		log:      log,
+		monitors: make(map[string]*MonitorStatus),
+		stopCh:   make(chan struct{}),
 	}
 
 	// Initialize event collector
+	var resolvers []collector.IdentityResolver
+	if cfg.WorkloadIdentity {
+		resolvers = append(resolvers, collector.GKEMetadataResolver{})
+	}
 	var err error
 	m.collector, err = collector.New(collector.Config{
 		ControllerEndpoint: cfg.ControllerEndpoint,
 		AgentID:            cfg.AgentID,
 		PodName:            cfg.PodName,
 		PodNamespace:       cfg.PodNamespace,
+		NodeName:           cfg.NodeName,
+		PodIP:              cfg.PodIP,
 		BufferSize:         10000,
+		Version:            cfg.Version,
+		ConfigHash:         cfg.Hash(),
+		DegradedMode:       cfg.DegradedMode,
+		AuthToken:          cfg.ControllerToken,
+		BreakerThreshold:   cfg.BreakerThreshold,
+		BreakerCooldown:    cfg.BreakerCooldown,
+		SpoolDir:           cfg.SpoolDir,
+		SpoolMaxBytes:      cfg.SpoolMaxBytes,
+		ServiceAccount:     cfg.ServiceAccount,
+		IdentityResolvers:  resolvers,
+		ClusterName:        cfg.ClusterName,
+		Environment:        cfg.Environment,
 	}, log)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create collector: %w", err)
 	}
 
-	// Initialize process monitor
-	m.procMon = procmon.New(procmon.Config{
-		ScanInterval:        cfg.ProcScanInterval,
-		SuspiciousProcesses: cfg.SuspiciousProcesses,
-		EventChan:           m.collector.EventChannel(),
-	}, log)
+	// Initialize process monitor (not useful without a shared process namespace)
+	if cfg.DegradedMode {
+		log.Warn("Process namespace not shared, running in degraded mode without process monitoring")
+	} else {
+		m.procMon = procmon.New(procmon.Config{
+			ScanInterval:        cfg.ProcScanInterval,
+			SuspiciousProcesses: cfg.SuspiciousProcesses,
+			FDUsagePercent:      cfg.FDUsagePercent,
+			EventChan:           m.collector.EventChannel(),
+			ExeHashAllowlist:    cfg.ExeHashAllowlist,
+			ExeHashDenylist:     cfg.ExeHashDenylist,
+			RedactEnvSecrets:    cfg.RedactEnvSecrets,
+			HighCPUPercent:      cfg.HighCPUPercent,
+			HighCPUScans:        cfg.HighCPUScans,
+			EventMode:           cfg.ProcEventMode,
+			MinScanInterval:     cfg.ProcScanMinInterval,
+			ScanSamples:         cfg.ProcScanSamples,
+			CredentialPaths:     cfg.CredentialPaths,
+			ProbeCommands:       cfg.ProbeCommands,
+			ProbePolicy:         cfg.ExecProbePolicy,
+		}, log)
+	}
 
 	// Initialize network monitor
 	m.netMon = netpolicy.New(netpolicy.Config{
-		ScanInterval:    cfg.NetScanInterval,
-		SuspiciousPorts: cfg.SuspiciousPorts,
-		EventChan:       m.collector.EventChannel(),
+		ScanInterval:         cfg.NetScanInterval,
+		SuspiciousPorts:      cfg.SuspiciousPorts,
+		ListenBaselineWindow: cfg.ListenBaseline,
+		SMTPPorts:            cfg.SMTPPorts,
+		IRCPorts:             cfg.IRCPorts,
+		EventChan:            m.collector.EventChannel(),
+		Fanout: netpolicy.FanoutConfig{
+			MinConnections:  cfg.FanoutConnections,
+			MinDestinations: cfg.FanoutDestinations,
+			Sigma:           cfg.FanoutSigma,
+		},
 	}, log)
 
 	// Initialize file integrity monitor
 	m.fileMon, err = fileintegrity.New(fileintegrity.Config{
-		WatchPaths: cfg.WatchPaths,
-		EventChan:  m.collector.EventChannel(),
+		WatchPaths:      cfg.WatchPaths,
+		EventChan:       m.collector.EventChannel(),
+		ScanInterval:    cfg.FileScanInterval,
+		WatchExclude:    cfg.WatchExclude,
+		CredentialPaths: cfg.CredentialPaths,
 	}, log)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file monitor: %w", err)
 	}
+	if cfg.FileBaselineKey != "" {
+		if m.baselineKey, err = fileintegrity.ParsePublicKey([]byte(cfg.FileBaselineKey)); err != nil {
+			return nil, fmt.Errorf("invalid file baseline public key: %w", err)
+		}
+	}
+
+	// Initialize disk usage monitor
+	if len(cfg.DiskWatchPaths) > 0 {
+		m.diskMon = diskusage.New(diskusage.Config{
+			ScanInterval:      cfg.DiskScanInterval,
+			Paths:             cfg.DiskWatchPaths,
+			GrowthBytes:       cfg.DiskGrowthBytes,
+			GrowthFiles:       cfg.DiskGrowthFiles,
+			InodeUsagePercent: cfg.InodeUsagePercent,
+			EventChan:         m.collector.EventChannel(),
+		}, log)
+	}
+
+	// Initialize dropped executable watcher
+	if len(cfg.DropWatchPaths) > 0 {
+		m.dropMon, err = fileintegrity.NewDropWatcher(fileintegrity.DropperConfig{
+			Paths:     cfg.DropWatchPaths,
+			EventChan: m.collector.EventChannel(),
+		}, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dropped executable watcher: %w", err)
+		}
+	}
+
+	// Initialize GPU monitor
+	if cfg.GPUMonitor {
+		m.gpuMon = gpumon.New(gpumon.Config{
+			ScanInterval:     cfg.GPUScanInterval,
+			PodName:          cfg.PodName,
+			PodNamespace:     cfg.PodNamespace,
+			Workload:         cfg.GPUWorkload,
+			AllowedProcesses: cfg.GPUAllowedProcesses,
+			MetricsURL:       cfg.GPUMetricsURL,
+			UtilPercent:      cfg.GPUUtilPercent,
+			UtilScans:        cfg.GPUUtilScans,
+			EventChan:        m.collector.EventChannel(),
+		}, log)
+	}
 
 	return m, nil
 }
 
+// Hash returns a short, stable digest of the effective agent configuration so
+// the controller can spot agents running with drifted settings. The controller
+// token is excluded.
+func (c *AgentConfig) Hash() string {
+	cp := *c
+	cp.ControllerToken = ""
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
 // Start begins all monitoring goroutines
 func (m *Monitor) Start(ctx context.Context) error {
 	m.log.Info("Starting security monitors")
 
+	// Resolved before anything is sent so registration and every event
+	// carry it
+	m.collector.ResolveIdentity(ctx)
+
 	// Start collector first
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		if err := m.collector.Start(ctx); err != nil {
+	m.goSupervised(ctx, "collector", func(ctx context.Context) {
+		if err := m.collector.Start(ctx); err != nil && ctx.Err() == nil {
 			m.log.WithError(err).Error("Collector error")
 		}
-	}()
+	})
+
+	// Spread the first scans and registration of agents restarted
+	// together. The collector is already running, so nothing is lost but
+	// the monitors' head start.
+	if m.cfg.StartupJitter > 0 {
+		delay := jitter.Duration(m.cfg.StartupJitter)
+		m.log.WithField("delay", delay.String()).Info("Delaying monitor startup")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
 
 	// Start process monitor
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		m.procMon.Start(ctx)
-	}()
+	if m.procMon != nil {
+		m.goSupervised(ctx, "procmon", m.procMon.Start)
+	}
 
 	// Start network monitor
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		m.netMon.Start(ctx)
-	}()
+	m.goSupervised(ctx, "netpolicy", m.netMon.Start)
 
 	// Start file integrity monitor
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		m.fileMon.Start(ctx)
-	}()
+	m.goSupervised(ctx, "fileintegrity", m.fileMon.Start)
+
+	// Start disk usage monitor
+	if m.diskMon != nil {
+		m.goSupervised(ctx, "diskusage", m.diskMon.Start)
+	}
+
+	// Start dropped executable watcher
+	if m.dropMon != nil {
+		m.goSupervised(ctx, "dropper", m.dropMon.Start)
+	}
+
+	// Start GPU monitor
+	if m.gpuMon != nil {
+		m.goSupervised(ctx, "gpumon", m.gpuMon.Start)
+	}
+
+	// Report liveness and crash counts
+	if m.cfg.HeartbeatInterval > 0 {
+		m.goSupervised(ctx, "heartbeat", m.heartbeatLoop)
+	}
+
+	// Serve per-monitor status locally
+	if m.cfg.HealthAddr != "" {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.serveHealth(ctx)
+		}()
+	}
 
 	m.log.Info("All monitors started")
 
@@ -139,6 +399,16 @@ func (m *Monitor) Start(ctx context.Context) error {
 	return nil
 }
 
+// goSupervised starts fn in a tracked goroutine with panic recovery
+func (m *Monitor) goSupervised(ctx context.Context, name string, fn func(context.Context)) {
+	m.setState(name, MonitorStateRunning)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.supervise(ctx, name, fn)
+	}()
+}
+
 // Shutdown gracefully stops all monitors
 func (m *Monitor) Shutdown(ctx context.Context) error {
 	m.log.Info("Shutting down monitors")
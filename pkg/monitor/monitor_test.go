@@ -2,10 +2,17 @@ package monitor
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
 )
 
 func TestNew(t *testing.T) {
@@ -51,3 +58,112 @@ func TestMonitor_Shutdown(t *testing.T) {
 		t.Errorf("Shutdown: %v", err)
 	}
 }
+
+func TestNew_DegradedMode(t *testing.T) {
+	log := logrus.New()
+	cfg := &AgentConfig{
+		ControllerEndpoint: "localhost:8080",
+		WatchPaths:         []string{},
+		DegradedMode:       true,
+	}
+	m, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if m.procMon != nil {
+		t.Error("process monitor should be disabled in degraded mode")
+	}
+	if m.netMon == nil || m.fileMon == nil {
+		t.Error("network and file monitors should still run in degraded mode")
+	}
+}
+
+func TestMonitor_ApplyConfig(t *testing.T) {
+	cfg := &AgentConfig{
+		ControllerEndpoint:  "localhost:8080",
+		WatchPaths:          []string{},
+		SuspiciousProcesses: []string{"nc"},
+		SuspiciousPorts:     []int{4444},
+	}
+	m, err := New(cfg, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	before := cfg.Hash()
+
+	m.applyConfig(&collector.RemoteConfig{Revision: 2, SuspiciousPorts: []int{}})
+	if m.configRevision != 2 {
+		t.Errorf("configRevision = %d, want 2", m.configRevision)
+	}
+	if len(cfg.SuspiciousPorts) != 0 || len(cfg.SuspiciousProcesses) != 1 {
+		t.Errorf("ports should be cleared and processes kept: %+v", cfg)
+	}
+	if cfg.Hash() == before {
+		t.Error("config hash should change after applying pushed config")
+	}
+
+	m.applyConfig(&collector.RemoteConfig{Revision: 3, ExeHashDenylist: []string{strings.Repeat("ab", 32)}})
+	if len(cfg.ExeHashDenylist) != 1 || cfg.ExeHashAllowlist != nil {
+		t.Errorf("denylist should be set and allowlist kept: %+v", cfg)
+	}
+}
+
+func TestMonitor_PollBrownout(t *testing.T) {
+	var until atomic.Value
+	until.Store(time.Now().Add(time.Hour))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/agents/agent-1/brownout" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		u := until.Load().(time.Time)
+		if u.IsZero() {
+			http.NotFound(w, r)
+			return
+		}
+		etag := fmt.Sprintf(`"%d"`, u.Unix())
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `{"factor":4,"until":%q}`, u.Format(time.RFC3339Nano))
+	}))
+	defer srv.Close()
+
+	cfg := &AgentConfig{
+		AgentID:            "agent-1",
+		ControllerEndpoint: strings.TrimPrefix(srv.URL, "http://"),
+		ProcScanInterval:   time.Second,
+		NetScanInterval:    time.Second,
+		WatchPaths:         []string{},
+	}
+	m, err := New(cfg, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+
+	m.pollBrownout(ctx)
+	if m.brownoutUntil.IsZero() || m.brownoutETag == "" {
+		t.Fatalf("brownout not applied: until %v, etag %q", m.brownoutUntil, m.brownoutETag)
+	}
+	m.pollBrownout(ctx)
+	if m.brownoutUntil.IsZero() {
+		t.Error("unchanged brownout ended")
+	}
+
+	// A brownout that ran out ends even while the controller still serves it.
+	m.brownoutUntil = time.Now().Add(-time.Second)
+	m.pollBrownout(ctx)
+	if !m.brownoutUntil.IsZero() {
+		t.Error("expired brownout still in effect")
+	}
+
+	m.brownoutETag = ""
+	m.pollBrownout(ctx)
+	until.Store(time.Time{})
+	m.pollBrownout(ctx)
+	if !m.brownoutUntil.IsZero() || m.brownoutETag != "" {
+		t.Errorf("brownout ended on the controller still in effect: until %v, etag %q", m.brownoutUntil, m.brownoutETag)
+	}
+}
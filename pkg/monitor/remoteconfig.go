@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// pollConfig fetches config pushed by the controller and applies it if it
+// changed since the last poll
+func (m *Monitor) pollConfig(ctx context.Context) {
+	rc, etag, err := m.collector.FetchConfig(ctx, m.configETag)
+	if err != nil {
+		m.log.WithError(err).Debug("Failed to fetch pushed config")
+		return
+	}
+	if rc == nil {
+		return
+	}
+	m.applyConfig(rc)
+	m.configETag = etag
+}
+
+// applyConfig hot-swaps detection settings in the running sub-monitors. Lists
+// left nil by the controller keep their local values.
+func (m *Monitor) applyConfig(rc *collector.RemoteConfig) {
+	if rc.SuspiciousProcesses != nil {
+		m.cfg.SuspiciousProcesses = rc.SuspiciousProcesses
+		if m.procMon != nil {
+			m.procMon.SetSuspiciousProcesses(rc.SuspiciousProcesses)
+		}
+	}
+	if rc.ExeHashAllowlist != nil || rc.ExeHashDenylist != nil {
+		if rc.ExeHashAllowlist != nil {
+			m.cfg.ExeHashAllowlist = rc.ExeHashAllowlist
+		}
+		if rc.ExeHashDenylist != nil {
+			m.cfg.ExeHashDenylist = rc.ExeHashDenylist
+		}
+		if m.procMon != nil {
+			m.procMon.SetExeHashLists(m.cfg.ExeHashAllowlist, m.cfg.ExeHashDenylist)
+		}
+	}
+	if rc.SuspiciousPorts != nil {
+		m.cfg.SuspiciousPorts = rc.SuspiciousPorts
+		m.netMon.SetSuspiciousPorts(rc.SuspiciousPorts)
+	}
+	if rc.WatchPaths != nil {
+		m.cfg.WatchPaths = rc.WatchPaths
+		m.fileMon.SetWatchPaths(rc.WatchPaths)
+	}
+	if rc.WatchExclude != nil {
+		m.cfg.WatchExclude = rc.WatchExclude
+		m.fileMon.SetWatchExclude(rc.WatchExclude)
+	}
+	m.configRevision = rc.Revision
+	m.collector.SetConfigHash(m.cfg.Hash())
+
+	m.log.WithFields(logrus.Fields{
+		"revision":             rc.Revision,
+		"suspicious_processes": len(m.cfg.SuspiciousProcesses),
+		"suspicious_ports":     len(m.cfg.SuspiciousPorts),
+		"watch_paths":          len(m.cfg.WatchPaths),
+		"watch_exclude":        len(m.cfg.WatchExclude),
+		"exe_hash_allowlist":   len(m.cfg.ExeHashAllowlist),
+		"exe_hash_denylist":    len(m.cfg.ExeHashDenylist),
+	}).Info("Applied config pushed by controller")
+}
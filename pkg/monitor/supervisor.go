@@ -0,0 +1,263 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/jitter"
+)
+
+// Defaults for monitor restart after a panic
+const (
+	defaultMaxRestarts    = 5
+	defaultRestartBackoff = time.Second
+	maxRestartBackoff     = time.Minute
+)
+
+// Monitor states reported in heartbeats
+const (
+	MonitorStateRunning    = "running"
+	MonitorStateRestarting = "restarting"
+	MonitorStateFailed     = "failed"
+	MonitorStateStopped    = "stopped"
+)
+
+// MonitorStatus is the supervision state of one sub-monitor
+type MonitorStatus struct {
+	State string `json:"state"`
+	// Since is when the monitor entered State
+	Since time.Time `json:"since"`
+	// Failures counts panics and unexpected returns; Crashes counts panics only
+	Failures  int    `json:"failures"`
+	Crashes   int    `json:"crashes"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// errExitedEarly is recorded when a monitor returns while the agent is still running
+var errExitedEarly = errors.New("monitor exited unexpectedly")
+
+// supervise runs fn and restarts it with exponential backoff if it panics or
+// returns before ctx is cancelled. After MaxMonitorRestarts failures the
+// monitor is marked failed and abandoned; the rest of the agent keeps running.
+func (m *Monitor) supervise(ctx context.Context, name string, fn func(context.Context)) {
+	maxRestarts := m.cfg.MaxMonitorRestarts
+	if maxRestarts <= 0 {
+		maxRestarts = defaultMaxRestarts
+	}
+	backoff := m.cfg.RestartBackoff
+	if backoff <= 0 {
+		backoff = defaultRestartBackoff
+	}
+
+	for {
+		m.setState(name, MonitorStateRunning)
+		err := runRecovered(ctx, fn)
+		if ctx.Err() != nil {
+			m.setState(name, MonitorStateStopped)
+			return
+		}
+		if err == nil {
+			err = errExitedEarly
+		}
+
+		failures := m.recordFailure(name, err)
+		log := m.log.WithError(err).WithField("monitor", name).WithField("failures", failures)
+		if failures > maxRestarts {
+			m.setState(name, MonitorStateFailed)
+			log.Error("Monitor keeps failing, giving up on restarts")
+			return
+		}
+		m.setState(name, MonitorStateRestarting)
+		log.WithField("backoff", backoff.String()).Error("Monitor failed, restarting")
+
+		select {
+		case <-ctx.Done():
+			m.setState(name, MonitorStateStopped)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// panicError marks an error recovered from a monitor panic
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.value, e.stack)
+}
+
+// runRecovered calls fn and converts a panic into an error
+func runRecovered(ctx context.Context, fn func(context.Context)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{value: r, stack: debug.Stack()}
+		}
+	}()
+	fn(ctx)
+	return nil
+}
+
+// status returns the tracked status for name, creating it if needed.
+// Caller must hold statusMu.
+func (m *Monitor) status(name string) *MonitorStatus {
+	st, ok := m.monitors[name]
+	if !ok {
+		st = &MonitorStatus{}
+		m.monitors[name] = st
+	}
+	return st
+}
+
+func (m *Monitor) recordFailure(name string, err error) int {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	st := m.status(name)
+	st.Failures++
+	var pe *panicError
+	if errors.As(err, &pe) {
+		st.Crashes++
+		st.LastError = fmt.Sprintf("panic: %v", pe.value)
+	} else {
+		st.LastError = err.Error()
+	}
+	return st.Failures
+}
+
+func (m *Monitor) setState(name, state string) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	st := m.status(name)
+	if st.State != state {
+		st.State = state
+		st.Since = time.Now()
+	}
+}
+
+// CrashCounts returns the number of panics per monitor since agent start
+func (m *Monitor) CrashCounts() map[string]int {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	out := make(map[string]int, len(m.monitors))
+	for name, st := range m.monitors {
+		if st.Crashes > 0 {
+			out[name] = st.Crashes
+		}
+	}
+	return out
+}
+
+// MonitorStates returns the current state of each supervised monitor
+func (m *Monitor) MonitorStates() map[string]string {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	out := make(map[string]string, len(m.monitors))
+	for name, st := range m.monitors {
+		out[name] = st.State
+	}
+	return out
+}
+
+// MonitorStatuses returns a snapshot of every supervised monitor's status
+func (m *Monitor) MonitorStatuses() map[string]MonitorStatus {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	out := make(map[string]MonitorStatus, len(m.monitors))
+	for name, st := range m.monitors {
+		out[name] = *st
+	}
+	return out
+}
+
+// heartbeatLoop registers the agent with the controller, then periodically
+// polls for pushed config, YARA rules and brownouts and reports liveness,
+// monitor state and crash counts. Registration and the file baseline check
+// are retried on each tick until they succeed, and made again when the
+// controller routes the agent to another replica.
+func (m *Monitor) heartbeatLoop(ctx context.Context) {
+	m.pollRouting(ctx)
+	registered := m.register(ctx)
+	baselined := m.baselineKey == nil || (registered && m.syncBaseline(ctx))
+	m.pollConfig(ctx)
+	m.pollYaraRules(ctx)
+	m.pollBrownout(ctx)
+	ticker := jitter.NewTicker(m.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m.pollRouting(ctx) {
+				registered, baselined = false, m.baselineKey == nil
+			}
+			if !registered {
+				registered = m.register(ctx)
+			}
+			if registered && !baselined {
+				baselined = m.syncBaseline(ctx)
+			}
+			m.pollConfig(ctx)
+			m.pollYaraRules(ctx)
+			m.pollBrownout(ctx)
+			if err := m.collector.SendHeartbeat(ctx, m.MonitorStates(), m.CrashCounts(), m.configRevision); err != nil {
+				m.log.WithError(err).Debug("Failed to send heartbeat")
+			}
+		}
+	}
+}
+
+// pollRouting follows the controller's routing table and reports whether
+// the agent moved to another controller replica
+func (m *Monitor) pollRouting(ctx context.Context) bool {
+	route, changed, err := m.collector.FetchRouting(ctx)
+	if err != nil {
+		m.log.WithError(err).Debug("Failed to fetch controller routing table")
+		return false
+	}
+	if changed {
+		if route == "" {
+			route = m.cfg.ControllerEndpoint
+		}
+		m.log.WithField("controller", route).Info("Routed to controller replica")
+	}
+	return changed
+}
+
+// register negotiates the protocol with the controller, then registers.
+// A controller that cannot negotiate is sent single events.
+func (m *Monitor) register(ctx context.Context) bool {
+	protocol, err := m.collector.Handshake(ctx)
+	switch {
+	case errors.Is(err, collector.ErrIncompatibleController):
+		m.log.WithError(err).Warn("Controller shares no protocol with this agent, sending single events")
+	case err != nil:
+		m.log.WithError(err).Debug("Failed to negotiate protocol with controller")
+	case protocol != nil:
+		m.log.WithFields(logrus.Fields{"protocol": protocol.Version, "capabilities": protocol.Capabilities}).Info("Negotiated protocol with controller")
+	}
+	states := m.MonitorStates()
+	monitors := make([]string, 0, len(states))
+	for name := range states {
+		monitors = append(monitors, name)
+	}
+	sort.Strings(monitors)
+	if err := m.collector.Register(ctx, monitors); err != nil {
+		m.log.WithError(err).Debug("Failed to register with controller")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestMonitor(t *testing.T, cfg *AgentConfig) *Monitor {
+	t.Helper()
+	cfg.ControllerEndpoint = "localhost:8080"
+	cfg.WatchPaths = []string{}
+	m, err := New(cfg, logrus.New())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+func TestSupervise_RestartsUntilBudgetExhausted(t *testing.T) {
+	m := newTestMonitor(t, &AgentConfig{MaxMonitorRestarts: 2, RestartBackoff: time.Millisecond})
+	var runs int32
+	done := make(chan struct{})
+	go func() {
+		m.supervise(context.Background(), "flaky", func(context.Context) {
+			atomic.AddInt32(&runs, 1)
+			panic("boom")
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("supervise did not give up")
+	}
+	// Initial run plus two restarts.
+	if got := atomic.LoadInt32(&runs); got != 3 {
+		t.Errorf("runs = %d, want 3", got)
+	}
+	if got := m.CrashCounts()["flaky"]; got != 3 {
+		t.Errorf("crash count = %d, want 3", got)
+	}
+	if got := m.MonitorStates()["flaky"]; got != MonitorStateFailed {
+		t.Errorf("state = %q, want %q", got, MonitorStateFailed)
+	}
+}
+
+func TestSupervise_RecoversAfterPanic(t *testing.T) {
+	m := newTestMonitor(t, &AgentConfig{RestartBackoff: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs int32
+	m.supervise(ctx, "once", func(ctx context.Context) {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			panic("first run fails")
+		}
+		cancel()
+		<-ctx.Done()
+	})
+	if got := atomic.LoadInt32(&runs); got != 2 {
+		t.Errorf("runs = %d, want 2", got)
+	}
+	if got := m.CrashCounts()["once"]; got != 1 {
+		t.Errorf("crash count = %d, want 1", got)
+	}
+	if st := m.MonitorStatuses()["once"]; st.State != MonitorStateStopped || st.LastError != "panic: first run fails" {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestSupervise_RestartsEarlyExit(t *testing.T) {
+	m := newTestMonitor(t, &AgentConfig{MaxMonitorRestarts: 1, RestartBackoff: time.Millisecond})
+	var runs int32
+	m.supervise(context.Background(), "quitter", func(context.Context) {
+		atomic.AddInt32(&runs, 1)
+	})
+	if got := atomic.LoadInt32(&runs); got != 2 {
+		t.Errorf("runs = %d, want 2", got)
+	}
+	st := m.MonitorStatuses()["quitter"]
+	if st.State != MonitorStateFailed || st.Failures != 2 || st.Crashes != 0 || st.LastError != errExitedEarly.Error() {
+		t.Errorf("status = %+v", st)
+	}
+	if _, ok := m.CrashCounts()["quitter"]; ok {
+		t.Error("early exits should not count as crashes")
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	m := newTestMonitor(t, &AgentConfig{AgentID: "agent-1"})
+	m.setState("netpolicy", MonitorStateRunning)
+
+	rec := httptest.NewRecorder()
+	m.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("healthy status = %d", rec.Code)
+	}
+
+	m.setState("procmon", MonitorStateFailed)
+	rec = httptest.NewRecorder()
+	m.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("degraded status = %d", rec.Code)
+	}
+	var h Health
+	if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if h.Status != HealthDegraded || h.AgentID != "agent-1" || h.Monitors["procmon"].State != MonitorStateFailed {
+		t.Errorf("health = %+v", h)
+	}
+}
+
+func TestSupervise_NoRestartOnCancel(t *testing.T) {
+	m := newTestMonitor(t, &AgentConfig{RestartBackoff: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var runs int32
+	m.supervise(ctx, "cancelled", func(context.Context) {
+		atomic.AddInt32(&runs, 1)
+		panic("after cancel")
+	})
+	if got := atomic.LoadInt32(&runs); got != 1 {
+		t.Errorf("runs = %d, want 1", got)
+	}
+}
+
+func TestAgentConfig_Hash(t *testing.T) {
+	a := &AgentConfig{ProcScanInterval: time.Second, WatchPaths: []string{"/etc/passwd"}, ControllerToken: "one"}
+	b := *a
+	b.ControllerToken = "two"
+	if a.Hash() == "" || a.Hash() != b.Hash() {
+		t.Errorf("hash should ignore the controller token: %q vs %q", a.Hash(), b.Hash())
+	}
+	b.ProcScanInterval = 2 * time.Second
+	if a.Hash() == b.Hash() {
+		t.Error("hash should change when config changes")
+	}
+}
@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"context"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/yara"
+)
+
+// pollYaraRules fetches the YARA rules from the controller and, when they
+// changed, has the file monitor and dropped executable watcher scan with
+// them. Rules removed on the controller stop the scanning; rules that fail
+// to compile are logged and the previous ones kept.
+func (m *Monitor) pollYaraRules(ctx context.Context) {
+	source, etag, err := m.collector.FetchYaraRules(ctx, m.yaraETag)
+	if err != nil {
+		m.log.WithError(err).Debug("Failed to fetch YARA rules")
+		return
+	}
+	if etag == m.yaraETag {
+		return
+	}
+	var rules *yara.Rules
+	if source != nil {
+		if rules, err = yara.Compile(string(source)); err != nil {
+			m.log.WithError(err).WithField("etag", etag).Error("Invalid YARA rules from controller, keeping the previous ones")
+			m.yaraETag = etag
+			return
+		}
+	}
+	m.fileMon.SetYaraRules(rules)
+	if m.dropMon != nil {
+		m.dropMon.SetYaraRules(rules)
+	}
+	m.yaraETag = etag
+	if rules == nil {
+		m.log.Info("YARA rules removed by controller, file scanning stopped")
+		return
+	}
+	m.log.WithField("rules", len(rules.Names())).Info("Applied YARA rules from controller")
+}
@@ -0,0 +1,101 @@
+package netpolicy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// MetadataListenBaseline marks a listener that appeared after the baseline
+// was learned; its value is ListenNew.
+const (
+	MetadataListenBaseline = "listen_baseline"
+	ListenNew              = "new_listener"
+)
+
+// listenBaseline is the set of ports the pod listened on during warm-up.
+// Scan goroutine only.
+type listenBaseline struct {
+	until   time.Time
+	ports   map[string]bool
+	learned bool
+}
+
+func newListenBaseline(window time.Duration, now time.Time) *listenBaseline {
+	return &listenBaseline{until: now.Add(window), ports: make(map[string]bool)}
+}
+
+// isListener reports whether conn accepts connections: a listening TCP
+// socket or a UDP socket with no remote peer.
+func isListener(conn *Connection) bool {
+	if strings.HasPrefix(conn.Protocol, "udp") {
+		return conn.RemotePort == 0
+	}
+	return conn.State == "LISTEN"
+}
+
+// listenKey identifies a listening port regardless of address family and
+// bind address, so tcp and tcp6 listeners on 8080 are one port.
+func listenKey(conn *Connection) string {
+	return fmt.Sprintf("%s/%d", strings.TrimSuffix(conn.Protocol, "6"), conn.LocalPort)
+}
+
+// observe records a new listener during warm-up and reports whether it is
+// outside the baseline afterwards.
+func (b *listenBaseline) observe(conn *Connection, now time.Time) bool {
+	key := listenKey(conn)
+	if now.Before(b.until) {
+		b.ports[key] = true
+		return false
+	}
+	return !b.ports[key]
+}
+
+// finish reports, once, the ports learned when warm-up has ended.
+func (b *listenBaseline) finish(now time.Time) ([]string, bool) {
+	if b.learned || now.Before(b.until) {
+		return nil, false
+	}
+	b.learned = true
+	ports := make([]string, 0, len(b.ports))
+	for key := range b.ports {
+		ports = append(ports, key)
+	}
+	sort.Strings(ports)
+	return ports, true
+}
+
+// checkListener handles a new listener in baseline mode: it is learned
+// during warm-up and reported afterwards only if its port is new. Listeners
+// on suspicious ports are HIGH, others MEDIUM.
+func (nm *NetworkMonitor) checkListener(ctx context.Context, conn *Connection, now time.Time) {
+	if !nm.baseline.observe(conn, now) {
+		return
+	}
+	nm.portsMu.RLock()
+	isSuspiciousPort := nm.suspiciousPorts[conn.LocalPort]
+	nm.portsMu.RUnlock()
+
+	severity := collector.SeverityMedium
+	if isSuspiciousPort || nm.isPotentialReverseShell(conn) {
+		severity = collector.SeverityHigh
+	}
+	nm.emit(ctx, collector.SecurityEvent{
+		Type:       collector.EventTypeNetworkListen,
+		Severity:   severity,
+		Timestamp:  now,
+		OccurredAt: conn.OccurredAt,
+		Network: &collector.NetworkEvent{
+			Protocol:         conn.Protocol,
+			SrcIP:            conn.LocalIP.String(),
+			SrcPort:          conn.LocalPort,
+			State:            "LISTEN",
+			IsSuspiciousPort: isSuspiciousPort,
+		},
+		Metadata: map[string]string{MetadataListenBaseline: ListenNew},
+	})
+}
@@ -0,0 +1,71 @@
+package netpolicy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func TestNetworkMonitor_checkListener(t *testing.T) {
+	ch := make(chan collector.SecurityEvent, 10)
+	nm := New(Config{ScanInterval: time.Second, SuspiciousPorts: []int{4444}, EventChan: ch}, logrus.New())
+	start := time.Now()
+	nm.baseline = newListenBaseline(time.Minute, start)
+	listen := func(proto string, port int) *Connection {
+		return &Connection{Protocol: proto, LocalIP: net.IPv4zero, LocalPort: port, RemoteIP: net.IPv4zero, State: "LISTEN"}
+	}
+
+	// Warm-up: the service ports are learned silently.
+	nm.checkListener(context.Background(), listen("tcp", 8080), start)
+	nm.checkListener(context.Background(), &Connection{Protocol: "udp", LocalIP: net.IPv4zero, LocalPort: 53, RemoteIP: net.IPv4zero, State: "CLOSE"}, start.Add(time.Second))
+	if len(ch) != 0 {
+		t.Fatalf("%d events during warm-up", len(ch))
+	}
+	if _, ok := nm.baseline.finish(start.Add(30 * time.Second)); ok {
+		t.Error("baseline finished during warm-up")
+	}
+	ports, ok := nm.baseline.finish(start.Add(time.Minute))
+	if !ok || len(ports) != 2 || ports[0] != "tcp/8080" || ports[1] != "udp/53" {
+		t.Errorf("baseline = %v, %v", ports, ok)
+	}
+
+	// After warm-up, the same port over IPv6 is known; a bind shell is not.
+	after := start.Add(2 * time.Minute)
+	nm.checkListener(context.Background(), listen("tcp6", 8080), after)
+	nm.checkListener(context.Background(), listen("tcp", 4444), after)
+	nm.checkListener(context.Background(), listen("tcp", 9090), after)
+	if len(ch) != 2 {
+		t.Fatalf("%d events after warm-up, want 2", len(ch))
+	}
+	for _, want := range []struct {
+		port     int
+		severity collector.Severity
+	}{{4444, collector.SeverityHigh}, {9090, collector.SeverityMedium}} {
+		e := <-ch
+		if e.Type != collector.EventTypeNetworkListen || e.Network.SrcPort != want.port || e.Severity != want.severity || e.Metadata[MetadataListenBaseline] != ListenNew {
+			t.Errorf("event = %+v, network %+v", e, e.Network)
+		}
+	}
+}
+
+func TestIsListener(t *testing.T) {
+	tests := []struct {
+		conn Connection
+		want bool
+	}{
+		{Connection{Protocol: "tcp", State: "LISTEN"}, true},
+		{Connection{Protocol: "tcp6", State: "ESTABLISHED", RemotePort: 443}, false},
+		{Connection{Protocol: "udp", State: "CLOSE"}, true},
+		{Connection{Protocol: "udp6", State: "ESTABLISHED", RemotePort: 53}, false},
+	}
+	for _, tt := range tests {
+		if got := isListener(&tt.conn); got != tt.want {
+			t.Errorf("isListener(%+v) = %v, want %v", tt.conn, got, tt.want)
+		}
+	}
+}
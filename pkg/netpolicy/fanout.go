@@ -0,0 +1,177 @@
+package netpolicy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// AnomalyConnectionFanout is the ResourceEvent.AnomalyType of a burst of new
+// external connections or destinations; AnomalyScore is how far the burst
+// went past its threshold, as a ratio.
+const AnomalyConnectionFanout = "connection_fanout"
+
+const (
+	// fanoutWindow is how many scans the rolling baseline covers.
+	fanoutWindow = 30
+	// fanoutMinSamples is how many scans are needed before anything is
+	// reported, so the first scans after start do not set off alerts.
+	fanoutMinSamples = 6
+	// fanoutTopDestinations caps the destinations listed in an event.
+	fanoutTopDestinations = 5
+)
+
+// FanoutConfig sets when a scan's new external connections or distinct
+// destination IPs are anomalous: above the larger of the minimum and the
+// rolling mean plus Sigma standard deviations. Sigma 0 disables it.
+type FanoutConfig struct {
+	MinConnections  int
+	MinDestinations int
+	Sigma           float64
+}
+
+// fanoutTracker keeps the per-scan counts of recent normal scans. Scan
+// goroutine only.
+type fanoutTracker struct {
+	cfg          FanoutConfig
+	connections  []float64
+	destinations []float64
+	// alerted is set while a burst lasts, so it is reported once.
+	alerted bool
+}
+
+// fanoutScan is one scan's new outbound external connections.
+type fanoutScan struct {
+	connections int
+	// perDestination counts new connections by destination IP.
+	perDestination map[string]int
+}
+
+// fanoutResult is a scan and the thresholds it was held to.
+type fanoutResult struct {
+	scan          fanoutScan
+	connThreshold float64
+	destThreshold float64
+}
+
+// countFanout counts new outbound connections to external addresses.
+func (nm *NetworkMonitor) countFanout(conns []*Connection) fanoutScan {
+	scan := fanoutScan{perDestination: make(map[string]int)}
+	for _, conn := range conns {
+		if conn.State != "ESTABLISHED" && conn.State != "SYN_SENT" {
+			continue
+		}
+		if conn.RemotePort == 0 || nm.isPrivateIP(conn.RemoteIP) {
+			continue
+		}
+		scan.connections++
+		scan.perDestination[conn.RemoteIP.String()]++
+	}
+	return scan
+}
+
+// observe adds a scan to the baseline and returns it if it is anomalous
+// and the first anomalous scan of a burst. Anomalous scans are left out of
+// the baseline, so a long burst does not become normal.
+func (t *fanoutTracker) observe(scan fanoutScan) (fanoutResult, bool) {
+	conns, dests := float64(scan.connections), float64(len(scan.perDestination))
+	res := fanoutResult{scan: scan}
+	anomalous := false
+	if len(t.connections) >= fanoutMinSamples {
+		res.connThreshold = t.threshold(t.connections, t.cfg.MinConnections)
+		res.destThreshold = t.threshold(t.destinations, t.cfg.MinDestinations)
+		anomalous = conns > res.connThreshold || dests > res.destThreshold
+	}
+	if !anomalous {
+		t.alerted = false
+		t.connections = appendWindow(t.connections, conns)
+		t.destinations = appendWindow(t.destinations, dests)
+		return res, false
+	}
+	if t.alerted {
+		return res, false
+	}
+	t.alerted = true
+	return res, true
+}
+
+// threshold is the larger of floor and the samples' mean plus Sigma
+// standard deviations, and at least 1.
+func (t *fanoutTracker) threshold(samples []float64, floor int) float64 {
+	mean, sd := meanStddev(samples)
+	return math.Max(math.Max(float64(floor), 1), mean+t.cfg.Sigma*sd)
+}
+
+func appendWindow(samples []float64, v float64) []float64 {
+	samples = append(samples, v)
+	if len(samples) > fanoutWindow {
+		samples = samples[1:]
+	}
+	return samples
+}
+
+func meanStddev(samples []float64) (mean, sd float64) {
+	for _, v := range samples {
+		mean += v
+	}
+	mean /= float64(len(samples))
+	for _, v := range samples {
+		sd += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(samples)))
+}
+
+// checkFanout reports a burst of new external connections or destinations
+// in the scan's new connections.
+func (nm *NetworkMonitor) checkFanout(ctx context.Context, conns []*Connection, now time.Time) {
+	res, ok := nm.fanout.observe(nm.countFanout(conns))
+	if !ok {
+		return
+	}
+	dests := len(res.scan.perDestination)
+	score := math.Max(float64(res.scan.connections)/res.connThreshold, float64(dests)/res.destThreshold)
+	nm.emit(ctx, collector.SecurityEvent{
+		Type:      collector.EventTypeResourceAnomaly,
+		Severity:  collector.SeverityHigh,
+		Timestamp: now,
+		Resource: &collector.ResourceEvent{
+			AnomalyType:  AnomalyConnectionFanout,
+			AnomalyScore: score,
+		},
+		Metadata: map[string]string{
+			"new_connections":        strconv.Itoa(res.scan.connections),
+			"distinct_destinations":  strconv.Itoa(dests),
+			"connections_threshold":  fmt.Sprintf("%.1f", res.connThreshold),
+			"destinations_threshold": fmt.Sprintf("%.1f", res.destThreshold),
+			"top_destinations":       topDestinations(res.scan.perDestination, fanoutTopDestinations),
+		},
+	})
+}
+
+// topDestinations lists the n destinations with the most new connections
+// as ip=count, most first.
+func topDestinations(perDestination map[string]int, n int) string {
+	ips := make([]string, 0, len(perDestination))
+	for ip := range perDestination {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if perDestination[ips[i]] != perDestination[ips[j]] {
+			return perDestination[ips[i]] > perDestination[ips[j]]
+		}
+		return ips[i] < ips[j]
+	})
+	if len(ips) > n {
+		ips = ips[:n]
+	}
+	for i, ip := range ips {
+		ips[i] = fmt.Sprintf("%s=%d", ip, perDestination[ip])
+	}
+	return strings.Join(ips, ",")
+}
@@ -0,0 +1,88 @@
+package netpolicy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func TestNetworkMonitor_checkFanout(t *testing.T) {
+	ch := make(chan collector.SecurityEvent, 10)
+	nm := New(Config{ScanInterval: time.Second, Fanout: FanoutConfig{MinConnections: 10, MinDestinations: 5, Sigma: 3}, EventChan: ch}, logrus.New())
+	outbound := func(n, dests int) []*Connection {
+		var conns []*Connection
+		for i := 0; i < n; i++ {
+			conns = append(conns, &Connection{
+				Protocol: "tcp", LocalIP: net.IPv4(10, 1, 0, 4), LocalPort: 40000 + i,
+				RemoteIP: net.IPv4(203, 0, 113, byte(1+i%dests)), RemotePort: 443, State: "ESTABLISHED",
+			})
+		}
+		// Internal and listening sockets do not count.
+		return append(conns,
+			&Connection{Protocol: "tcp", LocalIP: net.IPv4(10, 1, 0, 4), LocalPort: 39999, RemoteIP: net.IPv4(10, 0, 0, 10), RemotePort: 5432, State: "ESTABLISHED"},
+			&Connection{Protocol: "tcp", LocalIP: net.IPv4zero, LocalPort: 8080, RemoteIP: net.IPv4zero, State: "LISTEN"},
+		)
+	}
+	now := time.Now()
+
+	// A steady 2-4 new connections to 1-2 hosts per scan.
+	for i := 0; i < fanoutMinSamples; i++ {
+		nm.checkFanout(context.Background(), outbound(2+i%3, 1+i%2), now)
+	}
+	// 8 connections stays under the minimum of 10 even though it is far
+	// above the baseline.
+	nm.checkFanout(context.Background(), outbound(8, 2), now)
+	if len(ch) != 0 {
+		t.Fatalf("%d events for normal scans", len(ch))
+	}
+
+	// A scan of 40 hosts is reported once while it lasts.
+	nm.checkFanout(context.Background(), outbound(40, 40), now)
+	nm.checkFanout(context.Background(), outbound(40, 40), now)
+	if len(ch) != 1 {
+		t.Fatalf("%d events for a burst, want 1", len(ch))
+	}
+	e := <-ch
+	if e.Type != collector.EventTypeResourceAnomaly || e.Resource.AnomalyType != AnomalyConnectionFanout || e.Resource.AnomalyScore <= 1 {
+		t.Errorf("event = %+v, resource %+v", e, e.Resource)
+	}
+	if e.Metadata["new_connections"] != "40" || e.Metadata["distinct_destinations"] != "40" || e.Metadata["connections_threshold"] != "10.0" {
+		t.Errorf("metadata = %v", e.Metadata)
+	}
+	if got := len(nm.fanout.connections); got != fanoutMinSamples+1 {
+		t.Errorf("baseline has %d samples, the burst must be left out", got)
+	}
+
+	// After a quiet scan, an exfiltration burst to one host re-alerts on
+	// connections alone.
+	nm.checkFanout(context.Background(), outbound(3, 1), now)
+	nm.checkFanout(context.Background(), outbound(30, 1), now)
+	if len(ch) != 1 {
+		t.Fatalf("%d events after re-arming, want 1", len(ch))
+	}
+	if e := <-ch; e.Metadata["top_destinations"] != "203.0.113.1=30" {
+		t.Errorf("top_destinations = %q", e.Metadata["top_destinations"])
+	}
+}
+
+func TestTopDestinations(t *testing.T) {
+	per := map[string]int{}
+	for i := 1; i <= 7; i++ {
+		per[fmt.Sprintf("198.51.100.%d", i)] = i % 4
+	}
+	if got, want := topDestinations(per, 3), "198.51.100.3=3,198.51.100.7=3,198.51.100.2=2"; got != want {
+		t.Errorf("topDestinations = %q, want %q", got, want)
+	}
+}
+
+func TestNew_FanoutDisabled(t *testing.T) {
+	if nm := New(Config{ScanInterval: time.Second}, logrus.New()); nm.fanout != nil {
+		t.Error("fan-out tracking should be off without Sigma")
+	}
+}
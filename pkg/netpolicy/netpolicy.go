@@ -16,13 +16,23 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/jitter"
 )
 
 // Config for network monitoring
 type Config struct {
 	ScanInterval    time.Duration
 	SuspiciousPorts []int
-	EventChan       chan<- collector.SecurityEvent
+	// ListenBaselineWindow, when set, learns the ports listened on for that
+	// long after start and then reports only listeners on other ports.
+	ListenBaselineWindow time.Duration
+	// SMTPPorts and IRCPorts are destination ports of outbound mail and IRC
+	// connections, reported with MetadataOutboundProtocol.
+	SMTPPorts []int
+	IRCPorts  []int
+	// Fanout sets when bursts of new external connections are reported.
+	Fanout    FanoutConfig
+	EventChan chan<- collector.SecurityEvent
 }
 
 // Connection represents a network connection
@@ -35,6 +45,9 @@ type Connection struct {
 	State      string
 	Inode      uint64
 	UID        int
+	// OccurredAt is set when the owning process started after the previous
+	// scan: the socket was opened at or shortly after that start time.
+	OccurredAt time.Time
 }
 
 // NetworkMonitor monitors network connections within the container
@@ -46,11 +59,27 @@ type NetworkMonitor struct {
 	knownConns map[string]*Connection
 	mu         sync.RWMutex
 
-	// Suspicious ports as a set for fast lookup
+	// Suspicious ports as a set for fast lookup, replaceable at runtime
 	suspiciousPorts map[int]bool
+	portsMu         sync.RWMutex
 
 	// Private IP ranges
 	privateRanges []*net.IPNet
+
+	smtpPorts map[int]bool
+	ircPorts  map[int]bool
+
+	// procRoot is where socket owners are looked up; lastScan bounds when a
+	// newly seen connection can have been opened.
+	procRoot string
+	lastScan time.Time
+
+	// baseline is the learned listening ports; nil outside baseline mode.
+	baseline *listenBaseline
+	// fanout is the connection rate baseline; nil when disabled.
+	fanout *fanoutTracker
+
+	scan *jitter.Schedule
 }
 
 // New creates a new NetworkMonitor
@@ -59,11 +88,11 @@ func New(cfg Config, log *logrus.Logger) *NetworkMonitor {
 		cfg:             cfg,
 		log:             log,
 		knownConns:      make(map[string]*Connection),
-		suspiciousPorts: make(map[int]bool),
-	}
-
-	for _, port := range cfg.SuspiciousPorts {
-		nm.suspiciousPorts[port] = true
+		suspiciousPorts: portSet(cfg.SuspiciousPorts),
+		smtpPorts:       portSet(cfg.SMTPPorts),
+		ircPorts:        portSet(cfg.IRCPorts),
+		procRoot:        "/proc",
+		scan:            jitter.NewSchedule(cfg.ScanInterval),
 	}
 
 	// Initialize private IP ranges
@@ -73,20 +102,46 @@ func New(cfg Config, log *logrus.Logger) *NetworkMonitor {
 		"192.168.0.0/16",
 		"127.0.0.0/8",
 		"169.254.0.0/16", // Link-local
+		"fc00::/7",       // IPv6 unique local
+		"fe80::/10",      // IPv6 link-local
 	}
 	for _, cidr := range privateRangeStrs {
 		_, ipnet, _ := net.ParseCIDR(cidr)
 		nm.privateRanges = append(nm.privateRanges, ipnet)
 	}
 
+	if cfg.Fanout.Sigma > 0 {
+		nm.fanout = &fanoutTracker{cfg: cfg.Fanout}
+	}
+
 	return nm
 }
 
+// SetSuspiciousPorts replaces the set of suspicious ports
+func (nm *NetworkMonitor) SetSuspiciousPorts(ports []int) {
+	set := portSet(ports)
+	nm.portsMu.Lock()
+	nm.suspiciousPorts = set
+	nm.portsMu.Unlock()
+}
+
+func portSet(ports []int) map[int]bool {
+	set := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		set[port] = true
+	}
+	return set
+}
+
 // Start begins network monitoring
 func (nm *NetworkMonitor) Start(ctx context.Context) {
 	nm.log.Info("Starting network monitor")
+	if nm.cfg.ListenBaselineWindow > 0 {
+		nm.baseline = newListenBaseline(nm.cfg.ListenBaselineWindow, time.Now())
+		nm.log.WithField("window", nm.cfg.ListenBaselineWindow).Info("Learning listening-port baseline")
+	}
 
-	ticker := time.NewTicker(nm.cfg.ScanInterval)
+	ticker := nm.scan.NewTicker()
 	defer ticker.Stop()
 
 	for {
@@ -100,8 +155,14 @@ func (nm *NetworkMonitor) Start(ctx context.Context) {
 	}
 }
 
-// scanConnections reads /proc/net/tcp and /proc/net/udp
+// SetSlowdown multiplies the scan interval by factor; 1 restores it.
+func (nm *NetworkMonitor) SetSlowdown(factor int) {
+	nm.scan.SetSlowdown(factor)
+}
+
+// scanConnections reads /proc/net/tcp, tcp6, udp and udp6
 func (nm *NetworkMonitor) scanConnections(ctx context.Context) {
+	scanStart := time.Now()
 	currentConns := make(map[string]bool)
 
 	// Scan TCP connections
@@ -122,9 +183,17 @@ func (nm *NetworkMonitor) scanConnections(ctx context.Context) {
 		nm.log.WithError(err).Debug("Failed to read /proc/net/udp")
 	}
 
+	// Scan UDP6 connections
+	udp6Conns, err := nm.parseNetFile("/proc/net/udp6", "udp6")
+	if err != nil {
+		nm.log.WithError(err).Debug("Failed to read /proc/net/udp6")
+	}
+
 	allConns := append(tcpConns, tcp6Conns...)
 	allConns = append(allConns, udpConns...)
+	allConns = append(allConns, udp6Conns...)
 
+	var newConns []*Connection
 	for _, conn := range allConns {
 		key := nm.connectionKey(conn)
 		currentConns[key] = true
@@ -138,7 +207,25 @@ func (nm *NetworkMonitor) scanConnections(ctx context.Context) {
 			nm.knownConns[key] = conn
 			nm.mu.Unlock()
 
-			nm.analyzeConnection(ctx, conn)
+			newConns = append(newConns, conn)
+		}
+	}
+	nm.setOccurredAt(newConns)
+	if nm.fanout != nil && !nm.lastScan.IsZero() {
+		// The first scan's connections predate the agent.
+		nm.checkFanout(ctx, newConns, scanStart)
+	}
+	nm.lastScan = scanStart
+	for _, conn := range newConns {
+		if nm.baseline != nil && isListener(conn) {
+			nm.checkListener(ctx, conn, scanStart)
+			continue
+		}
+		nm.analyzeConnection(ctx, conn)
+	}
+	if nm.baseline != nil {
+		if ports, ok := nm.baseline.finish(scanStart); ok {
+			nm.log.WithField("ports", ports).Info("Listening-port baseline learned")
 		}
 	}
 
@@ -152,6 +239,31 @@ func (nm *NetworkMonitor) scanConnections(ctx context.Context) {
 	nm.mu.Unlock()
 }
 
+// setOccurredAt dates new connections whose owning process started since
+// the previous scan. Connections owned by older processes could have been
+// opened at any point in the scan interval and stay undated, as do all
+// connections on the first scan, which predate the agent.
+func (nm *NetworkMonitor) setOccurredAt(conns []*Connection) {
+	if nm.lastScan.IsZero() || len(conns) == 0 {
+		return
+	}
+	inodes := make(map[uint64]bool)
+	for _, conn := range conns {
+		if conn.Inode != 0 {
+			inodes[conn.Inode] = true
+		}
+	}
+	if len(inodes) == 0 {
+		return
+	}
+	starts := socketStartTimes(nm.procRoot, inodes)
+	for _, conn := range conns {
+		if start, ok := starts[conn.Inode]; ok && start.After(nm.lastScan) {
+			conn.OccurredAt = start
+		}
+	}
+}
+
 // parseNetFile parses /proc/net/tcp or /proc/net/udp
 func (nm *NetworkMonitor) parseNetFile(path, protocol string) ([]*Connection, error) {
 	file, err := os.Open(path)
@@ -213,41 +325,38 @@ func (nm *NetworkMonitor) parseLine(line, protocol string) (*Connection, error)
 	}, nil
 }
 
-// parseAddress parses an address from hex format (e.g., "0100007F:0050")
+// parseAddress parses an address from hex format (e.g., "0100007F:0050").
+// The kernel prints IPv4 addresses as one 32-bit word and IPv6 addresses as
+// four, each in host (little endian) byte order. IPv4-mapped IPv6 addresses,
+// as dual-stack sockets report IPv4 peers, print and match ranges as IPv4.
 func (nm *NetworkMonitor) parseAddress(s string) (net.IP, int, error) {
-	parts := strings.Split(s, ":")
-	if len(parts) != 2 {
-		return nil, 0, fmt.Errorf("invalid address format")
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid address format %q", s)
+	}
+	if len(ipHex) != 8 && len(ipHex) != 32 {
+		return nil, 0, fmt.Errorf("invalid address length %d in %q", len(ipHex), s)
+	}
+	ipBytes, err := hex.DecodeString(ipHex)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid address %q: %w", s, err)
 	}
 
-	ipHex := parts[0]
 	var ip net.IP
-
-	if len(ipHex) == 8 {
-		// IPv4
-		ipBytes, err := hex.DecodeString(ipHex)
-		if err != nil {
-			return nil, 0, err
-		}
+	if len(ipBytes) == net.IPv4len {
 		// Reverse byte order (little endian)
 		ip = net.IPv4(ipBytes[3], ipBytes[2], ipBytes[1], ipBytes[0])
-	} else if len(ipHex) == 32 {
-		// IPv6
-		ipBytes, err := hex.DecodeString(ipHex)
-		if err != nil {
-			return nil, 0, err
-		}
-		// Handle IPv6 byte order
-		ip = make(net.IP, 16)
-		for i := 0; i < 4; i++ {
-			start := i * 4
-			binary.LittleEndian.PutUint32(ip[start:start+4], binary.BigEndian.Uint32(ipBytes[start:start+4]))
+	} else {
+		// Reverse the byte order of each 32-bit word
+		ip = make(net.IP, net.IPv6len)
+		for i := 0; i < net.IPv6len; i += 4 {
+			binary.LittleEndian.PutUint32(ip[i:i+4], binary.BigEndian.Uint32(ipBytes[i:i+4]))
 		}
 	}
 
-	port, err := strconv.ParseInt(parts[1], 16, 32)
+	port, err := strconv.ParseUint(portHex, 16, 16)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, fmt.Errorf("invalid port in %q: %w", s, err)
 	}
 
 	return ip, int(port), nil
@@ -295,7 +404,9 @@ func (nm *NetworkMonitor) analyzeConnection(ctx context.Context, conn *Connectio
 	}
 
 	isExternal := !nm.isPrivateIP(conn.RemoteIP)
+	nm.portsMu.RLock()
 	isSuspiciousPort := nm.suspiciousPorts[conn.RemotePort] || nm.suspiciousPorts[conn.LocalPort]
+	nm.portsMu.RUnlock()
 
 	// Elevate severity based on suspicious indicators
 	if conn.State == "ESTABLISHED" && isExternal {
@@ -306,6 +417,11 @@ func (nm *NetworkMonitor) analyzeConnection(ctx context.Context, conn *Connectio
 		severity = collector.SeverityHigh
 	}
 
+	protocol := nm.outboundProtocol(conn, isExternal)
+	if s := protocolSeverity(protocol); s > severity {
+		severity = s
+	}
+
 	// Check for potential reverse shell indicators
 	if conn.State == "ESTABLISHED" && isExternal && nm.isPotentialReverseShell(conn) {
 		severity = collector.SeverityCritical
@@ -317,9 +433,10 @@ func (nm *NetworkMonitor) analyzeConnection(ctx context.Context, conn *Connectio
 	}
 
 	event := collector.SecurityEvent{
-		Type:      eventType,
-		Severity:  severity,
-		Timestamp: time.Now(),
+		Type:       eventType,
+		Severity:   severity,
+		Timestamp:  time.Now(),
+		OccurredAt: conn.OccurredAt,
 		Network: &collector.NetworkEvent{
 			Protocol:        conn.Protocol,
 			SrcIP:           conn.LocalIP.String(),
@@ -331,7 +448,14 @@ func (nm *NetworkMonitor) analyzeConnection(ctx context.Context, conn *Connectio
 			IsSuspiciousPort: isSuspiciousPort,
 		},
 	}
+	if protocol != "" {
+		event.Metadata = map[string]string{MetadataOutboundProtocol: protocol}
+	}
+
+	nm.emit(ctx, event)
+}
 
+func (nm *NetworkMonitor) emit(ctx context.Context, event collector.SecurityEvent) {
 	select {
 	case nm.cfg.EventChan <- event:
 	case <-ctx.Done():
@@ -3,6 +3,8 @@ package netpolicy
 import (
 	"context"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -132,3 +134,91 @@ func TestNetworkMonitor_analyzeConnection(t *testing.T) {
 		t.Error("expected one event from analyzeConnection")
 	}
 }
+
+func TestNetworkMonitor_SetSuspiciousPorts(t *testing.T) {
+	nm := New(Config{ScanInterval: time.Second, SuspiciousPorts: []int{4444}}, logrus.New())
+	nm.SetSuspiciousPorts([]int{1337})
+	if nm.suspiciousPorts[4444] || !nm.suspiciousPorts[1337] {
+		t.Errorf("suspiciousPorts = %v", nm.suspiciousPorts)
+	}
+}
+
+func TestNetworkMonitor_parseAddress(t *testing.T) {
+	nm := New(Config{ScanInterval: time.Second}, logrus.New())
+	tests := []struct {
+		in       string
+		wantIP   string
+		wantPort int
+	}{
+		{"0100007F:0050", "127.0.0.1", 80},
+		{"00000000:0035", "0.0.0.0", 53},
+		{"00000000000000000000000001000000:1F90", "::1", 8080},
+		{"00000000000000000000000000000000:0000", "::", 0},
+		{"B80D0120000000000000000001000000:01BB", "2001:db8::1", 443},
+		{"000080FE00000000FF0050020E1CFEFE:FFFF", "fe80::250:ff:fefe:1c0e", 65535},
+		{"0000000000000000FFFF0000090271CB:01BB", "203.113.2.9", 443},
+	}
+	for _, tt := range tests {
+		ip, port, err := nm.parseAddress(tt.in)
+		if err != nil {
+			t.Errorf("parseAddress(%q): %v", tt.in, err)
+			continue
+		}
+		if ip.String() != tt.wantIP || port != tt.wantPort {
+			t.Errorf("parseAddress(%q) = %s:%d, want %s:%d", tt.in, ip, port, tt.wantIP, tt.wantPort)
+		}
+	}
+	for _, in := range []string{
+		"0100007F",
+		"0100007F:0050:01",
+		"00007F:0050",
+		"0000000000000000000000000100000:0050",
+		"0100007G:0050",
+		"0100007F:10000",
+		"0100007F:",
+	} {
+		if ip, port, err := nm.parseAddress(in); err == nil {
+			t.Errorf("parseAddress(%q) = %s:%d, want error", in, ip, port)
+		}
+	}
+}
+
+func TestNetworkMonitor_parseNetFileUDP6(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "udp6")
+	content := `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  0: 00000000000000000000000000000000:14E9 00000000000000000000000000000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 23456 2 0000000000000000 0
+  1: B80D0120000000000000000002000000:D431 B80D0120000000000000000001000000:0035 01 00000000:00000000 00:00000000 00000000  1000        0 23457 2 0000000000000000 0
+  2: garbage
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	nm := New(Config{ScanInterval: time.Second}, logrus.New())
+	conns, err := nm.parseNetFile(path, "udp6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 2 {
+		t.Fatalf("got %d connections, want 2", len(conns))
+	}
+	if c := conns[0]; !isListener(c) || listenKey(c) != "udp/5353" || c.UID != 101 || c.Inode != 23456 {
+		t.Errorf("listener = %+v", c)
+	}
+	if c := conns[1]; c.LocalIP.String() != "2001:db8::2" || c.RemoteIP.String() != "2001:db8::1" || c.RemotePort != 53 || c.State != "ESTABLISHED" {
+		t.Errorf("connection = %+v", c)
+	}
+}
+
+func TestNetworkMonitor_isPrivateIPv6(t *testing.T) {
+	nm := New(Config{ScanInterval: time.Second}, logrus.New())
+	for _, s := range []string{"::1", "::", "fc00::1", "fd12:3456::1", "fe80::1", "febf::1", "::ffff:10.0.0.1"} {
+		if !nm.isPrivateIP(net.ParseIP(s)) {
+			t.Errorf("%s should be private", s)
+		}
+	}
+	for _, s := range []string{"2001:4860:4860::8888", "fec0::1", "fb00::1", "::ffff:8.8.8.8"} {
+		if nm.isPrivateIP(net.ParseIP(s)) {
+			t.Errorf("%s should not be private", s)
+		}
+	}
+}
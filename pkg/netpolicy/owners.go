@@ -0,0 +1,63 @@
+package netpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/procmon"
+)
+
+// socketStartTimes maps each socket inode in inodes to the start time of the
+// earliest-started process holding it open, found by walking the fd
+// directories under procRoot. Processes the agent may not inspect are
+// skipped, so sockets they own are left out.
+func socketStartTimes(procRoot string, inodes map[uint64]bool) map[uint64]time.Time {
+	times := make(map[uint64]time.Time)
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return times
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		procPath := filepath.Join(procRoot, entry.Name())
+		owned := ownedSockets(procPath, inodes)
+		if len(owned) == 0 {
+			continue
+		}
+		start, err := procmon.StartTime(procPath)
+		if err != nil {
+			continue
+		}
+		for _, inode := range owned {
+			if t, ok := times[inode]; !ok || start.Before(t) {
+				times[inode] = start
+			}
+		}
+	}
+	return times
+}
+
+// ownedSockets returns the inodes from want among the process's open sockets.
+func ownedSockets(procPath string, want map[uint64]bool) []uint64 {
+	fds, err := os.ReadDir(filepath.Join(procPath, "fd"))
+	if err != nil {
+		return nil
+	}
+	var owned []uint64
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(procPath, "fd", fd.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+		if err == nil && want[inode] {
+			owned = append(owned, inode)
+		}
+	}
+	return owned
+}
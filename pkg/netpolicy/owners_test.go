@@ -0,0 +1,83 @@
+package netpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/procmon"
+)
+
+// fakeProc creates procRoot/pid with a stat file starting ticks after boot
+// and fd symlinks to the given socket inodes.
+func fakeProc(t *testing.T, procRoot, pid, ticks string, links ...string) {
+	t.Helper()
+	dir := filepath.Join(procRoot, pid)
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	stat := pid + " (app) S 1 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 " + ticks + " 0 0"
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for i, link := range links {
+		if err := os.Symlink(link, filepath.Join(dir, "fd", string(rune('3'+i)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSocketStartTimes(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, "10", "500", "socket:[111]", "/dev/null", "socket:[222]")
+	fakeProc(t, root, "20", "100", "socket:[222]")
+	fakeProc(t, root, "30", "900", "socket:[333]")
+	// Non-PID entries are ignored.
+	if err := os.MkdirAll(filepath.Join(root, "net"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	got := socketStartTimes(root, map[uint64]bool{111: true, 222: true, 444: true})
+	start10, _ := procmon.StartTime(filepath.Join(root, "10"))
+	start20, _ := procmon.StartTime(filepath.Join(root, "20"))
+	if len(got) != 2 {
+		t.Fatalf("got %v, want inodes 111 and 222 only", got)
+	}
+	if !got[111].Equal(start10) {
+		t.Errorf("inode 111 = %v, want %v", got[111], start10)
+	}
+	// A socket shared after fork dates from the earliest holder.
+	if !got[222].Equal(start20) {
+		t.Errorf("inode 222 = %v, want %v", got[222], start20)
+	}
+}
+
+func TestNetworkMonitor_setOccurredAt(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, "10", "500", "socket:[111]")
+	fakeProc(t, root, "20", "100", "socket:[222]")
+	start10, _ := procmon.StartTime(filepath.Join(root, "10"))
+
+	nm := New(Config{ScanInterval: time.Second}, logrus.New())
+	nm.procRoot = root
+	fresh := &Connection{Inode: 111}
+	old := &Connection{Inode: 222}
+
+	nm.setOccurredAt([]*Connection{fresh, old})
+	if !fresh.OccurredAt.IsZero() {
+		t.Error("first scan should not date connections")
+	}
+
+	// Process 10 started after the previous scan, process 20 before it.
+	nm.lastScan = start10.Add(-time.Second)
+	nm.setOccurredAt([]*Connection{fresh, old})
+	if !fresh.OccurredAt.Equal(start10) {
+		t.Errorf("fresh.OccurredAt = %v, want %v", fresh.OccurredAt, start10)
+	}
+	if !old.OccurredAt.IsZero() {
+		t.Errorf("old.OccurredAt = %v, want zero", old.OccurredAt)
+	}
+}
@@ -0,0 +1,41 @@
+package netpolicy
+
+import "github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+
+// MetadataOutboundProtocol names the protocol an outbound connection's
+// destination port is known for, ProtocolSMTP or ProtocolIRC.
+const MetadataOutboundProtocol = "outbound_protocol"
+
+// Outbound protocols reported in MetadataOutboundProtocol.
+const (
+	ProtocolSMTP = "smtp"
+	ProtocolIRC  = "irc"
+)
+
+// outboundProtocol returns the protocol of an outbound connection to an
+// SMTP or IRC port, or "". SMTP counts only to external addresses, since
+// in-cluster mail relays are common; IRC counts anywhere.
+func (nm *NetworkMonitor) outboundProtocol(conn *Connection, isExternal bool) string {
+	if conn.State != "ESTABLISHED" && conn.State != "SYN_SENT" {
+		return ""
+	}
+	switch {
+	case isExternal && nm.smtpPorts[conn.RemotePort]:
+		return ProtocolSMTP
+	case nm.ircPorts[conn.RemotePort]:
+		return ProtocolIRC
+	}
+	return ""
+}
+
+// protocolSeverity is the lowest severity of a connection speaking protocol:
+// mail from a pod is MEDIUM, IRC, a common botnet channel, HIGH.
+func protocolSeverity(protocol string) collector.Severity {
+	switch protocol {
+	case ProtocolSMTP:
+		return collector.SeverityMedium
+	case ProtocolIRC:
+		return collector.SeverityHigh
+	}
+	return collector.SeverityUnknown
+}
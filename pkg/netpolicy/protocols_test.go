@@ -0,0 +1,41 @@
+package netpolicy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func TestNetworkMonitor_outboundProtocol(t *testing.T) {
+	ch := make(chan collector.SecurityEvent, 10)
+	nm := New(Config{ScanInterval: time.Second, SMTPPorts: []int{25, 465, 587}, IRCPorts: []int{6667}, EventChan: ch}, logrus.New())
+	tests := []struct {
+		name     string
+		remote   net.IP
+		port     int
+		state    string
+		want     string
+		severity collector.Severity
+	}{
+		{"external submission", net.IPv4(203, 0, 113, 5), 587, "ESTABLISHED", ProtocolSMTP, collector.SeverityMedium},
+		{"blocked spam attempt", net.IPv4(203, 0, 113, 5), 25, "SYN_SENT", ProtocolSMTP, collector.SeverityMedium},
+		{"in-cluster relay", net.IPv4(10, 0, 0, 25), 25, "ESTABLISHED", "", collector.SeverityInfo},
+		{"IRC", net.IPv4(10, 0, 0, 9), 6667, "ESTABLISHED", ProtocolIRC, collector.SeverityHigh},
+		{"closing", net.IPv4(203, 0, 113, 5), 6667, "TIME_WAIT", "", collector.SeverityInfo},
+		{"HTTPS", net.IPv4(203, 0, 113, 5), 443, "ESTABLISHED", "", collector.SeverityLow},
+	}
+	for _, tt := range tests {
+		nm.analyzeConnection(context.Background(), &Connection{
+			Protocol: "tcp", LocalIP: net.IPv4(10, 1, 0, 4), LocalPort: 40000, RemoteIP: tt.remote, RemotePort: tt.port, State: tt.state,
+		})
+		e := <-ch
+		if e.Metadata[MetadataOutboundProtocol] != tt.want || e.Severity != tt.severity {
+			t.Errorf("%s: protocol %q severity %v, want %q %v", tt.name, e.Metadata[MetadataOutboundProtocol], e.Severity, tt.want, tt.severity)
+		}
+	}
+}
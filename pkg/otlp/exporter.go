@@ -0,0 +1,332 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+)
+
+// Transport protocols, named as in OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	ProtocolGRPC         = "grpc"
+	ProtocolHTTPProtobuf = "http/protobuf"
+)
+
+// Defaults for Config fields left zero.
+const (
+	DefaultProtocol      = ProtocolHTTPProtobuf
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = 5 * time.Second
+	DefaultQueueSize     = 10000
+	DefaultTimeout       = 10 * time.Second
+)
+
+const (
+	// logsPath is the OTLP/HTTP logs endpoint, relative to the endpoint URL.
+	logsPath = "/v1/logs"
+	// grpcMethod is the gRPC method logs are exported with.
+	grpcMethod = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+)
+
+var exported = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_otlp_log_records_total",
+		Help: "Total log records exported over OTLP by result (sent, rejected, failed, dropped)",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(exported)
+}
+
+// Config for the exporter.
+type Config struct {
+	// Endpoint is the collector base URL, e.g. http://otel-collector:4318
+	// for http/protobuf or http://otel-collector:4317 for grpc. An http URL
+	// uses plaintext (h2c for grpc), https uses TLS.
+	Endpoint string
+	// Protocol is ProtocolGRPC or ProtocolHTTPProtobuf.
+	Protocol string
+	// Headers are sent with every export, e.g. for authentication.
+	Headers map[string]string
+	// Scope names the instrumentation in every export.
+	Scope Scope
+	// BatchSize records are sent in one export; a partial batch is sent
+	// after FlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueueSize bounds records waiting to be sent; beyond it they are
+	// dropped.
+	QueueSize int
+	Timeout   time.Duration
+	// Egress sets the proxy and TLS trust used to reach the collector. gRPC
+	// exports cannot go through a proxy.
+	Egress egress.Config
+}
+
+// Exporter queues log records and exports them in batches from Run.
+type Exporter struct {
+	cfg        Config
+	url        string
+	httpClient *http.Client
+	queue      chan Record
+	log        *logrus.Logger
+}
+
+// NewExporter creates an OTLP log exporter, filling in defaults for zero
+// fields. It fails on an unknown protocol, an endpoint that is not an http
+// or https URL, or egress settings it cannot apply.
+func NewExporter(cfg Config, log *logrus.Logger) (*Exporter, error) {
+	if cfg.Protocol == "" {
+		cfg.Protocol = DefaultProtocol
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: want an http or https URL", cfg.Endpoint)
+	}
+	base := strings.TrimRight(cfg.Endpoint, "/")
+
+	e := &Exporter{cfg: cfg, queue: make(chan Record, cfg.QueueSize), log: log}
+	switch cfg.Protocol {
+	case ProtocolHTTPProtobuf:
+		e.url = base + logsPath
+		t, err := cfg.Egress.Transport()
+		if err != nil {
+			return nil, fmt.Errorf("OTLP egress: %w", err)
+		}
+		e.httpClient = &http.Client{Timeout: cfg.Timeout, Transport: t}
+	case ProtocolGRPC:
+		e.url = base + grpcMethod
+		if cfg.Egress.ProxyURL != "" {
+			return nil, fmt.Errorf("OTLP over %s cannot use a proxy; use %s", ProtocolGRPC, ProtocolHTTPProtobuf)
+		}
+		tlsConfig, err := cfg.Egress.TLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("OTLP egress: %w", err)
+		}
+		t := &http2.Transport{TLSClientConfig: tlsConfig}
+		if u.Scheme == "http" {
+			// gRPC without TLS is HTTP/2 with prior knowledge (h2c).
+			t.AllowHTTP = true
+			t.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			}
+		}
+		e.httpClient = &http.Client{Timeout: cfg.Timeout, Transport: t}
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q: want %s or %s", cfg.Protocol, ProtocolGRPC, ProtocolHTTPProtobuf)
+	}
+	return e, nil
+}
+
+// Export queues a record. It never blocks; it returns false if the queue is
+// full and the record was dropped.
+func (e *Exporter) Export(r Record) bool {
+	select {
+	case e.queue <- r:
+		return true
+	default:
+		exported.WithLabelValues("dropped").Inc()
+		return false
+	}
+}
+
+// Run exports queued records until ctx is done, then sends what is left.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Record, 0, e.cfg.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(ctx, batch); err != nil {
+			e.log.WithError(err).WithField("records", len(batch)).Error("Failed to export log records over OTLP")
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+			defer cancel()
+			for n := len(e.queue); n > 0; n-- {
+				batch = append(batch, <-e.queue)
+				if len(batch) >= e.cfg.BatchSize {
+					flush(drainCtx)
+				}
+			}
+			flush(drainCtx)
+			return
+		case r := <-e.queue:
+			batch = append(batch, r)
+			if len(batch) >= e.cfg.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// send exports batch in one request and counts the outcome. Records the
+// backend reports as rejected in a partial success are counted as such.
+func (e *Exporter) send(ctx context.Context, batch []Record) error {
+	body := EncodeRequest(e.cfg.Scope, batch)
+	var (
+		resp []byte
+		err  error
+	)
+	if e.cfg.Protocol == ProtocolGRPC {
+		resp, err = e.postGRPC(ctx, body)
+	} else {
+		resp, err = e.postHTTP(ctx, body)
+	}
+	if err != nil {
+		exported.WithLabelValues("failed").Add(float64(len(batch)))
+		return err
+	}
+	ps, err := decodeResponse(resp)
+	if err != nil {
+		// The records were accepted; only the response is unreadable.
+		exported.WithLabelValues("sent").Add(float64(len(batch)))
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	rejected := ps.Rejected
+	if rejected > int64(len(batch)) {
+		rejected = int64(len(batch))
+	}
+	exported.WithLabelValues("sent").Add(float64(int64(len(batch)) - rejected))
+	if rejected > 0 || ps.ErrorMessage != "" {
+		exported.WithLabelValues("rejected").Add(float64(rejected))
+		return fmt.Errorf("%d of %d records rejected: %s", ps.Rejected, len(batch), ps.ErrorMessage)
+	}
+	return nil
+}
+
+func (e *Exporter) newRequest(ctx context.Context, body []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// postHTTP sends an OTLP/HTTP request and returns the response message.
+func (e *Exporter) postHTTP(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := e.newRequest(ctx, body, "application/x-protobuf")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return msg, nil
+}
+
+// postGRPC makes a unary gRPC call and returns the response message.
+func (e *Exporter) postGRPC(ctx context.Context, body []byte) ([]byte, error) {
+	// A gRPC message is prefixed with a compressed flag and its length.
+	frame := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(body)))
+	frame = append(frame, body...)
+	req, err := e.newRequest(ctx, frame, "application/grpc")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("TE", "trailers")
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	// The status is in the trailers, or in the headers of a response
+	// without a body.
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if msg, err := url.PathUnescape(message); err == nil {
+			message = msg
+		}
+		return nil, fmt.Errorf("grpc status %s: %s", status, message)
+	}
+	if len(data) < 5 {
+		return nil, nil
+	}
+	n := binary.BigEndian.Uint32(data[1:5])
+	if data[0] != 0 || int(n) > len(data)-5 {
+		return nil, fmt.Errorf("malformed grpc response of %d bytes", len(data))
+	}
+	return data[5 : 5+n], nil
+}
+
+// ParseHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS format,
+// comma-separated key=value pairs with URL-encoded values.
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid header %q: want key=value", pair)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q: %w", pair, err)
+		}
+		headers[strings.TrimSpace(k)] = value
+	}
+	return headers, nil
+}
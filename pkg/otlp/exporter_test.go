@@ -0,0 +1,179 @@
+package otlp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+)
+
+func TestExporter_HTTPProtobuf(t *testing.T) {
+	requests := make(chan []decodedLogs, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- decodeRequest(t, body)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer srv.Close()
+
+	e, err := NewExporter(Config{
+		Endpoint: srv.URL + "/", Headers: map[string]string{"Authorization": "Bearer tok"},
+		BatchSize: 2, FlushInterval: 50 * time.Millisecond,
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	for i := 0; i < 3; i++ {
+		e.Export(Record{Severity: SeverityWarn, Resource: []KeyValue{String("k8s.pod.name", "p")}})
+	}
+	// A full batch is sent at once; the partial one after FlushInterval.
+	var sizes []int
+	for len(sizes) < 2 {
+		select {
+		case req := <-requests:
+			sizes = append(sizes, len(req[0].Records))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d requests, want 2", len(sizes))
+		}
+	}
+	if sizes[0] != 2 || sizes[1] != 1 {
+		t.Errorf("batch sizes = %v, want [2 1]", sizes)
+	}
+}
+
+func TestExporter_PartialSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var partial []byte
+		partial = protowire.AppendTag(partial, fieldPartialRejected, protowire.VarintType)
+		partial = protowire.AppendVarint(partial, 1)
+		partial = appendString(partial, fieldPartialErrorMessage, "record too large")
+		w.Write(appendMessage(nil, fieldResponsePartialSuccess, partial))
+	}))
+	defer srv.Close()
+
+	e, err := NewExporter(Config{Endpoint: srv.URL}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	err = e.send(context.Background(), []Record{{}, {}})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") || !strings.Contains(err.Error(), "record too large") {
+		t.Errorf("send err = %v, want the partial success", err)
+	}
+}
+
+// grpcServer serves the logs Export method over h2c, replying with status.
+func grpcServer(t *testing.T, status, message string, got chan<- []decodedLogs) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != grpcMethod || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("request %s %s %s", r.Proto, r.URL.Path, r.Header.Get("Content-Type"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		frame, _ := io.ReadAll(r.Body)
+		if len(frame) < 5 || int(binary.BigEndian.Uint32(frame[1:5])) != len(frame)-5 {
+			t.Errorf("malformed grpc frame of %d bytes", len(frame))
+		} else if got != nil {
+			got <- decodeRequest(t, frame[5:])
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", status)
+		w.Header().Set("Grpc-Message", message)
+	})
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+func TestExporter_GRPC(t *testing.T) {
+	got := make(chan []decodedLogs, 1)
+	srv := grpcServer(t, "0", "", got)
+	defer srv.Close()
+
+	e, err := NewExporter(Config{Endpoint: srv.URL, Protocol: ProtocolGRPC}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	if err := e.send(context.Background(), []Record{{Severity: SeverityError, Body: "x"}}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	req := <-got
+	if len(req) != 1 || len(req[0].Records) != 1 || req[0].Records[0].Body != "x" {
+		t.Errorf("exported %+v", req)
+	}
+}
+
+func TestExporter_GRPCError(t *testing.T) {
+	srv := grpcServer(t, "16", "missing%20token", nil)
+	defer srv.Close()
+
+	e, err := NewExporter(Config{Endpoint: srv.URL, Protocol: ProtocolGRPC}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	err = e.send(context.Background(), []Record{{}})
+	if err == nil || !strings.Contains(err.Error(), "grpc status 16: missing token") {
+		t.Errorf("send err = %v, want the grpc status", err)
+	}
+}
+
+func TestNewExporter_Invalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Endpoint: "otel-collector:4317"},
+		{Endpoint: "ftp://otel-collector"},
+		{Endpoint: "http://otel-collector:4318", Protocol: "http/json"},
+		// gRPC goes over HTTP/2 directly, which cannot use an HTTP proxy.
+		{Endpoint: "https://otel-collector:4317", Protocol: ProtocolGRPC, Egress: egress.Config{ProxyURL: "http://proxy.corp:3128"}},
+	} {
+		if _, err := NewExporter(cfg, logrus.New()); err == nil {
+			t.Errorf("NewExporter(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestExporter_QueueFull(t *testing.T) {
+	e, err := NewExporter(Config{Endpoint: "http://127.0.0.1:1", QueueSize: 1}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	if !e.Export(Record{}) {
+		t.Fatal("first record dropped")
+	}
+	if e.Export(Record{}) {
+		t.Error("second record queued past QueueSize")
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	got, err := ParseHeaders("Authorization=Bearer%20a+b/c=, x-tenant = acme ,")
+	if err != nil {
+		t.Fatalf("ParseHeaders: %v", err)
+	}
+	if got["Authorization"] != "Bearer a+b/c=" || got["x-tenant"] != "acme" || len(got) != 2 {
+		t.Errorf("ParseHeaders = %v", got)
+	}
+	if _, err := ParseHeaders("no-value"); err == nil {
+		t.Error("header without = parsed")
+	}
+}
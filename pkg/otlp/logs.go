@@ -0,0 +1,280 @@
+// Package otlp exports log records to an OpenTelemetry collector or any
+// OTLP-compatible backend, over gRPC or HTTP with protobuf payloads.
+//
+// Only the small part of the OTLP logs protocol the sensor needs is
+// implemented, encoded directly with protowire rather than generated code.
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Severity numbers from the OpenTelemetry logs data model.
+const (
+	SeverityInfo  int32 = 9
+	SeverityWarn  int32 = 13
+	SeverityError int32 = 17
+	SeverityFatal int32 = 21
+)
+
+// KeyValue is a resource or log record attribute. Value is a string, bool,
+// int, int64, float64 or []string; other types are sent as their fmt
+// representation.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, value string) KeyValue { return KeyValue{Key: key, Value: value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) KeyValue { return KeyValue{Key: key, Value: value} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) KeyValue { return KeyValue{Key: key, Value: value} }
+
+// Strings returns a string array attribute.
+func Strings(key string, value []string) KeyValue { return KeyValue{Key: key, Value: value} }
+
+// Record is one log record and the resource that produced it.
+type Record struct {
+	// Time is when the activity happened; ObservedTime is when it was seen.
+	Time         time.Time
+	ObservedTime time.Time
+	Severity     int32
+	SeverityText string
+	Body         string
+	// Resource describes the entity the record is about, e.g. the pod.
+	// Records with equal resources are sent under one resource entry.
+	Resource   []KeyValue
+	Attributes []KeyValue
+}
+
+// Field numbers of the OTLP protobuf messages used here.
+const (
+	fieldRequestResourceLogs = 1 // ExportLogsServiceRequest.resource_logs
+
+	fieldResourceLogsResource  = 1 // ResourceLogs.resource
+	fieldResourceLogsScopeLogs = 2 // ResourceLogs.scope_logs
+	fieldResourceAttributes    = 1 // Resource.attributes
+
+	fieldScopeLogsScope      = 1 // ScopeLogs.scope
+	fieldScopeLogsLogRecords = 2 // ScopeLogs.log_records
+	fieldScopeName           = 1 // InstrumentationScope.name
+	fieldScopeVersion        = 2 // InstrumentationScope.version
+
+	fieldLogTime         = 1  // LogRecord.time_unix_nano
+	fieldLogSeverity     = 2  // LogRecord.severity_number
+	fieldLogSeverityText = 3  // LogRecord.severity_text
+	fieldLogBody         = 5  // LogRecord.body
+	fieldLogAttributes   = 6  // LogRecord.attributes
+	fieldLogObservedTime = 11 // LogRecord.observed_time_unix_nano
+
+	fieldKeyValueKey   = 1 // KeyValue.key
+	fieldKeyValueValue = 2 // KeyValue.value
+
+	fieldAnyString = 1 // AnyValue.string_value
+	fieldAnyBool   = 2 // AnyValue.bool_value
+	fieldAnyInt    = 3 // AnyValue.int_value
+	fieldAnyDouble = 4 // AnyValue.double_value
+	fieldAnyArray  = 5 // AnyValue.array_value
+	fieldArrayVals = 1 // ArrayValue.values
+
+	fieldResponsePartialSuccess = 1 // ExportLogsServiceResponse.partial_success
+	fieldPartialRejected        = 1 // ExportLogsPartialSuccess.rejected_log_records
+	fieldPartialErrorMessage    = 2 // ExportLogsPartialSuccess.error_message
+)
+
+// Scope identifies the instrumentation that produced the records.
+type Scope struct {
+	Name    string
+	Version string
+}
+
+// EncodeRequest encodes records as an ExportLogsServiceRequest, grouping
+// them by resource in order of first appearance.
+func EncodeRequest(scope Scope, records []Record) []byte {
+	var order []string
+	groups := map[string][]int{}
+	for i, r := range records {
+		key := resourceKey(r.Resource)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	var b []byte
+	for _, key := range order {
+		idx := groups[key]
+		var resource []byte
+		for _, kv := range records[idx[0]].Resource {
+			resource = appendMessage(resource, fieldResourceAttributes, appendKeyValue(nil, kv))
+		}
+		sc := appendString(nil, fieldScopeName, scope.Name)
+		sc = appendString(sc, fieldScopeVersion, scope.Version)
+		sl := appendMessage(nil, fieldScopeLogsScope, sc)
+		for _, i := range idx {
+			sl = appendMessage(sl, fieldScopeLogsLogRecords, appendLogRecord(nil, records[i]))
+		}
+		rl := appendMessage(nil, fieldResourceLogsResource, resource)
+		rl = appendMessage(rl, fieldResourceLogsScopeLogs, sl)
+		b = appendMessage(b, fieldRequestResourceLogs, rl)
+	}
+	return b
+}
+
+// resourceKey identifies a resource independent of attribute order.
+func resourceKey(attrs []KeyValue) string {
+	parts := make([]string, len(attrs))
+	for i, kv := range attrs {
+		parts[i] = fmt.Sprintf("%s=%v", kv.Key, kv.Value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\x00")
+}
+
+func appendLogRecord(b []byte, r Record) []byte {
+	if !r.Time.IsZero() {
+		b = protowire.AppendTag(b, fieldLogTime, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, uint64(r.Time.UnixNano()))
+	}
+	if r.Severity != 0 {
+		b = protowire.AppendTag(b, fieldLogSeverity, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Severity))
+	}
+	b = appendString(b, fieldLogSeverityText, r.SeverityText)
+	if r.Body != "" {
+		b = appendMessage(b, fieldLogBody, appendString(nil, fieldAnyString, r.Body))
+	}
+	for _, kv := range r.Attributes {
+		b = appendMessage(b, fieldLogAttributes, appendKeyValue(nil, kv))
+	}
+	if !r.ObservedTime.IsZero() {
+		b = protowire.AppendTag(b, fieldLogObservedTime, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, uint64(r.ObservedTime.UnixNano()))
+	}
+	return b
+}
+
+func appendKeyValue(b []byte, kv KeyValue) []byte {
+	b = appendString(b, fieldKeyValueKey, kv.Key)
+	return appendMessage(b, fieldKeyValueValue, appendAnyValue(nil, kv.Value))
+}
+
+func appendAnyValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		b = protowire.AppendTag(b, fieldAnyString, protowire.BytesType)
+		return protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, fieldAnyBool, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int:
+		b = protowire.AppendTag(b, fieldAnyInt, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(int64(v)))
+	case int64:
+		b = protowire.AppendTag(b, fieldAnyInt, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v))
+	case float64:
+		b = protowire.AppendTag(b, fieldAnyDouble, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v))
+	case []string:
+		var arr []byte
+		for _, s := range v {
+			arr = appendMessage(arr, fieldArrayVals, appendAnyValue(nil, s))
+		}
+		return appendMessage(b, fieldAnyArray, arr)
+	}
+	return appendAnyValue(b, fmt.Sprint(v))
+}
+
+// appendString appends a string field, omitting it when empty as proto3
+// does.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendMessage appends an embedded message field. Empty messages are still
+// written so that, e.g., an empty string attribute keeps its value.
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// partialSuccess is the ExportLogsPartialSuccess of a response.
+type partialSuccess struct {
+	Rejected     int64
+	ErrorMessage string
+}
+
+// decodeResponse reads the partial success, if any, from an encoded
+// ExportLogsServiceResponse.
+func decodeResponse(b []byte) (partialSuccess, error) {
+	var ps partialSuccess
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != fieldResponsePartialSuccess || typ != protowire.BytesType {
+			return nil
+		}
+		return walk(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+			switch {
+			case num == fieldPartialRejected && typ == protowire.VarintType:
+				ps.Rejected = int64(n)
+			case num == fieldPartialErrorMessage && typ == protowire.BytesType:
+				ps.ErrorMessage = string(v)
+			}
+			return nil
+		})
+	})
+	return ps, err
+}
+
+// walk calls fn for each field of an encoded message, with the contents of
+// length-delimited fields in v and the value of varint and fixed fields in n.
+func walk(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			return protowire.ParseError(tagLen)
+		}
+		b = b[tagLen:]
+		var (
+			v      []byte
+			n      uint64
+			valLen int
+		)
+		switch typ {
+		case protowire.VarintType:
+			n, valLen = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			n, valLen = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var n32 uint32
+			n32, valLen = protowire.ConsumeFixed32(b)
+			n = uint64(n32)
+		case protowire.BytesType:
+			v, valLen = protowire.ConsumeBytes(b)
+		default:
+			valLen = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if valLen < 0 {
+			return protowire.ParseError(valLen)
+		}
+		if err := fn(num, typ, v, n); err != nil {
+			return err
+		}
+		b = b[valLen:]
+	}
+	return nil
+}
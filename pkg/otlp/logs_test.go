@@ -0,0 +1,187 @@
+package otlp
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodedLogs is an ExportLogsServiceRequest decoded just enough for tests.
+type decodedLogs struct {
+	Resource map[string]interface{}
+	Scope    Scope
+	Records  []decodedRecord
+}
+
+type decodedRecord struct {
+	Time, ObservedTime uint64
+	Severity           int32
+	SeverityText       string
+	Body               string
+	Attributes         map[string]interface{}
+}
+
+func decodeAnyValue(t *testing.T, b []byte) interface{} {
+	t.Helper()
+	var v interface{}
+	mustWalk(t, b, func(num protowire.Number, typ protowire.Type, raw []byte, n uint64) {
+		switch num {
+		case fieldAnyString:
+			v = string(raw)
+		case fieldAnyBool:
+			v = n != 0
+		case fieldAnyInt:
+			v = int64(n)
+		case fieldAnyDouble:
+			v = math.Float64frombits(n)
+		case fieldAnyArray:
+			arr := []interface{}{}
+			mustWalk(t, raw, func(_ protowire.Number, _ protowire.Type, raw []byte, _ uint64) {
+				arr = append(arr, decodeAnyValue(t, raw))
+			})
+			v = arr
+		}
+	})
+	return v
+}
+
+func decodeKeyValues(t *testing.T, into map[string]interface{}, b []byte) {
+	t.Helper()
+	var key string
+	var value interface{}
+	mustWalk(t, b, func(num protowire.Number, _ protowire.Type, raw []byte, _ uint64) {
+		if num == fieldKeyValueKey {
+			key = string(raw)
+		} else {
+			value = decodeAnyValue(t, raw)
+		}
+	})
+	into[key] = value
+}
+
+func decodeRequest(t *testing.T, b []byte) []decodedLogs {
+	t.Helper()
+	var out []decodedLogs
+	mustWalk(t, b, func(_ protowire.Number, _ protowire.Type, rl []byte, _ uint64) {
+		logs := decodedLogs{Resource: map[string]interface{}{}}
+		mustWalk(t, rl, func(num protowire.Number, _ protowire.Type, raw []byte, _ uint64) {
+			if num == fieldResourceLogsResource {
+				mustWalk(t, raw, func(_ protowire.Number, _ protowire.Type, kv []byte, _ uint64) {
+					decodeKeyValues(t, logs.Resource, kv)
+				})
+				return
+			}
+			mustWalk(t, raw, func(num protowire.Number, _ protowire.Type, raw []byte, _ uint64) {
+				if num == fieldScopeLogsScope {
+					mustWalk(t, raw, func(num protowire.Number, _ protowire.Type, raw []byte, _ uint64) {
+						if num == fieldScopeName {
+							logs.Scope.Name = string(raw)
+						} else {
+							logs.Scope.Version = string(raw)
+						}
+					})
+					return
+				}
+				rec := decodedRecord{Attributes: map[string]interface{}{}}
+				mustWalk(t, raw, func(num protowire.Number, _ protowire.Type, raw []byte, n uint64) {
+					switch num {
+					case fieldLogTime:
+						rec.Time = n
+					case fieldLogObservedTime:
+						rec.ObservedTime = n
+					case fieldLogSeverity:
+						rec.Severity = int32(n)
+					case fieldLogSeverityText:
+						rec.SeverityText = string(raw)
+					case fieldLogBody:
+						rec.Body, _ = decodeAnyValue(t, raw).(string)
+					case fieldLogAttributes:
+						decodeKeyValues(t, rec.Attributes, raw)
+					}
+				})
+				logs.Records = append(logs.Records, rec)
+			})
+		})
+		out = append(out, logs)
+	})
+	return out
+}
+
+func mustWalk(t *testing.T, b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64)) {
+	t.Helper()
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		fn(num, typ, v, n)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("malformed message: %v", err)
+	}
+}
+
+func TestEncodeRequest(t *testing.T) {
+	at := time.Unix(1700000000, 5)
+	podA := []KeyValue{String("k8s.pod.name", "a"), String("k8s.namespace.name", "ns")}
+	records := []Record{
+		{Time: at, ObservedTime: at.Add(time.Second), Severity: SeverityFatal, SeverityText: "CRITICAL", Body: `{"id":"1"}`,
+			Resource: podA,
+			Attributes: []KeyValue{
+				String("apss.event.id", "1"), Int("process.pid", 42), Bool("apss.network.is_external", true),
+				Strings("process.command_args", []string{"sh", "-c"}), {Key: "apss.score", Value: 0.5}, String("empty", ""),
+			}},
+		{Severity: SeverityInfo, Resource: []KeyValue{String("k8s.pod.name", "b")}},
+		// Same resource as the first record with attributes in another order.
+		{Severity: SeverityWarn, Resource: []KeyValue{podA[1], podA[0]}},
+	}
+	got := decodeRequest(t, EncodeRequest(Scope{Name: "apss", Version: "1.0"}, records))
+	if len(got) != 2 {
+		t.Fatalf("resource logs = %d, want 2 (records grouped by resource)", len(got))
+	}
+	if want := map[string]interface{}{"k8s.pod.name": "a", "k8s.namespace.name": "ns"}; !reflect.DeepEqual(got[0].Resource, want) {
+		t.Errorf("resource = %v, want %v", got[0].Resource, want)
+	}
+	if got[0].Scope != (Scope{Name: "apss", Version: "1.0"}) {
+		t.Errorf("scope = %+v", got[0].Scope)
+	}
+	if len(got[0].Records) != 2 || len(got[1].Records) != 1 {
+		t.Fatalf("records per resource = %d, %d; want 2, 1", len(got[0].Records), len(got[1].Records))
+	}
+	rec := got[0].Records[0]
+	if rec.Time != uint64(at.UnixNano()) || rec.ObservedTime != uint64(at.Add(time.Second).UnixNano()) {
+		t.Errorf("times = %d, %d", rec.Time, rec.ObservedTime)
+	}
+	if rec.Severity != SeverityFatal || rec.SeverityText != "CRITICAL" || rec.Body != `{"id":"1"}` {
+		t.Errorf("record = %+v", rec)
+	}
+	wantAttrs := map[string]interface{}{
+		"apss.event.id": "1", "process.pid": int64(42), "apss.network.is_external": true,
+		"process.command_args": []interface{}{"sh", "-c"}, "apss.score": 0.5, "empty": "",
+	}
+	if !reflect.DeepEqual(rec.Attributes, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", rec.Attributes, wantAttrs)
+	}
+	if got[0].Records[1].Severity != SeverityWarn {
+		t.Errorf("second record of resource a = %+v", got[0].Records[1])
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	var partial []byte
+	partial = protowire.AppendTag(partial, fieldPartialRejected, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, 3)
+	partial = appendString(partial, fieldPartialErrorMessage, "bad records")
+	resp := appendMessage(nil, fieldResponsePartialSuccess, partial)
+
+	ps, err := decodeResponse(resp)
+	if err != nil || ps.Rejected != 3 || ps.ErrorMessage != "bad records" {
+		t.Errorf("decodeResponse = %+v, %v", ps, err)
+	}
+	if ps, err := decodeResponse(nil); err != nil || ps != (partialSuccess{}) {
+		t.Errorf("empty response = %+v, %v", ps, err)
+	}
+	if _, err := decodeResponse([]byte{0x0a, 0x05}); err == nil {
+		t.Error("truncated response decoded without error")
+	}
+}
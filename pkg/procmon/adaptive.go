@@ -0,0 +1,221 @@
+package procmon
+
+import (
+	"context"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Without the process connector, a process that starts and exits between
+// two scans is never seen. The scan scheduler narrows that blind spot: it
+// halves the interval, down to Config.MinScanInterval, while processes
+// churn, relaxes it back towards Config.ScanInterval when they do not, and
+// between full scans samples /proc for new PIDs Config.ScanSamples - 1
+// times at jittered offsets, so a process cannot hide by matching the
+// scan period.
+
+const (
+	// scanChurnThreshold new or missed processes in one interval tighten
+	// the next one.
+	scanChurnThreshold = 2
+	// scanRelaxFactor stretches the interval after one without churn.
+	scanRelaxFactor = 1.5
+)
+
+var (
+	procScans = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_agent_proc_scans_total",
+			Help: "Total /proc reads by kind (full, sample)",
+		},
+		[]string{"kind"},
+	)
+	scanInterval = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "apss_agent_proc_scan_interval_seconds",
+		Help: "Current interval between full /proc scans",
+	})
+	processesSeen = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "apss_agent_processes_seen_total",
+		Help: "Total new processes inspected",
+	})
+	processesMissed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "apss_agent_processes_missed_estimated_total",
+		Help: "Estimated processes and threads that started and exited between scans unseen",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(procScans, scanInterval, processesSeen, processesMissed)
+}
+
+// scanScheduler plans the wakeups of the monitor loop. It is only used from
+// the loop's goroutine.
+type scanScheduler struct {
+	min, max time.Duration
+	samples  int
+	interval time.Duration
+	// baseMin and baseMax are min and max before a slowdown by factor.
+	baseMin, baseMax time.Duration
+	factor           int
+	// waits are the delays before the wakeups left in this interval; the
+	// last one is the full scan.
+	waits []time.Duration
+
+	// seen counts processes inspected since the last full scan.
+	seen int
+	// lastPID and threads are the PID counter and the number of extra
+	// threads at the last full scan; lastPID is -1 until one succeeded.
+	lastPID int
+	threads int
+}
+
+func newScanScheduler(cfg Config) *scanScheduler {
+	s := &scanScheduler{min: cfg.MinScanInterval, max: cfg.ScanInterval, samples: cfg.ScanSamples, interval: cfg.ScanInterval, lastPID: -1}
+	if s.min <= 0 || s.min > s.max {
+		s.min = s.max
+	}
+	if s.samples < 1 {
+		s.samples = 1
+	}
+	s.baseMin, s.baseMax, s.factor = s.min, s.max, 1
+	scanInterval.Set(s.interval.Seconds())
+	return s
+}
+
+// fixed stops adapting and sampling, for when the process connector reports
+// every exec.
+func (s *scanScheduler) fixed() {
+	s.min, s.samples, s.interval, s.waits = s.max, 1, s.max, nil
+	s.baseMin = s.baseMax
+	scanInterval.Set(s.interval.Seconds())
+}
+
+// slowdown multiplies the interval bounds by factor, 1 restoring them, and
+// drops the wakeups planned with the old ones.
+func (s *scanScheduler) slowdown(factor int) {
+	factor = max(factor, 1)
+	s.min, s.max = s.baseMin*time.Duration(factor), s.baseMax*time.Duration(factor)
+	s.interval = min(max(s.interval/time.Duration(s.factor)*time.Duration(factor), s.min), s.max)
+	s.factor, s.waits = factor, nil
+	scanInterval.Set(s.interval.Seconds())
+}
+
+// next returns how long to wait for the next wakeup and whether it is a
+// full scan rather than a sample.
+func (s *scanScheduler) next() (time.Duration, bool) {
+	if len(s.waits) == 0 {
+		s.plan()
+	}
+	wait := s.waits[0]
+	s.waits = s.waits[1:]
+	return wait, len(s.waits) == 0
+}
+
+// plan spreads the samples over the interval, each within a quarter slot
+// of its even spacing.
+func (s *scanScheduler) plan() {
+	slot := s.interval / time.Duration(s.samples)
+	var prev time.Duration
+	for k := 1; k < s.samples; k++ {
+		at := time.Duration(k) * slot
+		if j := slot / 2; j > 0 {
+			at += rand.N(j+1) - slot/4
+		}
+		s.waits = append(s.waits, at-prev)
+		prev = at
+	}
+	s.waits = append(s.waits, s.interval-prev)
+}
+
+// observed counts a process inspected for the first time.
+func (s *scanScheduler) observed() {
+	s.seen++
+	processesSeen.Inc()
+}
+
+// scanned takes the PID counter and the number of extra threads after a
+// full scan, estimates how many processes were missed since the previous
+// one and adapts the interval. The estimate is an upper bound: PIDs taken
+// by threads that came and went between scans count as missed too.
+func (s *scanScheduler) scanned(lastPID, threads int) (missed int) {
+	if s.lastPID >= 0 && lastPID >= s.lastPID {
+		missed = lastPID - s.lastPID - s.seen - max(threads-s.threads, 0)
+		missed = max(missed, 0)
+		processesMissed.Add(float64(missed))
+	}
+	// A negative delta is the counter wrapping at pid_max; start over.
+	s.lastPID, s.threads = lastPID, threads
+
+	switch {
+	case s.seen+missed >= scanChurnThreshold:
+		s.interval = max(s.interval/2, s.min)
+	case s.seen+missed == 0:
+		s.interval = min(time.Duration(float64(s.interval)*scanRelaxFactor), s.max)
+	}
+	s.seen = 0
+	scanInterval.Set(s.interval.Seconds())
+	return missed
+}
+
+// fullScan scans /proc and lets the scheduler adapt to what it found.
+func (pm *ProcessMonitor) fullScan(ctx context.Context) {
+	procScans.WithLabelValues("full").Inc()
+	pm.scanProcesses(ctx)
+
+	threads := 0
+	pm.mu.RLock()
+	for _, proc := range pm.knownProcs {
+		threads += max(proc.threads-1, 0)
+	}
+	pm.mu.RUnlock()
+
+	if missed := pm.sched.scanned(readLastPID(), threads); missed > 0 {
+		pm.log.WithField("missed", missed).Debug("Processes likely exited between scans unseen")
+	}
+}
+
+// sampleProcesses inspects the processes started since /proc was last
+// read, skipping the checks a full scan makes of the known ones.
+func (pm *ProcessMonitor) sampleProcesses(ctx context.Context) {
+	procScans.WithLabelValues("sample").Inc()
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		pm.log.WithError(err).Error("Failed to read /proc")
+		return
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		pm.mu.RLock()
+		_, exists := pm.knownProcs[pid]
+		pm.mu.RUnlock()
+		if !exists {
+			pm.inspectNewProcess(ctx, pid)
+		}
+	}
+}
+
+// readLastPID returns the last PID allocated in the agent's PID namespace,
+// the fifth field of /proc/loadavg, or -1 if it cannot be read.
+func readLastPID() int {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return -1
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 5 {
+		return -1
+	}
+	pid, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return -1
+	}
+	return pid
+}
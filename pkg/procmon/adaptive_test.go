@@ -0,0 +1,88 @@
+package procmon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanScheduler_plan(t *testing.T) {
+	s := newScanScheduler(Config{ScanInterval: 4 * time.Second, MinScanInterval: time.Second, ScanSamples: 4})
+	var total time.Duration
+	for i := 0; i < 4; i++ {
+		wait, full := s.next()
+		if wait <= 0 {
+			t.Fatalf("wakeup %d after %v", i, wait)
+		}
+		if full != (i == 3) {
+			t.Errorf("wakeup %d full = %v", i, full)
+		}
+		total += wait
+	}
+	if total != 4*time.Second {
+		t.Errorf("interval took %v, want 4s", total)
+	}
+
+	s.fixed()
+	if wait, full := s.next(); wait != 4*time.Second || !full {
+		t.Errorf("fixed wakeup = %v, full %v", wait, full)
+	}
+}
+
+func TestScanScheduler_scanned(t *testing.T) {
+	s := newScanScheduler(Config{ScanInterval: 4 * time.Second, MinScanInterval: time.Second})
+	s.scanned(100, 2)
+
+	// 10 PIDs allocated: 3 processes seen, 2 new threads, 5 missed.
+	for i := 0; i < 3; i++ {
+		s.observed()
+	}
+	if missed := s.scanned(110, 4); missed != 5 {
+		t.Errorf("missed = %d, want 5", missed)
+	}
+	if s.interval != 2*time.Second {
+		t.Errorf("interval = %v after churn, want 2s", s.interval)
+	}
+	s.observed()
+	s.observed()
+	s.scanned(112, 4)
+	s.observed()
+	s.observed()
+	s.scanned(114, 4)
+	if s.interval != time.Second {
+		t.Errorf("interval = %v, want the 1s minimum", s.interval)
+	}
+
+	// Quiet intervals relax back to ScanInterval; a wrapped counter
+	// estimates nothing.
+	for _, pid := range []int{114, 114, 114, 5, 5} {
+		if missed := s.scanned(pid, 4); missed != 0 {
+			t.Errorf("missed %d at PID %d", missed, pid)
+		}
+	}
+	if s.interval != 4*time.Second {
+		t.Errorf("interval = %v after quiet scans, want 4s", s.interval)
+	}
+
+	if s := newScanScheduler(Config{ScanInterval: 4 * time.Second}); s.min != 4*time.Second {
+		t.Errorf("min = %v without MinScanInterval, want ScanInterval", s.min)
+	}
+}
+
+func TestScanScheduler_slowdown(t *testing.T) {
+	s := newScanScheduler(Config{ScanInterval: 4 * time.Second, MinScanInterval: time.Second})
+	s.interval = 2 * time.Second
+	s.next()
+
+	s.slowdown(4)
+	if s.min != 4*time.Second || s.max != 16*time.Second || s.interval != 8*time.Second {
+		t.Errorf("slowed down: min %v, max %v, interval %v", s.min, s.max, s.interval)
+	}
+	if wait, full := s.next(); wait != 8*time.Second || !full {
+		t.Errorf("slowed down wakeup = %v, full %v", wait, full)
+	}
+
+	s.slowdown(1)
+	if s.min != time.Second || s.max != 4*time.Second || s.interval != 2*time.Second {
+		t.Errorf("restored: min %v, max %v, interval %v", s.min, s.max, s.interval)
+	}
+}
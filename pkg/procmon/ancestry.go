@@ -0,0 +1,43 @@
+package procmon
+
+import (
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// maxAncestors bounds the lineage recorded per process, which also stops the
+// walk on a PPID cycle from a reused PID.
+const maxAncestors = 16
+
+// ancestors returns proc's lineage, parent first. A parent the monitor
+// already knows contributes the lineage resolved when it started, so the
+// chain survives grandparents that have since exited. Other parents are read
+// from /proc until one is missing or PID 0 is reached.
+func (pm *ProcessMonitor) ancestors(proc *ProcessInfo) []collector.ProcessAncestor {
+	var out []collector.ProcessAncestor
+	ppid := proc.PPID
+	for ppid > 0 && ppid != proc.PID && len(out) < maxAncestors {
+		pm.mu.RLock()
+		parent, known := pm.knownProcs[ppid]
+		pm.mu.RUnlock()
+		if !known {
+			var err error
+			if parent, err = pm.getProcessInfo(ppid); err != nil {
+				break
+			}
+		}
+		out = append(out, ancestorOf(parent))
+		if known {
+			rest := parent.Ancestors
+			if n := maxAncestors - len(out); len(rest) > n {
+				rest = rest[:n]
+			}
+			return append(out, rest...)
+		}
+		ppid = parent.PPID
+	}
+	return out
+}
+
+func ancestorOf(p *ProcessInfo) collector.ProcessAncestor {
+	return collector.ProcessAncestor{PID: p.PID, Name: p.Name, ExePath: p.Exe, Cmdline: p.Cmdline}
+}
@@ -0,0 +1,48 @@
+package procmon
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func TestProcessMonitor_ancestors(t *testing.T) {
+	pm := New(Config{ScanInterval: time.Second, EventChan: make(chan collector.SecurityEvent, 1)}, logrus.New())
+	// nginx's own parent has exited; its lineage was recorded when it started.
+	pm.knownProcs[10] = &ProcessInfo{
+		PID: 10, PPID: 1, Name: "nginx", Cmdline: []string{"nginx: worker process"},
+		Ancestors: []collector.ProcessAncestor{{PID: 1, Name: "tini"}},
+	}
+	pm.knownProcs[20] = &ProcessInfo{PID: 20, PPID: 10, Name: "sh"}
+	pm.knownProcs[20].Ancestors = pm.ancestors(pm.knownProcs[20])
+
+	got := pm.ancestors(&ProcessInfo{PID: 30, PPID: 20, Name: "curl"})
+	if len(got) != 3 || got[0].Name != "sh" || got[1].Name != "nginx" || got[2].Name != "tini" {
+		t.Errorf("ancestors = %+v, want sh, nginx, tini", got)
+	}
+	if got[1].Cmdline[0] != "nginx: worker process" {
+		t.Errorf("nginx cmdline = %v", got[1].Cmdline)
+	}
+
+	if got := pm.ancestors(&ProcessInfo{PID: 5, PPID: 0}); len(got) != 0 {
+		t.Errorf("ancestors of a PPID 0 process = %+v, want none", got)
+	}
+}
+
+func TestProcessMonitor_ancestorsFromProc(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	pm := New(Config{ScanInterval: time.Second, EventChan: make(chan collector.SecurityEvent, 1)}, logrus.New())
+	got := pm.ancestors(&ProcessInfo{PID: -1, PPID: os.Getpid()})
+	if len(got) == 0 || got[0].PID != os.Getpid() || got[0].Name == "" {
+		t.Fatalf("ancestors = %+v, want the test process first", got)
+	}
+	if len(got) > 1 && got[1].PID != os.Getppid() {
+		t.Errorf("second ancestor PID = %d, want %d", got[1].PID, os.Getppid())
+	}
+}
@@ -0,0 +1,109 @@
+package procmon
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
+)
+
+// IndicatorCredentialAccess marks a process that names a Kubernetes or cloud
+// credential file on its command line, and the file access event of a
+// process found holding one open.
+const IndicatorCredentialAccess = fileintegrity.IndicatorCredentialAccess
+
+// MetadataCredentialPaths lists, comma separated, the credential paths a
+// process names on its command line.
+const MetadataCredentialPaths = "credential_paths"
+
+// credentialArgs returns the credential paths named in cmdline, such as the
+// token file in sh -c 'curl -H "Authorization: Bearer $(cat /var/run/...)"'.
+// Home directory paths are matched as root's.
+func (pm *ProcessMonitor) credentialArgs(cmdline []string) []string {
+	if pm.credentials == nil {
+		return nil
+	}
+	var found []string
+	seen := make(map[string]bool)
+	for _, arg := range cmdline {
+		arg = strings.NewReplacer("${HOME}/", "~/", "$HOME/", "~/").Replace(arg)
+		for _, tok := range strings.FieldsFunc(arg, isArgSeparator) {
+			if rest, ok := strings.CutPrefix(tok, "~/"); ok {
+				tok = "/root/" + rest
+			}
+			if !strings.HasPrefix(tok, "/") {
+				continue
+			}
+			p := path.Clean(tok)
+			if !seen[p] && pm.credentials.Match(p) {
+				seen[p] = true
+				found = append(found, p)
+			}
+		}
+	}
+	return found
+}
+
+// isArgSeparator splits a command line argument into the words a shell
+// command or option value is made of.
+func isArgSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("=\"'`$(){};|&<>,:", r)
+}
+
+// checkCredentialFDs reports each credential file proc has open, once per
+// process. Reads are only seen while the file is open during a scan; the
+// command line check catches short-lived readers such as cat.
+func (pm *ProcessMonitor) checkCredentialFDs(ctx context.Context, proc *ProcessInfo, procPath string) {
+	if pm.credentials == nil || proc.allowlisted || proc.PID == os.Getpid() {
+		return
+	}
+	fdDir := filepath.Join(procPath, "fd")
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		target, err := os.Readlink(filepath.Join(fdDir, e.Name()))
+		if err != nil || !strings.HasPrefix(target, "/") || proc.credentialFiles[target] || !pm.credentials.Match(target) {
+			continue
+		}
+		if proc.credentialFiles == nil {
+			proc.credentialFiles = make(map[string]bool)
+		}
+		proc.credentialFiles[target] = true
+
+		pm.log.WithFields(logrus.Fields{
+			"pid": proc.PID, "name": proc.Name, "path": target,
+		}).Warn("Process has a credential file open")
+
+		event := collector.SecurityEvent{
+			Type:      collector.EventTypeFileAccess,
+			Severity:  collector.SeverityHigh,
+			Timestamp: time.Now(),
+			File: &collector.FileEvent{
+				Path:        target,
+				Operation:   "open",
+				PID:         proc.PID,
+				ProcessName: proc.Name,
+				Indicators:  []string{IndicatorCredentialAccess},
+			},
+			Metadata: map[string]string{
+				"cmdline_hash": proc.CmdlineHash,
+			},
+		}
+		select {
+		case pm.cfg.EventChan <- event:
+		case <-ctx.Done():
+		default:
+			pm.log.Warn("Event channel full, dropping credential access event")
+		}
+	}
+}
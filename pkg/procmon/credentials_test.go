@@ -0,0 +1,87 @@
+package procmon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+var testCredentialPaths = []string{"/var/run/secrets/kubernetes.io/serviceaccount", "~/.aws"}
+
+func TestCredentialArgs(t *testing.T) {
+	pm := New(Config{CredentialPaths: testCredentialPaths}, logrus.New())
+	tests := []struct {
+		name    string
+		cmdline []string
+		want    []string
+	}{
+		{"cat token", []string{"cat", "/var/run/secrets/kubernetes.io/serviceaccount/token"}, []string{"/var/run/secrets/kubernetes.io/serviceaccount/token"}},
+		{"bearer in shell", []string{"sh", "-c", `curl -H "Authorization: Bearer $(cat /var/run/secrets/kubernetes.io/serviceaccount/token)" https://kubernetes.default`},
+			[]string{"/var/run/secrets/kubernetes.io/serviceaccount/token"}},
+		{"home", []string{"sh", "-c", "cat ~/.aws/credentials; cp $HOME/.aws/config /tmp/c"}, []string{"/root/.aws/credentials", "/root/.aws/config"}},
+		{"option value", []string{"aws", "--shared-credentials-file=/home/app/.aws/credentials"}, []string{"/home/app/.aws/credentials"}},
+		{"directory", []string{"ls", "/var/run/secrets/kubernetes.io/serviceaccount/"}, []string{"/var/run/secrets/kubernetes.io/serviceaccount"}},
+		{"other paths", []string{"cat", "/etc/hostname", "/var/run/secrets/other"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pm.credentialArgs(tt.cmdline); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("credentialArgs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := New(Config{}, logrus.New()).credentialArgs([]string{"cat", "/root/.aws/credentials"}); got != nil {
+		t.Errorf("without credential paths = %v", got)
+	}
+}
+
+func TestCheckCredentialFDs(t *testing.T) {
+	events := make(chan collector.SecurityEvent, 4)
+	pm := New(Config{CredentialPaths: testCredentialPaths, EventChan: events}, logrus.New())
+	proc := &ProcessInfo{PID: 42, Name: "python3", CmdlineHash: "c1"}
+
+	dir := t.TempDir()
+	fds := map[string]string{
+		"0": "/dev/null",
+		"3": "/home/app/.aws/credentials",
+		"4": "socket:[1234]",
+		"5": "/var/run/secrets/kubernetes.io/serviceaccount/..2026_10_16_08_00_00.123/token",
+	}
+	os.Mkdir(filepath.Join(dir, "fd"), 0o755)
+	for fd, target := range fds {
+		if err := os.Symlink(target, filepath.Join(dir, "fd", fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pm.checkCredentialFDs(context.Background(), proc, dir)
+	pm.checkCredentialFDs(context.Background(), proc, dir)
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want one per credential file", len(events))
+	}
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		ev := <-events
+		f := ev.File
+		if ev.Type != collector.EventTypeFileAccess || f.Operation != "open" || f.PID != 42 || f.ProcessName != "python3" ||
+			!reflect.DeepEqual(f.Indicators, []string{IndicatorCredentialAccess}) {
+			t.Errorf("event = %+v, file = %+v", ev, f)
+		}
+		got[f.Path] = true
+	}
+	if !got["/home/app/.aws/credentials"] || !got[fds["5"]] {
+		t.Errorf("paths = %v", got)
+	}
+
+	pm.checkCredentialFDs(context.Background(), &ProcessInfo{PID: 43, allowlisted: true}, dir)
+	if len(events) != 0 {
+		t.Error("allowlisted process reported")
+	}
+}
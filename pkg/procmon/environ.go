@@ -0,0 +1,148 @@
+package procmon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Process environment indicators.
+const (
+	IndicatorLDPreload         = "ld_preload"
+	IndicatorLibraryPathHijack = "ld_library_path_hijack"
+	IndicatorHistoryDisabled   = "history_disabled"
+	IndicatorEnvCredentials    = "credentials_in_env"
+)
+
+// maxEnvironBytes bounds how much of /proc/<pid>/environ is read.
+const maxEnvironBytes = 128 << 10
+
+// systemLibDirs hold the libraries a legitimate LD_PRELOAD, such as
+// jemalloc, normally points at.
+var systemLibDirs = []string{"/lib/", "/lib64/", "/usr/lib/", "/usr/lib64/", "/usr/local/lib/"}
+
+// writableDirs are world-writable, so a library search path into them lets
+// any user plant a library.
+var writableDirs = []string{"/tmp/", "/var/tmp/", "/dev/shm/"}
+
+// credentialPatterns match values that are credentials whatever the name of
+// the variable holding them.
+var credentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(AKIA|ASIA)[0-9A-Z]{16}$`),                      // AWS access key ID
+	regexp.MustCompile(`^gh[pousr]_[A-Za-z0-9]{36,}$`),                   // GitHub token
+	regexp.MustCompile(`^glpat-[A-Za-z0-9_-]{20,}$`),                     // GitLab token
+	regexp.MustCompile(`^xox[abposr]-[A-Za-z0-9-]{10,}$`),                // Slack token
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),             // PEM private key
+	regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`), // URL with a password
+}
+
+// scanEnviron reads the environment of the process at procPath (e.g.
+// /proc/42) and returns its indicators and the variables behind them.
+func scanEnviron(procPath string, redactCredentials bool) ([]string, map[string]string) {
+	f, err := os.Open(filepath.Join(procPath, "environ"))
+	if err != nil {
+		return nil, nil
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxEnvironBytes))
+	if err != nil {
+		return nil, nil
+	}
+	return analyzeEnviron(data, redactCredentials)
+}
+
+// analyzeEnviron checks NUL-separated NAME=value pairs. Only flagged
+// variables are returned; with redactCredentials, credential values are
+// replaced by their SHA-256 so they can be matched but not read.
+func analyzeEnviron(environ []byte, redactCredentials bool) ([]string, map[string]string) {
+	var indicators []string
+	var vars map[string]string
+	flag := func(indicator, name, value string) {
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		vars[name] = value
+		for _, ind := range indicators {
+			if ind == indicator {
+				return
+			}
+		}
+		indicators = append(indicators, indicator)
+	}
+
+	for _, kv := range bytes.Split(environ, []byte{0}) {
+		name, value, ok := strings.Cut(string(kv), "=")
+		if !ok || name == "" {
+			continue
+		}
+		switch name {
+		case "LD_PRELOAD":
+			if suspiciousPreload(value) {
+				flag(IndicatorLDPreload, name, value)
+			}
+			continue
+		case "LD_LIBRARY_PATH":
+			if hijackableLibraryPath(value) {
+				flag(IndicatorLibraryPathHijack, name, value)
+			}
+			continue
+		case "HISTFILE":
+			if value == "" || value == "/dev/null" {
+				flag(IndicatorHistoryDisabled, name, value)
+			}
+			continue
+		case "HISTSIZE", "HISTFILESIZE":
+			if value == "0" {
+				flag(IndicatorHistoryDisabled, name, value)
+			}
+			continue
+		}
+		for _, re := range credentialPatterns {
+			if re.MatchString(value) {
+				if redactCredentials {
+					sum := sha256.Sum256([]byte(value))
+					value = "sha256:" + hex.EncodeToString(sum[:])
+				}
+				flag(IndicatorEnvCredentials, name, value)
+				break
+			}
+		}
+	}
+	return indicators, vars
+}
+
+// suspiciousPreload reports whether LD_PRELOAD (space- or colon-separated)
+// loads anything outside the system library directories.
+func suspiciousPreload(value string) bool {
+	for _, lib := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ':' }) {
+		if !hasAnyPrefix(filepath.Clean(lib), systemLibDirs) {
+			return true
+		}
+	}
+	return false
+}
+
+// hijackableLibraryPath reports whether LD_LIBRARY_PATH searches the
+// working directory (an empty or relative entry) or a world-writable one.
+func hijackableLibraryPath(value string) bool {
+	for _, dir := range strings.Split(value, ":") {
+		if !filepath.IsAbs(dir) || hasAnyPrefix(filepath.Clean(dir)+"/", writableDirs) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
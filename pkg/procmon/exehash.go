@@ -0,0 +1,82 @@
+package procmon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+const (
+	// maxExeHashBytes skips hashing executables larger than this.
+	maxExeHashBytes = 64 << 20
+	// maxExeHashCache bounds the number of cached hashes; the cache is
+	// cleared when it fills.
+	maxExeHashCache = 1024
+)
+
+// exeKey identifies an executable's content well enough to reuse its hash:
+// the same inode, size and mtime.
+type exeKey struct {
+	dev, ino uint64
+	size     int64
+	mtime    int64
+}
+
+// exeHasher hashes process executables through /proc/<pid>/exe, which works
+// even if the file was deleted after the process started.
+type exeHasher struct {
+	mu    sync.Mutex
+	cache map[exeKey]string
+}
+
+func newExeHasher() *exeHasher {
+	return &exeHasher{cache: make(map[exeKey]string)}
+}
+
+// hash returns the hex SHA-256 of the executable of the process at procPath
+// (e.g. /proc/42), or "" if it cannot be read or is too large.
+func (h *exeHasher) hash(procPath string) string {
+	f, err := os.Open(filepath.Join(procPath, "exe"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() > maxExeHashBytes {
+		return ""
+	}
+	key := fileKey(fi)
+
+	h.mu.Lock()
+	sum, ok := h.cache[key]
+	h.mu.Unlock()
+	if ok {
+		return sum
+	}
+
+	d := sha256.New()
+	if _, err := io.Copy(d, io.LimitReader(f, maxExeHashBytes)); err != nil {
+		return ""
+	}
+	sum = hex.EncodeToString(d.Sum(nil))
+
+	h.mu.Lock()
+	if len(h.cache) >= maxExeHashCache {
+		h.cache = make(map[exeKey]string)
+	}
+	h.cache[key] = sum
+	h.mu.Unlock()
+	return sum
+}
+
+func fileKey(fi os.FileInfo) exeKey {
+	key := exeKey{size: fi.Size(), mtime: fi.ModTime().UnixNano()}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		key.dev, key.ino = uint64(st.Dev), st.Ino
+	}
+	return key
+}
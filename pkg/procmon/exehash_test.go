@@ -0,0 +1,37 @@
+package procmon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExeHasher(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	content := []byte("\x7fELF not really")
+	if err := os.WriteFile(bin, content, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	procPath := filepath.Join(dir, "42")
+	if err := os.Mkdir(procPath, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(bin, filepath.Join(procPath, "exe")); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newExeHasher()
+	sum := sha256.Sum256(content)
+	if got, want := h.hash(procPath), hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("hash = %q, want %q", got, want)
+	}
+	if len(h.cache) != 1 {
+		t.Errorf("cache entries = %d, want 1", len(h.cache))
+	}
+	if got := h.hash(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("hash of missing process = %q, want empty", got)
+	}
+}
@@ -0,0 +1,106 @@
+package procmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// AnomalyFDExhaustion is the ResourceEvent.AnomalyType for a process close to
+// its open file descriptor limit.
+const AnomalyFDExhaustion = "fd_exhaustion"
+
+// checkFDs raises an fd_exhaustion anomaly the first time proc's open file
+// descriptors reach cfg.FDUsagePercent of its soft limit, and re-arms once
+// usage drops back below it. Processes the agent may not inspect are skipped.
+func (pm *ProcessMonitor) checkFDs(ctx context.Context, proc *ProcessInfo, procPath string) {
+	if pm.cfg.FDUsagePercent <= 0 {
+		return
+	}
+	limit, err := fdSoftLimit(procPath)
+	if err != nil || limit <= 0 {
+		return
+	}
+	open, err := countFDs(procPath)
+	if err != nil {
+		return
+	}
+	over := open*100 >= limit*pm.cfg.FDUsagePercent
+	if !over || proc.fdAlerted {
+		proc.fdAlerted = over
+		return
+	}
+	proc.fdAlerted = true
+
+	pm.log.WithFields(logrus.Fields{
+		"pid": proc.PID, "name": proc.Name, "open_fds": open, "limit": limit,
+	}).Warn("Process near its file descriptor limit")
+
+	event := collector.SecurityEvent{
+		Type:      collector.EventTypeResourceAnomaly,
+		Severity:  collector.SeverityMedium,
+		Timestamp: time.Now(),
+		Resource: &collector.ResourceEvent{
+			AnomalyType:  AnomalyFDExhaustion,
+			AnomalyScore: float64(open) / float64(limit),
+			PID:          proc.PID,
+			ProcessName:  proc.Name,
+			OpenFDs:      open,
+			FDLimit:      limit,
+		},
+		Metadata: map[string]string{
+			"cmdline_hash": proc.CmdlineHash,
+		},
+	}
+	select {
+	case pm.cfg.EventChan <- event:
+	case <-ctx.Done():
+	default:
+		pm.log.Warn("Event channel full, dropping fd exhaustion event")
+	}
+}
+
+// countFDs returns the number of open file descriptors in procPath/fd.
+func countFDs(procPath string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(procPath, "fd"))
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// fdSoftLimit returns the soft "Max open files" limit from procPath/limits.
+// An unlimited limit is reported as 0.
+func fdSoftLimit(procPath string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(procPath, "limits"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 {
+			break
+		}
+		if fields[0] == "unlimited" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return 0, fmt.Errorf("parse open files limit %q: %w", fields[0], err)
+		}
+		return n, nil
+	}
+	return 0, errors.New("no open files limit")
+}
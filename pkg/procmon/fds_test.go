@@ -0,0 +1,78 @@
+package procmon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+const limitsFile = `Limit                     Soft Limit           Hard Limit           Units
+Max cpu time              unlimited            unlimited            seconds
+Max open files            10                   4096                 files
+`
+
+func fakeProc(t *testing.T, fds int) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < fds; i++ {
+		if err := os.WriteFile(filepath.Join(dir, "fd", strconv.Itoa(i)), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "limits"), []byte(limitsFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFDSoftLimit(t *testing.T) {
+	dir := fakeProc(t, 0)
+	if n, err := fdSoftLimit(dir); err != nil || n != 10 {
+		t.Errorf("fdSoftLimit = %d, %v", n, err)
+	}
+	unlimited := "Max open files            unlimited            unlimited            files\n"
+	if err := os.WriteFile(filepath.Join(dir, "limits"), []byte(unlimited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := fdSoftLimit(dir); err != nil || n != 0 {
+		t.Errorf("unlimited fdSoftLimit = %d, %v", n, err)
+	}
+}
+
+func TestCheckFDs_AlertsOncePerCrossing(t *testing.T) {
+	events := make(chan collector.SecurityEvent, 4)
+	pm := New(Config{FDUsagePercent: 80, EventChan: events}, logrus.New())
+	proc := &ProcessInfo{PID: 7, Name: "leaky"}
+
+	pm.checkFDs(context.Background(), proc, fakeProc(t, 5))
+	if len(events) != 0 {
+		t.Fatal("50% usage should not alert")
+	}
+
+	busy := fakeProc(t, 9)
+	pm.checkFDs(context.Background(), proc, busy)
+	pm.checkFDs(context.Background(), proc, busy)
+	if len(events) != 1 {
+		t.Fatalf("events = %d, want 1 while over the threshold", len(events))
+	}
+	ev := <-events
+	r := ev.Resource
+	if ev.Type != collector.EventTypeResourceAnomaly || r.AnomalyType != AnomalyFDExhaustion || r.OpenFDs != 9 || r.FDLimit != 10 || r.PID != 7 {
+		t.Errorf("event = %+v, resource = %+v", ev, r)
+	}
+
+	pm.checkFDs(context.Background(), proc, fakeProc(t, 2))
+	pm.checkFDs(context.Background(), proc, busy)
+	if len(events) != 1 {
+		t.Errorf("expected a new alert after usage dropped and rose again, got %d", len(events))
+	}
+}
@@ -0,0 +1,83 @@
+package procmon
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IndicatorFilelessExecution marks a process running code that has no file
+// on disk behind it.
+const IndicatorFilelessExecution = "fileless_execution"
+
+// Fileless execution reasons, reported in the event's fileless_reason
+// metadata.
+const (
+	FilelessMemfd       = "memfd"
+	FilelessDevShm      = "dev_shm"
+	FilelessDeleted     = "deleted_binary"
+	FilelessMemfdMap    = "memfd_mapping"
+	FilelessAnonExecMap = "anonymous_exec_mapping"
+)
+
+// jitRuntimes generate code into anonymous executable memory as a matter of
+// course, so their mappings are not checked.
+var jitRuntimes = map[string]bool{
+	"java": true, "node": true, "nodejs": true, "deno": true, "bun": true,
+	"dotnet": true, "mono": true, "pwsh": true, "luajit": true,
+	"pypy": true, "pypy3": true, "chrome": true, "chromium": true,
+}
+
+// filelessReason reports why the process at procPath (e.g. /proc/42) with
+// executable exe looks fileless, or "" if it does not. The executable is
+// checked first; the memory maps only for processes that are not JIT
+// runtimes.
+func filelessReason(procPath, exe, name string) string {
+	if reason := filelessExeReason(exe); reason != "" {
+		return reason
+	}
+	if jitRuntimes[name] || strings.HasPrefix(name, "php") {
+		return ""
+	}
+	return execMappingReason(filepath.Join(procPath, "maps"))
+}
+
+// filelessExeReason classifies the target of /proc/<pid>/exe.
+func filelessExeReason(exe string) string {
+	switch {
+	case strings.HasPrefix(exe, "/memfd:"):
+		return FilelessMemfd
+	case strings.HasPrefix(exe, "/dev/shm/"):
+		return FilelessDevShm
+	case strings.HasSuffix(exe, " (deleted)"):
+		return FilelessDeleted
+	}
+	return ""
+}
+
+// execMappingReason scans a maps file for executable regions backed by a
+// memfd or by nothing at all. Pseudo-mappings such as [vdso] are named and
+// do not count.
+func execMappingReason(mapsPath string) string {
+	f, err := os.Open(mapsPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address perms offset dev inode [pathname]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || len(fields[1]) < 3 || fields[1][2] != 'x' {
+			continue
+		}
+		if len(fields) == 5 {
+			return FilelessAnonExecMap
+		}
+		if strings.HasPrefix(fields[5], "/memfd:") {
+			return FilelessMemfdMap
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package procmon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func TestFilelessReason(t *testing.T) {
+	procPath := t.TempDir()
+	writeMaps := func(maps string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(procPath, "maps"), []byte(maps), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const libc = "7f0000000000-7f0000020000 r-xp 00000000 08:01 1234 /usr/lib/libc.so.6\n" +
+		"7ffd00000000-7ffd00002000 r-xp 00000000 00:00 0 [vdso]\n"
+	writeMaps(libc)
+
+	tests := []struct {
+		exe, name, want string
+	}{
+		{"/memfd:payload (deleted)", "payload", FilelessMemfd},
+		{"/dev/shm/.x", "x", FilelessDevShm},
+		{"/tmp/implant (deleted)", "implant", FilelessDeleted},
+		{"/usr/sbin/nginx", "nginx", ""},
+	}
+	for _, tt := range tests {
+		if got := filelessReason(procPath, tt.exe, tt.name); got != tt.want {
+			t.Errorf("filelessReason(%q) = %q, want %q", tt.exe, got, tt.want)
+		}
+	}
+
+	writeMaps(libc + "7f1000000000-7f1000001000 rwxp 00000000 00:00 0 \n")
+	if got := filelessReason(procPath, "/usr/bin/python3", "python3"); got != FilelessAnonExecMap {
+		t.Errorf("anonymous rwx mapping: reason = %q", got)
+	}
+	if got := filelessReason(procPath, "/usr/bin/java", "java"); got != "" {
+		t.Errorf("JIT runtime flagged for %q", got)
+	}
+	writeMaps(libc + "7f2000000000-7f2000001000 r-xp 00000000 00:01 99 /memfd:lib (deleted)\n")
+	if got := filelessReason(procPath, "/usr/bin/python3", "python3"); got != FilelessMemfdMap {
+		t.Errorf("memfd mapping: reason = %q", got)
+	}
+}
+
+func TestFilelessReason_DeletedBinary(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("no sleep binary")
+	}
+	if _, err := os.Stat("/proc/self/exe"); err != nil {
+		t.Skip("no /proc")
+	}
+	data, err := os.ReadFile(sleep)
+	if err != nil {
+		t.Skip(err)
+	}
+	bin := filepath.Join(t.TempDir(), "sleep")
+	if err := os.WriteFile(bin, data, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bin, "5")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer cmd.Process.Kill()
+	os.Remove(bin)
+
+	procPath := fmt.Sprintf("/proc/%d", cmd.Process.Pid)
+	exe, _ := os.Readlink(filepath.Join(procPath, "exe"))
+	if got := filelessReason(procPath, exe, "sleep"); got != FilelessDeleted {
+		t.Errorf("reason for %q = %q, want %s", exe, got, FilelessDeleted)
+	}
+}
+
+func TestAnalyzeNewProcess_Fileless(t *testing.T) {
+	events := make(chan collector.SecurityEvent, 1)
+	pm := New(Config{ScanInterval: time.Second, EventChan: events}, logrus.New())
+	pm.analyzeNewProcess(context.Background(), &ProcessInfo{PID: 7, Name: "3", Exe: "/memfd:3 (deleted)", fileless: FilelessMemfd})
+	ev := <-events
+	if ev.Severity != collector.SeverityHigh || ev.Metadata["fileless_reason"] != FilelessMemfd {
+		t.Errorf("event severity=%v metadata=%v", ev.Severity, ev.Metadata)
+	}
+	if got := ev.Process.SuspiciousIndicators; len(got) != 1 || got[0] != IndicatorFilelessExecution {
+		t.Errorf("indicators = %v", got)
+	}
+}
@@ -0,0 +1,54 @@
+package procmon
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// IndicatorDenylistedHash marks a process whose executable hash is on the
+// denylist.
+const IndicatorDenylistedHash = "denylisted_hash"
+
+// exeHashLists are the executable hashes that raise a CRITICAL event (deny)
+// or suppress process events (allow). A hash on both lists is denied.
+type exeHashLists struct {
+	allow, deny map[string]bool
+}
+
+// SetExeHashLists replaces the executable hash allowlist and denylist.
+// Entries that are not hex SHA-256 digests are skipped with a warning.
+func (pm *ProcessMonitor) SetExeHashLists(allow, deny []string) {
+	lists := exeHashLists{allow: hashSet(allow, pm.log), deny: hashSet(deny, pm.log)}
+	pm.hashListsMu.Lock()
+	pm.hashLists = lists
+	pm.hashListsMu.Unlock()
+}
+
+// classifyExeHash reports whether hash is denylisted or allowlisted. An
+// unreadable executable ("") is neither.
+func (pm *ProcessMonitor) classifyExeHash(hash string) (denied, allowed bool) {
+	if hash == "" {
+		return false, false
+	}
+	pm.hashListsMu.RLock()
+	defer pm.hashListsMu.RUnlock()
+	if pm.hashLists.deny[hash] {
+		return true, false
+	}
+	return false, pm.hashLists.allow[hash]
+}
+
+func hashSet(hashes []string, log *logrus.Logger) map[string]bool {
+	set := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if b, err := hex.DecodeString(h); err != nil || len(b) != 32 {
+			log.WithField("hash", h).Warn("Invalid executable hash, want a hex SHA-256")
+			continue
+		}
+		set[h] = true
+	}
+	return set
+}
@@ -0,0 +1,53 @@
+package procmon
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+const (
+	goodHash = "1111111111111111111111111111111111111111111111111111111111111111"
+	badHash  = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func TestProcessMonitor_exeHashLists(t *testing.T) {
+	events := make(chan collector.SecurityEvent, 4)
+	pm := New(Config{
+		ScanInterval:     time.Second,
+		EventChan:        events,
+		ExeHashAllowlist: []string{strings.ToUpper(goodHash), "not-a-hash"},
+		ExeHashDenylist:  []string{badHash},
+	}, logrus.New())
+	if len(pm.hashLists.allow) != 1 {
+		t.Errorf("allowlist = %v, want the one valid entry", pm.hashLists.allow)
+	}
+
+	allowed := &ProcessInfo{PID: 10, Name: "nginx", ExeHash: goodHash}
+	pm.analyzeNewProcess(context.Background(), allowed)
+	pm.emitProcessExit(context.Background(), allowed)
+	if len(events) != 0 {
+		t.Fatalf("allowlisted process emitted %d events", len(events))
+	}
+
+	pm.analyzeNewProcess(context.Background(), &ProcessInfo{PID: 11, Name: "kworker", ExeHash: badHash})
+	ev := <-events
+	if ev.Severity != collector.SeverityCritical {
+		t.Errorf("denylisted severity = %v, want CRITICAL", ev.Severity)
+	}
+	if got := ev.Process.SuspiciousIndicators; len(got) != 1 || got[0] != IndicatorDenylistedHash {
+		t.Errorf("indicators = %v", got)
+	}
+
+	// A hash on both lists is denied.
+	pm.SetExeHashLists([]string{badHash}, []string{badHash})
+	pm.analyzeNewProcess(context.Background(), &ProcessInfo{PID: 12, Name: "kworker", ExeHash: badHash})
+	if len(events) != 1 {
+		t.Errorf("hash on both lists emitted %d events, want 1", len(events))
+	}
+}
@@ -0,0 +1,180 @@
+package procmon
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// IndicatorExecProbe marks a process run by a Kubernetes exec probe.
+const IndicatorExecProbe = "exec_probe"
+
+// Exec probe policies: what happens to the events of processes probes run.
+// Events with HIGH or CRITICAL findings are always sent, marked exec_probe.
+const (
+	// ProbePolicyDownrank sends them as INFO without the shell_spawn
+	// indicator.
+	ProbePolicyDownrank = "downrank"
+	// ProbePolicyExempt sends none.
+	ProbePolicyExempt = "exempt"
+	// ProbePolicyOff handles probe processes like any other.
+	ProbePolicyOff = "off"
+)
+
+// MetadataExecProbe is the event metadata key holding why a process is
+// taken for a probe's: ProbeFromPodSpec or ProbePeriodic.
+const MetadataExecProbe = "exec_probe"
+
+// Why a process is taken for a probe's.
+const (
+	ProbeFromPodSpec = "pod_spec"
+	ProbePeriodic    = "periodic"
+)
+
+const (
+	// probeRuns is how many starts of one command exec'd into the pod are
+	// needed to tell whether it runs on a period.
+	probeRuns = 4
+	// Periods outside probeMinPeriod and probeMaxPeriod are not a probe's;
+	// the kubelet's shortest is a second.
+	probeMinPeriod = time.Second
+	probeMaxPeriod = 10 * time.Minute
+	// probeJitter is how far, as a fraction of the period, an interval may
+	// be from the mean and still be periodic.
+	probeJitter = 0.2
+	// maxProbeHistory bounds the commands whose starts are tracked.
+	maxProbeHistory = 256
+)
+
+// probeTracker recognizes processes run by exec probes. The kubelet execs
+// probe commands into the container, so they have no parent in the pod
+// (PPID 0). Such a process is a probe's if its command line is one of the
+// pod spec's probe commands, or if the same command line has been exec'd on
+// a steady period. The processes it starts are probe processes too.
+type probeTracker struct {
+	commands map[string]bool
+
+	mu      sync.Mutex
+	history map[string][]time.Time
+}
+
+func newProbeTracker(commands [][]string) *probeTracker {
+	t := &probeTracker{commands: make(map[string]bool), history: make(map[string][]time.Time)}
+	for _, cmd := range commands {
+		if len(cmd) > 0 {
+			t.commands[probeKey(cmd)] = true
+		}
+	}
+	return t
+}
+
+func probeKey(cmdline []string) string {
+	return strings.Join(cmdline, "\x00")
+}
+
+// classify returns why proc is taken for a probe's process, or "" if it is
+// not. Processes exec'd into the pod are recorded for the periodicity check;
+// others are classified by the root of their lineage.
+func (t *probeTracker) classify(proc *ProcessInfo) string {
+	if proc.PPID == 0 {
+		if proc.PID == 1 {
+			return ""
+		}
+		key := probeKey(proc.Cmdline)
+		steady := t.record(key, proc.StartTime)
+		switch {
+		case t.commands[key]:
+			return ProbeFromPodSpec
+		case steady:
+			return ProbePeriodic
+		}
+		return ""
+	}
+	if len(proc.Ancestors) == 0 {
+		return ""
+	}
+	root := proc.Ancestors[len(proc.Ancestors)-1]
+	if root.PID == 1 {
+		return ""
+	}
+	return t.rootReason(root)
+}
+
+// rootReason classifies an exec'd process from its recorded starts,
+// without recording one.
+func (t *probeTracker) rootReason(root collector.ProcessAncestor) string {
+	key := probeKey(root.Cmdline)
+	if t.commands[key] {
+		return ProbeFromPodSpec
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if periodic(t.history[key]) {
+		return ProbePeriodic
+	}
+	return ""
+}
+
+// record adds a start of command key and reports whether its latest starts
+// are periodic.
+func (t *probeTracker) record(key string, start time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	starts, ok := t.history[key]
+	if !ok && len(t.history) >= maxProbeHistory {
+		t.evictLocked()
+	}
+	if n := len(starts); n > 0 && !start.After(starts[n-1]) {
+		return periodic(starts)
+	}
+	starts = append(starts, start)
+	if len(starts) > probeRuns {
+		starts = starts[len(starts)-probeRuns:]
+	}
+	t.history[key] = starts
+	return periodic(starts)
+}
+
+// evictLocked forgets the command that started least recently.
+func (t *probeTracker) evictLocked() {
+	var oldest string
+	var at time.Time
+	for key, starts := range t.history {
+		if last := starts[len(starts)-1]; at.IsZero() || last.Before(at) {
+			oldest, at = key, last
+		}
+	}
+	delete(t.history, oldest)
+}
+
+// periodic reports whether starts are probeRuns starts at a steady interval
+// a probe could have.
+func periodic(starts []time.Time) bool {
+	if len(starts) < probeRuns {
+		return false
+	}
+	mean := starts[len(starts)-1].Sub(starts[0]) / time.Duration(len(starts)-1)
+	if mean < probeMinPeriod || mean > probeMaxPeriod {
+		return false
+	}
+	slack := time.Duration(float64(mean) * probeJitter)
+	for i := 1; i < len(starts); i++ {
+		if d := starts[i].Sub(starts[i-1]) - mean; d > slack || d < -slack {
+			return false
+		}
+	}
+	return true
+}
+
+// dropIndicator returns indicators without drop.
+func dropIndicator(indicators []string, drop string) []string {
+	out := indicators[:0]
+	for _, ind := range indicators {
+		if ind != drop {
+			out = append(out, ind)
+		}
+	}
+	return out
+}
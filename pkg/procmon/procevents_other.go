@@ -0,0 +1,18 @@
+//go:build !linux
+
+package procmon
+
+// procConnector is only implemented on Linux.
+type procConnector struct{}
+
+func openProcConnector() (*procConnector, error) {
+	return nil, errProcConnectorUnsupported
+}
+
+func (c *procConnector) read() ([]procEvent, error) {
+	return nil, errProcConnectorUnsupported
+}
+
+func (c *procConnector) close() error {
+	return nil
+}
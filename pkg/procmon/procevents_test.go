@@ -0,0 +1,113 @@
+package procmon
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// procEventPayload is a process connector message after its netlink header.
+func procEventPayload(what uint32, data ...uint32) []byte {
+	b := make([]byte, procEventDataOff+4*len(data))
+	ne := binary.NativeEndian
+	ne.PutUint32(b[0:], cnIdxProc)
+	ne.PutUint32(b[4:], cnValProc)
+	ne.PutUint32(b[procEventWhatOff:], what)
+	for i, v := range data {
+		ne.PutUint32(b[procEventDataOff+4*i:], v)
+	}
+	return b
+}
+
+func TestParseProcEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    procEvent
+		ok      bool
+	}{
+		{"exec", procEventPayload(procEventExec, 42, 42), procEvent{what: procEventExec, pid: 42, tid: 42}, true},
+		{"exit", procEventPayload(procEventExit, 43, 42, 0, 0), procEvent{what: procEventExit, pid: 42, tid: 43}, true},
+		{"fork", procEventPayload(procEventFork, 1, 1, 50, 50), procEvent{what: procEventFork, pid: 50, tid: 50}, true},
+		{"ack", procEventPayload(procEventNone, uint32(syscall.EPERM)), procEvent{ackErr: uint32(syscall.EPERM)}, true},
+		{"truncated fork", procEventPayload(procEventFork, 1, 1), procEvent{}, false},
+		{"uid change", procEventPayload(0x4, 42, 42, 0, 0), procEvent{}, false},
+		{"short", procEventPayload(procEventExec)[:procEventDataOff], procEvent{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseProcEvent(tt.payload)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseProcEvent = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	other := procEventPayload(procEventExec, 42, 42)
+	binary.NativeEndian.PutUint32(other[0:], 4)
+	if _, ok := parseProcEvent(other); ok {
+		t.Error("parsed a message from another connector")
+	}
+	if err := ackError(procEvent{ackErr: uint32(syscall.EPERM)}); err == nil {
+		t.Error("ackError(EPERM) = nil")
+	}
+}
+
+func TestProcConnectorListenMsg(t *testing.T) {
+	msg := procConnectorListenMsg(7)
+	ne := binary.NativeEndian
+	if int(ne.Uint32(msg[0:])) != len(msg) || ne.Uint32(msg[12:]) != 7 {
+		t.Errorf("netlink header = %v", msg[:16])
+	}
+	cn := msg[16:]
+	if ne.Uint32(cn[0:]) != cnIdxProc || ne.Uint32(cn[4:]) != cnValProc || ne.Uint32(cn[12:]) == 0 {
+		t.Errorf("cn_msg header = %v", cn[:cnMsgLen])
+	}
+	if ne.Uint16(cn[16:]) != 4 || ne.Uint32(cn[cnMsgLen:]) != procCnMcastListen {
+		t.Errorf("cn_msg data = %v", cn[16:])
+	}
+}
+
+func TestProcessMonitor_handleProcEvent(t *testing.T) {
+	events := make(chan collector.SecurityEvent, 10)
+	pm := New(Config{ScanInterval: time.Second, EventChan: events}, logrus.New())
+	ctx := context.Background()
+
+	pm.knownProcs[99999] = &ProcessInfo{PID: 99999, Name: "curl"}
+	pm.handleProcEvent(ctx, procEvent{what: procEventExit, pid: 99999, tid: 100000})
+	if _, ok := pm.knownProcs[99999]; !ok {
+		t.Fatal("a thread exit removed the process")
+	}
+	pm.handleProcEvent(ctx, procEvent{what: procEventExit, pid: 99999, tid: 99999})
+	if _, ok := pm.knownProcs[99999]; ok {
+		t.Error("exited process still known")
+	}
+	if ev := <-events; ev.Type != collector.EventTypeProcessExit || ev.Process.Name != "curl" {
+		t.Errorf("event = %+v, want the exit of curl", ev)
+	}
+
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	// A known PID that execs is read again.
+	self := os.Getpid()
+	pm.knownProcs[self] = &ProcessInfo{PID: self, Name: "old"}
+	pm.handleProcEvent(ctx, procEvent{what: procEventExec, pid: self, tid: self})
+	if proc := pm.knownProcs[self]; proc == nil || proc.Name == "old" {
+		t.Errorf("known process after exec = %+v, want it read again", proc)
+	}
+}
+
+func TestProcessMonitor_startProcEventsPoll(t *testing.T) {
+	pm := New(Config{ScanInterval: time.Second, EventMode: EventModePoll}, logrus.New())
+	if events := pm.startProcEvents(context.Background()); events != nil {
+		t.Error("poll mode opened the process connector")
+	}
+}
@@ -16,13 +16,56 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/fileintegrity"
 )
 
 // Config for process monitoring
 type Config struct {
 	ScanInterval        time.Duration
 	SuspiciousProcesses []string
-	EventChan           chan<- collector.SecurityEvent
+	// FDUsagePercent of a process's open file limit raises an fd_exhaustion
+	// anomaly; 0 disables the check.
+	FDUsagePercent int
+	EventChan      chan<- collector.SecurityEvent
+
+	// ExeHashAllowlist and ExeHashDenylist are hex SHA-256 digests of
+	// executables. Allowlisted processes emit no events; denylisted ones
+	// raise a CRITICAL process event.
+	ExeHashAllowlist []string
+	ExeHashDenylist  []string
+
+	// RedactEnvSecrets ships credentials found in process environments
+	// as SHA-256 hashes instead of in clear text.
+	RedactEnvSecrets bool
+
+	// A process using HighCPUPercent of a core for HighCPUScans scans in a
+	// row raises a sustained CPU event; 0 scans disables the check.
+	HighCPUPercent int
+	HighCPUScans   int
+
+	// EventMode selects how processes are noticed: EventModePoll scans /proc
+	// every ScanInterval; EventModeAuto ("" or unknown) and EventModeNetlink
+	// also handle execs and exits as the kernel's process connector reports
+	// them.
+	EventMode string
+
+	// Without the process connector, the interval between full scans
+	// shrinks towards MinScanInterval while processes churn, and /proc is
+	// sampled for new processes ScanSamples times per interval. A zero
+	// MinScanInterval keeps ScanInterval.
+	MinScanInterval time.Duration
+	ScanSamples     int
+
+	// CredentialPaths are Kubernetes and cloud credential files or
+	// directories, which may start with ~/. Processes naming one on their
+	// command line or holding one open are reported.
+	CredentialPaths []string
+
+	// ProbeCommands are the pod spec's exec probe commands. Processes they
+	// run, and commands exec'd into the pod on a probe-like period, are
+	// handled as ProbePolicy says; "" is ProbePolicyDownrank.
+	ProbeCommands [][]string
+	ProbePolicy   string
 }
 
 // ProcessInfo holds information about a running process
@@ -36,6 +79,40 @@ type ProcessInfo struct {
 	UID         int
 	StartTime   time.Time
 	CmdlineHash string
+	// ExeHash is the SHA-256 of the executable, "" if it could not be read.
+	ExeHash string
+	// Ancestors is the lineage resolved when the process was first seen,
+	// parent first.
+	Ancestors []collector.ProcessAncestor
+
+	// fdAlerted is set while the process is over the fd usage threshold
+	fdAlerted bool
+	// allowlisted is set when the executable hash is on the allowlist
+	allowlisted bool
+	// fileless is why the process looks fileless, "" if it does not
+	fileless string
+	// envIndicators are flagged in the environment; env holds the variables
+	// behind them
+	envIndicators []string
+	env           map[string]string
+	// cpuTicks and sampledAt are the previous usage sample; cpuPercent is
+	// the CPU used since the one before, memoryBytes the RSS
+	cpuTicks    uint64
+	sampledAt   time.Time
+	cpuPercent  float64
+	memoryBytes int64
+	// highCPUScans counts consecutive scans over the CPU threshold;
+	// cpuAlerted is set once they raised an event
+	highCPUScans int
+	cpuAlerted   bool
+	// threads is the thread count at the last usage sample
+	threads int
+	// credentialFiles are the credential files seen open and reported
+	credentialFiles map[string]bool
+	// probe is why the process is taken for an exec probe's, "" if it is
+	// not; probeExempt is set when its events are not sent
+	probe       string
+	probeExempt bool
 }
 
 // ProcessMonitor monitors processes within the container namespace
@@ -47,8 +124,26 @@ type ProcessMonitor struct {
 	knownProcs map[int]*ProcessInfo
 	mu         sync.RWMutex
 
-	// Compiled suspicious patterns
+	// Compiled suspicious patterns, replaceable at runtime
 	suspiciousPatterns []*regexp.Regexp
+	patternsMu         sync.RWMutex
+
+	exeHashes *exeHasher
+
+	// Executable hash lists, replaceable at runtime
+	hashLists   exeHashLists
+	hashListsMu sync.RWMutex
+
+	// sched plans full scans and samples of /proc
+	sched *scanScheduler
+	// slowdown passes the latest SetSlowdown factor to the scan loop
+	slowdown chan int
+
+	// credentials matches CredentialPaths; nil when there are none
+	credentials *fileintegrity.Matcher
+
+	// probes recognizes exec probe processes; nil with ProbePolicyOff
+	probes *probeTracker
 }
 
 // New creates a new ProcessMonitor
@@ -57,19 +152,76 @@ func New(cfg Config, log *logrus.Logger) *ProcessMonitor {
 		cfg:        cfg,
 		log:        log,
 		knownProcs: make(map[int]*ProcessInfo),
+		exeHashes:  newExeHasher(),
+		sched:      newScanScheduler(cfg),
+		slowdown:   make(chan int, 1),
 	}
 
 	// Compile suspicious process patterns
-	for _, pattern := range cfg.SuspiciousProcesses {
+	pm.suspiciousPatterns = compilePatterns(cfg.SuspiciousProcesses, log)
+	pm.SetExeHashLists(cfg.ExeHashAllowlist, cfg.ExeHashDenylist)
+	if len(cfg.CredentialPaths) > 0 {
+		var err error
+		if pm.credentials, err = fileintegrity.NewCredentialMatcher(cfg.CredentialPaths); err != nil {
+			log.WithError(err).Warn("Ignoring invalid credential paths")
+		}
+	}
+
+	switch cfg.ProbePolicy {
+	case "", ProbePolicyDownrank, ProbePolicyExempt:
+		pm.probes = newProbeTracker(cfg.ProbeCommands)
+	case ProbePolicyOff:
+	default:
+		log.WithField("policy", cfg.ProbePolicy).Warn("Unknown exec probe policy, using downrank")
+		pm.probes = newProbeTracker(cfg.ProbeCommands)
+	}
+
+	switch cfg.EventMode {
+	case "", EventModeAuto, EventModeNetlink, EventModePoll:
+	default:
+		log.WithField("mode", cfg.EventMode).Warn("Unknown process event mode, using auto")
+	}
+
+	return pm
+}
+
+// SetSlowdown multiplies the scan intervals by factor; 1 restores them.
+// Process connector events are handled as before.
+func (pm *ProcessMonitor) SetSlowdown(factor int) {
+	for {
+		select {
+		case pm.slowdown <- factor:
+			return
+		default:
+			// Replace a factor the loop has not taken yet.
+			select {
+			case <-pm.slowdown:
+			default:
+			}
+		}
+	}
+}
+
+// SetSuspiciousProcesses replaces the suspicious process patterns. Invalid
+// patterns are skipped with a warning, as at startup.
+func (pm *ProcessMonitor) SetSuspiciousProcesses(patterns []string) {
+	compiled := compilePatterns(patterns, pm.log)
+	pm.patternsMu.Lock()
+	pm.suspiciousPatterns = compiled
+	pm.patternsMu.Unlock()
+}
+
+func compilePatterns(patterns []string, log *logrus.Logger) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
 		re, err := regexp.Compile(pattern)
 		if err != nil {
 			log.WithError(err).WithField("pattern", pattern).Warn("Invalid process pattern")
 			continue
 		}
-		pm.suspiciousPatterns = append(pm.suspiciousPatterns, re)
+		compiled = append(compiled, re)
 	}
-
-	return pm
+	return compiled
 }
 
 // Start begins process monitoring
@@ -77,18 +229,43 @@ func (pm *ProcessMonitor) Start(ctx context.Context) {
 	pm.log.Info("Starting process monitor")
 
 	// Initial scan
-	pm.scanProcesses(ctx)
+	pm.fullScan(ctx)
+
+	// events is nil, and never ready, when polling only.
+	events := pm.startProcEvents(ctx)
+	if events != nil {
+		pm.sched.fixed()
+	}
 
-	ticker := time.NewTicker(pm.cfg.ScanInterval)
-	defer ticker.Stop()
+	wait, full := pm.sched.next()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			pm.log.Info("Process monitor stopping")
 			return
-		case <-ticker.C:
-			pm.scanProcesses(ctx)
+		case <-timer.C:
+			if full {
+				pm.fullScan(ctx)
+			} else {
+				pm.sampleProcesses(ctx)
+			}
+			wait, full = pm.sched.next()
+			timer.Reset(wait)
+		case factor := <-pm.slowdown:
+			pm.sched.slowdown(factor)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			wait, full = pm.sched.next()
+			timer.Reset(wait)
+		case ev := <-events:
+			pm.handleProcEvent(ctx, ev)
 		}
 	}
 }
@@ -114,22 +291,20 @@ func (pm *ProcessMonitor) scanProcesses(ctx context.Context) {
 
 		// Check if this is a new process
 		pm.mu.RLock()
-		_, exists := pm.knownProcs[pid]
+		proc, exists := pm.knownProcs[pid]
 		pm.mu.RUnlock()
 
 		if !exists {
-			proc, err := pm.getProcessInfo(pid)
+			proc, err = pm.inspectNewProcess(ctx, pid)
 			if err != nil {
 				continue // Process may have exited
 			}
-
-			pm.mu.Lock()
-			pm.knownProcs[pid] = proc
-			pm.mu.Unlock()
-
-			// Check for suspicious activity and emit event
-			pm.analyzeNewProcess(ctx, proc)
+		} else {
+			pm.checkCPU(ctx, proc, fmt.Sprintf("/proc/%d", pid))
 		}
+
+		pm.checkFDs(ctx, proc, fmt.Sprintf("/proc/%d", pid))
+		pm.checkCredentialFDs(ctx, proc, fmt.Sprintf("/proc/%d", pid))
 	}
 
 	// Detect exited processes
@@ -143,6 +318,31 @@ func (pm *ProcessMonitor) scanProcesses(ctx context.Context) {
 	pm.mu.Unlock()
 }
 
+// inspectNewProcess reads a process not seen before, records it and
+// analyzes it.
+func (pm *ProcessMonitor) inspectNewProcess(ctx context.Context, pid int) (*ProcessInfo, error) {
+	proc, err := pm.getProcessInfo(pid)
+	if err != nil {
+		return nil, err
+	}
+	proc.Ancestors = pm.ancestors(proc)
+	if pm.probes != nil {
+		proc.probe = pm.probes.classify(proc)
+	}
+	proc.fileless = filelessReason(fmt.Sprintf("/proc/%d", pid), proc.Exe, proc.Name)
+	proc.envIndicators, proc.env = scanEnviron(fmt.Sprintf("/proc/%d", pid), pm.cfg.RedactEnvSecrets)
+	sampleUsage(proc, fmt.Sprintf("/proc/%d", pid), time.Now())
+
+	pm.mu.Lock()
+	pm.knownProcs[pid] = proc
+	pm.mu.Unlock()
+	pm.sched.observed()
+
+	// Check for suspicious activity and emit event
+	pm.analyzeNewProcess(ctx, proc)
+	return proc, nil
+}
+
 // getProcessInfo reads process information from /proc
 func (pm *ProcessMonitor) getProcessInfo(pid int) (*ProcessInfo, error) {
 	procPath := fmt.Sprintf("/proc/%d", pid)
@@ -179,9 +379,24 @@ func (pm *ProcessMonitor) getProcessInfo(pid int) (*ProcessInfo, error) {
 		UID:         uid,
 		StartTime:   startTime,
 		CmdlineHash: hex.EncodeToString(hash[:8]),
+		ExeHash:     pm.exeHashes.hash(procPath),
 	}, nil
 }
 
+// StartTime returns when the process at procPath (e.g. /proc/42) started,
+// from the starttime field of its stat file.
+func StartTime(procPath string) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(procPath, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, _, startTime := parseStatFile(string(data))
+	if startTime.IsZero() {
+		return time.Time{}, fmt.Errorf("no start time in %s/stat", procPath)
+	}
+	return startTime, nil
+}
+
 // parseStatFile extracts name, ppid, and start time from /proc/[pid]/stat
 func parseStatFile(stat string) (name string, ppid int, startTime time.Time) {
 	// Format: pid (comm) state ppid ...
@@ -243,12 +458,21 @@ func (pm *ProcessMonitor) getProcessUID(procPath string) int {
 
 // analyzeNewProcess checks if a new process is suspicious
 func (pm *ProcessMonitor) analyzeNewProcess(ctx context.Context, proc *ProcessInfo) {
+	denied, allowed := pm.classifyExeHash(proc.ExeHash)
+	if allowed {
+		proc.allowlisted = true
+		return
+	}
+
 	cmdlineStr := strings.Join(proc.Cmdline, " ")
 	indicators := []string{}
 	severity := collector.SeverityInfo
 
 	// Check against suspicious patterns
-	for _, pattern := range pm.suspiciousPatterns {
+	pm.patternsMu.RLock()
+	patterns := pm.suspiciousPatterns
+	pm.patternsMu.RUnlock()
+	for _, pattern := range patterns {
 		if pattern.MatchString(cmdlineStr) || pattern.MatchString(proc.Name) {
 			indicators = append(indicators, fmt.Sprintf("matches_pattern:%s", pattern.String()))
 			severity = collector.SeverityHigh
@@ -273,25 +497,83 @@ func (pm *ProcessMonitor) analyzeNewProcess(ctx context.Context, proc *ProcessIn
 		}
 	}
 
+	if proc.fileless != "" {
+		indicators = append(indicators, IndicatorFilelessExecution)
+		if severity < collector.SeverityHigh {
+			severity = collector.SeverityHigh
+		}
+	}
+
+	for _, ind := range proc.envIndicators {
+		indicators = append(indicators, ind)
+		floor := collector.SeverityMedium
+		if ind == IndicatorLDPreload || ind == IndicatorLibraryPathHijack {
+			floor = collector.SeverityHigh
+		}
+		if severity < floor {
+			severity = floor
+		}
+	}
+
+	credentialPaths := pm.credentialArgs(proc.Cmdline)
+	if len(credentialPaths) > 0 {
+		indicators = append(indicators, IndicatorCredentialAccess)
+		if severity < collector.SeverityHigh {
+			severity = collector.SeverityHigh
+		}
+	}
+
+	if denied {
+		indicators = append(indicators, IndicatorDenylistedHash)
+		severity = collector.SeverityCritical
+	}
+
+	// Probes run every few seconds; below HIGH, their findings are noise.
+	if proc.probe != "" {
+		if severity < collector.SeverityHigh {
+			if pm.cfg.ProbePolicy == ProbePolicyExempt {
+				proc.probeExempt = true
+				return
+			}
+			indicators = dropIndicator(indicators, "shell_spawn")
+			severity = collector.SeverityInfo
+		}
+		indicators = append(indicators, IndicatorExecProbe)
+	}
+
 	// Emit event
 	event := collector.SecurityEvent{
-		Type:      collector.EventTypeProcessStart,
-		Severity:  severity,
-		Timestamp: time.Now(),
+		Type:       collector.EventTypeProcessStart,
+		Severity:   severity,
+		Timestamp:  time.Now(),
+		OccurredAt: proc.StartTime,
 		Process: &collector.ProcessEvent{
 			PID:                  proc.PID,
 			PPID:                 proc.PPID,
 			Name:                 proc.Name,
 			ExePath:             proc.Exe,
+			ExeHash:              proc.ExeHash,
 			Cmdline:              proc.Cmdline,
 			UID:                  proc.UID,
 			StartTime:            proc.StartTime,
 			SuspiciousIndicators: indicators,
+			Ancestors:            proc.Ancestors,
+			Environment:          proc.env,
+			MemoryBytes:          proc.memoryBytes,
 		},
 		Metadata: map[string]string{
 			"cmdline_hash": proc.CmdlineHash,
 		},
 	}
+	if proc.fileless != "" {
+		event.Metadata["fileless_reason"] = proc.fileless
+	}
+	if len(credentialPaths) > 0 {
+		event.Metadata[MetadataCredentialPaths] = strings.Join(credentialPaths, ",")
+	}
+	if proc.probe != "" {
+		event.Metadata[MetadataExecProbe] = proc.probe
+	}
 
 	select {
 	case pm.cfg.EventChan <- event:
@@ -303,6 +585,9 @@ func (pm *ProcessMonitor) analyzeNewProcess(ctx context.Context, proc *ProcessIn
 
 // emitProcessExit emits an event when a process exits
 func (pm *ProcessMonitor) emitProcessExit(ctx context.Context, proc *ProcessInfo) {
+	if proc.allowlisted || proc.probeExempt {
+		return
+	}
 	event := collector.SecurityEvent{
 		Type:      collector.EventTypeProcessExit,
 		Severity:  collector.SeverityInfo,
@@ -1,6 +1,8 @@
 package procmon
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -66,3 +68,31 @@ func TestProcessMonitor_isShellSpawn(t *testing.T) {
 		t.Error("sleep should not be shell spawn")
 	}
 }
+
+func TestProcessMonitor_SetSuspiciousProcesses(t *testing.T) {
+	pm := New(Config{ScanInterval: time.Second, SuspiciousProcesses: []string{"nc"}}, logrus.New())
+	pm.SetSuspiciousProcesses([]string{"xmrig", "(", "minerd"})
+	if len(pm.suspiciousPatterns) != 2 {
+		t.Errorf("patterns = %d, want 2 (invalid pattern skipped)", len(pm.suspiciousPatterns))
+	}
+}
+
+func TestStartTime(t *testing.T) {
+	dir := t.TempDir()
+	// starttime (field 22) is 12345 clock ticks after boot.
+	stat := "42 (my proc) S 1 42 42 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 12345 1000 10"
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := StartTime(dir)
+	if err != nil {
+		t.Fatalf("StartTime: %v", err)
+	}
+	if want := getBootTime().Add(123450 * time.Millisecond); !got.Equal(want) {
+		t.Errorf("StartTime = %v, want %v", got, want)
+	}
+
+	if _, err := StartTime(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing stat file")
+	}
+}
@@ -0,0 +1,148 @@
+package procmon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// IndicatorSustainedHighCPU marks a process that kept at least
+// Config.HighCPUPercent of a core busy for Config.HighCPUScans scans in a row.
+const IndicatorSustainedHighCPU = "sustained_high_cpu"
+
+// AnomalySustainedCPU is the ResourceEvent.AnomalyType of the same event.
+const AnomalySustainedCPU = "sustained_cpu"
+
+// clockTicks is USER_HZ, the unit of the stat file's CPU times. It is 100 on
+// every Linux architecture the agent ships for.
+const clockTicks = 100
+
+var pageSize = int64(os.Getpagesize())
+
+// processUsage is a process's CPU time and resident memory at one scan.
+type processUsage struct {
+	cpuTicks uint64
+	rssBytes int64
+	threads  int
+}
+
+// readUsage returns the CPU time (utime + stime) and RSS from procPath/stat.
+func readUsage(procPath string) (processUsage, error) {
+	data, err := os.ReadFile(filepath.Join(procPath, "stat"))
+	if err != nil {
+		return processUsage{}, err
+	}
+	return parseUsage(string(data))
+}
+
+func parseUsage(stat string) (processUsage, error) {
+	// The fields after "(comm)" start at field 3, state; utime and stime
+	// are fields 14 and 15, num_threads field 20 and rss, in pages, field
+	// 24.
+	end := strings.LastIndex(stat, ")")
+	if end == -1 || end+2 > len(stat) {
+		return processUsage{}, fmt.Errorf("malformed stat")
+	}
+	fields := strings.Fields(stat[end+2:])
+	if len(fields) < 22 {
+		return processUsage{}, fmt.Errorf("stat has %d fields after comm, want 22", len(fields))
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	rss, err3 := strconv.ParseInt(fields[21], 10, 64)
+	threads, err4 := strconv.Atoi(fields[17])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return processUsage{}, fmt.Errorf("malformed stat cpu, thread or rss field")
+	}
+	return processUsage{cpuTicks: utime + stime, rssBytes: rss * pageSize, threads: threads}, nil
+}
+
+// sampleUsage records proc's memory and, from the second sample on, its CPU
+// use since the previous one, in percent of one core. It reports whether
+// cpuPercent is new.
+func sampleUsage(proc *ProcessInfo, procPath string, now time.Time) bool {
+	u, err := readUsage(procPath)
+	if err != nil {
+		return false
+	}
+	proc.memoryBytes, proc.threads = u.rssBytes, u.threads
+	prevTicks, prevAt := proc.cpuTicks, proc.sampledAt
+	proc.cpuTicks, proc.sampledAt = u.cpuTicks, now
+	elapsed := now.Sub(prevAt).Seconds()
+	if prevAt.IsZero() || elapsed <= 0 || u.cpuTicks < prevTicks {
+		return false
+	}
+	proc.cpuPercent = float64(u.cpuTicks-prevTicks) / clockTicks / elapsed * 100
+	return true
+}
+
+// checkCPU samples proc and raises a sustained CPU event the first time it
+// has used cfg.HighCPUPercent of a core for cfg.HighCPUScans scans in a
+// row, catching miners renamed past the name and command line checks. It
+// re-arms once usage drops below the threshold. Allowlisted processes are
+// skipped.
+func (pm *ProcessMonitor) checkCPU(ctx context.Context, proc *ProcessInfo, procPath string) {
+	if !sampleUsage(proc, procPath, time.Now()) || pm.cfg.HighCPUScans <= 0 || proc.allowlisted {
+		return
+	}
+	if proc.cpuPercent < float64(pm.cfg.HighCPUPercent) {
+		proc.highCPUScans = 0
+		proc.cpuAlerted = false
+		return
+	}
+	proc.highCPUScans++
+	if proc.highCPUScans < pm.cfg.HighCPUScans || proc.cpuAlerted {
+		return
+	}
+	proc.cpuAlerted = true
+
+	pm.log.WithFields(logrus.Fields{
+		"pid": proc.PID, "name": proc.Name, "cpu_percent": proc.cpuPercent, "scans": proc.highCPUScans,
+	}).Warn("Process sustaining high CPU")
+
+	event := collector.SecurityEvent{
+		Type:      collector.EventTypeResourceAnomaly,
+		Severity:  collector.SeverityHigh,
+		Timestamp: time.Now(),
+		Process: &collector.ProcessEvent{
+			PID:                  proc.PID,
+			PPID:                 proc.PPID,
+			Name:                 proc.Name,
+			ExePath:              proc.Exe,
+			ExeHash:              proc.ExeHash,
+			Cmdline:              proc.Cmdline,
+			UID:                  proc.UID,
+			StartTime:            proc.StartTime,
+			SuspiciousIndicators: []string{IndicatorSustainedHighCPU},
+			Ancestors:            proc.Ancestors,
+			CPUPercent:           proc.cpuPercent,
+			MemoryBytes:          proc.memoryBytes,
+		},
+		Resource: &collector.ResourceEvent{
+			AnomalyType:  AnomalySustainedCPU,
+			AnomalyScore: proc.cpuPercent / 100,
+			CPUPercent:   proc.cpuPercent,
+			MemoryBytes:  proc.memoryBytes,
+			PID:          proc.PID,
+			ProcessName:  proc.Name,
+		},
+		Metadata: map[string]string{
+			"cmdline_hash":   proc.CmdlineHash,
+			"high_cpu_scans": strconv.Itoa(proc.highCPUScans),
+		},
+	}
+	select {
+	case pm.cfg.EventChan <- event:
+	case <-ctx.Done():
+	default:
+		pm.log.Warn("Event channel full, dropping sustained CPU event")
+	}
+}
@@ -0,0 +1,99 @@
+package procmon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/collector"
+)
+
+// statLine is a stat file for a process named "kworker x" (a space in comm,
+// as miners use to look like kernel threads) with the given CPU ticks and
+// RSS pages.
+func statLine(utime, stime, rssPages int) string {
+	return fmt.Sprintf("42 (kworker x) R 1 42 42 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 4 0 1000 123456 %d 18446744073709551615", utime, stime, rssPages)
+}
+
+func TestParseUsage(t *testing.T) {
+	u, err := parseUsage(statLine(300, 50, 256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.cpuTicks != 350 || u.rssBytes != 256*pageSize || u.threads != 4 {
+		t.Errorf("usage = %+v, want 350 ticks, 256 pages and 4 threads", u)
+	}
+	for _, bad := range []string{"", "42 (sh", "42 (sh) R 1 2 3"} {
+		if _, err := parseUsage(bad); err == nil {
+			t.Errorf("parseUsage(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestProcessMonitor_checkCPU(t *testing.T) {
+	dir := t.TempDir()
+	events := make(chan collector.SecurityEvent, 10)
+	pm := New(Config{ScanInterval: time.Second, EventChan: events, HighCPUPercent: 80, HighCPUScans: 3}, logrus.New())
+	proc := &ProcessInfo{PID: 42, Name: "kworker x"}
+
+	// scan writes the process's cumulative CPU ticks and pretends the
+	// previous sample was taken a second ago.
+	ticks := 0
+	scan := func(perSecond int) {
+		t.Helper()
+		ticks += perSecond
+		if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(statLine(ticks, 0, 1024)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		proc.sampledAt = time.Now().Add(-time.Second)
+		pm.checkCPU(context.Background(), proc, dir)
+	}
+
+	scan(0) // baseline
+	scan(390)
+	scan(390)
+	if len(events) != 0 {
+		t.Fatalf("event after 2 busy scans, want 3")
+	}
+	if proc.cpuPercent < 380 || proc.cpuPercent > 391 || proc.memoryBytes != 1024*pageSize {
+		t.Errorf("cpu = %.1f%%, memory = %d", proc.cpuPercent, proc.memoryBytes)
+	}
+	scan(390)
+	if len(events) != 1 {
+		t.Fatalf("got %d events after 3 busy scans, want 1", len(events))
+	}
+	e := <-events
+	if e.Type != collector.EventTypeResourceAnomaly || e.Severity != collector.SeverityHigh ||
+		e.Resource.AnomalyType != AnomalySustainedCPU || e.Process.SuspiciousIndicators[0] != IndicatorSustainedHighCPU ||
+		e.Process.CPUPercent < 380 || e.Process.MemoryBytes != 1024*pageSize {
+		t.Errorf("event = %+v, process %+v, resource %+v", e, e.Process, e.Resource)
+	}
+
+	// Still busy: no repeat until usage drops and climbs again.
+	scan(390)
+	scan(10)
+	if len(events) != 0 {
+		t.Errorf("repeated or idle scans raised %d events", len(events))
+	}
+	for i := 0; i < 3; i++ {
+		scan(100)
+	}
+	if len(events) != 1 {
+		t.Errorf("got %d events after usage climbed again, want 1", len(events))
+	}
+
+	// Allowlisted processes are sampled but never flagged.
+	<-events
+	proc.allowlisted, proc.cpuAlerted, proc.highCPUScans = true, false, 0
+	for i := 0; i < 4; i++ {
+		scan(390)
+	}
+	if len(events) != 0 {
+		t.Errorf("allowlisted process raised %d events", len(events))
+	}
+}
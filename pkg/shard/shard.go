@@ -0,0 +1,83 @@
+// Package shard assigns agents to controller replicas. Sharded controllers
+// publish a routing Table and agents send to the replica it names for their
+// ID, so agents and replicas agree on each agent's owner without talking to
+// each other. Owners are picked by rendezvous hashing: when a replica joins
+// or leaves, only the agents it gains or held move.
+package shard
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Member is a controller replica agents can be routed to.
+type Member struct {
+	Name string `json:"name"`
+	// Address is the replica's API base URL.
+	Address string `json:"address"`
+}
+
+// Table is the routing table a sharded controller publishes.
+type Table struct {
+	// Generation changes whenever the members do.
+	Generation string   `json:"generation"`
+	Members    []Member `json:"members"`
+}
+
+// NewTable returns the table of members, sorted by name.
+func NewTable(members []Member) *Table {
+	sorted := append([]Member(nil), members...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	h := fnv.New64a()
+	for _, m := range sorted {
+		h.Write([]byte(m.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(m.Address))
+		h.Write([]byte{0})
+	}
+	return &Table{Generation: strconv.FormatUint(h.Sum64(), 16), Members: sorted}
+}
+
+// Owner returns the member key, an agent ID, is routed to, and false when
+// the table has no members.
+func (t *Table) Owner(key string) (Member, bool) {
+	var (
+		owner Member
+		best  uint64
+		found bool
+	)
+	for _, m := range t.Members {
+		if s := score(m.Name, key); !found || s > best {
+			owner, best, found = m, s, true
+		}
+	}
+	return owner, found
+}
+
+// Member returns the member named name.
+func (t *Table) Member(name string) (Member, bool) {
+	for _, m := range t.Members {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// score is member's weight for key. FNV-1a alone spreads similar strings,
+// such as pod names differing in one character, poorly, so its sum is
+// mixed with the splitmix64 finalizer.
+func score(member, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(member))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
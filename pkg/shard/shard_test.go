@@ -0,0 +1,58 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func members(n int) []Member {
+	var out []Member
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("apss-controller-7d9f8-%c", 'a'+i)
+		out = append(out, Member{Name: name, Address: "http://10.0.0." + fmt.Sprint(i+1) + ":8080"})
+	}
+	return out
+}
+
+func TestTable_Owner(t *testing.T) {
+	if _, ok := NewTable(nil).Owner("agent-1"); ok {
+		t.Error("empty table has an owner")
+	}
+
+	three := NewTable(members(3))
+	four := NewTable(members(4))
+	if three.Generation == four.Generation {
+		t.Error("generation did not change with the members")
+	}
+	// The order members are listed in does not matter.
+	reversed := members(3)
+	reversed[0], reversed[2] = reversed[2], reversed[0]
+	if NewTable(reversed).Generation != three.Generation {
+		t.Error("generation depends on member order")
+	}
+
+	counts := make(map[string]int)
+	moved := 0
+	const agents = 3000
+	for i := 0; i < agents; i++ {
+		id := fmt.Sprintf("agent-%d", i)
+		before, _ := three.Owner(id)
+		after, _ := four.Owner(id)
+		counts[before.Name]++
+		if before != after {
+			moved++
+			// Only agents taken by the new replica move.
+			if after.Name != members(4)[3].Name {
+				t.Fatalf("%s moved from %s to %s", id, before.Name, after.Name)
+			}
+		}
+	}
+	for name, n := range counts {
+		if n < agents/3*8/10 || n > agents/3*12/10 {
+			t.Errorf("%s owns %d of %d agents", name, n, agents)
+		}
+	}
+	if moved < agents/4*8/10 || moved > agents/4*12/10 {
+		t.Errorf("%d of %d agents moved to the fourth replica", moved, agents)
+	}
+}
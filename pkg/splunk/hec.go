@@ -0,0 +1,229 @@
+// Package splunk exports events and alerts to a Splunk HTTP Event Collector
+// (HEC), batching them into as few requests as possible.
+package splunk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults for Config fields left zero.
+const (
+	DefaultEventSourceType = "apss:event"
+	DefaultAlertSourceType = "apss:alert"
+	DefaultBatchSize       = 100
+	DefaultFlushInterval   = 5 * time.Second
+	DefaultQueueSize       = 10000
+	DefaultTimeout         = 30 * time.Second
+)
+
+// collectorPath is the HEC endpoint for JSON events, relative to the URL.
+const collectorPath = "/services/collector/event"
+
+var exported = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_splunk_hec_events_total",
+		Help: "Total records exported to Splunk HEC by sourcetype and result (sent, failed, dropped)",
+	},
+	[]string{"sourcetype", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(exported)
+}
+
+// Config for the HEC client.
+type Config struct {
+	// URL is the HEC base URL, e.g. https://splunk.example.com:8088.
+	URL   string
+	Token string
+	// Index is the target index; empty uses the token's default index.
+	Index string
+	// Host is reported as the host field of every record.
+	Host            string
+	EventSourceType string
+	AlertSourceType string
+	// BatchSize records are sent in one request; a partial batch is sent
+	// after FlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueueSize bounds records waiting to be sent; beyond it they are dropped.
+	QueueSize int
+	Timeout   time.Duration
+	// Transport carries requests to the collector, e.g. through a proxy;
+	// nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// record is one HEC event in the collector's JSON format.
+type record struct {
+	Time       float64     `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Source     string      `json:"source"`
+	SourceType string      `json:"sourcetype"`
+	Index      string      `json:"index,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// Client queues records and sends them in batches from Run.
+type Client struct {
+	cfg        Config
+	url        string
+	httpClient *http.Client
+	queue      chan record
+	log        *logrus.Logger
+}
+
+// NewClient creates a HEC client, filling in defaults for zero fields.
+func NewClient(cfg Config, log *logrus.Logger) *Client {
+	if cfg.EventSourceType == "" {
+		cfg.EventSourceType = DefaultEventSourceType
+	}
+	if cfg.AlertSourceType == "" {
+		cfg.AlertSourceType = DefaultAlertSourceType
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Client{
+		cfg:        cfg,
+		url:        strings.TrimRight(cfg.URL, "/") + collectorPath,
+		httpClient: &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+		queue:      make(chan record, cfg.QueueSize),
+		log:        log,
+	}
+}
+
+// SendEvent queues a security event observed at t. It never blocks; it
+// returns false if the queue is full and the event was dropped.
+func (c *Client) SendEvent(event interface{}, t time.Time) bool {
+	return c.enqueue(c.cfg.EventSourceType, "apss-agent", event, t)
+}
+
+// SendAlert queues an alert raised at t. It never blocks; it returns false
+// if the queue is full and the alert was dropped.
+func (c *Client) SendAlert(alert interface{}, t time.Time) bool {
+	return c.enqueue(c.cfg.AlertSourceType, "apss-controller", alert, t)
+}
+
+func (c *Client) enqueue(sourceType, source string, v interface{}, t time.Time) bool {
+	r := record{
+		Time:       float64(t.UnixNano()) / 1e9,
+		Host:       c.cfg.Host,
+		Source:     source,
+		SourceType: sourceType,
+		Index:      c.cfg.Index,
+		Event:      v,
+	}
+	select {
+	case c.queue <- r:
+		return true
+	default:
+		exported.WithLabelValues(sourceType, "dropped").Inc()
+		return false
+	}
+}
+
+// Run sends queued records until ctx is done, then sends what is left.
+func (c *Client) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]record, 0, c.cfg.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := c.send(ctx, batch); err != nil {
+			c.log.WithError(err).WithField("records", len(batch)).Error("Failed to send records to Splunk HEC")
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+			defer cancel()
+			for n := len(c.queue); n > 0; n-- {
+				batch = append(batch, <-c.queue)
+				if len(batch) >= c.cfg.BatchSize {
+					flush(drainCtx)
+				}
+			}
+			flush(drainCtx)
+			return
+		case r := <-c.queue:
+			batch = append(batch, r)
+			if len(batch) >= c.cfg.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// send posts batch as one request of concatenated JSON records and counts
+// the outcome per sourcetype.
+func (c *Client) send(ctx context.Context, batch []record) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for i := range batch {
+		if err := enc.Encode(&batch[i]); err != nil {
+			return fmt.Errorf("failed to marshal record: %w", err)
+		}
+	}
+	err := c.post(ctx, &body)
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	for _, r := range batch {
+		exported.WithLabelValues(r.SourceType, result).Inc()
+	}
+	return err
+}
+
+func (c *Client) post(ctx context.Context, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+c.cfg.Token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// HEC explains rejections in {"text": ..., "code": ...}.
+		var hecErr struct {
+			Text string `json:"text"`
+			Code int    `json:"code"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&hecErr) == nil && hecErr.Text != "" {
+			return fmt.Errorf("unexpected status code %d: %s (code %d)", resp.StatusCode, hecErr.Text, hecErr.Code)
+		}
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package splunk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// decodeBatch splits a HEC request body into its records.
+func decodeBatch(t *testing.T, r io.Reader) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Errorf("decode record: %v", err)
+			return out
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestClient_Batches(t *testing.T) {
+	batches := make(chan []map[string]interface{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/collector/event" || r.Header.Get("Authorization") != "Splunk tok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		batches <- decodeBatch(t, r.Body)
+		io.WriteString(w, `{"text":"Success","code":0}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{
+		URL: srv.URL + "/", Token: "tok", Index: "security", Host: "ctrl-0",
+		BatchSize: 2, FlushInterval: 50 * time.Millisecond,
+	}, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	at := time.Unix(1700000000, 500000000)
+	c.SendEvent(map[string]string{"id": "ev-1"}, at)
+	c.SendEvent(map[string]string{"id": "ev-2"}, at)
+	c.SendAlert(map[string]string{"id": "alert-1"}, at)
+
+	// A full batch is sent at once; the partial one after FlushInterval.
+	var got [][]map[string]interface{}
+	for len(got) < 2 {
+		select {
+		case b := <-batches:
+			got = append(got, b)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d batches, want 2", len(got))
+		}
+	}
+	if len(got[0]) != 2 || len(got[1]) != 1 {
+		t.Fatalf("batch sizes = %d, %d; want 2, 1", len(got[0]), len(got[1]))
+	}
+	ev := got[0][0]
+	if ev["sourcetype"] != DefaultEventSourceType || ev["index"] != "security" || ev["host"] != "ctrl-0" || ev["time"] != 1700000000.5 {
+		t.Errorf("event record = %v", ev)
+	}
+	if id := ev["event"].(map[string]interface{})["id"]; id != "ev-1" {
+		t.Errorf("event id = %v", id)
+	}
+	if st := got[1][0]["sourcetype"]; st != DefaultAlertSourceType {
+		t.Errorf("alert sourcetype = %v", st)
+	}
+}
+
+func TestClient_FlushOnStop(t *testing.T) {
+	received := make(chan int, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- len(decodeBatch(t, r.Body))
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{URL: srv.URL, Token: "tok", FlushInterval: time.Hour}, logrus.New())
+	for i := 0; i < 3; i++ {
+		c.SendEvent(i, time.Now())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Run(ctx)
+	select {
+	case n := <-received:
+		if n != 3 {
+			t.Errorf("records sent on stop = %d, want 3", n)
+		}
+	default:
+		t.Fatal("nothing sent on stop")
+	}
+}
+
+func TestClient_QueueFull(t *testing.T) {
+	c := NewClient(Config{URL: "http://127.0.0.1:1", Token: "tok", QueueSize: 1}, logrus.New())
+	if !c.SendEvent(1, time.Now()) {
+		t.Fatal("first event dropped")
+	}
+	if c.SendAlert(2, time.Now()) {
+		t.Error("second record queued past QueueSize")
+	}
+}
+
+func TestClient_Rejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"text":"Incorrect index","code":7}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{URL: srv.URL, Token: "tok"}, logrus.New())
+	err := c.send(context.Background(), []record{{Event: "x", SourceType: DefaultEventSourceType}})
+	if err == nil || !strings.Contains(err.Error(), "Incorrect index") {
+		t.Errorf("send err = %v, want the HEC error text", err)
+	}
+}
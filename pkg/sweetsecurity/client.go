@@ -4,19 +4,49 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/internal/breaker"
+)
+
+// Auth modes: how Config.APIKey is sent.
+const (
+	AuthBearer       = "bearer"
+	AuthAPIKeyHeader = "header"
+	AuthNone         = "none"
 )
 
+// DefaultAPIKeyHeader carries the API key in AuthAPIKeyHeader mode.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// ValidAuthMode reports whether mode is one of the auth modes; "" means
+// AuthBearer.
+func ValidAuthMode(mode string) bool {
+	switch mode {
+	case "", AuthBearer, AuthAPIKeyHeader, AuthNone:
+		return true
+	}
+	return false
+}
+
 // Client handles communication with Sweet Security API
 type Client struct {
 	apiEndpoint string
 	apiKey      string
+	authMode    string
+	headers     http.Header
 	httpClient  *http.Client
 	log         *logrus.Logger
+
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	breaker         *breaker.Breaker
 }
 
 // Config for Sweet Security client
@@ -24,6 +54,35 @@ type Config struct {
 	APIEndpoint string
 	APIKey      string
 	Timeout     time.Duration
+
+	// AuthMode is how APIKey is sent: AuthBearer (the default) as
+	// "Authorization: Bearer <key>", or AuthAPIKeyHeader in the APIKeyHeader
+	// header (DefaultAPIKeyHeader if empty). With AuthNone no key is needed
+	// and Headers carries the credentials, e.g. an Authorization header with
+	// a custom scheme.
+	AuthMode     string
+	APIKeyHeader string
+	// Headers are set on every request, e.g. X-Org-ID. The auth header of
+	// AuthMode takes precedence over one with the same name.
+	Headers map[string]string
+
+	// MaxRetries is how many times a send is retried after a network error,
+	// 429 or 5xx; negative disables retries. RetryBackoff is the first delay,
+	// doubled per retry up to MaxRetryBackoff, with jitter. A Retry-After
+	// header replaces the delay; one longer than MaxRetryBackoff ends the
+	// retries.
+	MaxRetries      int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// BreakerThreshold consecutive failed sends open the circuit breaker,
+	// failing sends with ErrCircuitOpen for BreakerCooldown before one
+	// trial send is let through. Negative disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Transport carries requests to the API, e.g. through a proxy; nil uses
+	// http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
 // NewClient creates a new Sweet Security API client
@@ -31,14 +90,57 @@ func NewClient(cfg Config, log *logrus.Logger) *Client {
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 30 * time.Second
 	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.MaxRetryBackoff <= 0 {
+		cfg.MaxRetryBackoff = DefaultMaxRetryBackoff
+	}
+	if cfg.BreakerThreshold == 0 {
+		cfg.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = DefaultBreakerCooldown
+	}
+
+	if cfg.AuthMode == "" {
+		cfg.AuthMode = AuthBearer
+	}
+
+	headers := make(http.Header, len(cfg.Headers)+3)
+	headers.Set("User-Agent", "apss-autopilot-security-sensor/0.1.0")
+	for k, v := range cfg.Headers {
+		headers.Set(k, v)
+	}
+	switch cfg.AuthMode {
+	case AuthBearer:
+		headers.Set("Authorization", "Bearer "+cfg.APIKey)
+	case AuthAPIKeyHeader:
+		name := cfg.APIKeyHeader
+		if name == "" {
+			name = DefaultAPIKeyHeader
+		}
+		headers.Set(name, cfg.APIKey)
+	}
 
 	return &Client{
 		apiEndpoint: cfg.APIEndpoint,
 		apiKey:      cfg.APIKey,
+		authMode:    cfg.AuthMode,
+		headers:     headers,
 		httpClient: &http.Client{
-			Timeout: cfg.Timeout,
+			Timeout:   cfg.Timeout,
+			Transport: cfg.Transport,
 		},
 		log: log,
+
+		maxRetries:      max(cfg.MaxRetries, 0),
+		retryBackoff:    cfg.RetryBackoff,
+		maxRetryBackoff: cfg.MaxRetryBackoff,
+		breaker:         breaker.New(cfg.BreakerThreshold, cfg.BreakerCooldown),
 	}
 }
 
@@ -57,6 +159,10 @@ type Alert struct {
 	MitreID     string                 `json:"mitre_id,omitempty"`
 	EventIDs    []string               `json:"event_ids,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+
+	// Payload, when set by AlertMappings.Apply, is sent instead of the
+	// fields above.
+	Payload map[string]interface{} `json:"-"`
 }
 
 // Event represents a security event to send to Sweet Security
@@ -76,17 +182,20 @@ type Event struct {
 
 // SendAlert sends a security alert to Sweet Security API
 func (c *Client) SendAlert(ctx context.Context, alert *Alert) error {
-	if c.apiEndpoint == "" || c.apiKey == "" {
+	if !c.configured() {
 		return fmt.Errorf("sweet security client not configured")
 	}
 
 	url := fmt.Sprintf("%s/api/v1/alerts", c.apiEndpoint)
+	if alert.Payload != nil {
+		return c.sendJSON(ctx, url, alert.Payload)
+	}
 	return c.sendJSON(ctx, url, alert)
 }
 
 // SendEvent sends a security event to Sweet Security API
 func (c *Client) SendEvent(ctx context.Context, event *Event) error {
-	if c.apiEndpoint == "" || c.apiKey == "" {
+	if !c.configured() {
 		return fmt.Errorf("sweet security client not configured")
 	}
 
@@ -96,7 +205,7 @@ func (c *Client) SendEvent(ctx context.Context, event *Event) error {
 
 // SendBatchEvents sends multiple events in a batch
 func (c *Client) SendBatchEvents(ctx context.Context, events []*Event) error {
-	if c.apiEndpoint == "" || c.apiKey == "" {
+	if !c.configured() {
 		return fmt.Errorf("sweet security client not configured")
 	}
 
@@ -107,21 +216,70 @@ func (c *Client) SendBatchEvents(ctx context.Context, events []*Event) error {
 	return c.sendJSON(ctx, url, payload)
 }
 
-// sendJSON sends a JSON payload to the API
+// sendJSON sends a JSON payload to the API, retrying failures that may be
+// transient unless the circuit breaker is open.
 func (c *Client) sendJSON(ctx context.Context, url string, payload interface{}) error {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
+	if !c.allowSend() {
+		requests.WithLabelValues("short_circuited").Inc()
+		return ErrCircuitOpen
+	}
 
+	for attempt := 0; ; attempt++ {
+		err = c.post(ctx, url, jsonData)
+		switch {
+		case err == nil:
+			c.recordSend(true)
+			requests.WithLabelValues("sent").Inc()
+			return nil
+		case ctx.Err() != nil:
+			c.breaker.Abandon()
+			requests.WithLabelValues("failed").Inc()
+			return err
+		case !retryable(err):
+			// The API is up but refused the payload; retrying won't help.
+			c.recordSend(true)
+			requests.WithLabelValues("failed").Inc()
+			return err
+		}
+		if attempt >= c.maxRetries {
+			break
+		}
+		delay := backoff(c.retryBackoff, c.maxRetryBackoff, attempt)
+		var se *statusError
+		if errors.As(err, &se) && se.retryAfter > 0 {
+			if se.retryAfter > c.maxRetryBackoff {
+				break
+			}
+			delay = se.retryAfter
+		}
+		requests.WithLabelValues("retried").Inc()
+		c.log.WithError(err).WithFields(logrus.Fields{"url": url, "attempt": attempt + 1, "retry_in": delay}).Debug("Retrying Sweet Security API request")
+		select {
+		case <-ctx.Done():
+			c.breaker.Abandon()
+			requests.WithLabelValues("failed").Inc()
+			return err
+		case <-time.After(delay):
+		}
+	}
+	c.recordSend(false)
+	requests.WithLabelValues("failed").Inc()
+	return err
+}
+
+// post makes one attempt at sending jsonData.
+func (c *Client) post(ctx context.Context, url string, jsonData []byte) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
-	req.Header.Set("User-Agent", "apss-autopilot-security-sensor/0.1.0")
+	c.setHeaders(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -130,7 +288,7 @@ func (c *Client) sendJSON(ctx context.Context, url string, payload interface{})
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return &statusError{code: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
 	}
 
 	c.log.WithFields(logrus.Fields{
@@ -143,7 +301,7 @@ func (c *Client) sendJSON(ctx context.Context, url string, payload interface{})
 
 // HealthCheck checks if the Sweet Security API is reachable
 func (c *Client) HealthCheck(ctx context.Context) error {
-	if c.apiEndpoint == "" || c.apiKey == "" {
+	if !c.configured() {
 		return fmt.Errorf("sweet security client not configured")
 	}
 
@@ -153,7 +311,7 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	c.setHeaders(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -167,3 +325,17 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 
 	return nil
 }
+
+// configured reports whether the client has an endpoint and, unless
+// AuthNone is used, an API key.
+func (c *Client) configured() bool {
+	return c.apiEndpoint != "" && (c.apiKey != "" || c.authMode == AuthNone)
+}
+
+// setHeaders adds the static and auth headers to req. A static
+// Content-Type replaces the one already set.
+func (c *Client) setHeaders(req *http.Request) {
+	for k, v := range c.headers {
+		req.Header[k] = v
+	}
+}
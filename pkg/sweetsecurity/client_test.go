@@ -245,3 +245,68 @@ func TestClient_SendBatchEvents_Success(t *testing.T) {
 		t.Errorf("SendBatchEvents: %v", err)
 	}
 }
+
+func TestClient_AuthModesAndHeaders(t *testing.T) {
+	if !canListen(t) {
+		return
+	}
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		want map[string]string
+	}{
+		{
+			name: "bearer with org header",
+			cfg:  Config{APIKey: "my-key", Headers: map[string]string{"X-Org-ID": "org-1", "Authorization": "ignored"}},
+			want: map[string]string{"Authorization": "Bearer my-key", "X-Org-ID": "org-1", "Content-Type": "application/json"},
+		},
+		{
+			name: "api key header",
+			cfg:  Config{APIKey: "my-key", AuthMode: AuthAPIKeyHeader},
+			want: map[string]string{"X-Api-Key": "my-key", "Authorization": ""},
+		},
+		{
+			name: "custom header name",
+			cfg:  Config{APIKey: "my-key", AuthMode: AuthAPIKeyHeader, APIKeyHeader: "X-Sweet-Key"},
+			want: map[string]string{"X-Sweet-Key": "my-key", "X-Api-Key": ""},
+		},
+		{
+			name: "authorization passthrough",
+			cfg:  Config{AuthMode: AuthNone, Headers: map[string]string{"Authorization": "SSWS token-1"}},
+			want: map[string]string{"Authorization": "SSWS token-1"},
+		},
+	} {
+		tc.cfg.APIEndpoint = server.URL
+		c := NewClient(tc.cfg, logrus.New())
+		if err := c.SendAlert(context.Background(), &Alert{ID: "alert-1"}); err != nil {
+			t.Errorf("%s: SendAlert: %v", tc.name, err)
+			continue
+		}
+		for k, v := range tc.want {
+			if got.Get(k) != v {
+				t.Errorf("%s: header %s = %q, want %q", tc.name, k, got.Get(k), v)
+			}
+		}
+		if err := c.HealthCheck(context.Background()); err != nil {
+			t.Errorf("%s: HealthCheck: %v", tc.name, err)
+		}
+		if auth := tc.want["Authorization"]; got.Get("Authorization") != auth {
+			t.Errorf("%s: health check Authorization = %q, want %q", tc.name, got.Get("Authorization"), auth)
+		}
+	}
+}
+
+func TestValidAuthMode(t *testing.T) {
+	for mode, want := range map[string]bool{"": true, AuthBearer: true, AuthAPIKeyHeader: true, AuthNone: true, "basic": false} {
+		if got := ValidAuthMode(mode); got != want {
+			t.Errorf("ValidAuthMode(%q) = %v, want %v", mode, got, want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package sweetsecurity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// AlertMapping reshapes the alert payload of a rule into the taxonomy a
+// Sweet Security detection model expects. Renames run first, then category,
+// confidence and Set, then Drop.
+type AlertMapping struct {
+	// Category and Confidence set the top-level category and confidence.
+	Category   string   `json:"category,omitempty"`
+	Confidence *float64 `json:"confidence,omitempty"`
+	// Rename moves fields, by dotted path, to other paths. All sources are
+	// read before any target is written, so renames do not chain.
+	Rename map[string]string `json:"rename,omitempty"`
+	// Set assigns fields by dotted path, e.g. entity.name. In string
+	// values ${path} is replaced by that field of the alert as built,
+	// before any mapping; a value that is only "${path}" keeps its type.
+	Set map[string]interface{} `json:"set,omitempty"`
+	// Drop removes fields by dotted path.
+	Drop []string `json:"drop,omitempty"`
+}
+
+// AlertMappings holds the mapping for every rule, and one applied to all
+// rules before their own.
+type AlertMappings struct {
+	Default *AlertMapping            `json:"default,omitempty"`
+	Rules   map[string]*AlertMapping `json:"rules,omitempty"`
+}
+
+// fieldRef matches a ${path} reference in a Set value.
+var fieldRef = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// LoadAlertMappings reads alert mappings from a YAML or JSON file.
+func LoadAlertMappings(file string) (*AlertMappings, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m AlertMappings
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, err
+	}
+	if m.Default != nil {
+		if err := m.Default.validate(); err != nil {
+			return nil, fmt.Errorf("default: %w", err)
+		}
+	}
+	for ruleID, rm := range m.Rules {
+		if rm == nil {
+			return nil, fmt.Errorf("rule %s: empty mapping", ruleID)
+		}
+		if err := rm.validate(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", ruleID, err)
+		}
+	}
+	return &m, nil
+}
+
+func (m *AlertMapping) validate() error {
+	if m.Confidence != nil && (*m.Confidence < 0 || *m.Confidence > 1) {
+		return fmt.Errorf("confidence %v is not between 0 and 1", *m.Confidence)
+	}
+	for from, to := range m.Rename {
+		if err := validatePath(from); err != nil {
+			return err
+		}
+		if err := validatePath(to); err != nil {
+			return err
+		}
+	}
+	for path := range m.Set {
+		if err := validatePath(path); err != nil {
+			return err
+		}
+	}
+	for _, path := range m.Drop {
+		if err := validatePath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePath(path string) error {
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			return fmt.Errorf("invalid field path %q", path)
+		}
+	}
+	return nil
+}
+
+// Apply sets alert.Payload to the alert reshaped by the default mapping and
+// then the mapping for its rule. Alerts of rules without either are left
+// alone.
+func (m *AlertMappings) Apply(alert *Alert) error {
+	if m == nil {
+		return nil
+	}
+	rule := m.Rules[alert.RuleID]
+	if m.Default == nil && rule == nil {
+		return nil
+	}
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	var payload, orig map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &orig); err != nil {
+		return err
+	}
+	for _, mapping := range []*AlertMapping{m.Default, rule} {
+		if mapping != nil {
+			if err := mapping.apply(payload, orig); err != nil {
+				return fmt.Errorf("rule %s: %w", alert.RuleID, err)
+			}
+		}
+	}
+	alert.Payload = payload
+	return nil
+}
+
+func (m *AlertMapping) apply(payload, orig map[string]interface{}) error {
+	moved := make(map[string]interface{}, len(m.Rename))
+	for from, to := range m.Rename {
+		if v, ok := getPath(payload, from); ok {
+			moved[to] = v
+		}
+	}
+	for from := range m.Rename {
+		deletePath(payload, from)
+	}
+	for _, to := range sortedKeys(moved) {
+		if err := setPath(payload, to, moved[to]); err != nil {
+			return err
+		}
+	}
+	if m.Category != "" {
+		payload["category"] = m.Category
+	}
+	if m.Confidence != nil {
+		payload["confidence"] = *m.Confidence
+	}
+	for _, path := range sortedKeys(m.Set) {
+		if err := setPath(payload, path, expandRefs(m.Set[path], orig)); err != nil {
+			return err
+		}
+	}
+	for _, path := range m.Drop {
+		deletePath(payload, path)
+	}
+	return nil
+}
+
+// expandRefs replaces ${path} references in a string value with fields of
+// orig. Missing fields expand to "".
+func expandRefs(v interface{}, orig map[string]interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	if m := fieldRef.FindStringSubmatch(s); m != nil && m[0] == s {
+		ref, _ := getPath(orig, m[1])
+		return ref
+	}
+	return fieldRef.ReplaceAllStringFunc(s, func(ref string) string {
+		v, ok := getPath(orig, ref[2:len(ref)-1])
+		if !ok || v == nil {
+			return ""
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	})
+}
+
+// sortedKeys orders paths so that setting them is deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func getPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		v, ok := obj[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return v, true
+		}
+		if obj, ok = v.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// setPath sets a field, creating the objects on its path. It fails when a
+// field on the path is not an object.
+func setPath(obj map[string]interface{}, path string, v interface{}) error {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part]
+		if !ok || next == nil {
+			child := map[string]interface{}{}
+			obj[part] = child
+			obj = child
+			continue
+		}
+		if obj, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("cannot set %s: %s is not an object", path, part)
+		}
+	}
+	obj[parts[len(parts)-1]] = v
+	return nil
+}
+
+func deletePath(obj map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		obj = next
+	}
+	delete(obj, parts[len(parts)-1])
+}
@@ -0,0 +1,139 @@
+package sweetsecurity
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoadAlertMappings(t *testing.T) {
+	tests := []struct {
+		name, file, wantErr string
+	}{
+		{name: "valid", file: "default:\n  set: {source.product: apss}\nrules:\n  APSS-002:\n    category: cryptomining\n    confidence: 0.9\n    rename: {mitre_id: technique_id}\n    drop: [event_ids]\n"},
+		{name: "confidence", file: "rules:\n  APSS-002: {confidence: 90}\n", wantErr: "APSS-002: confidence 90"},
+		{name: "path", file: "rules:\n  APSS-002:\n    set: {entity..name: x}\n", wantErr: "invalid field path"},
+		{name: "null", file: "rules:\n  APSS-002:\n", wantErr: "empty mapping"},
+		{name: "unknown field", file: "rules:\n  APSS-002: {categroy: x}\n", wantErr: "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mappings.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			m, err := LoadAlertMappings(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAlertMappings: %v", err)
+			}
+			if m.Default == nil || m.Rules["APSS-002"].Category != "cryptomining" {
+				t.Errorf("mappings = %+v", m)
+			}
+		})
+	}
+}
+
+func TestAlertMappings_Apply(t *testing.T) {
+	confidence := 0.9
+	m := &AlertMappings{
+		Default: &AlertMapping{Set: map[string]interface{}{"source.product": "apss", "category": "generic"}},
+		Rules: map[string]*AlertMapping{
+			"APSS-002": {
+				Category:   "cryptomining",
+				Confidence: &confidence,
+				// The swap only works if renames do not chain.
+				Rename: map[string]string{"pod_name": "pod_namespace", "pod_namespace": "pod_name", "mitre_id": "threat.technique.id"},
+				Set: map[string]interface{}{
+					"entity.name": "${pod_namespace}/${pod_name}",
+					"entity.type": "pod",
+					"evidence":    "${event_ids}",
+					"observed":    "${metadata.observed_at}",
+				},
+				Drop: []string{"event_ids", "metadata.source"},
+			},
+		},
+	}
+
+	alert := &Alert{
+		ID: "a1", RuleID: "APSS-002", PodName: "web-1", PodNamespace: "prod", MitreID: "T1496",
+		EventIDs: []string{"e1", "e2"},
+		Metadata: map[string]interface{}{"source": "apss", "observed_at": "2026-01-02T03:04:05Z"},
+	}
+	if err := m.Apply(alert); err != nil {
+		t.Fatal(err)
+	}
+	p := alert.Payload
+	entity, _ := p["entity"].(map[string]interface{})
+	threat, _ := p["threat"].(map[string]interface{})
+	if p["category"] != "cryptomining" || p["confidence"] != 0.9 || p["pod_name"] != "prod" || p["pod_namespace"] != "web-1" {
+		t.Errorf("payload = %+v", p)
+	}
+	if entity["name"] != "prod/web-1" || entity["type"] != "pod" {
+		t.Errorf("entity = %+v, want prod/web-1 pod", entity)
+	}
+	if ids, _ := p["evidence"].([]interface{}); len(ids) != 2 {
+		t.Errorf("evidence = %v, want the event IDs list", p["evidence"])
+	}
+	if threat["technique"].(map[string]interface{})["id"] != "T1496" || p["mitre_id"] != nil {
+		t.Errorf("mitre_id not renamed: %+v", p)
+	}
+	if _, ok := p["event_ids"]; ok {
+		t.Error("event_ids not dropped")
+	}
+	if md := p["metadata"].(map[string]interface{}); md["source"] != nil || p["observed"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("metadata = %+v, observed = %v", md, p["observed"])
+	}
+	if p["source"].(map[string]interface{})["product"] != "apss" {
+		t.Error("default mapping not applied")
+	}
+
+	other := &Alert{ID: "a2", RuleID: "APSS-001"}
+	if err := m.Apply(other); err != nil || other.Payload["category"] != "generic" {
+		t.Errorf("default-only payload = %+v, err %v", other.Payload, err)
+	}
+	unmapped := &Alert{ID: "a3", RuleID: "APSS-001"}
+	if err := (&AlertMappings{}).Apply(unmapped); err != nil || unmapped.Payload != nil {
+		t.Errorf("alert without a mapping got payload %+v", unmapped.Payload)
+	}
+	bad := &AlertMappings{Default: &AlertMapping{Set: map[string]interface{}{"rule_id.x": 1}}}
+	if err := bad.Apply(&Alert{RuleID: "APSS-001"}); err == nil {
+		t.Error("setting below a string field succeeded")
+	}
+}
+
+func TestClient_SendAlert_Payload(t *testing.T) {
+	if !canListen(t) {
+		return
+	}
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := NewClient(Config{APIEndpoint: server.URL, APIKey: "k", Timeout: time.Second}, logrus.New())
+	alert := &Alert{ID: "a1", RuleID: "APSS-002", Payload: map[string]interface{}{"category": "cryptomining"}}
+	if err := c.SendAlert(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if got["category"] != "cryptomining" || got["id"] != nil {
+		t.Errorf("sent %+v, want the payload only", got)
+	}
+}
@@ -0,0 +1,224 @@
+package sweetsecurity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Queue full policies.
+const (
+	// DropNewest rejects the item being queued.
+	DropNewest = "drop-newest"
+	// DropOldest discards the longest-waiting item to make room.
+	DropOldest = "drop-oldest"
+)
+
+// Defaults for QueueConfig fields left zero.
+const (
+	DefaultQueueSize     = 10000
+	DefaultWorkers       = 4
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 2 * time.Second
+	DefaultDrainTimeout  = 10 * time.Second
+)
+
+var (
+	queueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apss_sweetsecurity_queue_depth",
+			Help: "Events and alerts waiting to be sent to Sweet Security by kind",
+		},
+		[]string{"kind"},
+	)
+	queueDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_sweetsecurity_queue_dropped_total",
+			Help: "Total events and alerts dropped because the Sweet Security queue was full, by kind",
+		},
+		[]string{"kind"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth, queueDropped)
+}
+
+// QueueConfig for a Queue.
+type QueueConfig struct {
+	// Size bounds the events and, separately, the alerts waiting to be
+	// sent. Policy chooses what is dropped when one is full.
+	Size   int
+	Policy string
+	// Workers send concurrently. Each sends events in batches of up to
+	// BatchSize, and a partial batch after FlushInterval; alerts are sent
+	// one at a time as they arrive.
+	Workers       int
+	BatchSize     int
+	FlushInterval time.Duration
+	// DrainTimeout bounds sending what is left once Run's context is done.
+	DrainTimeout time.Duration
+}
+
+// Queue sends events and alerts to Sweet Security from a fixed pool of
+// workers, so a burst costs queue slots rather than goroutines.
+type Queue struct {
+	client *Client
+	cfg    QueueConfig
+	events chan *Event
+	alerts chan *Alert
+	// mu serialises DropOldest evictions with the enqueue that follows.
+	mu  sync.Mutex
+	log *logrus.Logger
+}
+
+// NewQueue creates a queue in front of client, filling in defaults for zero
+// fields. It fails on an unknown policy.
+func NewQueue(client *Client, cfg QueueConfig, log *logrus.Logger) (*Queue, error) {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultQueueSize
+	}
+	if cfg.Policy == "" {
+		cfg.Policy = DropNewest
+	}
+	if cfg.Policy != DropNewest && cfg.Policy != DropOldest {
+		return nil, fmt.Errorf("unknown queue policy %q: want %s or %s", cfg.Policy, DropNewest, DropOldest)
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = DefaultDrainTimeout
+	}
+	return &Queue{
+		client: client,
+		cfg:    cfg,
+		events: make(chan *Event, cfg.Size),
+		alerts: make(chan *Alert, cfg.Size),
+		log:    log,
+	}, nil
+}
+
+// SendEvent queues an event. It never blocks; it returns false if the queue
+// was full and the event was dropped. Under DropOldest the event is always
+// queued, dropping the oldest one if need be.
+func (q *Queue) SendEvent(event *Event) bool {
+	return enqueue(q, q.events, event, "event")
+}
+
+// SendAlert queues an alert like SendEvent.
+func (q *Queue) SendAlert(alert *Alert) bool {
+	return enqueue(q, q.alerts, alert, "alert")
+}
+
+func enqueue[T any](q *Queue, ch chan T, item T, kind string) bool {
+	defer func() { queueDepth.WithLabelValues(kind).Set(float64(len(ch))) }()
+	select {
+	case ch <- item:
+		return true
+	default:
+	}
+	queueDropped.WithLabelValues(kind).Inc()
+	if q.cfg.Policy != DropOldest {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		select {
+		case ch <- item:
+			return true
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+// Run sends queued items until ctx is done, then sends what is left within
+// DrainTimeout.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), q.cfg.DrainTimeout)
+	defer cancel()
+	for n := len(q.alerts); n > 0 && drainCtx.Err() == nil; n-- {
+		q.sendAlert(drainCtx, <-q.alerts)
+	}
+	batch := make([]*Event, 0, q.cfg.BatchSize)
+	for n := len(q.events); n > 0 && drainCtx.Err() == nil; n-- {
+		batch = append(batch, <-q.events)
+		if len(batch) >= q.cfg.BatchSize {
+			q.sendBatch(drainCtx, batch)
+			batch = batch[:0]
+		}
+	}
+	q.sendBatch(drainCtx, batch)
+}
+
+// work is one worker: it batches events and sends alerts until ctx is
+// done, then sends its partial batch.
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*Event, 0, q.cfg.BatchSize)
+	flush := func(ctx context.Context) {
+		q.sendBatch(ctx, batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), q.cfg.DrainTimeout)
+			defer cancel()
+			flush(drainCtx)
+			return
+		case alert := <-q.alerts:
+			queueDepth.WithLabelValues("alert").Set(float64(len(q.alerts)))
+			q.sendAlert(ctx, alert)
+		case event := <-q.events:
+			queueDepth.WithLabelValues("event").Set(float64(len(q.events)))
+			batch = append(batch, event)
+			if len(batch) >= q.cfg.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+func (q *Queue) sendBatch(ctx context.Context, batch []*Event) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := q.client.SendBatchEvents(ctx, batch); err != nil {
+		q.log.WithError(err).WithField("events", len(batch)).Debug("Failed to send events to Sweet Security")
+	}
+}
+
+func (q *Queue) sendAlert(ctx context.Context, alert *Alert) {
+	if err := q.client.SendAlert(ctx, alert); err != nil {
+		q.log.WithError(err).WithFields(logrus.Fields{"alert_id": alert.ID, "rule_id": alert.RuleID}).Error("Failed to send alert to Sweet Security API")
+	}
+}
@@ -0,0 +1,147 @@
+package sweetsecurity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recordingServer records the event IDs of each batch and the alert IDs it
+// receives.
+type recordingServer struct {
+	mu      sync.Mutex
+	batches [][]string
+	alerts  []string
+}
+
+func (s *recordingServer) start(t *testing.T) string {
+	t.Helper()
+	if !canListen(t) {
+		return ""
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v1/events/batch":
+			var body struct{ Events []Event }
+			json.NewDecoder(r.Body).Decode(&body)
+			var ids []string
+			for _, ev := range body.Events {
+				ids = append(ids, ev.ID)
+			}
+			s.batches = append(s.batches, ids)
+		case "/api/v1/alerts":
+			var a Alert
+			json.NewDecoder(r.Body).Decode(&a)
+			s.alerts = append(s.alerts, a.ID)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func (s *recordingServer) events() (batches, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.batches {
+		total += len(b)
+	}
+	return len(s.batches), total
+}
+
+func newTestQueue(t *testing.T, url string, cfg QueueConfig) *Queue {
+	t.Helper()
+	client := NewClient(Config{APIEndpoint: url, APIKey: "key", Timeout: time.Second}, logrus.New())
+	q, err := NewQueue(client, cfg, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestNewQueue_UnknownPolicy(t *testing.T) {
+	if _, err := NewQueue(NewClient(Config{}, logrus.New()), QueueConfig{Policy: "drop-random"}, logrus.New()); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestQueue_BatchesEvents(t *testing.T) {
+	var rec recordingServer
+	url := rec.start(t)
+	q := newTestQueue(t, url, QueueConfig{Workers: 1, BatchSize: 3, FlushInterval: time.Hour})
+	for _, id := range []string{"e1", "e2", "e3", "e4"} {
+		q.SendEvent(&Event{ID: id})
+	}
+	q.SendAlert(&Alert{ID: "a1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		if batches, _ := rec.events(); batches == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The fourth event is a partial batch, sent when the queue stops.
+	cancel()
+	<-done
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.batches) != 2 || len(rec.batches[0]) != 3 || len(rec.batches[1]) != 1 {
+		t.Errorf("batches = %v, want one of 3 events then one of 1", rec.batches)
+	}
+	if len(rec.alerts) != 1 || rec.alerts[0] != "a1" {
+		t.Errorf("alerts = %v, want [a1]", rec.alerts)
+	}
+}
+
+func TestQueue_FlushInterval(t *testing.T) {
+	var rec recordingServer
+	url := rec.start(t)
+	q := newTestQueue(t, url, QueueConfig{Workers: 2, BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+	q.SendEvent(&Event{ID: "e1"})
+	for i := 0; i < 100; i++ {
+		if _, total := rec.events(); total == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("partial batch not sent after the flush interval")
+}
+
+func TestQueue_DropNewest(t *testing.T) {
+	q := newTestQueue(t, "http://unused", QueueConfig{Size: 2})
+	results := []bool{q.SendEvent(&Event{ID: "e1"}), q.SendEvent(&Event{ID: "e2"}), q.SendEvent(&Event{ID: "e3"})}
+	if !results[0] || !results[1] || results[2] {
+		t.Errorf("SendEvent results = %v, want the third rejected", results)
+	}
+	if first := <-q.events; first.ID != "e1" {
+		t.Errorf("oldest queued = %s, want e1", first.ID)
+	}
+}
+
+func TestQueue_DropOldest(t *testing.T) {
+	q := newTestQueue(t, "http://unused", QueueConfig{Size: 2, Policy: DropOldest})
+	for _, id := range []string{"a1", "a2", "a3"} {
+		if !q.SendAlert(&Alert{ID: id}) {
+			t.Errorf("SendAlert(%s) rejected under drop-oldest", id)
+		}
+	}
+	if got := []string{(<-q.alerts).ID, (<-q.alerts).ID}; got[0] != "a2" || got[1] != "a3" {
+		t.Errorf("queued alerts = %v, want [a2 a3]", got)
+	}
+}
@@ -0,0 +1,104 @@
+package sweetsecurity
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults for the retry and circuit breaker Config fields left zero.
+const (
+	DefaultMaxRetries       = 3
+	DefaultRetryBackoff     = 500 * time.Millisecond
+	DefaultMaxRetryBackoff  = 30 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting the API while the circuit
+// breaker is open after repeated failures.
+var ErrCircuitOpen = errors.New("sweet security circuit breaker open")
+
+var (
+	requests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apss_sweetsecurity_requests_total",
+			Help: "Total Sweet Security API sends by result (sent, retried, failed, short_circuited)",
+		},
+		[]string{"result"},
+	)
+	breakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "apss_sweetsecurity_circuit_breaker_state",
+		Help: "Sweet Security circuit breaker state (0 closed, 1 open, 2 half-open)",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requests, breakerState)
+}
+
+// statusError is a response with a non-2xx status.
+type statusError struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
+
+// retryable reports whether a request that failed with err may succeed if
+// sent again: network errors, throttling and server errors.
+func retryable(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return se.code == http.StatusTooManyRequests || se.code >= 500
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date.
+// It returns 0 when the header is absent or unreadable.
+func parseRetryAfter(h string, now time.Time) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// backoff returns the delay before retry attempt (0-based): base doubled
+// per attempt, capped at limit, with the upper half jittered so clients
+// that failed together do not retry together.
+func backoff(base, limit time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	return d/2 + rand.N(d/2+1)
+}
+
+// allowSend reports whether the circuit breaker lets a send through.
+func (c *Client) allowSend() bool {
+	ok := c.breaker.Allow()
+	breakerState.Set(float64(c.breaker.State()))
+	return ok
+}
+
+// recordSend records with the circuit breaker whether the API answered a
+// send.
+func (c *Client) recordSend(answered bool) {
+	_, to := c.breaker.Record(answered)
+	breakerState.Set(float64(to))
+}
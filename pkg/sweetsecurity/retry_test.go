@@ -0,0 +1,155 @@
+package sweetsecurity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			d := backoff(100*time.Millisecond, time.Second, attempt)
+			if d < want/2 || d > want {
+				t.Fatalf("backoff(attempt %d) = %v, want in [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-3":                            0,
+		"soon":                          0,
+		"Fri, 02 Jan 2026 03:04:35 GMT": 30 * time.Second,
+		"Fri, 02 Jan 2026 03:00:00 GMT": 0,
+	}
+	for h, want := range tests {
+		if got := parseRetryAfter(h, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", h, got, want)
+		}
+	}
+}
+
+// flakyServer answers with the given statuses in turn, then 200.
+func flakyServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	if !canListen(t) {
+		return nil, nil
+	}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			if statuses[n-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func retryClient(url string, cfg Config) *Client {
+	cfg.APIEndpoint, cfg.APIKey = url, "key"
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = time.Millisecond
+	}
+	return NewClient(cfg, logrus.New())
+}
+
+func TestClient_RetriesTransientFailures(t *testing.T) {
+	srv, calls := flakyServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway)
+	c := retryClient(srv.URL, Config{})
+	if err := c.SendEvent(context.Background(), &Event{ID: "e1"}); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("calls = %d, want 4", got)
+	}
+}
+
+func TestClient_GivesUpAfterMaxRetries(t *testing.T) {
+	srv, calls := flakyServer(t, 500, 500, 500, 500)
+	c := retryClient(srv.URL, Config{MaxRetries: 2})
+	if err := c.SendEvent(context.Background(), &Event{ID: "e1"}); err == nil {
+		t.Fatal("expected an error after the retries")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestClient_DoesNotRetryClientErrors(t *testing.T) {
+	srv, calls := flakyServer(t, http.StatusBadRequest)
+	c := retryClient(srv.URL, Config{})
+	if err := c.SendEvent(context.Background(), &Event{ID: "e1"}); err == nil {
+		t.Fatal("expected an error on 400")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+}
+
+func TestClient_RetryAfterBeyondMaxBackoff(t *testing.T) {
+	if !canListen(t) {
+		return
+	}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	c := retryClient(srv.URL, Config{MaxRetryBackoff: time.Second})
+	if err := c.SendEvent(context.Background(), &Event{ID: "e1"}); err == nil {
+		t.Fatal("expected an error on 429")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1: a Retry-After of an hour should end the retries", got)
+	}
+}
+
+func TestClient_CircuitBreakerShortCircuits(t *testing.T) {
+	srv, calls := flakyServer(t, 500, 500, 500, 500)
+	c := retryClient(srv.URL, Config{MaxRetries: -1, BreakerThreshold: 2, BreakerCooldown: time.Hour})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := c.SendAlert(ctx, &Alert{ID: "a"}); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("send %d: err = %v, want a status error", i, err)
+		}
+	}
+	if err := c.SendAlert(ctx, &Alert{ID: "a"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("send with breaker open: err = %v, want ErrCircuitOpen", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestClient_CancelledRetryDoesNotOpenBreaker(t *testing.T) {
+	srv, _ := flakyServer(t, 500)
+	c := retryClient(srv.URL, Config{RetryBackoff: time.Hour, BreakerThreshold: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.SendEvent(ctx, &Event{ID: "e1"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := c.SendEvent(context.Background(), &Event{ID: "e2"}); err != nil {
+		t.Errorf("send after a cancelled one: %v", err)
+	}
+}
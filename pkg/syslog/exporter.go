@@ -0,0 +1,291 @@
+// Package syslog ships messages to a syslog collector, such as the syslog
+// input of a SIEM, as RFC 5424 messages over TCP or TLS. Messages are framed
+// by octet counting (RFC 6587, RFC 5425), so they may span lines.
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+)
+
+// Transport protocols.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+)
+
+// Formats the messages' content can be rendered in: an ArcSight CEF record
+// as the message, or RFC 5424 structured data with a JSON message.
+const (
+	FormatCEF     = "cef"
+	FormatRFC5424 = "rfc5424"
+)
+
+// Defaults for Config fields left zero.
+const (
+	DefaultProtocol  = ProtocolTLS
+	DefaultFacility  = 10 // security/authorization (authpriv)
+	DefaultAppName   = "apss-controller"
+	DefaultBatchSize = 100
+	DefaultQueueSize = 10000
+	DefaultTimeout   = 10 * time.Second
+)
+
+// maxReconnectDelay caps the wait between failed writes to the collector.
+const maxReconnectDelay = time.Minute
+
+var exported = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "apss_syslog_messages_total",
+		Help: "Total messages exported over syslog by msgid and result (sent, failed, dropped)",
+	},
+	[]string{"msgid", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(exported)
+}
+
+// ValidFormat reports whether format is FormatCEF or FormatRFC5424.
+func ValidFormat(format string) bool {
+	return format == FormatCEF || format == FormatRFC5424
+}
+
+// Config for the exporter.
+type Config struct {
+	// Address is the collector's host:port.
+	Address string
+	// Protocol is ProtocolTCP or ProtocolTLS.
+	Protocol string
+	// Facility is the RFC 5424 facility code, 1 to 23, of every message.
+	Facility int
+	// Hostname and AppName identify the sender in every message.
+	Hostname string
+	AppName  string
+	// BatchSize messages queued together are written at once.
+	BatchSize int
+	// QueueSize bounds messages waiting to be sent; beyond it they are
+	// dropped.
+	QueueSize int
+	// Timeout bounds connecting to the collector and each write.
+	Timeout time.Duration
+	// Egress sets the TLS trust used to reach the collector. Syslog cannot
+	// go through a proxy.
+	Egress egress.Config
+}
+
+// Exporter queues messages and writes them to the collector from Run over
+// one connection, reconnecting when it fails.
+type Exporter struct {
+	cfg       Config
+	tlsConfig *tls.Config
+	queue     chan Message
+	log       *logrus.Logger
+
+	// Only Run uses these.
+	conn net.Conn
+	buf  []byte
+}
+
+// NewExporter creates a syslog exporter, filling in defaults for zero
+// fields. It fails on an unknown protocol or facility, an address that is
+// not host:port, or egress settings it cannot apply.
+func NewExporter(cfg Config, log *logrus.Logger) (*Exporter, error) {
+	if cfg.Protocol == "" {
+		cfg.Protocol = DefaultProtocol
+	}
+	if cfg.Facility == 0 {
+		cfg.Facility = DefaultFacility
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = DefaultAppName
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if host, port, err := net.SplitHostPort(cfg.Address); err != nil || host == "" || port == "" {
+		return nil, fmt.Errorf("invalid syslog address %q: want host:port", cfg.Address)
+	}
+	if cfg.Facility < 1 || cfg.Facility > 23 {
+		return nil, fmt.Errorf("invalid syslog facility %d: want 1 to 23", cfg.Facility)
+	}
+	if cfg.Egress.ProxyURL != "" {
+		return nil, errors.New("syslog cannot use a proxy")
+	}
+	e := &Exporter{cfg: cfg, queue: make(chan Message, cfg.QueueSize), log: log}
+	switch cfg.Protocol {
+	case ProtocolTLS:
+		tlsConfig, err := cfg.Egress.TLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("syslog egress: %w", err)
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		e.tlsConfig = tlsConfig
+	case ProtocolTCP:
+		if !cfg.Egress.IsZero() {
+			return nil, fmt.Errorf("syslog over %s has no TLS settings; use %s", ProtocolTCP, ProtocolTLS)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported syslog protocol %q: want %s or %s", cfg.Protocol, ProtocolTCP, ProtocolTLS)
+	}
+	return e, nil
+}
+
+// Export queues a message. It never blocks; it returns false if the queue
+// is full and the message was dropped.
+func (e *Exporter) Export(m Message) bool {
+	select {
+	case e.queue <- m:
+		return true
+	default:
+		exported.WithLabelValues(m.MsgID, "dropped").Inc()
+		return false
+	}
+}
+
+// Run writes queued messages until ctx is done, then writes what is left.
+// After a failed write it waits, doubling the wait up to a minute, before
+// reconnecting; messages queue up meanwhile.
+func (e *Exporter) Run(ctx context.Context) {
+	defer e.disconnect()
+	batch := make([]Message, 0, e.cfg.BatchSize)
+	var delay time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			for len(e.queue) > 0 {
+				batch = e.fill(batch[:0], <-e.queue)
+				if err := e.send(batch); err != nil {
+					e.log.WithError(err).WithField("messages", len(e.queue)+len(batch)).Error("Failed to send remaining syslog messages")
+					return
+				}
+			}
+			return
+		case m := <-e.queue:
+			batch = e.fill(batch[:0], m)
+			if err := e.send(batch); err != nil {
+				delay = min(max(2*delay, time.Second), maxReconnectDelay)
+				e.log.WithError(err).WithFields(logrus.Fields{"messages": len(batch), "retry_in": delay}).Error("Failed to send messages to syslog collector")
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+				}
+				continue
+			}
+			delay = 0
+		}
+	}
+}
+
+// fill appends m and the messages queued behind it to batch, up to
+// BatchSize.
+func (e *Exporter) fill(batch []Message, m Message) []Message {
+	batch = append(batch, m)
+	for len(batch) < e.cfg.BatchSize && len(e.queue) > 0 {
+		batch = append(batch, <-e.queue)
+	}
+	return batch
+}
+
+// send writes batch in one write and counts the outcome. A connection the
+// collector closed since the last write is replaced first.
+func (e *Exporter) send(batch []Message) error {
+	e.buf = e.buf[:0]
+	var msg []byte
+	for i := range batch {
+		msg = batch[i].AppendRFC5424(msg[:0], e.cfg.Facility, e.cfg.Hostname, e.cfg.AppName)
+		e.buf = strconv.AppendInt(e.buf, int64(len(msg)), 10)
+		e.buf = append(e.buf, ' ')
+		e.buf = append(e.buf, msg...)
+	}
+	err := e.write(e.buf)
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	for i := range batch {
+		exported.WithLabelValues(batch[i].MsgID, result).Inc()
+	}
+	return err
+}
+
+func (e *Exporter) write(data []byte) error {
+	if e.conn != nil && !e.connected() {
+		e.disconnect()
+	}
+	if e.conn == nil {
+		if err := e.connect(); err != nil {
+			return err
+		}
+	}
+	if err := e.conn.SetWriteDeadline(time.Now().Add(e.cfg.Timeout)); err != nil {
+		e.disconnect()
+		return fmt.Errorf("failed to set write deadline: %w", err)
+	}
+	if _, err := e.conn.Write(data); err != nil {
+		// Part of a frame may have been written; the next message starts
+		// on a new connection.
+		e.disconnect()
+		return fmt.Errorf("failed to write to %s: %w", e.cfg.Address, err)
+	}
+	return nil
+}
+
+func (e *Exporter) connect() error {
+	d := net.Dialer{Timeout: e.cfg.Timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if e.cfg.Protocol == ProtocolTLS {
+		conn, err = tls.DialWithDialer(&d, "tcp", e.cfg.Address, e.tlsConfig)
+	} else {
+		conn, err = d.Dial("tcp", e.cfg.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", e.cfg.Address, err)
+	}
+	e.conn = conn
+	e.log.WithFields(logrus.Fields{"address": e.cfg.Address, "protocol": e.cfg.Protocol}).Debug("Connected to syslog collector")
+	return nil
+}
+
+// connected reports whether the collector still has the connection open.
+// Collectors never send on it, so a read that does not time out means it
+// was closed or reset. Writing to such a connection can succeed and lose
+// the messages. The deadline is in the future because a read past its
+// deadline fails without looking at the connection.
+func (e *Exporter) connected() bool {
+	if err := e.conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return false
+	}
+	var one [1]byte
+	_, err := e.conn.Read(one[:])
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func (e *Exporter) disconnect() {
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
@@ -0,0 +1,196 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/invisible-tech/autopilot-security-sensor/pkg/egress"
+)
+
+// collector accepts connections on ln and sends each octet-counted frame it
+// reads to the returned channel.
+func collector(t *testing.T, ln net.Listener) <-chan string {
+	t.Helper()
+	frames := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					n, err := r.ReadString(' ')
+					if err != nil {
+						return
+					}
+					size, err := strconv.Atoi(strings.TrimSuffix(n, " "))
+					if err != nil {
+						t.Errorf("bad frame length %q", n)
+						return
+					}
+					msg := make([]byte, size)
+					if _, err := io.ReadFull(r, msg); err != nil {
+						return
+					}
+					frames <- string(msg)
+				}
+			}()
+		}
+	}()
+	return frames
+}
+
+func receive(t *testing.T, frames <-chan string, n int) []string {
+	t.Helper()
+	var got []string
+	for len(got) < n {
+		select {
+		case f := <-frames:
+			got = append(got, f)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d messages, want %d", len(got), n)
+		}
+	}
+	return got
+}
+
+func TestExporter_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+	}
+	defer ln.Close()
+	frames := collector(t, ln)
+
+	e, err := NewExporter(Config{Address: ln.Addr().String(), Protocol: ProtocolTCP, Hostname: "h"}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	// A message spanning lines stays one frame.
+	e.Export(Message{Severity: SeverityWarning, MsgID: "alert", Msg: "line 1\nline 2"})
+	e.Export(Message{Severity: SeverityInfo, MsgID: "event", Msg: "second"})
+	got := receive(t, frames, 2)
+	if got[0] != "<84>1 - h apss-controller - alert - line 1\nline 2" || !strings.HasSuffix(got[1], " event - second") {
+		t.Errorf("messages = %q", got)
+	}
+}
+
+func TestExporter_TLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: srv.TLS.Certificates})
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+	}
+	defer ln.Close()
+	frames := collector(t, ln)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewExporter(Config{Address: ln.Addr().String(), Egress: egress.Config{CAFile: caFile}}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	e.Export(Message{Severity: SeverityCritical, MsgID: "alert", Msg: "CEF:0|a|b|c|d|e|10|"})
+	if got := receive(t, frames, 1); got[0] != "<82>1 - - apss-controller - alert - CEF:0|a|b|c|d|e|10|" {
+		t.Errorf("message = %q", got[0])
+	}
+	e.Export(Message{Severity: SeverityInfo, MsgID: "event"})
+	receive(t, frames, 1)
+}
+
+func TestExporter_Reconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot bind for test: %v", err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 2)
+	frames := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := r.ReadString(' '); err != nil {
+						return
+					}
+					line, _ := r.ReadString('!')
+					frames <- line
+				}
+			}()
+		}
+	}()
+
+	e, err := NewExporter(Config{Address: ln.Addr().String(), Protocol: ProtocolTCP}, logrus.New())
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	e.Export(Message{MsgID: "a", Msg: "first!"})
+	receive(t, frames, 1)
+	// The collector closes the idle connection; the next message is sent
+	// on a new one instead of being lost.
+	(<-conns).Close()
+	time.Sleep(50 * time.Millisecond)
+	e.Export(Message{MsgID: "a", Msg: "second!"})
+	if got := receive(t, frames, 1); !strings.HasSuffix(got[0], "second!") {
+		t.Errorf("message = %q", got[0])
+	}
+	select {
+	case <-conns:
+	default:
+		t.Error("exporter did not reconnect")
+	}
+}
+
+func TestNewExporter_Invalid(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"no port":        {Address: "siem.example.com"},
+		"protocol":       {Address: "siem:6514", Protocol: "udp"},
+		"facility":       {Address: "siem:6514", Facility: 24},
+		"proxy":          {Address: "siem:6514", Egress: egress.Config{ProxyURL: "http://proxy:3128"}},
+		"tls over tcp":   {Address: "siem:514", Protocol: ProtocolTCP, Egress: egress.Config{InsecureSkipVerify: true}},
+		"missing bundle": {Address: "siem:6514", Egress: egress.Config{CAFile: "/nonexistent.pem"}},
+	} {
+		if _, err := NewExporter(cfg, logrus.New()); err == nil {
+			t.Errorf("%s: NewExporter succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package syslog
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severities of RFC 5424 section 6.2.1 used for security records.
+const (
+	SeverityCritical = 2
+	SeverityError    = 3
+	SeverityWarning  = 4
+	SeverityNotice   = 5
+	SeverityInfo     = 6
+)
+
+// Header field limits of RFC 5424 section 6.
+const (
+	maxHostname = 255
+	maxAppName  = 48
+	maxMsgID    = 32
+	maxSDName   = 32
+)
+
+// Message is one syslog message.
+type Message struct {
+	Time     time.Time
+	Severity int
+	// MsgID identifies the type of message, e.g. "alert".
+	MsgID          string
+	StructuredData []SDElement
+	// Msg is the free-form message, e.g. a CEF record or a JSON document.
+	Msg string
+}
+
+// SDElement is an RFC 5424 structured data element. Its ID must either be
+// registered with IANA or of the form name@enterprise-number.
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// SDParam is one name="value" parameter of an SDElement.
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// AppendRFC5424 appends m as an RFC 5424 message from appName on hostname,
+// without framing. Header fields are truncated to their limits and
+// characters they may not contain are replaced with underscores.
+func (m *Message) AppendRFC5424(b []byte, facility int, hostname, appName string) []byte {
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(facility*8+m.Severity), 10)
+	b = append(b, ">1 "...)
+	if m.Time.IsZero() {
+		b = append(b, '-')
+	} else {
+		b = m.Time.UTC().AppendFormat(b, "2006-01-02T15:04:05.000000Z07:00")
+	}
+	b = append(b, ' ')
+	b = appendHeaderField(b, hostname, maxHostname)
+	b = append(b, ' ')
+	b = appendHeaderField(b, appName, maxAppName)
+	b = append(b, " - "...)
+	b = appendHeaderField(b, m.MsgID, maxMsgID)
+	b = append(b, ' ')
+	if len(m.StructuredData) == 0 {
+		b = append(b, '-')
+	}
+	for _, sd := range m.StructuredData {
+		b = append(b, '[')
+		b = appendSDName(b, sd.ID)
+		for _, p := range sd.Params {
+			b = append(b, ' ')
+			b = appendSDName(b, p.Name)
+			b = append(b, `="`...)
+			b = appendSDValue(b, p.Value)
+			b = append(b, '"')
+		}
+		b = append(b, ']')
+	}
+	if m.Msg != "" {
+		b = append(b, ' ')
+		b = append(b, m.Msg...)
+	}
+	return b
+}
+
+// appendHeaderField appends s as a header field of at most limit printable
+// ASCII characters, or the nil value "-" when it is empty.
+func appendHeaderField(b []byte, s string, limit int) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	for i := 0; i < len(s) && i < limit; i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// appendSDName appends an SD-ID or PARAM-NAME, which may not contain '=',
+// space, ']' or '"'.
+func appendSDName(b []byte, s string) []byte {
+	for i := 0; i < len(s) && i < maxSDName; i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// appendSDValue appends a PARAM-VALUE with '"', '\' and ']' escaped.
+func appendSDValue(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\', ']':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// CEF is an ArcSight Common Event Format record.
+type CEF struct {
+	DeviceVendor  string
+	DeviceProduct string
+	DeviceVersion string
+	SignatureID   string
+	Name          string
+	// Severity is 0 (lowest) to 10 (highest).
+	Severity   int
+	Extensions []CEFExtension
+}
+
+// CEFExtension is one key=value pair of a CEF record's extension. Keys
+// should be from the CEF dictionary, such as rt, msg or cs1 and cs1Label.
+type CEFExtension struct {
+	Key   string
+	Value string
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// String renders the record as CEF version 0. Extensions with an empty
+// value are left out.
+func (c *CEF) String() string {
+	var sb strings.Builder
+	sb.WriteString("CEF:0")
+	for _, h := range []string{c.DeviceVendor, c.DeviceProduct, c.DeviceVersion, c.SignatureID, c.Name} {
+		sb.WriteByte('|')
+		sb.WriteString(cefHeaderEscaper.Replace(h))
+	}
+	sb.WriteByte('|')
+	sb.WriteString(strconv.Itoa(min(max(c.Severity, 0), 10)))
+	sb.WriteByte('|')
+	first := true
+	for _, ext := range c.Extensions {
+		if ext.Value == "" {
+			continue
+		}
+		if !first {
+			sb.WriteByte(' ')
+		}
+		first = false
+		sb.WriteString(ext.Key)
+		sb.WriteByte('=')
+		sb.WriteString(cefValueEscaper.Replace(ext.Value))
+	}
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMessage_AppendRFC5424(t *testing.T) {
+	m := Message{
+		Time:     time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.FixedZone("CET", 3600)),
+		Severity: SeverityError,
+		MsgID:    "alert",
+		StructuredData: []SDElement{{ID: "apss@32473", Params: []SDParam{
+			{Name: "rule_id", Value: "APSS-001"},
+			{Name: "description", Value: `a "quoted" \ [value]`},
+		}}},
+		Msg: `{"id":"a-1"}`,
+	}
+	want := `<83>1 2026-01-02T02:04:05.123456Z controller-0 apss-controller - alert ` +
+		`[apss@32473 rule_id="APSS-001" description="a \"quoted\" \\ [value\]"] {"id":"a-1"}`
+	if got := string(m.AppendRFC5424(nil, 10, "controller-0", "apss-controller")); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// Empty fields are the nil value; invalid header characters are replaced.
+	m = Message{Severity: SeverityInfo}
+	want = `<14>1 - - my_app - - -`
+	if got := string(m.AppendRFC5424(nil, 1, "", "my app")); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestCEF_String(t *testing.T) {
+	c := CEF{
+		DeviceVendor:  "Invisible",
+		DeviceProduct: "APSS",
+		DeviceVersion: "1.0",
+		SignatureID:   "APSS-001",
+		Name:          "Reverse shell | netcat",
+		Severity:      12,
+		Extensions: []CEFExtension{
+			{Key: "msg", Value: "a=b \\ c\nd"},
+			{Key: "cs1", Value: ""},
+			{Key: "externalId", Value: "a-1"},
+		},
+	}
+	want := `CEF:0|Invisible|APSS|1.0|APSS-001|Reverse shell \| netcat|10|msg=a\=b \\ c\nd externalId=a-1`
+	if got := c.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package yara
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// IsRuleFile reports whether name has a YARA rule file extension.
+func IsRuleFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yar" || ext == ".yara"
+}
+
+// LoadDir compiles the rule files (*.yar, *.yara) in dir, in name order,
+// into one bundle: their concatenated source and its rules. A file that does
+// not compile on its own, or defines a rule an earlier file has, is left
+// out and reported in the joined error, so rules may only refer to rules in
+// the same file.
+func LoadDir(dir string) ([]byte, *Rules, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read yara rules dir: %w", err)
+	}
+	var (
+		bundle bytes.Buffer
+		errs   []error
+	)
+	seen := make(map[string]string)
+	for _, ent := range entries {
+		if ent.IsDir() || !IsRuleFile(ent.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, ent.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules, err := Compile(string(data))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ent.Name(), err))
+			continue
+		}
+		if dup := firstDuplicate(rules, seen); dup != "" {
+			errs = append(errs, fmt.Errorf("%s: duplicate rule %s (also in %s)", ent.Name(), dup, seen[dup]))
+			continue
+		}
+		for _, name := range rules.Names() {
+			seen[name] = ent.Name()
+		}
+		fmt.Fprintf(&bundle, "// %s\n%s\n", ent.Name(), bytes.TrimRight(data, "\n"))
+	}
+	rules, err := Compile(bundle.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return bundle.Bytes(), rules, errors.Join(errs...)
+}
+
+func firstDuplicate(rules *Rules, seen map[string]string) string {
+	for _, name := range rules.Names() {
+		if _, ok := seen[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,756 @@
+package yara
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Error is a rule source error, with the line it was found on.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokStringID // $name, $name* or $
+	tokCount    // #name
+	tokInt
+	tokText
+	tokPunct
+)
+
+type token struct {
+	kind tokKind
+	text string
+	val  int64
+	line int
+}
+
+// parser compiles rule source. Errors are raised by panicking with an
+// *Error, recovered in Compile, as the grammar is deeply recursive.
+type parser struct {
+	src  string
+	pos  int
+	line int
+
+	rules   []*rule
+	strings []*stringDef
+	byName  map[string]int
+
+	// cur is the rule being parsed.
+	cur *rule
+}
+
+// Compile parses rule source. Every error names the line it was found on.
+func Compile(src string) (rs *Rules, err error) {
+	p := &parser{src: src, line: 1, byName: make(map[string]int)}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			rs, err = nil, e
+		}
+	}()
+	for {
+		t := p.next()
+		switch {
+		case t.kind == tokEOF:
+			return &Rules{rules: p.rules, strings: p.strings}, nil
+		case t.kind == tokIdent && (t.text == "import" || t.text == "include"):
+			p.failAt(t.line, "%s is not supported", t.text)
+		}
+		p.parseRule(t)
+	}
+}
+
+func (p *parser) failAt(line int, format string, args ...interface{}) {
+	panic(&Error{Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) fail(t token, format string, args ...interface{}) {
+	p.failAt(t.line, format, args...)
+}
+
+// skip moves past white space and comments.
+func (p *parser) skip() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.failAt(p.line, "unterminated comment")
+			}
+			p.line += strings.Count(p.src[p.pos:p.pos+2+end], "\n")
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// next lexes the next token.
+func (p *parser) next() token {
+	p.skip()
+	t := token{line: p.line}
+	if p.pos >= len(p.src) {
+		return t
+	}
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case c == '$' || c == '#':
+		p.pos++
+		for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+			p.pos++
+		}
+		t.kind = tokCount
+		if c == '$' {
+			t.kind = tokStringID
+			if p.pos < len(p.src) && p.src[p.pos] == '*' {
+				p.pos++
+			}
+		}
+	case c >= '0' && c <= '9':
+		return p.lexInt(t)
+	case isIdentByte(c):
+		for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+			p.pos++
+		}
+		t.kind = tokIdent
+	case c == '"':
+		t.kind = tokText
+		t.text = p.lexText()
+		return t
+	default:
+		t.kind = tokPunct
+		for _, op := range []string{"==", "!=", "<=", ">=", ".."} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				t.text = op
+				return t
+			}
+		}
+		p.pos++
+	}
+	t.text = p.src[start:p.pos]
+	return t
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() token {
+	pos, line := p.pos, p.line
+	t := p.next()
+	p.pos, p.line = pos, line
+	return t
+}
+
+// accept consumes the next token if it is text.
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tokPunct || t.kind == tokIdent) && t.text == text {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) token {
+	t := p.next()
+	if (t.kind != tokPunct && t.kind != tokIdent) || t.text != text {
+		p.fail(t, "expected %q, found %s", text, describe(t))
+	}
+	return t
+}
+
+func describe(t token) string {
+	if t.kind == tokEOF {
+		return "end of rules"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lexInt lexes a decimal or 0x hexadecimal integer, with an optional KB or
+// MB suffix.
+func (p *parser) lexInt(t token) token {
+	start := p.pos
+	base := 10
+	if strings.HasPrefix(p.src[p.pos:], "0x") {
+		base = 16
+		p.pos += 2
+		start = p.pos
+	}
+	for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	mult := int64(1)
+	if base == 10 {
+		if strings.HasSuffix(text, "KB") {
+			text, mult = strings.TrimSuffix(text, "KB"), 1024
+		} else if strings.HasSuffix(text, "MB") {
+			text, mult = strings.TrimSuffix(text, "MB"), 1024*1024
+		}
+	}
+	v, err := strconv.ParseInt(text, base, 64)
+	if err != nil {
+		p.fail(t, "invalid number %q", p.src[start:p.pos])
+	}
+	t.kind, t.val, t.text = tokInt, v*mult, p.src[start:p.pos]
+	return t
+}
+
+// lexText lexes a double-quoted string with C escapes.
+func (p *parser) lexText() string {
+	line := p.line
+	var b strings.Builder
+	for p.pos++; ; p.pos++ {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.failAt(line, "unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			return b.String()
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		p.pos++
+		if p.pos >= len(p.src) {
+			p.failAt(line, "unterminated string")
+		}
+		switch e := p.src[p.pos]; e {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(e)
+		case 'x':
+			if p.pos+2 >= len(p.src) {
+				p.failAt(line, "invalid \\x escape")
+			}
+			v, err := strconv.ParseUint(p.src[p.pos+1:p.pos+3], 16, 8)
+			if err != nil {
+				p.failAt(line, "invalid \\x escape")
+			}
+			b.WriteByte(byte(v))
+			p.pos += 2
+		default:
+			p.failAt(line, "unknown escape \\%c", e)
+		}
+	}
+}
+
+// parseRule parses a rule; t is its first token.
+func (p *parser) parseRule(t token) {
+	r := &rule{meta: make(map[string]string), stringIDs: make(map[string]int)}
+	for t.kind == tokIdent && (t.text == "private" || t.text == "global") {
+		if t.text == "private" {
+			r.private = true
+		} else {
+			r.global = true
+		}
+		t = p.next()
+	}
+	if t.kind != tokIdent || t.text != "rule" {
+		p.fail(t, "expected rule, found %s", describe(t))
+	}
+	name := p.next()
+	if name.kind != tokIdent || isKeyword(name.text) {
+		p.fail(name, "invalid rule name %s", describe(name))
+	}
+	if _, dup := p.byName[name.text]; dup {
+		p.fail(name, "duplicate rule %s", name.text)
+	}
+	r.name = name.text
+	if p.accept(":") {
+		for p.peek().kind == tokIdent {
+			r.tags = append(r.tags, p.next().text)
+		}
+		if len(r.tags) == 0 {
+			p.fail(p.peek(), "expected tags after ':'")
+		}
+	}
+	p.expect("{")
+	p.cur = r
+	if p.accept("meta") {
+		p.expect(":")
+		p.parseMeta(r)
+	}
+	if p.accept("strings") {
+		p.expect(":")
+		p.parseStrings(r)
+	}
+	p.expect("condition")
+	p.expect(":")
+	r.cond = p.parseOr()
+	if t := p.next(); t.kind != tokPunct || t.text != "}" {
+		p.fail(t, "unexpected %s in condition", describe(t))
+	}
+	p.cur = nil
+	p.byName[r.name] = len(p.rules)
+	p.rules = append(p.rules, r)
+}
+
+func (p *parser) parseMeta(r *rule) {
+	for {
+		t := p.peek()
+		if t.kind != tokIdent || t.text == "strings" || t.text == "condition" {
+			return
+		}
+		p.next()
+		p.expect("=")
+		v := p.next()
+		switch {
+		case v.kind == tokText || v.kind == tokInt:
+			r.meta[t.text] = v.text
+		case v.kind == tokIdent && (v.text == "true" || v.text == "false"):
+			r.meta[t.text] = v.text
+		case v.kind == tokPunct && v.text == "-":
+			n := p.next()
+			if n.kind != tokInt {
+				p.fail(n, "invalid value for meta %s", t.text)
+			}
+			r.meta[t.text] = "-" + n.text
+		default:
+			p.fail(v, "invalid value for meta %s", t.text)
+		}
+	}
+}
+
+func (p *parser) parseStrings(r *rule) {
+	for p.peek().kind == tokStringID {
+		id := p.next()
+		if strings.HasSuffix(id.text, "*") {
+			p.fail(id, "invalid string identifier %s", id.text)
+		}
+		if _, dup := r.stringIDs[id.text]; dup && id.text != "$" {
+			p.fail(id, "duplicate string %s", id.text)
+		}
+		p.expect("=")
+		p.skip()
+		s := &stringDef{id: id.text, line: p.line}
+		switch {
+		case p.pos < len(p.src) && p.src[p.pos] == '"':
+			s.kind = stringText
+			s.text = []byte(p.lexText())
+			if len(s.text) == 0 {
+				p.fail(id, "empty string %s", id.text)
+			}
+		case p.pos < len(p.src) && p.src[p.pos] == '{':
+			s.kind = stringHex
+			s.hex = p.parseHex()
+		case p.pos < len(p.src) && p.src[p.pos] == '/':
+			s.kind = stringRegex
+			s.pattern = p.lexRegex()
+		default:
+			p.fail(id, "expected a string, hex string or regular expression for %s", id.text)
+		}
+		p.parseModifiers(s)
+		if s.kind == stringRegex {
+			if s.nocase {
+				s.pattern = "(?i)" + s.pattern
+			}
+			re, err := regexp.Compile(s.pattern)
+			if err != nil {
+				p.fail(id, "%s: %v", id.text, err)
+			}
+			s.re = re
+		}
+		if id.text != "$" {
+			r.stringIDs[id.text] = len(p.strings)
+		}
+		r.strings = append(r.strings, len(p.strings))
+		p.strings = append(p.strings, s)
+	}
+	if len(r.strings) == 0 {
+		p.fail(p.peek(), "no strings in strings section")
+	}
+}
+
+// parseModifiers parses the modifiers after a string.
+func (p *parser) parseModifiers(s *stringDef) {
+	for {
+		t := p.peek()
+		if t.kind != tokIdent || t.text == "condition" {
+			return
+		}
+		p.next()
+		switch t.text {
+		case "nocase":
+			if s.kind == stringHex {
+				p.fail(t, "nocase is not valid for hex strings")
+			}
+			s.nocase = true
+		case "wide":
+			if s.kind != stringText {
+				p.fail(t, "wide is only supported for text strings")
+			}
+			s.wide = true
+		case "ascii":
+			s.ascii = true
+		case "fullword":
+			if s.kind == stringHex {
+				p.fail(t, "fullword is not valid for hex strings")
+			}
+			s.fullword = true
+		case "private":
+		case "xor", "base64", "base64wide":
+			p.fail(t, "modifier %s is not supported", t.text)
+		default:
+			p.fail(t, "unknown modifier %s", t.text)
+		}
+	}
+}
+
+// lexRegex lexes /pattern/ and its i and s flags into a Go pattern.
+func (p *parser) lexRegex() string {
+	line := p.line
+	var b strings.Builder
+	for p.pos++; ; p.pos++ {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.failAt(line, "unterminated regular expression")
+		}
+		c := p.src[p.pos]
+		if c == '/' {
+			p.pos++
+			break
+		}
+		if c == '\\' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '/' {
+			p.pos++
+			c = '/'
+		} else if c == '\\' && p.pos+1 < len(p.src) {
+			b.WriteByte(c)
+			p.pos++
+			c = p.src[p.pos]
+		}
+		b.WriteByte(c)
+	}
+	if b.Len() == 0 {
+		p.failAt(line, "empty regular expression")
+	}
+	flags := ""
+	for p.pos < len(p.src) && (p.src[p.pos] == 'i' || p.src[p.pos] == 's') {
+		flags += p.src[p.pos : p.pos+1]
+		p.pos++
+	}
+	if p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+		p.failAt(line, "unknown regular expression flag %q", p.src[p.pos])
+	}
+	if flags != "" {
+		return "(?" + flags + ")" + b.String()
+	}
+	return b.String()
+}
+
+// parseHex parses a hex string: bytes with ? nibble wildcards, jumps such
+// as [4] or [2-8], and alternatives such as (01 | 02 03).
+func (p *parser) parseHex() []hexNode {
+	line := p.line
+	p.pos++
+	nodes := p.parseHexSeq(line, "}")
+	p.pos++
+	if len(nodes) == 0 || nodes[0].kind == hexJump || nodes[len(nodes)-1].kind == hexJump {
+		p.failAt(line, "hex string must start and end with a byte")
+	}
+	return nodes
+}
+
+// parseHexSeq parses hex tokens up to one of the terminator bytes in end,
+// leaving it to the caller.
+func (p *parser) parseHexSeq(line int, end string) []hexNode {
+	var nodes []hexNode
+	for {
+		p.skip()
+		if p.pos >= len(p.src) {
+			p.failAt(line, "unterminated hex string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case strings.IndexByte(end, c) >= 0:
+			return nodes
+		case c == '[':
+			nodes = append(nodes, p.parseJump())
+		case c == '(':
+			p.pos++
+			alt := hexNode{kind: hexAlt}
+			for {
+				seq := p.parseHexSeq(line, "|)")
+				if len(seq) == 0 {
+					p.failAt(p.line, "empty alternative in hex string")
+				}
+				alt.alts = append(alt.alts, seq)
+				c := p.src[p.pos]
+				p.pos++
+				if c == ')' {
+					break
+				}
+			}
+			nodes = append(nodes, alt)
+		case c == '~':
+			p.failAt(p.line, "~ is not supported in hex strings")
+		default:
+			if p.pos+1 >= len(p.src) {
+				p.failAt(line, "unterminated hex string")
+			}
+			node := hexNode{kind: hexByte}
+			for i := 0; i < 2; i++ {
+				d := p.src[p.pos+i]
+				shift := uint(4 * (1 - i))
+				if d == '?' {
+					continue
+				}
+				v, err := strconv.ParseUint(string(d), 16, 8)
+				if err != nil {
+					p.failAt(p.line, "invalid hex byte %q", p.src[p.pos:p.pos+2])
+				}
+				node.value |= byte(v) << shift
+				node.mask |= 0xf << shift
+			}
+			nodes = append(nodes, node)
+			p.pos += 2
+		}
+	}
+}
+
+// parseJump parses [n], [n-m], [n-] or [-].
+func (p *parser) parseJump() hexNode {
+	line := p.line
+	end := strings.IndexByte(p.src[p.pos:], ']')
+	if end < 0 {
+		p.failAt(line, "unterminated jump in hex string")
+	}
+	spec := strings.TrimSpace(p.src[p.pos+1 : p.pos+end])
+	p.pos += end + 1
+	node := hexNode{kind: hexJump, max: -1}
+	lo, hi, isRange := strings.Cut(spec, "-")
+	var err error
+	if lo = strings.TrimSpace(lo); lo != "" {
+		if node.min, err = strconv.Atoi(lo); err != nil || node.min < 0 {
+			p.failAt(line, "invalid jump [%s]", spec)
+		}
+	}
+	switch hi = strings.TrimSpace(hi); {
+	case !isRange:
+		if lo == "" {
+			p.failAt(line, "invalid jump [%s]", spec)
+		}
+		node.max = node.min
+	case hi != "":
+		if node.max, err = strconv.Atoi(hi); err != nil || node.max < node.min {
+			p.failAt(line, "invalid jump [%s]", spec)
+		}
+	}
+	return node
+}
+
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "all": true, "any": true, "none": true,
+	"of": true, "them": true, "at": true, "in": true, "filesize": true,
+	"true": true, "false": true, "rule": true, "private": true, "global": true,
+	"meta": true, "strings": true, "condition": true, "for": true,
+}
+
+func isKeyword(s string) bool { return keywords[s] }
+
+// Condition grammar, loosest first: or, and, not, comparison, + and -,
+// then primary expressions.
+
+func (p *parser) parseOr() expr {
+	x := p.parseAnd()
+	for p.accept("or") {
+		x = &logicExpr{or: true, l: x, r: p.parseAnd()}
+	}
+	return x
+}
+
+func (p *parser) parseAnd() expr {
+	x := p.parseNot()
+	for p.accept("and") {
+		x = &logicExpr{l: x, r: p.parseNot()}
+	}
+	return x
+}
+
+func (p *parser) parseNot() expr {
+	if p.accept("not") {
+		return &notExpr{x: p.parseNot()}
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() expr {
+	x := p.parseSum()
+	t := p.peek()
+	if t.kind == tokPunct {
+		switch t.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+			p.next()
+			return &cmpExpr{op: t.text, l: x, r: p.parseSum()}
+		}
+	}
+	return x
+}
+
+func (p *parser) parseSum() expr {
+	x := p.parsePrimary()
+	for {
+		t := p.peek()
+		if t.kind != tokPunct || (t.text != "+" && t.text != "-") {
+			return x
+		}
+		p.next()
+		x = &arithExpr{minus: t.text == "-", l: x, r: p.parsePrimary()}
+	}
+}
+
+func (p *parser) parsePrimary() expr {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		if p.peek().text == "of" {
+			return p.parseOf(t, &numExpr{v: t.val})
+		}
+		return &numExpr{v: t.val}
+	case tokStringID:
+		idx := p.stringRef(t)
+		switch {
+		case p.accept("at"):
+			return &atExpr{str: idx, off: p.parseSum()}
+		case p.accept("in"):
+			p.expect("(")
+			lo := p.parseSum()
+			p.expect("..")
+			hi := p.parseSum()
+			p.expect(")")
+			return &inExpr{str: idx, lo: lo, hi: hi}
+		}
+		return &matchExpr{str: idx}
+	case tokCount:
+		return &countExpr{str: p.stringRef(token{kind: tokStringID, text: "$" + t.text[1:], line: t.line})}
+	case tokPunct:
+		if t.text == "(" {
+			x := p.parseOr()
+			p.expect(")")
+			return x
+		}
+		if t.text == "-" {
+			if n := p.next(); n.kind == tokInt {
+				return &numExpr{v: -n.val}
+			}
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &numExpr{v: 1}
+		case "false":
+			return &numExpr{v: 0}
+		case "filesize":
+			return filesizeExpr{}
+		case "any", "all", "none":
+			return p.parseOf(t, nil)
+		case "uint8", "uint16", "uint32", "uint16be", "uint32be", "int8", "int16", "int32", "int16be", "int32be":
+			p.expect("(")
+			off := p.parseSum()
+			p.expect(")")
+			return newIntExpr(t.text, off)
+		case "for", "entrypoint":
+			p.fail(t, "%s is not supported", t.text)
+		}
+		if idx, ok := p.byName[t.text]; ok {
+			return &ruleExpr{rule: idx}
+		}
+		if p.peek().text == "." {
+			p.fail(t, "modules are not supported (%s)", t.text)
+		}
+		p.fail(t, "undefined identifier %s", t.text)
+	}
+	p.fail(t, "unexpected %s in condition", describe(t))
+	return nil
+}
+
+// parseOf parses the string set after a quantifier: "of them" or
+// "of ($a, $b*)". n is the count for a numeric quantifier.
+func (p *parser) parseOf(q token, n expr) expr {
+	p.expect("of")
+	x := &ofExpr{quant: q.text, n: n}
+	if p.accept("them") {
+		x.set = p.cur.strings
+	} else {
+		p.expect("(")
+		for {
+			id := p.next()
+			if id.kind != tokStringID {
+				p.fail(id, "expected a string identifier, found %s", describe(id))
+			}
+			x.set = append(x.set, p.stringSet(id)...)
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(")")
+	}
+	if len(x.set) == 0 {
+		p.fail(q, "no strings for %s of", q.text)
+	}
+	return x
+}
+
+// stringRef resolves a string identifier of the current rule.
+func (p *parser) stringRef(t token) int {
+	if strings.HasSuffix(t.text, "*") || t.text == "$" {
+		p.fail(t, "%s can only be used in a string set", t.text)
+	}
+	idx, ok := p.cur.stringIDs[t.text]
+	if !ok {
+		p.fail(t, "undefined string %s", t.text)
+	}
+	return idx
+}
+
+// stringSet resolves $name or the $prefix* wildcard in a string set.
+func (p *parser) stringSet(t token) []int {
+	prefix, wild := strings.CutSuffix(t.text, "*")
+	if !wild {
+		return []int{p.stringRef(t)}
+	}
+	var set []int
+	for _, idx := range p.cur.strings {
+		if id := p.strings[idx].id; id != "$" && strings.HasPrefix(id, prefix) {
+			set = append(set, idx)
+		}
+	}
+	if len(set) == 0 {
+		p.fail(t, "no strings match %s", t.text)
+	}
+	return set
+}
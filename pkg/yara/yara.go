@@ -0,0 +1,472 @@
+// Package yara matches data against YARA rules. It implements, in pure Go so
+// the agent needs neither cgo nor libyara, the subset of the language that
+// content signatures use:
+//
+//   - private and global rules, tags and meta;
+//   - text strings with the nocase, wide, ascii, fullword and private
+//     modifiers;
+//   - hex strings with ? wildcards, jumps such as [4] or [2-8], and
+//     alternatives such as (01 | 02 03);
+//   - regular expressions with the i and s flags, in Go syntax;
+//   - conditions with and, or, not, comparisons, + and -, $a, #a,
+//     $a at N, $a in (N..M), any, all, none or N of them or of a set such
+//     as ($a, $b*), filesize, uint8 to int32be reads, and references to
+//     earlier rules.
+//
+// Modules, include, for loops and the xor and base64 modifiers are not
+// supported and fail to compile.
+package yara
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"strings"
+)
+
+// maxMatches bounds the matches kept per string and scan.
+const maxMatches = 1000
+
+// Rules are compiled rules, safe for concurrent scans.
+type Rules struct {
+	rules   []*rule
+	strings []*stringDef
+}
+
+// Match is a rule that matched.
+type Match struct {
+	Rule string
+	Tags []string
+	Meta map[string]string
+}
+
+// Names returns the names of the rules, in source order.
+func (rs *Rules) Names() []string {
+	names := make([]string, len(rs.rules))
+	for i, r := range rs.rules {
+		names[i] = r.name
+	}
+	return names
+}
+
+// Scan returns the public rules data matches, in source order.
+func (rs *Rules) Scan(data []byte) []Match {
+	sc := &scan{
+		rs:      rs,
+		data:    data,
+		matches: make([][]int, len(rs.strings)),
+		done:    make([]bool, len(rs.strings)),
+		results: make([]bool, len(rs.rules)),
+	}
+	for i, r := range rs.rules {
+		if r.global {
+			if sc.results[i] = r.cond.eval(sc) != 0; !sc.results[i] {
+				return nil
+			}
+		}
+	}
+	var out []Match
+	for i, r := range rs.rules {
+		if !r.global {
+			sc.results[i] = r.cond.eval(sc) != 0
+		}
+		if sc.results[i] && !r.private {
+			out = append(out, Match{Rule: r.name, Tags: r.tags, Meta: r.meta})
+		}
+	}
+	return out
+}
+
+type rule struct {
+	name    string
+	tags    []string
+	meta    map[string]string
+	private bool
+	global  bool
+	// strings are indexes into Rules.strings, stringIDs those by identifier.
+	strings   []int
+	stringIDs map[string]int
+	cond      expr
+}
+
+type stringKind int
+
+const (
+	stringText stringKind = iota
+	stringHex
+	stringRegex
+)
+
+type stringDef struct {
+	id   string
+	line int
+	kind stringKind
+
+	text    []byte
+	hex     []hexNode
+	pattern string
+	re      *regexp.Regexp
+
+	nocase, wide, ascii, fullword bool
+}
+
+type hexKind int
+
+const (
+	hexByte hexKind = iota
+	hexJump
+	hexAlt
+)
+
+// hexNode is a byte matched under mask, a jump of min to max bytes (max -1
+// for unbounded), or a choice of sequences.
+type hexNode struct {
+	kind        hexKind
+	value, mask byte
+	min, max    int
+	alts        [][]hexNode
+}
+
+// scan is the state of one Scan. String matches are found the first time a
+// condition needs them.
+type scan struct {
+	rs      *Rules
+	data    []byte
+	lower   []byte
+	matches [][]int
+	done    []bool
+	results []bool
+}
+
+// offsets returns where string idx matches.
+func (sc *scan) offsets(idx int) []int {
+	if !sc.done[idx] {
+		sc.done[idx] = true
+		sc.matches[idx] = sc.find(sc.rs.strings[idx])
+	}
+	return sc.matches[idx]
+}
+
+func (sc *scan) find(s *stringDef) []int {
+	switch s.kind {
+	case stringHex:
+		return findHex(s.hex, sc.data)
+	case stringRegex:
+		var offs []int
+		for _, loc := range s.re.FindAllIndex(sc.data, maxMatches) {
+			if !s.fullword || isWord(sc.data, loc[0], loc[1]) {
+				offs = append(offs, loc[0])
+			}
+		}
+		return offs
+	}
+	data := sc.data
+	if s.nocase {
+		if sc.lower == nil {
+			sc.lower = asciiLower(sc.data)
+		}
+		data = sc.lower
+	}
+	var offs []int
+	for _, needle := range textNeedles(s) {
+		for start := 0; len(offs) < maxMatches; {
+			i := bytes.Index(data[start:], needle)
+			if i < 0 {
+				break
+			}
+			i += start
+			if !s.fullword || isWord(data, i, i+len(needle)) {
+				offs = append(offs, i)
+			}
+			start = i + 1
+		}
+	}
+	return offs
+}
+
+// textNeedles returns the byte sequences a text string matches: ASCII,
+// UTF-16LE with wide, or both with wide and ascii.
+func textNeedles(s *stringDef) [][]byte {
+	text := s.text
+	if s.nocase {
+		text = asciiLower(text)
+	}
+	if !s.wide {
+		return [][]byte{text}
+	}
+	wide := make([]byte, 0, 2*len(text))
+	for _, c := range text {
+		wide = append(wide, c, 0)
+	}
+	if s.ascii {
+		return [][]byte{text, wide}
+	}
+	return [][]byte{wide}
+}
+
+func asciiLower(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// isWord reports whether data[start:end] is not preceded or followed by an
+// alphanumeric character.
+func isWord(data []byte, start, end int) bool {
+	alnum := func(c byte) bool {
+		return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	return (start == 0 || !alnum(data[start-1])) && (end >= len(data) || !alnum(data[end]))
+}
+
+func findHex(nodes []hexNode, data []byte) []int {
+	var offs []int
+	first := nodes[0]
+	for i := 0; i < len(data) && len(offs) < maxMatches; i++ {
+		if first.kind == hexByte && first.mask == 0xff {
+			j := bytes.IndexByte(data[i:], first.value)
+			if j < 0 {
+				break
+			}
+			i += j
+		}
+		if matchHex(nodes, data, i) >= 0 {
+			offs = append(offs, i)
+		}
+	}
+	return offs
+}
+
+// matchHex matches nodes at data[i:], returning the end of the match or -1.
+func matchHex(nodes []hexNode, data []byte, i int) int {
+	if len(nodes) == 0 {
+		return i
+	}
+	n, rest := nodes[0], nodes[1:]
+	switch n.kind {
+	case hexByte:
+		if i < len(data) && data[i]&n.mask == n.value {
+			return matchHex(rest, data, i+1)
+		}
+	case hexJump:
+		max := n.max
+		if max < 0 || i+max > len(data) {
+			max = len(data) - i
+		}
+		for j := n.min; j <= max; j++ {
+			if end := matchHex(rest, data, i+j); end >= 0 {
+				return end
+			}
+		}
+	case hexAlt:
+		for _, alt := range n.alts {
+			seq := append(append(make([]hexNode, 0, len(alt)+len(rest)), alt...), rest...)
+			if end := matchHex(seq, data, i); end >= 0 {
+				return end
+			}
+		}
+	}
+	return -1
+}
+
+// expr is a condition expression. Booleans evaluate to 1 or 0.
+type expr interface {
+	eval(sc *scan) int64
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type numExpr struct{ v int64 }
+
+func (x *numExpr) eval(*scan) int64 { return x.v }
+
+type filesizeExpr struct{}
+
+func (filesizeExpr) eval(sc *scan) int64 { return int64(len(sc.data)) }
+
+type logicExpr struct {
+	or   bool
+	l, r expr
+}
+
+func (x *logicExpr) eval(sc *scan) int64 {
+	l := x.l.eval(sc) != 0
+	if l == x.or {
+		return boolInt(l)
+	}
+	return boolInt(x.r.eval(sc) != 0)
+}
+
+type notExpr struct{ x expr }
+
+func (x *notExpr) eval(sc *scan) int64 { return boolInt(x.x.eval(sc) == 0) }
+
+type cmpExpr struct {
+	op   string
+	l, r expr
+}
+
+func (x *cmpExpr) eval(sc *scan) int64 {
+	l, r := x.l.eval(sc), x.r.eval(sc)
+	switch x.op {
+	case "==":
+		return boolInt(l == r)
+	case "!=":
+		return boolInt(l != r)
+	case "<":
+		return boolInt(l < r)
+	case "<=":
+		return boolInt(l <= r)
+	case ">":
+		return boolInt(l > r)
+	}
+	return boolInt(l >= r)
+}
+
+type arithExpr struct {
+	minus bool
+	l, r  expr
+}
+
+func (x *arithExpr) eval(sc *scan) int64 {
+	if x.minus {
+		return x.l.eval(sc) - x.r.eval(sc)
+	}
+	return x.l.eval(sc) + x.r.eval(sc)
+}
+
+type matchExpr struct{ str int }
+
+func (x *matchExpr) eval(sc *scan) int64 { return boolInt(len(sc.offsets(x.str)) > 0) }
+
+type countExpr struct{ str int }
+
+func (x *countExpr) eval(sc *scan) int64 { return int64(len(sc.offsets(x.str))) }
+
+type atExpr struct {
+	str int
+	off expr
+}
+
+func (x *atExpr) eval(sc *scan) int64 {
+	off := x.off.eval(sc)
+	for _, o := range sc.offsets(x.str) {
+		if int64(o) == off {
+			return 1
+		}
+	}
+	return 0
+}
+
+type inExpr struct {
+	str    int
+	lo, hi expr
+}
+
+func (x *inExpr) eval(sc *scan) int64 {
+	lo, hi := x.lo.eval(sc), x.hi.eval(sc)
+	for _, o := range sc.offsets(x.str) {
+		if int64(o) >= lo && int64(o) <= hi {
+			return 1
+		}
+	}
+	return 0
+}
+
+// ofExpr is "any", "all", "none" or n "of" a string set.
+type ofExpr struct {
+	quant string
+	n     expr
+	set   []int
+}
+
+func (x *ofExpr) eval(sc *scan) int64 {
+	want := int64(len(x.set))
+	switch x.quant {
+	case "any":
+		want = 1
+	case "none":
+		want = 0
+	case "all":
+	default:
+		want = x.n.eval(sc)
+	}
+	var matched int64
+	for _, idx := range x.set {
+		if len(sc.offsets(idx)) > 0 {
+			matched++
+		}
+		if x.quant != "none" && matched >= want {
+			return 1
+		}
+	}
+	if x.quant == "none" {
+		return boolInt(matched == 0)
+	}
+	return boolInt(matched >= want)
+}
+
+type ruleExpr struct{ rule int }
+
+func (x *ruleExpr) eval(sc *scan) int64 { return boolInt(sc.results[x.rule]) }
+
+// intExpr reads an integer at an offset; reads past the end are 0.
+type intExpr struct {
+	size   int
+	signed bool
+	big    bool
+	off    expr
+}
+
+func newIntExpr(name string, off expr) *intExpr {
+	x := &intExpr{off: off, big: strings.HasSuffix(name, "be")}
+	unsigned, ok := strings.CutPrefix(name, "u")
+	x.signed = !ok
+	switch strings.TrimSuffix(unsigned, "be") {
+	case "int8":
+		x.size = 1
+	case "int16":
+		x.size = 2
+	default:
+		x.size = 4
+	}
+	return x
+}
+
+func (x *intExpr) eval(sc *scan) int64 {
+	off := x.off.eval(sc)
+	if off < 0 || off+int64(x.size) > int64(len(sc.data)) {
+		return 0
+	}
+	b := sc.data[off : off+int64(x.size)]
+	var order binary.ByteOrder = binary.LittleEndian
+	if x.big {
+		order = binary.BigEndian
+	}
+	switch x.size {
+	case 1:
+		if x.signed {
+			return int64(int8(b[0]))
+		}
+		return int64(b[0])
+	case 2:
+		if x.signed {
+			return int64(int16(order.Uint16(b)))
+		}
+		return int64(order.Uint16(b))
+	}
+	if x.signed {
+		return int64(int32(order.Uint32(b)))
+	}
+	return int64(order.Uint32(b))
+}
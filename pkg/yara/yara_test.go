@@ -0,0 +1,177 @@
+package yara
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRules = `
+// Miner and dropper signatures
+private rule elf {
+    condition:
+        uint32(0) == 0x464c457f
+}
+
+rule xmrig : miner linux {
+    meta:
+        author = "apss"
+        score = 80
+    strings:
+        $pool = "stratum+tcp://" nocase
+        $name = "xmrig" fullword
+        $algo = /rand(om)?x/i
+    condition:
+        $pool and ($name or #algo > 1)
+}
+
+rule elf_dropper {
+    strings:
+        $hex = { 2F 74 6D 70 [1-4] ( 78 | 79 ) ?? 2E 5? }
+        $w = "payload" wide ascii
+    condition:
+        elf and filesize < 1MB and all of ($hex, $w*)
+}
+
+rule header_at {
+    strings:
+        $m = "MZ"
+    condition:
+        $m at 0 and uint16be(0) == 0x4d5a and not $m in (1..filesize)
+}
+`
+
+func TestScan(t *testing.T) {
+	rs, err := Compile(testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rs.Names(); !reflect.DeepEqual(got, []string{"elf", "xmrig", "elf_dropper", "header_at"}) {
+		t.Errorf("Names() = %v", got)
+	}
+
+	elf := "\x7fELF\x02\x01 /tmp//yZ.P p\x00a\x00y\x00l\x00o\x00a\x00d\x00"
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"miner", "connect STRATUM+TCP://pool:3333 using xmrig", []string{"xmrig"}},
+		{"miner by algo", "stratum+tcp://pool rx/0 RandomX randx", []string{"xmrig"}},
+		{"not fullword", "stratum+tcp://pool xmrigd", nil},
+		{"elf dropper", elf, []string{"elf_dropper"}},
+		{"dropper without elf header", elf[4:], nil},
+		{"hex alternative fails", strings.Replace(elf, "yZ", "zZ", 1), nil},
+		{"mz", "MZ\x90\x00", []string{"header_at"}},
+		{"mz twice", "MZ MZ", nil},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range rs.Scan([]byte(tt.data)) {
+				got = append(got, m.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	m := rs.Scan([]byte("stratum+tcp:// xmrig"))[0]
+	if !reflect.DeepEqual(m.Tags, []string{"miner", "linux"}) || m.Meta["author"] != "apss" || m.Meta["score"] != "80" {
+		t.Errorf("match = %+v", m)
+	}
+}
+
+func TestScan_GlobalAndQuantifiers(t *testing.T) {
+	_, err := Compile(`
+global rule small { condition: filesize < 64 }
+rule two { strings: $a = "a1" $b = "b2" $c = "c3" condition: 2 of them }
+rule none_of { strings: $a = "bad" condition: none of them }
+rule count { strings: $x = "x" condition: #x == 3 and @x_free }
+`)
+	if err == nil || !strings.Contains(err.Error(), "line 5") {
+		t.Fatalf("err = %v, want a line 5 error", err)
+	}
+	rs, err := Compile(`
+global rule small { condition: filesize < 64 }
+rule two { strings: $a = "a1" $b = "b2" $c = "c3" condition: 2 of them }
+rule none_of { strings: $a = "bad" condition: none of them }
+rule count { strings: $x = "x" condition: #x == 3 }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := func(data string) []string {
+		var names []string
+		for _, m := range rs.Scan([]byte(data)) {
+			names = append(names, m.Rule)
+		}
+		return names
+	}
+	if got := scan("a1 c3 x x x"); !reflect.DeepEqual(got, []string{"small", "two", "none_of", "count"}) {
+		t.Errorf("scan = %v", got)
+	}
+	if got := scan("a1 bad"); !reflect.DeepEqual(got, []string{"small"}) {
+		t.Errorf("scan = %v", got)
+	}
+	if got := scan(strings.Repeat("a1 c3 ", 20)); got != nil {
+		t.Errorf("global rule failed, scan = %v", got)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"module", "import \"pe\"\nrule a { condition: true }", "line 1: import is not supported"},
+		{"undefined string", "rule a {\n  strings:\n    $a = \"x\"\n  condition:\n    $b\n}", "line 5: undefined string $b"},
+		{"duplicate rule", "rule a { condition: true }\nrule a { condition: true }", "line 2: duplicate rule a"},
+		{"bad hex", "rule a {\n strings:\n  $h = { 4D ZZ }\n condition: $h }", "line 3: invalid hex byte"},
+		{"hex starting with jump", "rule a { strings: $h = { [2] 4D } condition: $h }", "must start and end with a byte"},
+		{"bad regex", "rule a {\n strings:\n  $r = /a(b/\n condition: $r }", "line 3: $r: error parsing regexp"},
+		{"xor", "rule a { strings: $a = \"x\" xor condition: $a }", "modifier xor is not supported"},
+		{"for", "rule a { strings: $a = \"x\" condition: for any i in (1..2): ($a) }", "for is not supported"},
+		{"undefined rule", "rule a { condition: b }", "undefined identifier b"},
+		{"missing condition", "rule a {\n meta:\n  x = 1\n}", "line 4: expected \"condition\""},
+		{"unterminated", "rule a { strings: $a = \"x condition: $a }", "unterminated string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yar":    "rule one { condition: true }",
+		"b.yara":   "rule two { condition: one }",
+		"c.yar":    "rule one { condition: false }",
+		"d.yar":    "rule three { condition: filesize > 0 }",
+		"skip.txt": "not rules",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source, rules, err := LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "b.yara: line 1: undefined identifier one") ||
+		!strings.Contains(err.Error(), "c.yar: duplicate rule one (also in a.yar)") {
+		t.Errorf("err = %v", err)
+	}
+	if got := rules.Names(); !reflect.DeepEqual(got, []string{"one", "three"}) {
+		t.Errorf("Names() = %v", got)
+	}
+	if !strings.Contains(string(source), "// d.yar\nrule three") {
+		t.Errorf("source = %s", source)
+	}
+}